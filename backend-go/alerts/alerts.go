@@ -0,0 +1,245 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const maxHistory = 500
+
+type State string
+
+const (
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// Alert records a metric crossing its threshold (firing) or dropping back
+// below threshold minus the hysteresis band (resolved).
+type Alert struct {
+	ID        string    `json:"id"`
+	Metric    string    `json:"metric"`
+	State     State     `json:"state"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Config struct {
+	// Thresholds maps a base metric ("cpu", "memory", "disk") to the
+	// percentage above which it fires. Zero disables the metric.
+	Thresholds      map[string]float64
+	Hysteresis      float64
+	WebhookURL      string
+	SlackWebhookURL string
+}
+
+type Monitor struct {
+	config  Config
+	active  map[string]*Alert
+	history []Alert
+	client  *http.Client
+	mu      sync.RWMutex
+}
+
+var Default = NewMonitor(Config{})
+
+func NewMonitor(cfg Config) *Monitor {
+	if cfg.Thresholds == nil {
+		cfg.Thresholds = map[string]float64{}
+	}
+	return &Monitor{
+		config: cfg,
+		active: make(map[string]*Alert),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Configure replaces the default monitor's settings, keeping its state.
+func Configure(cfg Config) {
+	if cfg.Thresholds == nil {
+		cfg.Thresholds = map[string]float64{}
+	}
+	Default.mu.Lock()
+	Default.config = cfg
+	Default.mu.Unlock()
+}
+
+// baseMetric strips the instance suffix, e.g. "disk:/var" -> "disk".
+func baseMetric(metric string) string {
+	return strings.SplitN(metric, ":", 2)[0]
+}
+
+// Evaluate checks the sampled values against their thresholds and returns the
+// alerts that changed state. An active alert resolves once its threshold is
+// disabled or its metric is no longer sampled. Notifications for them are
+// sent asynchronously.
+func (m *Monitor) Evaluate(values map[string]float64) []Alert {
+	now := time.Now()
+	changes := make([]Alert, 0)
+
+	m.mu.Lock()
+	metrics := make([]string, 0, len(values))
+	for metric := range values {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	for _, metric := range metrics {
+		value := values[metric]
+		threshold := m.config.Thresholds[baseMetric(metric)]
+		active := m.active[metric]
+
+		switch {
+		case threshold <= 0 && active != nil:
+			delete(m.active, metric)
+			changes = append(changes, resolved(active, value, fmt.Sprintf("%s threshold disabled at %.1f%%", metric, value), now))
+		case threshold <= 0:
+			continue
+		case active == nil && value > threshold:
+			alert := Alert{
+				ID:        uuid.New().String(),
+				Metric:    metric,
+				State:     StateFiring,
+				Value:     value,
+				Threshold: threshold,
+				Message:   fmt.Sprintf("%s at %.1f%% exceeds threshold of %.1f%%", metric, value, threshold),
+				Timestamp: now,
+			}
+			m.active[metric] = &alert
+			changes = append(changes, alert)
+		case active != nil && value < threshold-m.config.Hysteresis:
+			active.Threshold = threshold
+			delete(m.active, metric)
+			changes = append(changes, resolved(active, value, fmt.Sprintf("%s back to %.1f%% (threshold %.1f%%)", metric, value, threshold), now))
+		case active != nil:
+			active.Value = value
+		}
+	}
+
+	gone := make([]string, 0)
+	for metric := range m.active {
+		if _, sampled := values[metric]; !sampled {
+			gone = append(gone, metric)
+		}
+	}
+	sort.Strings(gone)
+	for _, metric := range gone {
+		active := m.active[metric]
+		delete(m.active, metric)
+		changes = append(changes, resolved(active, active.Value, fmt.Sprintf("%s is no longer sampled", metric), now))
+	}
+
+	m.history = append(m.history, changes...)
+	if len(m.history) > maxHistory {
+		m.history = m.history[len(m.history)-maxHistory:]
+	}
+	cfg := m.config
+	m.mu.Unlock()
+
+	for _, alert := range changes {
+		go m.notify(cfg, alert)
+	}
+	return changes
+}
+
+// resolved returns the resolution of an active alert.
+func resolved(active *Alert, value float64, message string, now time.Time) Alert {
+	return Alert{
+		ID:        active.ID,
+		Metric:    active.Metric,
+		State:     StateResolved,
+		Value:     value,
+		Threshold: active.Threshold,
+		Message:   message,
+		Timestamp: now,
+	}
+}
+
+// History returns up to limit recorded state changes, newest first.
+func (m *Monitor) History(limit int) []Alert {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if limit <= 0 || limit > len(m.history) {
+		limit = len(m.history)
+	}
+	history := make([]Alert, 0, limit)
+	for i := len(m.history) - 1; i >= 0 && len(history) < limit; i-- {
+		history = append(history, m.history[i])
+	}
+	return history
+}
+
+// Active returns the alerts currently firing.
+func (m *Monitor) Active() []Alert {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	active := make([]Alert, 0, len(m.active))
+	for _, alert := range m.active {
+		active = append(active, *alert)
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Metric < active[j].Metric })
+	return active
+}
+
+func (m *Monitor) Thresholds() (map[string]float64, float64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	thresholds := make(map[string]float64, len(m.config.Thresholds))
+	for metric, value := range m.config.Thresholds {
+		thresholds[metric] = value
+	}
+	return thresholds, m.config.Hysteresis
+}
+
+func (m *Monitor) notify(cfg Config, alert Alert) {
+	if cfg.WebhookURL != "" {
+		if err := m.post(cfg.WebhookURL, alert); err != nil {
+			log.Printf("Alerts: webhook notification failed: %v", err)
+		}
+	}
+
+	if cfg.SlackWebhookURL != "" {
+		icon := ":rotating_light:"
+		if alert.State == StateResolved {
+			icon = ":white_check_mark:"
+		}
+		payload := map[string]string{
+			"text": fmt.Sprintf("%s Performa resource alert (%s): %s", icon, alert.State, alert.Message),
+		}
+		if err := m.post(cfg.SlackWebhookURL, payload); err != nil {
+			log.Printf("Alerts: Slack notification failed: %v", err)
+		}
+	}
+}
+
+func (m *Monitor) post(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
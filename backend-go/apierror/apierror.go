@@ -0,0 +1,144 @@
+// Package apierror defines the errors the HTTP API returns. Handlers return
+// an *Error and the Fiber error handler renders it as
+//
+//	{"error": "...", "code": "NOT_FOUND", "request_id": "...", "details": {...}}
+//
+// so that clients can branch on the code instead of parsing the message.
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Code identifies the kind of failure.
+type Code string
+
+const (
+	ValidationFailed    Code = "VALIDATION_FAILED"
+	Unauthenticated     Code = "UNAUTHENTICATED"
+	Forbidden           Code = "FORBIDDEN"
+	NotFound            Code = "NOT_FOUND"
+	Conflict            Code = "CONFLICT"
+	PayloadTooLarge     Code = "PAYLOAD_TOO_LARGE"
+	RateLimited         Code = "RATE_LIMITED"
+	BrainUnavailable    Code = "BRAIN_UNAVAILABLE"
+	ProviderRateLimited Code = "PROVIDER_RATE_LIMITED"
+	ProviderError       Code = "PROVIDER_ERROR"
+	ServiceUnavailable  Code = "SERVICE_UNAVAILABLE"
+	NotImplemented      Code = "NOT_IMPLEMENTED"
+	Internal            Code = "INTERNAL"
+)
+
+// RequestIDLocalsKey is the Fiber locals key the request ID middleware
+// stores the request's ID under.
+const RequestIDLocalsKey = "requestid"
+
+// Error is an API error: the HTTP status, a code, a human-readable message and
+// optional details.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Details map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// New returns an error with an explicit code.
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Status returns an error whose code is the default one of status.
+func Status(status int, message string) *Error {
+	return New(status, CodeForStatus(status), message)
+}
+
+// With adds a detail to the error and returns it.
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// WithReason records the underlying cause as the "reason" detail.
+func (e *Error) WithReason(reason interface{}) *Error {
+	if reason == nil {
+		return e
+	}
+	if err, ok := reason.(error); ok {
+		reason = err.Error()
+	}
+	return e.With("reason", reason)
+}
+
+// CodeForStatus returns the code used for an HTTP status when no more
+// specific one applies.
+func CodeForStatus(status int) Code {
+	switch status {
+	case fiber.StatusBadRequest, fiber.StatusUnprocessableEntity:
+		return ValidationFailed
+	case fiber.StatusUnauthorized:
+		return Unauthenticated
+	case fiber.StatusForbidden:
+		return Forbidden
+	case fiber.StatusNotFound, fiber.StatusMethodNotAllowed:
+		return NotFound
+	case fiber.StatusConflict, fiber.StatusPreconditionFailed:
+		return Conflict
+	case fiber.StatusRequestEntityTooLarge:
+		return PayloadTooLarge
+	case fiber.StatusTooManyRequests:
+		return RateLimited
+	case fiber.StatusBadGateway:
+		return ProviderError
+	case fiber.StatusServiceUnavailable, fiber.StatusGatewayTimeout:
+		return ServiceUnavailable
+	case fiber.StatusNotImplemented:
+		return NotImplemented
+	}
+	if status >= 400 && status < 500 {
+		return ValidationFailed
+	}
+	return Internal
+}
+
+// Body is the JSON rendering of an error.
+type Body struct {
+	Error     string                 `json:"error"`
+	Code      Code                   `json:"code"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Handler is the Fiber error handler. It renders *Error values as they are,
+// Fiber's own errors (unknown routes, body limits) with the code of their
+// status, and anything else as an internal error whose cause is only logged.
+func Handler(c *fiber.Ctx, err error) error {
+	var apiErr *Error
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.As(err, &fiberErr):
+		apiErr = Status(fiberErr.Code, fiberErr.Message)
+	default:
+		log.Printf("API: %s %s failed: %v", c.Method(), c.Path(), err)
+		apiErr = New(fiber.StatusInternalServerError, Internal, "Internal server error")
+	}
+
+	requestID, _ := c.Locals(RequestIDLocalsKey).(string)
+	return c.Status(apiErr.Status).JSON(Body{
+		Error:     apiErr.Message,
+		Code:      apiErr.Code,
+		RequestID: requestID,
+		Details:   apiErr.Details,
+	})
+}
@@ -0,0 +1,552 @@
+// Package assets keeps an inventory of the hosts operations discover, built
+// from operation targets, tool output and results agents share.
+package assets
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+	"performa-backend/workspaces"
+
+	"github.com/google/uuid"
+)
+
+const (
+	KindDomain = "domain"
+	KindIP     = "ip"
+)
+
+// Service is a port found open on an asset. Host is the hostname or IP the
+// port was last seen open on.
+type Service struct {
+	Host      string    `json:"host,omitempty"`
+	Port      int       `json:"port"`
+	Protocol  string    `json:"protocol"`
+	Name      string    `json:"name,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Banner    string    `json:"banner,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Asset is one host. A hostname and the IPs it is seen to resolve to are the
+// same asset: observations that link them merge their assets. Each workspace
+// has its own inventory, so the same host may be an asset in several.
+type Asset struct {
+	ID           string    `json:"id"`
+	WorkspaceID  string    `json:"workspace_id"`
+	Kind         string    `json:"kind"`
+	Name         string    `json:"name"`
+	Hostnames    []string  `json:"hostnames"`
+	IPs          []string  `json:"ips"`
+	Services     []Service `json:"services"`
+	Technologies []string  `json:"technologies"`
+	OperationIDs []string  `json:"operation_ids"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// assetData is the part of an asset stored as JSON in the database.
+type assetData struct {
+	Hostnames    []string  `json:"hostnames"`
+	IPs          []string  `json:"ips"`
+	Services     []Service `json:"services"`
+	Technologies []string  `json:"technologies"`
+	OperationIDs []string  `json:"operation_ids"`
+	WorkspaceID  string    `json:"workspace_id,omitempty"`
+}
+
+// Observation is something learned about a host. Host may be a hostname, IP
+// or URL; IP, when set, is an address Host resolves to. Port, Technology and
+// OperationID are recorded when non-empty. WorkspaceID selects the inventory
+// the observation goes to.
+type Observation struct {
+	WorkspaceID string
+	Host        string
+	IP          string
+	Port        int
+	Protocol    string
+	Service     string
+	Version     string
+	Banner      string
+	Technology  string
+	OperationID string
+}
+
+// Identifiers returns the normalized hostnames and IPs an asset is known by.
+func (a *Asset) Identifiers() []string {
+	return append(append([]string(nil), a.Hostnames...), a.IPs...)
+}
+
+func (a *Asset) clone() *Asset {
+	copied := *a
+	copied.Hostnames = append([]string{}, a.Hostnames...)
+	copied.IPs = append([]string{}, a.IPs...)
+	copied.Services = append([]Service{}, a.Services...)
+	copied.Technologies = append([]string{}, a.Technologies...)
+	copied.OperationIDs = append([]string{}, a.OperationIDs...)
+	return &copied
+}
+
+// refresh must be called with the store's lock held.
+func (a *Asset) refresh() {
+	sort.Strings(a.Hostnames)
+	sort.Strings(a.IPs)
+	sort.Slice(a.Services, func(i, j int) bool {
+		if a.Services[i].Port != a.Services[j].Port {
+			return a.Services[i].Port < a.Services[j].Port
+		}
+		return a.Services[i].Protocol < a.Services[j].Protocol
+	})
+
+	if len(a.Hostnames) > 0 {
+		a.Kind, a.Name = KindDomain, a.Hostnames[0]
+	} else if len(a.IPs) > 0 {
+		a.Kind, a.Name = KindIP, a.IPs[0]
+	}
+}
+
+type Store struct {
+	assets map[string]*Asset
+	// index maps each workspace's hostnames and IPs, keyed by indexKey, to
+	// the asset that has them.
+	index map[string]string
+	mu    sync.RWMutex
+}
+
+func indexKey(workspaceID, identifier string) string {
+	return workspaceID + "/" + identifier
+}
+
+var Default = &Store{
+	assets: make(map[string]*Asset),
+	index:  make(map[string]string),
+}
+
+func addUnique(values []string, value string) ([]string, bool) {
+	for _, existing := range values {
+		if strings.EqualFold(existing, value) {
+			return values, false
+		}
+	}
+	return append(values, value), true
+}
+
+// Observe records an observation, creating or merging assets as needed, and
+// returns a copy of the asset it applies to, or nil when it names no host.
+func (s *Store) Observe(obs Observation) *Asset {
+	var hostnames, ips []string
+	for _, value := range []string{obs.Host, obs.IP} {
+		host, isIP, ok := NormalizeHost(value)
+		switch {
+		case !ok:
+		case isIP:
+			ips = append(ips, host)
+		default:
+			hostnames = append(hostnames, host)
+		}
+	}
+	if len(hostnames) == 0 && len(ips) == 0 {
+		return nil
+	}
+
+	workspace := workspaces.Normalize(obs.WorkspaceID)
+	now := time.Now()
+	s.mu.Lock()
+
+	var matches []*Asset
+	for _, identifier := range append(append([]string(nil), hostnames...), ips...) {
+		if id, ok := s.index[indexKey(workspace, identifier)]; ok {
+			asset := s.assets[id]
+			duplicate := false
+			for _, match := range matches {
+				duplicate = duplicate || match == asset
+			}
+			if !duplicate {
+				matches = append(matches, asset)
+			}
+		}
+	}
+
+	var asset *Asset
+	var merged []string
+	if len(matches) == 0 {
+		asset = &Asset{
+			ID:           uuid.New().String(),
+			WorkspaceID:  workspace,
+			Hostnames:    []string{},
+			IPs:          []string{},
+			Services:     []Service{},
+			Technologies: []string{},
+			OperationIDs: []string{},
+			FirstSeen:    now,
+		}
+		s.assets[asset.ID] = asset
+	} else {
+		sort.Slice(matches, func(i, j int) bool { return matches[i].FirstSeen.Before(matches[j].FirstSeen) })
+		asset = matches[0]
+		for _, other := range matches[1:] {
+			s.merge(asset, other)
+			merged = append(merged, other.ID)
+		}
+	}
+
+	for _, hostname := range hostnames {
+		asset.Hostnames, _ = addUnique(asset.Hostnames, hostname)
+		s.index[indexKey(asset.WorkspaceID, hostname)] = asset.ID
+	}
+	for _, ip := range ips {
+		asset.IPs, _ = addUnique(asset.IPs, ip)
+		s.index[indexKey(asset.WorkspaceID, ip)] = asset.ID
+	}
+	if obs.Port > 0 {
+		asset.addService(obs, now)
+	}
+	if technology := strings.TrimSpace(obs.Technology); technology != "" {
+		asset.Technologies, _ = addUnique(asset.Technologies, technology)
+	}
+	if obs.OperationID != "" {
+		asset.OperationIDs, _ = addUnique(asset.OperationIDs, obs.OperationID)
+	}
+	asset.LastSeen = now
+	asset.refresh()
+
+	result := asset.clone()
+	s.mu.Unlock()
+
+	for _, id := range merged {
+		if database.DB != nil {
+			database.DeleteAsset(id)
+		}
+	}
+	s.persist(result)
+	if obs.Port > 0 {
+		persistService(result.WorkspaceID, obs, now)
+	}
+	return result
+}
+
+// merge must be called with s.mu held. It folds other into asset and removes
+// other from the store.
+func (s *Store) merge(asset, other *Asset) {
+	for _, hostname := range other.Hostnames {
+		asset.Hostnames, _ = addUnique(asset.Hostnames, hostname)
+		s.index[indexKey(asset.WorkspaceID, hostname)] = asset.ID
+	}
+	for _, ip := range other.IPs {
+		asset.IPs, _ = addUnique(asset.IPs, ip)
+		s.index[indexKey(asset.WorkspaceID, ip)] = asset.ID
+	}
+	for _, service := range other.Services {
+		asset.addService(Observation{
+			Host:     service.Host,
+			Port:     service.Port,
+			Protocol: service.Protocol,
+			Service:  service.Name,
+			Version:  service.Version,
+			Banner:   service.Banner,
+		}, service.LastSeen)
+	}
+	for _, technology := range other.Technologies {
+		asset.Technologies, _ = addUnique(asset.Technologies, technology)
+	}
+	for _, operationID := range other.OperationIDs {
+		asset.OperationIDs, _ = addUnique(asset.OperationIDs, operationID)
+	}
+	if other.FirstSeen.Before(asset.FirstSeen) {
+		asset.FirstSeen = other.FirstSeen
+	}
+	delete(s.assets, other.ID)
+}
+
+// serviceProtocol is the protocol of a port observation, tcp by default.
+func serviceProtocol(obs Observation) string {
+	if protocol := strings.ToLower(obs.Protocol); protocol != "" {
+		return protocol
+	}
+	return "tcp"
+}
+
+// serviceHost is the normalized host a port observation was made on.
+func serviceHost(obs Observation) string {
+	for _, value := range []string{obs.Host, obs.IP} {
+		if host, _, ok := NormalizeHost(value); ok {
+			return host
+		}
+	}
+	return ""
+}
+
+func (a *Asset) addService(obs Observation, seen time.Time) {
+	protocol := serviceProtocol(obs)
+	host := serviceHost(obs)
+	for i := range a.Services {
+		service := &a.Services[i]
+		if service.Port == obs.Port && service.Protocol == protocol {
+			if host != "" {
+				service.Host = host
+			}
+			if obs.Service != "" {
+				service.Name = obs.Service
+			}
+			if obs.Version != "" {
+				service.Version = obs.Version
+			}
+			if obs.Banner != "" {
+				service.Banner = obs.Banner
+			}
+			if seen.After(service.LastSeen) {
+				service.LastSeen = seen
+			}
+			return
+		}
+	}
+	a.Services = append(a.Services, Service{
+		Host:      host,
+		Port:      obs.Port,
+		Protocol:  protocol,
+		Name:      obs.Service,
+		Version:   obs.Version,
+		Banner:    obs.Banner,
+		FirstSeen: seen,
+		LastSeen:  seen,
+	})
+}
+
+// Get returns a copy of the asset with the given ID.
+func (s *Store) Get(id string) *Asset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if asset, ok := s.assets[id]; ok {
+		return asset.clone()
+	}
+	return nil
+}
+
+// Lookup returns the asset of a workspace known by a hostname, IP or URL.
+func (s *Store) Lookup(workspaceID, value string) *Asset {
+	host, _, ok := NormalizeHost(value)
+	if !ok {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if id, ok := s.index[indexKey(workspaces.Normalize(workspaceID), host)]; ok {
+		return s.assets[id].clone()
+	}
+	return nil
+}
+
+// Filter narrows an asset search. Query matches hostnames, IPs, service names
+// and technologies; the other fields must match exactly when set.
+type Filter struct {
+	WorkspaceID string
+	Query       string
+	Kind        string
+	OperationID string
+	Port        int
+	Technology  string
+	Limit       int
+	Offset      int
+}
+
+func (f Filter) matches(asset *Asset) bool {
+	if f.WorkspaceID != "" && asset.WorkspaceID != f.WorkspaceID {
+		return false
+	}
+	if f.Kind != "" && asset.Kind != f.Kind {
+		return false
+	}
+	if f.OperationID != "" && !containsExact(asset.OperationIDs, f.OperationID) {
+		return false
+	}
+	if f.Port > 0 {
+		found := false
+		for _, service := range asset.Services {
+			found = found || service.Port == f.Port
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Technology != "" && !containsFold(asset.Technologies, f.Technology) {
+		return false
+	}
+	if f.Query != "" {
+		haystack := append(asset.Identifiers(), asset.Technologies...)
+		for _, service := range asset.Services {
+			haystack = append(haystack, service.Name, service.Version)
+		}
+		if !containsFold(haystack, f.Query) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsExact(values []string, needle string) bool {
+	for _, value := range values {
+		if value == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, needle string) bool {
+	needle = strings.ToLower(needle)
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value), needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns one page of the assets matching filter, most recently seen
+// first, and the total number of matches.
+func (s *Store) Search(filter Filter) ([]*Asset, int) {
+	s.mu.RLock()
+	matched := make([]*Asset, 0)
+	for _, asset := range s.assets {
+		if filter.matches(asset) {
+			matched = append(matched, asset.clone())
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i].LastSeen.After(matched[j].LastSeen) })
+
+	total := len(matched)
+	if filter.Offset > 0 {
+		if filter.Offset >= len(matched) {
+			return []*Asset{}, total
+		}
+		matched = matched[filter.Offset:]
+	}
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total
+}
+
+func (s *Store) persist(asset *Asset) {
+	if database.DB == nil {
+		return
+	}
+
+	data, _ := json.Marshal(assetData{
+		Hostnames:    asset.Hostnames,
+		IPs:          asset.IPs,
+		Services:     asset.Services,
+		Technologies: asset.Technologies,
+		OperationIDs: asset.OperationIDs,
+		WorkspaceID:  asset.WorkspaceID,
+	})
+	record := database.AssetRecord{
+		ID:        asset.ID,
+		Kind:      asset.Kind,
+		Name:      asset.Name,
+		Data:      data,
+		FirstSeen: asset.FirstSeen,
+		LastSeen:  asset.LastSeen,
+	}
+	if err := database.SaveAsset(record); err != nil {
+		log.Printf("Assets: failed to persist asset %s: %v", asset.ID, err)
+	}
+}
+
+// persistService records a port observation in the services table.
+func persistService(workspaceID string, obs Observation, seen time.Time) {
+	if database.DB == nil {
+		return
+	}
+
+	record := database.ServiceRecord{
+		WorkspaceID: workspaceID,
+		Host:        serviceHost(obs),
+		Port:        obs.Port,
+		Proto:       serviceProtocol(obs),
+		Service:     obs.Service,
+		Version:     obs.Version,
+		Banner:      obs.Banner,
+		OperationID: obs.OperationID,
+		FirstSeen:   seen,
+		LastSeen:    seen,
+	}
+	if err := database.SaveService(record); err != nil {
+		log.Printf("Assets: failed to persist service %s %d/%s: %v", record.Host, record.Port, record.Proto, err)
+	}
+}
+
+// Services returns the services found on any of an asset's hostnames and IPs,
+// one per host, port and protocol. They are read from the services table,
+// or from the asset itself when there is no database or it cannot be read.
+func (s *Store) Services(asset *Asset) []Service {
+	if database.DB != nil {
+		records, err := database.GetServices(asset.WorkspaceID, asset.Identifiers())
+		if err == nil {
+			services := make([]Service, 0, len(records))
+			for _, record := range records {
+				services = append(services, Service{
+					Host:      record.Host,
+					Port:      record.Port,
+					Protocol:  record.Proto,
+					Name:      record.Service,
+					Version:   record.Version,
+					Banner:    record.Banner,
+					FirstSeen: record.FirstSeen,
+					LastSeen:  record.LastSeen,
+				})
+			}
+			return services
+		}
+		log.Printf("Assets: failed to load services of asset %s: %v", asset.ID, err)
+	}
+	return append([]Service{}, asset.Services...)
+}
+
+// Load restores the inventory from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllAssets()
+	if err != nil {
+		log.Printf("Assets: failed to load assets: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		var data assetData
+		json.Unmarshal(record.Data, &data)
+		asset := &Asset{
+			ID:           record.ID,
+			WorkspaceID:  workspaces.Normalize(data.WorkspaceID),
+			Hostnames:    append([]string{}, data.Hostnames...),
+			IPs:          append([]string{}, data.IPs...),
+			Services:     append([]Service{}, data.Services...),
+			Technologies: append([]string{}, data.Technologies...),
+			OperationIDs: append([]string{}, data.OperationIDs...),
+			FirstSeen:    record.FirstSeen,
+			LastSeen:     record.LastSeen,
+		}
+		asset.refresh()
+		s.assets[asset.ID] = asset
+		for _, identifier := range asset.Identifiers() {
+			s.index[indexKey(asset.WorkspaceID, identifier)] = asset.ID
+		}
+	}
+}
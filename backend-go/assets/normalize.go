@@ -0,0 +1,62 @@
+package assets
+
+import (
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// NormalizeHost reduces a hostname, IP address or URL to the bare host it
+// names: scheme, credentials, port and path are dropped, hostnames are
+// lower-cased without a trailing dot and IPs are written in canonical form.
+// ok is false when value does not name a single host, e.g. a CIDR range.
+func NormalizeHost(value string) (host string, isIP bool, ok bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", false, false
+	}
+
+	if strings.Contains(value, "://") {
+		u, err := url.Parse(value)
+		if err != nil || u.Hostname() == "" {
+			return "", false, false
+		}
+		value = u.Hostname()
+	} else if h, _, err := net.SplitHostPort(value); err == nil {
+		value = h
+	} else if i := strings.IndexAny(value, "/?#"); i >= 0 {
+		if _, err := netip.ParsePrefix(value); err == nil {
+			return "", false, false
+		}
+		value = value[:i]
+	}
+
+	value = strings.Trim(value, "[]")
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap().String(), true, true
+	}
+
+	value = strings.ToLower(strings.TrimSuffix(value, "."))
+	if !isHostname(value) {
+		return "", false, false
+	}
+	return value, false, true
+}
+
+func isHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package assets
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	nmapReportPattern = regexp.MustCompile(`^Nmap scan report for (\S+)(?: \(([^)]+)\))?$`)
+	nmapPortPattern   = regexp.MustCompile(`^(\d+)/(tcp|udp)\s+open\s+(\S+)\s*(.*)$`)
+	nmapBannerPattern = regexp.MustCompile(`^\|_?\s*banner:\s*(.+)$`)
+	servicePattern    = regexp.MustCompile(`^(\d+)/(tcp|udp)\s+(\S+)\s*(.*)$`)
+	naabuPortPattern  = regexp.MustCompile(`^(\[[0-9A-Fa-f:.]+\]|[A-Za-z0-9._-]+):(\d{1,5})$`)
+)
+
+// ParseNmap extracts hosts and their open ports from nmap's normal output,
+// with the banners the banner script grabs. Port lines seen before any "scan
+// report" line have an empty Host, to be attributed by the caller.
+func ParseNmap(output string) []Observation {
+	var observations []Observation
+	var host, ip string
+	lastPort := -1
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		if match := nmapReportPattern.FindStringSubmatch(line); match != nil {
+			host, ip = match[1], match[2]
+			observations = append(observations, Observation{Host: host, IP: ip})
+			lastPort = -1
+			continue
+		}
+
+		if match := nmapBannerPattern.FindStringSubmatch(line); match != nil && lastPort >= 0 {
+			observations[lastPort].Banner = strings.TrimSpace(match[1])
+			continue
+		}
+
+		if match := nmapPortPattern.FindStringSubmatch(line); match != nil {
+			port, _ := strconv.Atoi(match[1])
+			observations = append(observations, Observation{
+				Host:       host,
+				IP:         ip,
+				Port:       port,
+				Protocol:   match[2],
+				Service:    match[3],
+				Version:    strings.TrimSpace(match[4]),
+				Technology: strings.TrimSpace(match[4]),
+			})
+			lastPort = len(observations) - 1
+		}
+	}
+	return observations
+}
+
+// naabuResult is a line of naabu's JSON output. Older releases write the
+// protocol as a number, which is ignored.
+type naabuResult struct {
+	Host     string      `json:"host"`
+	IP       string      `json:"ip"`
+	Port     int         `json:"port"`
+	Protocol interface{} `json:"protocol"`
+}
+
+// ParseNaabu extracts open ports from naabu's output, either its default
+// "host:port" lines or the JSON lines it writes with -json.
+func ParseNaabu(output string) []Observation {
+	var observations []Observation
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "{") {
+			var result naabuResult
+			if json.Unmarshal([]byte(line), &result) != nil || result.Port <= 0 || result.Port > 65535 {
+				continue
+			}
+			protocol, _ := result.Protocol.(string)
+			observations = append(observations, Observation{
+				Host:     result.Host,
+				IP:       result.IP,
+				Port:     result.Port,
+				Protocol: protocol,
+			})
+			continue
+		}
+
+		if match := naabuPortPattern.FindStringSubmatch(line); match != nil {
+			port, err := strconv.Atoi(match[2])
+			if err != nil || port <= 0 || port > 65535 {
+				continue
+			}
+			observations = append(observations, Observation{
+				Host:     strings.Trim(match[1], "[]"),
+				Port:     port,
+				Protocol: "tcp",
+			})
+		}
+	}
+	return observations
+}
+
+// ParseService reads a port or service result such as "443/tcp https" or
+// "22/tcp ssh OpenSSH 8.9p1", as agents share them.
+func ParseService(value string) (Observation, bool) {
+	match := servicePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return Observation{}, false
+	}
+	port, err := strconv.Atoi(match[1])
+	if err != nil || port <= 0 || port > 65535 {
+		return Observation{}, false
+	}
+	version := strings.TrimSpace(match[4])
+	return Observation{
+		Port:       port,
+		Protocol:   match[2],
+		Service:    match[3],
+		Version:    version,
+		Technology: version,
+	}, true
+}
@@ -0,0 +1,157 @@
+// Package auth issues and verifies the JWTs that authenticate API users.
+// Access tokens are short-lived and sent on every request; refresh tokens
+// only obtain new token pairs. Both carry the user's token version so they
+// can be revoked together.
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"performa-backend/users"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Token types.
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+const issuer = "performa"
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Claims are the JWT claims of an issued token.
+type Claims struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Type     string `json:"typ"`
+	Version  int    `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+func (c *Claims) UserID() string {
+	return c.Subject
+}
+
+func (c *Claims) IsAdmin() bool {
+	return c.Role == users.RoleAdmin
+}
+
+// TokenPair is returned on login and refresh.
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+var (
+	secret     []byte
+	accessTTL  = 15 * time.Minute
+	refreshTTL = 7 * 24 * time.Hour
+	mu         sync.RWMutex
+)
+
+// Configure sets the signing secret and token lifetimes. Without a secret a
+// random one is generated, so tokens do not survive a restart.
+func Configure(signingSecret string, access, refresh time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if signingSecret == "" {
+		random := make([]byte, 32)
+		rand.Read(random)
+		signingSecret = hex.EncodeToString(random)
+		log.Printf("Warning: JWT_SECRET is not set; using a random secret, tokens will not survive a restart")
+	}
+	secret = []byte(signingSecret)
+	if access > 0 {
+		accessTTL = access
+	}
+	if refresh > 0 {
+		refreshTTL = refresh
+	}
+}
+
+func sign(user *users.User, tokenType string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(ttl)
+	claims := Claims{
+		Username: user.Username,
+		Role:     user.Role,
+		Type:     tokenType,
+		Version:  user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    issuer,
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	return signed, expires, err
+}
+
+// Issue creates an access and refresh token for user.
+func Issue(user *users.User) (*TokenPair, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("authentication is not configured")
+	}
+	access, accessExpires, err := sign(user, TokenAccess, accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	refresh, refreshExpires, err := sign(user, TokenRefresh, refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		TokenType:        "Bearer",
+		ExpiresAt:        accessExpires,
+		RefreshExpiresAt: refreshExpires,
+	}, nil
+}
+
+// Verify parses a token of the given type and checks it against the current
+// state of its user: the user must still exist, be enabled and not have
+// revoked the token. The returned claims carry the user's current role.
+func Verify(token, tokenType string) (*Claims, error) {
+	mu.RLock()
+	key := secret
+	mu.RUnlock()
+	if len(key) == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(issuer), jwt.WithExpirationRequired())
+	if err != nil || claims.Type != tokenType {
+		return nil, ErrInvalidToken
+	}
+
+	user := users.Default.Get(claims.Subject)
+	if user == nil || user.Disabled || user.TokenVersion != claims.Version {
+		return nil, ErrInvalidToken
+	}
+	claims.Username = user.Username
+	claims.Role = user.Role
+	return &claims, nil
+}
@@ -0,0 +1,241 @@
+// Package benchmark runs the same prompts across several models to compare
+// them for an engagement: how fast they answer, what they cost, how many
+// tokens they use and, when the Brain scores the answers, how good they are.
+package benchmark
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"performa-backend/openrouter"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxModels bounds the models compared at once.
+	MaxModels = 8
+	// concurrency bounds the model calls in flight for one benchmark.
+	concurrency = 4
+	// maxResponseBytes bounds each response kept with the results.
+	maxResponseBytes = 8 << 10
+)
+
+// Request is what to benchmark: Prompt, with an optional System prompt, or
+// else the cases of the canned Suite, run on each of Models. Score asks the
+// Brain to rate each response.
+type Request struct {
+	Models       []string `json:"models"`
+	Prompt       string   `json:"prompt,omitempty"`
+	System       string   `json:"system,omitempty"`
+	Suite        string   `json:"suite,omitempty"`
+	Score        bool     `json:"score,omitempty"`
+	CredentialID string   `json:"credential_id,omitempty"`
+}
+
+// Cases returns the cases the request runs.
+func (r Request) Cases() ([]Case, bool) {
+	if r.Prompt != "" {
+		return []Case{{Name: "prompt", System: r.System, Prompt: r.Prompt}}, true
+	}
+	suite := r.Suite
+	if suite == "" {
+		suite = SecuritySuite
+	}
+	cases, ok := Suites()[suite]
+	return cases, ok
+}
+
+// Run is one model's answer to one case.
+type Run struct {
+	Model            string   `json:"model"`
+	Case             string   `json:"case"`
+	LatencyMs        int64    `json:"latency_ms"`
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	CostUSD          float64  `json:"cost_usd"`
+	Response         string   `json:"response,omitempty"`
+	Truncated        bool     `json:"truncated,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	Quality          *float64 `json:"quality,omitempty"`
+	QualityReason    string   `json:"quality_reasoning,omitempty"`
+	ScoreError       string   `json:"score_error,omitempty"`
+}
+
+// Summary is one row of the comparison table: a model's totals over the
+// cases, with its averages over the runs that succeeded. Quality is unset
+// when no response of the model was scored.
+type Summary struct {
+	Rank             int      `json:"rank"`
+	Model            string   `json:"model"`
+	Runs             int      `json:"runs"`
+	Errors           int      `json:"errors"`
+	AvgLatencyMs     int64    `json:"avg_latency_ms"`
+	MaxLatencyMs     int64    `json:"max_latency_ms"`
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	CostUSD          float64  `json:"cost_usd"`
+	Quality          *float64 `json:"quality,omitempty"`
+}
+
+// Benchmark is a finished comparison.
+type Benchmark struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	Suite       string    `json:"suite,omitempty"`
+	Models      []string  `json:"models"`
+	Cases       []Case    `json:"cases"`
+	Scored      bool      `json:"scored"`
+	Table       []Summary `json:"table"`
+	Runs        []Run     `json:"runs,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+// ChatFunc asks model to answer messages.
+type ChatFunc func(messages []openrouter.Message, model string) (string, openrouter.CallStats, error)
+
+// ScoreFunc rates a model's response to a case, higher being better.
+type ScoreFunc func(c Case, model, response string) (float64, string, error)
+
+// Execute runs every case on every model, a few calls at a time, and scores
+// the responses with score when it is set.
+func Execute(req Request, cases []Case, chat ChatFunc, score ScoreFunc) *Benchmark {
+	b := &Benchmark{
+		ID:        uuid.New().String(),
+		Models:    req.Models,
+		Cases:     cases,
+		Scored:    score != nil,
+		CreatedAt: time.Now(),
+	}
+	if req.Prompt == "" {
+		b.Suite = req.Suite
+		if b.Suite == "" {
+			b.Suite = SecuritySuite
+		}
+	}
+
+	b.Runs = make([]Run, len(req.Models)*len(cases))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, model := range req.Models {
+		for j, c := range cases {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(run *Run, model string, c Case) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				*run = execute(model, c, chat, score)
+			}(&b.Runs[i*len(cases)+j], model, c)
+		}
+	}
+	wg.Wait()
+
+	b.Table = summarize(req.Models, b.Runs)
+	b.DurationMs = time.Since(b.CreatedAt).Milliseconds()
+	return b
+}
+
+func execute(model string, c Case, chat ChatFunc, score ScoreFunc) Run {
+	messages := make([]openrouter.Message, 0, 2)
+	if c.System != "" {
+		messages = append(messages, openrouter.Message{Role: "system", Content: c.System})
+	}
+	messages = append(messages, openrouter.Message{Role: "user", Content: c.Prompt})
+
+	response, stats, err := chat(messages, model)
+	run := Run{
+		Model:            model,
+		Case:             c.Name,
+		LatencyMs:        stats.Latency.Milliseconds(),
+		PromptTokens:     stats.PromptTokens,
+		CompletionTokens: stats.CompletionTokens,
+		CostUSD:          stats.Cost,
+	}
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+
+	if score != nil {
+		quality, reasoning, err := score(c, model, response)
+		if err != nil {
+			run.ScoreError = err.Error()
+		} else {
+			run.Quality = &quality
+			run.QualityReason = reasoning
+		}
+	}
+	if len(response) > maxResponseBytes {
+		response, run.Truncated = response[:maxResponseBytes], true
+	}
+	run.Response = response
+	return run
+}
+
+// summarize builds the comparison table, best model first: by quality when
+// the responses were scored, then by fewest errors, lowest latency and
+// lowest cost.
+func summarize(models []string, runs []Run) []Summary {
+	table := make([]Summary, 0, len(models))
+	for _, model := range models {
+		row := Summary{Model: model}
+		var latency int64
+		var quality float64
+		scored := 0
+		for _, run := range runs {
+			if run.Model != model {
+				continue
+			}
+			row.Runs++
+			row.PromptTokens += run.PromptTokens
+			row.CompletionTokens += run.CompletionTokens
+			row.CostUSD += run.CostUSD
+			if run.Error != "" {
+				row.Errors++
+				continue
+			}
+			latency += run.LatencyMs
+			if run.LatencyMs > row.MaxLatencyMs {
+				row.MaxLatencyMs = run.LatencyMs
+			}
+			if run.Quality != nil {
+				quality += *run.Quality
+				scored++
+			}
+		}
+		if ok := row.Runs - row.Errors; ok > 0 {
+			row.AvgLatencyMs = latency / int64(ok)
+		}
+		if scored > 0 {
+			avg := quality / float64(scored)
+			row.Quality = &avg
+		}
+		table = append(table, row)
+	}
+
+	sort.SliceStable(table, func(i, j int) bool {
+		a, b := table[i], table[j]
+		if (a.Quality != nil) != (b.Quality != nil) {
+			return a.Quality != nil
+		}
+		if a.Quality != nil && *a.Quality != *b.Quality {
+			return *a.Quality > *b.Quality
+		}
+		if a.Errors != b.Errors {
+			return a.Errors < b.Errors
+		}
+		if a.AvgLatencyMs != b.AvgLatencyMs {
+			return a.AvgLatencyMs < b.AvgLatencyMs
+		}
+		return a.CostUSD < b.CostUSD
+	})
+	for i := range table {
+		table[i].Rank = i + 1
+	}
+	return table
+}
@@ -0,0 +1,100 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+
+	"performa-backend/database"
+)
+
+// maxBenchmarks bounds the benchmarks kept in memory; the oldest are dropped
+// first. With a database connected all of them are kept there.
+const maxBenchmarks = 200
+
+// Store keeps the finished benchmarks.
+type Store struct {
+	benchmarks map[string]*Benchmark
+	mu         sync.RWMutex
+}
+
+var Default = &Store{benchmarks: make(map[string]*Benchmark)}
+
+// Add keeps a benchmark and persists it.
+func (s *Store) Add(b *Benchmark) {
+	s.mu.Lock()
+	s.benchmarks[b.ID] = b
+	s.evict()
+	s.mu.Unlock()
+
+	if database.DB == nil {
+		return
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return
+	}
+	record := database.ModelBenchmarkRecord{ID: b.ID, WorkspaceID: b.WorkspaceID, Data: data, CreatedAt: b.CreatedAt}
+	if err := database.SaveModelBenchmark(record); err != nil {
+		log.Printf("Benchmarks: failed to persist benchmark %s: %v", b.ID, err)
+	}
+}
+
+// evict must be called with s.mu held.
+func (s *Store) evict() {
+	for len(s.benchmarks) > maxBenchmarks {
+		var oldest *Benchmark
+		for _, b := range s.benchmarks {
+			if oldest == nil || b.CreatedAt.Before(oldest.CreatedAt) {
+				oldest = b
+			}
+		}
+		delete(s.benchmarks, oldest.ID)
+	}
+}
+
+// Get returns the benchmark with the given ID, or nil.
+func (s *Store) Get(id string) *Benchmark {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.benchmarks[id]
+}
+
+// List returns the benchmarks of a workspace, most recent first.
+func (s *Store) List(workspaceID string) []*Benchmark {
+	s.mu.RLock()
+	list := make([]*Benchmark, 0)
+	for _, b := range s.benchmarks {
+		if b.WorkspaceID == workspaceID {
+			list = append(list, b)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Load restores the most recent benchmarks from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+	records, err := database.GetRecentModelBenchmarks(maxBenchmarks)
+	if err != nil {
+		log.Printf("Benchmarks: failed to load benchmarks: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		var b Benchmark
+		if err := json.Unmarshal(record.Data, &b); err != nil {
+			log.Printf("Benchmarks: skipping benchmark %s: %v", record.ID, err)
+			continue
+		}
+		s.benchmarks[b.ID] = &b
+	}
+}
@@ -0,0 +1,79 @@
+package benchmark
+
+// Case is one prompt of a benchmark. Criteria tells the Brain what a good
+// answer covers when it scores the responses.
+type Case struct {
+	Name     string `json:"name"`
+	System   string `json:"system,omitempty"`
+	Prompt   string `json:"prompt"`
+	Criteria string `json:"criteria,omitempty"`
+}
+
+// SecuritySuite is the name of the canned security-analysis suite.
+const SecuritySuite = "security-analysis"
+
+const analystSystem = "You are a senior penetration tester. Answer precisely and concisely, and say when the evidence does not support a conclusion."
+
+// securityCases are the tasks an engagement asks of its models: reading scan
+// output, spotting an attack in logs, reviewing code and planning next
+// steps.
+var securityCases = []Case{
+	{
+		Name:   "nmap-triage",
+		System: analystSystem,
+		Prompt: `Triage this nmap output. List the most promising attack vectors in priority order and the next command you would run for each.
+
+PORT     STATE SERVICE  VERSION
+21/tcp   open  ftp      vsftpd 2.3.4
+22/tcp   open  ssh      OpenSSH 4.7p1 Debian 8ubuntu1
+80/tcp   open  http     Apache httpd 2.2.8 ((Ubuntu) DAV/2)
+139/tcp  open  netbios-ssn Samba smbd 3.X - 4.X
+3306/tcp open  mysql    MySQL 5.0.51a-3ubuntu5
+5432/tcp open  postgresql PostgreSQL DB 8.3.0 - 8.3.7`,
+		Criteria: "Identifies the vsftpd 2.3.4 backdoor (CVE-2011-2523) first, notes the outdated OpenSSH, Apache with WebDAV, Samba usermap_script and exposed databases, and gives concrete, safe follow-up commands.",
+	},
+	{
+		Name:   "log-analysis",
+		System: analystSystem,
+		Prompt: `These lines are from a web server access log. What is happening, is it likely to have succeeded, and what should be checked next?
+
+203.0.113.7 - - [12/Mar/2025:10:14:02 +0000] "GET /products.php?id=1 HTTP/1.1" 200 5120
+203.0.113.7 - - [12/Mar/2025:10:14:03 +0000] "GET /products.php?id=1' HTTP/1.1" 500 312
+203.0.113.7 - - [12/Mar/2025:10:14:05 +0000] "GET /products.php?id=1%20AND%201=1 HTTP/1.1" 200 5120
+203.0.113.7 - - [12/Mar/2025:10:14:06 +0000] "GET /products.php?id=1%20AND%201=2 HTTP/1.1" 200 87
+203.0.113.7 - - [12/Mar/2025:10:14:09 +0000] "GET /products.php?id=1%20UNION%20SELECT%20username,password%20FROM%20users-- HTTP/1.1" 200 9034`,
+		Criteria: "Recognizes boolean-based then UNION-based SQL injection on the id parameter, infers from the response sizes that it likely succeeded and that credentials may have leaked, and recommends checking the database, rotating credentials and fixing the query with parameterization.",
+	},
+	{
+		Name:   "code-review",
+		System: analystSystem,
+		Prompt: "Review this handler for security issues, rate each by severity and show the fix.\n\n" +
+			"```python\n" +
+			"@app.route('/download')\n" +
+			"def download():\n" +
+			"    name = request.args.get('file')\n" +
+			"    path = os.path.join('/srv/reports', name)\n" +
+			"    os.system('gzip -k ' + path)\n" +
+			"    return send_file(path + '.gz')\n" +
+			"```",
+		Criteria: "Finds the path traversal in the file parameter and the OS command injection in os.system, rates both high or critical, and fixes them by validating the name against the directory and avoiding the shell.",
+	},
+	{
+		Name:   "header-review",
+		System: analystSystem,
+		Prompt: `Assess these HTTP response headers from a login page and list the weaknesses with their impact.
+
+HTTP/1.1 200 OK
+Server: Apache/2.4.29 (Ubuntu)
+X-Powered-By: PHP/7.2.24
+Set-Cookie: PHPSESSID=9d2f1c; path=/
+Access-Control-Allow-Origin: *
+Content-Type: text/html; charset=UTF-8`,
+		Criteria: "Notes version disclosure, the session cookie missing Secure, HttpOnly and SameSite, the wildcard CORS policy, and the missing HSTS, CSP and frame protections, with their impact on a login page.",
+	},
+}
+
+// Suites lists the canned suites by name.
+func Suites() map[string][]Case {
+	return map[string][]Case{SecuritySuite: append([]Case(nil), securityCases...)}
+}
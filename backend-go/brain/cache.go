@@ -0,0 +1,134 @@
+package brain
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCacheSize = 500
+	DefaultCacheTTL  = 24 * time.Hour
+)
+
+// CacheStats describes the response cache.
+type CacheStats struct {
+	Entries    int    `json:"entries"`
+	MaxEntries int    `json:"max_entries"`
+	TTL        string `json:"ttl"`
+	// Hits counts responses served from the cache while the Brain was
+	// unreachable, Misses outages with nothing cached for the request.
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+type cacheEntry struct {
+	key      string
+	body     json.RawMessage
+	storedAt time.Time
+}
+
+// ResponseCache keeps the most recent Brain responses by request, so that
+// they can still be served while the Brain is unreachable. The least
+// recently used entry is evicted once it holds maxEntries.
+type ResponseCache struct {
+	entries    map[string]*list.Element
+	order      *list.List
+	maxEntries int
+	ttl        time.Duration
+	stats      CacheStats
+	mu         sync.Mutex
+}
+
+// Responses is the cache Brain clients share, so that it survives the client
+// being recreated for a new service URL.
+var Responses = NewResponseCache(DefaultCacheSize, DefaultCacheTTL)
+
+func NewResponseCache(maxEntries int, ttl time.Duration) *ResponseCache {
+	c := &ResponseCache{entries: make(map[string]*list.Element), order: list.New()}
+	c.Configure(maxEntries, ttl)
+	return c
+}
+
+// Configure sets the cache's size and how long entries may be served. Values
+// of zero or less keep the defaults.
+func (c *ResponseCache) Configure(maxEntries int, ttl time.Duration) {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries, c.ttl = maxEntries, ttl
+	c.evict()
+}
+
+// cacheKey hashes an endpoint and its request body.
+func cacheKey(endpoint string, body interface{}) (string, bool) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(append([]byte(endpoint+"\n"), data...))
+	return hex.EncodeToString(sum[:]), true
+}
+
+func (c *ResponseCache) put(key string, body json.RawMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, body: append(json.RawMessage(nil), body...), storedAt: time.Now()}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	c.evict()
+}
+
+// get returns the response cached for key, unless it expired.
+func (c *ResponseCache) get(key string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if ok && time.Since(element.Value.(*cacheEntry).storedAt) > c.ttl {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	c.stats.Hits++
+	return element.Value.(*cacheEntry).body, true
+}
+
+// evict must be called with c.mu held.
+func (c *ResponseCache) evict() {
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *ResponseCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	stats.MaxEntries = c.maxEntries
+	stats.TTL = c.ttl.String()
+	return stats
+}
@@ -2,11 +2,16 @@ package brain
 
 import (
         "bytes"
+        "context"
         "encoding/json"
+        "errors"
         "fmt"
         "io"
         "net/http"
+        "net/url"
         "time"
+
+        "performa-backend/telemetry"
 )
 
 type BrainClient struct {
@@ -15,7 +20,7 @@ type BrainClient struct {
 }
 
 type ThinkRequest struct {
-        Task        string                 `json:"task"`
+        Task        string                 `json:"task" validate:"required"`
         Context     map[string]interface{} `json:"context,omitempty"`
         Constraints []string               `json:"constraints,omitempty"`
         History     []map[string]interface{} `json:"history,omitempty"`
@@ -33,7 +38,7 @@ type ThinkResponse struct {
 }
 
 type ClassifyRequest struct {
-        Description       string                 `json:"description"`
+        Description       string                 `json:"description" validate:"required"`
         Type              string                 `json:"type,omitempty"`
         AdditionalContext map[string]interface{} `json:"additional_context,omitempty"`
 }
@@ -44,10 +49,14 @@ type ClassifyResponse struct {
         SeverityScores    map[string]float64     `json:"severity_scores"`
         VulnerabilityType string                 `json:"vulnerability_type"`
         ModelUsed         string                 `json:"model_used"`
+        CWE               string                 `json:"cwe_id,omitempty"`
+        OWASPCategory     string                 `json:"owasp_category,omitempty"`
+        // Stale marks a cached response served while the Brain was unreachable.
+        Stale             bool                   `json:"stale,omitempty"`
 }
 
 type EvaluateRequest struct {
-        Action  map[string]interface{} `json:"action"`
+        Action  map[string]interface{} `json:"action" validate:"required"`
         Context map[string]interface{} `json:"context"`
 }
 
@@ -62,7 +71,7 @@ type EvaluateResponse struct {
 }
 
 type StrategyRequest struct {
-        Target map[string]interface{} `json:"target"`
+        Target map[string]interface{} `json:"target" validate:"required"`
         Mode   string                 `json:"mode,omitempty"`
 }
 
@@ -75,6 +84,8 @@ type StrategyResponse struct {
         TimingMultiplier       float64                  `json:"timing_multiplier"`
         TotalEstimatedDuration int                      `json:"total_estimated_duration"`
         CreatedAt              string                   `json:"created_at"`
+        // Stale marks a cached response served while the Brain was unreachable.
+        Stale                  bool                     `json:"stale,omitempty"`
 }
 
 type BrainStatus struct {
@@ -84,6 +95,26 @@ type BrainStatus struct {
         ContextSize          int                      `json:"context_size"`
 }
 
+// StatusError is an error response from the Brain.
+type StatusError struct {
+        Code int
+        Body string
+}
+
+func (e *StatusError) Error() string {
+        return fmt.Sprintf("request failed with status %d: %s", e.Code, e.Body)
+}
+
+// IsOutage reports whether err means the Brain could not answer, rather than
+// that it rejected the request.
+func IsOutage(err error) bool {
+        var status *StatusError
+        if errors.As(err, &status) {
+                return status.Code >= 500
+        }
+        return err != nil
+}
+
 func NewBrainClient(brainURL string) *BrainClient {
         client := &BrainClient{
                 baseURL: brainURL,
@@ -110,7 +141,10 @@ func (c *BrainClient) IsHealthy() bool {
         return err == nil
 }
 
-func (c *BrainClient) doRequest(method, endpoint string, body interface{}, result interface{}) error {
+func (c *BrainClient) doRequest(method, endpoint string, body interface{}, result interface{}) (err error) {
+        ctx, span := telemetry.Start(context.Background(), "brain "+method, telemetry.SpanClient)
+        defer func() { span.End(err) }()
+
         var reqBody io.Reader
         if body != nil {
                 jsonData, err := json.Marshal(body)
@@ -126,16 +160,21 @@ func (c *BrainClient) doRequest(method, endpoint string, body interface{}, resul
         }
 
         req.Header.Set("Content-Type", "application/json")
+        telemetry.Inject(ctx, req.Header)
+        span.SetAttribute("http.request.method", method)
+        span.SetAttribute("server.address", req.URL.Host)
+        span.SetAttribute("url.path", req.URL.Path)
 
         resp, err := c.httpClient.Do(req)
         if err != nil {
                 return fmt.Errorf("request failed: %w", err)
         }
         defer resp.Body.Close()
+        span.SetAttribute("http.response.status_code", resp.StatusCode)
 
         if resp.StatusCode >= 400 {
                 bodyBytes, _ := io.ReadAll(resp.Body)
-                return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+                return &StatusError{Code: resp.StatusCode, Body: string(bodyBytes)}
         }
 
         if result != nil {
@@ -147,6 +186,49 @@ func (c *BrainClient) doRequest(method, endpoint string, body interface{}, resul
         return nil
 }
 
+// doCachedRequest is doRequest for a response that is cached: it is served
+// from Responses, with stale true, when the Brain is unreachable. It also
+// returns the undecoded response.
+func (c *BrainClient) doCachedRequest(method, endpoint string, body interface{}, result interface{}) (json.RawMessage, bool, error) {
+        var raw json.RawMessage
+        err := c.doRequest(method, endpoint, body, &raw)
+        key, cacheable := cacheKey(endpoint, body)
+        stale := false
+        switch {
+        case err == nil:
+                if cacheable {
+                        Responses.put(key, raw)
+                }
+        case cacheable && IsOutage(err):
+                cached, ok := Responses.get(key)
+                if !ok {
+                        return nil, false, err
+                }
+                raw, stale = cached, true
+        default:
+                return nil, false, err
+        }
+
+        if err := json.Unmarshal(raw, result); err != nil {
+                return raw, stale, fmt.Errorf("failed to decode response: %w", err)
+        }
+        return raw, stale, nil
+}
+
+// cachedResponse decodes the cached response to a request without calling
+// the Brain, for callers that already know it is unreachable.
+func cachedResponse(endpoint string, body interface{}, result interface{}) (json.RawMessage, bool) {
+        key, cacheable := cacheKey(endpoint, body)
+        if !cacheable {
+                return nil, false
+        }
+        raw, ok := Responses.get(key)
+        if !ok || json.Unmarshal(raw, result) != nil {
+                return nil, false
+        }
+        return raw, true
+}
+
 func (c *BrainClient) Health() (map[string]string, error) {
         var result map[string]string
         err := c.doRequest("GET", "/brain/health", nil, &result)
@@ -171,10 +253,35 @@ func (c *BrainClient) Think(req *ThinkRequest) (*ThinkResponse, error) {
         return &result, err
 }
 
+// ClassifyThreat classifies a threat. While the Brain is unreachable, the
+// last response to the same request is served with Stale set.
 func (c *BrainClient) ClassifyThreat(req *ClassifyRequest) (*ClassifyResponse, error) {
+        result, _, err := c.ClassifyThreatRaw(req)
+        return result, err
+}
+
+// ClassifyThreatRaw is ClassifyThreat that also returns the undecoded
+// response body, for callers that keep it for audit.
+func (c *BrainClient) ClassifyThreatRaw(req *ClassifyRequest) (*ClassifyResponse, json.RawMessage, error) {
         var result ClassifyResponse
-        err := c.doRequest("POST", "/brain/classify", req, &result)
-        return &result, err
+        raw, stale, err := c.doCachedRequest("POST", "/brain/classify", req, &result)
+        if err != nil {
+                return nil, raw, err
+        }
+        result.Stale = stale
+        return &result, raw, nil
+}
+
+// CachedClassifyThreat returns the cached classification for req, flagged
+// Stale, without calling the Brain.
+func CachedClassifyThreat(req *ClassifyRequest) (*ClassifyResponse, json.RawMessage, bool) {
+        var result ClassifyResponse
+        raw, ok := cachedResponse("/brain/classify", req, &result)
+        if !ok {
+                return nil, nil, false
+        }
+        result.Stale = true
+        return &result, raw, true
 }
 
 func (c *BrainClient) EvaluateAction(req *EvaluateRequest) (*EvaluateResponse, error) {
@@ -183,10 +290,28 @@ func (c *BrainClient) EvaluateAction(req *EvaluateRequest) (*EvaluateResponse, e
         return &result, err
 }
 
+// GenerateStrategy generates an attack strategy. While the Brain is
+// unreachable, the last response to the same request is served with Stale
+// set.
 func (c *BrainClient) GenerateStrategy(req *StrategyRequest) (*StrategyResponse, error) {
         var result StrategyResponse
-        err := c.doRequest("POST", "/brain/strategy", req, &result)
-        return &result, err
+        _, stale, err := c.doCachedRequest("POST", "/brain/strategy", req, &result)
+        if err != nil {
+                return nil, err
+        }
+        result.Stale = stale
+        return &result, nil
+}
+
+// CachedStrategy returns the cached strategy for req, flagged Stale, without
+// calling the Brain.
+func CachedStrategy(req *StrategyRequest) (*StrategyResponse, bool) {
+        var result StrategyResponse
+        if _, ok := cachedResponse("/brain/strategy", req, &result); !ok {
+                return nil, false
+        }
+        result.Stale = true
+        return &result, true
 }
 
 func (c *BrainClient) GetModels() ([]map[string]interface{}, error) {
@@ -204,6 +329,14 @@ func (c *BrainClient) Learn(action, outcome map[string]interface{}) error {
         return c.doRequest("POST", "/brain/learn", req, &result)
 }
 
+// GetMissionConfig fetches a mission config saved through the Brain service's
+// own /api/config endpoints.
+func (c *BrainClient) GetMissionConfig(id string) (json.RawMessage, error) {
+        var result json.RawMessage
+        err := c.doRequest("GET", "/api/config/"+url.PathEscape(id), nil, &result)
+        return result, err
+}
+
 func (c *BrainClient) Reset() error {
         var result map[string]interface{}
         return c.doRequest("POST", "/brain/reset", nil, &result)
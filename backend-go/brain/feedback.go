@@ -0,0 +1,196 @@
+package brain
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const maxPendingFeedback = 1000
+
+// Feedback is one action/outcome pair reported to the Brain's learning endpoint.
+type Feedback struct {
+	Action  map[string]interface{}
+	Outcome map[string]interface{}
+}
+
+type FeedbackStats struct {
+	Enabled   bool       `json:"enabled"`
+	Pending   int        `json:"pending"`
+	Sent      int64      `json:"sent"`
+	Failed    int64      `json:"failed"`
+	Dropped   int64      `json:"dropped"`
+	BatchSize int        `json:"batch_size"`
+	Interval  string     `json:"flush_interval"`
+	LastFlush *time.Time `json:"last_flush,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+
+	// ReplayPending counts Learn calls made while the Brain was unreachable
+	// that wait for it to recover; Replayed those delivered since.
+	ReplayPending int   `json:"replay_pending"`
+	Replayed      int64 `json:"replayed"`
+}
+
+// FeedbackBatcher queues feedback and delivers it to the Brain in batches,
+// either when a batch fills up or on a timer, so the agent loop never waits
+// on the learning endpoint.
+type FeedbackBatcher struct {
+	client    *BrainClient
+	enabled   bool
+	batchSize int
+	interval  time.Duration
+	pending   []Feedback
+	replay    []Feedback
+	stats     FeedbackStats
+	flushing  bool
+	mu        sync.Mutex
+}
+
+func NewFeedbackBatcher(client *BrainClient, enabled bool, batchSize int, interval time.Duration) *FeedbackBatcher {
+	if batchSize <= 0 {
+		batchSize = 20
+	}
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	b := &FeedbackBatcher{
+		client:    client,
+		enabled:   enabled,
+		batchSize: batchSize,
+		interval:  interval,
+	}
+	go b.run()
+	return b
+}
+
+func (b *FeedbackBatcher) run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.Flush()
+	}
+}
+
+// Record queues a feedback pair. When the queue is full the oldest entry is
+// dropped.
+func (b *FeedbackBatcher) Record(action, outcome map[string]interface{}) {
+	b.mu.Lock()
+	if !b.enabled {
+		b.mu.Unlock()
+		return
+	}
+	if len(b.pending) >= maxPendingFeedback {
+		b.pending = b.pending[1:]
+		b.stats.Dropped++
+	}
+	b.pending = append(b.pending, Feedback{Action: action, Outcome: outcome})
+	full := len(b.pending) >= b.batchSize
+	b.mu.Unlock()
+
+	if full {
+		go b.Flush()
+	}
+}
+
+// Replay queues a Learn call that failed because the Brain was unreachable.
+// Replayed calls are delivered ahead of collected feedback and are kept even
+// while feedback collection is disabled.
+func (b *FeedbackBatcher) Replay(action, outcome map[string]interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.replay) >= maxPendingFeedback {
+		b.replay = b.replay[1:]
+		b.stats.Dropped++
+	}
+	b.replay = append(b.replay, Feedback{Action: action, Outcome: outcome})
+}
+
+// Flush sends the calls queued for replay and one batch of queued feedback.
+// Entries that fail to send stay queued for the next flush.
+func (b *FeedbackBatcher) Flush() {
+	b.mu.Lock()
+	if b.flushing || (len(b.pending) == 0 && len(b.replay) == 0) {
+		b.mu.Unlock()
+		return
+	}
+	b.flushing = true
+	replay := append([]Feedback(nil), b.replay...)
+	batch := b.pending
+	if len(batch) > b.batchSize {
+		batch = batch[:b.batchSize]
+	}
+	batch = append([]Feedback(nil), batch...)
+	client := b.client
+	b.mu.Unlock()
+
+	replayed := 0
+	var lastErr error
+	for _, item := range replay {
+		if err := client.Learn(item.Action, item.Outcome); err != nil {
+			lastErr = err
+			break
+		}
+		replayed++
+	}
+	sent := 0
+	for _, item := range batch {
+		if lastErr != nil {
+			break
+		}
+		if err := client.Learn(item.Action, item.Outcome); err != nil {
+			lastErr = err
+			break
+		}
+		sent++
+	}
+
+	now := time.Now()
+	b.mu.Lock()
+	b.replay = b.replay[replayed:]
+	b.pending = b.pending[sent:]
+	b.stats.Sent += int64(sent + replayed)
+	b.stats.Replayed += int64(replayed)
+	b.stats.LastFlush = &now
+	if lastErr != nil {
+		b.stats.Failed++
+		b.stats.LastError = lastErr.Error()
+	}
+	b.flushing = false
+	b.mu.Unlock()
+
+	if lastErr != nil {
+		log.Printf("Brain: learning feedback delivery failed, %d queued: %v", len(replay)-replayed+len(batch)-sent, lastErr)
+	}
+}
+
+// SetClient points delivery at a new Brain client, e.g. after the service URL
+// changed.
+func (b *FeedbackBatcher) SetClient(client *BrainClient) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.client = client
+}
+
+// SetEnabled turns feedback collection on or off. Disabling discards the queue.
+func (b *FeedbackBatcher) SetEnabled(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.enabled = enabled
+	if !enabled {
+		b.pending = nil
+	}
+}
+
+func (b *FeedbackBatcher) Stats() FeedbackStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.stats
+	stats.Enabled = b.enabled
+	stats.Pending = len(b.pending)
+	stats.ReplayPending = len(b.replay)
+	stats.BatchSize = b.batchSize
+	stats.Interval = b.interval.String()
+	return stats
+}
@@ -0,0 +1,310 @@
+// Package capture records the HTTP traffic of agents' web tools. Tools are
+// pointed at a local intercepting proxy that forwards their requests along
+// the operation's route and keeps each request/response pair, with sensitive
+// headers redacted, in a capped in-memory store. Captured exchanges can be
+// exported as HAR and attached to findings as evidence.
+package capture
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultMaxExchanges = 2000
+	DefaultMaxBodyBytes = 64 * 1024
+
+	// Redacted replaces the value of sensitive headers.
+	Redacted = "[REDACTED]"
+)
+
+// DefaultRedactedHeaders are the headers whose values are never stored.
+var DefaultRedactedHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+	"X-Api-Key", "Api-Key", "X-Auth-Token", "X-Access-Token",
+	"X-Csrf-Token", "X-Xsrf-Token", "X-Amz-Security-Token",
+}
+
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Body is a captured message body. Text holds at most the store's body limit;
+// bodies that are not valid UTF-8 are base64 encoded, as Encoding says.
+type Body struct {
+	Text      string `json:"text,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	MimeType  string `json:"mime_type,omitempty"`
+	Size      int64  `json:"size"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+type Request struct {
+	Method      string   `json:"method"`
+	URL         string   `json:"url"`
+	HTTPVersion string   `json:"http_version"`
+	Headers     []Header `json:"headers"`
+	Body        Body     `json:"body"`
+}
+
+type Response struct {
+	Status      int      `json:"status"`
+	StatusText  string   `json:"status_text"`
+	HTTPVersion string   `json:"http_version"`
+	Headers     []Header `json:"headers"`
+	Body        Body     `json:"body"`
+}
+
+// Exchange is one request an agent's tool sent through the proxy and the
+// response it got. Response is nil when the request failed, with Error set.
+type Exchange struct {
+	ID          string    `json:"id"`
+	OperationID string    `json:"operation_id"`
+	AgentID     string    `json:"agent_id"`
+	StartedAt   time.Time `json:"started_at"`
+	DurationMs  int64     `json:"duration_ms"`
+	Request     Request   `json:"request"`
+	Response    *Response `json:"response,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	FindingIDs  []string  `json:"finding_ids"`
+}
+
+// Summary is the part of an exchange listed without its headers and bodies.
+type Summary struct {
+	ID           string    `json:"id"`
+	OperationID  string    `json:"operation_id"`
+	AgentID      string    `json:"agent_id"`
+	Method       string    `json:"method"`
+	URL          string    `json:"url"`
+	Status       int       `json:"status"`
+	RequestSize  int64     `json:"request_size"`
+	ResponseSize int64     `json:"response_size"`
+	DurationMs   int64     `json:"duration_ms"`
+	StartedAt    time.Time `json:"started_at"`
+	Error        string    `json:"error,omitempty"`
+	FindingIDs   []string  `json:"finding_ids"`
+}
+
+func (e *Exchange) Summary() Summary {
+	summary := Summary{
+		ID:          e.ID,
+		OperationID: e.OperationID,
+		AgentID:     e.AgentID,
+		Method:      e.Request.Method,
+		URL:         e.Request.URL,
+		RequestSize: e.Request.Body.Size,
+		DurationMs:  e.DurationMs,
+		StartedAt:   e.StartedAt,
+		Error:       e.Error,
+		FindingIDs:  e.FindingIDs,
+	}
+	if e.Response != nil {
+		summary.Status = e.Response.Status
+		summary.ResponseSize = e.Response.Body.Size
+	}
+	return summary
+}
+
+func (e *Exchange) clone() *Exchange {
+	copied := *e
+	copied.Request.Headers = append([]Header{}, e.Request.Headers...)
+	if e.Response != nil {
+		response := *e.Response
+		response.Headers = append([]Header{}, e.Response.Headers...)
+		copied.Response = &response
+	}
+	copied.FindingIDs = append([]string{}, e.FindingIDs...)
+	return &copied
+}
+
+// Filter selects exchanges. Query matches the URL.
+type Filter struct {
+	OperationID string
+	AgentID     string
+	Query       string
+	Limit       int
+	Offset      int
+}
+
+func (f Filter) matches(e *Exchange) bool {
+	if f.OperationID != "" && e.OperationID != f.OperationID {
+		return false
+	}
+	if f.AgentID != "" && e.AgentID != f.AgentID {
+		return false
+	}
+	if q := strings.ToLower(strings.TrimSpace(f.Query)); q != "" {
+		return strings.Contains(strings.ToLower(e.Request.URL), q)
+	}
+	return true
+}
+
+// Store keeps the most recent exchanges, dropping the oldest once it holds
+// maxExchanges.
+type Store struct {
+	exchanges    []*Exchange
+	byID         map[string]*Exchange
+	maxExchanges int
+	maxBodyBytes int
+	redacted     map[string]bool
+	mu           sync.RWMutex
+}
+
+func NewStore() *Store {
+	s := &Store{byID: make(map[string]*Exchange)}
+	s.Configure(DefaultMaxExchanges, DefaultMaxBodyBytes, nil)
+	return s
+}
+
+// Configure sets the store's limits and the headers redacted on top of
+// DefaultRedactedHeaders. Limits of zero or less keep the defaults.
+func (s *Store) Configure(maxExchanges, maxBodyBytes int, redactHeaders []string) {
+	if maxExchanges <= 0 {
+		maxExchanges = DefaultMaxExchanges
+	}
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = DefaultMaxBodyBytes
+	}
+	redacted := make(map[string]bool)
+	for _, name := range append(append([]string{}, DefaultRedactedHeaders...), redactHeaders...) {
+		if name = strings.TrimSpace(name); name != "" {
+			redacted[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxExchanges, s.maxBodyBytes, s.redacted = maxExchanges, maxBodyBytes, redacted
+	s.evict()
+}
+
+// MaxBodyBytes is how much of each body is kept.
+func (s *Store) MaxBodyBytes() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maxBodyBytes
+}
+
+// Headers converts headers for storage, sorted by name, with the values of
+// sensitive ones redacted.
+func (s *Store) Headers(header http.Header) []Header {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	headers := make([]Header, 0, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			if s.redacted[http.CanonicalHeaderKey(name)] {
+				value = Redacted
+			}
+			headers = append(headers, Header{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+// NewBody builds a captured body from the first bytes of a body of size
+// bytes.
+func NewBody(data []byte, size int64, mimeType string) Body {
+	body := Body{MimeType: mimeType, Size: size, Truncated: size > int64(len(data))}
+	if len(data) == 0 {
+		return body
+	}
+	if utf8.Valid(data) {
+		body.Text = string(data)
+	} else {
+		body.Text = base64Encode(data)
+		body.Encoding = "base64"
+	}
+	return body
+}
+
+// Add stores an exchange, assigning its ID.
+func (s *Store) Add(exchange *Exchange) *Exchange {
+	exchange.ID = uuid.New().String()
+	if exchange.FindingIDs == nil {
+		exchange.FindingIDs = []string{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exchanges = append(s.exchanges, exchange)
+	s.byID[exchange.ID] = exchange
+	s.evict()
+	return exchange.clone()
+}
+
+// evict must be called with s.mu held.
+func (s *Store) evict() {
+	if excess := len(s.exchanges) - s.maxExchanges; excess > 0 {
+		for _, exchange := range s.exchanges[:excess] {
+			delete(s.byID, exchange.ID)
+		}
+		s.exchanges = append([]*Exchange(nil), s.exchanges[excess:]...)
+	}
+}
+
+// Get returns a copy of the exchange with the given ID.
+func (s *Store) Get(id string) *Exchange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if exchange, ok := s.byID[id]; ok {
+		return exchange.clone()
+	}
+	return nil
+}
+
+// List returns the page of exchanges matching filter, most recent first, and
+// the number of matches.
+func (s *Store) List(filter Filter) ([]*Exchange, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := make([]*Exchange, 0)
+	for i := len(s.exchanges) - 1; i >= 0; i-- {
+		if filter.matches(s.exchanges[i]) {
+			matched = append(matched, s.exchanges[i])
+		}
+	}
+	total := len(matched)
+	if filter.Offset >= total {
+		return []*Exchange{}, total
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+
+	result := make([]*Exchange, 0, len(matched))
+	for _, exchange := range matched {
+		result = append(result, exchange.clone())
+	}
+	return result, total
+}
+
+// Link records that an exchange is evidence for a finding.
+func (s *Store) Link(id, findingID string) *Exchange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exchange, ok := s.byID[id]
+	if !ok {
+		return nil
+	}
+	for _, existing := range exchange.FindingIDs {
+		if existing == findingID {
+			return exchange.clone()
+		}
+	}
+	exchange.FindingIDs = append(exchange.FindingIDs, findingID)
+	return exchange.clone()
+}
@@ -0,0 +1,175 @@
+package capture
+
+import (
+	"encoding/base64"
+	"net/url"
+	"time"
+)
+
+func base64Encode(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// HAR is an HTTP Archive 1.2 document.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARTimings struct {
+	Send    int64 `json:"send"`
+	Wait    int64 `json:"wait"`
+	Receive int64 `json:"receive"`
+}
+
+// HAREntry is one exchange. The underscore fields are HAR custom fields
+// linking the entry back to its exchange.
+type HAREntry struct {
+	StartedDateTime string                 `json:"startedDateTime"`
+	Time            int64                  `json:"time"`
+	Request         HARRequest             `json:"request"`
+	Response        HARResponse            `json:"response"`
+	Cache           map[string]interface{} `json:"cache"`
+	Timings         HARTimings             `json:"timings"`
+	ExchangeID      string                 `json:"_exchangeId"`
+	AgentID         string                 `json:"_agentId,omitempty"`
+	FindingIDs      []string               `json:"_findingIds,omitempty"`
+	Error           string                 `json:"_error,omitempty"`
+}
+
+func harHeaders(headers []Header) []HARNameValue {
+	values := make([]HARNameValue, 0, len(headers))
+	for _, header := range headers {
+		values = append(values, HARNameValue{Name: header.Name, Value: header.Value})
+	}
+	return values
+}
+
+func harQuery(rawURL string) []HARNameValue {
+	values := make([]HARNameValue, 0)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return values
+	}
+	for name, list := range u.Query() {
+		for _, value := range list {
+			values = append(values, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return values
+}
+
+// NewHAR exports exchanges, in the given order, as a HAR document.
+// Redacted headers keep their placeholder values and cookies are not listed
+// separately, since their headers are redacted.
+func NewHAR(exchanges []*Exchange) HAR {
+	har := HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "performa", Version: "2.0.0"},
+		Entries: make([]HAREntry, 0, len(exchanges)),
+	}}
+
+	for _, exchange := range exchanges {
+		entry := HAREntry{
+			StartedDateTime: exchange.StartedAt.UTC().Format(time.RFC3339Nano),
+			Time:            exchange.DurationMs,
+			Request: HARRequest{
+				Method:      exchange.Request.Method,
+				URL:         exchange.Request.URL,
+				HTTPVersion: exchange.Request.HTTPVersion,
+				Cookies:     []HARNameValue{},
+				Headers:     harHeaders(exchange.Request.Headers),
+				QueryString: harQuery(exchange.Request.URL),
+				HeadersSize: -1,
+				BodySize:    exchange.Request.Body.Size,
+			},
+			Response: HARResponse{
+				Cookies:     []HARNameValue{},
+				Headers:     []HARNameValue{},
+				Content:     HARContent{MimeType: "x-unknown"},
+				HeadersSize: -1,
+				BodySize:    -1,
+			},
+			Cache:      map[string]interface{}{},
+			Timings:    HARTimings{Send: 0, Wait: exchange.DurationMs, Receive: 0},
+			ExchangeID: exchange.ID,
+			AgentID:    exchange.AgentID,
+			FindingIDs: exchange.FindingIDs,
+			Error:      exchange.Error,
+		}
+		if body := exchange.Request.Body; body.Size > 0 && body.Encoding == "" {
+			entry.Request.PostData = &HARPostData{MimeType: body.MimeType, Text: body.Text}
+		}
+		if response := exchange.Response; response != nil {
+			entry.Response.Status = response.Status
+			entry.Response.StatusText = response.StatusText
+			entry.Response.HTTPVersion = response.HTTPVersion
+			entry.Response.Headers = harHeaders(response.Headers)
+			entry.Response.BodySize = response.Body.Size
+			entry.Response.Content = HARContent{
+				Size:     response.Body.Size,
+				MimeType: response.Body.MimeType,
+				Text:     response.Body.Text,
+				Encoding: response.Body.Encoding,
+			}
+			for _, header := range response.Headers {
+				if header.Name == "Location" {
+					entry.Response.RedirectURL = header.Value
+				}
+			}
+		}
+		har.Log.Entries = append(har.Log.Entries, entry)
+	}
+	return har
+}
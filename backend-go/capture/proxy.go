@@ -0,0 +1,530 @@
+package capture
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/stealth"
+)
+
+const (
+	// upstreamTimeout bounds connecting to a target and waiting for its
+	// response headers.
+	upstreamTimeout = 30 * time.Second
+	leafValidity    = 7 * 24 * time.Hour
+)
+
+// hopHeaders only apply to a single connection and are not forwarded.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Session attributes the traffic sent with its token to an agent, and
+// forwards it along the agent's operation's route and pacer.
+type Session struct {
+	OperationID string
+	AgentID     string
+	token       string
+	pacer       *stealth.Pacer
+	transport   *http.Transport
+}
+
+// Proxy is the local intercepting proxy. It only listens on a loopback
+// address and only serves clients presenting a session token. HTTPS is
+// intercepted with certificates signed by the proxy's CA, which tools are
+// given to trust.
+type Proxy struct {
+	addr     string
+	caDir    string
+	store    *Store
+	listener net.Listener
+	ca       *x509.Certificate
+	caKey    *ecdsa.PrivateKey
+	caFile   string
+	leafKey  *ecdsa.PrivateKey
+	leaves   map[string]*tls.Certificate
+	sessions map[string]*Session
+	byAgent  map[string]*Session
+	mu       sync.Mutex
+}
+
+var (
+	Exchanges = NewStore()
+	Default   = &Proxy{store: Exchanges, addr: "127.0.0.1:0", caDir: "./capture-ca"}
+)
+
+// Configure sets the address the proxy listens on once started and the
+// directory its CA is kept in.
+func (p *Proxy) Configure(addr, caDir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if addr != "" {
+		p.addr = addr
+	}
+	if caDir != "" {
+		p.caDir = caDir
+	}
+}
+
+// start must be called with p.mu held. It loads or creates the CA and starts
+// listening, once.
+func (p *Proxy) start() error {
+	if p.listener != nil {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(p.addr)
+	if err != nil {
+		return fmt.Errorf("invalid capture proxy address %q: %w", p.addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("capture proxy address %q is not a loopback address", p.addr)
+	}
+
+	if err := p.loadCA(); err != nil {
+		return err
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start capture proxy: %w", err)
+	}
+	p.listener = listener
+	p.leafKey = leafKey
+	p.leaves = make(map[string]*tls.Certificate)
+	p.sessions = make(map[string]*Session)
+	p.byAgent = make(map[string]*Session)
+
+	server := &http.Server{Handler: p, ReadHeaderTimeout: upstreamTimeout}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Printf("Capture: proxy stopped: %v", err)
+		}
+	}()
+	log.Printf("Capture: proxy listening on %s", listener.Addr())
+	return nil
+}
+
+// loadCA reads the CA from the CA directory, creating it on first use so
+// that the same CA can be trusted across restarts.
+func (p *Proxy) loadCA() error {
+	certFile := filepath.Join(p.caDir, "ca.pem")
+	keyFile := filepath.Join(p.caDir, "ca-key.pem")
+
+	certPEM, certErr := os.ReadFile(certFile)
+	keyPEM, keyErr := os.ReadFile(keyFile)
+	if certErr == nil && keyErr == nil {
+		certBlock, _ := pem.Decode(certPEM)
+		keyBlock, _ := pem.Decode(keyPEM)
+		if certBlock == nil || keyBlock == nil {
+			return fmt.Errorf("invalid capture CA in %s", p.caDir)
+		}
+		cert, err := x509.ParseCertificate(certBlock.Bytes)
+		if err != nil {
+			return fmt.Errorf("invalid capture CA certificate: %w", err)
+		}
+		key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return fmt.Errorf("invalid capture CA key: %w", err)
+		}
+		p.ca, p.caKey, p.caFile = cert, key, certFile
+		return nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "Performa Capture CA", Organization: []string{"Performa"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(5, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(p.caDir, 0700); err != nil {
+		return fmt.Errorf("failed to create capture CA directory: %w", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+	p.ca, p.caKey, p.caFile = cert, key, certFile
+	return nil
+}
+
+func randomSerial() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 126))
+	return serial
+}
+
+// CACertificate returns the PEM encoded CA certificate tools must trust, and
+// the path of its file. The proxy is started if it is not running.
+func (p *Proxy) CACertificate() ([]byte, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.start(); err != nil {
+		return nil, "", err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.ca.Raw}), p.caFile, nil
+}
+
+// Session returns the proxy URL an agent's tools use, carrying the agent's
+// session token, and the path of the CA certificate they must trust. The
+// agent's traffic is forwarded through the route's proxies, if any, paced by
+// pacer. The proxy is started on first use.
+func (p *Proxy) Session(operationID, agentID string, route *stealth.Route, pacer *stealth.Pacer) (string, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.start(); err != nil {
+		return "", "", err
+	}
+
+	session, ok := p.byAgent[agentID]
+	if !ok {
+		dialer, err := route.Dialer(upstreamTimeout)
+		if err != nil {
+			return "", "", err
+		}
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return "", "", err
+		}
+		session = &Session{
+			OperationID: operationID,
+			AgentID:     agentID,
+			token:       hex.EncodeToString(token),
+			pacer:       pacer,
+			transport: &http.Transport{
+				Proxy:       nil,
+				DialContext: dialer.DialContext,
+				// Targets under test routinely present self-signed or expired
+				// certificates, which scanners accept too.
+				TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+				TLSHandshakeTimeout:   upstreamTimeout,
+				ResponseHeaderTimeout: upstreamTimeout,
+				DisableCompression:    true,
+				MaxIdleConnsPerHost:   4,
+				IdleConnTimeout:       60 * time.Second,
+			},
+		}
+		p.sessions[session.token] = session
+		p.byAgent[agentID] = session
+	}
+
+	proxyURL := url.URL{
+		Scheme: "http",
+		User:   url.UserPassword(session.token, "capture"),
+		Host:   p.listener.Addr().String(),
+	}
+	return proxyURL.String(), p.caFile, nil
+}
+
+func (p *Proxy) authenticate(r *http.Request) *Session {
+	auth := r.Header.Get("Proxy-Authorization")
+	if !strings.HasPrefix(auth, "Basic ") {
+		return nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
+	if err != nil {
+		return nil
+	}
+	token := strings.SplitN(string(decoded), ":", 2)[0]
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions[token]
+}
+
+// certificate returns a leaf certificate for host signed by the CA.
+func (p *Proxy) certificate(host string) (*tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cert, ok := p.leaves[host]; ok && time.Now().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &p.leafKey.PublicKey, p.caKey)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{Certificate: [][]byte{der, p.ca.Raw}, PrivateKey: p.leafKey, Leaf: leaf}
+	p.leaves[host] = cert
+	return cert, nil
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session := p.authenticate(r)
+	if session == nil {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="performa-capture"`)
+		http.Error(w, "capture session required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.intercept(w, r, session)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "absolute URL required", http.StatusBadRequest)
+		return
+	}
+
+	resp := p.forward(session, r)
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// intercept terminates the TLS connection a CONNECT opens with a certificate
+// for the requested host and forwards the requests sent over it.
+func (p *Proxy) intercept(w http.ResponseWriter, r *http.Request, session *Session) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be intercepted", http.StatusInternalServerError)
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+
+	target := r.Host
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+	}
+	tlsConn := tls.Server(conn, &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return p.certificate(hello.ServerName)
+			}
+			return p.certificate(host)
+		},
+	})
+	tlsConn.SetDeadline(time.Now().Add(upstreamTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	reader := bufio.NewReader(tlsConn)
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		req.URL.Scheme = "https"
+		req.URL.Host = target
+		req.RemoteAddr = r.RemoteAddr
+
+		resp := p.forward(session, req)
+		removeHopHeaders(resp.Header)
+		err = resp.Write(tlsConn)
+		io.Copy(io.Discard, req.Body)
+		if err != nil || req.Close || resp.Close {
+			return
+		}
+	}
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, name := range strings.Split(header.Get("Connection"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			header.Del(name)
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// limitedCapture keeps the first limit bytes written to it and counts the
+// rest.
+type limitedCapture struct {
+	data  []byte
+	limit int
+	size  int64
+}
+
+func (c *limitedCapture) Write(p []byte) (int, error) {
+	c.size += int64(len(p))
+	if remaining := c.limit - len(c.data); remaining > 0 {
+		if len(p) > remaining {
+			c.data = append(c.data, p[:remaining]...)
+		} else {
+			c.data = append(c.data, p...)
+		}
+	}
+	return len(p), nil
+}
+
+// recordingBody captures a response body as it is read and stores the
+// exchange once it is closed.
+type recordingBody struct {
+	io.ReadCloser
+	reader  io.Reader
+	capture *limitedCapture
+	done    func(*limitedCapture)
+	once    sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.capture) })
+	return err
+}
+
+// forward sends a request upstream and returns the response to relay to the
+// tool, recording the exchange. Failures are answered with a 502.
+func (p *Proxy) forward(session *Session, r *http.Request) *http.Response {
+	limit := p.store.MaxBodyBytes()
+	exchange := &Exchange{
+		OperationID: session.OperationID,
+		AgentID:     session.AgentID,
+		StartedAt:   time.Now(),
+	}
+
+	header := r.Header.Clone()
+	if header.Get("Host") == "" {
+		header.Set("Host", r.Host)
+	}
+	header.Del("Proxy-Authorization")
+	exchange.Request = Request{
+		Method:      r.Method,
+		URL:         r.URL.String(),
+		HTTPVersion: r.Proto,
+		Headers:     p.store.Headers(header),
+	}
+
+	requestBody := &limitedCapture{limit: limit}
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header = r.Header.Clone()
+	removeHopHeaders(out.Header)
+	if r.Body != nil && r.Body != http.NoBody {
+		out.Body = io.NopCloser(io.TeeReader(r.Body, requestBody))
+	}
+
+	err := session.pacer.Wait(r.Context())
+	var resp *http.Response
+	if err == nil {
+		resp, err = session.transport.RoundTrip(out)
+	}
+	exchange.Request.Body = NewBody(requestBody.data, requestBody.size, r.Header.Get("Content-Type"))
+
+	if err != nil {
+		exchange.DurationMs = time.Since(exchange.StartedAt).Milliseconds()
+		exchange.Error = err.Error()
+		p.store.Add(exchange)
+		message := "capture proxy: " + err.Error()
+		return &http.Response{
+			StatusCode:    http.StatusBadGateway,
+			Status:        "502 Bad Gateway",
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			Body:          io.NopCloser(strings.NewReader(message)),
+			ContentLength: int64(len(message)),
+			Close:         true,
+			Request:       r,
+		}
+	}
+
+	response := &Response{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+		HTTPVersion: resp.Proto,
+		Headers:     p.store.Headers(resp.Header),
+	}
+	responseBody := &limitedCapture{limit: limit}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		reader:     io.TeeReader(resp.Body, responseBody),
+		capture:    responseBody,
+		done: func(captured *limitedCapture) {
+			response.Body = NewBody(captured.data, captured.size, resp.Header.Get("Content-Type"))
+			exchange.Response = response
+			exchange.DurationMs = time.Since(exchange.StartedAt).Milliseconds()
+			p.store.Add(exchange)
+		},
+	}
+	return resp
+}
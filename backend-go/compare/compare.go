@@ -0,0 +1,293 @@
+// Package compare diffs two snapshots of an engagement, such as two saved
+// sessions or two operations against the same scope, to show what changed
+// after a re-run: new, resolved and re-rated findings, new and vanished
+// assets, and how the agents fared.
+package compare
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Finding is the part of a finding compared between snapshots. Findings of
+// two snapshots are the same finding when their titles and targets match,
+// ignoring case, as their IDs differ from run to run.
+type Finding struct {
+	ID       string `json:"id,omitempty"`
+	Title    string `json:"title"`
+	Severity string `json:"severity"`
+	Category string `json:"category,omitempty"`
+	Target   string `json:"target,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+func (f Finding) key() string {
+	return strings.ToLower(strings.TrimSpace(f.Title)) + "\x00" + strings.ToLower(strings.TrimSpace(f.Target))
+}
+
+// Asset is a host seen in a snapshot, keyed by its identifier.
+type Asset struct {
+	Identifier string `json:"identifier"`
+	Kind       string `json:"kind,omitempty"`
+	Ports      []int  `json:"ports,omitempty"`
+}
+
+// Agent is the part of an agent compared between snapshots.
+type Agent struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	TaskCount int    `json:"task_count"`
+	Findings  int    `json:"findings"`
+	ToolRuns  int    `json:"tool_runs"`
+	LLMCalls  int    `json:"llm_calls"`
+}
+
+// Snapshot is one side of a comparison.
+type Snapshot struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Findings  []Finding `json:"-"`
+	Assets    []Asset   `json:"-"`
+	Agents    []Agent   `json:"-"`
+}
+
+// SeverityChange is a finding present in both snapshots whose severity
+// changed.
+type SeverityChange struct {
+	Finding Finding `json:"finding"`
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+}
+
+type FindingDelta struct {
+	New             []Finding        `json:"new"`
+	Resolved        []Finding        `json:"resolved"`
+	SeverityChanged []SeverityChange `json:"severity_changed"`
+	Unchanged       int              `json:"unchanged"`
+	// BySeverity counts findings per severity in each snapshot.
+	BySeverity map[string]*SeverityCount `json:"by_severity"`
+}
+
+type SeverityCount struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+// PortChange lists the ports that opened or closed on an asset present in
+// both snapshots.
+type PortChange struct {
+	Identifier string `json:"identifier"`
+	Opened     []int  `json:"opened,omitempty"`
+	Closed     []int  `json:"closed,omitempty"`
+}
+
+type AssetDelta struct {
+	New       []Asset      `json:"new"`
+	Removed   []Asset      `json:"removed"`
+	Changed   []PortChange `json:"changed"`
+	Unchanged int          `json:"unchanged"`
+}
+
+// AgentStats aggregates a snapshot's agents. SuccessRate is the share of
+// finished agents that completed rather than failed.
+type AgentStats struct {
+	Agents      int     `json:"agents"`
+	Completed   int     `json:"completed"`
+	Errored     int     `json:"errored"`
+	Stopped     int     `json:"stopped"`
+	Active      int     `json:"active"`
+	Tasks       int     `json:"tasks"`
+	Findings    int     `json:"findings"`
+	ToolRuns    int     `json:"tool_runs"`
+	LLMCalls    int     `json:"llm_calls"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+type AgentDelta struct {
+	A AgentStats `json:"a"`
+	B AgentStats `json:"b"`
+	// Change is B minus A.
+	Change AgentStats `json:"change"`
+}
+
+// Delta is the structured difference between snapshot A, the baseline, and
+// snapshot B.
+type Delta struct {
+	A           Snapshot     `json:"a"`
+	B           Snapshot     `json:"b"`
+	Findings    FindingDelta `json:"findings"`
+	Assets      AssetDelta   `json:"assets"`
+	Agents      AgentDelta   `json:"agents"`
+	GeneratedAt time.Time    `json:"generated_at"`
+}
+
+// Diff compares snapshot b against the baseline a.
+func Diff(a, b Snapshot) *Delta {
+	return &Delta{
+		A:           a,
+		B:           b,
+		Findings:    diffFindings(a.Findings, b.Findings),
+		Assets:      diffAssets(a.Assets, b.Assets),
+		Agents:      diffAgents(a.Agents, b.Agents),
+		GeneratedAt: time.Now(),
+	}
+}
+
+func indexFindings(findings []Finding) (map[string]Finding, []string) {
+	index := make(map[string]Finding, len(findings))
+	var order []string
+	for _, finding := range findings {
+		key := finding.key()
+		if _, seen := index[key]; !seen {
+			order = append(order, key)
+		}
+		index[key] = finding
+	}
+	return index, order
+}
+
+func diffFindings(a, b []Finding) FindingDelta {
+	delta := FindingDelta{
+		New:             []Finding{},
+		Resolved:        []Finding{},
+		SeverityChanged: []SeverityChange{},
+		BySeverity:      make(map[string]*SeverityCount),
+	}
+	count := func(severity string) *SeverityCount {
+		if delta.BySeverity[severity] == nil {
+			delta.BySeverity[severity] = &SeverityCount{}
+		}
+		return delta.BySeverity[severity]
+	}
+	before, beforeOrder := indexFindings(a)
+	after, afterOrder := indexFindings(b)
+
+	for _, key := range afterOrder {
+		finding := after[key]
+		count(finding.Severity).B++
+
+		previous, existed := before[key]
+		switch {
+		case !existed:
+			delta.New = append(delta.New, finding)
+		case !strings.EqualFold(previous.Severity, finding.Severity):
+			delta.SeverityChanged = append(delta.SeverityChanged, SeverityChange{Finding: finding, From: previous.Severity, To: finding.Severity})
+		default:
+			delta.Unchanged++
+		}
+	}
+	for _, key := range beforeOrder {
+		finding := before[key]
+		count(finding.Severity).A++
+
+		if _, still := after[key]; !still {
+			delta.Resolved = append(delta.Resolved, finding)
+		}
+	}
+	return delta
+}
+
+func indexAssets(assets []Asset) map[string]Asset {
+	index := make(map[string]Asset, len(assets))
+	for _, asset := range assets {
+		index[strings.ToLower(asset.Identifier)] = asset
+	}
+	return index
+}
+
+func diffAssets(a, b []Asset) AssetDelta {
+	delta := AssetDelta{New: []Asset{}, Removed: []Asset{}, Changed: []PortChange{}}
+	before := indexAssets(a)
+	after := indexAssets(b)
+
+	for key, asset := range after {
+		previous, existed := before[key]
+		if !existed {
+			delta.New = append(delta.New, asset)
+			continue
+		}
+		opened := missingPorts(asset.Ports, previous.Ports)
+		closed := missingPorts(previous.Ports, asset.Ports)
+		if len(opened) > 0 || len(closed) > 0 {
+			delta.Changed = append(delta.Changed, PortChange{Identifier: asset.Identifier, Opened: opened, Closed: closed})
+		} else {
+			delta.Unchanged++
+		}
+	}
+	for key, asset := range before {
+		if _, still := after[key]; !still {
+			delta.Removed = append(delta.Removed, asset)
+		}
+	}
+
+	sort.Slice(delta.New, func(i, j int) bool { return delta.New[i].Identifier < delta.New[j].Identifier })
+	sort.Slice(delta.Removed, func(i, j int) bool { return delta.Removed[i].Identifier < delta.Removed[j].Identifier })
+	sort.Slice(delta.Changed, func(i, j int) bool { return delta.Changed[i].Identifier < delta.Changed[j].Identifier })
+	return delta
+}
+
+// missingPorts returns the ports of ports that are not in other.
+func missingPorts(ports, other []int) []int {
+	present := make(map[int]bool, len(other))
+	for _, port := range other {
+		present[port] = true
+	}
+	var missing []int
+	for _, port := range ports {
+		if !present[port] {
+			missing = append(missing, port)
+		}
+	}
+	sort.Ints(missing)
+	return missing
+}
+
+// Stats aggregates agents.
+func Stats(agents []Agent) AgentStats {
+	var stats AgentStats
+	for _, agent := range agents {
+		stats.Agents++
+		switch agent.Status {
+		case "complete":
+			stats.Completed++
+		case "error":
+			stats.Errored++
+		case "stopped":
+			stats.Stopped++
+		default:
+			stats.Active++
+		}
+		stats.Tasks += agent.TaskCount
+		stats.Findings += agent.Findings
+		stats.ToolRuns += agent.ToolRuns
+		stats.LLMCalls += agent.LLMCalls
+	}
+	if finished := stats.Completed + stats.Errored; finished > 0 {
+		stats.SuccessRate = float64(stats.Completed) / float64(finished)
+	}
+	return stats
+}
+
+func diffAgents(a, b []Agent) AgentDelta {
+	before, after := Stats(a), Stats(b)
+	return AgentDelta{
+		A: before,
+		B: after,
+		Change: AgentStats{
+			Agents:      after.Agents - before.Agents,
+			Completed:   after.Completed - before.Completed,
+			Errored:     after.Errored - before.Errored,
+			Stopped:     after.Stopped - before.Stopped,
+			Active:      after.Active - before.Active,
+			Tasks:       after.Tasks - before.Tasks,
+			Findings:    after.Findings - before.Findings,
+			ToolRuns:    after.ToolRuns - before.ToolRuns,
+			LLMCalls:    after.LLMCalls - before.LLMCalls,
+			SuccessRate: after.SuccessRate - before.SuccessRate,
+		},
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
         "os"
         "strconv"
+        "strings"
 
         "github.com/joho/godotenv"
 )
@@ -10,12 +11,192 @@ import (
 type Config struct {
         Host             string
         Port             int
+        GRPCPort         int
         OpenRouterAPIKey string
         AnthropicAPIKey  string
         OpenAIAPIKey     string
         LogDir           string
         FindingsDir      string
         BrainServiceURL  string
+
+        CredentialsMasterKey string
+        AdminToken           string
+
+        AuthEnabled         bool
+        JWTSecret           string
+        JWTAccessTTLMinutes int
+        JWTRefreshTTLHours  int
+        AuthAdminUsername   string
+        AuthAdminPassword   string
+
+        RedisURL       string
+        RedisWSChannel string
+
+        StorageBackend    string
+        StorageSigningKey string
+        S3Endpoint        string
+        S3Region          string
+        S3Bucket          string
+        S3AccessKeyID     string
+        S3SecretAccessKey string
+        S3Prefix          string
+        S3UsePathStyle    bool
+
+        OTelServiceName    string
+        OTelServiceVersion string
+        OTLPEndpoint       string
+        OTLPHeaders        map[string]string
+        TraceSampleRatio   float64
+        OTLPFlushSeconds   int
+        SyslogNetwork      string
+        SyslogAddress      string
+        SyslogFormat       string
+
+        StealthProxies       []string
+        TorSOCKSAddr         string
+        DoHEndpoint          string
+        DoHFallback          bool
+        FingerprintRotation  int
+        TrafficPaddingRatio  float64
+        ExitIPCheckURL       string
+        ToolExecutionEnabled bool
+        AgentMaxSteps        int
+        ToolTimeoutSeconds   int
+
+        // Default per-agent resource limits; 0 leaves a limit off.
+        AgentMaxToolCPUSeconds  float64
+        AgentMaxToolMemoryMB    int
+        AgentMaxConcurrentTools int
+        AgentMaxLLMCalls        int
+
+        // Running agents whose loop has not reported for AgentStaleSeconds are
+        // flagged stale, and after AgentReapSeconds marked as failed; the
+        // reaper checks every AgentReaperSeconds. 0 turns a stage off.
+        AgentStaleSeconds  int
+        AgentReapSeconds   int
+        AgentReaperSeconds int
+
+        // Agent conversations are summarized past ContextThreshold of the
+        // model's window, or of ContextMaxTokens when it is set and smaller.
+        ContextMaxTokens     int
+        ContextDefaultTokens int
+        ContextThreshold     float64
+        ContextKeepRecent    int
+        ContextSummaryModel  string
+
+        ExecutionBackend      string
+        DockerSandboxImage    string
+        DockerSandboxImages   map[string]string
+        DockerSandboxCPUs     float64
+        DockerSandboxMemoryMB int
+        DockerSandboxNetwork  string
+
+        CommandPolicyFile string
+
+        ToolInstallEnabled   bool
+        ToolInstallContainer string
+        ToolInstallAllowlist []string
+
+        NucleiTemplatesDir  string
+        NucleiTemplatesRepo string
+
+        WordlistsDir string
+
+        ShodanAPIKey      string
+        ShodanAPIURL      string
+        ShodanRateLimit   float64
+        CensysAPIID       string
+        CensysAPISecret   string
+        CensysAPIURL      string
+        CensysRateLimit   float64
+        OSINTCacheMinutes int
+
+        CVEEnrichment bool
+        NVDAPIKey     string
+        NVDAPIURL     string
+        OSVAPIURL     string
+        CISAKEVURL    string
+        CVECacheDir   string
+        CVECacheHours int
+        CVEMirrorDir  string
+        CVEOffline    bool
+
+        CaptureProxyAddr     string
+        CaptureCADir         string
+        CaptureMaxExchanges  int
+        CaptureMaxBodyBytes  int
+        CaptureRedactHeaders []string
+
+        PrivilegedNetworkEnabled    bool
+        NetworkTestInterface        string
+        NetworkManagementInterfaces []string
+        NetworkStateFile            string
+        SpoofSessionSeconds         int
+        SpoofMaxSessionSeconds      int
+        SpoofReportSeconds          int
+
+        ResourceMonitorInterval int
+        ResourceMonitorMounts   []string
+
+        AlertCPUThreshold    float64
+        AlertMemoryThreshold float64
+        AlertDiskThreshold   float64
+        AlertHysteresis      float64
+        AlertWebhookURL      string
+        AlertSlackWebhookURL string
+
+        // SMTP settings of the mailer sending email digests. SMTPTLS is
+        // "starttls", "tls" (implicit TLS, usually port 465) or "none";
+        // DigestHour is the UTC hour daily digests go out at.
+        SMTPHost     string
+        SMTPPort     int
+        SMTPUsername string
+        SMTPPassword string
+        SMTPFrom     string
+        SMTPTLS      string
+        DigestHour   int
+
+        IntegrationSyncSeconds int
+
+        SessionSnapshotSeconds int
+        SessionSnapshotKeep    int
+
+        OperationProgressSeconds int
+        // CostTickerSeconds is the interval of the cost_update events of
+        // running operations; 0 turns them off.
+        CostTickerSeconds int
+
+        RetentionLogsDays        int
+        RetentionFindingsDays    int
+        RetentionSessionsDays    int
+        RetentionMessagesDays    int
+        RetentionMaxDiskMB       int
+        RetentionIntervalMinutes int
+        RetentionArchiveDir      string
+
+        BackupEncryptionKey string
+        BackupDir           string
+
+        FindingAutoClassify  bool
+        FindingAutoRemediate bool
+        FindingLLMExtraction bool
+        RemediationModel     string
+        ReportSummaryModel   string
+
+        BrainLearningEnabled      bool
+        BrainLearningBatchSize    int
+        BrainLearningFlushSeconds int
+        BrainCacheSize            int
+        BrainCacheTTLMinutes      int
+        JobWorkers                int
+        IdempotencyTTLHours       int
+
+        DBMaxOpenConns        int
+        DBMaxIdleConns        int
+        DBConnMaxLifetimeSecs int
+        DBConnMaxIdleTimeSecs int
+        DBQueryTimeoutSeconds int
+        DBMaxRetries          int
 }
 
 var AppConfig *Config
@@ -25,17 +206,238 @@ func Load() {
         godotenv.Load("../.env")
 
         port, _ := strconv.Atoi(getEnv("PORT", "8000"))
+        grpcPort, _ := strconv.Atoi(getEnv("GRPC_PORT", "50051"))
+        maxSteps, _ := strconv.Atoi(getEnv("AGENT_MAX_STEPS", "5"))
+        toolTimeout, _ := strconv.Atoi(getEnv("TOOL_TIMEOUT_SECONDS", "300"))
+        maxToolMemory, _ := strconv.Atoi(getEnv("AGENT_MAX_TOOL_MEMORY_MB", "0"))
+        maxConcurrentTools, _ := strconv.Atoi(getEnv("AGENT_MAX_CONCURRENT_TOOLS", "0"))
+        maxLLMCalls, _ := strconv.Atoi(getEnv("AGENT_MAX_LLM_CALLS", "0"))
+        agentStale, _ := strconv.Atoi(getEnv("AGENT_STALE_AFTER_SECONDS", "600"))
+        agentReap, _ := strconv.Atoi(getEnv("AGENT_REAP_AFTER_SECONDS", "1800"))
+        agentReaper, _ := strconv.Atoi(getEnv("AGENT_REAPER_INTERVAL_SECONDS", "30"))
+        contextMaxTokens, _ := strconv.Atoi(getEnv("CONTEXT_MAX_TOKENS", "0"))
+        contextDefaultTokens, _ := strconv.Atoi(getEnv("CONTEXT_DEFAULT_TOKENS", "32000"))
+        contextKeepRecent, _ := strconv.Atoi(getEnv("CONTEXT_KEEP_RECENT_MESSAGES", "6"))
+        fingerprintRotation, _ := strconv.Atoi(getEnv("FINGERPRINT_ROTATE_EVERY", "25"))
+        paddingRatio, _ := strconv.ParseFloat(getEnv("TRAFFIC_PADDING_RATIO", "0.5"), 64)
+        monitorInterval, _ := strconv.Atoi(getEnv("RESOURCE_MONITOR_INTERVAL", "5"))
+        learningBatch, _ := strconv.Atoi(getEnv("BRAIN_LEARNING_BATCH_SIZE", "20"))
+        learningFlush, _ := strconv.Atoi(getEnv("BRAIN_LEARNING_FLUSH_SECONDS", "30"))
+        brainCacheSize, _ := strconv.Atoi(getEnv("BRAIN_CACHE_SIZE", "500"))
+        brainCacheTTL, _ := strconv.Atoi(getEnv("BRAIN_CACHE_TTL_MINUTES", "1440"))
+        jobWorkers, _ := strconv.Atoi(getEnv("JOB_WORKERS", "2"))
+        idempotencyTTL, _ := strconv.Atoi(getEnv("IDEMPOTENCY_TTL_HOURS", "24"))
+        integrationSync, _ := strconv.Atoi(getEnv("INTEGRATION_SYNC_SECONDS", "300"))
+        snapshotSeconds, _ := strconv.Atoi(getEnv("SESSION_SNAPSHOT_SECONDS", "60"))
+        snapshotKeep, _ := strconv.Atoi(getEnv("SESSION_SNAPSHOT_KEEP", "10"))
+        progressSeconds, _ := strconv.Atoi(getEnv("OPERATION_PROGRESS_SECONDS", "10"))
+        costTickerSeconds, _ := strconv.Atoi(getEnv("COST_TICKER_SECONDS", "5"))
+        retentionLogs, _ := strconv.Atoi(getEnv("RETENTION_LOGS_DAYS", "0"))
+        retentionFindings, _ := strconv.Atoi(getEnv("RETENTION_FINDINGS_DAYS", "0"))
+        retentionSessions, _ := strconv.Atoi(getEnv("RETENTION_SESSIONS_DAYS", "0"))
+        retentionMessages, _ := strconv.Atoi(getEnv("RETENTION_MESSAGES_DAYS", "0"))
+        retentionMaxDisk, _ := strconv.Atoi(getEnv("RETENTION_MAX_DISK_MB", "0"))
+        retentionInterval, _ := strconv.Atoi(getEnv("RETENTION_INTERVAL_MINUTES", "60"))
+        captureMaxExchanges, _ := strconv.Atoi(getEnv("CAPTURE_MAX_EXCHANGES", "2000"))
+        captureMaxBody, _ := strconv.Atoi(getEnv("CAPTURE_MAX_BODY_BYTES", "65536"))
+        osintCache, _ := strconv.Atoi(getEnv("OSINT_CACHE_MINUTES", "60"))
+        cveCache, _ := strconv.Atoi(getEnv("CVE_CACHE_HOURS", "168"))
+        spoofSession, _ := strconv.Atoi(getEnv("SPOOF_SESSION_SECONDS", "300"))
+        spoofMaxSession, _ := strconv.Atoi(getEnv("SPOOF_MAX_SESSION_SECONDS", "1800"))
+        spoofReport, _ := strconv.Atoi(getEnv("SPOOF_REPORT_SECONDS", "5"))
+        sandboxMemory, _ := strconv.Atoi(getEnv("DOCKER_SANDBOX_MEMORY_MB", "1024"))
+        otlpFlush, _ := strconv.Atoi(getEnv("OTEL_EXPORTER_OTLP_FLUSH_SECONDS", "5"))
+        dbMaxOpen, _ := strconv.Atoi(getEnv("DB_MAX_OPEN_CONNS", "25"))
+        dbMaxIdle, _ := strconv.Atoi(getEnv("DB_MAX_IDLE_CONNS", "5"))
+        dbLifetime, _ := strconv.Atoi(getEnv("DB_CONN_MAX_LIFETIME_SECONDS", "300"))
+        dbIdleTime, _ := strconv.Atoi(getEnv("DB_CONN_MAX_IDLE_SECONDS", "60"))
+        dbQueryTimeout, _ := strconv.Atoi(getEnv("DB_QUERY_TIMEOUT_SECONDS", "10"))
+        dbRetries, _ := strconv.Atoi(getEnv("DB_MAX_RETRIES", "2"))
+        accessTTL, _ := strconv.Atoi(getEnv("JWT_ACCESS_TTL_MINUTES", "15"))
+        refreshTTL, _ := strconv.Atoi(getEnv("JWT_REFRESH_TTL_HOURS", "168"))
+        smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+        digestHour, _ := strconv.Atoi(getEnv("DIGEST_HOUR", "8"))
 
         AppConfig = &Config{
                 Host:             getEnv("HOST", "0.0.0.0"),
                 Port:             port,
+                GRPCPort:         grpcPort,
                 OpenRouterAPIKey: getEnv("OPENROUTER_API_KEY", ""),
                 AnthropicAPIKey:  getEnv("ANTHROPIC_API_KEY", ""),
                 OpenAIAPIKey:     getEnv("OPENAI_API_KEY", ""),
                 LogDir:           getEnv("LOG_DIR", "./logs"),
                 FindingsDir:      getEnv("FINDINGS_DIR", "./findings"),
                 BrainServiceURL:  getEnv("BRAIN_SERVICE_URL", "http://localhost:8001"),
+
+                CredentialsMasterKey: getEnv("CREDENTIALS_MASTER_KEY", ""),
+                AdminToken:           getEnv("ADMIN_TOKEN", ""),
+
+                AuthEnabled:         getEnvBool("AUTH_ENABLED", false),
+                JWTSecret:           getEnv("JWT_SECRET", ""),
+                JWTAccessTTLMinutes: accessTTL,
+                JWTRefreshTTLHours:  refreshTTL,
+                AuthAdminUsername:   getEnv("AUTH_ADMIN_USERNAME", "admin"),
+                AuthAdminPassword:   getEnv("AUTH_ADMIN_PASSWORD", ""),
+
+                RedisURL:       getEnv("REDIS_URL", ""),
+                RedisWSChannel: getEnv("REDIS_WS_CHANNEL", "performa:ws:broadcast"),
+
+                StorageBackend:    getEnv("STORAGE_BACKEND", "local"),
+                StorageSigningKey: getEnv("STORAGE_SIGNING_KEY", ""),
+                S3Endpoint:        getEnv("S3_ENDPOINT", ""),
+                S3Region:          getEnv("S3_REGION", "us-east-1"),
+                S3Bucket:          getEnv("S3_BUCKET", ""),
+                S3AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+                S3SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+                S3Prefix:          getEnv("S3_PREFIX", ""),
+                S3UsePathStyle:    getEnvBool("S3_USE_PATH_STYLE", false),
+
+                OTelServiceName:    getEnv("OTEL_SERVICE_NAME", "performa-backend"),
+                OTelServiceVersion: getEnv("OTEL_SERVICE_VERSION", "0.1.0"),
+                OTLPEndpoint:       getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+                OTLPHeaders:        getEnvMap("OTEL_EXPORTER_OTLP_HEADERS"),
+                TraceSampleRatio:   getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1),
+                OTLPFlushSeconds:   otlpFlush,
+                SyslogNetwork:      getEnv("SYSLOG_NETWORK", "udp"),
+                SyslogAddress:      getEnv("SYSLOG_ADDRESS", ""),
+                SyslogFormat:       getEnv("SYSLOG_FORMAT", "rfc5424"),
+
+                StealthProxies:       getEnvList("STEALTH_PROXIES"),
+                TorSOCKSAddr:         getEnv("TOR_SOCKS_ADDR", "127.0.0.1:9050"),
+                DoHEndpoint:          getEnv("DOH_ENDPOINT", "cloudflare"),
+                DoHFallback:          getEnvBool("DOH_FALLBACK", true),
+                FingerprintRotation:  fingerprintRotation,
+                TrafficPaddingRatio:  paddingRatio,
+                ExitIPCheckURL:       getEnv("EXIT_IP_CHECK_URL", "https://api.ipify.org?format=json"),
+                ToolExecutionEnabled: getEnvBool("TOOL_EXECUTION_ENABLED", false),
+                AgentMaxSteps:        maxSteps,
+                ToolTimeoutSeconds:   toolTimeout,
+
+                AgentMaxToolCPUSeconds:  getEnvFloat("AGENT_MAX_TOOL_CPU_SECONDS", 0),
+                AgentMaxToolMemoryMB:    maxToolMemory,
+                AgentMaxConcurrentTools: maxConcurrentTools,
+                AgentMaxLLMCalls:        maxLLMCalls,
+
+                AgentStaleSeconds:  agentStale,
+                AgentReapSeconds:   agentReap,
+                AgentReaperSeconds: agentReaper,
+
+                ContextMaxTokens:     contextMaxTokens,
+                ContextDefaultTokens: contextDefaultTokens,
+                ContextThreshold:     getEnvFloat("CONTEXT_SUMMARIZE_THRESHOLD", 0.75),
+                ContextKeepRecent:    contextKeepRecent,
+                ContextSummaryModel:  getEnv("CONTEXT_SUMMARY_MODEL", "openai/gpt-4o-mini"),
+
+                ExecutionBackend:      getEnv("EXECUTION_BACKEND", "local"),
+                DockerSandboxImage:    getEnv("DOCKER_SANDBOX_IMAGE", "performa/tools:latest"),
+                DockerSandboxImages:   getEnvMap("DOCKER_SANDBOX_IMAGES"),
+                DockerSandboxCPUs:     getEnvFloat("DOCKER_SANDBOX_CPUS", 1),
+                DockerSandboxMemoryMB: sandboxMemory,
+                DockerSandboxNetwork:  getEnv("DOCKER_SANDBOX_NETWORK", ""),
+
+                CommandPolicyFile: getEnv("COMMAND_POLICY_FILE", ""),
+
+                ToolInstallEnabled:   getEnvBool("TOOL_INSTALL_ENABLED", false),
+                ToolInstallContainer: getEnv("TOOL_INSTALL_CONTAINER", ""),
+                ToolInstallAllowlist: getEnvList("TOOL_INSTALL_ALLOWLIST"),
+
+                NucleiTemplatesDir:  getEnv("NUCLEI_TEMPLATES_DIR", "./nuclei-templates"),
+                NucleiTemplatesRepo: getEnv("NUCLEI_TEMPLATES_REPO", ""),
+
+                WordlistsDir: getEnv("WORDLISTS_DIR", "./wordlist-data"),
+
+                ShodanAPIKey:      getEnv("SHODAN_API_KEY", ""),
+                ShodanAPIURL:      getEnv("SHODAN_API_URL", ""),
+                ShodanRateLimit:   getEnvFloat("SHODAN_RATE_LIMIT_RPS", 1),
+                CensysAPIID:       getEnv("CENSYS_API_ID", ""),
+                CensysAPISecret:   getEnv("CENSYS_API_SECRET", ""),
+                CensysAPIURL:      getEnv("CENSYS_API_URL", ""),
+                CensysRateLimit:   getEnvFloat("CENSYS_RATE_LIMIT_RPS", 0.4),
+                OSINTCacheMinutes: osintCache,
+
+                CVEEnrichment: getEnvBool("CVE_ENRICHMENT", true),
+                NVDAPIKey:     getEnv("NVD_API_KEY", ""),
+                NVDAPIURL:     getEnv("NVD_API_URL", ""),
+                OSVAPIURL:     getEnv("OSV_API_URL", ""),
+                CISAKEVURL:    getEnv("CISA_KEV_URL", ""),
+                CVECacheDir:   getEnv("CVE_CACHE_DIR", "./cve-cache"),
+                CVECacheHours: cveCache,
+                CVEMirrorDir:  getEnv("CVE_MIRROR_DIR", ""),
+                CVEOffline:    getEnvBool("CVE_OFFLINE", false),
+
+                CaptureProxyAddr:     getEnv("CAPTURE_PROXY_ADDR", "127.0.0.1:0"),
+                CaptureCADir:         getEnv("CAPTURE_CA_DIR", "./capture-ca"),
+                CaptureMaxExchanges:  captureMaxExchanges,
+                CaptureMaxBodyBytes:  captureMaxBody,
+                CaptureRedactHeaders: getEnvList("CAPTURE_REDACT_HEADERS"),
+
+                PrivilegedNetworkEnabled:    getEnvBool("PRIVILEGED_NETWORK_ENABLED", false),
+                NetworkTestInterface:        getEnv("NETWORK_TEST_INTERFACE", ""),
+                NetworkManagementInterfaces: getEnvList("NETWORK_MANAGEMENT_INTERFACES"),
+                NetworkStateFile:            getEnv("NETWORK_STATE_FILE", "./network-state.json"),
+                SpoofSessionSeconds:         spoofSession,
+                SpoofMaxSessionSeconds:      spoofMaxSession,
+                SpoofReportSeconds:          spoofReport,
+
+                ResourceMonitorInterval: monitorInterval,
+                ResourceMonitorMounts:   getEnvList("RESOURCE_MONITOR_MOUNTS"),
+
+                AlertCPUThreshold:    getEnvFloat("ALERT_CPU_THRESHOLD", 90),
+                AlertMemoryThreshold: getEnvFloat("ALERT_MEMORY_THRESHOLD", 85),
+                AlertDiskThreshold:   getEnvFloat("ALERT_DISK_THRESHOLD", 95),
+                AlertHysteresis:      getEnvFloat("ALERT_HYSTERESIS", 5),
+                AlertWebhookURL:      getEnv("ALERT_WEBHOOK_URL", ""),
+                AlertSlackWebhookURL: getEnv("ALERT_SLACK_WEBHOOK_URL", ""),
+
+                SMTPHost:     getEnv("SMTP_HOST", ""),
+                SMTPPort:     smtpPort,
+                SMTPUsername: getEnv("SMTP_USERNAME", ""),
+                SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+                SMTPFrom:     getEnv("SMTP_FROM", ""),
+                SMTPTLS:      strings.ToLower(getEnv("SMTP_TLS", "starttls")),
+                DigestHour:   digestHour,
+
+                IntegrationSyncSeconds: integrationSync,
+
+                SessionSnapshotSeconds: snapshotSeconds,
+                SessionSnapshotKeep:    snapshotKeep,
+
+                OperationProgressSeconds: progressSeconds,
+                CostTickerSeconds:        costTickerSeconds,
+
+                RetentionLogsDays:        retentionLogs,
+                RetentionFindingsDays:    retentionFindings,
+                RetentionSessionsDays:    retentionSessions,
+                RetentionMessagesDays:    retentionMessages,
+                RetentionMaxDiskMB:       retentionMaxDisk,
+                RetentionIntervalMinutes: retentionInterval,
+                RetentionArchiveDir:      getEnv("RETENTION_ARCHIVE_DIR", "./archive"),
+
+                BackupEncryptionKey: getEnv("BACKUP_ENCRYPTION_KEY", ""),
+                BackupDir:           getEnv("BACKUP_DIR", "./backups"),
+
+                FindingAutoClassify:  getEnvBool("FINDING_AUTO_CLASSIFY", true),
+                FindingAutoRemediate: getEnvBool("FINDING_AUTO_REMEDIATE", false),
+                FindingLLMExtraction: getEnvBool("FINDING_LLM_EXTRACTION", true),
+                RemediationModel:     getEnv("REMEDIATION_MODEL", "anthropic/claude-3.5-sonnet"),
+                ReportSummaryModel:   getEnv("REPORT_SUMMARY_MODEL", "anthropic/claude-3.5-sonnet"),
+
+                BrainLearningEnabled:      getEnvBool("BRAIN_LEARNING_ENABLED", true),
+                BrainLearningBatchSize:    learningBatch,
+                BrainLearningFlushSeconds: learningFlush,
+                BrainCacheSize:            brainCacheSize,
+                BrainCacheTTLMinutes:      brainCacheTTL,
+                JobWorkers:                jobWorkers,
+                IdempotencyTTLHours:       idempotencyTTL,
+
+                DBMaxOpenConns:        dbMaxOpen,
+                DBMaxIdleConns:        dbMaxIdle,
+                DBConnMaxLifetimeSecs: dbLifetime,
+                DBConnMaxIdleTimeSecs: dbIdleTime,
+                DBQueryTimeoutSeconds: dbQueryTimeout,
+                DBMaxRetries:          dbRetries,
         }
+        envConfig = AppConfig
 }
 
 func getEnv(key, defaultValue string) string {
@@ -44,3 +446,45 @@ func getEnv(key, defaultValue string) string {
         }
         return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+        if value := os.Getenv(key); value != "" {
+                if b, err := strconv.ParseBool(value); err == nil {
+                        return b
+                }
+        }
+        return defaultValue
+}
+
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+        if value := os.Getenv(key); value != "" {
+                if f, err := strconv.ParseFloat(value, 64); err == nil {
+                        return f
+                }
+        }
+        return defaultValue
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+        var values []string
+        for _, value := range strings.Split(os.Getenv(key), ",") {
+                if value = strings.TrimSpace(value); value != "" {
+                        values = append(values, value)
+                }
+        }
+        return values
+}
+
+// getEnvMap parses a comma-separated list of key=value pairs.
+func getEnvMap(key string) map[string]string {
+        values := make(map[string]string)
+        for _, entry := range getEnvList(key) {
+                k, v, ok := strings.Cut(entry, "=")
+                if k, v = strings.TrimSpace(k), strings.TrimSpace(v); ok && k != "" && v != "" {
+                        values[k] = v
+                }
+        }
+        return values
+}
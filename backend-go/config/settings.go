@@ -0,0 +1,250 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// setting describes a value that can be changed at runtime through
+// /api/admin/settings without restarting the backend.
+type setting struct {
+	env    string
+	secret bool
+	get    func(c *Config) string
+	set    func(c *Config, value string) error
+}
+
+// SettingValue is a setting as reported to clients. Secret values are
+// redacted.
+type SettingValue struct {
+	Key    string `json:"key"`
+	Env    string `json:"env"`
+	Value  string `json:"value"`
+	Secret bool   `json:"secret"`
+	Source string `json:"source"`
+}
+
+func stringSetting(env string, secret bool, field func(c *Config) *string) setting {
+	return setting{
+		env:    env,
+		secret: secret,
+		get:    func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+func urlSetting(env string, field func(c *Config) *string) setting {
+	s := stringSetting(env, false, field)
+	s.set = func(c *Config, value string) error {
+		if value != "" {
+			if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("must be an absolute URL")
+			}
+		}
+		*field(c) = value
+		return nil
+	}
+	return s
+}
+
+func intSetting(env string, min int, field func(c *Config) *int) setting {
+	return setting{
+		env: env,
+		get: func(c *Config) string { return strconv.Itoa(*field(c)) },
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < min {
+				return fmt.Errorf("must be an integer >= %d", min)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+func choiceSetting(env string, choices []string, field func(c *Config) *string) setting {
+	s := stringSetting(env, false, field)
+	s.set = func(c *Config, value string) error {
+		value = strings.ToLower(strings.TrimSpace(value))
+		for _, choice := range choices {
+			if value == choice {
+				*field(c) = value
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(choices, ", "))
+	}
+	return s
+}
+
+func floatSetting(env string, field func(c *Config) *float64) setting {
+	return setting{
+		env: env,
+		get: func(c *Config) string { return strconv.FormatFloat(*field(c), 'f', -1, 64) },
+		set: func(c *Config, value string) error {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil || f < 0 || f > 100 {
+				return fmt.Errorf("must be a number between 0 and 100")
+			}
+			*field(c) = f
+			return nil
+		},
+	}
+}
+
+func boolSetting(env string, field func(c *Config) *bool) setting {
+	return setting{
+		env: env,
+		get: func(c *Config) string { return strconv.FormatBool(*field(c)) },
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("must be true or false")
+			}
+			*field(c) = b
+			return nil
+		},
+	}
+}
+
+var settings = map[string]setting{
+	"brain_service_url":       urlSetting("BRAIN_SERVICE_URL", func(c *Config) *string { return &c.BrainServiceURL }),
+	"openrouter_api_key":      stringSetting("OPENROUTER_API_KEY", true, func(c *Config) *string { return &c.OpenRouterAPIKey }),
+	"anthropic_api_key":       stringSetting("ANTHROPIC_API_KEY", true, func(c *Config) *string { return &c.AnthropicAPIKey }),
+	"openai_api_key":          stringSetting("OPENAI_API_KEY", true, func(c *Config) *string { return &c.OpenAIAPIKey }),
+	"tool_execution_enabled":  boolSetting("TOOL_EXECUTION_ENABLED", func(c *Config) *bool { return &c.ToolExecutionEnabled }),
+	"agent_max_steps":         intSetting("AGENT_MAX_STEPS", 1, func(c *Config) *int { return &c.AgentMaxSteps }),
+	"tool_timeout_seconds":    intSetting("TOOL_TIMEOUT_SECONDS", 1, func(c *Config) *int { return &c.ToolTimeoutSeconds }),
+	"tool_install_enabled":    boolSetting("TOOL_INSTALL_ENABLED", func(c *Config) *bool { return &c.ToolInstallEnabled }),
+	"exit_ip_check_url":       urlSetting("EXIT_IP_CHECK_URL", func(c *Config) *string { return &c.ExitIPCheckURL }),
+	"tor_socks_addr":          stringSetting("TOR_SOCKS_ADDR", false, func(c *Config) *string { return &c.TorSOCKSAddr }),
+	"alert_cpu_threshold":     floatSetting("ALERT_CPU_THRESHOLD", func(c *Config) *float64 { return &c.AlertCPUThreshold }),
+	"alert_memory_threshold":  floatSetting("ALERT_MEMORY_THRESHOLD", func(c *Config) *float64 { return &c.AlertMemoryThreshold }),
+	"alert_disk_threshold":    floatSetting("ALERT_DISK_THRESHOLD", func(c *Config) *float64 { return &c.AlertDiskThreshold }),
+	"alert_webhook_url":       urlSetting("ALERT_WEBHOOK_URL", func(c *Config) *string { return &c.AlertWebhookURL }),
+	"alert_slack_webhook_url": stringSetting("ALERT_SLACK_WEBHOOK_URL", true, func(c *Config) *string { return &c.AlertSlackWebhookURL }),
+	"smtp_host":               stringSetting("SMTP_HOST", false, func(c *Config) *string { return &c.SMTPHost }),
+	"smtp_port":               intSetting("SMTP_PORT", 1, func(c *Config) *int { return &c.SMTPPort }),
+	"smtp_username":           stringSetting("SMTP_USERNAME", false, func(c *Config) *string { return &c.SMTPUsername }),
+	"smtp_password":           stringSetting("SMTP_PASSWORD", true, func(c *Config) *string { return &c.SMTPPassword }),
+	"smtp_from":               stringSetting("SMTP_FROM", false, func(c *Config) *string { return &c.SMTPFrom }),
+	"smtp_tls":                choiceSetting("SMTP_TLS", []string{"starttls", "tls", "none"}, func(c *Config) *string { return &c.SMTPTLS }),
+	"digest_hour":             intSetting("DIGEST_HOUR", 0, func(c *Config) *int { return &c.DigestHour }),
+	"finding_auto_classify":   boolSetting("FINDING_AUTO_CLASSIFY", func(c *Config) *bool { return &c.FindingAutoClassify }),
+	"finding_auto_remediate":  boolSetting("FINDING_AUTO_REMEDIATE", func(c *Config) *bool { return &c.FindingAutoRemediate }),
+	"finding_llm_extraction":  boolSetting("FINDING_LLM_EXTRACTION", func(c *Config) *bool { return &c.FindingLLMExtraction }),
+	"remediation_model":       stringSetting("REMEDIATION_MODEL", false, func(c *Config) *string { return &c.RemediationModel }),
+	"brain_learning_enabled":  boolSetting("BRAIN_LEARNING_ENABLED", func(c *Config) *bool { return &c.BrainLearningEnabled }),
+	"retention_logs_days":     intSetting("RETENTION_LOGS_DAYS", 0, func(c *Config) *int { return &c.RetentionLogsDays }),
+	"retention_findings_days": intSetting("RETENTION_FINDINGS_DAYS", 0, func(c *Config) *int { return &c.RetentionFindingsDays }),
+	"retention_sessions_days": intSetting("RETENTION_SESSIONS_DAYS", 0, func(c *Config) *int { return &c.RetentionSessionsDays }),
+	"retention_messages_days": intSetting("RETENTION_MESSAGES_DAYS", 0, func(c *Config) *int { return &c.RetentionMessagesDays }),
+	"retention_max_disk_mb":   intSetting("RETENTION_MAX_DISK_MB", 0, func(c *Config) *int { return &c.RetentionMaxDiskMB }),
+}
+
+var (
+	// envConfig is the configuration loaded from the environment, before any
+	// runtime overrides.
+	envConfig  *Config
+	overrides  = make(map[string]string)
+	settingsMu sync.Mutex
+)
+
+// IsSetting reports whether key names a runtime setting.
+func IsSetting(key string) bool {
+	_, ok := settings[key]
+	return ok
+}
+
+// ApplyOverrides validates the changes, merges them over the environment
+// defaults and swaps in the resulting configuration. A nil value removes the
+// override so the setting falls back to its environment value. It returns
+// the previous and new configuration.
+func ApplyOverrides(changes map[string]*string) (*Config, *Config, error) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	merged := make(map[string]string, len(overrides)+len(changes))
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	for key, value := range changes {
+		if !IsSetting(key) {
+			return nil, nil, fmt.Errorf("unknown setting %q", key)
+		}
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = strings.TrimSpace(*value)
+		}
+	}
+
+	if envConfig == nil {
+		envConfig = AppConfig
+	}
+	next := *envConfig
+	for key, value := range merged {
+		if err := settings[key].set(&next, value); err != nil {
+			return nil, nil, fmt.Errorf("%s %v", key, err)
+		}
+	}
+
+	previous := AppConfig
+	overrides = merged
+	AppConfig = &next
+	return previous, &next, nil
+}
+
+// Overrides returns a copy of the active runtime overrides.
+func Overrides() map[string]string {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	copied := make(map[string]string, len(overrides))
+	for key, value := range overrides {
+		copied[key] = value
+	}
+	return copied
+}
+
+// SettingValues lists every runtime setting with its effective value and
+// where it came from, with secrets redacted.
+func SettingValues() []SettingValue {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	values := make([]SettingValue, 0, len(settings))
+	for key, s := range settings {
+		value := s.get(AppConfig)
+		source := "default"
+		if _, ok := overrides[key]; ok {
+			source = "override"
+		} else if getEnv(s.env, "") != "" {
+			source = "env"
+		}
+		if s.secret {
+			value = Redact(value)
+		}
+		values = append(values, SettingValue{Key: key, Env: s.env, Value: value, Secret: s.secret, Source: source})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+	return values
+}
+
+// Redact hides all but the last four characters of a secret.
+func Redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "********"
+	}
+	return "********" + secret[len(secret)-4:]
+}
@@ -0,0 +1,362 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+
+	"github.com/google/uuid"
+)
+
+// Providers are the services credentials can be stored for: LLM providers,
+// the issue trackers findings are pushed to and the OSINT services hosts are
+// looked up in. A censys key is its API ID and secret joined by a colon.
+var Providers = []string{"openrouter", "anthropic", "openai", "jira", "github", "shodan", "censys"}
+
+var ErrNoMasterKey = errors.New("credentials store is disabled: CREDENTIALS_MASTER_KEY is not set")
+
+// Credential is a named provider API key. The key itself is write-only: it is
+// kept encrypted and only a hint of its last characters is ever returned.
+type Credential struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Provider  string    `json:"provider"`
+	IsDefault bool      `json:"is_default"`
+	Hint      string    `json:"hint"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ciphertext string
+}
+
+type Store struct {
+	credentials map[string]*Credential
+	sealer      *Sealer
+	mu          sync.RWMutex
+}
+
+var Default = &Store{
+	credentials: make(map[string]*Credential),
+}
+
+// SetMasterKey derives the AES-256-GCM key used to encrypt stored values.
+func (s *Store) SetMasterKey(masterKey string) error {
+	sealer, err := NewSealer(masterKey)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sealer = sealer
+	return nil
+}
+
+func (s *Store) Enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sealer != nil
+}
+
+// encrypt must be called with s.mu held.
+func (s *Store) encrypt(plaintext string) (string, error) {
+	return s.sealer.Seal(plaintext)
+}
+
+// decrypt must be called with s.mu held.
+func (s *Store) decrypt(ciphertext string) (string, error) {
+	return s.sealer.Open(ciphertext)
+}
+
+func hint(value string) string {
+	if len(value) <= 8 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
+
+// ValidateProvider rejects providers credentials cannot be stored for.
+func ValidateProvider(provider string) error {
+	for _, known := range Providers {
+		if provider == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown provider %q, expected one of %s", provider, strings.Join(Providers, ", "))
+}
+
+// Create encrypts and stores a new key. The first key stored for a provider
+// becomes its default.
+func (s *Store) Create(name, provider, value string, isDefault bool) (*Credential, error) {
+	name = strings.TrimSpace(name)
+	value = strings.TrimSpace(value)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if value == "" {
+		return nil, fmt.Errorf("value is required")
+	}
+	if err := ValidateProvider(provider); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	for _, other := range s.credentials {
+		if other.Provider == provider && strings.EqualFold(other.Name, name) {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("credential %q already exists for %s", name, provider)
+		}
+	}
+	ciphertext, err := s.encrypt(value)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	now := time.Now()
+	credential := &Credential{
+		ID:         uuid.New().String(),
+		Name:       name,
+		Provider:   provider,
+		Hint:       hint(value),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ciphertext: ciphertext,
+	}
+	s.credentials[credential.ID] = credential
+	changed := []*Credential{credential}
+	if isDefault || s.defaultFor(provider) == nil {
+		changed = append(changed, s.makeDefault(credential)...)
+	}
+	s.mu.Unlock()
+
+	for _, c := range changed {
+		s.persist(c)
+	}
+	return credential, nil
+}
+
+// Get returns a copy of the credential without its value.
+func (s *Store) Get(id string) *Credential {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if credential, ok := s.credentials[id]; ok {
+		copied := *credential
+		copied.ciphertext = ""
+		return &copied
+	}
+	return nil
+}
+
+// GetAll lists credentials, optionally for one provider, sorted by provider
+// and name.
+func (s *Store) GetAll(provider string) []*Credential {
+	s.mu.RLock()
+	all := make([]*Credential, 0, len(s.credentials))
+	for _, credential := range s.credentials {
+		if provider != "" && credential.Provider != provider {
+			continue
+		}
+		copied := *credential
+		copied.ciphertext = ""
+		all = append(all, &copied)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Provider != all[j].Provider {
+			return all[i].Provider < all[j].Provider
+		}
+		return strings.ToLower(all[i].Name) < strings.ToLower(all[j].Name)
+	})
+	return all
+}
+
+// Update renames a credential, replaces its value when value is non-nil and
+// optionally makes it its provider's default.
+func (s *Store) Update(id string, name *string, value *string, makeDefault bool) (*Credential, error) {
+	s.mu.Lock()
+	credential, ok := s.credentials[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, nil
+	}
+
+	if name != nil {
+		trimmed := strings.TrimSpace(*name)
+		if trimmed == "" {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("name is required")
+		}
+		for otherID, other := range s.credentials {
+			if otherID != id && other.Provider == credential.Provider && strings.EqualFold(other.Name, trimmed) {
+				s.mu.Unlock()
+				return nil, fmt.Errorf("credential %q already exists for %s", trimmed, credential.Provider)
+			}
+		}
+		credential.Name = trimmed
+	}
+	if value != nil {
+		trimmed := strings.TrimSpace(*value)
+		if trimmed == "" {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("value is required")
+		}
+		ciphertext, err := s.encrypt(trimmed)
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		credential.ciphertext = ciphertext
+		credential.Hint = hint(trimmed)
+	}
+	credential.UpdatedAt = time.Now()
+
+	changed := []*Credential{credential}
+	if makeDefault {
+		changed = append(changed, s.makeDefault(credential)...)
+	}
+	s.mu.Unlock()
+
+	for _, c := range changed {
+		s.persist(c)
+	}
+	return s.Get(id), nil
+}
+
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	credential, exists := s.credentials[id]
+	delete(s.credentials, id)
+	var promoted []*Credential
+	if exists && credential.IsDefault {
+		for _, other := range s.credentials {
+			if other.Provider == credential.Provider {
+				promoted = s.makeDefault(other)
+				promoted = append(promoted, other)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		database.DeleteCredential(id)
+	}
+	for _, c := range promoted {
+		s.persist(c)
+	}
+	return exists
+}
+
+// defaultFor must be called with s.mu held.
+func (s *Store) defaultFor(provider string) *Credential {
+	for _, credential := range s.credentials {
+		if credential.Provider == provider && credential.IsDefault {
+			return credential
+		}
+	}
+	return nil
+}
+
+// makeDefault must be called with s.mu held. It returns the credentials whose
+// default flag was cleared.
+func (s *Store) makeDefault(credential *Credential) []*Credential {
+	var cleared []*Credential
+	for _, other := range s.credentials {
+		if other != credential && other.Provider == credential.Provider && other.IsDefault {
+			other.IsDefault = false
+			cleared = append(cleared, other)
+		}
+	}
+	credential.IsDefault = true
+	return cleared
+}
+
+// Resolve returns the API key to use for provider: the credential with the
+// given ID when it belongs to the provider, otherwise the provider's default.
+// It returns an empty string when no stored key applies, in which case the
+// caller falls back to the environment.
+func (s *Store) Resolve(provider, credentialID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.sealer == nil {
+		return ""
+	}
+
+	credential := s.credentials[credentialID]
+	if credential == nil || credential.Provider != provider {
+		credential = s.defaultFor(provider)
+	}
+	if credential == nil {
+		return ""
+	}
+
+	value, err := s.decrypt(credential.ciphertext)
+	if err != nil {
+		log.Printf("Credentials: %s: %v", credential.ID, err)
+		return ""
+	}
+	return value
+}
+
+func (s *Store) persist(credential *Credential) {
+	if database.DB == nil {
+		return
+	}
+
+	s.mu.RLock()
+	record := database.CredentialRecord{
+		ID:         credential.ID,
+		Name:       credential.Name,
+		Provider:   credential.Provider,
+		IsDefault:  credential.IsDefault,
+		Hint:       credential.Hint,
+		Ciphertext: credential.ciphertext,
+		CreatedAt:  credential.CreatedAt,
+		UpdatedAt:  credential.UpdatedAt,
+	}
+	s.mu.RUnlock()
+
+	if err := database.SaveCredential(record); err != nil {
+		log.Printf("Credentials: failed to persist credential %s: %v", credential.ID, err)
+	}
+}
+
+// Load restores credentials from the database. Values stay encrypted until
+// they are resolved for a request.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllCredentials()
+	if err != nil {
+		log.Printf("Credentials: failed to load credentials: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		s.credentials[record.ID] = &Credential{
+			ID:         record.ID,
+			Name:       record.Name,
+			Provider:   record.Provider,
+			IsDefault:  record.IsDefault,
+			Hint:       record.Hint,
+			CreatedAt:  record.CreatedAt,
+			UpdatedAt:  record.UpdatedAt,
+			ciphertext: record.Ciphertext,
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Sealer encrypts values with AES-256-GCM under a key derived from a master
+// passphrase. Any passphrase is accepted; it is stretched to 32 bytes with
+// SHA-256.
+type Sealer struct {
+	aead           cipher.AEAD
+	fingerprintKey []byte
+}
+
+// NewSealer returns a sealer for masterKey, or nil when it is empty.
+func NewSealer(masterKey string) (*Sealer, error) {
+	if masterKey == "" {
+		return nil, nil
+	}
+	key := sha256.Sum256([]byte(masterKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	fingerprintKey := sha256.Sum256([]byte("fingerprint:" + masterKey))
+	return &Sealer{aead: aead, fingerprintKey: fingerprintKey[:]}, nil
+}
+
+func (s *Sealer) Seal(plaintext string) (string, error) {
+	sealed, err := s.SealBytes([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *Sealer) Open(ciphertext string) (string, error) {
+	if s == nil {
+		return "", ErrNoMasterKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := s.OpenBytes(sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt credential: wrong master key?")
+	}
+	return string(plaintext), nil
+}
+
+// SealBytes encrypts plaintext, prefixing the result with its nonce.
+func (s *Sealer) SealBytes(plaintext []byte) ([]byte, error) {
+	if s == nil {
+		return nil, ErrNoMasterKey
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// OpenBytes decrypts what SealBytes produced.
+func (s *Sealer) OpenBytes(sealed []byte) ([]byte, error) {
+	if s == nil {
+		return nil, ErrNoMasterKey
+	}
+	size := s.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return s.aead.Open(nil, sealed[:size], sealed[size:], nil)
+}
+
+// Fingerprint is a keyed hash of value, to recognise a value already stored
+// without keeping it in clear.
+func (s *Sealer) Fingerprint(value string) string {
+	if s == nil {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, s.fingerprintKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,462 @@
+// Package cve looks CVEs up in the NVD and OSV databases and in CISA's
+// catalog of known exploited vulnerabilities (KEV), merging what they say
+// into one record: the CVSS score, description, affected products and
+// versions, and whether the CVE is exploited in the wild. Records are cached
+// on disk. A local mirror of the feeds can stand in for the services, and in
+// offline mode it and the cache are all that is read.
+package cve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/cvss"
+)
+
+// Sources a record's data can come from.
+const (
+	NVD = "nvd"
+	OSV = "osv"
+	KEV = "kev"
+)
+
+const (
+	// maxAffected and maxReferences bound what a record keeps of the long
+	// lists some CVEs have.
+	maxAffected   = 50
+	maxReferences = 20
+	// maxResponseBytes bounds a response read from a service.
+	maxResponseBytes = 8 << 20
+	// notFoundTTL is how long an unknown CVE is remembered as such.
+	notFoundTTL = time.Hour
+)
+
+var (
+	ErrInvalidID = errors.New("not a CVE ID")
+	ErrNotFound  = errors.New("no source knows this CVE")
+	// ErrOffline is returned by lookups that would need a service while
+	// the client is offline.
+	ErrOffline = errors.New("the CVE sources are offline")
+)
+
+var idPattern = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,7}\b`)
+
+// Affected is a product a CVE applies to and the versions of it that are
+// vulnerable, as ranges such as ">= 2.0, < 2.15.0" or single versions, with
+// those that fixed it when known. Product is "vendor:product" from NVD or
+// "ecosystem/name" from OSV.
+type Affected struct {
+	Product  string   `json:"product"`
+	Versions []string `json:"versions,omitempty"`
+	Fixed    []string `json:"fixed,omitempty"`
+	Source   string   `json:"source"`
+}
+
+// Exploited is a CVE's entry in the KEV catalog.
+type Exploited struct {
+	Name            string `json:"name,omitempty"`
+	VendorProject   string `json:"vendor_project,omitempty"`
+	Product         string `json:"product,omitempty"`
+	DateAdded       string `json:"date_added"`
+	DueDate         string `json:"due_date,omitempty"`
+	RequiredAction  string `json:"required_action,omitempty"`
+	KnownRansomware bool   `json:"known_ransomware"`
+}
+
+// Record is what the sources know about a CVE. The CVSS vector is a v3 one;
+// Severity follows from the score. Cached is set when it was served from the
+// cache, fetched at FetchedAt.
+type Record struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description,omitempty"`
+	CVSSVector  string     `json:"cvss_vector,omitempty"`
+	CVSSScore   *float64   `json:"cvss_score,omitempty"`
+	Severity    string     `json:"severity,omitempty"`
+	CWEs        []string   `json:"cwes,omitempty"`
+	Affected    []Affected `json:"affected,omitempty"`
+	References  []string   `json:"references,omitempty"`
+	Published   *time.Time `json:"published,omitempty"`
+	Exploited   *Exploited `json:"known_exploited,omitempty"`
+	Sources     []string   `json:"sources"`
+	FetchedAt   time.Time  `json:"fetched_at"`
+	Cached      bool       `json:"cached"`
+}
+
+// Config holds the services' endpoints, the NVD API key that raises its rate
+// limit, where records are cached and for how long, and the mirror directory.
+// The mirror holds nvd/<ID>.json (NVD API responses), osv/<ID>.json (OSV
+// records) and known_exploited_vulnerabilities.json (the KEV catalog).
+type Config struct {
+	NVDURL    string
+	NVDKey    string
+	OSVURL    string
+	KEVURL    string
+	CacheDir  string
+	CacheTTL  time.Duration
+	MirrorDir string
+	Offline   bool
+}
+
+// Status describes how the client looks CVEs up.
+type Status struct {
+	Offline      bool       `json:"offline"`
+	MirrorDir    string     `json:"mirror_dir,omitempty"`
+	NVDKey       bool       `json:"nvd_api_key"`
+	CacheTTL     string     `json:"cache_ttl"`
+	Cached       int        `json:"cached"`
+	KEVEntries   int        `json:"kev_entries"`
+	KEVUpdatedAt *time.Time `json:"kev_updated_at,omitempty"`
+	KEVError     string     `json:"kev_error,omitempty"`
+}
+
+type Client struct {
+	cfg    Config
+	http   *http.Client
+	nvd    *nvdSource
+	osv    *osvSource
+	kev    *kevCatalog
+	cache  map[string]*Record
+	misses map[string]time.Time
+	mu     sync.RWMutex
+}
+
+var Default = &Client{http: &http.Client{Timeout: 30 * time.Second}}
+
+// Configure sets the client's endpoints and directories and loads the
+// records cached on disk.
+func (c *Client) Configure(cfg Config) {
+	if cfg.NVDURL == "" {
+		cfg.NVDURL = defaultNVDURL
+	}
+	if cfg.OSVURL == "" {
+		cfg.OSVURL = defaultOSVURL
+	}
+	if cfg.KEVURL == "" {
+		cfg.KEVURL = defaultKEVURL
+	}
+
+	c.mu.Lock()
+	c.cfg = cfg
+	c.nvd = newNVDSource(strings.TrimRight(cfg.NVDURL, "/"), cfg.NVDKey)
+	c.osv = &osvSource{baseURL: strings.TrimRight(cfg.OSVURL, "/")}
+	c.kev = &kevCatalog{url: cfg.KEVURL}
+	if cfg.MirrorDir != "" {
+		c.kev.mirrorPath = filepath.Join(cfg.MirrorDir, kevFile)
+	}
+	if cfg.CacheDir != "" {
+		c.kev.cachePath = filepath.Join(cfg.CacheDir, kevFile)
+	}
+	c.cache = make(map[string]*Record)
+	c.misses = make(map[string]time.Time)
+	c.mu.Unlock()
+
+	if cfg.CacheDir != "" {
+		os.MkdirAll(filepath.Join(cfg.CacheDir, "records"), 0755)
+		c.loadCache()
+	}
+	c.kev.load()
+}
+
+// Normalize returns the canonical form of a CVE ID, upper case.
+func Normalize(id string) (string, error) {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	if match := idPattern.FindString(id); match == "" || match != id {
+		return "", fmt.Errorf("%w: %q", ErrInvalidID, id)
+	}
+	return id, nil
+}
+
+// Extract returns the CVE IDs text mentions, in the order they first appear.
+func Extract(text string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, match := range idPattern.FindAllString(text, -1) {
+		id := strings.ToUpper(match)
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Status reports the client's configuration and what it has cached.
+func (c *Client) Status() Status {
+	c.mu.RLock()
+	status := Status{
+		Offline:   c.cfg.Offline,
+		MirrorDir: c.cfg.MirrorDir,
+		NVDKey:    c.cfg.NVDKey != "",
+		CacheTTL:  c.cfg.CacheTTL.String(),
+		Cached:    len(c.cache),
+	}
+	kev := c.kev
+	c.mu.RUnlock()
+	if kev != nil {
+		status.KEVEntries, status.KEVUpdatedAt, status.KEVError = kev.status()
+	}
+	return status
+}
+
+// Lookup returns what the sources know about a CVE: from the cache while it
+// is fresh unless refresh is set, otherwise from the mirror and, online, NVD
+// and OSV, asked side by side. When the services fail, a stale cached record
+// is better than none. The KEV status is always the catalog's current one.
+func (c *Client) Lookup(ctx context.Context, id string, refresh bool) (*Record, error) {
+	id, err := Normalize(id)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	cfg, nvd, osv := c.cfg, c.nvd, c.osv
+	cached := c.cache[id]
+	missedAt, missed := c.misses[id]
+	c.mu.RUnlock()
+	if nvd == nil {
+		return nil, fmt.Errorf("the CVE client is not configured")
+	}
+
+	if cached != nil && !refresh && (cfg.Offline || cfg.CacheTTL <= 0 || time.Since(cached.FetchedAt) < cfg.CacheTTL) {
+		return c.withKEV(ctx, cached, true), nil
+	}
+	if missed && !refresh && time.Since(missedAt) < notFoundTTL {
+		return nil, ErrNotFound
+	}
+
+	var nvdData *nvdCVE
+	var osvData *osvVuln
+	var nvdErr, osvErr error
+	if cfg.MirrorDir != "" {
+		nvdData, nvdErr = nvd.fromMirror(cfg.MirrorDir, id)
+		osvData, osvErr = osv.fromMirror(cfg.MirrorDir, id)
+	} else {
+		nvdErr, osvErr = ErrNotFound, ErrNotFound
+	}
+	if !cfg.Offline {
+		var wg sync.WaitGroup
+		if nvdData == nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				nvdData, nvdErr = nvd.fetch(ctx, c, id)
+			}()
+		}
+		if osvData == nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				osvData, osvErr = osv.fetch(ctx, c, id)
+			}()
+		}
+		wg.Wait()
+	}
+
+	if nvdData == nil && osvData == nil {
+		failed := nvdErr
+		if failed == nil || errors.Is(failed, ErrNotFound) {
+			failed = osvErr
+		}
+		switch {
+		case cached != nil:
+			return c.withKEV(ctx, cached, true), nil
+		case failed == nil || errors.Is(failed, ErrNotFound):
+			if cfg.Offline {
+				return nil, fmt.Errorf("%w: %s is neither cached nor mirrored", ErrOffline, id)
+			}
+			c.mu.Lock()
+			c.misses[id] = time.Now()
+			c.mu.Unlock()
+			return nil, ErrNotFound
+		}
+		return nil, failed
+	}
+
+	record := &Record{ID: id, FetchedAt: time.Now().UTC()}
+	if nvdData != nil {
+		nvdData.apply(record)
+	}
+	if osvData != nil {
+		osvData.apply(record)
+	}
+	finish(record)
+	c.store(record)
+	return c.withKEV(ctx, record, false), nil
+}
+
+// withKEV returns a copy of a record with its current KEV status.
+func (c *Client) withKEV(ctx context.Context, record *Record, cached bool) *Record {
+	result := *record
+	result.Cached = cached
+	result.Exploited = nil
+	result.Sources = append([]string(nil), record.Sources...)
+	c.mu.RLock()
+	kev, offline := c.kev, c.cfg.Offline
+	c.mu.RUnlock()
+	if !offline {
+		kev.refreshIfStale(ctx, c.http)
+	}
+	if entry := kev.get(result.ID); entry != nil {
+		result.Exploited = entry
+		result.Sources = append(result.Sources, KEV)
+	}
+	return &result
+}
+
+// SyncKEV downloads the KEV catalog again, or offline reads it again from
+// the mirror, and returns how many CVEs it lists.
+func (c *Client) SyncKEV(ctx context.Context) (int, error) {
+	c.mu.RLock()
+	kev, offline := c.kev, c.cfg.Offline
+	c.mu.RUnlock()
+	if kev == nil {
+		return 0, fmt.Errorf("the CVE client is not configured")
+	}
+	if offline {
+		if err := kev.load(); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrOffline, err)
+		}
+		entries, _, _ := kev.status()
+		return entries, nil
+	}
+	return kev.refresh(ctx, c.http)
+}
+
+// finish derives a record's severity from its vector or score and sorts and
+// bounds its lists.
+func finish(record *Record) {
+	if record.CVSSVector != "" {
+		if score, severity, err := cvss.Score(record.CVSSVector); err == nil {
+			record.CVSSScore, record.Severity = &score, severity
+		} else {
+			record.CVSSVector = ""
+		}
+	}
+	if record.CVSSScore != nil && record.Severity == "" {
+		record.Severity = cvss.Severity(*record.CVSSScore)
+	}
+	record.CWEs = unique(record.CWEs)
+	sort.Strings(record.CWEs)
+	record.References = unique(record.References)
+	if len(record.References) > maxReferences {
+		record.References = record.References[:maxReferences]
+	}
+	record.Affected = mergeAffected(record.Affected)
+	if len(record.Affected) > maxAffected {
+		record.Affected = record.Affected[:maxAffected]
+	}
+	record.Sources = unique(record.Sources)
+}
+
+// mergeAffected joins the entries a source gives for the same product, as
+// NVD does for each range of versions.
+func mergeAffected(entries []Affected) []Affected {
+	var merged []Affected
+	index := make(map[string]int)
+	for _, entry := range entries {
+		key := entry.Source + "|" + entry.Product
+		i, seen := index[key]
+		if !seen {
+			index[key] = len(merged)
+			merged = append(merged, entry)
+			continue
+		}
+		merged[i].Versions = unique(append(merged[i].Versions, entry.Versions...))
+		merged[i].Fixed = unique(append(merged[i].Fixed, entry.Fixed...))
+	}
+	return merged
+}
+
+func (c *Client) store(record *Record) {
+	c.mu.Lock()
+	c.cache[record.ID] = record
+	delete(c.misses, record.ID)
+	dir := c.cfg.CacheDir
+	c.mu.Unlock()
+	if dir == "" {
+		return
+	}
+	data, _ := json.MarshalIndent(record, "", "  ")
+	os.WriteFile(filepath.Join(dir, "records", record.ID+".json"), data, 0644)
+}
+
+func (c *Client) loadCache() {
+	files, _ := filepath.Glob(filepath.Join(c.cfg.CacheDir, "records", "CVE-*.json"))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var record Record
+		if json.Unmarshal(data, &record) == nil && record.ID != "" {
+			record.Cached = false
+			c.cache[record.ID] = &record
+		}
+	}
+}
+
+// get makes a GET request and returns its body. A 404 is ErrNotFound.
+func (c *Client) get(ctx context.Context, url string, header http.Header) (data []byte, status int, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("reading response: %v", err)
+	}
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return data, resp.StatusCode, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, resp.StatusCode, ErrNotFound
+	}
+	if len(data) > 300 {
+		data = data[:300]
+	}
+	return nil, resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+}
+
+// readMirror reads a record of a source from the mirror.
+func readMirror(dir, source, id string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, source, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func unique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var result []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}
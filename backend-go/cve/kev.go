@@ -0,0 +1,192 @@
+package cve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultKEVURL = "https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json"
+
+const (
+	kevFile = "known_exploited_vulnerabilities.json"
+	// kevMaxAge is how old the catalog may get before it is downloaded
+	// again; CISA adds to it a few times a week.
+	kevMaxAge = 24 * time.Hour
+	// kevRetryDelay spaces the attempts to download it after a failure.
+	kevRetryDelay = time.Hour
+	// maxKEVBytes bounds the catalog, about 1 MB today.
+	maxKEVBytes = 32 << 20
+)
+
+// kevCatalog is CISA's catalog of known exploited vulnerabilities, read from
+// the mirror or the cache and downloaded again once a day.
+type kevCatalog struct {
+	url        string
+	mirrorPath string
+	cachePath  string
+
+	mu        sync.RWMutex
+	entries   map[string]*Exploited
+	updatedAt time.Time
+	tried     time.Time
+	err       string
+
+	// refreshing lets one download run at a time.
+	refreshing sync.Mutex
+}
+
+type kevDocument struct {
+	Vulnerabilities []struct {
+		CVEID             string `json:"cveID"`
+		VendorProject     string `json:"vendorProject"`
+		Product           string `json:"product"`
+		VulnerabilityName string `json:"vulnerabilityName"`
+		DateAdded         string `json:"dateAdded"`
+		RequiredAction    string `json:"requiredAction"`
+		DueDate           string `json:"dueDate"`
+		Ransomware        string `json:"knownRansomwareCampaignUse"`
+	} `json:"vulnerabilities"`
+}
+
+func parseKEV(data []byte) (map[string]*Exploited, error) {
+	var document kevDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid KEV catalog: %v", err)
+	}
+	if len(document.Vulnerabilities) == 0 {
+		return nil, fmt.Errorf("invalid KEV catalog: it lists no vulnerabilities")
+	}
+	entries := make(map[string]*Exploited, len(document.Vulnerabilities))
+	for _, v := range document.Vulnerabilities {
+		entries[strings.ToUpper(v.CVEID)] = &Exploited{
+			Name:            v.VulnerabilityName,
+			VendorProject:   v.VendorProject,
+			Product:         v.Product,
+			DateAdded:       v.DateAdded,
+			DueDate:         v.DueDate,
+			RequiredAction:  v.RequiredAction,
+			KnownRansomware: strings.EqualFold(v.Ransomware, "Known"),
+		}
+	}
+	return entries, nil
+}
+
+// load reads the catalog from the mirror, or else from the cache. The
+// catalog is as old as its file.
+func (k *kevCatalog) load() error {
+	err := fmt.Errorf("no KEV catalog is mirrored or cached")
+	for _, path := range []string{k.mirrorPath, k.cachePath} {
+		if path == "" {
+			continue
+		}
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			continue
+		}
+		entries, parseErr := parseKEV(data)
+		if parseErr != nil {
+			err = fmt.Errorf("%s: %v", path, parseErr)
+			continue
+		}
+		updatedAt := time.Now()
+		if info, statErr := os.Stat(path); statErr == nil {
+			updatedAt = info.ModTime()
+		}
+		k.mu.Lock()
+		k.entries, k.updatedAt, k.err = entries, updatedAt, ""
+		k.mu.Unlock()
+		return nil
+	}
+	k.mu.Lock()
+	k.err = err.Error()
+	k.mu.Unlock()
+	return err
+}
+
+// refreshIfStale downloads the catalog when it is older than a day, unless
+// the last attempt failed within the hour.
+func (k *kevCatalog) refreshIfStale(ctx context.Context, client *http.Client) {
+	k.mu.RLock()
+	stale := time.Since(k.updatedAt) > kevMaxAge && time.Since(k.tried) > kevRetryDelay
+	k.mu.RUnlock()
+	if stale {
+		k.refresh(ctx, client)
+	}
+}
+
+// refresh downloads the catalog and caches it.
+func (k *kevCatalog) refresh(ctx context.Context, client *http.Client) (int, error) {
+	k.refreshing.Lock()
+	defer k.refreshing.Unlock()
+
+	k.mu.Lock()
+	k.tried = time.Now()
+	k.mu.Unlock()
+
+	entries, data, err := k.download(ctx, client)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err != nil {
+		k.err = err.Error()
+		return len(k.entries), err
+	}
+	k.entries, k.updatedAt, k.err = entries, time.Now(), ""
+	if k.cachePath != "" {
+		os.MkdirAll(filepath.Dir(k.cachePath), 0755)
+		os.WriteFile(k.cachePath, data, 0644)
+	}
+	return len(entries), nil
+}
+
+func (k *kevCatalog) download(ctx context.Context, client *http.Client) (map[string]*Exploited, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", k.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("downloading the KEV catalog: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("downloading the KEV catalog: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKEVBytes))
+	if err != nil {
+		return nil, nil, fmt.Errorf("downloading the KEV catalog: %v", err)
+	}
+	entries, err := parseKEV(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, data, nil
+}
+
+// get returns a CVE's entry in the catalog, or nil.
+func (k *kevCatalog) get(id string) *Exploited {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if entry := k.entries[id]; entry != nil {
+		copied := *entry
+		return &copied
+	}
+	return nil
+}
+
+func (k *kevCatalog) status() (entries int, updatedAt *time.Time, err string) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if !k.updatedAt.IsZero() {
+		at := k.updatedAt.UTC()
+		updatedAt = &at
+	}
+	return len(k.entries), updatedAt, k.err
+}
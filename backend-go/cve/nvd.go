@@ -0,0 +1,268 @@
+package cve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultNVDURL = "https://services.nvd.nist.gov/rest/json/cves/2.0"
+
+const (
+	// NVD allows 5 requests in 30 seconds without an API key and 50 with
+	// one; requests are spaced to stay under that.
+	nvdInterval       = 6 * time.Second
+	nvdKeyInterval    = 600 * time.Millisecond
+	nvdMaxAttempts    = 3
+	nvdTimeLayout     = "2006-01-02T15:04:05.000"
+	nvdPrimaryMetrics = "Primary"
+)
+
+// nvdSource calls the NVD CVE API 2.0, one request at a time at its rate.
+type nvdSource struct {
+	baseURL  string
+	key      string
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newNVDSource(baseURL, key string) *nvdSource {
+	interval := nvdInterval
+	if key != "" {
+		interval = nvdKeyInterval
+	}
+	return &nvdSource{baseURL: baseURL, key: key, interval: interval}
+}
+
+type nvdResponse struct {
+	Vulnerabilities []struct {
+		CVE nvdCVE `json:"cve"`
+	} `json:"vulnerabilities"`
+}
+
+type nvdCVE struct {
+	ID           string `json:"id"`
+	Published    string `json:"published"`
+	Descriptions []struct {
+		Lang  string `json:"lang"`
+		Value string `json:"value"`
+	} `json:"descriptions"`
+	Metrics struct {
+		V31 []nvdMetric `json:"cvssMetricV31"`
+		V30 []nvdMetric `json:"cvssMetricV30"`
+		V2  []nvdMetric `json:"cvssMetricV2"`
+	} `json:"metrics"`
+	Weaknesses []struct {
+		Description []struct {
+			Value string `json:"value"`
+		} `json:"description"`
+	} `json:"weaknesses"`
+	Configurations []struct {
+		Nodes []struct {
+			CPEMatch []nvdCPEMatch `json:"cpeMatch"`
+		} `json:"nodes"`
+	} `json:"configurations"`
+	References []struct {
+		URL string `json:"url"`
+	} `json:"references"`
+}
+
+type nvdMetric struct {
+	Type     string `json:"type"`
+	CVSSData struct {
+		VectorString string  `json:"vectorString"`
+		BaseScore    float64 `json:"baseScore"`
+	} `json:"cvssData"`
+}
+
+type nvdCPEMatch struct {
+	Vulnerable            bool   `json:"vulnerable"`
+	Criteria              string `json:"criteria"`
+	VersionStartIncluding string `json:"versionStartIncluding"`
+	VersionStartExcluding string `json:"versionStartExcluding"`
+	VersionEndIncluding   string `json:"versionEndIncluding"`
+	VersionEndExcluding   string `json:"versionEndExcluding"`
+}
+
+// wait blocks until the next request may be sent.
+func (s *nvdSource) wait(ctx context.Context) error {
+	s.mu.Lock()
+	now := time.Now()
+	at := s.next
+	if at.Before(now) {
+		at = now
+	}
+	s.next = at.Add(s.interval)
+	s.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetch asks NVD about a CVE. NVD answers 403 as well as 429 and 503 when a
+// client goes over its rate; those are retried after the next free slot.
+func (s *nvdSource) fetch(ctx context.Context, c *Client, id string) (*nvdCVE, error) {
+	header := http.Header{}
+	if s.key != "" {
+		header.Set("apiKey", s.key)
+	}
+	for attempt := 1; ; attempt++ {
+		if err := s.wait(ctx); err != nil {
+			return nil, fmt.Errorf("nvd: %v", err)
+		}
+		data, status, err := c.get(ctx, s.baseURL+"?cveId="+url.QueryEscape(id), header)
+		if errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		if err != nil {
+			throttled := status == http.StatusForbidden || status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+			if throttled && attempt < nvdMaxAttempts {
+				continue
+			}
+			return nil, fmt.Errorf("nvd: %v", err)
+		}
+		return parseNVD(data, id)
+	}
+}
+
+// fromMirror reads a CVE from the mirror's nvd directory, which holds API
+// responses or the CVE objects they contain.
+func (s *nvdSource) fromMirror(dir, id string) (*nvdCVE, error) {
+	data, err := readMirror(dir, NVD, id)
+	if err != nil {
+		return nil, err
+	}
+	return parseNVD(data, id)
+}
+
+func parseNVD(data []byte, id string) (*nvdCVE, error) {
+	var response nvdResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("nvd: invalid response: %v", err)
+	}
+	for _, vulnerability := range response.Vulnerabilities {
+		if strings.EqualFold(vulnerability.CVE.ID, id) {
+			found := vulnerability.CVE
+			return &found, nil
+		}
+	}
+	var single nvdCVE
+	if json.Unmarshal(data, &single) == nil && strings.EqualFold(single.ID, id) {
+		return &single, nil
+	}
+	return nil, ErrNotFound
+}
+
+// apply fills in a record from NVD, which is the reference for the
+// description and the score.
+func (n *nvdCVE) apply(record *Record) {
+	record.Sources = append(record.Sources, NVD)
+	for _, description := range n.Descriptions {
+		if description.Lang == "en" {
+			record.Description = strings.TrimSpace(description.Value)
+			break
+		}
+	}
+	if published, err := time.Parse(nvdTimeLayout, n.Published); err == nil {
+		published = published.UTC()
+		record.Published = &published
+	}
+
+	for _, metrics := range [][]nvdMetric{n.Metrics.V31, n.Metrics.V30} {
+		if metric := primaryMetric(metrics); metric != nil {
+			record.CVSSVector = metric.CVSSData.VectorString
+			score := metric.CVSSData.BaseScore
+			record.CVSSScore = &score
+			break
+		}
+	}
+	if record.CVSSScore == nil {
+		// Old CVEs were only scored with CVSS v2, whose score is kept
+		// without a vector.
+		if metric := primaryMetric(n.Metrics.V2); metric != nil {
+			score := metric.CVSSData.BaseScore
+			record.CVSSScore = &score
+		}
+	}
+
+	for _, weakness := range n.Weaknesses {
+		for _, description := range weakness.Description {
+			if strings.HasPrefix(description.Value, "CWE-") {
+				record.CWEs = append(record.CWEs, description.Value)
+			}
+		}
+	}
+
+	for _, configuration := range n.Configurations {
+		for _, node := range configuration.Nodes {
+			for _, match := range node.CPEMatch {
+				if affected, ok := match.affected(); ok {
+					record.Affected = append(record.Affected, affected)
+				}
+			}
+		}
+	}
+
+	for _, reference := range n.References {
+		record.References = append(record.References, reference.URL)
+	}
+}
+
+// primaryMetric returns NVD's own score among a CVE's metrics, or the first.
+func primaryMetric(metrics []nvdMetric) *nvdMetric {
+	for i := range metrics {
+		if metrics[i].Type == nvdPrimaryMetrics {
+			return &metrics[i]
+		}
+	}
+	if len(metrics) > 0 {
+		return &metrics[0]
+	}
+	return nil
+}
+
+// affected reads the product and versions of a vulnerable CPE match, such
+// as cpe:2.3:a:apache:log4j:*:*:*:*:*:*:*:* from 2.0.1 up to 2.3.1.
+func (m nvdCPEMatch) affected() (Affected, bool) {
+	parts := strings.Split(m.Criteria, ":")
+	if !m.Vulnerable || len(parts) < 6 {
+		return Affected{}, false
+	}
+	affected := Affected{Product: parts[3] + ":" + parts[4], Source: NVD}
+
+	var bounds []string
+	if m.VersionStartIncluding != "" {
+		bounds = append(bounds, ">= "+m.VersionStartIncluding)
+	}
+	if m.VersionStartExcluding != "" {
+		bounds = append(bounds, "> "+m.VersionStartExcluding)
+	}
+	if m.VersionEndIncluding != "" {
+		bounds = append(bounds, "<= "+m.VersionEndIncluding)
+	}
+	if m.VersionEndExcluding != "" {
+		bounds = append(bounds, "< "+m.VersionEndExcluding)
+		affected.Fixed = []string{m.VersionEndExcluding}
+	}
+	switch version := parts[5]; {
+	case len(bounds) > 0:
+		affected.Versions = []string{strings.Join(bounds, ", ")}
+	case version != "*" && version != "-":
+		affected.Versions = []string{version}
+	}
+	return affected, true
+}
@@ -0,0 +1,160 @@
+package cve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const defaultOSVURL = "https://api.osv.dev/v1"
+
+// osvSource calls the OSV API, which knows the package versions a CVE
+// affects in the ecosystems it covers.
+type osvSource struct {
+	baseURL string
+}
+
+type osvVuln struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Details  string   `json:"details"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced   string `json:"introduced"`
+				Fixed        string `json:"fixed"`
+				LastAffected string `json:"last_affected"`
+			} `json:"events"`
+		} `json:"ranges"`
+		Versions []string `json:"versions"`
+	} `json:"affected"`
+	References []struct {
+		URL string `json:"url"`
+	} `json:"references"`
+	DatabaseSpecific struct {
+		CWEIDs []string `json:"cwe_ids"`
+	} `json:"database_specific"`
+}
+
+// maxOSVVersions bounds the single versions listed for a package that has
+// no ranges.
+const maxOSVVersions = 20
+
+func (s *osvSource) fetch(ctx context.Context, c *Client, id string) (*osvVuln, error) {
+	data, _, err := c.get(ctx, s.baseURL+"/vulns/"+url.PathEscape(id), nil)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("osv: %v", err)
+	}
+	return parseOSV(data, id)
+}
+
+func (s *osvSource) fromMirror(dir, id string) (*osvVuln, error) {
+	data, err := readMirror(dir, OSV, id)
+	if err != nil {
+		return nil, err
+	}
+	return parseOSV(data, id)
+}
+
+// parseOSV reads an OSV record, which must be the CVE's or an alias of it.
+func parseOSV(data []byte, id string) (*osvVuln, error) {
+	var vuln osvVuln
+	if err := json.Unmarshal(data, &vuln); err != nil {
+		return nil, fmt.Errorf("osv: invalid response: %v", err)
+	}
+	if strings.EqualFold(vuln.ID, id) {
+		return &vuln, nil
+	}
+	for _, alias := range vuln.Aliases {
+		if strings.EqualFold(alias, id) {
+			return &vuln, nil
+		}
+	}
+	return nil, fmt.Errorf("osv: the response is not about %s", id)
+}
+
+// apply fills in what NVD left blank and adds the affected packages.
+func (v *osvVuln) apply(record *Record) {
+	record.Sources = append(record.Sources, OSV)
+	if record.Description == "" {
+		record.Description = strings.TrimSpace(v.Details)
+		if record.Description == "" {
+			record.Description = strings.TrimSpace(v.Summary)
+		}
+	}
+	if record.CVSSVector == "" {
+		for _, severity := range v.Severity {
+			if severity.Type == "CVSS_V3" {
+				record.CVSSVector = severity.Score
+				record.CVSSScore = nil
+				break
+			}
+		}
+	}
+	record.CWEs = append(record.CWEs, v.DatabaseSpecific.CWEIDs...)
+
+	for _, entry := range v.Affected {
+		if entry.Package.Name == "" {
+			continue
+		}
+		affected := Affected{Product: entry.Package.Name, Source: OSV}
+		if entry.Package.Ecosystem != "" {
+			affected.Product = entry.Package.Ecosystem + "/" + entry.Package.Name
+		}
+		for _, r := range entry.Ranges {
+			// GIT ranges are commits, not versions.
+			if r.Type == "GIT" {
+				continue
+			}
+			var bounds []string
+			for _, event := range r.Events {
+				switch {
+				case event.Introduced != "" && event.Introduced != "0":
+					bounds = append(bounds, ">= "+event.Introduced)
+				case event.Fixed != "":
+					bounds = append(bounds, "< "+event.Fixed)
+					affected.Fixed = append(affected.Fixed, event.Fixed)
+				case event.LastAffected != "":
+					bounds = append(bounds, "<= "+event.LastAffected)
+				}
+				if event.Fixed != "" || event.LastAffected != "" {
+					if len(bounds) > 0 {
+						affected.Versions = append(affected.Versions, strings.Join(bounds, ", "))
+					}
+					bounds = nil
+				}
+			}
+			if len(bounds) > 0 {
+				affected.Versions = append(affected.Versions, strings.Join(bounds, ", "))
+			}
+		}
+		if len(affected.Versions) == 0 {
+			versions := entry.Versions
+			if len(versions) > maxOSVVersions {
+				versions = versions[:maxOSVVersions]
+			}
+			affected.Versions = versions
+		}
+		record.Affected = append(record.Affected, affected)
+	}
+
+	for _, reference := range v.References {
+		record.References = append(record.References, reference.URL)
+	}
+}
@@ -0,0 +1,167 @@
+package cvss
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type Vector struct {
+	Version            string `json:"version"`
+	AttackVector       string `json:"attack_vector"`
+	AttackComplexity   string `json:"attack_complexity"`
+	PrivilegesRequired string `json:"privileges_required"`
+	UserInteraction    string `json:"user_interaction"`
+	Scope              string `json:"scope"`
+	Confidentiality    string `json:"confidentiality"`
+	Integrity          string `json:"integrity"`
+	Availability       string `json:"availability"`
+}
+
+var baseMetricValues = map[string][]string{
+	"AV": {"N", "A", "L", "P"},
+	"AC": {"L", "H"},
+	"PR": {"N", "L", "H"},
+	"UI": {"N", "R"},
+	"S":  {"U", "C"},
+	"C":  {"H", "L", "N"},
+	"I":  {"H", "L", "N"},
+	"A":  {"H", "L", "N"},
+}
+
+var metricOrder = []string{"AV", "AC", "PR", "UI", "S", "C", "I", "A"}
+
+// Parse validates a CVSS v3.0/v3.1 base vector such as
+// "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H".
+func Parse(vector string) (*Vector, error) {
+	parts := strings.Split(strings.TrimSpace(vector), "/")
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "CVSS:") {
+		return nil, fmt.Errorf("vector must start with CVSS:3.1/ or CVSS:3.0/")
+	}
+
+	version := strings.TrimPrefix(parts[0], "CVSS:")
+	if version != "3.0" && version != "3.1" {
+		return nil, fmt.Errorf("unsupported CVSS version %q", version)
+	}
+
+	metrics := make(map[string]string)
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed metric %q", part)
+		}
+		allowed, known := baseMetricValues[kv[0]]
+		if !known {
+			return nil, fmt.Errorf("unknown base metric %q", kv[0])
+		}
+		if _, dup := metrics[kv[0]]; dup {
+			return nil, fmt.Errorf("metric %s specified more than once", kv[0])
+		}
+		if !contains(allowed, kv[1]) {
+			return nil, fmt.Errorf("invalid value %q for metric %s", kv[1], kv[0])
+		}
+		metrics[kv[0]] = kv[1]
+	}
+
+	for _, metric := range metricOrder {
+		if _, ok := metrics[metric]; !ok {
+			return nil, fmt.Errorf("missing base metric %s", metric)
+		}
+	}
+
+	return &Vector{
+		Version:            version,
+		AttackVector:       metrics["AV"],
+		AttackComplexity:   metrics["AC"],
+		PrivilegesRequired: metrics["PR"],
+		UserInteraction:    metrics["UI"],
+		Scope:              metrics["S"],
+		Confidentiality:    metrics["C"],
+		Integrity:          metrics["I"],
+		Availability:       metrics["A"],
+	}, nil
+}
+
+func (v *Vector) String() string {
+	return fmt.Sprintf("CVSS:%s/AV:%s/AC:%s/PR:%s/UI:%s/S:%s/C:%s/I:%s/A:%s",
+		v.Version, v.AttackVector, v.AttackComplexity, v.PrivilegesRequired, v.UserInteraction,
+		v.Scope, v.Confidentiality, v.Integrity, v.Availability)
+}
+
+// BaseScore implements the CVSS v3.1 base score equations.
+func (v *Vector) BaseScore() float64 {
+	av := map[string]float64{"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2}[v.AttackVector]
+	ac := map[string]float64{"L": 0.77, "H": 0.44}[v.AttackComplexity]
+	ui := map[string]float64{"N": 0.85, "R": 0.62}[v.UserInteraction]
+	cia := map[string]float64{"H": 0.56, "L": 0.22, "N": 0}
+
+	scopeChanged := v.Scope == "C"
+	pr := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}[v.PrivilegesRequired]
+	if scopeChanged {
+		pr = map[string]float64{"N": 0.85, "L": 0.68, "H": 0.5}[v.PrivilegesRequired]
+	}
+
+	iss := 1 - (1-cia[v.Confidentiality])*(1-cia[v.Integrity])*(1-cia[v.Availability])
+
+	var impact float64
+	if scopeChanged {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	} else {
+		impact = 6.42 * iss
+	}
+	if impact <= 0 {
+		return 0
+	}
+
+	exploitability := 8.22 * av * ac * pr * ui
+	if scopeChanged {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10))
+	}
+	return roundUp(math.Min(impact+exploitability, 10))
+}
+
+// Severity maps a base score onto the qualitative rating scale, using "info"
+// for a zero score to match finding severities.
+func Severity(score float64) string {
+	switch {
+	case score >= 9.0:
+		return "critical"
+	case score >= 7.0:
+		return "high"
+	case score >= 4.0:
+		return "medium"
+	case score > 0:
+		return "low"
+	default:
+		return "info"
+	}
+}
+
+// Score parses vector and returns its base score and severity.
+func Score(vector string) (float64, string, error) {
+	v, err := Parse(vector)
+	if err != nil {
+		return 0, "", err
+	}
+	score := v.BaseScore()
+	return score, Severity(score), nil
+}
+
+// roundUp is the Roundup function from the CVSS v3.1 specification, which
+// avoids floating point artefacts such as 4.000000000001 rounding to 4.1.
+func roundUp(value float64) float64 {
+	intInput := int(math.Round(value * 100000))
+	if intInput%10000 == 0 {
+		return float64(intInput) / 100000
+	}
+	return (math.Floor(float64(intInput)/10000) + 1) / 10
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
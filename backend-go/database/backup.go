@@ -0,0 +1,237 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// restoreTimeout bounds a whole restore, which runs in one transaction.
+const restoreTimeout = 10 * time.Minute
+
+// Column kinds that JSON does not carry and are restored explicitly.
+const (
+	ColumnTime  = "time"
+	ColumnBytes = "bytes"
+)
+
+// Column is a dumped column. Kind is ColumnTime or ColumnBytes for values
+// read as timestamps or raw bytes (JSON columns), and empty otherwise.
+type Column struct {
+	Name string `json:"name"`
+	Kind string `json:"kind,omitempty"`
+}
+
+// TableDump holds every row of a table. Bytes are dumped as strings and
+// timestamps as RFC 3339.
+type TableDump struct {
+	Name    string          `json:"name"`
+	Columns []Column        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// Tables lists the application's tables in creation order.
+func Tables() []string {
+	return append([]string(nil), tables...)
+}
+
+// ExportTable reads every row of table.
+func ExportTable(table string) (*TableDump, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("no database configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+	defer cancel()
+
+	rows, err := dbQuery(ctx, "SELECT * FROM "+table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	dump := &TableDump{Name: table, Columns: make([]Column, len(names)), Rows: make([][]interface{}, 0)}
+	for i, name := range names {
+		dump.Columns[i].Name = name
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(names))
+		pointers := make([]interface{}, len(names))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			switch v := value.(type) {
+			case []byte:
+				dump.Columns[i].Kind = ColumnBytes
+				values[i] = string(v)
+			case time.Time:
+				dump.Columns[i].Kind = ColumnTime
+				values[i] = v.UTC().Format(time.RFC3339Nano)
+			}
+		}
+		dump.Rows = append(dump.Rows, values)
+	}
+	return dump, rows.Err()
+}
+
+// Import replaces the contents of the dumped tables in one transaction.
+// Tables and columns the schema does not have are skipped and reported.
+func Import(dumps []TableDump) (int, []string, error) {
+	if DB == nil {
+		return 0, nil, fmt.Errorf("no database configured")
+	}
+
+	byName := make(map[string]TableDump, len(dumps))
+	for _, dump := range dumps {
+		byName[dump.Name] = dump
+	}
+	known := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		known[table] = true
+	}
+	var skipped []string
+	for _, dump := range dumps {
+		if !known[dump.Name] {
+			skipped = append(skipped, "table "+dump.Name)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	for i := len(tables) - 1; i >= 0; i-- {
+		if _, ok := byName[tables[i]]; !ok {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+tables[i]); err != nil {
+			return 0, nil, fmt.Errorf("clear %s: %w", tables[i], err)
+		}
+	}
+
+	restored := 0
+	for _, table := range tables {
+		dump, ok := byName[table]
+		if !ok {
+			continue
+		}
+		existing, err := tableColumns(ctx, tx, table)
+		if err != nil {
+			return 0, nil, fmt.Errorf("read columns of %s: %w", table, err)
+		}
+
+		var columns []string
+		var indexes []int
+		for i, column := range dump.Columns {
+			if !existing[column.Name] {
+				skipped = append(skipped, "column "+table+"."+column.Name)
+				continue
+			}
+			columns = append(columns, column.Name)
+			indexes = append(indexes, i)
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		placeholders := make([]string, len(columns))
+		for i := range placeholders {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+		stmt, err := tx.PrepareContext(ctx, rebind(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))))
+		if err != nil {
+			return 0, nil, fmt.Errorf("prepare %s: %w", table, err)
+		}
+		for _, row := range dump.Rows {
+			args := make([]interface{}, len(indexes))
+			for i, index := range indexes {
+				if index >= len(row) {
+					continue
+				}
+				if args[i], err = importValue(dump.Columns[index], row[index]); err != nil {
+					stmt.Close()
+					return 0, nil, fmt.Errorf("%s.%s: %w", table, dump.Columns[index].Name, err)
+				}
+			}
+			if _, err := stmt.ExecContext(ctx, args...); err != nil {
+				stmt.Close()
+				return 0, nil, fmt.Errorf("insert into %s: %w", table, err)
+			}
+			restored++
+		}
+		stmt.Close()
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+	return restored, skipped, nil
+}
+
+// importValue converts a dumped value back to what the driver expects. JSON
+// numbers arrive as json.Number, which drivers take as a string. Bytes go
+// back to SQLite as a BLOB, which JSON columns are read from, and to
+// Postgres as text.
+func importValue(column Column, value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	switch column.Kind {
+	case ColumnTime:
+		return time.Parse(time.RFC3339Nano, s)
+	case ColumnBytes:
+		if Driver == DriverSQLite {
+			return []byte(s), nil
+		}
+	}
+	return s, nil
+}
+
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT * FROM "+table+" WHERE 1 = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		columns[name] = true
+	}
+	return columns, nil
+}
+
+// DecodeTableDump parses a dumped table, keeping numbers exact.
+func DecodeTableDump(data []byte) (*TableDump, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var dump TableDump
+	if err := decoder.Decode(&dump); err != nil {
+		return nil, err
+	}
+	return &dump, nil
+}
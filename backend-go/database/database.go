@@ -1,11 +1,13 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -28,34 +30,328 @@ type SavedConfig struct {
 	AllowedToolsOnly  bool            `json:"allowed_tools_only"`
 	StealthOptions    json.RawMessage `json:"stealth_options"`
 	Capabilities      json.RawMessage `json:"capabilities"`
+	RoE               json.RawMessage `json:"roe,omitempty"`
+	OwnerID           string          `json:"owner_id,omitempty"`
+	WorkspaceID       string          `json:"workspace_id"`
 	CreatedAt         time.Time       `json:"created_at"`
 	UpdatedAt         time.Time       `json:"updated_at"`
 }
 
-type SavedSession struct {
+type FindingRecord struct {
+	ID          string     `json:"id"`
+	SessionID   *string    `json:"session_id"`
+	AgentID     string     `json:"agent_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Severity    string     `json:"severity"`
+	Category    string     `json:"category"`
+	Target      string     `json:"target"`
+	Evidence    string     `json:"evidence"`
+	Remediation string     `json:"remediation"`
+	Status      string     `json:"status"`
+	CVSSVector  string     `json:"cvss_vector"`
+	CVSSScore   *float64   `json:"cvss_score"`
+	CWE         string     `json:"cwe_id"`
+	OWASP       string     `json:"owasp_category"`
+	Confidence  *float64   `json:"confidence"`
+	WorkspaceID string     `json:"workspace_id"`
+	Source      string     `json:"source"`
+	CreatedAt   time.Time  `json:"created_at"`
+	TriagedAt   *time.Time `json:"triaged_at,omitempty"`
+
+	Classification     json.RawMessage `json:"classification"`
+	Issues             json.RawMessage `json:"issues"`
+	Retests            json.RawMessage `json:"retests"`
+	Tags               json.RawMessage `json:"tags"`
+	Assignee           string          `json:"assignee"`
+	Suppression        string          `json:"suppression_id"`
+	RemediationDetails json.RawMessage `json:"remediation_details"`
+	CVEEnrichment      json.RawMessage `json:"cve_enrichment"`
+}
+
+type FindingQuery struct {
+	WorkspaceID string
+	Severities  []string
+	Category    string
+	Target      string
+	AgentID     string
+	Status      string
+	Search      string
+	Since       *time.Time
+	Until       *time.Time
+	SortBy      string
+	SortDesc    bool
+	Limit       int
+	Offset      int
+}
+
+// SavedQuery selects a page of saved configs or sessions. Search matches the
+// name or target; SortBy is created_at, updated_at or name.
+type SavedQuery struct {
+	WorkspaceID string
+	OwnerID     string
+	Search      string
+	Category    string
+	SortBy      string
+	SortDesc    bool
+	Limit       int
+	Offset      int
+}
+
+type ScheduleRecord struct {
 	ID        string          `json:"id"`
 	Name      string          `json:"name"`
-	Config    json.RawMessage `json:"config"`
-	Agents    json.RawMessage `json:"agents"`
-	Findings  json.RawMessage `json:"findings"`
+	ConfigID  string          `json:"config_id"`
+	CronExpr  string          `json:"cron"`
+	Timezone  string          `json:"timezone"`
+	Enabled   bool            `json:"enabled"`
+	Paused    bool            `json:"paused"`
+	NextRunAt *time.Time      `json:"next_run_at"`
+	LastRunAt *time.Time      `json:"last_run_at"`
+	Runs      json.RawMessage `json:"runs"`
 	CreatedAt time.Time       `json:"created_at"`
 	UpdatedAt time.Time       `json:"updated_at"`
 }
 
-func Init() error {
+type PromptTemplateRecord struct {
+	ID            string          `json:"id"`
+	Role          string          `json:"role"`
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	ActiveVersion int             `json:"active_version"`
+	Versions      json.RawMessage `json:"versions"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+type AgentRoleRecord struct {
+	ID               string          `json:"id"`
+	Name             string          `json:"name"`
+	Description      string          `json:"description"`
+	PromptTemplateID string          `json:"prompt_template_id"`
+	ToolCategories   json.RawMessage `json:"tool_categories"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+type ConfigPresetRecord struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Config      json.RawMessage `json:"config"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type AssetRecord struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Name      string          `json:"name"`
+	Data      json.RawMessage `json:"data"`
+	FirstSeen time.Time       `json:"first_seen"`
+	LastSeen  time.Time       `json:"last_seen"`
+}
+
+// ServiceRecord is a port found open on a host by a network scan.
+type ServiceRecord struct {
+	WorkspaceID string    `json:"workspace_id"`
+	Host        string    `json:"host"`
+	Port        int       `json:"port"`
+	Proto       string    `json:"proto"`
+	Service     string    `json:"service"`
+	Version     string    `json:"version"`
+	Banner      string    `json:"banner"`
+	OperationID string    `json:"operation_id"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// CapturedCredentialRecord is a credential found during an operation. Its
+// value is only stored encrypted.
+type CapturedCredentialRecord struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	OperationID string    `json:"operation_id"`
+	AgentID     string    `json:"agent_id"`
+	FindingID   string    `json:"finding_id"`
+	Target      string    `json:"target"`
+	Kind        string    `json:"kind"`
+	Username    string    `json:"username"`
+	Masked      string    `json:"masked"`
+	Source      string    `json:"source"`
+	Fingerprint string    `json:"-"`
+	Ciphertext  string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AgentCheckpointRecord is the latest checkpoint of an agent's run.
+type AgentCheckpointRecord struct {
+	AgentID     string          `json:"agent_id"`
+	OperationID string          `json:"operation_id"`
+	Data        json.RawMessage `json:"data"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// JobRecord is a background job with its input and, once finished, its
+// result.
+type JobRecord struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	WorkspaceID string          `json:"workspace_id"`
+	Status      string          `json:"status"`
+	Input       json.RawMessage `json:"input"`
+	Result      json.RawMessage `json:"result"`
+	Error       string          `json:"error"`
+	CreatedBy   string          `json:"created_by"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
+
+// ModelBenchmarkRecord is a finished model benchmark, stored as JSON.
+type ModelBenchmarkRecord struct {
+	ID          string          `json:"id"`
+	WorkspaceID string          `json:"workspace_id"`
+	Data        json.RawMessage `json:"data"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ReportTemplateRecord is an uploaded report template, stored as JSON.
+type ReportTemplateRecord struct {
+	ID          string          `json:"id"`
+	WorkspaceID string          `json:"workspace_id"`
+	Data        json.RawMessage `json:"data"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ReportSummaryRecord is the executive summary of an operation's report,
+// stored as JSON.
+type ReportSummaryRecord struct {
+	OperationID string          `json:"operation_id"`
+	WorkspaceID string          `json:"workspace_id"`
+	Data        json.RawMessage `json:"data"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// FindingRuleRecord is a finding rule, stored as JSON.
+type FindingRuleRecord struct {
+	ID          string          `json:"id"`
+	WorkspaceID string          `json:"workspace_id"`
+	Data        json.RawMessage `json:"data"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// SuppressionRecord is an accepted risk of the suppression register, stored
+// as JSON.
+type SuppressionRecord struct {
+	ID          string          `json:"id"`
+	WorkspaceID string          `json:"workspace_id"`
+	Data        json.RawMessage `json:"data"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// EmailRecipientRecord is a recipient of email digests, stored as JSON.
+type EmailRecipientRecord struct {
+	ID          string          `json:"id"`
+	WorkspaceID string          `json:"workspace_id"`
+	Data        json.RawMessage `json:"data"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// RetryPolicyRecord is the global retry policy of an agent error class,
+// stored as JSON.
+type RetryPolicyRecord struct {
+	Class     string          `json:"class"`
+	Data      json.RawMessage `json:"data"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// AgentRecordingRecord is one entry of the recording of an agent's run,
+// numbered by Seq within the agent and stored as JSON.
+type AgentRecordingRecord struct {
+	AgentID     string          `json:"agent_id"`
+	Seq         int             `json:"seq"`
+	OperationID string          `json:"operation_id"`
+	Kind        string          `json:"kind"`
+	Data        json.RawMessage `json:"data"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// NetworkAuditRecord is an audit entry for a privileged network action.
+type NetworkAuditRecord struct {
+	ID          string    `json:"id"`
+	Action      string    `json:"action"`
+	Actor       string    `json:"actor"`
+	Interface   string    `json:"interface"`
+	OperationID string    `json:"operation_id"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Error       string    `json:"error"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CredentialRevealRecord is an audit entry for a captured credential value
+// shown in clear.
+type CredentialRevealRecord struct {
+	ID           string    `json:"id"`
+	CredentialID string    `json:"credential_id"`
+	Actor        string    `json:"actor"`
+	IP           string    `json:"ip"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type CredentialRecord struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Provider   string    `json:"provider"`
+	IsDefault  bool      `json:"is_default"`
+	Hint       string    `json:"hint"`
+	Ciphertext string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type SavedSession struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Config      json.RawMessage `json:"config"`
+	Agents      json.RawMessage `json:"agents"`
+	Findings    json.RawMessage `json:"findings"`
+	OwnerID     string          `json:"owner_id,omitempty"`
+	WorkspaceID string          `json:"workspace_id"`
+	OperationID string          `json:"operation_id,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Init connects to DATABASE_URL, if set, and applies the pool settings.
+func Init(cfg PoolConfig) error {
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
 		log.Println("DATABASE_URL not set, using in-memory storage")
 		return nil
 	}
 
-	var err error
-	DB, err = sql.Open("postgres", dbURL)
+	driver, dsn, err := parseDatabaseURL(dbURL)
+	if err != nil {
+		return err
+	}
+	Driver = driver
+
+	DB, err = sql.Open(driver, dsn)
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
+	applyPoolConfig(cfg)
+
+	ctx, cancel := queryContext()
+	defer cancel()
 
-	if err = DB.Ping(); err != nil {
+	if err = withRetry(ctx, func() error { return DB.PingContext(ctx) }); err != nil {
 		return fmt.Errorf("failed to ping database: %w", err)
 	}
 
@@ -63,7 +359,7 @@ func Init() error {
 		return fmt.Errorf("failed to create tables: %w", err)
 	}
 
-	log.Println("Database connected successfully")
+	log.Printf("Database connected successfully (%s)", driver)
 	return nil
 }
 
@@ -110,10 +406,278 @@ func createTables() error {
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
 		)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS status VARCHAR(50) DEFAULT 'new'`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS cvss_vector VARCHAR(100)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS cvss_score NUMERIC(3,1)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS cwe_id VARCHAR(20)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS owasp_category VARCHAR(100)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS confidence NUMERIC(4,3)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS classification JSONB`,
+		`CREATE INDEX IF NOT EXISTS idx_findings_severity ON findings (severity)`,
+		`CREATE INDEX IF NOT EXISTS idx_findings_created_at ON findings (created_at)`,
+		`CREATE TABLE IF NOT EXISTS schedules (
+			id VARCHAR(255) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			config_id VARCHAR(255) NOT NULL,
+			cron_expr VARCHAR(255) NOT NULL,
+			timezone VARCHAR(100),
+			enabled BOOLEAN DEFAULT true,
+			paused BOOLEAN DEFAULT false,
+			next_run_at TIMESTAMP,
+			last_run_at TIMESTAMP,
+			runs JSONB DEFAULT '[]',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS prompt_templates (
+			id VARCHAR(255) PRIMARY KEY,
+			role VARCHAR(255) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			description TEXT,
+			active_version INTEGER NOT NULL DEFAULT 1,
+			versions JSONB DEFAULT '[]',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_prompt_templates_role ON prompt_templates (LOWER(role))`,
+		`CREATE TABLE IF NOT EXISTS agent_roles (
+			id VARCHAR(255) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			description TEXT,
+			prompt_template_id VARCHAR(255),
+			tool_categories JSONB DEFAULT '[]',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_agent_roles_name ON agent_roles (LOWER(name))`,
+		`CREATE TABLE IF NOT EXISTS settings (
+			key VARCHAR(255) PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS credentials (
+			id VARCHAR(255) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			provider VARCHAR(100) NOT NULL,
+			is_default BOOLEAN DEFAULT false,
+			hint VARCHAR(50),
+			ciphertext TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS assets (
+			id VARCHAR(255) PRIMARY KEY,
+			kind VARCHAR(20) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			data JSONB DEFAULT '{}',
+			first_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_assets_name ON assets(name)`,
+		`CREATE TABLE IF NOT EXISTS integrations (
+			id VARCHAR(255) PRIMARY KEY,
+			type VARCHAR(20) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			data JSONB DEFAULT '{}',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS issues JSONB`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS retests JSONB`,
+		`CREATE TABLE IF NOT EXISTS command_policy (
+			id VARCHAR(50) PRIMARY KEY,
+			rules JSONB DEFAULT '[]',
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS events (
+			id VARCHAR(255) PRIMARY KEY,
+			operation_id VARCHAR(255) NOT NULL,
+			agent_id VARCHAR(255),
+			type VARCHAR(50) NOT NULL,
+			actor VARCHAR(50),
+			summary TEXT,
+			data JSONB,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_events_operation ON events (operation_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS escalation_policies (
+			id VARCHAR(255) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			data JSONB DEFAULT '{}',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS users (
+			id VARCHAR(255) PRIMARY KEY,
+			username VARCHAR(255) NOT NULL,
+			password_hash VARCHAR(255) NOT NULL,
+			role VARCHAR(20) NOT NULL,
+			disabled BOOLEAN DEFAULT false,
+			token_version INTEGER DEFAULT 0,
+			last_login_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (LOWER(username))`,
+		`ALTER TABLE configs ADD COLUMN IF NOT EXISTS owner_id VARCHAR(255)`,
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS owner_id VARCHAR(255)`,
+		`CREATE TABLE IF NOT EXISTS workspaces (
+			id VARCHAR(64) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			data JSONB DEFAULT '{}',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE configs ADD COLUMN IF NOT EXISTS workspace_id VARCHAR(64)`,
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS workspace_id VARCHAR(64)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS workspace_id VARCHAR(64)`,
+		`CREATE INDEX IF NOT EXISTS idx_findings_workspace ON findings (workspace_id)`,
+		`ALTER TABLE configs ADD COLUMN IF NOT EXISTS roe JSONB`,
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS operation_id VARCHAR(255)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_operation ON sessions (operation_id)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS triaged_at TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS config_presets (
+			id VARCHAR(255) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			description TEXT,
+			config JSONB DEFAULT '{}',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS services (
+			workspace_id VARCHAR(64) NOT NULL,
+			host VARCHAR(255) NOT NULL,
+			port INTEGER NOT NULL,
+			proto VARCHAR(10) NOT NULL,
+			service VARCHAR(100),
+			version TEXT,
+			banner TEXT,
+			operation_id VARCHAR(255),
+			first_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (workspace_id, host, port, proto)
+		)`,
+		`CREATE TABLE IF NOT EXISTS captured_credentials (
+			id VARCHAR(255) PRIMARY KEY,
+			workspace_id VARCHAR(64) NOT NULL DEFAULT '',
+			operation_id VARCHAR(255),
+			agent_id VARCHAR(255),
+			finding_id VARCHAR(255),
+			target TEXT,
+			kind VARCHAR(50) NOT NULL,
+			username TEXT,
+			masked TEXT,
+			source VARCHAR(50),
+			fingerprint VARCHAR(128) NOT NULL,
+			ciphertext TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_captured_credentials_workspace ON captured_credentials (workspace_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS credential_reveals (
+			id VARCHAR(255) PRIMARY KEY,
+			credential_id VARCHAR(255) NOT NULL,
+			actor VARCHAR(255),
+			ip VARCHAR(100),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_credential_reveals_credential ON credential_reveals (credential_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS network_audit (
+			id VARCHAR(255) PRIMARY KEY,
+			action VARCHAR(50) NOT NULL,
+			actor VARCHAR(255),
+			interface VARCHAR(64),
+			operation_id VARCHAR(255),
+			from_value VARCHAR(255),
+			to_value VARCHAR(255),
+			error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_network_audit_created ON network_audit (created_at)`,
+		`CREATE TABLE IF NOT EXISTS jobs (
+			id VARCHAR(255) PRIMARY KEY,
+			kind VARCHAR(100) NOT NULL,
+			workspace_id VARCHAR(64) NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL,
+			input JSONB,
+			result JSONB,
+			error TEXT,
+			created_by VARCHAR(255),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			started_at TIMESTAMP,
+			finished_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_created ON jobs (created_at)`,
+		`CREATE TABLE IF NOT EXISTS agent_checkpoints (
+			agent_id VARCHAR(255) PRIMARY KEY,
+			operation_id VARCHAR(255),
+			data JSONB NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS source VARCHAR(50)`,
+		`CREATE TABLE IF NOT EXISTS model_benchmarks (
+			id VARCHAR(255) PRIMARY KEY,
+			workspace_id VARCHAR(64) NOT NULL DEFAULT '',
+			data JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_model_benchmarks_created ON model_benchmarks (created_at)`,
+		`CREATE TABLE IF NOT EXISTS report_templates (
+			id VARCHAR(255) PRIMARY KEY,
+			workspace_id VARCHAR(64) NOT NULL DEFAULT '',
+			data JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS report_summaries (
+			operation_id VARCHAR(255) PRIMARY KEY,
+			workspace_id VARCHAR(64) NOT NULL DEFAULT '',
+			data JSONB NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS finding_rules (
+			id VARCHAR(255) PRIMARY KEY,
+			workspace_id VARCHAR(64) NOT NULL DEFAULT '',
+			data JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS tags JSONB`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS assignee VARCHAR(255)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS suppression_id VARCHAR(255)`,
+		`CREATE TABLE IF NOT EXISTS suppressions (
+			id VARCHAR(255) PRIMARY KEY,
+			workspace_id VARCHAR(64) NOT NULL DEFAULT '',
+			data JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS email_recipients (
+			id VARCHAR(255) PRIMARY KEY,
+			workspace_id VARCHAR(64) NOT NULL DEFAULT '',
+			data JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS retry_policies (
+			class VARCHAR(64) PRIMARY KEY,
+			data JSONB NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS agent_recordings (
+			agent_id VARCHAR(64) NOT NULL,
+			seq INTEGER NOT NULL,
+			operation_id VARCHAR(64),
+			kind VARCHAR(32) NOT NULL,
+			data JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (agent_id, seq)
+		)`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS remediation_details JSONB`,
+		`ALTER TABLE findings ADD COLUMN IF NOT EXISTS cve_enrichment JSONB`,
 	}
 
 	for _, query := range queries {
-		if _, err := DB.Exec(query); err != nil {
+		if err := migrate(query); err != nil {
 			return err
 		}
 	}
@@ -126,11 +690,14 @@ func SaveConfig(config SavedConfig) error {
 		return nil
 	}
 
+	ctx, cancel := queryContext()
+	defer cancel()
+
 	query := `
 		INSERT INTO configs (id, name, target, category, custom_instruction, stealth_mode, 
 			aggressive_level, model_name, num_agents, execution_duration, requested_tools,
-			allowed_tools_only, stealth_options, capabilities, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+			allowed_tools_only, stealth_options, capabilities, roe, owner_id, workspace_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 		ON CONFLICT (id) DO UPDATE SET
 			name = EXCLUDED.name,
 			target = EXCLUDED.target,
@@ -145,13 +712,16 @@ func SaveConfig(config SavedConfig) error {
 			allowed_tools_only = EXCLUDED.allowed_tools_only,
 			stealth_options = EXCLUDED.stealth_options,
 			capabilities = EXCLUDED.capabilities,
+			roe = EXCLUDED.roe,
+			owner_id = EXCLUDED.owner_id,
+			workspace_id = EXCLUDED.workspace_id,
 			updated_at = EXCLUDED.updated_at
 	`
 
-	_, err := DB.Exec(query, config.ID, config.Name, config.Target, config.Category,
+	_, err := dbExec(ctx, query, config.ID, config.Name, config.Target, config.Category,
 		config.CustomInstruction, config.StealthMode, config.AggressiveLevel, config.ModelName,
 		config.NumAgents, config.ExecutionDuration, config.RequestedTools, config.AllowedToolsOnly,
-		config.StealthOptions, config.Capabilities, config.CreatedAt, config.UpdatedAt)
+		config.StealthOptions, config.Capabilities, config.RoE, config.OwnerID, config.WorkspaceID, config.CreatedAt, config.UpdatedAt)
 
 	return err
 }
@@ -161,16 +731,19 @@ func GetConfig(id string) (*SavedConfig, error) {
 		return nil, fmt.Errorf("database not initialized")
 	}
 
+	ctx, cancel := queryContext()
+	defer cancel()
+
 	query := `SELECT id, name, target, category, custom_instruction, stealth_mode,
 		aggressive_level, model_name, num_agents, execution_duration, requested_tools,
-		allowed_tools_only, stealth_options, capabilities, created_at, updated_at
+		allowed_tools_only, stealth_options, capabilities, COALESCE(roe, 'null'::jsonb), COALESCE(owner_id, ''), COALESCE(workspace_id, 'default'), created_at, updated_at
 		FROM configs WHERE id = $1`
 
 	var config SavedConfig
-	err := DB.QueryRow(query, id).Scan(&config.ID, &config.Name, &config.Target, &config.Category,
+	err := dbQueryRow(ctx, query, id).Scan(&config.ID, &config.Name, &config.Target, &config.Category,
 		&config.CustomInstruction, &config.StealthMode, &config.AggressiveLevel, &config.ModelName,
 		&config.NumAgents, &config.ExecutionDuration, &config.RequestedTools, &config.AllowedToolsOnly,
-		&config.StealthOptions, &config.Capabilities, &config.CreatedAt, &config.UpdatedAt)
+		&config.StealthOptions, &config.Capabilities, &config.RoE, &config.OwnerID, &config.WorkspaceID, &config.CreatedAt, &config.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -187,31 +760,122 @@ func GetAllConfigs() ([]SavedConfig, error) {
 		return []SavedConfig{}, nil
 	}
 
+	ctx, cancel := queryContext()
+	defer cancel()
+
 	query := `SELECT id, name, target, category, custom_instruction, stealth_mode,
 		aggressive_level, model_name, num_agents, execution_duration, requested_tools,
-		allowed_tools_only, stealth_options, capabilities, created_at, updated_at
+		allowed_tools_only, stealth_options, capabilities, COALESCE(roe, 'null'::jsonb), COALESCE(owner_id, ''), COALESCE(workspace_id, 'default'), created_at, updated_at
 		FROM configs ORDER BY updated_at DESC`
 
-	rows, err := DB.Query(query)
+	return queryConfigs(ctx, query)
+}
+
+// QueryConfigs returns one page of the saved configs matching q and the
+// total number of matches.
+func QueryConfigs(q SavedQuery) ([]SavedConfig, int, error) {
+	if DB == nil {
+		return nil, 0, fmt.Errorf("database not initialized")
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	where, args := buildSavedWhere(q, "target", "category")
+	var total int
+	if err := dbQueryRow(ctx, "SELECT COUNT(*) FROM configs"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, name, target, category, custom_instruction, stealth_mode,
+		aggressive_level, model_name, num_agents, execution_duration, requested_tools,
+		allowed_tools_only, stealth_options, capabilities, COALESCE(roe, 'null'::jsonb), COALESCE(owner_id, ''), COALESCE(workspace_id, 'default'), created_at, updated_at
+		FROM configs` + where
+	query, args = pageSavedQuery(q, query, args)
+
+	configs, err := queryConfigs(ctx, query, args...)
+	return configs, total, err
+}
+
+func queryConfigs(ctx context.Context, query string, args ...interface{}) ([]SavedConfig, error) {
+	rows, err := dbQuery(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var configs []SavedConfig
+	configs := make([]SavedConfig, 0)
 	for rows.Next() {
 		var config SavedConfig
 		err := rows.Scan(&config.ID, &config.Name, &config.Target, &config.Category,
 			&config.CustomInstruction, &config.StealthMode, &config.AggressiveLevel, &config.ModelName,
 			&config.NumAgents, &config.ExecutionDuration, &config.RequestedTools, &config.AllowedToolsOnly,
-			&config.StealthOptions, &config.Capabilities, &config.CreatedAt, &config.UpdatedAt)
+			&config.StealthOptions, &config.Capabilities, &config.RoE, &config.OwnerID, &config.WorkspaceID, &config.CreatedAt, &config.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
 		configs = append(configs, config)
 	}
 
-	return configs, nil
+	return configs, rows.Err()
+}
+
+// buildSavedWhere returns the WHERE clause of a saved config or session
+// query, with the column expressions holding their target and category.
+func buildSavedWhere(q SavedQuery, target, category string) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+
+	add := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		clauses = append(clauses, fmt.Sprintf(clause, len(args)))
+	}
+
+	if q.WorkspaceID != "" {
+		add("COALESCE(workspace_id, 'default') = $%d", q.WorkspaceID)
+	}
+	if q.OwnerID != "" {
+		add("owner_id = $%d", q.OwnerID)
+	}
+	if q.Category != "" {
+		add("LOWER(COALESCE("+category+", '')) = LOWER($%d)", q.Category)
+	}
+	if q.Search != "" {
+		args = append(args, "%"+q.Search+"%")
+		clauses = append(clauses, fmt.Sprintf("(name ILIKE $%d OR COALESCE(%s, '') ILIKE $%d)", len(args), target, len(args)))
+	}
+
+	if len(clauses) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// pageSavedQuery adds the ordering and paging of q to a saved config or
+// session query.
+func pageSavedQuery(q SavedQuery, query string, args []interface{}) (string, []interface{}) {
+	orderBy := "updated_at"
+	switch q.SortBy {
+	case "created_at":
+		orderBy = "created_at"
+	case "name":
+		orderBy = "LOWER(name)"
+	}
+	direction := "ASC"
+	if q.SortDesc {
+		direction = "DESC"
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id", orderBy, direction)
+
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if q.Offset > 0 {
+		args = append(args, q.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	return query, args
 }
 
 func DeleteConfig(id string) error {
@@ -219,7 +883,10 @@ func DeleteConfig(id string) error {
 		return nil
 	}
 
-	_, err := DB.Exec("DELETE FROM configs WHERE id = $1", id)
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM configs WHERE id = $1", id)
 	return err
 }
 
@@ -228,19 +895,25 @@ func SaveSession(session SavedSession) error {
 		return nil
 	}
 
+	ctx, cancel := queryContext()
+	defer cancel()
+
 	query := `
-		INSERT INTO sessions (id, name, config, agents, findings, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO sessions (id, name, config, agents, findings, owner_id, workspace_id, operation_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		ON CONFLICT (id) DO UPDATE SET
 			name = EXCLUDED.name,
 			config = EXCLUDED.config,
 			agents = EXCLUDED.agents,
 			findings = EXCLUDED.findings,
+			owner_id = EXCLUDED.owner_id,
+			workspace_id = EXCLUDED.workspace_id,
+			operation_id = EXCLUDED.operation_id,
 			updated_at = EXCLUDED.updated_at
 	`
 
-	_, err := DB.Exec(query, session.ID, session.Name, session.Config, session.Agents,
-		session.Findings, session.CreatedAt, session.UpdatedAt)
+	_, err := dbExec(ctx, query, session.ID, session.Name, session.Config, session.Agents,
+		session.Findings, session.OwnerID, session.WorkspaceID, session.OperationID, session.CreatedAt, session.UpdatedAt)
 
 	return err
 }
@@ -250,11 +923,14 @@ func GetSession(id string) (*SavedSession, error) {
 		return nil, fmt.Errorf("database not initialized")
 	}
 
-	query := `SELECT id, name, config, agents, findings, created_at, updated_at FROM sessions WHERE id = $1`
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, name, config, agents, findings, COALESCE(owner_id, ''), COALESCE(workspace_id, 'default'), COALESCE(operation_id, ''), created_at, updated_at FROM sessions WHERE id = $1`
 
 	var session SavedSession
-	err := DB.QueryRow(query, id).Scan(&session.ID, &session.Name, &session.Config,
-		&session.Agents, &session.Findings, &session.CreatedAt, &session.UpdatedAt)
+	err := dbQueryRow(ctx, query, id).Scan(&session.ID, &session.Name, &session.Config,
+		&session.Agents, &session.Findings, &session.OwnerID, &session.WorkspaceID, &session.OperationID, &session.CreatedAt, &session.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -271,9 +947,55 @@ func GetAllSessions() ([]SavedSession, error) {
 		return []SavedSession{}, nil
 	}
 
-	query := `SELECT id, name, config, agents, findings, created_at, updated_at FROM sessions ORDER BY updated_at DESC`
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, name, config, agents, findings, COALESCE(owner_id, ''), COALESCE(workspace_id, 'default'), COALESCE(operation_id, ''), created_at, updated_at FROM sessions ORDER BY updated_at DESC`
+
+	return querySessions(ctx, query)
+}
+
+// QuerySessions returns one page of the saved sessions matching q and the
+// total number of matches. Their target and category are those of their
+// config.
+func QuerySessions(q SavedQuery) ([]SavedSession, int, error) {
+	if DB == nil {
+		return nil, 0, fmt.Errorf("database not initialized")
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	where, args := buildSavedWhere(q, "config->>'target'", "config->>'category'")
+	var total int
+	if err := dbQueryRow(ctx, "SELECT COUNT(*) FROM sessions"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, name, config, agents, findings, COALESCE(owner_id, ''), COALESCE(workspace_id, 'default'), COALESCE(operation_id, ''), created_at, updated_at FROM sessions` + where
+	query, args = pageSavedQuery(q, query, args)
+
+	sessions, err := querySessions(ctx, query, args...)
+	return sessions, total, err
+}
+
+// GetOperationSessions returns the sessions snapshotted from an operation,
+// newest first.
+func GetOperationSessions(operationID string) ([]SavedSession, error) {
+	if DB == nil {
+		return []SavedSession{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
 
-	rows, err := DB.Query(query)
+	query := `SELECT id, name, config, agents, findings, COALESCE(owner_id, ''), COALESCE(workspace_id, 'default'), COALESCE(operation_id, ''), created_at, updated_at FROM sessions WHERE operation_id = $1 ORDER BY created_at DESC`
+
+	return querySessions(ctx, query, operationID)
+}
+
+func querySessions(ctx context.Context, query string, args ...interface{}) ([]SavedSession, error) {
+	rows, err := dbQuery(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -283,7 +1005,7 @@ func GetAllSessions() ([]SavedSession, error) {
 	for rows.Next() {
 		var session SavedSession
 		err := rows.Scan(&session.ID, &session.Name, &session.Config, &session.Agents,
-			&session.Findings, &session.CreatedAt, &session.UpdatedAt)
+			&session.Findings, &session.OwnerID, &session.WorkspaceID, &session.OperationID, &session.CreatedAt, &session.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -298,10 +1020,1884 @@ func DeleteSession(id string) error {
 		return nil
 	}
 
-	_, err := DB.Exec("DELETE FROM sessions WHERE id = $1", id)
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM sessions WHERE id = $1", id)
+	return err
+}
+
+func SaveFinding(finding FindingRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO findings (id, session_id, agent_id, title, description, severity, category,
+			target, evidence, remediation, status, cvss_vector, cvss_score, cwe_id, owasp_category,
+			confidence, classification, issues, retests, tags, assignee, suppression_id, workspace_id, source, created_at, triaged_at,
+			remediation_details, cve_enrichment)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28)
+		ON CONFLICT (id) DO UPDATE SET
+			title = EXCLUDED.title,
+			description = EXCLUDED.description,
+			severity = EXCLUDED.severity,
+			category = EXCLUDED.category,
+			target = EXCLUDED.target,
+			evidence = EXCLUDED.evidence,
+			remediation = EXCLUDED.remediation,
+			status = EXCLUDED.status,
+			cvss_vector = EXCLUDED.cvss_vector,
+			cvss_score = EXCLUDED.cvss_score,
+			cwe_id = EXCLUDED.cwe_id,
+			owasp_category = EXCLUDED.owasp_category,
+			confidence = EXCLUDED.confidence,
+			classification = EXCLUDED.classification,
+			issues = EXCLUDED.issues,
+			retests = EXCLUDED.retests,
+			tags = EXCLUDED.tags,
+			assignee = EXCLUDED.assignee,
+			suppression_id = EXCLUDED.suppression_id,
+			source = EXCLUDED.source,
+			triaged_at = EXCLUDED.triaged_at,
+			remediation_details = EXCLUDED.remediation_details,
+			cve_enrichment = EXCLUDED.cve_enrichment
+	`
+
+	_, err := dbExec(ctx, query, finding.ID, finding.SessionID, finding.AgentID, finding.Title,
+		finding.Description, finding.Severity, finding.Category, finding.Target, finding.Evidence,
+		finding.Remediation, finding.Status, finding.CVSSVector, finding.CVSSScore, finding.CWE,
+		finding.OWASP, finding.Confidence, nullableJSON(finding.Classification), nullableJSON(finding.Issues), nullableJSON(finding.Retests), nullableJSON(finding.Tags), finding.Assignee, finding.Suppression, finding.WorkspaceID, finding.Source, finding.CreatedAt, finding.TriagedAt,
+		nullableJSON(finding.RemediationDetails), nullableJSON(finding.CVEEnrichment))
+
+	return err
+}
+
+// nullableJSON stores an empty raw message as SQL NULL rather than invalid JSON.
+func nullableJSON(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return []byte(data)
+}
+
+func DeleteFinding(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM findings WHERE id = $1", id)
 	return err
 }
 
+func buildFindingsWhere(q FindingQuery) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+
+	add := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		clauses = append(clauses, fmt.Sprintf(clause, len(args)))
+	}
+
+	if q.WorkspaceID != "" {
+		add("COALESCE(workspace_id, 'default') = $%d", q.WorkspaceID)
+	}
+	if len(q.Severities) > 0 {
+		placeholders := make([]string, 0, len(q.Severities))
+		for _, severity := range q.Severities {
+			args = append(args, severity)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		clauses = append(clauses, "severity IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if q.Category != "" {
+		add("LOWER(category) = LOWER($%d)", q.Category)
+	}
+	if q.Target != "" {
+		add("target ILIKE $%d", "%"+q.Target+"%")
+	}
+	if q.AgentID != "" {
+		add("agent_id = $%d", q.AgentID)
+	}
+	if q.Status != "" {
+		add("status = $%d", q.Status)
+	}
+	if q.Search != "" {
+		args = append(args, "%"+q.Search+"%")
+		clauses = append(clauses, fmt.Sprintf("(title ILIKE $%d OR description ILIKE $%d)", len(args), len(args)))
+	}
+	if q.Since != nil {
+		add("created_at >= $%d", *q.Since)
+	}
+	if q.Until != nil {
+		add("created_at <= $%d", *q.Until)
+	}
+
+	if len(clauses) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// QueryFindings returns one page of findings matching q, the total number of
+// matches, and a per-severity count over all matches.
+func QueryFindings(q FindingQuery) ([]FindingRecord, int, map[string]int, error) {
+	if DB == nil {
+		return nil, 0, nil, fmt.Errorf("database not initialized")
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	where, args := buildFindingsWhere(q)
+
+	summary := make(map[string]int)
+	total := 0
+	rows, err := dbQuery(ctx, "SELECT COALESCE(severity, ''), COUNT(*) FROM findings"+where+" GROUP BY severity", args...)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	for rows.Next() {
+		var severity string
+		var count int
+		if err := rows.Scan(&severity, &count); err != nil {
+			rows.Close()
+			return nil, 0, nil, err
+		}
+		summary[severity] = count
+		total += count
+	}
+	rows.Close()
+
+	orderBy := "created_at"
+	switch q.SortBy {
+	case "severity":
+		orderBy = "CASE severity WHEN 'critical' THEN 5 WHEN 'high' THEN 4 WHEN 'medium' THEN 3 WHEN 'low' THEN 2 WHEN 'info' THEN 1 ELSE 0 END"
+	case "title":
+		orderBy = "LOWER(title)"
+	}
+	direction := "ASC"
+	if q.SortDesc {
+		direction = "DESC"
+	}
+
+	query := `SELECT id, session_id, COALESCE(agent_id, ''), title, COALESCE(description, ''),
+		COALESCE(severity, ''), COALESCE(category, ''), COALESCE(target, ''), COALESCE(evidence, ''),
+		COALESCE(remediation, ''), COALESCE(status, 'new'), COALESCE(cvss_vector, ''), cvss_score,
+		COALESCE(cwe_id, ''), COALESCE(owasp_category, ''), confidence,
+		COALESCE(classification, 'null'::jsonb), COALESCE(issues, 'null'::jsonb), COALESCE(retests, 'null'::jsonb), COALESCE(tags, 'null'::jsonb), COALESCE(assignee, ''), COALESCE(suppression_id, ''), COALESCE(workspace_id, 'default'), COALESCE(source, ''), created_at, triaged_at,
+		COALESCE(remediation_details, 'null'::jsonb), COALESCE(cve_enrichment, 'null'::jsonb)
+		FROM findings` + where + fmt.Sprintf(" ORDER BY %s %s, id", orderBy, direction)
+
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if q.Offset > 0 {
+		args = append(args, q.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err = dbQuery(ctx, query, args...)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer rows.Close()
+
+	findings := make([]FindingRecord, 0)
+	for rows.Next() {
+		var finding FindingRecord
+		err := rows.Scan(&finding.ID, &finding.SessionID, &finding.AgentID, &finding.Title,
+			&finding.Description, &finding.Severity, &finding.Category, &finding.Target,
+			&finding.Evidence, &finding.Remediation, &finding.Status, &finding.CVSSVector,
+			&finding.CVSSScore, &finding.CWE, &finding.OWASP, &finding.Confidence,
+			&finding.Classification, &finding.Issues, &finding.Retests, &finding.Tags, &finding.Assignee, &finding.Suppression, &finding.WorkspaceID, &finding.Source, &finding.CreatedAt, &finding.TriagedAt,
+			&finding.RemediationDetails, &finding.CVEEnrichment)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings, total, summary, nil
+}
+
+func SaveSchedule(schedule ScheduleRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO schedules (id, name, config_id, cron_expr, timezone, enabled, paused,
+			next_run_at, last_run_at, runs, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name,
+			config_id = EXCLUDED.config_id,
+			cron_expr = EXCLUDED.cron_expr,
+			timezone = EXCLUDED.timezone,
+			enabled = EXCLUDED.enabled,
+			paused = EXCLUDED.paused,
+			next_run_at = EXCLUDED.next_run_at,
+			last_run_at = EXCLUDED.last_run_at,
+			runs = EXCLUDED.runs,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, schedule.ID, schedule.Name, schedule.ConfigID, schedule.CronExpr,
+		schedule.Timezone, schedule.Enabled, schedule.Paused, schedule.NextRunAt, schedule.LastRunAt,
+		schedule.Runs, schedule.CreatedAt, schedule.UpdatedAt)
+
+	return err
+}
+
+func GetAllSchedules() ([]ScheduleRecord, error) {
+	if DB == nil {
+		return []ScheduleRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, name, config_id, cron_expr, COALESCE(timezone, ''), enabled, paused,
+		next_run_at, last_run_at, runs, created_at, updated_at FROM schedules ORDER BY created_at`
+
+	rows, err := dbQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []ScheduleRecord
+	for rows.Next() {
+		var schedule ScheduleRecord
+		err := rows.Scan(&schedule.ID, &schedule.Name, &schedule.ConfigID, &schedule.CronExpr,
+			&schedule.Timezone, &schedule.Enabled, &schedule.Paused, &schedule.NextRunAt,
+			&schedule.LastRunAt, &schedule.Runs, &schedule.CreatedAt, &schedule.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+func DeleteSchedule(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM schedules WHERE id = $1", id)
+	return err
+}
+
+func SavePromptTemplate(tmpl PromptTemplateRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO prompt_templates (id, role, name, description, active_version, versions,
+			created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			role = EXCLUDED.role,
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			active_version = EXCLUDED.active_version,
+			versions = EXCLUDED.versions,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, tmpl.ID, tmpl.Role, tmpl.Name, tmpl.Description, tmpl.ActiveVersion,
+		tmpl.Versions, tmpl.CreatedAt, tmpl.UpdatedAt)
+
+	return err
+}
+
+func GetAllPromptTemplates() ([]PromptTemplateRecord, error) {
+	if DB == nil {
+		return []PromptTemplateRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, role, name, COALESCE(description, ''), active_version, versions,
+		created_at, updated_at FROM prompt_templates ORDER BY role`
+
+	rows, err := dbQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []PromptTemplateRecord
+	for rows.Next() {
+		var tmpl PromptTemplateRecord
+		err := rows.Scan(&tmpl.ID, &tmpl.Role, &tmpl.Name, &tmpl.Description, &tmpl.ActiveVersion,
+			&tmpl.Versions, &tmpl.CreatedAt, &tmpl.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+
+	return templates, nil
+}
+
+func DeletePromptTemplate(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM prompt_templates WHERE id = $1", id)
+	return err
+}
+
+func SaveAgentRole(role AgentRoleRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO agent_roles (id, name, description, prompt_template_id, tool_categories,
+			created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			prompt_template_id = EXCLUDED.prompt_template_id,
+			tool_categories = EXCLUDED.tool_categories,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, role.ID, role.Name, role.Description, role.PromptTemplateID,
+		role.ToolCategories, role.CreatedAt, role.UpdatedAt)
+
+	return err
+}
+
+func GetAllAgentRoles() ([]AgentRoleRecord, error) {
+	if DB == nil {
+		return []AgentRoleRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, name, COALESCE(description, ''), COALESCE(prompt_template_id, ''),
+		tool_categories, created_at, updated_at FROM agent_roles ORDER BY name`
+
+	rows, err := dbQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []AgentRoleRecord
+	for rows.Next() {
+		var role AgentRoleRecord
+		err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.PromptTemplateID,
+			&role.ToolCategories, &role.CreatedAt, &role.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+func DeleteAgentRole(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM agent_roles WHERE id = $1", id)
+	return err
+}
+
+func SaveConfigPreset(preset ConfigPresetRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO config_presets (id, name, description, config, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			config = EXCLUDED.config,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, preset.ID, preset.Name, preset.Description, preset.Config,
+		preset.CreatedAt, preset.UpdatedAt)
+
+	return err
+}
+
+func GetAllConfigPresets() ([]ConfigPresetRecord, error) {
+	if DB == nil {
+		return []ConfigPresetRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, name, COALESCE(description, ''), config, created_at, updated_at
+		FROM config_presets ORDER BY name`
+
+	rows, err := dbQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var presets []ConfigPresetRecord
+	for rows.Next() {
+		var preset ConfigPresetRecord
+		err := rows.Scan(&preset.ID, &preset.Name, &preset.Description, &preset.Config,
+			&preset.CreatedAt, &preset.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, preset)
+	}
+
+	return presets, nil
+}
+
+func DeleteConfigPreset(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM config_presets WHERE id = $1", id)
+	return err
+}
+
+func SaveSetting(key, value string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO settings (key, value, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET
+			value = EXCLUDED.value,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, key, value, time.Now())
+	return err
+}
+
+func GetAllSettings() (map[string]string, error) {
+	if DB == nil {
+		return map[string]string{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, "SELECT key, value FROM settings")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
+	}
+
+	return settings, nil
+}
+
+func DeleteSetting(key string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM settings WHERE key = $1", key)
+	return err
+}
+
+func SaveCredential(credential CredentialRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO credentials (id, name, provider, is_default, hint, ciphertext, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name,
+			is_default = EXCLUDED.is_default,
+			hint = EXCLUDED.hint,
+			ciphertext = EXCLUDED.ciphertext,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, credential.ID, credential.Name, credential.Provider, credential.IsDefault,
+		credential.Hint, credential.Ciphertext, credential.CreatedAt, credential.UpdatedAt)
+
+	return err
+}
+
+func GetAllCredentials() ([]CredentialRecord, error) {
+	if DB == nil {
+		return []CredentialRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, name, provider, is_default, COALESCE(hint, ''), ciphertext, created_at, updated_at
+		FROM credentials ORDER BY provider, name`
+
+	rows, err := dbQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []CredentialRecord
+	for rows.Next() {
+		var credential CredentialRecord
+		err := rows.Scan(&credential.ID, &credential.Name, &credential.Provider, &credential.IsDefault,
+			&credential.Hint, &credential.Ciphertext, &credential.CreatedAt, &credential.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
+
+func DeleteCredential(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM credentials WHERE id = $1", id)
+	return err
+}
+
+func SaveAsset(asset AssetRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO assets (id, kind, name, data, first_seen, last_seen)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			kind = EXCLUDED.kind,
+			name = EXCLUDED.name,
+			data = EXCLUDED.data,
+			first_seen = EXCLUDED.first_seen,
+			last_seen = EXCLUDED.last_seen
+	`
+
+	_, err := dbExec(ctx, query, asset.ID, asset.Kind, asset.Name, asset.Data, asset.FirstSeen, asset.LastSeen)
+	return err
+}
+
+func GetAllAssets() ([]AssetRecord, error) {
+	if DB == nil {
+		return []AssetRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, "SELECT id, kind, name, data, first_seen, last_seen FROM assets ORDER BY last_seen DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assets []AssetRecord
+	for rows.Next() {
+		var asset AssetRecord
+		if err := rows.Scan(&asset.ID, &asset.Kind, &asset.Name, &asset.Data, &asset.FirstSeen, &asset.LastSeen); err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets, nil
+}
+
+func DeleteAsset(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM assets WHERE id = $1", id)
+	return err
+}
+
+// SaveService records a service, keeping the name, version and banner already
+// stored when the new observation has none.
+func SaveService(service ServiceRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO services (workspace_id, host, port, proto, service, version, banner, operation_id, first_seen, last_seen)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (workspace_id, host, port, proto) DO UPDATE SET
+			service = COALESCE(NULLIF(EXCLUDED.service, ''), services.service),
+			version = COALESCE(NULLIF(EXCLUDED.version, ''), services.version),
+			banner = COALESCE(NULLIF(EXCLUDED.banner, ''), services.banner),
+			operation_id = COALESCE(NULLIF(EXCLUDED.operation_id, ''), services.operation_id),
+			last_seen = EXCLUDED.last_seen
+	`
+
+	_, err := dbExec(ctx, query, service.WorkspaceID, service.Host, service.Port, service.Proto,
+		service.Service, service.Version, service.Banner, service.OperationID, service.FirstSeen, service.LastSeen)
+	return err
+}
+
+// GetServices returns the services of a workspace found on any of hosts.
+func GetServices(workspaceID string, hosts []string) ([]ServiceRecord, error) {
+	if DB == nil || len(hosts) == 0 {
+		return []ServiceRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	args := []interface{}{workspaceID}
+	placeholders := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		args = append(args, host)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	query := fmt.Sprintf(`
+		SELECT workspace_id, host, port, proto, COALESCE(service, ''), COALESCE(version, ''),
+			COALESCE(banner, ''), COALESCE(operation_id, ''), first_seen, last_seen
+		FROM services
+		WHERE workspace_id = $1 AND host IN (%s)
+		ORDER BY port, proto, host
+	`, strings.Join(placeholders, ", "))
+
+	rows, err := dbQuery(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	services := make([]ServiceRecord, 0)
+	for rows.Next() {
+		var service ServiceRecord
+		if err := rows.Scan(&service.WorkspaceID, &service.Host, &service.Port, &service.Proto, &service.Service,
+			&service.Version, &service.Banner, &service.OperationID, &service.FirstSeen, &service.LastSeen); err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+
+	return services, rows.Err()
+}
+
+func SaveCapturedCredential(credential CapturedCredentialRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO captured_credentials (id, workspace_id, operation_id, agent_id, finding_id, target, kind,
+			username, masked, source, fingerprint, ciphertext, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO UPDATE SET
+			finding_id = EXCLUDED.finding_id,
+			masked = EXCLUDED.masked,
+			ciphertext = EXCLUDED.ciphertext
+	`
+
+	_, err := dbExec(ctx, query, credential.ID, credential.WorkspaceID, credential.OperationID, credential.AgentID,
+		credential.FindingID, credential.Target, credential.Kind, credential.Username, credential.Masked,
+		credential.Source, credential.Fingerprint, credential.Ciphertext, credential.CreatedAt)
+
+	return err
+}
+
+func GetAllCapturedCredentials() ([]CapturedCredentialRecord, error) {
+	if DB == nil {
+		return []CapturedCredentialRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, workspace_id, COALESCE(operation_id, ''), COALESCE(agent_id, ''), COALESCE(finding_id, ''),
+			COALESCE(target, ''), kind, COALESCE(username, ''), COALESCE(masked, ''), COALESCE(source, ''),
+			fingerprint, ciphertext, created_at
+		FROM captured_credentials ORDER BY created_at`
+
+	rows, err := dbQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := make([]CapturedCredentialRecord, 0)
+	for rows.Next() {
+		var credential CapturedCredentialRecord
+		if err := rows.Scan(&credential.ID, &credential.WorkspaceID, &credential.OperationID, &credential.AgentID,
+			&credential.FindingID, &credential.Target, &credential.Kind, &credential.Username, &credential.Masked,
+			&credential.Source, &credential.Fingerprint, &credential.Ciphertext, &credential.CreatedAt); err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+func SaveCredentialReveal(reveal CredentialRevealRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, `INSERT INTO credential_reveals (id, credential_id, actor, ip, created_at)
+		VALUES ($1, $2, $3, $4, $5)`, reveal.ID, reveal.CredentialID, reveal.Actor, reveal.IP, reveal.CreatedAt)
+	return err
+}
+
+// GetCredentialReveals returns the audit trail of a captured credential,
+// oldest first.
+func GetCredentialReveals(credentialID string) ([]CredentialRevealRecord, error) {
+	if DB == nil {
+		return []CredentialRevealRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, `SELECT id, credential_id, COALESCE(actor, ''), COALESCE(ip, ''), created_at
+		FROM credential_reveals WHERE credential_id = $1 ORDER BY created_at`, credentialID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reveals := make([]CredentialRevealRecord, 0)
+	for rows.Next() {
+		var reveal CredentialRevealRecord
+		if err := rows.Scan(&reveal.ID, &reveal.CredentialID, &reveal.Actor, &reveal.IP, &reveal.CreatedAt); err != nil {
+			return nil, err
+		}
+		reveals = append(reveals, reveal)
+	}
+
+	return reveals, rows.Err()
+}
+
+func SaveNetworkAudit(entry NetworkAuditRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, `INSERT INTO network_audit (id, action, actor, interface, operation_id, from_value, to_value, error, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		entry.ID, entry.Action, entry.Actor, entry.Interface, entry.OperationID, entry.From, entry.To, entry.Error, entry.CreatedAt)
+	return err
+}
+
+// GetNetworkAudit returns the most recent privileged network actions, newest
+// first. A limit of 0 returns them all.
+func GetNetworkAudit(limit int) ([]NetworkAuditRecord, error) {
+	if DB == nil {
+		return []NetworkAuditRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, action, COALESCE(actor, ''), COALESCE(interface, ''), COALESCE(operation_id, ''),
+		COALESCE(from_value, ''), COALESCE(to_value, ''), COALESCE(error, ''), created_at
+		FROM network_audit ORDER BY created_at DESC`
+	args := []interface{}{}
+	if limit > 0 {
+		query += ` LIMIT $1`
+		args = append(args, limit)
+	}
+	rows, err := dbQuery(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]NetworkAuditRecord, 0)
+	for rows.Next() {
+		var entry NetworkAuditRecord
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.Actor, &entry.Interface, &entry.OperationID,
+			&entry.From, &entry.To, &entry.Error, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func SaveAgentCheckpoint(checkpoint AgentCheckpointRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO agent_checkpoints (agent_id, operation_id, data, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (agent_id) DO UPDATE SET
+			operation_id = EXCLUDED.operation_id,
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, checkpoint.AgentID, checkpoint.OperationID, []byte(checkpoint.Data), checkpoint.UpdatedAt)
+	return err
+}
+
+// GetAgentCheckpoint returns the agent's checkpoint, or nil when it has none.
+func GetAgentCheckpoint(agentID string) (*AgentCheckpointRecord, error) {
+	if DB == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	var checkpoint AgentCheckpointRecord
+	var data []byte
+	err := dbQueryRow(ctx, `SELECT agent_id, COALESCE(operation_id, ''), data, updated_at
+		FROM agent_checkpoints WHERE agent_id = $1`, agentID).Scan(&checkpoint.AgentID, &checkpoint.OperationID,
+		&data, &checkpoint.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkpoint.Data = data
+	return &checkpoint, nil
+}
+
+func DeleteAgentCheckpoint(agentID string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, `DELETE FROM agent_checkpoints WHERE agent_id = $1`, agentID)
+	return err
+}
+
+func SaveModelBenchmark(record ModelBenchmarkRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, `INSERT INTO model_benchmarks (id, workspace_id, data, created_at) VALUES ($1, $2, $3, $4)`,
+		record.ID, record.WorkspaceID, []byte(record.Data), record.CreatedAt)
+	return err
+}
+
+// GetRecentModelBenchmarks returns the limit most recent benchmarks, oldest
+// first.
+func GetRecentModelBenchmarks(limit int) ([]ModelBenchmarkRecord, error) {
+	if DB == nil {
+		return []ModelBenchmarkRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, workspace_id, data, created_at
+		FROM (SELECT * FROM model_benchmarks ORDER BY created_at DESC LIMIT $1) recent ORDER BY created_at`
+
+	rows, err := dbQuery(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]ModelBenchmarkRecord, 0)
+	for rows.Next() {
+		var record ModelBenchmarkRecord
+		var data []byte
+		if err := rows.Scan(&record.ID, &record.WorkspaceID, &data, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		record.Data = data
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func SaveReportTemplate(record ReportTemplateRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO report_templates (id, workspace_id, data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := dbExec(ctx, query, record.ID, record.WorkspaceID, []byte(record.Data), record.CreatedAt, record.UpdatedAt)
+	return err
+}
+
+func GetAllReportTemplates() ([]ReportTemplateRecord, error) {
+	if DB == nil {
+		return []ReportTemplateRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, `SELECT id, workspace_id, data, created_at, updated_at FROM report_templates ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]ReportTemplateRecord, 0)
+	for rows.Next() {
+		var record ReportTemplateRecord
+		var data []byte
+		if err := rows.Scan(&record.ID, &record.WorkspaceID, &data, &record.CreatedAt, &record.UpdatedAt); err != nil {
+			return nil, err
+		}
+		record.Data = data
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func DeleteReportTemplate(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM report_templates WHERE id = $1", id)
+	return err
+}
+
+func SaveReportSummary(record ReportSummaryRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO report_summaries (operation_id, workspace_id, data, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (operation_id) DO UPDATE SET
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := dbExec(ctx, query, record.OperationID, record.WorkspaceID, []byte(record.Data), record.UpdatedAt)
+	return err
+}
+
+func GetAllReportSummaries() ([]ReportSummaryRecord, error) {
+	if DB == nil {
+		return []ReportSummaryRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, `SELECT operation_id, workspace_id, data, updated_at FROM report_summaries`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]ReportSummaryRecord, 0)
+	for rows.Next() {
+		var record ReportSummaryRecord
+		var data []byte
+		if err := rows.Scan(&record.OperationID, &record.WorkspaceID, &data, &record.UpdatedAt); err != nil {
+			return nil, err
+		}
+		record.Data = data
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func SaveFindingRule(record FindingRuleRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO finding_rules (id, workspace_id, data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := dbExec(ctx, query, record.ID, record.WorkspaceID, []byte(record.Data), record.CreatedAt, record.UpdatedAt)
+	return err
+}
+
+func GetAllFindingRules() ([]FindingRuleRecord, error) {
+	if DB == nil {
+		return []FindingRuleRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, `SELECT id, workspace_id, data, created_at, updated_at FROM finding_rules ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]FindingRuleRecord, 0)
+	for rows.Next() {
+		var record FindingRuleRecord
+		var data []byte
+		if err := rows.Scan(&record.ID, &record.WorkspaceID, &data, &record.CreatedAt, &record.UpdatedAt); err != nil {
+			return nil, err
+		}
+		record.Data = data
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func DeleteFindingRule(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM finding_rules WHERE id = $1", id)
+	return err
+}
+
+func SaveSuppression(record SuppressionRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO suppressions (id, workspace_id, data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := dbExec(ctx, query, record.ID, record.WorkspaceID, []byte(record.Data), record.CreatedAt, record.UpdatedAt)
+	return err
+}
+
+func GetAllSuppressions() ([]SuppressionRecord, error) {
+	if DB == nil {
+		return []SuppressionRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, `SELECT id, workspace_id, data, created_at, updated_at FROM suppressions ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]SuppressionRecord, 0)
+	for rows.Next() {
+		var record SuppressionRecord
+		var data []byte
+		if err := rows.Scan(&record.ID, &record.WorkspaceID, &data, &record.CreatedAt, &record.UpdatedAt); err != nil {
+			return nil, err
+		}
+		record.Data = data
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func DeleteSuppression(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM suppressions WHERE id = $1", id)
+	return err
+}
+
+func SaveEmailRecipient(record EmailRecipientRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO email_recipients (id, workspace_id, data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := dbExec(ctx, query, record.ID, record.WorkspaceID, []byte(record.Data), record.CreatedAt, record.UpdatedAt)
+	return err
+}
+
+func GetAllEmailRecipients() ([]EmailRecipientRecord, error) {
+	if DB == nil {
+		return []EmailRecipientRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, `SELECT id, workspace_id, data, created_at, updated_at FROM email_recipients ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]EmailRecipientRecord, 0)
+	for rows.Next() {
+		var record EmailRecipientRecord
+		var data []byte
+		if err := rows.Scan(&record.ID, &record.WorkspaceID, &data, &record.CreatedAt, &record.UpdatedAt); err != nil {
+			return nil, err
+		}
+		record.Data = data
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func DeleteEmailRecipient(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM email_recipients WHERE id = $1", id)
+	return err
+}
+
+func SaveRetryPolicy(record RetryPolicyRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO retry_policies (class, data, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (class) DO UPDATE SET
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := dbExec(ctx, query, record.Class, []byte(record.Data), record.UpdatedAt)
+	return err
+}
+
+func GetAllRetryPolicies() ([]RetryPolicyRecord, error) {
+	if DB == nil {
+		return []RetryPolicyRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, `SELECT class, data, updated_at FROM retry_policies`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]RetryPolicyRecord, 0)
+	for rows.Next() {
+		var record RetryPolicyRecord
+		var data []byte
+		if err := rows.Scan(&record.Class, &data, &record.UpdatedAt); err != nil {
+			return nil, err
+		}
+		record.Data = data
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func DeleteRetryPolicy(class string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM retry_policies WHERE class = $1", class)
+	return err
+}
+
+func SaveJob(job JobRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO jobs (id, kind, workspace_id, status, input, result, error, created_by,
+			created_at, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			result = EXCLUDED.result,
+			error = EXCLUDED.error,
+			started_at = EXCLUDED.started_at,
+			finished_at = EXCLUDED.finished_at
+	`
+
+	_, err := dbExec(ctx, query, job.ID, job.Kind, job.WorkspaceID, job.Status, nullableJSON(job.Input),
+		nullableJSON(job.Result), job.Error, job.CreatedBy, job.CreatedAt, job.StartedAt, job.FinishedAt)
+	return err
+}
+
+// GetRecentJobs returns the limit most recent jobs, oldest first.
+func GetRecentJobs(limit int) ([]JobRecord, error) {
+	if DB == nil {
+		return []JobRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, kind, workspace_id, status, input, result, COALESCE(error, ''), COALESCE(created_by, ''),
+			created_at, started_at, finished_at
+		FROM (SELECT * FROM jobs ORDER BY created_at DESC LIMIT $1) recent ORDER BY created_at`
+
+	rows, err := dbQuery(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]JobRecord, 0)
+	for rows.Next() {
+		var job JobRecord
+		var input, result []byte
+		if err := rows.Scan(&job.ID, &job.Kind, &job.WorkspaceID, &job.Status, &input, &result, &job.Error,
+			&job.CreatedBy, &job.CreatedAt, &job.StartedAt, &job.FinishedAt); err != nil {
+			return nil, err
+		}
+		if len(input) > 0 {
+			job.Input = input
+		}
+		if len(result) > 0 {
+			job.Result = result
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+type IntegrationRecord struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Name      string          `json:"name"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func SaveIntegration(integration IntegrationRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO integrations (id, type, name, data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			type = EXCLUDED.type,
+			name = EXCLUDED.name,
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, integration.ID, integration.Type, integration.Name, integration.Data,
+		integration.CreatedAt, integration.UpdatedAt)
+	return err
+}
+
+func GetAllIntegrations() ([]IntegrationRecord, error) {
+	if DB == nil {
+		return []IntegrationRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, "SELECT id, type, name, data, created_at, updated_at FROM integrations ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var integrations []IntegrationRecord
+	for rows.Next() {
+		var integration IntegrationRecord
+		if err := rows.Scan(&integration.ID, &integration.Type, &integration.Name, &integration.Data,
+			&integration.CreatedAt, &integration.UpdatedAt); err != nil {
+			return nil, err
+		}
+		integrations = append(integrations, integration)
+	}
+	return integrations, nil
+}
+
+func DeleteIntegration(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM integrations WHERE id = $1", id)
+	return err
+}
+
+type EscalationPolicyRecord struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func SaveEscalationPolicy(policy EscalationPolicyRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO escalation_policies (id, name, data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name,
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, policy.ID, policy.Name, policy.Data, policy.CreatedAt, policy.UpdatedAt)
+	return err
+}
+
+func GetAllEscalationPolicies() ([]EscalationPolicyRecord, error) {
+	if DB == nil {
+		return []EscalationPolicyRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, "SELECT id, name, data, created_at, updated_at FROM escalation_policies ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []EscalationPolicyRecord
+	for rows.Next() {
+		var policy EscalationPolicyRecord
+		if err := rows.Scan(&policy.ID, &policy.Name, &policy.Data, &policy.CreatedAt, &policy.UpdatedAt); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func DeleteEscalationPolicy(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM escalation_policies WHERE id = $1", id)
+	return err
+}
+
+type UserRecord struct {
+	ID           string     `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	Role         string     `json:"role"`
+	Disabled     bool       `json:"disabled"`
+	TokenVersion int        `json:"token_version"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func SaveUser(user UserRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO users (id, username, password_hash, role, disabled, token_version,
+			last_login_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			username = EXCLUDED.username,
+			password_hash = EXCLUDED.password_hash,
+			role = EXCLUDED.role,
+			disabled = EXCLUDED.disabled,
+			token_version = EXCLUDED.token_version,
+			last_login_at = EXCLUDED.last_login_at,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, user.ID, user.Username, user.PasswordHash, user.Role, user.Disabled,
+		user.TokenVersion, user.LastLoginAt, user.CreatedAt, user.UpdatedAt)
+	return err
+}
+
+func GetAllUsers() ([]UserRecord, error) {
+	if DB == nil {
+		return []UserRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `SELECT id, username, password_hash, role, disabled, token_version, last_login_at,
+		created_at, updated_at FROM users ORDER BY username`
+
+	rows, err := dbQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []UserRecord
+	for rows.Next() {
+		var user UserRecord
+		if err := rows.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.Disabled,
+			&user.TokenVersion, &user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func DeleteUser(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM users WHERE id = $1", id)
+	return err
+}
+
+type WorkspaceRecord struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func SaveWorkspace(workspace WorkspaceRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO workspaces (id, name, data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name,
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, workspace.ID, workspace.Name, workspace.Data, workspace.CreatedAt, workspace.UpdatedAt)
+	return err
+}
+
+func GetAllWorkspaces() ([]WorkspaceRecord, error) {
+	if DB == nil {
+		return []WorkspaceRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, "SELECT id, name, data, created_at, updated_at FROM workspaces ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workspaces []WorkspaceRecord
+	for rows.Next() {
+		var workspace WorkspaceRecord
+		if err := rows.Scan(&workspace.ID, &workspace.Name, &workspace.Data,
+			&workspace.CreatedAt, &workspace.UpdatedAt); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+	return workspaces, nil
+}
+
+func DeleteWorkspace(id string) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, "DELETE FROM workspaces WHERE id = $1", id)
+	return err
+}
+
+// SaveCommandPolicy stores the global command policy rules.
+func SaveCommandPolicy(rules json.RawMessage) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO command_policy (id, rules, updated_at)
+		VALUES ('global', $1, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET
+			rules = EXCLUDED.rules,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := dbExec(ctx, query, rules)
+	return err
+}
+
+// GetCommandPolicy returns the stored global command policy rules, or nil
+// if none have been saved.
+func GetCommandPolicy() (json.RawMessage, error) {
+	if DB == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	var rules json.RawMessage
+	err := dbQueryRow(ctx, "SELECT rules FROM command_policy WHERE id = 'global'").Scan(&rules)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rules, err
+}
+
+type EventRecord struct {
+	ID          string          `json:"id"`
+	OperationID string          `json:"operation_id"`
+	AgentID     string          `json:"agent_id"`
+	Type        string          `json:"type"`
+	Actor       string          `json:"actor"`
+	Summary     string          `json:"summary"`
+	Data        json.RawMessage `json:"data"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type EventQuery struct {
+	OperationID string
+	Types       []string
+	AgentID     string
+	Since       *time.Time
+	Until       *time.Time
+	Limit       int
+	Offset      int
+}
+
+func SaveEvent(event EventRecord) error {
+	if DB == nil {
+		return nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO events (id, operation_id, agent_id, type, actor, summary, data, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := dbExec(ctx, query, event.ID, event.OperationID, event.AgentID, event.Type, event.Actor,
+		event.Summary, nullableJSON(event.Data), event.CreatedAt)
+	return err
+}
+
+// QueryEvents returns one page of an operation's events in chronological
+// order and the total number of matches.
+func QueryEvents(q EventQuery) ([]EventRecord, int, error) {
+	if DB == nil {
+		return nil, 0, fmt.Errorf("database not initialized")
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	args := []interface{}{q.OperationID}
+	where := " WHERE operation_id = $1"
+	if len(q.Types) > 0 {
+		placeholders := make([]string, 0, len(q.Types))
+		for _, eventType := range q.Types {
+			args = append(args, eventType)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		where += " AND type IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	if q.AgentID != "" {
+		args = append(args, q.AgentID)
+		where += fmt.Sprintf(" AND agent_id = $%d", len(args))
+	}
+	if q.Since != nil {
+		args = append(args, *q.Since)
+		where += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if q.Until != nil {
+		args = append(args, *q.Until)
+		where += fmt.Sprintf(" AND created_at <= $%d", len(args))
+	}
+
+	var total int
+	if err := dbQueryRow(ctx, "SELECT COUNT(*) FROM events"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, operation_id, COALESCE(agent_id, ''), type, COALESCE(actor, ''),
+		COALESCE(summary, ''), COALESCE(data, 'null'::jsonb), created_at
+		FROM events` + where + " ORDER BY created_at, id"
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if q.Offset > 0 {
+		args = append(args, q.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := dbQuery(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := make([]EventRecord, 0)
+	for rows.Next() {
+		var event EventRecord
+		if err := rows.Scan(&event.ID, &event.OperationID, &event.AgentID, &event.Type, &event.Actor,
+			&event.Summary, &event.Data, &event.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+	}
+	return events, total, nil
+}
+
+// SaveAgentRecording appends an entry to the agent's recording and returns
+// the sequence number it was given, one past the agent's last.
+func SaveAgentRecording(record AgentRecordingRecord) (int, error) {
+	if DB == nil {
+		return 0, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := `
+		INSERT INTO agent_recordings (agent_id, seq, operation_id, kind, data, created_at)
+		SELECT $1, COALESCE(MAX(seq), 0) + 1, $2, $3, $4, $5 FROM agent_recordings WHERE agent_id = $1
+		RETURNING seq
+	`
+
+	var seq int
+	err := dbQueryRow(ctx, query, record.AgentID, record.OperationID, record.Kind, []byte(record.Data),
+		record.CreatedAt).Scan(&seq)
+	return seq, err
+}
+
+// GetAgentRecording returns the agent's recording, in sequence order.
+func GetAgentRecording(agentID string) ([]AgentRecordingRecord, error) {
+	if DB == nil {
+		return []AgentRecordingRecord{}, nil
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, `SELECT agent_id, seq, COALESCE(operation_id, ''), kind, data, created_at
+		FROM agent_recordings WHERE agent_id = $1 ORDER BY seq`, agentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]AgentRecordingRecord, 0)
+	for rows.Next() {
+		var record AgentRecordingRecord
+		var data []byte
+		if err := rows.Scan(&record.AgentID, &record.Seq, &record.OperationID, &record.Kind, &data, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		record.Data = data
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
 func Close() {
 	if DB != nil {
 		DB.Close()
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Driver is the SQL driver DB was opened with.
+var Driver = DriverPostgres
+
+var (
+	sqliteRewrites = strings.NewReplacer(
+		" ILIKE ", " LIKE ",
+		" JSONB", " TEXT",
+	)
+	// JSON literals are cast to BLOB so they scan into json.RawMessage like
+	// the stored values do.
+	jsonbLiteral         = regexp.MustCompile(`('[^']*')::jsonb`)
+	addColumnIfNotExists = regexp.MustCompile(`(?i)^ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+) (.+)$`)
+	createTable          = regexp.MustCompile(`(?i)^\s*CREATE TABLE IF NOT EXISTS (\w+)`)
+)
+
+// tables lists the tables created by the migrations, in creation order, so
+// that a table comes after those its foreign keys reference.
+var tables []string
+
+// parseDatabaseURL maps DATABASE_URL to a driver and DSN. sqlite://path.db
+// selects the embedded SQLite driver; anything else is handed to Postgres.
+func parseDatabaseURL(dbURL string) (string, string, error) {
+	if !strings.HasPrefix(dbURL, "sqlite://") {
+		return DriverPostgres, dbURL, nil
+	}
+
+	path := strings.TrimPrefix(dbURL, "sqlite://")
+	if path == "" {
+		return "", "", fmt.Errorf("sqlite database path is empty")
+	}
+	return DriverSQLite, path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", nil
+}
+
+// rebind adapts a query written for Postgres to the active driver. SQLite
+// accepts the $N placeholders as is; only Postgres-specific syntax changes.
+func rebind(query string) string {
+	if Driver != DriverSQLite {
+		return query
+	}
+	return jsonbLiteral.ReplaceAllString(sqliteRewrites.Replace(query), "CAST($1 AS BLOB)")
+}
+
+// migrate runs one schema statement. SQLite has no ADD COLUMN IF NOT EXISTS,
+// so the column is looked up first.
+func migrate(statement string) error {
+	if match := createTable.FindStringSubmatch(statement); match != nil {
+		tables = append(tables, match[1])
+	}
+	if Driver == DriverSQLite {
+		if match := addColumnIfNotExists.FindStringSubmatch(statement); match != nil {
+			exists, err := sqliteColumnExists(match[1], match[2])
+			if err != nil || exists {
+				return err
+			}
+			statement = fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", match[1], match[2], match[3])
+		}
+	}
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	_, err := dbExec(ctx, statement)
+	return err
+}
+
+func sqliteColumnExists(table, column string) (bool, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := dbQuery(ctx, fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if strings.EqualFold(name, column) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PoolConfig tunes the connection pool and the per-query timeout and retry
+// policy.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	QueryTimeout    time.Duration
+	MaxRetries      int
+}
+
+var pool = PoolConfig{
+	MaxOpenConns:    25,
+	MaxIdleConns:    5,
+	ConnMaxLifetime: 5 * time.Minute,
+	ConnMaxIdleTime: time.Minute,
+	QueryTimeout:    10 * time.Second,
+	MaxRetries:      2,
+}
+
+const retryBackoff = 200 * time.Millisecond
+
+func applyPoolConfig(cfg PoolConfig) {
+	if cfg.MaxOpenConns > 0 {
+		pool.MaxOpenConns = cfg.MaxOpenConns
+	}
+	if cfg.MaxIdleConns > 0 {
+		pool.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		pool.ConnMaxLifetime = cfg.ConnMaxLifetime
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		pool.ConnMaxIdleTime = cfg.ConnMaxIdleTime
+	}
+	if cfg.QueryTimeout > 0 {
+		pool.QueryTimeout = cfg.QueryTimeout
+	}
+	if cfg.MaxRetries >= 0 {
+		pool.MaxRetries = cfg.MaxRetries
+	}
+
+	maxOpen := pool.MaxOpenConns
+	if Driver == DriverSQLite {
+		// SQLite allows a single writer; serialise access instead of
+		// surfacing SQLITE_BUSY.
+		maxOpen = 1
+	}
+	DB.SetMaxOpenConns(maxOpen)
+	DB.SetMaxIdleConns(minInt(pool.MaxIdleConns, maxOpen))
+	DB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	DB.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+}
+
+func queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), pool.QueryTimeout)
+}
+
+// isTransient reports whether err is a connection-level failure worth
+// retrying, as opposed to a problem with the query itself.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "53", "57":
+			return true
+		}
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+
+	message := err.Error()
+	return strings.Contains(message, "SQLITE_BUSY") || strings.Contains(message, "database is locked")
+}
+
+// withRetry runs fn, retrying transient failures with a growing backoff while
+// ctx allows.
+func withRetry(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(); !isTransient(err) || attempt >= pool.MaxRetries {
+			return err
+		}
+		log.Printf("Database: retrying after transient error (attempt %d): %v", attempt+1, err)
+		select {
+		case <-time.After(retryBackoff * time.Duration(attempt+1)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+func dbExec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := withRetry(ctx, func() error {
+		var err error
+		result, err = DB.ExecContext(ctx, rebind(query), args...)
+		return err
+	})
+	return result, err
+}
+
+func dbQuery(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := withRetry(ctx, func() error {
+		var err error
+		rows, err = DB.QueryContext(ctx, rebind(query), args...)
+		return err
+	})
+	return rows, err
+}
+
+func dbQueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	var row *sql.Row
+	withRetry(ctx, func() error {
+		row = DB.QueryRowContext(ctx, rebind(query), args...)
+		return row.Err()
+	})
+	return row
+}
+
+// HealthStatus reports database reachability and connection pool usage.
+type HealthStatus struct {
+	Enabled      bool    `json:"enabled"`
+	Driver       string  `json:"driver,omitempty"`
+	Reachable    bool    `json:"reachable"`
+	LatencyMs    float64 `json:"latency_ms"`
+	Error        string  `json:"error,omitempty"`
+	OpenConns    int     `json:"open_connections"`
+	InUse        int     `json:"in_use"`
+	Idle         int     `json:"idle"`
+	MaxOpenConns int     `json:"max_open_connections"`
+	WaitCount    int64   `json:"wait_count"`
+	WaitMs       int64   `json:"wait_duration_ms"`
+}
+
+// Health pings the database and returns its latency and pool stats. It
+// reports Enabled false when the backend runs on in-memory storage.
+func Health() HealthStatus {
+	if DB == nil {
+		return HealthStatus{}
+	}
+
+	status := HealthStatus{Enabled: true, Driver: Driver}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	start := time.Now()
+	err := DB.PingContext(ctx)
+	status.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Reachable = true
+	}
+
+	stats := DB.Stats()
+	status.OpenConns = stats.OpenConnections
+	status.InUse = stats.InUse
+	status.Idle = stats.Idle
+	status.MaxOpenConns = stats.MaxOpenConnections
+	status.WaitCount = stats.WaitCount
+	status.WaitMs = stats.WaitDuration.Milliseconds()
+	return status
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FindingStatsRecord holds the finding aggregates behind the stats API.
+// Daily counts findings per creation day ("YYYY-MM-DD") and severity,
+// Suppressed those of them suppressed as accepted risks, and Triage lists
+// when the findings were created and triaged, all for findings created since
+// the requested time. Categories counts all findings, and
+// Targets counts the open ones per target and severity.
+type FindingStatsRecord struct {
+	Daily      map[string]map[string]int
+	Suppressed map[string]map[string]int
+	Categories map[string]int
+	Targets    map[string]map[string]int
+	Triage     []TriageRecord
+}
+
+type TriageRecord struct {
+	CreatedAt time.Time
+	TriagedAt time.Time
+}
+
+// FindingStats aggregates a workspace's findings. closedStatuses are the
+// statuses of findings that no longer count towards a target's risk.
+func FindingStats(workspaceID string, since time.Time, closedStatuses []string) (*FindingStatsRecord, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	result := &FindingStatsRecord{
+		Daily:      make(map[string]map[string]int),
+		Suppressed: make(map[string]map[string]int),
+		Categories: make(map[string]int),
+		Targets:    make(map[string]map[string]int),
+	}
+
+	rows, err := dbQuery(ctx, `SELECT SUBSTR(CAST(created_at AS TEXT), 1, 10) AS day, COALESCE(severity, ''),
+		COALESCE(status, 'new') = 'suppressed', COUNT(*)
+		FROM findings WHERE COALESCE(workspace_id, 'default') = $1 AND created_at >= $2
+		GROUP BY day, severity, COALESCE(status, 'new') = 'suppressed'`, workspaceID, since)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var day, severity string
+		var suppressed bool
+		var count int
+		if err := rows.Scan(&day, &severity, &suppressed, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if result.Daily[day] == nil {
+			result.Daily[day] = make(map[string]int)
+		}
+		result.Daily[day][severity] += count
+		if suppressed {
+			if result.Suppressed[day] == nil {
+				result.Suppressed[day] = make(map[string]int)
+			}
+			result.Suppressed[day][severity] += count
+		}
+	}
+	rows.Close()
+
+	rows, err = dbQuery(ctx, `SELECT COALESCE(category, ''), COUNT(*) FROM findings
+		WHERE COALESCE(workspace_id, 'default') = $1 GROUP BY category`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var category string
+		var count int
+		if err := rows.Scan(&category, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.Categories[category] += count
+	}
+	rows.Close()
+
+	args := []interface{}{workspaceID}
+	placeholders := make([]string, 0, len(closedStatuses))
+	for _, status := range closedStatuses {
+		args = append(args, status)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	query := `SELECT COALESCE(target, ''), COALESCE(severity, ''), COUNT(*) FROM findings
+		WHERE COALESCE(workspace_id, 'default') = $1`
+	if len(placeholders) > 0 {
+		query += " AND COALESCE(status, 'new') NOT IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	rows, err = dbQuery(ctx, query+" GROUP BY target, severity", args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var target, severity string
+		var count int
+		if err := rows.Scan(&target, &severity, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if result.Targets[target] == nil {
+			result.Targets[target] = make(map[string]int)
+		}
+		result.Targets[target][severity] += count
+	}
+	rows.Close()
+
+	rows, err = dbQuery(ctx, `SELECT created_at, triaged_at FROM findings
+		WHERE COALESCE(workspace_id, 'default') = $1 AND created_at >= $2 AND triaged_at IS NOT NULL`, workspaceID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var record TriageRecord
+		if err := rows.Scan(&record.CreatedAt, &record.TriagedAt); err != nil {
+			return nil, err
+		}
+		result.Triage = append(result.Triage, record)
+	}
+
+	return result, rows.Err()
+}
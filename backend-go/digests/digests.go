@@ -0,0 +1,291 @@
+// Package digests emails workspace recipients a summary of each operation
+// that finishes and a daily digest of the findings reported since their last
+// one, rendered from HTML templates and filtered by each recipient's
+// severity threshold.
+package digests
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"performa-backend/config"
+	"performa-backend/mailer"
+	"performa-backend/models"
+	"performa-backend/reports"
+	"performa-backend/workspaces"
+)
+
+// Kinds of email.
+const (
+	KindOperation = "operation"
+	KindDaily     = "daily"
+)
+
+const (
+	defaultDigestHour = 8
+	// maxListed bounds the findings an email lists; the rest are only
+	// counted.
+	maxListed = 50
+)
+
+// Finding is a finding as the emails list it.
+type Finding struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Severity  string    `json:"severity"`
+	Category  string    `json:"category"`
+	Target    string    `json:"target"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Operation is a finished operation and its findings, summarized for email.
+type Operation struct {
+	ID          string     `json:"id"`
+	Target      string     `json:"target"`
+	Status      string     `json:"status"`
+	Agents      int        `json:"agents"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Findings    []Finding  `json:"findings"`
+}
+
+// Email is what the templates render for one recipient. Findings are those
+// at or above the recipient's threshold, most severe first, up to maxListed;
+// Severities and Total count all of them.
+type Email struct {
+	Kind           string
+	Subject        string
+	Workspace      string
+	Recipient      *Recipient
+	Operation      *Operation
+	Since          time.Time
+	Until          time.Time
+	Findings       []Finding
+	Severities     []reports.SeverityCount
+	Total          int
+	Omitted        int
+	BelowThreshold int
+	Suppressed     int
+}
+
+// FromModel converts a stored finding.
+func FromModel(f *models.Finding) Finding {
+	return Finding{
+		ID:        f.ID,
+		Title:     f.Title,
+		Severity:  string(f.Severity),
+		Category:  f.Category,
+		Target:    f.Target,
+		Status:    f.Status,
+		CreatedAt: f.CreatedAt,
+	}
+}
+
+// newEmail fills an email's findings for the recipient, leaving out those
+// suppressed as accepted risks and those below its threshold.
+func newEmail(kind string, recipient *Recipient, findings []Finding) Email {
+	email := Email{
+		Kind:      kind,
+		Workspace: workspaceName(recipient.WorkspaceID),
+		Recipient: recipient,
+	}
+	counts := make(map[string]int)
+	var listed []Finding
+	for _, f := range findings {
+		switch {
+		case f.Status == models.FindingStatusSuppressed:
+			email.Suppressed++
+		case !recipient.includes(f.Severity):
+			email.BelowThreshold++
+		default:
+			listed = append(listed, f)
+			counts[strings.ToLower(f.Severity)]++
+		}
+	}
+	sort.SliceStable(listed, func(i, j int) bool {
+		return models.SeverityRank[models.Severity(strings.ToLower(listed[i].Severity))] >
+			models.SeverityRank[models.Severity(strings.ToLower(listed[j].Severity))]
+	})
+
+	for _, severity := range reports.Severities {
+		if recipient.includes(severity) {
+			email.Severities = append(email.Severities, reports.SeverityCount{Severity: severity, Count: counts[severity]})
+		}
+	}
+	email.Total = len(listed)
+	if len(listed) > maxListed {
+		email.Omitted = len(listed) - maxListed
+		listed = listed[:maxListed]
+	}
+	email.Findings = listed
+	return email
+}
+
+func workspaceName(id string) string {
+	if workspace := workspaces.Default.Get(id); workspace != nil && workspace.Name != "" {
+		return workspace.Name
+	}
+	return id
+}
+
+// OperationEmail is the summary of a finished operation for the recipient.
+func OperationEmail(recipient *Recipient, op Operation) Email {
+	email := newEmail(KindOperation, recipient, op.Findings)
+	email.Operation = &op
+	email.Since = op.StartedAt
+	email.Until = time.Now()
+	if op.CompletedAt != nil {
+		email.Until = *op.CompletedAt
+	}
+	email.Subject = fmt.Sprintf("[Performa] Operation on %s %s: %d finding(s)", op.Target, op.Status, email.Total)
+	return email
+}
+
+// DailyEmail is the recipient's digest of the findings of its workspace
+// reported since its last digest, or over the last day for the first one.
+func DailyEmail(recipient *Recipient, now time.Time) Email {
+	since := now.Add(-24 * time.Hour)
+	if recipient.LastDigestAt != nil {
+		since = *recipient.LastDigestAt
+	}
+	stored, _ := models.Findings.Query(models.FindingFilter{
+		WorkspaceID: recipient.WorkspaceID,
+		Since:       &since,
+		Until:       &now,
+	})
+	findings := make([]Finding, 0, len(stored))
+	for _, f := range stored {
+		findings = append(findings, FromModel(f))
+	}
+
+	email := newEmail(KindDaily, recipient, findings)
+	email.Since = since
+	email.Until = now
+	email.Subject = fmt.Sprintf("[Performa] Daily digest for %s: %d new finding(s)", email.Workspace, email.Total)
+	return email
+}
+
+// Message renders the email.
+func (e Email) Message() (mailer.Message, error) {
+	html, text, err := render(e)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	return mailer.Message{
+		To:      []string{e.Recipient.Email},
+		Subject: e.Subject,
+		HTML:    html,
+		Text:    text,
+	}, nil
+}
+
+// SendOperationSummary emails the summary of a finished operation to the
+// enabled recipients of its workspace that subscribe to them.
+func SendOperationSummary(workspaceID string, op Operation) {
+	if !mailer.Configured() {
+		return
+	}
+	for _, recipient := range Default.List(workspaceID) {
+		if !recipient.Enabled || !recipient.OperationSummaries {
+			continue
+		}
+		err := send(OperationEmail(recipient, op))
+		Default.recordDelivery(recipient.ID, false, time.Now(), err == nil, err)
+		if err != nil {
+			log.Printf("Digests: operation summary to %s failed: %v", recipient.Email, err)
+		}
+	}
+}
+
+// SendDigest emails the recipient's daily digest now, even when it lists no
+// findings, and returns how many it lists.
+func SendDigest(id string) (int, error) {
+	recipient := Default.Get(id)
+	if recipient == nil {
+		return 0, fmt.Errorf("recipient not found")
+	}
+	now := time.Now()
+	email := DailyEmail(recipient, now)
+	err := send(email)
+	Default.recordDelivery(id, true, now, err == nil, err)
+	if err != nil {
+		return 0, err
+	}
+	return email.Total, nil
+}
+
+func send(email Email) error {
+	msg, err := email.Message()
+	if err != nil {
+		return err
+	}
+	return mailer.Send(msg)
+}
+
+// digestHour returns the UTC hour daily digests go out at.
+func digestHour() int {
+	hour := config.AppConfig.DigestHour
+	if hour < 0 || hour > 23 {
+		return defaultDigestHour
+	}
+	return hour
+}
+
+// digestDue reports whether the recipient's daily digest of the day is due:
+// the digest hour has passed and no digest went out since.
+func digestDue(recipient *Recipient, now time.Time) bool {
+	if !recipient.Enabled || !recipient.DailyDigest {
+		return false
+	}
+	now = now.UTC()
+	scheduled := time.Date(now.Year(), now.Month(), now.Day(), digestHour(), 0, 0, 0, time.UTC)
+	if now.Before(scheduled) {
+		return false
+	}
+	last := recipient.CreatedAt
+	if recipient.LastDigestAt != nil {
+		last = *recipient.LastDigestAt
+	}
+	return last.Before(scheduled)
+}
+
+// flushDigests sends every daily digest that is due. A digest without
+// findings is skipped rather than sent, but still starts the next period.
+func flushDigests() {
+	if !mailer.Configured() {
+		return
+	}
+	now := time.Now()
+	for _, recipient := range Default.GetAll() {
+		if !digestDue(recipient, now) {
+			continue
+		}
+		email := DailyEmail(recipient, now)
+		if email.Total == 0 {
+			Default.recordDelivery(recipient.ID, true, now, false, nil)
+			continue
+		}
+		err := send(email)
+		Default.recordDelivery(recipient.ID, true, now, err == nil, err)
+		if err != nil {
+			log.Printf("Digests: daily digest to %s failed: %v", recipient.Email, err)
+		} else {
+			log.Printf("Digests: sent daily digest to %s with %d finding(s)", recipient.Email, email.Total)
+		}
+	}
+}
+
+// Start checks for due daily digests every interval. It blocks, so run it
+// in a goroutine.
+func Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		flushDigests()
+	}
+}
@@ -0,0 +1,248 @@
+package digests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+	"performa-backend/mailer"
+	"performa-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMinSeverity is the threshold of recipients that set none.
+const DefaultMinSeverity = "medium"
+
+// Recipient receives the email of a workspace: a summary of each operation
+// that finishes and a daily digest of new findings. Both only list findings
+// at or above MinSeverity.
+type Recipient struct {
+	ID                 string     `json:"id"`
+	WorkspaceID        string     `json:"workspace_id"`
+	Email              string     `json:"email"`
+	Name               string     `json:"name,omitempty"`
+	MinSeverity        string     `json:"min_severity"`
+	OperationSummaries bool       `json:"operation_summaries"`
+	DailyDigest        bool       `json:"daily_digest"`
+	Enabled            bool       `json:"enabled"`
+	LastDigestAt       *time.Time `json:"last_digest_at,omitempty"`
+	LastSentAt         *time.Time `json:"last_sent_at,omitempty"`
+	LastError          string     `json:"last_error,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// Validate checks the recipient's address, threshold and subscriptions.
+func (r *Recipient) Validate() error {
+	r.Email = strings.TrimSpace(r.Email)
+	r.Name = strings.TrimSpace(r.Name)
+	if !mailer.ValidAddress(r.Email) {
+		return fmt.Errorf("email must be an email address")
+	}
+	r.MinSeverity = strings.ToLower(strings.TrimSpace(r.MinSeverity))
+	if r.MinSeverity == "" {
+		r.MinSeverity = DefaultMinSeverity
+	}
+	if models.SeverityRank[models.Severity(r.MinSeverity)] == 0 {
+		return fmt.Errorf("unknown severity %q", r.MinSeverity)
+	}
+	if !r.OperationSummaries && !r.DailyDigest {
+		return fmt.Errorf("at least one of operation_summaries and daily_digest is required")
+	}
+	return nil
+}
+
+// includes reports whether a finding of the severity meets the recipient's
+// threshold.
+func (r *Recipient) includes(severity string) bool {
+	return models.SeverityRank[models.Severity(strings.ToLower(severity))] >= models.SeverityRank[models.Severity(r.MinSeverity)]
+}
+
+func (r *Recipient) clone() *Recipient {
+	copied := *r
+	return &copied
+}
+
+// Store keeps the recipients of every workspace.
+type Store struct {
+	recipients map[string]*Recipient
+	mu         sync.RWMutex
+}
+
+var Default = &Store{recipients: make(map[string]*Recipient)}
+
+func (s *Store) Create(recipient Recipient) (*Recipient, error) {
+	if err := recipient.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	recipient.ID = uuid.New().String()
+	recipient.CreatedAt = now
+	recipient.UpdatedAt = now
+	recipient.LastDigestAt = nil
+	recipient.LastSentAt = nil
+	recipient.LastError = ""
+	stored := recipient.clone()
+
+	s.mu.Lock()
+	s.recipients[stored.ID] = stored
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return stored.clone(), nil
+}
+
+func (s *Store) Get(id string) *Recipient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if recipient, ok := s.recipients[id]; ok {
+		return recipient.clone()
+	}
+	return nil
+}
+
+// List returns the workspace's recipients by address.
+func (s *Store) List(workspaceID string) []*Recipient {
+	s.mu.RLock()
+	list := make([]*Recipient, 0)
+	for _, recipient := range s.recipients {
+		if recipient.WorkspaceID == workspaceID {
+			list = append(list, recipient.clone())
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Email < list[j].Email })
+	return list
+}
+
+// GetAll returns the recipients of every workspace.
+func (s *Store) GetAll() []*Recipient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*Recipient, 0, len(s.recipients))
+	for _, recipient := range s.recipients {
+		list = append(list, recipient.clone())
+	}
+	return list
+}
+
+// Update applies fn to a copy of the recipient, validates it and stores the
+// result. It returns nil, nil when the recipient does not exist.
+func (s *Store) Update(id string, fn func(recipient *Recipient)) (*Recipient, error) {
+	s.mu.Lock()
+	existing, ok := s.recipients[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	updated := existing.clone()
+	fn(updated)
+	if err := updated.Validate(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	updated.ID = id
+	updated.WorkspaceID = existing.WorkspaceID
+	updated.LastDigestAt = existing.LastDigestAt
+	updated.LastSentAt = existing.LastSentAt
+	updated.LastError = existing.LastError
+	updated.CreatedAt = existing.CreatedAt
+	updated.UpdatedAt = time.Now()
+	s.recipients[id] = updated
+	stored := updated.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return stored, nil
+}
+
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.recipients[id]
+	delete(s.recipients, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		if err := database.DeleteEmailRecipient(id); err != nil {
+			log.Printf("Digests: failed to delete recipient %s: %v", id, err)
+		}
+	}
+	return exists
+}
+
+// recordDelivery records the outcome of an email to the recipient. A daily
+// digest moves the start of the next one to at, unless it failed.
+func (s *Store) recordDelivery(id string, digest bool, at time.Time, sent bool, err error) {
+	s.mu.Lock()
+	recipient, ok := s.recipients[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	if err != nil {
+		recipient.LastError = err.Error()
+	} else {
+		recipient.LastError = ""
+		if sent {
+			recipient.LastSentAt = &at
+		}
+		if digest {
+			recipient.LastDigestAt = &at
+		}
+	}
+	stored := recipient.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+}
+
+func (s *Store) persist(recipient *Recipient) {
+	if database.DB == nil {
+		return
+	}
+	data, err := json.Marshal(recipient)
+	if err != nil {
+		return
+	}
+	record := database.EmailRecipientRecord{
+		ID:          recipient.ID,
+		WorkspaceID: recipient.WorkspaceID,
+		Data:        data,
+		CreatedAt:   recipient.CreatedAt,
+		UpdatedAt:   recipient.UpdatedAt,
+	}
+	if err := database.SaveEmailRecipient(record); err != nil {
+		log.Printf("Digests: failed to persist recipient %s: %v", recipient.ID, err)
+	}
+}
+
+// Load restores the recipients from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+	records, err := database.GetAllEmailRecipients()
+	if err != nil {
+		log.Printf("Digests: failed to load recipients: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		var recipient Recipient
+		if err := json.Unmarshal(record.Data, &recipient); err != nil {
+			log.Printf("Digests: skipping recipient %s: %v", record.ID, err)
+			continue
+		}
+		s.recipients[recipient.ID] = &recipient
+	}
+}
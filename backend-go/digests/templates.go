@@ -0,0 +1,114 @@
+package digests
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"performa-backend/reports"
+)
+
+var funcs = map[string]interface{}{
+	"upper": strings.ToUpper,
+	"severityColor": func(severity string) string {
+		if color, ok := reports.DefaultColors[strings.ToLower(severity)]; ok {
+			return color
+		}
+		return reports.DefaultColors["info"]
+	},
+	"datetime": func(t time.Time) string { return t.UTC().Format("Jan 2, 2006 15:04 UTC") },
+	"duration": func(from, to time.Time) string { return to.Sub(from).Round(time.Second).String() },
+}
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("email").Funcs(htmltemplate.FuncMap(funcs)).Parse(htmlBody))
+	textTemplate = texttemplate.Must(texttemplate.New("email").Funcs(texttemplate.FuncMap(funcs)).Parse(textBody))
+)
+
+// render renders the email's HTML body and its plain-text alternative.
+func render(email Email) (string, string, error) {
+	var html, text bytes.Buffer
+	if err := htmlTemplate.Execute(&html, email); err != nil {
+		return "", "", err
+	}
+	if err := textTemplate.Execute(&text, email); err != nil {
+		return "", "", err
+	}
+	return html.String(), text.String(), nil
+}
+
+// The HTML body uses inline styles only, since mail clients drop style
+// sheets.
+const htmlBody = `<!DOCTYPE html>
+<html>
+<body style="margin: 0; padding: 24px; background: #f4f5f7; font-family: Helvetica, Arial, sans-serif; color: #222;">
+<table width="100%" cellpadding="0" cellspacing="0" style="max-width: 680px; margin: 0 auto; background: #fff; border-radius: 6px;">
+<tr><td style="padding: 24px;">
+  {{if .Operation}}
+  <h1 style="font-size: 20px; margin: 0 0 4px;">Operation {{.Operation.Status}}</h1>
+  <p style="margin: 0 0 16px; color: #666;">{{.Workspace}} &middot; {{.Operation.Target}}</p>
+  <table cellpadding="4" cellspacing="0" style="font-size: 14px; margin-bottom: 16px;">
+    <tr><td style="color: #666;">Started</td><td>{{datetime .Operation.StartedAt}}</td></tr>
+    {{with .Operation.CompletedAt}}<tr><td style="color: #666;">Finished</td><td>{{datetime .}} ({{duration $.Operation.StartedAt .}})</td></tr>{{end}}
+    <tr><td style="color: #666;">Agents</td><td>{{.Operation.Agents}}</td></tr>
+  </table>
+  {{else}}
+  <h1 style="font-size: 20px; margin: 0 0 4px;">Daily finding digest</h1>
+  <p style="margin: 0 0 16px; color: #666;">{{.Workspace}} &middot; {{datetime .Since}} to {{datetime .Until}}</p>
+  {{end}}
+
+  <table cellpadding="0" cellspacing="6" style="margin-bottom: 16px;">
+    <tr>
+    {{range .Severities}}
+      <td style="background: {{severityColor .Severity}}; color: #fff; border-radius: 4px; padding: 8px 12px; text-align: center; font-size: 12px;">
+        <div style="font-size: 20px; font-weight: bold;">{{.Count}}</div>{{upper .Severity}}
+      </td>
+    {{end}}
+    </tr>
+  </table>
+
+  {{if .Findings}}
+  <table width="100%" cellpadding="6" cellspacing="0" style="font-size: 14px; border-collapse: collapse;">
+    <tr style="background: #f0f1f3; text-align: left;"><th>Severity</th><th>Finding</th><th>Target</th></tr>
+    {{range .Findings}}
+    <tr style="border-bottom: 1px solid #eee;">
+      <td><span style="background: {{severityColor .Severity}}; color: #fff; border-radius: 3px; padding: 2px 6px; font-size: 11px;">{{upper .Severity}}</span></td>
+      <td>{{.Title}}{{with .Category}}<div style="color: #888; font-size: 12px;">{{.}}</div>{{end}}</td>
+      <td style="color: #555;">{{.Target}}</td>
+    </tr>
+    {{end}}
+  </table>
+  {{if .Omitted}}<p style="font-size: 13px; color: #666;">And {{.Omitted}} more.</p>{{end}}
+  {{else}}
+  <p style="font-size: 14px;">No findings at or above {{.Recipient.MinSeverity}} severity.</p>
+  {{end}}
+
+  <p style="font-size: 12px; color: #888; margin-top: 24px;">
+    {{if .BelowThreshold}}{{.BelowThreshold}} finding(s) below {{.Recipient.MinSeverity}} severity not shown. {{end}}
+    {{if .Suppressed}}{{.Suppressed}} finding(s) suppressed as accepted risks not shown. {{end}}
+    Sent by Performa to {{.Recipient.Email}}.
+  </p>
+</td></tr>
+</table>
+</body>
+</html>
+`
+
+const textBody = `{{if .Operation}}Operation {{.Operation.Status}}: {{.Operation.Target}} ({{.Workspace}})
+Started: {{datetime .Operation.StartedAt}}
+{{with .Operation.CompletedAt}}Finished: {{datetime .}} ({{duration $.Operation.StartedAt .}})
+{{end}}Agents: {{.Operation.Agents}}
+{{else}}Daily finding digest: {{.Workspace}}
+{{datetime .Since}} to {{datetime .Until}}
+{{end}}
+{{range .Severities}}{{upper .Severity}}: {{.Count}}
+{{end}}
+{{range .Findings}}[{{upper .Severity}}] {{.Title}}{{with .Target}} on {{.}}{{end}}
+{{else}}No findings at or above {{.Recipient.MinSeverity}} severity.
+{{end}}{{if .Omitted}}And {{.Omitted}} more.
+{{end}}{{if .BelowThreshold}}
+{{.BelowThreshold}} finding(s) below {{.Recipient.MinSeverity}} severity not shown.{{end}}{{if .Suppressed}}
+{{.Suppressed}} finding(s) suppressed as accepted risks not shown.{{end}}
+`
@@ -0,0 +1,229 @@
+package escalation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"performa-backend/config"
+	"performa-backend/integrations"
+	"performa-backend/models"
+)
+
+// Triggers that evaluate policies.
+const (
+	TriggerCreated  = "created"
+	TriggerUpgraded = "upgraded"
+)
+
+const issueTimeout = time.Minute
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// ErrNoDigest is returned by SendDigest for a policy without a digest action.
+var ErrNoDigest = errors.New("policy has no digest action")
+
+// Evaluate applies the matching policies to a finding that was just created
+// (previous is empty) or whose severity was raised from previous. Immediate
+// notifications and issues are sent asynchronously; digest actions queue the
+// finding. It returns the names of the policies that matched.
+func Evaluate(finding *models.Finding, previous models.Severity) []string {
+	if finding == nil {
+		return nil
+	}
+	trigger := TriggerCreated
+	if previous != "" {
+		trigger = TriggerUpgraded
+	}
+
+	matched := Default.matching(finding, previous)
+	names := make([]string, 0, len(matched))
+	for _, policy := range matched {
+		names = append(names, policy.Name)
+		for _, action := range policy.Actions {
+			switch action.Type {
+			case ActionDigest:
+				Default.queueDigest(policy.ID, finding)
+			case ActionNotify:
+				go notify(policy, action, trigger, finding)
+			case ActionIssue:
+				go fileIssue(policy, action, finding)
+			}
+		}
+	}
+	return names
+}
+
+func notify(policy *Policy, action Action, trigger string, finding *models.Finding) {
+	var payload interface{}
+	if action.Channel == ChannelSlack {
+		verb := "New"
+		if trigger == TriggerUpgraded {
+			verb = "Escalated"
+		}
+		payload = map[string]string{
+			"text": fmt.Sprintf(":rotating_light: %s %s finding: %s on %s (policy: %s)",
+				verb, strings.ToUpper(string(finding.Severity)), finding.Title, finding.Target, policy.Name),
+		}
+	} else {
+		payload = map[string]interface{}{
+			"policy":  policy.Name,
+			"trigger": trigger,
+			"finding": finding,
+		}
+	}
+	if err := post(channelURL(action), payload); err != nil {
+		log.Printf("Escalation: policy %q %s notification failed: %v", policy.Name, action.Channel, err)
+	}
+}
+
+func fileIssue(policy *Policy, action Action, finding *models.Finding) {
+	integration := integrations.Default.Get(action.IntegrationID)
+	if integration == nil {
+		log.Printf("Escalation: policy %q references unknown integration %s", policy.Name, action.IntegrationID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), issueTimeout)
+	defer cancel()
+
+	if _, _, err := integrations.Push(ctx, integration, finding); err != nil {
+		log.Printf("Escalation: policy %q failed to file issue for finding %s: %v", policy.Name, finding.ID, err)
+	}
+}
+
+// channelURL returns the action's URL, falling back to the alert webhooks
+// configured for the channel.
+func channelURL(action Action) string {
+	if action.URL != "" {
+		return action.URL
+	}
+	if action.Channel == ChannelSlack {
+		return config.AppConfig.AlertSlackWebhookURL
+	}
+	return config.AppConfig.AlertWebhookURL
+}
+
+// Post sends payload to a notification channel at url, or at the alert
+// webhook configured for the channel when url is empty.
+func Post(channel, url string, payload interface{}) error {
+	return post(channelURL(Action{Channel: channel, URL: url}), payload)
+}
+
+func post(url string, payload interface{}) error {
+	if url == "" {
+		return fmt.Errorf("no URL configured")
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// digestAction returns the policy's digest action, if it has one.
+func digestAction(policy *Policy) (Action, bool) {
+	for _, action := range policy.Actions {
+		if action.Type == ActionDigest {
+			return action, true
+		}
+	}
+	return Action{}, false
+}
+
+// digestDue reports whether the policy's digest interval has passed since it
+// was last sent, or since its oldest pending finding was queued.
+func digestDue(policy *Policy, action Action, now time.Time) bool {
+	if len(policy.Pending) == 0 {
+		return false
+	}
+	since := policy.Pending[0].QueuedAt
+	if policy.LastDigestAt != nil {
+		since = *policy.LastDigestAt
+	}
+	return now.Sub(since) >= digestIntervals[action.Interval]
+}
+
+// SendDigest sends the policy's pending findings now and returns how many
+// were sent. Findings are requeued when delivery fails.
+func SendDigest(policyID string) (int, error) {
+	policy := Default.Get(policyID)
+	if policy == nil {
+		return 0, fmt.Errorf("policy not found")
+	}
+	action, ok := digestAction(policy)
+	if !ok {
+		return 0, ErrNoDigest
+	}
+
+	items := Default.takeDigest(policyID)
+	if len(items) == 0 {
+		return 0, nil
+	}
+	err := post(channelURL(action), digestPayload(policy, action, items))
+	Default.finishDigest(policyID, items, err == nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(items), nil
+}
+
+func digestPayload(policy *Policy, action Action, items []DigestItem) interface{} {
+	if action.Channel != ChannelSlack {
+		return map[string]interface{}{
+			"policy":   policy.Name,
+			"interval": action.Interval,
+			"findings": items,
+		}
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, ":clipboard: Performa %s digest (%s): %d finding(s)", action.Interval, policy.Name, len(items))
+	for _, item := range items {
+		fmt.Fprintf(&text, "\n• [%s] %s on %s", strings.ToUpper(item.Severity), item.Title, item.Target)
+	}
+	return map[string]string{"text": text.String()}
+}
+
+// flushDigests sends every digest whose interval has passed.
+func flushDigests() {
+	now := time.Now()
+	for _, policy := range Default.GetAll() {
+		action, ok := digestAction(policy)
+		if !ok || !digestDue(policy, action, now) {
+			continue
+		}
+		if sent, err := SendDigest(policy.ID); err != nil {
+			log.Printf("Escalation: digest for policy %q failed: %v", policy.Name, err)
+		} else if sent > 0 {
+			log.Printf("Escalation: sent %s digest for policy %q with %d finding(s)", action.Interval, policy.Name, sent)
+		}
+	}
+}
+
+// StartDigests checks for due digests every interval. It blocks, so run it in
+// a goroutine.
+func StartDigests(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		flushDigests()
+	}
+}
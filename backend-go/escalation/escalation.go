@@ -0,0 +1,386 @@
+// Package escalation routes findings to notification channels, issue
+// trackers and periodic digests according to severity-based policies.
+package escalation
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+	"performa-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// Action types.
+const (
+	ActionNotify = "notify"
+	ActionIssue  = "issue"
+	ActionDigest = "digest"
+)
+
+// Notification channels.
+const (
+	ChannelSlack   = "slack"
+	ChannelWebhook = "webhook"
+)
+
+// Digest intervals.
+const (
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+)
+
+var digestIntervals = map[string]time.Duration{
+	DigestHourly: time.Hour,
+	DigestDaily:  24 * time.Hour,
+}
+
+// maxPendingDigest bounds the findings queued for one policy's digest; the
+// oldest are dropped beyond it.
+const maxPendingDigest = 500
+
+// Action is what a policy does with a matching finding: notify a channel
+// immediately, file an issue through an integration, or queue the finding for
+// the channel's next digest. URL overrides the configured Slack or webhook
+// URL for the channel.
+type Action struct {
+	Type          string `json:"type"`
+	Channel       string `json:"channel,omitempty"`
+	URL           string `json:"url,omitempty"`
+	IntegrationID string `json:"integration_id,omitempty"`
+	Interval      string `json:"interval,omitempty"`
+}
+
+// DigestItem is a finding waiting for a policy's next digest.
+type DigestItem struct {
+	FindingID string    `json:"finding_id"`
+	Title     string    `json:"title"`
+	Severity  string    `json:"severity"`
+	Target    string    `json:"target"`
+	QueuedAt  time.Time `json:"queued_at"`
+}
+
+// Policy applies its actions to findings created with, or upgraded to, one
+// of its severities, optionally only in some categories.
+type Policy struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	Enabled      bool         `json:"enabled"`
+	Severities   []string     `json:"severities"`
+	Categories   []string     `json:"categories"`
+	Actions      []Action     `json:"actions"`
+	Pending      []DigestItem `json:"pending"`
+	LastDigestAt *time.Time   `json:"last_digest_at,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// Validate checks the policy's severities and actions.
+func (p *Policy) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(p.Severities) == 0 {
+		return fmt.Errorf("at least one severity is required")
+	}
+	for i, severity := range p.Severities {
+		severity = strings.ToLower(strings.TrimSpace(severity))
+		if models.SeverityRank[models.Severity(severity)] == 0 {
+			return fmt.Errorf("unknown severity %q", p.Severities[i])
+		}
+		p.Severities[i] = severity
+	}
+	if len(p.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	for i, action := range p.Actions {
+		if err := action.validate(); err != nil {
+			return fmt.Errorf("action %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (a Action) validate() error {
+	switch a.Type {
+	case ActionNotify, ActionDigest:
+		if a.Channel != ChannelSlack && a.Channel != ChannelWebhook {
+			return fmt.Errorf("channel must be %q or %q", ChannelSlack, ChannelWebhook)
+		}
+		if a.Type == ActionDigest {
+			if _, ok := digestIntervals[a.Interval]; !ok {
+				return fmt.Errorf("interval must be %q or %q", DigestHourly, DigestDaily)
+			}
+		}
+	case ActionIssue:
+		if a.IntegrationID == "" {
+			return fmt.Errorf("integration_id is required")
+		}
+	default:
+		return fmt.Errorf("type must be one of %s, %s, %s", ActionNotify, ActionIssue, ActionDigest)
+	}
+	return nil
+}
+
+// matches reports whether the policy applies to finding. On an upgrade the
+// policy only fires when the previous severity was outside its severities,
+// so a finding is escalated once per policy. Findings suppressed as accepted
+// risks are not escalated.
+func (p *Policy) matches(finding *models.Finding, previous models.Severity) bool {
+	if !p.Enabled || finding.Status == models.FindingStatusSuppressed || !containsFold(p.Severities, string(finding.Severity)) {
+		return false
+	}
+	if previous != "" && containsFold(p.Severities, string(previous)) {
+		return false
+	}
+	return len(p.Categories) == 0 || containsFold(p.Categories, finding.Category)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) clone() *Policy {
+	copied := *p
+	copied.Severities = append([]string{}, p.Severities...)
+	copied.Categories = append([]string{}, p.Categories...)
+	copied.Actions = append([]Action{}, p.Actions...)
+	copied.Pending = append([]DigestItem{}, p.Pending...)
+	return &copied
+}
+
+type Store struct {
+	policies map[string]*Policy
+	mu       sync.RWMutex
+}
+
+var Default = &Store{
+	policies: make(map[string]*Policy),
+}
+
+func (s *Store) Create(policy Policy) (*Policy, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	policy.ID = uuid.New().String()
+	policy.Pending = nil
+	policy.LastDigestAt = nil
+	policy.CreatedAt = now
+	policy.UpdatedAt = now
+	stored := policy.clone()
+
+	s.mu.Lock()
+	s.policies[stored.ID] = stored
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return stored.clone(), nil
+}
+
+func (s *Store) Get(id string) *Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if policy, ok := s.policies[id]; ok {
+		return policy.clone()
+	}
+	return nil
+}
+
+// GetAll returns the policies sorted by name.
+func (s *Store) GetAll() []*Policy {
+	s.mu.RLock()
+	all := make([]*Policy, 0, len(s.policies))
+	for _, policy := range s.policies {
+		all = append(all, policy.clone())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool { return strings.ToLower(all[i].Name) < strings.ToLower(all[j].Name) })
+	return all
+}
+
+// Update applies fn to a copy of the policy, validates it and stores the
+// result. It returns nil, nil when the policy does not exist.
+func (s *Store) Update(id string, fn func(policy *Policy) error) (*Policy, error) {
+	s.mu.Lock()
+	existing, ok := s.policies[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	updated := existing.clone()
+	if err := fn(updated); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if err := updated.Validate(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	updated.ID = id
+	updated.Pending = existing.Pending
+	updated.LastDigestAt = existing.LastDigestAt
+	updated.UpdatedAt = time.Now()
+	s.policies[id] = updated
+	stored := updated.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return stored, nil
+}
+
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.policies[id]
+	delete(s.policies, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		database.DeleteEscalationPolicy(id)
+	}
+	return exists
+}
+
+// matching returns the enabled policies that apply to finding.
+func (s *Store) matching(finding *models.Finding, previous models.Severity) []*Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := make([]*Policy, 0)
+	for _, policy := range s.policies {
+		if policy.matches(finding, previous) {
+			matched = append(matched, policy.clone())
+		}
+	}
+	return matched
+}
+
+// queueDigest adds finding to the policy's pending digest.
+func (s *Store) queueDigest(policyID string, finding *models.Finding) {
+	s.mu.Lock()
+	policy, ok := s.policies[policyID]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	for _, item := range policy.Pending {
+		if item.FindingID == finding.ID {
+			s.mu.Unlock()
+			return
+		}
+	}
+	policy.Pending = append(policy.Pending, DigestItem{
+		FindingID: finding.ID,
+		Title:     finding.Title,
+		Severity:  string(finding.Severity),
+		Target:    finding.Target,
+		QueuedAt:  time.Now(),
+	})
+	if len(policy.Pending) > maxPendingDigest {
+		policy.Pending = policy.Pending[len(policy.Pending)-maxPendingDigest:]
+	}
+	stored := policy.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+}
+
+// takeDigest empties the policy's pending digest and returns what it held.
+func (s *Store) takeDigest(policyID string) []DigestItem {
+	s.mu.Lock()
+	policy, ok := s.policies[policyID]
+	if !ok || len(policy.Pending) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	items := policy.Pending
+	policy.Pending = nil
+	stored := policy.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return items
+}
+
+// finishDigest records the outcome of sending items: on success the digest
+// time is updated, on failure the items are put back ahead of anything queued
+// since.
+func (s *Store) finishDigest(policyID string, items []DigestItem, sent bool) {
+	s.mu.Lock()
+	policy, ok := s.policies[policyID]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	if sent {
+		now := time.Now()
+		policy.LastDigestAt = &now
+	} else {
+		policy.Pending = append(append([]DigestItem{}, items...), policy.Pending...)
+		if len(policy.Pending) > maxPendingDigest {
+			policy.Pending = policy.Pending[len(policy.Pending)-maxPendingDigest:]
+		}
+	}
+	stored := policy.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+}
+
+func (s *Store) persist(policy *Policy) {
+	if database.DB == nil {
+		return
+	}
+
+	data, _ := json.Marshal(policy)
+	record := database.EscalationPolicyRecord{
+		ID:        policy.ID,
+		Name:      policy.Name,
+		Data:      data,
+		CreatedAt: policy.CreatedAt,
+		UpdatedAt: policy.UpdatedAt,
+	}
+	if err := database.SaveEscalationPolicy(record); err != nil {
+		log.Printf("Escalation: failed to persist policy %s: %v", policy.ID, err)
+	}
+}
+
+// Load restores policies, and their pending digests, from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllEscalationPolicies()
+	if err != nil {
+		log.Printf("Escalation: failed to load policies: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		var policy Policy
+		if err := json.Unmarshal(record.Data, &policy); err != nil {
+			log.Printf("Escalation: skipping invalid policy %s: %v", record.ID, err)
+			continue
+		}
+		policy.ID = record.ID
+		s.policies[record.ID] = policy.clone()
+	}
+}
@@ -0,0 +1,30 @@
+package executor
+
+import "performa-backend/stealth"
+
+// captureEnv returns the environment that sends a web tool's traffic through
+// the request's capture proxy, or nil when it is not captured: the request
+// has no capture proxy, the tool is not a web tool that honours the proxy
+// environment, or it runs in a Docker sandbox, which cannot reach the
+// proxy's loopback address.
+func captureEnv(req Request, cfg SandboxConfig) []string {
+	if req.CaptureProxy == "" || req.Category != "web_scanning" || len(req.Args) == 0 ||
+		!stealth.ProxyAware(req.Args[0]) || cfg.Backend == BackendDocker {
+		return nil
+	}
+
+	env := []string{
+		"HTTP_PROXY=" + req.CaptureProxy, "http_proxy=" + req.CaptureProxy,
+		"HTTPS_PROXY=" + req.CaptureProxy, "https_proxy=" + req.CaptureProxy,
+		"ALL_PROXY=", "all_proxy=",
+		"NO_PROXY=", "no_proxy=",
+	}
+	if req.CaptureCA != "" {
+		env = append(env,
+			"SSL_CERT_FILE="+req.CaptureCA,
+			"CURL_CA_BUNDLE="+req.CaptureCA,
+			"REQUESTS_CA_BUNDLE="+req.CaptureCA,
+		)
+	}
+	return env
+}
@@ -0,0 +1,244 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"performa-backend/stealth"
+	"performa-backend/tools"
+)
+
+// maxOutputBytes caps how much of each stream is kept per command.
+const maxOutputBytes = 64 * 1024
+
+// Request describes a single tool invocation. Args[0] is the tool binary.
+// Owner (usually an agent ID) attributes the process for resource accounting.
+// Category, Offline and RawNetwork only apply to the Docker backend: they
+// pick the image, cut the container off the network, and grant raw socket
+// capabilities. Templates pins nuclei runs to those template files, which
+// live under TemplatesDir. Wordlists are the wordlist files the arguments
+// name, given to sandboxed runs read-only. CaptureProxy, when set, is the capture proxy URL
+// web tools send their traffic through, trusting the CA in CaptureCA.
+// Limits caps the run's resources; Waiting, when set, is told when the run
+// starts and stops waiting for a slot under Limits.MaxConcurrent.
+type Request struct {
+	Owner        string
+	Args         []string
+	Timeout      time.Duration
+	Route        *stealth.Route
+	Pacer        *stealth.Pacer
+	Fingerprint  *stealth.Fingerprinter
+	Category     string
+	Offline      bool
+	RawNetwork   bool
+	Templates    []string
+	TemplatesDir string
+	Wordlists    []string
+	CaptureProxy string
+	CaptureCA    string
+	Limits       Limits
+	Waiting      func(waiting bool)
+}
+
+type Result struct {
+	Command    string    `json:"command"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	ExitCode   int       `json:"exit_code"`
+	DurationMs int64     `json:"duration_ms"`
+	Truncated  bool      `json:"truncated"`
+	Routed     bool      `json:"routed"`
+	Captured   bool      `json:"captured"`
+	Sandboxed  bool      `json:"sandboxed"`
+	CPUSeconds float64   `json:"cpu_seconds"`
+	PacedMs    int64     `json:"paced_ms"`
+	StartedAt  time.Time `json:"started_at"`
+	Error      string    `json:"error,omitempty"`
+	// Limit is the resource limit the run was killed for, if any.
+	Limit string `json:"limit,omitempty"`
+}
+
+// limitedBuffer keeps the first maxOutputBytes written and drops the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	remaining := maxOutputBytes - b.buf.Len()
+	if remaining <= 0 {
+		b.truncated = true
+		return len(p), nil
+	}
+	if len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Run executes the tool directly (no shell), applying the request's stealth
+// route. It always returns a Result; failures are reported in Result.Error.
+func Run(ctx context.Context, req Request) *Result {
+	result := &Result{
+		Command:   strings.Join(req.Args, " "),
+		StartedAt: time.Now(),
+		ExitCode:  -1,
+	}
+	if len(req.Args) == 0 {
+		result.Error = "empty command"
+		return result
+	}
+	if goos := OS(); !tools.SupportedOn(req.Args[0], goos) {
+		result.Error = fmt.Sprintf("%s is not available on %s", req.Args[0], goos)
+		return result
+	}
+
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
+	}
+
+	release, err := acquireSlot(ctx, req.Owner, req.Limits.MaxConcurrent, req.Waiting)
+	if err != nil {
+		result.Error = "concurrency limit wait aborted: " + err.Error()
+		return result
+	}
+	defer release()
+
+	waitStart := time.Now()
+	if err := req.Pacer.Wait(ctx); err != nil {
+		result.Error = "rate limit wait aborted: " + err.Error()
+		return result
+	}
+	result.PacedMs = time.Since(waitStart).Milliseconds()
+
+	args := applyTemplates(applyRateLimit(req.Args, req.Pacer.Limit()), req.Templates)
+	args = applyFingerprint(args, req.Fingerprint)
+	result.Command = strings.Join(args, " ")
+
+	cfg := sandboxConfig()
+	route, captureVars := req.Route, captureEnv(req, cfg)
+	if captureVars != nil {
+		// The capture proxy forwards along the route itself.
+		route = nil
+	}
+	argv, env, cleanup, err := route.Wrap(args)
+	defer cleanup()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	env = append(env, captureVars...)
+	result.Routed = req.Route.Enabled()
+	result.Captured = captureVars != nil
+
+	var container string
+	if cfg.Backend == BackendDocker {
+		argv, container = sandboxCommand(cfg, req, argv, env)
+		env = nil
+		result.Sandboxed = true
+	}
+
+	var stdout, stderr limitedBuffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	runStart := time.Now()
+	err = cmd.Start()
+	if err == nil {
+		pid := int32(cmd.Process.Pid)
+		trackStart(req.Owner, pid)
+		stopWatching := watchLimits(pid, req.Limits)
+		err = cmd.Wait()
+		result.Limit = stopWatching()
+		var cpuSeconds float64
+		if cmd.ProcessState != nil {
+			cpuSeconds = (cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()).Seconds()
+		}
+		trackExit(req.Owner, pid, cpuSeconds)
+		result.CPUSeconds = cpuSeconds
+	}
+	if container != "" && ctx.Err() != nil {
+		killContainer(container)
+	}
+	result.DurationMs = time.Since(runStart).Milliseconds()
+	result.Stdout = stdout.buf.String()
+	result.Stderr = stderr.buf.String()
+	result.Truncated = stdout.truncated || stderr.truncated
+
+	var exitErr *exec.ExitError
+	switch {
+	case result.Limit != "":
+		result.Error = limitError(result.Limit, req.Limits)
+	case err == nil:
+		result.ExitCode = 0
+	case ctx.Err() == context.DeadlineExceeded:
+		result.Error = fmt.Sprintf("timed out after %s", req.Timeout)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// ParseCommandLine splits a command line into arguments, honouring single and
+// double quotes and backslash escapes. Shell operators are rejected because
+// commands are never run through a shell.
+func ParseCommandLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg, escaped := false, false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		case strings.ContainsRune("|;&<>`$", r):
+			return nil, fmt.Errorf("shell operator %q is not supported", r)
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return args, nil
+}
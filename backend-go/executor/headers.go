@@ -0,0 +1,64 @@
+package executor
+
+import (
+	"strings"
+
+	"performa-backend/stealth"
+)
+
+// headerFlags maps HTTP tools to the flag that adds one request header, and
+// userAgentFlags to their dedicated User-Agent flags, which are checked so
+// that a User-Agent chosen by the command itself is kept.
+var (
+	headerFlags = map[string]string{
+		"curl":     "-H",
+		"httpx":    "-H",
+		"nuclei":   "-H",
+		"ffuf":     "-H",
+		"gobuster": "-H",
+		"wget":     "--header",
+	}
+	userAgentFlags = map[string][]string{
+		"curl":     {"-A", "--user-agent"},
+		"gobuster": {"-a", "--useragent"},
+		"wget":     {"-U", "--user-agent"},
+	}
+)
+
+// applyFingerprint adds the session fingerprint's headers to an HTTP tool's
+// command line, skipping headers the command already sets. Each invocation
+// counts as one request towards the fingerprint's rotation.
+func applyFingerprint(args []string, fingerprinter *stealth.Fingerprinter) []string {
+	if fingerprinter == nil || len(args) == 0 {
+		return args
+	}
+	flag, ok := headerFlags[args[0]]
+	if !ok {
+		return args
+	}
+
+	set := make(map[string]bool)
+	for i, arg := range args[1:] {
+		for _, uaFlag := range userAgentFlags[args[0]] {
+			if arg == uaFlag || strings.HasPrefix(arg, uaFlag+"=") {
+				set["user-agent"] = true
+			}
+		}
+		if arg == flag && i+2 < len(args) {
+			name := strings.SplitN(args[i+2], ":", 2)[0]
+			set[strings.ToLower(strings.TrimSpace(name))] = true
+		} else if strings.HasPrefix(arg, flag+"=") {
+			name := strings.SplitN(strings.TrimPrefix(arg, flag+"="), ":", 2)[0]
+			set[strings.ToLower(strings.TrimSpace(name))] = true
+		}
+	}
+
+	headers := fingerprinter.Next()
+	result := append(make([]string, 0, len(args)+2*len(headers)), args...)
+	for _, name := range stealth.SortedHeaderNames(headers) {
+		if !set[strings.ToLower(name)] {
+			result = append(result, flag, name+": "+headers[name])
+		}
+	}
+	return result
+}
@@ -0,0 +1,169 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// Limits caps a tool run; zero leaves a limit off. CPUSeconds and MemoryMB
+// apply to the run's process tree, which is killed when it goes over either.
+// MaxConcurrent caps the runs of the request's owner at a time: a run over it
+// waits for one of the others to finish.
+type Limits struct {
+	CPUSeconds    float64
+	MemoryMB      int
+	MaxConcurrent int
+}
+
+// Limit names identify the limit that stopped a run in Result.Limit.
+const (
+	LimitCPU    = "cpu"
+	LimitMemory = "memory"
+)
+
+const limitSampleInterval = 250 * time.Millisecond
+
+var (
+	activeRuns = make(map[string]int)
+	// runFinished is closed and replaced whenever a run gives back its slot.
+	runFinished = make(chan struct{})
+	slotsMu     sync.Mutex
+)
+
+// acquireSlot waits until owner has fewer than max runs going and claims a
+// slot for another. waiting, when set, is called with true if the run has to
+// wait and with false once it got its slot.
+func acquireSlot(ctx context.Context, owner string, max int, waiting func(bool)) (func(), error) {
+	if owner == "" || max <= 0 {
+		return func() {}, nil
+	}
+
+	queued := false
+	for {
+		slotsMu.Lock()
+		if activeRuns[owner] < max {
+			activeRuns[owner]++
+			slotsMu.Unlock()
+			if queued && waiting != nil {
+				waiting(false)
+			}
+			return func() { releaseSlot(owner) }, nil
+		}
+		finished := runFinished
+		slotsMu.Unlock()
+
+		if !queued && waiting != nil {
+			waiting(true)
+		}
+		queued = true
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			if waiting != nil {
+				waiting(false)
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func releaseSlot(owner string) {
+	slotsMu.Lock()
+	defer slotsMu.Unlock()
+
+	if activeRuns[owner]--; activeRuns[owner] <= 0 {
+		delete(activeRuns, owner)
+	}
+	close(runFinished)
+	runFinished = make(chan struct{})
+}
+
+// watchLimits samples the process tree of pid and kills it once it goes over
+// the CPU or memory limit. The returned function stops watching and returns
+// the limit the tree went over, if any.
+func watchLimits(pid int32, limits Limits) func() string {
+	if limits.CPUSeconds <= 0 && limits.MemoryMB <= 0 {
+		return func() string { return "" }
+	}
+
+	done := make(chan struct{})
+	exceeded := make(chan string, 1)
+	go func() {
+		ticker := time.NewTicker(limitSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				exceeded <- ""
+				return
+			case <-ticker.C:
+			}
+
+			tree := ProcessTree(pid)
+			var cpuSeconds float64
+			var rss uint64
+			for _, p := range tree {
+				if times, err := p.Times(); err == nil {
+					cpuSeconds += times.User + times.System
+				}
+				if mem, err := p.MemoryInfo(); err == nil {
+					rss += mem.RSS
+				}
+			}
+
+			limit := ""
+			switch {
+			case limits.CPUSeconds > 0 && cpuSeconds > limits.CPUSeconds:
+				limit = LimitCPU
+			case limits.MemoryMB > 0 && rss > uint64(limits.MemoryMB)*1024*1024:
+				limit = LimitMemory
+			}
+			if limit != "" {
+				for _, p := range tree {
+					p.Kill()
+				}
+				<-done
+				exceeded <- limit
+				return
+			}
+		}
+	}()
+
+	return func() string {
+		close(done)
+		return <-exceeded
+	}
+}
+
+// ProcessTree returns the process and all of its descendants; tools such as
+// nmap or proxychains-wrapped commands do their work in child processes.
+func ProcessTree(pid int32) []*process.Process {
+	root, err := process.NewProcess(pid)
+	if err != nil {
+		return nil
+	}
+
+	tree := []*process.Process{root}
+	for i := 0; i < len(tree); i++ {
+		children, err := tree[i].Children()
+		if err != nil {
+			continue
+		}
+		tree = append(tree, children...)
+	}
+	return tree
+}
+
+func limitError(limit string, limits Limits) string {
+	switch limit {
+	case LimitCPU:
+		return fmt.Sprintf("killed after using more than its %.1f CPU seconds", limits.CPUSeconds)
+	case LimitMemory:
+		return fmt.Sprintf("killed after using more than %d MB of memory", limits.MemoryMB)
+	}
+	return "killed by a resource limit"
+}
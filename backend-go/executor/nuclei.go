@@ -0,0 +1,46 @@
+package executor
+
+import "strings"
+
+// nucleiSelectionFlags are the nuclei flags that choose templates, mapped to
+// whether they take a value.
+var nucleiSelectionFlags = map[string]bool{
+	"-t": true, "-templates": true,
+	"-w": true, "-workflows": true,
+	"-tags": true, "-id": true, "-template-id": true,
+	"-s": true, "-severity": true,
+	"-tu": true, "-template-url": true,
+	"-wu": true, "-workflow-url": true,
+	"-nt": false, "-new-templates": false,
+	"-as": false, "-automatic-scan": false,
+}
+
+// applyTemplates pins a nuclei command to templates: the command's own
+// template selection flags are dropped, each template is passed with -t and
+// template updates are disabled, so that the run uses exactly those files.
+// Other commands, and nuclei without templates, are left unchanged.
+func applyTemplates(args []string, templates []string) []string {
+	if len(templates) == 0 || len(args) == 0 || args[0] != "nuclei" {
+		return args
+	}
+
+	result := make([]string, 0, len(args)+2*len(templates)+1)
+	result = append(result, args[0])
+	for i := 1; i < len(args); i++ {
+		name := strings.SplitN(args[i], "=", 2)[0]
+		takesValue, selects := nucleiSelectionFlags[strings.Replace(name, "--", "-", 1)]
+		if !selects {
+			result = append(result, args[i])
+			continue
+		}
+		if takesValue && !strings.Contains(args[i], "=") {
+			i++
+		}
+	}
+
+	result = append(result, "-duc")
+	for _, template := range templates {
+		result = append(result, "-t", template)
+	}
+	return result
+}
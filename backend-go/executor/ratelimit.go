@@ -0,0 +1,45 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rateFlags maps tools that send many requests per invocation to the flag that
+// caps their own request rate. The pacer only spaces out invocations, so these
+// flags keep the traffic inside a single run within the operation's limit.
+var rateFlags = map[string]func(rps int) []string{
+	"nmap":    func(rps int) []string { return []string{"--max-rate", fmt.Sprint(rps)} },
+	"masscan": func(rps int) []string { return []string{"--rate", fmt.Sprint(rps)} },
+	"naabu":   func(rps int) []string { return []string{"-rate", fmt.Sprint(rps)} },
+	"nuclei":  func(rps int) []string { return []string{"-rl", fmt.Sprint(rps)} },
+	"httpx":   func(rps int) []string { return []string{"-rl", fmt.Sprint(rps)} },
+	"dnsx":    func(rps int) []string { return []string{"-rl", fmt.Sprint(rps)} },
+	"ffuf":    func(rps int) []string { return []string{"-rate", fmt.Sprint(rps)} },
+	"wpscan":  func(rps int) []string { return []string{"--throttle", fmt.Sprint(1000 / rps)} },
+	"sqlmap":  func(rps int) []string { return []string{fmt.Sprintf("--delay=%.3f", 1/float64(rps))} },
+}
+
+// applyRateLimit appends the tool's rate flag unless the command already sets
+// it. rps <= 0 leaves the command unchanged.
+func applyRateLimit(args []string, rps int) []string {
+	if rps <= 0 || len(args) == 0 {
+		return args
+	}
+	flags, ok := rateFlags[args[0]]
+	if !ok {
+		return args
+	}
+
+	extra := flags(rps)
+	name := strings.SplitN(extra[0], "=", 2)[0]
+	for _, arg := range args[1:] {
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return args
+		}
+	}
+
+	result := make([]string, 0, len(args)+len(extra))
+	result = append(result, args...)
+	return append(result, extra...)
+}
@@ -0,0 +1,182 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/tools"
+
+	"github.com/google/uuid"
+)
+
+// Execution backends.
+const (
+	BackendLocal  = "local"
+	BackendDocker = "docker"
+)
+
+// ownerLabel tags sandbox containers with the owner that started them so they
+// can be found and killed.
+const ownerLabel = "performa.owner"
+
+// SandboxConfig configures the Docker execution backend. Images maps a tool
+// category to the image its tools run in; other tools use DefaultImage.
+type SandboxConfig struct {
+	Backend      string
+	DefaultImage string
+	Images       map[string]string
+	CPUs         float64
+	MemoryMB     int
+	PidsLimit    int
+	Network      string
+}
+
+var (
+	sandbox   = SandboxConfig{Backend: BackendLocal}
+	sandboxMu sync.RWMutex
+)
+
+// Configure selects the execution backend for subsequent runs.
+func Configure(cfg SandboxConfig) error {
+	if cfg.Backend == "" {
+		cfg.Backend = BackendLocal
+	}
+	switch cfg.Backend {
+	case BackendLocal:
+	case BackendDocker:
+		if cfg.DefaultImage == "" {
+			return fmt.Errorf("docker backend needs a default image")
+		}
+		if _, err := exec.LookPath("docker"); err != nil {
+			return fmt.Errorf("docker backend selected but docker is not installed")
+		}
+	default:
+		return fmt.Errorf("unknown execution backend %q", cfg.Backend)
+	}
+
+	sandboxMu.Lock()
+	sandbox = cfg
+	sandboxMu.Unlock()
+	return nil
+}
+
+// Backend returns the execution backend in use.
+func Backend() string {
+	sandboxMu.RLock()
+	defer sandboxMu.RUnlock()
+	return sandbox.Backend
+}
+
+// OS returns the operating system tools run on: Linux inside the Docker
+// sandbox images, this host's otherwise.
+func OS() string {
+	if Backend() == BackendDocker {
+		return "linux"
+	}
+	return tools.HostOS()
+}
+
+func sandboxConfig() SandboxConfig {
+	sandboxMu.RLock()
+	defer sandboxMu.RUnlock()
+	return sandbox
+}
+
+// sandboxCommand wraps argv, as returned by the stealth route, in a docker run
+// of an ephemeral container. A proxychains config file the route wrote is
+// mounted read-only at the same path so the wrapper works inside the
+// container. It returns the docker argv and the container's name.
+func sandboxCommand(cfg SandboxConfig, req Request, argv, env []string) ([]string, string) {
+	name := "performa-" + uuid.New().String()[:12]
+	args := []string{
+		"docker", "run", "--rm", "--init",
+		"--name", name,
+		"--label", ownerLabel + "=" + req.Owner,
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+	}
+	if cfg.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(cfg.CPUs, 'f', -1, 64))
+	}
+	// The container's processes are not children of the docker client, so a
+	// run's memory limit is left to the container's.
+	memoryMB := cfg.MemoryMB
+	if limit := req.Limits.MemoryMB; limit > 0 && (memoryMB <= 0 || limit < memoryMB) {
+		memoryMB = limit
+	}
+	if memoryMB > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%dm", memoryMB))
+	}
+	if cfg.PidsLimit > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(cfg.PidsLimit))
+	}
+
+	switch {
+	case req.Offline:
+		args = append(args, "--network", "none")
+	case cfg.Network != "":
+		args = append(args, "--network", cfg.Network)
+	}
+	if req.RawNetwork && !req.Offline {
+		args = append(args, "--cap-add", "NET_RAW", "--cap-add", "NET_ADMIN")
+	}
+
+	for _, value := range env {
+		args = append(args, "-e", value)
+	}
+	if len(req.Templates) > 0 && req.TemplatesDir != "" {
+		args = append(args, "-v", req.TemplatesDir+":"+req.TemplatesDir+":ro")
+	}
+	for _, path := range req.Wordlists {
+		args = append(args, "-v", path+":"+path+":ro")
+	}
+
+	if len(argv) > 0 && argv[0] != req.Args[0] && strings.HasPrefix(filepath.Base(argv[0]), "proxychains") {
+		argv = append([]string{filepath.Base(argv[0])}, argv[1:]...)
+		for i := 0; i+1 < len(argv); i++ {
+			if argv[i] == "-f" {
+				args = append(args, "-v", argv[i+1]+":"+argv[i+1]+":ro")
+				break
+			}
+		}
+	}
+
+	image := cfg.Images[req.Category]
+	if image == "" {
+		image = cfg.DefaultImage
+	}
+	args = append(args, image)
+	return append(args, argv...), name
+}
+
+// killContainer stops a sandbox container whose docker client was killed,
+// e.g. on timeout, which would otherwise leave the container running.
+func killContainer(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exec.CommandContext(ctx, "docker", "kill", name).Run()
+}
+
+// killOwnerContainers stops every sandbox container started for owner and
+// returns how many there were.
+func killOwnerContainers(owner string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "docker", "ps", "-q", "--filter", "label="+ownerLabel+"="+owner).Output()
+	if err != nil {
+		return 0
+	}
+	ids := strings.Fields(string(output))
+	if len(ids) == 0 {
+		return 0
+	}
+	exec.CommandContext(ctx, "docker", append([]string{"kill"}, ids...)...).Run()
+	return len(ids)
+}
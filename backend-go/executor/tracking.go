@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"os"
+	"sync"
+)
+
+// Usage accumulates the cost of an owner's finished tool processes.
+type Usage struct {
+	Runs       int     `json:"runs"`
+	CPUSeconds float64 `json:"cpu_seconds"`
+}
+
+var (
+	running   = make(map[string]map[int32]struct{})
+	finished  = make(map[string]*Usage)
+	trackerMu sync.RWMutex
+)
+
+func trackStart(owner string, pid int32) {
+	if owner == "" {
+		return
+	}
+	trackerMu.Lock()
+	defer trackerMu.Unlock()
+
+	if running[owner] == nil {
+		running[owner] = make(map[int32]struct{})
+	}
+	running[owner][pid] = struct{}{}
+}
+
+func trackExit(owner string, pid int32, cpuSeconds float64) {
+	if owner == "" {
+		return
+	}
+	trackerMu.Lock()
+	defer trackerMu.Unlock()
+
+	delete(running[owner], pid)
+	if len(running[owner]) == 0 {
+		delete(running, owner)
+	}
+	if finished[owner] == nil {
+		finished[owner] = &Usage{}
+	}
+	finished[owner].Runs++
+	finished[owner].CPUSeconds += cpuSeconds
+}
+
+// Processes returns the PIDs of the owner's tool processes still running.
+func Processes(owner string) []int32 {
+	trackerMu.RLock()
+	defer trackerMu.RUnlock()
+
+	pids := make([]int32, 0, len(running[owner]))
+	for pid := range running[owner] {
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+// FinishedUsage returns the totals of the owner's completed tool processes.
+func FinishedUsage(owner string) Usage {
+	trackerMu.RLock()
+	defer trackerMu.RUnlock()
+
+	if usage := finished[owner]; usage != nil {
+		return *usage
+	}
+	return Usage{}
+}
+
+// Forget drops all accounting for owner.
+func Forget(owner string) {
+	trackerMu.Lock()
+	defer trackerMu.Unlock()
+	delete(running, owner)
+	delete(finished, owner)
+}
+
+// Kill terminates the owner's running tool processes, and their sandbox
+// containers under the Docker backend, and returns how many were signalled.
+func Kill(owner string) int {
+	killed := 0
+	for _, pid := range Processes(owner) {
+		if proc, err := os.FindProcess(int(pid)); err == nil && proc.Kill() == nil {
+			killed++
+		}
+	}
+	if Backend() == BackendDocker {
+		killOwnerContainers(owner)
+	}
+	return killed
+}
@@ -0,0 +1,203 @@
+// Package failures classifies the errors agents run into and decides, by
+// the retry policy of each class, whether to retry with a backoff, switch to
+// a fallback, or fail fast. Policies are set globally and can be overridden
+// per operation.
+package failures
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"performa-backend/openrouter"
+)
+
+// Error classes.
+const (
+	ProviderRateLimit = "provider_rate_limit"
+	ProviderAuth      = "provider_auth"
+	ToolTimeout       = "tool_timeout"
+	ToolMissing       = "tool_missing"
+	BrainUnavailable  = "brain_unavailable"
+	ContextOverflow   = "context_overflow"
+	Unknown           = "unknown"
+)
+
+// Classes lists the error classes in the order they are reported.
+var Classes = []string{ProviderRateLimit, ProviderAuth, ToolTimeout, ToolMissing, BrainUnavailable, ContextOverflow, Unknown}
+
+// Policy actions.
+const (
+	ActionRetry    = "retry"
+	ActionFail     = "fail"
+	ActionFallback = "fallback"
+)
+
+// maxBackoff bounds the delay between retries.
+const maxBackoff = time.Hour
+
+// Policy is what happens on an error of a class. A retry waits
+// BackoffSeconds, doubling on each attempt up to MaxBackoffSeconds, and gives
+// up after MaxRetries. A fallback switches a model call to FallbackModel, or
+// an operation's strategy to the Brain's cached one; it is not available for
+// tool errors.
+type Policy struct {
+	Action            string  `json:"action"`
+	MaxRetries        int     `json:"max_retries,omitempty"`
+	BackoffSeconds    float64 `json:"backoff_seconds,omitempty"`
+	MaxBackoffSeconds float64 `json:"max_backoff_seconds,omitempty"`
+	FallbackModel     string  `json:"fallback_model,omitempty"`
+}
+
+// Policies maps error classes to their policies.
+type Policies map[string]Policy
+
+// Defaults are the policies of the classes no global policy is set for.
+var Defaults = Policies{
+	ProviderRateLimit: {Action: ActionRetry, MaxRetries: 5, BackoffSeconds: 10, MaxBackoffSeconds: 300},
+	ProviderAuth:      {Action: ActionFail},
+	ToolTimeout:       {Action: ActionRetry, MaxRetries: 1, BackoffSeconds: 5},
+	ToolMissing:       {Action: ActionFail},
+	BrainUnavailable:  {Action: ActionRetry, MaxRetries: 2, BackoffSeconds: 2, MaxBackoffSeconds: 10},
+	ContextOverflow:   {Action: ActionFail},
+	Unknown:           {Action: ActionFail},
+}
+
+// Known reports whether class names an error class.
+func Known(class string) bool {
+	_, ok := Defaults[class]
+	return ok
+}
+
+// Validate checks the policy is usable for the class.
+func (p *Policy) Validate(class string) error {
+	p.Action = strings.ToLower(strings.TrimSpace(p.Action))
+	p.FallbackModel = strings.TrimSpace(p.FallbackModel)
+	switch p.Action {
+	case ActionRetry:
+		if p.MaxRetries < 1 {
+			return fmt.Errorf("max_retries must be at least 1")
+		}
+		if p.BackoffSeconds < 0 || p.MaxBackoffSeconds < 0 {
+			return fmt.Errorf("backoff must not be negative")
+		}
+		if p.MaxBackoffSeconds > 0 && p.MaxBackoffSeconds < p.BackoffSeconds {
+			return fmt.Errorf("max_backoff_seconds must not be less than backoff_seconds")
+		}
+	case ActionFallback:
+		switch class {
+		case ToolTimeout, ToolMissing:
+			return fmt.Errorf("%s errors have no fallback", class)
+		case BrainUnavailable:
+		default:
+			if p.FallbackModel == "" {
+				return fmt.Errorf("fallback_model is required")
+			}
+		}
+	case ActionFail:
+	default:
+		return fmt.Errorf("action must be %q, %q or %q", ActionRetry, ActionFail, ActionFallback)
+	}
+	return nil
+}
+
+// Validate checks every policy names a known class and is usable for it.
+func (p Policies) Validate() error {
+	for class, policy := range p {
+		if !Known(class) {
+			return fmt.Errorf("unknown error class %q", class)
+		}
+		if err := policy.Validate(class); err != nil {
+			return fmt.Errorf("%s: %v", class, err)
+		}
+		p[class] = policy
+	}
+	return nil
+}
+
+// Backoff returns the delay before the given retry, counted from 1.
+func (p Policy) Backoff(retry int) time.Duration {
+	delay := time.Duration(p.BackoffSeconds * float64(time.Second))
+	limit := maxBackoff
+	if p.MaxBackoffSeconds > 0 {
+		limit = time.Duration(p.MaxBackoffSeconds * float64(time.Second))
+	}
+	for i := 1; i < retry && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// Resolve returns the policy of class: the operation's override, else the
+// global policy.
+func Resolve(class string, overrides Policies) Policy {
+	if policy, ok := overrides[class]; ok {
+		return policy
+	}
+	return Default.Get(class)
+}
+
+// Failure is an error an agent ran into, classified, with what its policy
+// did about it.
+type Failure struct {
+	Class   string    `json:"class"`
+	Message string    `json:"message"`
+	Action  string    `json:"action"`
+	Attempt int       `json:"attempt"`
+	Model   string    `json:"model,omitempty"`
+	Command string    `json:"command,omitempty"`
+	RetryIn float64   `json:"retry_in_seconds,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Classify returns the class of an agent's error.
+func Classify(err error) string {
+	if err == nil {
+		return Unknown
+	}
+	if errors.Is(err, openrouter.ErrRateLimited) {
+		return ProviderRateLimit
+	}
+	return ClassifyMessage(err.Error())
+}
+
+// classifiers map phrases of error messages to their class, checked in
+// order.
+var classifiers = []struct {
+	class   string
+	phrases []string
+}{
+	{ContextOverflow, []string{"context length", "context_length", "context window", "maximum context", "too many tokens", "prompt is too long", "status 413"}},
+	{ProviderRateLimit, []string{"rate limit", "status 429", "too many requests"}},
+	{ProviderAuth, []string{"api key rejected", "invalid api key", "no auth credentials", "unauthorized", "status 401", "status 403", "insufficient credits", "status 402"}},
+	{ToolTimeout, []string{"timed out after"}},
+	{ToolMissing, []string{"executable file not found", "command not found", "is not available on", "no such file or directory"}},
+	{BrainUnavailable, []string{"brain service", "brain unavailable"}},
+}
+
+// ClassifyMessage returns the class of an error from its message.
+func ClassifyMessage(message string) string {
+	message = strings.ToLower(message)
+	for _, classifier := range classifiers {
+		for _, phrase := range classifier.phrases {
+			if strings.Contains(message, phrase) {
+				return classifier.class
+			}
+		}
+	}
+	return Unknown
+}
+
+// ClassifyTool returns the class of a tool run's error. Only tool classes
+// apply: a tool's output may well mention rate limits or credentials.
+func ClassifyTool(message string) string {
+	switch class := ClassifyMessage(message); class {
+	case ToolTimeout, ToolMissing:
+		return class
+	}
+	return Unknown
+}
@@ -0,0 +1,113 @@
+package failures
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+)
+
+// Store keeps the global retry policies set over the defaults.
+type Store struct {
+	policies Policies
+	mu       sync.RWMutex
+}
+
+var Default = &Store{policies: make(Policies)}
+
+// Get returns the global policy of class.
+func (s *Store) Get(class string) Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if policy, ok := s.policies[class]; ok {
+		return policy
+	}
+	if policy, ok := Defaults[class]; ok {
+		return policy
+	}
+	return Defaults[Unknown]
+}
+
+// All returns the global policy of every class and the classes whose policy
+// was set rather than defaulted.
+func (s *Store) All() (Policies, []string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make(Policies, len(Defaults))
+	custom := make([]string, 0)
+	for _, class := range Classes {
+		if policy, ok := s.policies[class]; ok {
+			all[class] = policy
+			custom = append(custom, class)
+		} else {
+			all[class] = Defaults[class]
+		}
+	}
+	return all, custom
+}
+
+// Set validates and stores the global policy of class.
+func (s *Store) Set(class string, policy Policy) (Policy, error) {
+	if !Known(class) {
+		return Policy{}, fmt.Errorf("unknown error class %q", class)
+	}
+	if err := policy.Validate(class); err != nil {
+		return Policy{}, err
+	}
+
+	s.mu.Lock()
+	s.policies[class] = policy
+	s.mu.Unlock()
+
+	if database.DB != nil {
+		data, _ := json.Marshal(policy)
+		record := database.RetryPolicyRecord{Class: class, Data: data, UpdatedAt: time.Now()}
+		if err := database.SaveRetryPolicy(record); err != nil {
+			log.Printf("Failures: failed to persist %s policy: %v", class, err)
+		}
+	}
+	return policy, nil
+}
+
+// Reset returns class to its default policy.
+func (s *Store) Reset(class string) {
+	s.mu.Lock()
+	delete(s.policies, class)
+	s.mu.Unlock()
+
+	if database.DB != nil {
+		if err := database.DeleteRetryPolicy(class); err != nil {
+			log.Printf("Failures: failed to delete %s policy: %v", class, err)
+		}
+	}
+}
+
+// Load restores the global policies from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+	records, err := database.GetAllRetryPolicies()
+	if err != nil {
+		log.Printf("Failures: failed to load retry policies: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		var policy Policy
+		if err := json.Unmarshal(record.Data, &policy); err != nil {
+			log.Printf("Failures: skipping %s policy: %v", record.Class, err)
+			continue
+		}
+		if !Known(record.Class) || policy.Validate(record.Class) != nil {
+			log.Printf("Failures: skipping invalid %s policy", record.Class)
+			continue
+		}
+		s.policies[record.Class] = policy
+	}
+}
@@ -0,0 +1,448 @@
+// Package graph lays out how an operation unfolded as nodes and edges a UI
+// can render: the agents it launched, the tools they ran, the assets those
+// tools touched and the findings reported on them.
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"performa-backend/assets"
+)
+
+// Node types.
+const (
+	NodeOperation = "operation"
+	NodeAgent     = "agent"
+	NodeTool      = "tool"
+	NodeAsset     = "asset"
+	NodeFinding   = "finding"
+)
+
+// Edge types. An asset no tool command named is linked to the agent that
+// targeted it, or else to the operation; a finding on no known asset is
+// linked to the agent that reported it.
+const (
+	EdgeLaunched   = "launched"
+	EdgeRan        = "ran"
+	EdgeDiscovered = "discovered"
+	EdgeTargeted   = "targeted"
+	EdgeObserved   = "observed"
+	EdgeExposes    = "exposes"
+	EdgeReported   = "reported"
+)
+
+// Phase is a strategy phase of an agent and when it ran. A phase still
+// running has no end.
+type Phase struct {
+	Name        string
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+}
+
+// Agent is an agent of the operation with the targets it was given.
+type Agent struct {
+	ID      string
+	Name    string
+	Role    string
+	Status  string
+	Targets []string
+	Phases  []Phase
+}
+
+// ToolRun is one tool command an agent ran.
+type ToolRun struct {
+	AgentID  string
+	Tool     string
+	Command  string
+	ExitCode int
+	Failed   bool
+	At       time.Time
+}
+
+// Asset is a host the operation observed.
+type Asset struct {
+	ID          string
+	Name        string
+	Kind        string
+	Identifiers []string
+	Ports       []int
+}
+
+// Finding is a finding an agent of the operation reported.
+type Finding struct {
+	ID        string
+	AgentID   string
+	Title     string
+	Severity  string
+	Status    string
+	Target    string
+	CreatedAt time.Time
+}
+
+// Input is what the graph is built from.
+type Input struct {
+	OperationID string
+	Target      string
+	Status      string
+	Agents      []Agent
+	ToolRuns    []ToolRun
+	Assets      []Asset
+	Findings    []Finding
+}
+
+// Filter narrows the graph. Severities keeps the findings of those
+// severities and only what leads to them; Phase keeps the tool runs and
+// findings of the strategy phase of that name. Empty fields match everything.
+type Filter struct {
+	Severities []string
+	Phase      string
+}
+
+func (f Filter) active() bool {
+	return len(f.Severities) > 0 || f.Phase != ""
+}
+
+// Node is a vertex of the graph. IDs are prefixed with the node type so
+// that they are unique across types.
+type Node struct {
+	ID    string                 `json:"id"`
+	Type  string                 `json:"type"`
+	Label string                 `json:"label"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+}
+
+// Edge is a directed link between two nodes.
+type Edge struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+	// Weight counts the tool runs an edge stands for.
+	Weight int `json:"weight,omitempty"`
+}
+
+// Graph is the operation's graph, with the number of nodes of each type.
+type Graph struct {
+	OperationID string         `json:"operation_id"`
+	Nodes       []Node         `json:"nodes"`
+	Edges       []Edge         `json:"edges"`
+	Counts      map[string]int `json:"counts"`
+}
+
+func nodeID(kind, id string) string {
+	return kind + ":" + id
+}
+
+// builder accumulates nodes and edges, merging repeats.
+type builder struct {
+	nodes map[string]*Node
+	order []string
+	edges map[string]*Edge
+}
+
+func (b *builder) node(id, kind, label string) *Node {
+	if node, ok := b.nodes[id]; ok {
+		return node
+	}
+	node := &Node{ID: id, Type: kind, Label: label, Data: map[string]interface{}{}}
+	b.nodes[id] = node
+	b.order = append(b.order, id)
+	return node
+}
+
+func (b *builder) edge(source, target, kind string, weight int) {
+	id := source + "->" + target
+	if edge, ok := b.edges[id]; ok {
+		edge.Weight += weight
+		return
+	}
+	b.edges[id] = &Edge{ID: id, Source: source, Target: target, Type: kind, Weight: weight}
+}
+
+// hostsOf returns the hosts a tool command or finding target names.
+func hostsOf(value string) []string {
+	var hosts []string
+	for _, field := range strings.Fields(value) {
+		// Flags carry their value after "=", e.g. --url=https://host.
+		if i := strings.Index(field, "="); i >= 0 && strings.HasPrefix(field, "-") {
+			field = field[i+1:]
+		}
+		field = strings.Trim(field, `"',;`)
+		if host, _, ok := assets.NormalizeHost(field); ok {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// phaseAt returns the name of the agent's phase running at t, or "".
+func phaseAt(agent *Agent, t time.Time) string {
+	if agent == nil {
+		return ""
+	}
+	for _, phase := range agent.Phases {
+		if phase.StartedAt == nil || t.Before(*phase.StartedAt) {
+			continue
+		}
+		if phase.CompletedAt == nil || !t.After(*phase.CompletedAt) {
+			return phase.Name
+		}
+	}
+	return ""
+}
+
+// Build lays out the graph of an operation.
+func Build(in Input, filter Filter) Graph {
+	b := &builder{nodes: make(map[string]*Node), edges: make(map[string]*Edge)}
+	severities := make(map[string]bool, len(filter.Severities))
+	for _, severity := range filter.Severities {
+		severities[strings.ToLower(severity)] = true
+	}
+
+	root := nodeID(NodeOperation, in.OperationID)
+	b.node(root, NodeOperation, in.Target).Data["status"] = in.Status
+
+	agents := make(map[string]*Agent, len(in.Agents))
+	for i := range in.Agents {
+		agent := &in.Agents[i]
+		agents[agent.ID] = agent
+		if filter.Phase != "" && !hasPhase(agent, filter.Phase) {
+			continue
+		}
+		label := agent.Name
+		if agent.Role != "" {
+			label = fmt.Sprintf("%s (%s)", agent.Name, agent.Role)
+		}
+		node := b.node(nodeID(NodeAgent, agent.ID), NodeAgent, label)
+		node.Data["agent_id"] = agent.ID
+		node.Data["role"] = agent.Role
+		node.Data["status"] = agent.Status
+		b.edge(root, node.ID, EdgeLaunched, 0)
+	}
+
+	byHost := make(map[string]string)
+	for _, asset := range in.Assets {
+		for _, identifier := range asset.Identifiers {
+			byHost[strings.ToLower(identifier)] = nodeID(NodeAsset, asset.ID)
+		}
+	}
+	reached := make(map[string]bool)
+
+	for _, run := range in.ToolRuns {
+		agent := agents[run.AgentID]
+		phase := phaseAt(agent, run.At)
+		if filter.Phase != "" && !strings.EqualFold(phase, filter.Phase) {
+			continue
+		}
+		agentNode := nodeID(NodeAgent, run.AgentID)
+		if _, ok := b.nodes[agentNode]; !ok {
+			continue
+		}
+
+		tool := b.node(nodeID(NodeTool, run.AgentID+":"+run.Tool), NodeTool, run.Tool)
+		tool.Data["tool"] = run.Tool
+		tool.Data["agent_id"] = run.AgentID
+		tool.Data["runs"] = intData(tool.Data["runs"]) + 1
+		if run.Failed {
+			tool.Data["failures"] = intData(tool.Data["failures"]) + 1
+		}
+		tool.Data["last_command"] = run.Command
+		tool.Data["last_exit_code"] = run.ExitCode
+		tool.Data["last_run_at"] = run.At
+		if phase != "" {
+			tool.Data["phases"] = addPhase(tool.Data["phases"], phase)
+		}
+		b.edge(agentNode, tool.ID, EdgeRan, 1)
+
+		for _, host := range hostsOf(run.Command) {
+			if asset, ok := byHost[host]; ok {
+				b.edge(tool.ID, asset, EdgeDiscovered, 1)
+				reached[asset] = true
+			}
+		}
+	}
+
+	for _, asset := range in.Assets {
+		id := nodeID(NodeAsset, asset.ID)
+		node := b.node(id, NodeAsset, asset.Name)
+		node.Data["asset_id"] = asset.ID
+		node.Data["kind"] = asset.Kind
+		if len(asset.Ports) > 0 {
+			node.Data["ports"] = asset.Ports
+		}
+		if reached[id] {
+			continue
+		}
+		if agentNode := targetingAgent(in.Agents, asset, b); agentNode != "" {
+			b.edge(agentNode, id, EdgeTargeted, 0)
+		} else {
+			b.edge(root, id, EdgeObserved, 0)
+		}
+	}
+
+	for _, finding := range in.Findings {
+		if len(severities) > 0 && !severities[strings.ToLower(finding.Severity)] {
+			continue
+		}
+		phase := phaseAt(agents[finding.AgentID], finding.CreatedAt)
+		if filter.Phase != "" && !strings.EqualFold(phase, filter.Phase) {
+			continue
+		}
+		node := b.node(nodeID(NodeFinding, finding.ID), NodeFinding, finding.Title)
+		node.Data["finding_id"] = finding.ID
+		node.Data["severity"] = finding.Severity
+		node.Data["status"] = finding.Status
+		node.Data["target"] = finding.Target
+		node.Data["agent_id"] = finding.AgentID
+		if phase != "" {
+			node.Data["phase"] = phase
+		}
+
+		attached := false
+		for _, host := range hostsOf(finding.Target) {
+			if asset, ok := byHost[host]; ok {
+				b.edge(asset, node.ID, EdgeExposes, 0)
+				attached = true
+				break
+			}
+		}
+		if agentNode := nodeID(NodeAgent, finding.AgentID); !attached {
+			if _, ok := b.nodes[agentNode]; ok {
+				b.edge(agentNode, node.ID, EdgeReported, 0)
+			} else {
+				b.edge(root, node.ID, EdgeReported, 0)
+			}
+		}
+	}
+
+	if filter.active() {
+		b.prune(root, filter)
+	}
+	return b.graph(in.OperationID)
+}
+
+// prune drops what the filter left disconnected. With a severity filter only
+// the paths to the remaining findings are kept; with a phase filter the
+// assets no remaining tool run or finding touched go as well.
+func (b *builder) prune(root string, filter Filter) {
+	keep := make(map[string]bool)
+	if len(filter.Severities) > 0 {
+		// Walk back from the findings to the root.
+		incoming := make(map[string][]string)
+		for _, edge := range b.edges {
+			incoming[edge.Target] = append(incoming[edge.Target], edge.Source)
+		}
+		queue := make([]string, 0)
+		for id, node := range b.nodes {
+			if node.Type == NodeFinding {
+				queue = append(queue, id)
+			}
+		}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			if keep[id] {
+				continue
+			}
+			keep[id] = true
+			queue = append(queue, incoming[id]...)
+		}
+	} else {
+		for id, node := range b.nodes {
+			if node.Type != NodeAsset {
+				keep[id] = true
+			}
+		}
+		for _, edge := range b.edges {
+			if b.nodes[edge.Target].Type == NodeAsset && edge.Type == EdgeDiscovered {
+				keep[edge.Target] = true
+			}
+			if b.nodes[edge.Target].Type == NodeFinding && b.nodes[edge.Source].Type == NodeAsset {
+				keep[edge.Source] = true
+			}
+		}
+	}
+
+	keep[root] = true
+	for id := range b.nodes {
+		if !keep[id] {
+			delete(b.nodes, id)
+		}
+	}
+	for id, edge := range b.edges {
+		if b.nodes[edge.Source] == nil || b.nodes[edge.Target] == nil {
+			delete(b.edges, id)
+		}
+	}
+}
+
+func (b *builder) graph(operationID string) Graph {
+	g := Graph{
+		OperationID: operationID,
+		Nodes:       make([]Node, 0, len(b.nodes)),
+		Edges:       make([]Edge, 0, len(b.edges)),
+		Counts:      make(map[string]int),
+	}
+	for _, id := range b.order {
+		if node, ok := b.nodes[id]; ok {
+			g.Nodes = append(g.Nodes, *node)
+			g.Counts[node.Type]++
+		}
+	}
+	for _, edge := range b.edges {
+		g.Edges = append(g.Edges, *edge)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool { return g.Edges[i].ID < g.Edges[j].ID })
+	g.Counts["edges"] = len(g.Edges)
+	return g
+}
+
+// targetingAgent returns the node of an agent in the graph whose targets
+// include the asset, or "".
+func targetingAgent(agents []Agent, asset Asset, b *builder) string {
+	for _, agent := range agents {
+		id := nodeID(NodeAgent, agent.ID)
+		if _, ok := b.nodes[id]; !ok {
+			continue
+		}
+		for _, target := range agent.Targets {
+			host, _, ok := assets.NormalizeHost(target)
+			if !ok {
+				continue
+			}
+			for _, identifier := range asset.Identifiers {
+				if strings.EqualFold(host, identifier) {
+					return id
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func hasPhase(agent *Agent, name string) bool {
+	for _, phase := range agent.Phases {
+		if strings.EqualFold(phase.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func intData(value interface{}) int {
+	n, _ := value.(int)
+	return n
+}
+
+func addPhase(value interface{}, phase string) []string {
+	phases, _ := value.([]string)
+	for _, existing := range phases {
+		if existing == phase {
+			return phases
+		}
+	}
+	return append(phases, phase)
+}
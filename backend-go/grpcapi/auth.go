@@ -0,0 +1,141 @@
+package grpcapi
+
+import (
+	"context"
+	"strings"
+
+	"performa-backend/auth"
+	"performa-backend/config"
+	"performa-backend/workspaces"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys carrying a call's credentials and workspace, the same as
+// the REST headers.
+const (
+	authorizationMetadata = "authorization"
+	apiKeyMetadata        = "x-api-key"
+	workspaceMetadata     = "x-workspace-id"
+)
+
+type callerKey struct{}
+
+// caller is who made a gRPC call: a user when authentication is enabled, a
+// workspace API key, or nobody when authentication is disabled. Workspace is
+// the workspace the call works in.
+type caller struct {
+	claims    *auth.Claims
+	apiKey    string // workspace of the API key
+	workspace string
+}
+
+// authenticate checks the credentials of a call like handlers.Authenticate
+// does for REST requests: an API key in x-api-key always, and an access token
+// in authorization when AUTH_ENABLED is set. It then selects the workspace of
+// x-workspace-id like handlers.ResolveWorkspace.
+func authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var who caller
+
+	if key := firstMetadata(md, apiKeyMetadata); key != "" {
+		workspace := workspaces.Default.ResolveAPIKey(key)
+		if workspace == nil {
+			return nil, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+		who.apiKey = workspace.ID
+	} else if config.AppConfig.AuthEnabled {
+		token := firstMetadata(md, authorizationMetadata)
+		if !strings.HasPrefix(token, "Bearer ") {
+			return nil, status.Error(codes.Unauthenticated, "authentication required")
+		}
+		claims, err := auth.Verify(strings.TrimSpace(strings.TrimPrefix(token, "Bearer ")), auth.TokenAccess)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "authentication required")
+		}
+		who.claims = claims
+	}
+
+	requested := firstMetadata(md, workspaceMetadata)
+	if requested == "" && who.apiKey != "" {
+		requested = who.apiKey
+	}
+	workspace := workspaces.Default.Get(requested)
+	if workspace == nil {
+		return nil, status.Error(codes.NotFound, "workspace not found")
+	}
+	if !who.canAccess(workspace) {
+		return nil, status.Error(codes.PermissionDenied, "access to this workspace is not allowed")
+	}
+	who.workspace = workspace.ID
+
+	return context.WithValue(ctx, callerKey{}, who), nil
+}
+
+// canAccess reports whether the caller may work in a workspace: an API key
+// only reaches its own, and users other than admins only the workspaces they
+// are members of.
+func (who caller) canAccess(workspace *workspaces.Workspace) bool {
+	if who.apiKey != "" {
+		return workspace.ID == who.apiKey
+	}
+	if who.claims != nil && !who.claims.IsAdmin() {
+		return workspace.HasMember(who.claims.UserID())
+	}
+	return true
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+func callerOf(ctx context.Context) caller {
+	who, _ := ctx.Value(callerKey{}).(caller)
+	return who
+}
+
+// callerWorkspace returns the workspace a call works in.
+func callerWorkspace(ctx context.Context) string {
+	return workspaces.Normalize(callerOf(ctx).workspace)
+}
+
+// callerUserID returns the ID recorded as the owner of resources a call
+// creates, or "" when it was not made by a user.
+func callerUserID(ctx context.Context) string {
+	if claims := callerOf(ctx).claims; claims != nil {
+		return claims.UserID()
+	}
+	return ""
+}
+
+func unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func streamAuth(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+// authenticatedStream carries the caller in its context.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
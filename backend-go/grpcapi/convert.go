@@ -0,0 +1,78 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"time"
+
+	"performa-backend/models"
+	performav1 "performa-backend/proto/performa/v1"
+	"performa-backend/ws"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toAgent(agent *models.Agent) *performav1.Agent {
+	return &performav1.Agent{
+		Id:             agent.ID,
+		Name:           agent.Name,
+		Role:           agent.Role,
+		Status:         string(agent.Status),
+		Target:         agent.Target,
+		Model:          agent.Model,
+		CreatedAt:      timestamppb.New(agent.CreatedAt),
+		UpdatedAt:      timestamppb.New(agent.UpdatedAt),
+		TaskCount:      int32(agent.TaskCount),
+		Findings:       int32(agent.Findings),
+		CurrentTask:    agent.CurrentTask,
+		Progress:       int32(agent.Progress),
+		OperationId:    agent.OperationID,
+		ElapsedSeconds: agent.ElapsedSeconds,
+		Usage: &performav1.AgentUsage{
+			LlmCalls:       int32(agent.Usage.LLMCalls),
+			LlmLatencyMs:   agent.Usage.LLMLatencyMs,
+			BytesSent:      agent.Usage.BytesSent,
+			BytesReceived:  agent.Usage.BytesReceived,
+			ToolRuns:       int32(agent.Usage.ToolRuns),
+			ToolCpuSeconds: agent.Usage.ToolCPUSeconds,
+		},
+	}
+}
+
+func toFinding(finding *models.Finding) *performav1.Finding {
+	return &performav1.Finding{
+		Id:            finding.ID,
+		Title:         finding.Title,
+		Description:   finding.Description,
+		Severity:      string(finding.Severity),
+		Category:      finding.Category,
+		Target:        finding.Target,
+		Evidence:      finding.Evidence,
+		AgentId:       finding.AgentID,
+		CreatedAt:     timestamppb.New(finding.CreatedAt),
+		Status:        finding.Status,
+		CvssVector:    finding.CVSSVector,
+		CvssScore:     finding.CVSSScore,
+		CweId:         finding.CWE,
+		OwaspCategory: finding.OWASP,
+	}
+}
+
+func toAgentEvent(msg ws.WSMessage) *performav1.AgentEvent {
+	event := &performav1.AgentEvent{
+		Type:         msg.Type,
+		AgentId:      msg.AgentID,
+		Status:       msg.Status,
+		Message:      msg.Message,
+		CpuUsage:     msg.CPU,
+		MemoryUsage:  msg.Memory,
+		DiskUsage:    msg.Disk,
+		NetworkUsage: msg.Network,
+		ReceivedAt:   timestamppb.New(time.Now()),
+	}
+	if msg.Data != nil {
+		if data, err := json.Marshal(msg.Data); err == nil {
+			event.DataJson = string(data)
+		}
+	}
+	return event
+}
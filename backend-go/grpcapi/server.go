@@ -0,0 +1,284 @@
+// Package grpcapi serves the gRPC API defined in proto/performa/v1 alongside
+// the Fiber HTTP server. Handlers delegate to the same code paths as their
+// REST counterparts so both APIs behave identically.
+package grpcapi
+
+//go:generate protoc -I ../proto --go_out=../proto --go_opt=paths=source_relative --go-grpc_out=../proto --go-grpc_opt=paths=source_relative performa/v1/performa.proto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+
+	"performa-backend/executor"
+	"performa-backend/handlers"
+	"performa-backend/models"
+	performav1 "performa-backend/proto/performa/v1"
+	"performa-backend/stealth"
+	"performa-backend/ws"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Serve listens on addr and serves the gRPC API until the listener fails.
+// Calls are authenticated like REST requests, from their metadata, and only
+// reach the agents and findings of the workspace they select.
+func Serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(unaryAuth),
+		grpc.StreamInterceptor(streamAuth),
+	)
+	performav1.RegisterOperationServiceServer(server, &operationService{})
+	performav1.RegisterAgentServiceServer(server, &agentService{})
+	performav1.RegisterFindingServiceServer(server, &findingService{})
+	reflection.Register(server)
+
+	log.Printf("gRPC API listening on %s", addr)
+	return server.Serve(lis)
+}
+
+type operationService struct {
+	performav1.UnimplementedOperationServiceServer
+}
+
+func (s *operationService) StartOperation(ctx context.Context, req *performav1.StartOperationRequest) (*performav1.StartOperationResponse, error) {
+	if req.GetTarget() == "" && len(req.GetTargets()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "target is required")
+	}
+
+	start := models.StartRequest{
+		Target:           req.GetTarget(),
+		Category:         req.GetCategory(),
+		Model:            req.GetModel(),
+		AgentCount:       int(req.GetAgentCount()),
+		Instructions:     req.GetInstructions(),
+		Mode:             req.GetMode(),
+		StealthMode:      req.GetStealthMode(),
+		AggressiveLevel:  int(req.GetAggressiveLevel()),
+		RequestedTools:   req.GetRequestedTools(),
+		AllowedToolsOnly: req.GetAllowedToolsOnly(),
+		OSType:           req.GetOsType(),
+		Roles:            req.GetRoles(),
+		UseStrategy:      req.GetUseStrategy(),
+		Credentials:      req.GetCredentials(),
+		Targets:          req.GetTargets(),
+		TargetAllocation: req.GetTargetAllocation(),
+		WorkspaceID:      callerWorkspace(ctx),
+	}
+	if req.GetExecutionDuration() > 0 {
+		duration := int(req.GetExecutionDuration())
+		start.ExecutionDuration = &duration
+	}
+
+	op, agents, err := handlers.LaunchOperation(start, "grpc")
+	if err != nil {
+		var invalid *handlers.StartError
+		if errors.As(err, &invalid) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	models.Operations.SetOwner(op.ID, callerUserID(ctx))
+
+	resp := &performav1.StartOperationResponse{OperationId: op.ID}
+	for _, agent := range agents {
+		resp.Agents = append(resp.Agents, toAgent(agent))
+	}
+	return resp, nil
+}
+
+type agentService struct {
+	performav1.UnimplementedAgentServiceServer
+}
+
+// CreateAgent registers an idle agent. It runs nothing by itself; operations
+// started with StartOperation launch agents that do.
+func (s *agentService) CreateAgent(ctx context.Context, req *performav1.CreateAgentRequest) (*performav1.Agent, error) {
+	model := req.GetModel()
+	if model == "" {
+		model = "openai/gpt-4-turbo"
+	}
+
+	agent := models.Manager.CreateAgent("Agent", "security-scanner", req.GetTarget(), model)
+	models.Manager.SetAgentWorkspace(agent.ID, callerWorkspace(ctx))
+	return toAgent(models.Manager.GetAgent(agent.ID)), nil
+}
+
+// workspaceAgent returns an agent of the caller's workspace. An agent of
+// another workspace is reported as not found, like one that does not exist.
+func workspaceAgent(ctx context.Context, id string) (*models.Agent, error) {
+	agent := models.Manager.GetAgent(id)
+	if agent == nil || handlers.AgentWorkspace(id) != callerWorkspace(ctx) {
+		return nil, status.Error(codes.NotFound, "agent not found")
+	}
+	return agent, nil
+}
+
+func (s *agentService) GetAgent(ctx context.Context, req *performav1.GetAgentRequest) (*performav1.Agent, error) {
+	agent, err := workspaceAgent(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return toAgent(agent), nil
+}
+
+func (s *agentService) ListAgents(ctx context.Context, req *performav1.ListAgentsRequest) (*performav1.ListAgentsResponse, error) {
+	resp := &performav1.ListAgentsResponse{}
+	workspace := callerWorkspace(ctx)
+	for _, agent := range models.Manager.GetAllAgents() {
+		if handlers.AgentWorkspace(agent.ID) != workspace {
+			continue
+		}
+		if req.GetOperationId() != "" && agent.OperationID != req.GetOperationId() {
+			continue
+		}
+		if req.GetStatus() != "" && string(agent.Status) != req.GetStatus() {
+			continue
+		}
+		resp.Agents = append(resp.Agents, toAgent(agent))
+	}
+	resp.Total = int32(len(resp.Agents))
+	return resp, nil
+}
+
+func (s *agentService) DeleteAgent(ctx context.Context, req *performav1.DeleteAgentRequest) (*performav1.DeleteAgentResponse, error) {
+	if _, err := workspaceAgent(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	if !models.Manager.DeleteAgent(req.GetId()) {
+		return nil, status.Error(codes.NotFound, "agent not found")
+	}
+	executor.Forget(req.GetId())
+	stealth.ForgetFingerprinter(req.GetId())
+	return &performav1.DeleteAgentResponse{}, nil
+}
+
+func (s *agentService) PauseAgent(ctx context.Context, req *performav1.PauseAgentRequest) (*performav1.Agent, error) {
+	if _, err := workspaceAgent(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	if !models.Manager.PauseAgent(req.GetId()) {
+		return nil, status.Error(codes.FailedPrecondition, "cannot pause agent")
+	}
+	ws.BroadcastAgentUpdate(req.GetId(), "paused", "Agent paused")
+	handlers.RecordOperatorAction(models.Manager.GetAgent(req.GetId()), "pause", nil)
+	return toAgent(models.Manager.GetAgent(req.GetId())), nil
+}
+
+func (s *agentService) ResumeAgent(ctx context.Context, req *performav1.ResumeAgentRequest) (*performav1.Agent, error) {
+	if _, err := workspaceAgent(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	if err := handlers.CheckBlackout(req.GetId()); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Message)
+	}
+	if !models.Manager.ResumeAgent(req.GetId()) {
+		return nil, status.Error(codes.FailedPrecondition, "cannot resume agent")
+	}
+	ws.BroadcastAgentUpdate(req.GetId(), "resumed", "Agent resumed")
+	handlers.RecordOperatorAction(models.Manager.GetAgent(req.GetId()), "resume", nil)
+	return toAgent(models.Manager.GetAgent(req.GetId())), nil
+}
+
+// AgentEvents relays the WebSocket feed of the caller's workspace. Like
+// WebSocket clients, a stream that falls behind misses events rather than
+// slowing the hub down.
+func (s *agentService) AgentEvents(req *performav1.AgentEventsRequest, stream performav1.AgentService_AgentEventsServer) error {
+	events, cancel := ws.MainHub.Listen()
+	defer cancel()
+	workspace := callerWorkspace(stream.Context())
+
+	types := make(map[string]bool, len(req.GetTypes()))
+	for _, t := range req.GetTypes() {
+		types[t] = true
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case data, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			var msg ws.WSMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			if owner := ws.MessageWorkspace(msg); owner != "" && owner != workspace {
+				continue
+			}
+			if len(types) > 0 && !types[msg.Type] {
+				continue
+			}
+			if req.GetAgentId() != "" && msg.AgentID != req.GetAgentId() {
+				continue
+			}
+
+			if err := stream.Send(toAgentEvent(msg)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type findingService struct {
+	performav1.UnimplementedFindingServiceServer
+}
+
+// QueryFindings searches the findings of the caller's workspace.
+func (s *findingService) QueryFindings(ctx context.Context, req *performav1.QueryFindingsRequest) (*performav1.QueryFindingsResponse, error) {
+	filter := models.FindingFilter{
+		WorkspaceID: callerWorkspace(ctx),
+		Category:    req.GetCategory(),
+		Target:      req.GetTarget(),
+		AgentID:     req.GetAgentId(),
+		Status:      req.GetStatus(),
+		Search:      req.GetSearch(),
+		SortBy:      req.GetSortBy(),
+		SortDesc:    !req.GetSortAsc(),
+		Limit:       int(req.GetLimit()),
+		Offset:      int(req.GetOffset()),
+	}
+	for _, severity := range req.GetSeverities() {
+		filter.Severities = append(filter.Severities, models.Severity(severity))
+	}
+	if req.GetSince() != nil {
+		since := req.GetSince().AsTime()
+		filter.Since = &since
+	}
+	if req.GetUntil() != nil {
+		until := req.GetUntil().AsTime()
+		filter.Until = &until
+	}
+	if err := handlers.NormalizeFindingFilter(&filter); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	findings, total, summary, err := handlers.QueryFindings(filter)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &performav1.QueryFindingsResponse{
+		Total:           int32(total),
+		SeveritySummary: make(map[string]int32, len(summary)),
+	}
+	for _, finding := range findings {
+		resp.Findings = append(resp.Findings, toFinding(finding))
+	}
+	for severity, count := range summary {
+		resp.SeveritySummary[severity] = int32(count)
+	}
+	return resp, nil
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"performa-backend/apierror"
+	"performa-backend/executor"
+	"performa-backend/models"
+	"performa-backend/stealth"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxBulkAgents = 500
+
+type BulkAgentFilters struct {
+	OperationID string `json:"operation_id"`
+	Status      string `json:"status"`
+}
+
+type BulkAgentRequest struct {
+	Action   string           `json:"action"`
+	AgentIDs []string         `json:"agent_ids"`
+	Filters  BulkAgentFilters `json:"filters"`
+}
+
+type BulkAgentResult struct {
+	AgentID string `json:"agent_id"`
+	Success bool   `json:"success"`
+	Status  string `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+var bulkAgentActions = map[string]func(id string) (bool, string){
+	"pause": func(id string) (bool, string) {
+		return models.Manager.PauseAgent(id), "agent is not running"
+	},
+	"resume": func(id string) (bool, string) {
+		if err := CheckBlackout(id); err != nil {
+			return false, err.Message
+		}
+		return models.Manager.ResumeAgent(id), "agent is not paused"
+	},
+	"stop": func(id string) (bool, string) {
+		if !models.Manager.StopAgent(id) {
+			return false, "agent is not running or paused"
+		}
+		executor.Kill(id)
+		return true, ""
+	},
+	"delete": func(id string) (bool, string) {
+		executor.Kill(id)
+		if !models.Manager.DeleteAgent(id) {
+			return false, "agent not found"
+		}
+		executor.Forget(id)
+		stealth.ForgetFingerprinter(id)
+		return true, ""
+	},
+}
+
+// BulkAgentAction applies pause, resume, stop or delete to the listed agents,
+// or to every agent matching the filters when no IDs are given, and reports
+// the outcome per agent.
+func BulkAgentAction(c *fiber.Ctx) error {
+	var req BulkAgentRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	action, ok := bulkAgentActions[req.Action]
+	if !ok {
+		return apierror.New(400, apierror.ValidationFailed, "action must be one of pause, resume, stop, delete")
+	}
+
+	ids := req.AgentIDs
+	if len(ids) == 0 {
+		if req.Filters.OperationID == "" && req.Filters.Status == "" {
+			return apierror.New(400, apierror.ValidationFailed, "agent_ids or filters are required")
+		}
+		ids = filterAgentIDs(req.Filters)
+	}
+	if len(ids) > maxBulkAgents {
+		return apierror.New(400, apierror.ValidationFailed, "Too many agents in one request")
+	}
+
+	results := make([]BulkAgentResult, 0, len(ids))
+	operations := make(map[string]bool)
+	succeeded := 0
+	for _, id := range ids {
+		result := BulkAgentResult{AgentID: id}
+		agent := models.Manager.GetAgent(id)
+		if agent == nil || !inWorkspace(c, AgentWorkspace(id)) {
+			result.Error = "agent not found"
+			results = append(results, result)
+			continue
+		}
+		operationID := agent.OperationID
+
+		done, reason := action(id)
+		result.Success = done
+		if done {
+			succeeded++
+			RecordOperatorAction(agent, req.Action, map[string]interface{}{"bulk": true})
+			if operationID != "" {
+				operations[operationID] = true
+			}
+		} else {
+			result.Error = reason
+		}
+		if current := models.Manager.GetAgent(id); current != nil {
+			result.Status = string(current.Status)
+		}
+		results = append(results, result)
+	}
+
+	for operationID := range operations {
+		refreshOperationStatus(operationID)
+	}
+
+	ws.BroadcastAgentsBulk(currentWorkspace(c), req.Action, results)
+
+	return c.JSON(fiber.Map{
+		"action":    req.Action,
+		"results":   results,
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
+
+func filterAgentIDs(filters BulkAgentFilters) []string {
+	ids := make([]string, 0)
+	for _, agent := range models.Manager.GetAllAgents() {
+		if filters.OperationID != "" && agent.OperationID != filters.OperationID {
+			continue
+		}
+		if filters.Status != "" && string(agent.Status) != filters.Status {
+			continue
+		}
+		ids = append(ids, agent.ID)
+	}
+	return ids
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"fmt"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/executor"
+	"performa-backend/models"
+	"performa-backend/timeline"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// agentLimits fills the limits a request left at 0 with the AGENT_MAX_*
+// defaults.
+func agentLimits(limits models.AgentLimits) models.AgentLimits {
+	if limits.MaxCPUSeconds == 0 {
+		limits.MaxCPUSeconds = config.AppConfig.AgentMaxToolCPUSeconds
+	}
+	if limits.MaxMemoryMB == 0 {
+		limits.MaxMemoryMB = config.AppConfig.AgentMaxToolMemoryMB
+	}
+	if limits.MaxConcurrentTools == 0 {
+		limits.MaxConcurrentTools = config.AppConfig.AgentMaxConcurrentTools
+	}
+	if limits.MaxLLMCalls == 0 {
+		limits.MaxLLMCalls = config.AppConfig.AgentMaxLLMCalls
+	}
+	return limits
+}
+
+func cpuLimitReason(limits models.AgentLimits) string {
+	return fmt.Sprintf("tool CPU limit of %g seconds reached", limits.MaxCPUSeconds)
+}
+
+func memoryLimitReason(limits models.AgentLimits) string {
+	return fmt.Sprintf("a tool run went over the %d MB memory limit", limits.MaxMemoryMB)
+}
+
+func concurrencyLimitReason(limits models.AgentLimits) string {
+	return fmt.Sprintf("%d concurrent tool run(s) limit reached", limits.MaxConcurrentTools)
+}
+
+func llmCallLimitReason(limits models.AgentLimits) string {
+	return fmt.Sprintf("limit of %d LLM calls reached", limits.MaxLLMCalls)
+}
+
+// throttleAgent holds the agent for reason, broadcasting the change and
+// recording it on the operation's timeline.
+func throttleAgent(agent *models.Agent, reason string) {
+	if models.Manager.ThrottleAgent(agent.ID, reason) {
+		ws.BroadcastAgentUpdate(agent.ID, "throttled", reason)
+		recordAgentStatus(agent, timeline.ActorSystem, models.AgentStatusThrottled, reason)
+	}
+}
+
+// unthrottleAgent clears reason and lets the agent run again if it was the
+// last one.
+func unthrottleAgent(agent *models.Agent, reason string) {
+	if models.Manager.ClearThrottle(agent.ID, reason) {
+		ws.BroadcastAgentUpdate(agent.ID, "resumed", "Limit no longer reached")
+		recordAgentStatus(agent, timeline.ActorSystem, models.AgentStatusRunning, "limit no longer reached")
+	}
+}
+
+// waitForToolLimits throttles the agent while it has used up its tool CPU
+// time, until an operator raises the limit or resumes it.
+func waitForToolLimits(agent *models.Agent) error {
+	return waitForLimit(agent, func(limits models.AgentLimits, usage models.AgentUsage) string {
+		if limits.MaxCPUSeconds > 0 && usage.ToolCPUSeconds >= limits.MaxCPUSeconds {
+			return cpuLimitReason(limits)
+		}
+		return ""
+	})
+}
+
+// waitForLLMLimits throttles the agent while it has made all the model calls
+// it may, until an operator raises the limit or resumes it.
+func waitForLLMLimits(agent *models.Agent) error {
+	return waitForLimit(agent, func(limits models.AgentLimits, usage models.AgentUsage) string {
+		if limits.MaxLLMCalls > 0 && usage.LLMCalls >= limits.MaxLLMCalls {
+			return llmCallLimitReason(limits)
+		}
+		return ""
+	})
+}
+
+func waitForLimit(agent *models.Agent, spent func(models.AgentLimits, models.AgentUsage) string) error {
+	for {
+		limits, usage, ok := models.Manager.AgentLimits(agent.ID)
+		if !ok {
+			return errAgentStopped
+		}
+		reason := spent(limits, usage)
+		if reason == "" {
+			return nil
+		}
+		throttleAgent(agent, reason)
+		if err := waitWhilePaused(agent); err != nil {
+			return err
+		}
+	}
+}
+
+// toolRunLimits returns the limits of the agent's next tool run: the CPU time
+// it has left, its memory ceiling and its concurrency cap. waiting throttles
+// the agent while the run waits for a free slot.
+func toolRunLimits(agent *models.Agent) (executor.Limits, func(bool)) {
+	limits, usage, _ := models.Manager.AgentLimits(agent.ID)
+	run := executor.Limits{
+		MemoryMB:      limits.MaxMemoryMB,
+		MaxConcurrent: limits.MaxConcurrentTools,
+	}
+	if limits.MaxCPUSeconds > 0 {
+		run.CPUSeconds = limits.MaxCPUSeconds - usage.ToolCPUSeconds
+	}
+	reason := concurrencyLimitReason(limits)
+	waiting := func(waiting bool) {
+		if waiting {
+			throttleAgent(agent, reason)
+		} else {
+			unthrottleAgent(agent, reason)
+		}
+	}
+	return run, waiting
+}
+
+// throttleForToolRun throttles the agent when its tool run was killed for
+// going over one of its limits.
+func throttleForToolRun(agent *models.Agent, result *executor.Result) {
+	limits, _, _ := models.Manager.AgentLimits(agent.ID)
+	switch result.Limit {
+	case executor.LimitCPU:
+		throttleAgent(agent, cpuLimitReason(limits))
+	case executor.LimitMemory:
+		throttleAgent(agent, memoryLimitReason(limits))
+	}
+}
+
+// AgentLimitsStatus is an agent's limits with what it used against them.
+type AgentLimitsStatus struct {
+	Limits          models.AgentLimits `json:"limits"`
+	ToolCPUSeconds  float64            `json:"tool_cpu_seconds"`
+	LLMCalls        int                `json:"llm_calls"`
+	RunningTools    int                `json:"running_tools"`
+	Status          models.AgentStatus `json:"status"`
+	ThrottleReasons []string           `json:"throttle_reasons,omitempty"`
+}
+
+func agentLimitsStatus(id string) (AgentLimitsStatus, bool) {
+	agent := models.Manager.GetAgent(id)
+	limits, usage, ok := models.Manager.AgentLimits(id)
+	if agent == nil || !ok {
+		return AgentLimitsStatus{}, false
+	}
+	return AgentLimitsStatus{
+		Limits:          limits,
+		ToolCPUSeconds:  usage.ToolCPUSeconds,
+		LLMCalls:        usage.LLMCalls,
+		RunningTools:    len(executor.Processes(id)),
+		Status:          agent.Status,
+		ThrottleReasons: agent.ThrottleReasons,
+	}, true
+}
+
+func GetAgentLimits(c *fiber.Ctx) error {
+	status, ok := agentLimitsStatus(c.Params("id"))
+	if !ok {
+		return apierror.New(404, apierror.NotFound, "Agent not found")
+	}
+	return c.JSON(status)
+}
+
+// UpdateAgentLimits replaces the agent's limits. A throttled agent stays
+// throttled until it is resumed, when its limits are checked again.
+func UpdateAgentLimits(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var limits models.AgentLimits
+	if err := parseBody(c, &limits); err != nil {
+		return err
+	}
+	if !models.Manager.UpdateAgentLimits(id, limits) {
+		return apierror.New(404, apierror.NotFound, "Agent not found")
+	}
+	RecordOperatorAction(models.Manager.GetAgent(id), "limit", map[string]interface{}{"limits": limits})
+
+	status, _ := agentLimitsStatus(id)
+	return c.JSON(status)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/executor"
+	"performa-backend/models"
+	"performa-backend/stealth"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const agentSampleInterval = time.Second
+
+// monitoredAgents guards against starting two samplers for one agent when a
+// resumed conversation overlaps a finishing one.
+var monitoredAgents sync.Map
+
+// processSample is the cumulative counters of one process at a point in time.
+type processSample struct {
+	cpuSeconds float64
+	ioBytes    uint64
+}
+
+// agentSampler turns cumulative counters of an agent's tool processes and LLM
+// traffic into per-interval rates.
+type agentSampler struct {
+	last        time.Time
+	processes   map[int32]processSample
+	cpuSeconds  float64
+	llmBytes    int64
+	initialized bool
+}
+
+// monitorAgentResources samples the agent's tool subprocesses and LLM traffic
+// until the agent finishes, updating its resources and broadcasting them.
+func monitorAgentResources(agentID string) {
+	if _, running := monitoredAgents.LoadOrStore(agentID, struct{}{}); running {
+		return
+	}
+
+	go func() {
+		defer monitoredAgents.Delete(agentID)
+
+		sampler := &agentSampler{processes: make(map[int32]processSample)}
+		ticker := time.NewTicker(agentSampleInterval)
+		defer ticker.Stop()
+
+		for {
+			agent := models.Manager.GetAgent(agentID)
+			if agent == nil {
+				return
+			}
+
+			resources := sampler.sample(agent)
+			models.Manager.UpdateAgentResources(agentID, resources)
+			ws.BroadcastResourceUpdate(agentID, resources.CPUUsage, resources.MemoryUsage, resources.DiskUsage, resources.NetworkIO)
+
+			if agent.Status == models.AgentStatusComplete || agent.Status == models.AgentStatusError {
+				return
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *agentSampler) sample(agent *models.Agent) models.AgentResources {
+	now := time.Now()
+	current := make(map[int32]processSample)
+	var rss, ioDelta uint64
+
+	for _, pid := range executor.Processes(agent.ID) {
+		for _, p := range executor.ProcessTree(pid) {
+			var sample processSample
+			if times, err := p.Times(); err == nil {
+				sample.cpuSeconds = times.User + times.System
+			}
+			if mem, err := p.MemoryInfo(); err == nil {
+				rss += mem.RSS
+			}
+			if io, err := p.IOCounters(); err == nil {
+				sample.ioBytes = io.ReadBytes + io.WriteBytes
+			}
+			if previous := s.processes[p.Pid]; sample.ioBytes > previous.ioBytes {
+				ioDelta += sample.ioBytes - previous.ioBytes
+			}
+			current[p.Pid] = sample
+		}
+	}
+
+	// Total CPU time is what running processes have used so far plus the final
+	// totals of processes that already exited, so it only ever grows.
+	cpuSeconds := executor.FinishedUsage(agent.ID).CPUSeconds
+	for _, sample := range current {
+		cpuSeconds += sample.cpuSeconds
+	}
+	llmBytes := agent.Usage.BytesSent + agent.Usage.BytesReceived
+
+	resources := models.AgentResources{
+		MemoryUsage: float64(rss) / 1024 / 1024,
+		Processes:   len(current),
+	}
+	if elapsed := now.Sub(s.last).Seconds(); s.initialized && elapsed > 0 {
+		if cpuSeconds > s.cpuSeconds {
+			resources.CPUUsage = (cpuSeconds - s.cpuSeconds) / elapsed * 100
+		}
+		resources.DiskUsage = float64(ioDelta) / 1024 / elapsed
+		resources.NetworkIO = float64(llmBytes-s.llmBytes) / 1024 / elapsed
+	}
+
+	rate := stealth.PacerFor(agent.OperationID).Stats()
+	resources.RequestRate = rate.CurrentRps
+	resources.RateLimitRps = rate.LimitRps
+	resources.ThrottledRequests = rate.Throttled
+
+	s.last = now
+	s.processes = current
+	s.cpuSeconds = cpuSeconds
+	s.llmBytes = llmBytes
+	s.initialized = true
+	return resources
+}
+
+// GetAgentSteps returns the agent's latest tool steps, oldest first, with the
+// resources each of their runs used. ?limit= caps how many are returned.
+func GetAgentSteps(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Manager.GetAgent(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Agent not found")
+	}
+
+	steps := models.Manager.Steps(id)
+	total := len(steps)
+	if limit := c.QueryInt("limit", 0); limit > 0 && len(steps) > limit {
+		steps = steps[len(steps)-limit:]
+	}
+	return c.JSON(fiber.Map{
+		"steps": steps,
+		"total": total,
+	})
+}
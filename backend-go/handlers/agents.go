@@ -1,9 +1,26 @@
 package handlers
 
 import (
+        "bufio"
+        "encoding/json"
+        "fmt"
+        "strings"
+        "time"
+
+        "performa-backend/apierror"
+        "performa-backend/executor"
         "performa-backend/models"
+        "performa-backend/stealth"
+        "performa-backend/ws"
 
         "github.com/gofiber/fiber/v2"
+        "github.com/gofiber/websocket/v2"
+)
+
+const (
+        defaultMessagesLimit = 50
+        maxMessagesLimit     = 500
+        recentMessagesInline = 50
 )
 
 type CreateAgentRequest struct {
@@ -17,8 +34,8 @@ type CreateAgentRequest struct {
 
 func CreateAgent(c *fiber.Ctx) error {
         var req CreateAgentRequest
-        if err := c.BodyParser(&req); err != nil {
-                req = CreateAgentRequest{}
+        if err := parseBody(c, &req); err != nil {
+                return err
         }
 
         modelName := req.ModelName
@@ -32,6 +49,7 @@ func CreateAgent(c *fiber.Ctx) error {
                 req.Target,
                 modelName,
         )
+        models.Manager.SetAgentWorkspace(agent.ID, currentWorkspace(c))
 
         if req.Target != "" {
                 models.Manager.UpdateAgentStatus(agent.ID, models.AgentStatusRunning)
@@ -45,7 +63,12 @@ func CreateAgent(c *fiber.Ctx) error {
 }
 
 func GetAgents(c *fiber.Ctx) error {
-        agents := models.Manager.GetAllAgents()
+        agents := make([]*models.Agent, 0)
+        for _, agent := range models.Manager.GetAllAgents() {
+                if inWorkspace(c, AgentWorkspace(agent.ID)) {
+                        agents = append(agents, agent)
+                }
+        }
         return c.JSON(fiber.Map{
                 "agents": agents,
                 "total":  len(agents),
@@ -57,53 +80,247 @@ func GetAgent(c *fiber.Ctx) error {
         agent := models.Manager.GetAgent(id)
 
         if agent == nil {
-                return c.Status(404).JSON(fiber.Map{
-                        "error": "Agent not found",
-                })
+                return apierror.New(404, apierror.NotFound, "Agent not found")
         }
 
         messages := models.Manager.GetMessages(id)
+        if len(messages) > recentMessagesInline {
+                messages = messages[len(messages)-recentMessagesInline:]
+        }
         return c.JSON(fiber.Map{
-                "agent":    agent,
-                "messages": messages,
+                "agent":         agent,
+                "messages":      messages,
+                "message_count": models.Manager.MessageCount(id),
+        })
+}
+
+func GetAgentMessages(c *fiber.Ctx) error {
+        id := c.Params("id")
+        if models.Manager.GetAgent(id) == nil {
+                return apierror.New(404, apierror.NotFound, "Agent not found")
+        }
+
+        after := c.Query("after")
+        limit := c.QueryInt("limit", defaultMessagesLimit)
+        if limit <= 0 || limit > maxMessagesLimit {
+                limit = defaultMessagesLimit
+        }
+
+        if c.QueryBool("tail", false) {
+                if websocket.IsWebSocketUpgrade(c) {
+                        return websocket.New(func(conn *websocket.Conn) {
+                                tailAgentMessagesWS(conn, id, after)
+                        })(c)
+                }
+                return tailAgentMessagesSSE(c, id, after)
+        }
+
+        messages, hasMore := models.Manager.GetMessagesAfter(id, after, limit)
+        nextAfter := after
+        if len(messages) > 0 {
+                nextAfter = messages[len(messages)-1].ID
+        }
+
+        return c.JSON(fiber.Map{
+                "messages":   messages,
+                "count":      len(messages),
+                "total":      models.Manager.MessageCount(id),
+                "has_more":   hasMore,
+                "next_after": nextAfter,
         })
 }
 
+// tailAgentMessagesSSE replays the history after the given message ID and then
+// streams new messages as server-sent events until the client disconnects.
+func tailAgentMessagesSSE(c *fiber.Ctx, agentID, after string) error {
+        c.Set("Content-Type", "text/event-stream")
+        c.Set("Cache-Control", "no-cache")
+        c.Set("Connection", "keep-alive")
+        c.Set("X-Accel-Buffering", "no")
+
+        live, cancel := models.Manager.Subscribe(agentID)
+        backlog, _ := models.Manager.GetMessagesAfter(agentID, after, 0)
+
+        c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+                defer cancel()
+
+                seen := make(map[string]bool, len(backlog))
+                for _, msg := range backlog {
+                        seen[msg.ID] = true
+                        if writeSSEMessage(w, msg) != nil {
+                                return
+                        }
+                }
+
+                heartbeat := time.NewTicker(15 * time.Second)
+                defer heartbeat.Stop()
+
+                for {
+                        select {
+                        case msg, ok := <-live:
+                                if !ok {
+                                        fmt.Fprint(w, "event: end\ndata: {}\n\n")
+                                        w.Flush()
+                                        return
+                                }
+                                if seen[msg.ID] {
+                                        continue
+                                }
+                                if writeSSEMessage(w, msg) != nil {
+                                        return
+                                }
+                        case <-heartbeat.C:
+                                fmt.Fprint(w, ": keep-alive\n\n")
+                                if w.Flush() != nil {
+                                        return
+                                }
+                        }
+                }
+        })
+
+        return nil
+}
+
+func writeSSEMessage(w *bufio.Writer, msg models.AgentMessage) error {
+        data, _ := json.Marshal(msg)
+        fmt.Fprintf(w, "id: %s\nevent: message\ndata: %s\n\n", msg.ID, data)
+        return w.Flush()
+}
+
+func tailAgentMessagesWS(conn *websocket.Conn, agentID, after string) {
+        live, cancel := models.Manager.Subscribe(agentID)
+        defer cancel()
+
+        backlog, _ := models.Manager.GetMessagesAfter(agentID, after, 0)
+        seen := make(map[string]bool, len(backlog))
+        for _, msg := range backlog {
+                seen[msg.ID] = true
+                if conn.WriteJSON(msg) != nil {
+                        return
+                }
+        }
+
+        closed := make(chan struct{})
+        go func() {
+                defer close(closed)
+                for {
+                        if _, _, err := conn.ReadMessage(); err != nil {
+                                return
+                        }
+                }
+        }()
+
+        for {
+                select {
+                case msg, ok := <-live:
+                        if !ok {
+                                return
+                        }
+                        if seen[msg.ID] {
+                                continue
+                        }
+                        if conn.WriteJSON(msg) != nil {
+                                return
+                        }
+                case <-closed:
+                        return
+                }
+        }
+}
+
 func DeleteAgent(c *fiber.Ctx) error {
         id := c.Params("id")
+        agent := models.Manager.GetAgent(id)
         if models.Manager.DeleteAgent(id) {
+                RecordOperatorAction(agent, "delete", nil)
+                executor.Forget(id)
+                stealth.ForgetFingerprinter(id)
                 return c.JSON(fiber.Map{
                         "message": "Agent deleted successfully",
                 })
         }
 
-        return c.Status(404).JSON(fiber.Map{
-                "error": "Agent not found",
-        })
+        return apierror.New(404, apierror.NotFound, "Agent not found")
 }
 
 func PauseAgent(c *fiber.Ctx) error {
         id := c.Params("id")
         if models.Manager.PauseAgent(id) {
+                ws.BroadcastAgentUpdate(id, "paused", "Agent paused")
+                RecordOperatorAction(models.Manager.GetAgent(id), "pause", nil)
                 return c.JSON(fiber.Map{
                         "message": "Agent paused successfully",
                 })
         }
 
-        return c.Status(400).JSON(fiber.Map{
-                "error": "Cannot pause agent",
-        })
+        return apierror.New(400, apierror.ValidationFailed, "Cannot pause agent")
 }
 
 func ResumeAgent(c *fiber.Ctx) error {
         id := c.Params("id")
+        if err := CheckBlackout(id); err != nil {
+                return err
+        }
         if models.Manager.ResumeAgent(id) {
+                ws.BroadcastAgentUpdate(id, "resumed", "Agent resumed")
+                RecordOperatorAction(models.Manager.GetAgent(id), "resume", nil)
                 return c.JSON(fiber.Map{
                         "message": "Agent resumed successfully",
                 })
         }
 
-        return c.Status(400).JSON(fiber.Map{
-                "error": "Cannot resume agent",
+        return apierror.New(400, apierror.ValidationFailed, "Cannot resume agent")
+}
+
+type AgentChatRequest struct {
+        Message string `json:"message"`
+}
+
+// ChatWithAgent injects an operator message into an agent's conversation. A
+// running agent picks it up before its next model turn; a finished agent is
+// woken for another turn. Either way the reply streams over the agent's
+// message tail and WebSocket.
+func ChatWithAgent(c *fiber.Ctx) error {
+        id := c.Params("id")
+        agent := models.Manager.GetAgent(id)
+        if agent == nil {
+                return apierror.New(404, apierror.NotFound, "Agent not found")
+        }
+
+        var req AgentChatRequest
+        if err := parseBody(c, &req); err != nil {
+                return err
+        }
+        req.Message = strings.TrimSpace(req.Message)
+        if req.Message == "" {
+                return apierror.New(400, apierror.ValidationFailed, "Message is required")
+        }
+
+        // An agent whose previous run is still winding down, or that the
+        // reaper marked stale, keeps its loop; the message is queued for it.
+        // Otherwise the message restarts the agent, which a blackout forbids.
+        restart := !agentTaskRunning(id)
+        if restart {
+                if err := CheckBlackout(id); err != nil {
+                        return err
+                }
+        }
+
+        models.Manager.AddMessage(id, "operator", req.Message)
+        RecordOperatorAction(agent, "chat", map[string]interface{}{"message": req.Message})
+
+        if restart && models.Manager.ReactivateAgent(id) {
+                go continueAgentTask(agent, agentStartRequest(agent))
+                return c.Status(202).JSON(fiber.Map{
+                        "status":   "started",
+                        "agent_id": id,
+                })
+        }
+
+        models.Manager.QueueOperatorMessage(id, req.Message)
+        return c.Status(202).JSON(fiber.Map{
+                "status":   "queued",
+                "agent_id": id,
+                "pending":  models.Manager.PendingOperatorMessages(id),
         })
 }
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/assets"
+	"performa-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultAssetsLimit = 100
+	maxAssetsLimit     = 1000
+	// maxReconServicesInPrompt bounds the services listed in one prompt.
+	maxReconServicesInPrompt = 50
+)
+
+// reconContextRoles are the roles that are told which services recon has
+// found on their targets, so that they build on them instead of rescanning.
+var reconContextRoles = map[string]bool{
+	"analyzer":  true,
+	"exploiter": true,
+}
+
+// agentHost is the host an agent's results are attributed to when they do not
+// name one, or "" when the agent covers several targets.
+func agentHost(agent *models.Agent) string {
+	if strings.Contains(agent.Target, ",") {
+		return ""
+	}
+	return agent.Target
+}
+
+// observeAsset records an observation in the inventory of its operation's
+// workspace.
+func observeAsset(obs assets.Observation) {
+	obs.WorkspaceID = operationWorkspace(obs.OperationID)
+	assets.Default.Observe(obs)
+}
+
+// recordTargetAssets adds an operation's targets to the inventory.
+func recordTargetAssets(operationID string, operationTargets []string) {
+	for _, target := range operationTargets {
+		observeAsset(assets.Observation{Host: target, OperationID: operationID})
+	}
+}
+
+// recordResultAssets adds what a shared result reveals about a host to the
+// inventory: open ports and services of the agent's target, technologies it
+// runs, and the hosts of discovered endpoints.
+func recordResultAssets(agent *models.Agent, kind, value string) {
+	switch kind {
+	case models.ResultOpenPort, models.ResultService:
+		if obs, ok := assets.ParseService(value); ok && agentHost(agent) != "" {
+			obs.Host = agentHost(agent)
+			obs.OperationID = agent.OperationID
+			observeAsset(obs)
+		}
+	case models.ResultTechnology:
+		if host := agentHost(agent); host != "" {
+			observeAsset(assets.Observation{Host: host, Technology: value, OperationID: agent.OperationID})
+		}
+	case models.ResultEndpoint:
+		if u, err := url.Parse(value); err == nil && u.Hostname() != "" {
+			observeAsset(assets.Observation{Host: u.Hostname(), OperationID: agent.OperationID})
+		}
+	}
+}
+
+// recordToolAssets parses the hosts and open ports in a tool's output into the
+// inventory. Ports listed without a host belong to the agent's target.
+func recordToolAssets(agent *models.Agent, tool, output string) {
+	observations := assets.ParseNmap(output)
+	if tool == "naabu" {
+		observations = append(observations, assets.ParseNaabu(output)...)
+	}
+	for _, obs := range observations {
+		if obs.Host == "" {
+			obs.Host = agentHost(agent)
+		}
+		obs.OperationID = agent.OperationID
+		observeAsset(obs)
+	}
+}
+
+// reconServicesMessage returns a prompt listing the services found on the
+// agent's targets that are new or changed since the last one, or "" when
+// there are none or the agent's role does not build on recon. seen records
+// what was already listed; services beyond the prompt's limit are left for
+// the next one.
+func reconServicesMessage(agent *models.Agent, seen map[string]string) string {
+	if !reconContextRoles[strings.ToLower(agent.Role)] {
+		return ""
+	}
+
+	workspace := operationWorkspace(agent.OperationID)
+	var lines []string
+	for _, target := range strings.Split(agent.Target, ",") {
+		asset := assets.Default.Lookup(workspace, strings.TrimSpace(target))
+		if asset == nil {
+			continue
+		}
+		for _, service := range asset.Services {
+			host := service.Host
+			if host == "" {
+				host = asset.Name
+			}
+			line := fmt.Sprintf("%s %d/%s %s", host, service.Port, service.Protocol, service.Name)
+			if service.Version != "" {
+				line += " " + service.Version
+			}
+			if service.Banner != "" {
+				line += fmt.Sprintf(" (banner: %s)", service.Banner)
+			}
+			key := fmt.Sprintf("%s/%d/%s", asset.ID, service.Port, service.Protocol)
+			if seen[key] == line || len(lines) == maxReconServicesInPrompt {
+				continue
+			}
+			seen[key] = line
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Services found by network recon on your targets:\n")
+	for _, line := range lines {
+		fmt.Fprintf(&b, "- %s\n", strings.TrimSpace(line))
+	}
+	b.WriteString("Build on these services instead of rescanning for them.")
+	return b.String()
+}
+
+// assetFindings returns the findings of the asset's workspace whose target is
+// one of its hostnames or IPs.
+func assetFindings(asset *assets.Asset) []*models.Finding {
+	identifiers := make(map[string]bool)
+	for _, identifier := range asset.Identifiers() {
+		identifiers[identifier] = true
+	}
+
+	seen := make(map[string]bool)
+	related := make([]*models.Finding, 0)
+	for _, identifier := range asset.Identifiers() {
+		findings, _, _, _ := QueryFindings(models.FindingFilter{WorkspaceID: asset.WorkspaceID, Target: identifier, SortBy: "created_at", SortDesc: true, Limit: maxFindingsLimit})
+		for _, finding := range findings {
+			host, _, ok := assets.NormalizeHost(finding.Target)
+			if !ok || !identifiers[host] || seen[finding.ID] {
+				continue
+			}
+			seen[finding.ID] = true
+			related = append(related, finding)
+		}
+	}
+	return related
+}
+
+func GetAssets(c *fiber.Ctx) error {
+	filter := assets.Filter{
+		WorkspaceID: currentWorkspace(c),
+		Query:       c.Query("q", c.Query("search")),
+		Kind:        c.Query("kind"),
+		OperationID: c.Query("operation_id"),
+		Port:        c.QueryInt("port", 0),
+		Technology:  c.Query("technology"),
+		Limit:       c.QueryInt("limit", defaultAssetsLimit),
+		Offset:      c.QueryInt("offset", 0),
+	}
+	if filter.Limit <= 0 || filter.Limit > maxAssetsLimit {
+		filter.Limit = defaultAssetsLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	found, total := assets.Default.Search(filter)
+	return c.JSON(fiber.Map{
+		"assets":   found,
+		"total":    total,
+		"limit":    filter.Limit,
+		"offset":   filter.Offset,
+		"has_more": filter.Offset+len(found) < total,
+	})
+}
+
+// requestAsset returns the asset the request's :id names, by ID or by
+// hostname or IP, in the request's workspace.
+func requestAsset(c *fiber.Ctx) *assets.Asset {
+	id, _ := url.PathUnescape(c.Params("id"))
+	asset := assets.Default.Get(id)
+	if asset == nil || !inWorkspace(c, asset.WorkspaceID) {
+		asset = assets.Default.Lookup(currentWorkspace(c), id)
+	}
+	return asset
+}
+
+// GetAsset returns an asset by ID, or by hostname or IP, with its findings.
+func GetAsset(c *fiber.Ctx) error {
+	asset := requestAsset(c)
+	if asset == nil {
+		return apierror.New(404, apierror.NotFound, "Asset not found")
+	}
+
+	findings := assetFindings(asset)
+	return c.JSON(fiber.Map{
+		"asset":    asset,
+		"findings": findings,
+		"total":    len(findings),
+	})
+}
+
+// GetAssetServices returns the services network scans found on an asset's
+// hostnames and IPs.
+func GetAssetServices(c *fiber.Ctx) error {
+	asset := requestAsset(c)
+	if asset == nil {
+		return apierror.New(404, apierror.NotFound, "Asset not found")
+	}
+
+	services := assets.Default.Services(asset)
+	return c.JSON(fiber.Map{
+		"asset_id": asset.ID,
+		"name":     asset.Name,
+		"services": services,
+		"total":    len(services),
+	})
+}
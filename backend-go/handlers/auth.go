@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/auth"
+	"performa-backend/config"
+	"performa-backend/telemetry"
+	"performa-backend/users"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const userLocalsKey = "user"
+
+// publicAuthPaths are reachable without a token so users can obtain one.
+var publicAuthPaths = map[string]bool{
+	"/api/auth/login":   true,
+	"/api/auth/refresh": true,
+}
+
+// presignedPathPrefix serves pre-signed download links, which browsers open
+// without a token; DownloadStoredObject checks their signature instead.
+const presignedPathPrefix = "/api/storage/"
+
+// isPublicPath reports whether a request path is reachable without a token.
+func isPublicPath(path string) bool {
+	return publicAuthPaths[path] || strings.HasPrefix(path, presignedPathPrefix)
+}
+
+func bearerToken(c *fiber.Ctx) string {
+	if header := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return ""
+}
+
+// currentUser returns the authenticated user of the request, or nil when
+// authentication is disabled or the request has no valid access token.
+func currentUser(c *fiber.Ctx) *auth.Claims {
+	if claims, ok := c.Locals(userLocalsKey).(*auth.Claims); ok {
+		return claims
+	}
+	if !config.AppConfig.AuthEnabled {
+		return nil
+	}
+	token := bearerToken(c)
+	if token == "" {
+		return nil
+	}
+	claims, err := auth.Verify(token, auth.TokenAccess)
+	if err != nil {
+		return nil
+	}
+	c.Locals(userLocalsKey, claims)
+	return claims
+}
+
+// ownerScope returns the user whose resources a listing is limited to. It
+// returns "" when the listing is unscoped: authentication is disabled or the
+// user is an admin.
+func ownerScope(c *fiber.Ctx) string {
+	claims := currentUser(c)
+	if claims == nil || claims.IsAdmin() {
+		return ""
+	}
+	return claims.UserID()
+}
+
+// currentUserID returns the ID recorded as the owner of resources the request
+// creates, or "" when authentication is disabled.
+func currentUserID(c *fiber.Ctx) string {
+	if claims := currentUser(c); claims != nil {
+		return claims.UserID()
+	}
+	return ""
+}
+
+// Authenticate requires a valid access token on API requests when
+// AUTH_ENABLED is set. Without it, requests stay anonymous as before. A
+// workspace API key in X-API-Key authenticates a request too, limiting it to
+// the key's workspace, and so does ADMIN_TOKEN, which grants admin access.
+func Authenticate(c *fiber.Ctx) error {
+	if key := c.Get(apiKeyHeader); key != "" {
+		if !authenticateAPIKey(c, key) {
+			return apierror.New(401, apierror.Unauthenticated, "Invalid API key")
+		}
+		return c.Next()
+	}
+	if !config.AppConfig.AuthEnabled || isPublicPath(c.Path()) || c.Method() == fiber.MethodOptions || hasAdminToken(c) {
+		return c.Next()
+	}
+	if currentUser(c) == nil {
+		return apierror.New(401, apierror.Unauthenticated, "Authentication required")
+	}
+	return c.Next()
+}
+
+// AuthenticateWebSocket is Authenticate for the WebSocket endpoint, where
+// browsers cannot set headers: the access token may be passed as ?token= and
+// an API key as ?api_key=.
+func AuthenticateWebSocket(c *fiber.Ctx) error {
+	if key := c.Get(apiKeyHeader, c.Query("api_key")); key != "" {
+		if !authenticateAPIKey(c, key) {
+			return apierror.New(401, apierror.Unauthenticated, "Invalid API key")
+		}
+		return c.Next()
+	}
+	if !config.AppConfig.AuthEnabled {
+		return c.Next()
+	}
+	token := bearerToken(c)
+	if token == "" {
+		token = c.Query("token")
+	}
+	claims, err := auth.Verify(token, auth.TokenAccess)
+	if err != nil {
+		return apierror.New(401, apierror.Unauthenticated, "Authentication required")
+	}
+	c.Locals(userLocalsKey, claims)
+	return c.Next()
+}
+
+// hasAdminToken reports whether the request presents ADMIN_TOKEN, as a
+// bearer token or in X-Admin-Token.
+func hasAdminToken(c *fiber.Ctx) bool {
+	expected := config.AppConfig.AdminToken
+	if expected == "" {
+		return false
+	}
+	token := c.Get("X-Admin-Token")
+	if token == "" {
+		token = bearerToken(c)
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// RequireAdmin limits a route to admins: admin users when authentication is
+// enabled, and callers presenting ADMIN_TOKEN when it is set. With neither
+// configured there is no one to tell apart and the route stays open, like
+// the rest of the API.
+func RequireAdmin(c *fiber.Ctx) error {
+	if err := checkAdmin(c); err != nil {
+		return err
+	}
+	return c.Next()
+}
+
+// checkAdmin returns the error RequireAdmin rejects the request with, or nil
+// when the caller is an admin.
+func checkAdmin(c *fiber.Ctx) error {
+	if hasAdminToken(c) {
+		return nil
+	}
+	if claims := currentUser(c); claims != nil {
+		if !claims.IsAdmin() {
+			return apierror.New(403, apierror.Forbidden, "Admin role required")
+		}
+		return nil
+	}
+	if config.AppConfig.AuthEnabled {
+		return apierror.New(401, apierror.Unauthenticated, "Authentication required")
+	}
+	if config.AppConfig.AdminToken != "" {
+		return apierror.New(401, apierror.Unauthenticated, "Admin token required")
+	}
+	return nil
+}
+
+func issueTokens(c *fiber.Ctx, user *users.User) error {
+	tokens, err := auth.Issue(user)
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to issue tokens").WithReason(err)
+	}
+	return c.JSON(fiber.Map{
+		"user":   user,
+		"tokens": tokens,
+	})
+}
+
+func authDisabled(c *fiber.Ctx) error {
+	return apierror.New(400, apierror.ValidationFailed, "Authentication is disabled; set AUTH_ENABLED=true")
+}
+
+func Login(c *fiber.Ctx) error {
+	if !config.AppConfig.AuthEnabled {
+		return authDisabled(c)
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	user, err := users.Default.Authenticate(req.Username, req.Password)
+	shipLogin(c, req.Username, err)
+	if err != nil {
+		return apierror.New(401, apierror.Unauthenticated, err.Error())
+	}
+	return issueTokens(c, user)
+}
+
+// shipLogin sends a login attempt to syslog; failed ones are notable.
+func shipLogin(c *fiber.Ctx, username string, err error) {
+	event := telemetry.Event{
+		Category: telemetry.CategoryAuth,
+		Action:   "login",
+		Severity: 3,
+		Outcome:  telemetry.OutcomeSuccess,
+		Actor:    username,
+		SourceIP: c.IP(),
+		Message:  "User logged in",
+	}
+	if err != nil {
+		event.Severity = 5
+		event.Outcome = telemetry.OutcomeFailure
+		event.Message = "Login failed: " + err.Error()
+	}
+	telemetry.Emit(event)
+}
+
+// RefreshToken exchanges a refresh token for a new token pair.
+func RefreshToken(c *fiber.Ctx) error {
+	if !config.AppConfig.AuthEnabled {
+		return authDisabled(c)
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	claims, err := auth.Verify(req.RefreshToken, auth.TokenRefresh)
+	if err != nil {
+		return apierror.New(401, apierror.Unauthenticated, err.Error())
+	}
+	return issueTokens(c, users.Default.Get(claims.UserID()))
+}
+
+// Logout revokes every token issued to the current user.
+func Logout(c *fiber.Ctx) error {
+	if claims := currentUser(c); claims != nil {
+		users.Default.RevokeTokens(claims.UserID())
+	}
+	return c.JSON(fiber.Map{
+		"message": "Logged out",
+	})
+}
+
+func GetCurrentUser(c *fiber.Ctx) error {
+	claims := currentUser(c)
+	if claims == nil {
+		return c.JSON(fiber.Map{
+			"auth_enabled": config.AppConfig.AuthEnabled,
+			"user":         nil,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"auth_enabled": true,
+		"user":         users.Default.Get(claims.UserID()),
+	})
+}
+
+// ChangePassword sets the current user's password after checking the old
+// one. Existing tokens are revoked and a new pair is returned.
+func ChangePassword(c *fiber.Ctx) error {
+	claims := currentUser(c)
+	if claims == nil {
+		return authDisabled(c)
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if _, err := users.Default.Authenticate(claims.Username, req.CurrentPassword); err != nil {
+		return apierror.New(401, apierror.Unauthenticated, "Current password is incorrect")
+	}
+
+	user, err := users.Default.Update(claims.UserID(), nil, nil, &req.NewPassword)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid password").WithReason(err)
+	}
+	return issueTokens(c, user)
+}
+
+func GetUsers(c *fiber.Ctx) error {
+	all := users.Default.GetAll()
+	return c.JSON(fiber.Map{
+		"users": all,
+		"total": len(all),
+	})
+}
+
+func CreateUser(c *fiber.Ctx) error {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	user, err := users.Default.Create(req.Username, req.Password, req.Role)
+	if errors.Is(err, users.ErrUsernameTaken) {
+		return apierror.New(409, apierror.Conflict, err.Error())
+	}
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid user").WithReason(err)
+	}
+	return c.Status(201).JSON(user)
+}
+
+// UpdateUser changes a user's role, disabled flag or password. Admins cannot
+// demote or disable themselves, so at least one admin always remains.
+func UpdateUser(c *fiber.Ctx) error {
+	var req struct {
+		Role     *string `json:"role"`
+		Disabled *bool   `json:"disabled"`
+		Password *string `json:"password"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	id := c.Params("id")
+	if id == currentUserID(c) && ((req.Role != nil && *req.Role != users.RoleAdmin) || (req.Disabled != nil && *req.Disabled)) {
+		return apierror.New(400, apierror.ValidationFailed, "You cannot demote or disable your own account")
+	}
+
+	user, err := users.Default.Update(id, req.Role, req.Disabled, req.Password)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid user").WithReason(err)
+	}
+	if user == nil {
+		return apierror.New(404, apierror.NotFound, "User not found")
+	}
+	return c.JSON(user)
+}
+
+func DeleteUser(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == currentUserID(c) {
+		return apierror.New(400, apierror.ValidationFailed, "You cannot delete your own account")
+	}
+	if !users.Default.Delete(id) {
+		return apierror.New(404, apierror.NotFound, "User not found")
+	}
+	return c.JSON(fiber.Map{
+		"message": "User deleted",
+	})
+}
+
+// InitAuth loads user accounts and, when authentication is enabled,
+// configures token signing and creates the bootstrap admin.
+func InitAuth() {
+	users.Default.Load()
+	if !config.AppConfig.AuthEnabled {
+		return
+	}
+	auth.Configure(config.AppConfig.JWTSecret,
+		time.Duration(config.AppConfig.JWTAccessTTLMinutes)*time.Minute,
+		time.Duration(config.AppConfig.JWTRefreshTTLHours)*time.Hour)
+	users.Default.Bootstrap(config.AppConfig.AuthAdminUsername, config.AppConfig.AuthAdminPassword)
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/credentials"
+	"performa-backend/database"
+	"performa-backend/models"
+	"performa-backend/repo"
+	"performa-backend/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// A backup is backupMagic followed by a gzipped tarball sealed with
+// AES-256-GCM. The tarball holds a manifest, every database table, or the
+// in-memory configs and sessions when there is no database, and every object
+// of the findings storage.
+const (
+	backupMagic         = "PERFORMA-BACKUP-1\n"
+	backupFormatVersion = 1
+
+	backupManifestFile = "manifest.json"
+	backupDatabaseDir  = "database/"
+	backupMemoryDir    = "memory/"
+	backupStorageDir   = "storage/"
+	backupConfigsFile  = backupMemoryDir + "configs.json"
+	backupSessionsFile = backupMemoryDir + "sessions.json"
+)
+
+const backupModeMemory = "memory"
+
+type backupManifest struct {
+	Version   int       `json:"version"`
+	Mode      string    `json:"mode"`
+	Tables    []string  `json:"tables,omitempty"`
+	Rows      int       `json:"rows"`
+	Configs   int       `json:"configs"`
+	Sessions  int       `json:"sessions"`
+	Objects   int       `json:"objects"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupRequest struct {
+	Passphrase string `json:"passphrase" form:"passphrase"`
+	// Save writes the backup to BACKUP_DIR instead of returning it.
+	Save bool `json:"save" form:"save"`
+}
+
+type restoreRequest struct {
+	Passphrase string `json:"passphrase" form:"passphrase"`
+	// File names a backup in BACKUP_DIR to restore instead of an upload.
+	File string `json:"file" form:"file"`
+}
+
+type restoreResult struct {
+	Mode            string    `json:"mode"`
+	BackupCreatedAt time.Time `json:"backup_created_at"`
+	Tables          int       `json:"tables"`
+	Rows            int       `json:"rows"`
+	Configs         int       `json:"configs"`
+	Sessions        int       `json:"sessions"`
+	Objects         int       `json:"objects"`
+	Warnings        []string  `json:"warnings"`
+	// RestartRequired is set when database tables were replaced: the stores
+	// cached in memory at startup only pick them up on restart.
+	RestartRequired bool `json:"restart_required"`
+}
+
+// backupSealer returns the sealer for passphrase, falling back to
+// BACKUP_ENCRYPTION_KEY.
+func backupSealer(passphrase string) (*credentials.Sealer, error) {
+	if passphrase == "" {
+		passphrase = config.AppConfig.BackupEncryptionKey
+	}
+	if passphrase == "" {
+		return nil, apierror.New(400, apierror.ValidationFailed, "Backups are encrypted: a passphrase or BACKUP_ENCRYPTION_KEY is required")
+	}
+	return credentials.NewSealer(passphrase)
+}
+
+// backupStorage is the findings storage backend, or the findings directory
+// when none is configured.
+func backupStorage() (storage.Backend, error) {
+	if storage.Default != nil {
+		return storage.Default, nil
+	}
+	return storage.NewLocal(config.AppConfig.FindingsDir, "")
+}
+
+// CreateBackup produces an encrypted archive of the whole datastore. It is
+// returned as a download, or written to BACKUP_DIR when save is set.
+func CreateBackup(c *fiber.Ctx) error {
+	var req backupRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	sealer, err := backupSealer(req.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	archive, manifest, err := buildBackup()
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to create backup").WithReason(err)
+	}
+	sealed, err := sealer.SealBytes(archive)
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to encrypt backup").WithReason(err)
+	}
+	data := append([]byte(backupMagic), sealed...)
+	name := "performa-backup-" + manifest.CreatedAt.UTC().Format("20060102T150405Z") + ".bak"
+	log.Printf("Backup: created %s (%s, %d tables, %d rows, %d objects, %d bytes)",
+		name, manifest.Mode, len(manifest.Tables), manifest.Rows, manifest.Objects, len(data))
+
+	if req.Save {
+		if err := os.MkdirAll(config.AppConfig.BackupDir, 0700); err != nil {
+			return apierror.New(500, apierror.Internal, "Failed to save backup").WithReason(err)
+		}
+		if err := os.WriteFile(filepath.Join(config.AppConfig.BackupDir, name), data, 0600); err != nil {
+			return apierror.New(500, apierror.Internal, "Failed to save backup").WithReason(err)
+		}
+		return c.Status(201).JSON(fiber.Map{"file": name, "size": len(data), "manifest": manifest})
+	}
+
+	c.Set("Content-Type", "application/octet-stream")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	return c.Send(data)
+}
+
+func buildBackup() ([]byte, backupManifest, error) {
+	manifest := backupManifest{Version: backupFormatVersion, CreatedAt: time.Now()}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	write := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	writeJSON := func(name string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return write(name, data)
+	}
+
+	if database.DB != nil {
+		manifest.Mode = database.Driver
+		for _, table := range database.Tables() {
+			dump, err := database.ExportTable(table)
+			if err != nil {
+				return nil, manifest, fmt.Errorf("export %s: %w", table, err)
+			}
+			if err := writeJSON(backupDatabaseDir+table+".json", dump); err != nil {
+				return nil, manifest, err
+			}
+			manifest.Tables = append(manifest.Tables, table)
+			manifest.Rows += len(dump.Rows)
+		}
+	} else {
+		manifest.Mode = backupModeMemory
+		configs, err := repo.Configs.List()
+		if err != nil {
+			return nil, manifest, fmt.Errorf("list configs: %w", err)
+		}
+		sessions, err := repo.Sessions.List()
+		if err != nil {
+			return nil, manifest, fmt.Errorf("list sessions: %w", err)
+		}
+
+		if err := writeJSON(backupConfigsFile, configs); err != nil {
+			return nil, manifest, err
+		}
+		if err := writeJSON(backupSessionsFile, sessions); err != nil {
+			return nil, manifest, err
+		}
+		manifest.Configs = len(configs)
+		manifest.Sessions = len(sessions)
+	}
+
+	store, err := backupStorage()
+	if err != nil {
+		return nil, manifest, err
+	}
+	objects, err := store.List("")
+	if err != nil {
+		return nil, manifest, fmt.Errorf("list storage: %w", err)
+	}
+	for _, object := range objects {
+		data, err := store.Get(object.Key)
+		if err != nil {
+			return nil, manifest, fmt.Errorf("read %s: %w", object.Key, err)
+		}
+		if err := write(backupStorageDir+object.Key, data); err != nil {
+			return nil, manifest, err
+		}
+		manifest.Objects++
+	}
+
+	if err := writeJSON(backupManifestFile, manifest); err != nil {
+		return nil, manifest, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, manifest, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, manifest, err
+	}
+	return buf.Bytes(), manifest, nil
+}
+
+// RestoreBackup rebuilds state from a backup, uploaded as the multipart field
+// "archive" or named by file in BACKUP_DIR. Database tables in the backup
+// replace the current ones; configs, sessions and storage objects are added
+// over what exists.
+func RestoreBackup(c *fiber.Ctx) error {
+	var req restoreRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	data, err := readBackupInput(c, req.File)
+	if err != nil {
+		return err
+	}
+	sealer, err := backupSealer(req.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.HasPrefix(data, []byte(backupMagic)) {
+		return apierror.New(422, apierror.ValidationFailed, "Not a backup archive")
+	}
+	archive, err := sealer.OpenBytes(data[len(backupMagic):])
+	if err != nil {
+		return apierror.New(422, apierror.ValidationFailed, "Failed to decrypt backup: wrong passphrase?")
+	}
+	entries, err := readBackupEntries(archive)
+	if err != nil {
+		return apierror.New(422, apierror.ValidationFailed, "Corrupt backup archive").WithReason(err)
+	}
+	var manifest backupManifest
+	if err := json.Unmarshal(entries[backupManifestFile], &manifest); err != nil || manifest.Version == 0 {
+		return apierror.New(422, apierror.ValidationFailed, "Backup archive has no manifest")
+	}
+	if manifest.Version > backupFormatVersion {
+		return apierror.New(422, apierror.ValidationFailed, "Backup was made by a newer version").WithReason(fmt.Sprintf("format version %d", manifest.Version))
+	}
+
+	result, err := restoreBackup(manifest, entries)
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to restore backup").WithReason(err)
+	}
+	log.Printf("Backup: restored %s backup from %s (%d tables, %d rows, %d configs, %d sessions, %d objects, %d warnings)",
+		result.Mode, result.BackupCreatedAt.Format(time.RFC3339), result.Tables, result.Rows, result.Configs, result.Sessions, result.Objects, len(result.Warnings))
+	return c.JSON(result)
+}
+
+func readBackupInput(c *fiber.Ctx, file string) ([]byte, error) {
+	if file != "" {
+		if file != filepath.Base(file) || strings.HasPrefix(file, ".") {
+			return nil, apierror.New(400, apierror.ValidationFailed, "Invalid backup file name")
+		}
+		data, err := os.ReadFile(filepath.Join(config.AppConfig.BackupDir, file))
+		if err != nil {
+			return nil, apierror.New(404, apierror.NotFound, "Backup file not found").WithReason(file)
+		}
+		return data, nil
+	}
+
+	fileHeader, err := c.FormFile("archive")
+	if err != nil {
+		return nil, apierror.New(400, apierror.ValidationFailed, "Multipart field 'archive' or a backup file name is required")
+	}
+	upload, err := fileHeader.Open()
+	if err != nil {
+		return nil, apierror.New(400, apierror.ValidationFailed, "Failed to read upload")
+	}
+	defer upload.Close()
+
+	data, err := io.ReadAll(upload)
+	if err != nil {
+		return nil, apierror.New(400, apierror.ValidationFailed, "Failed to read upload")
+	}
+	return data, nil
+}
+
+func readBackupEntries(archive []byte) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	entries := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		entries[header.Name] = data
+	}
+}
+
+func restoreBackup(manifest backupManifest, entries map[string][]byte) (*restoreResult, error) {
+	result := &restoreResult{Mode: manifest.Mode, BackupCreatedAt: manifest.CreatedAt, Warnings: make([]string, 0)}
+
+	var dumps []database.TableDump
+	for name, data := range entries {
+		if !strings.HasPrefix(name, backupDatabaseDir) {
+			continue
+		}
+		dump, err := database.DecodeTableDump(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", name, err)
+		}
+		dumps = append(dumps, *dump)
+	}
+	if len(dumps) > 0 {
+		if database.DB == nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%d database tables skipped: no database configured", len(dumps)))
+		} else {
+			rows, skipped, err := database.Import(dumps)
+			if err != nil {
+				return nil, err
+			}
+			result.Tables = len(dumps) - len(skippedTables(skipped))
+			result.Rows = rows
+			result.RestartRequired = true
+			for _, s := range skipped {
+				result.Warnings = append(result.Warnings, s+" is not in this version's schema and was skipped")
+			}
+		}
+	}
+
+	if data, ok := entries[backupConfigsFile]; ok {
+		var configs []*repo.Config
+		if err := json.Unmarshal(data, &configs); err != nil {
+			return nil, fmt.Errorf("decode configs: %w", err)
+		}
+		for _, config := range configs {
+			if err := repo.Configs.Save(config); err != nil {
+				return nil, fmt.Errorf("restore config %s: %w", config.ID, err)
+			}
+		}
+		result.Configs = len(configs)
+	}
+	if data, ok := entries[backupSessionsFile]; ok {
+		var sessions []*repo.Session
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			return nil, fmt.Errorf("decode sessions: %w", err)
+		}
+		for _, session := range sessions {
+			if err := repo.Sessions.Save(session); err != nil {
+				return nil, fmt.Errorf("restore session %s: %w", session.ID, err)
+			}
+		}
+		result.Sessions = len(sessions)
+	}
+
+	store, err := backupStorage()
+	if err != nil {
+		return nil, err
+	}
+	for name, data := range entries {
+		if !strings.HasPrefix(name, backupStorageDir) {
+			continue
+		}
+		key, err := storage.CleanKey(strings.TrimPrefix(name, backupStorageDir))
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("object %s skipped: %v", name, err))
+			continue
+		}
+		contentType := mime.TypeByExtension(path.Ext(key))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		if err := store.Put(key, data, contentType); err != nil {
+			return nil, fmt.Errorf("restore %s: %w", key, err)
+		}
+		result.Objects++
+	}
+	models.Findings.LoadFindings()
+	return result, nil
+}
+
+// skippedTables returns the skipped tables among Import's skipped items.
+func skippedTables(skipped []string) []string {
+	tables := make([]string, 0)
+	for _, s := range skipped {
+		if strings.HasPrefix(s, "table ") {
+			tables = append(tables, s)
+		}
+	}
+	return tables
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/benchmark"
+	"performa-backend/brain"
+	"performa-backend/jobs"
+	"performa-backend/openrouter"
+	"performa-backend/workspaces"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// InitBenchmarks restores the saved model benchmarks.
+func InitBenchmarks() {
+	benchmark.Default.Load()
+}
+
+// BenchmarkModels runs a prompt, or the cases of a canned suite, on several
+// models at once and returns how they compare on latency, cost, tokens and,
+// with score set, the quality the Brain gives their answers. With
+// ?async=true it runs as a background job instead.
+func BenchmarkModels(c *fiber.Ctx) error {
+	var req benchmark.Request
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if err := normalizeBenchmarkRequest(&req); err != nil {
+		return err
+	}
+
+	if c.QueryBool("async") {
+		return submitJob(c, jobKindModelBenchmark, &req)
+	}
+
+	actor := ""
+	if user := currentUser(c); user != nil {
+		actor = user.Username
+	}
+	return c.JSON(runModelBenchmark(req, currentWorkspace(c), actor))
+}
+
+// normalizeBenchmarkRequest drops blank and repeated models and checks that
+// the request names a known suite.
+func normalizeBenchmarkRequest(req *benchmark.Request) error {
+	seen := make(map[string]bool, len(req.Models))
+	models := make([]string, 0, len(req.Models))
+	for _, model := range req.Models {
+		model = strings.TrimSpace(model)
+		if model != "" && !seen[model] {
+			seen[model] = true
+			models = append(models, model)
+		}
+	}
+	if len(models) == 0 || len(models) > benchmark.MaxModels {
+		return apierror.New(400, apierror.ValidationFailed, fmt.Sprintf("models: between 1 and %d models are required", benchmark.MaxModels))
+	}
+	req.Models = models
+	req.Prompt = strings.TrimSpace(req.Prompt)
+
+	if _, ok := req.Cases(); !ok {
+		suites := make([]string, 0)
+		for name := range benchmark.Suites() {
+			suites = append(suites, name)
+		}
+		sort.Strings(suites)
+		return apierror.New(400, apierror.ValidationFailed, "Unknown benchmark suite").With("suite", req.Suite).With("suites", suites)
+	}
+	return nil
+}
+
+// runModelBenchmark runs a benchmark for a workspace and keeps its result.
+func runModelBenchmark(req benchmark.Request, workspaceID, actor string) *benchmark.Benchmark {
+	cases, _ := req.Cases()
+	chat := func(messages []openrouter.Message, model string) (string, openrouter.CallStats, error) {
+		return openrouter.ChatMeteredWithCredential(messages, model, req.CredentialID)
+	}
+	var score benchmark.ScoreFunc
+	if req.Score {
+		score = scoreBenchmarkResponse
+	}
+
+	result := benchmark.Execute(req, cases, chat, score)
+	result.WorkspaceID = workspaces.Normalize(workspaceID)
+	result.CreatedBy = actor
+	benchmark.Default.Add(result)
+	return result
+}
+
+// scoreBenchmarkResponse has the Brain evaluate a response against the
+// case's criteria.
+func scoreBenchmarkResponse(c benchmark.Case, model, response string) (float64, string, error) {
+	if !brainReachable() {
+		return 0, "", errBrainUnavailable
+	}
+	result, err := brainClient.EvaluateAction(&brain.EvaluateRequest{
+		Action: map[string]interface{}{
+			"type":     "model_response",
+			"name":     c.Name,
+			"model":    model,
+			"response": response,
+		},
+		Context: map[string]interface{}{
+			"task":     c.Prompt,
+			"criteria": c.Criteria,
+		},
+	})
+	if err != nil {
+		brainFailed(err)
+		return 0, "", err
+	}
+	return result.Score, result.Reasoning, nil
+}
+
+func runModelBenchmarkJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	var req benchmark.Request
+	if err := json.Unmarshal(job.Input, &req); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	if _, ok := req.Cases(); !ok || len(req.Models) == 0 {
+		return nil, fmt.Errorf("invalid input: no models or unknown suite")
+	}
+	return runModelBenchmark(req, job.WorkspaceID, job.CreatedBy), nil
+}
+
+// GetModelBenchmarks lists the workspace's benchmarks, most recent first,
+// with their comparison tables but not the responses.
+func GetModelBenchmarks(c *fiber.Ctx) error {
+	list := benchmark.Default.List(currentWorkspace(c))
+	summaries := make([]benchmark.Benchmark, 0, len(list))
+	for _, b := range list {
+		summary := *b
+		summary.Runs = nil
+		summaries = append(summaries, summary)
+	}
+	return c.JSON(fiber.Map{"benchmarks": summaries, "total": len(summaries)})
+}
+
+// GetModelBenchmark returns a benchmark with every response.
+func GetModelBenchmark(c *fiber.Ctx) error {
+	b := benchmark.Default.Get(c.Params("id"))
+	if b == nil || !inWorkspace(c, b.WorkspaceID) {
+		return apierror.New(404, apierror.NotFound, "Benchmark not found")
+	}
+	return c.JSON(b)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/timeline"
+	"performa-backend/ws"
+)
+
+// enforceBlackouts pauses the agents of the running operations that entered
+// a blackout window and resumes those of the operations whose window ended.
+// It runs on every scheduler tick.
+func enforceBlackouts(now time.Time) {
+	for _, op := range models.Operations.GetAllOperations() {
+		enforceOperationBlackout(op, now)
+	}
+}
+
+// enforceOperationBlackout applies the operation's blackout windows at now.
+// While a window holds, agents that run again, a finished agent started by
+// hand for instance, are paused too.
+func enforceOperationBlackout(op *models.Operation, now time.Time) {
+	active, until := op.Request.Blackout.Active(now)
+	if !active {
+		if op.BlackoutUntil != nil {
+			endBlackout(op)
+		}
+		return
+	}
+	if op.Status != models.OperationStatusRunning {
+		return
+	}
+
+	started := op.BlackoutUntil == nil
+	reason := fmt.Sprintf("blackout window until %s", until.Format(time.RFC3339))
+	paused := append([]string(nil), op.BlackoutAgents...)
+	for _, agent := range models.Manager.GetOperationAgents(op.ID) {
+		if models.Manager.PauseAgent(agent.ID) {
+			ws.BroadcastAgentUpdate(agent.ID, "paused", "Operation in a "+reason)
+			recordAgentStatus(agent, timeline.ActorSystem, models.AgentStatusPaused, reason)
+			paused = append(paused, agent.ID)
+		}
+	}
+	if !started && op.BlackoutUntil.Equal(until) && len(paused) == len(op.BlackoutAgents) {
+		return
+	}
+	models.Operations.SetBlackout(op.ID, &until, paused)
+	if !started {
+		return
+	}
+
+	summary := fmt.Sprintf("Blackout window started, %d agent(s) paused until %s", len(paused), until.Format(time.RFC3339))
+	ws.BroadcastWorkspaceMessage(op.WorkspaceID, "system", summary)
+	timeline.Record(timeline.Event{
+		OperationID: op.ID,
+		Type:        timeline.EventStatusChanged,
+		Summary:     summary,
+		Data: map[string]interface{}{
+			"scope":          "blackout",
+			"status":         "started",
+			"until":          until,
+			"agents_changed": len(paused),
+		},
+	})
+}
+
+// endBlackout resumes the agents the operation's blackout paused, leaving
+// those stopped or deleted in the meantime.
+func endBlackout(op *models.Operation) {
+	resumed := 0
+	for _, id := range op.BlackoutAgents {
+		if !models.Manager.ResumeAgent(id) {
+			continue
+		}
+		ws.BroadcastAgentUpdate(id, "resumed", "Blackout window ended")
+		if agent := models.Manager.GetAgent(id); agent != nil {
+			recordAgentStatus(agent, timeline.ActorSystem, models.AgentStatusRunning, "blackout window ended")
+		}
+		resumed++
+	}
+	models.Operations.SetBlackout(op.ID, nil, nil)
+
+	summary := fmt.Sprintf("Blackout window ended, %d agent(s) resumed", resumed)
+	ws.BroadcastWorkspaceMessage(op.WorkspaceID, "system", summary)
+	timeline.Record(timeline.Event{
+		OperationID: op.ID,
+		Type:        timeline.EventStatusChanged,
+		Summary:     summary,
+		Data: map[string]interface{}{
+			"scope":          "blackout",
+			"status":         "ended",
+			"agents_changed": resumed,
+		},
+	})
+}
+
+// CheckBlackout returns a 409 error when the agent's operation is in a
+// blackout window, in which its agents cannot be resumed or started by hand.
+func CheckBlackout(agentID string) *apierror.Error {
+	agent := models.Manager.GetAgent(agentID)
+	if agent == nil {
+		return nil
+	}
+	op := models.Operations.GetOperation(agent.OperationID)
+	if op == nil {
+		return nil
+	}
+	active, until := op.Request.Blackout.Active(time.Now())
+	if !active {
+		return nil
+	}
+	return apierror.New(409, apierror.Conflict,
+		fmt.Sprintf("Operation is in a blackout window until %s; its agents cannot be resumed before then", until.Format(time.RFC3339))).
+		With("operation_id", op.ID).
+		With("blackout_until", until)
+}
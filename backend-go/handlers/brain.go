@@ -1,11 +1,14 @@
 package handlers
 
 import (
+        "errors"
         "log"
         "time"
 
+        "performa-backend/apierror"
         "performa-backend/brain"
         "performa-backend/config"
+        "performa-backend/models"
 
         "github.com/gofiber/fiber/v2"
 )
@@ -13,42 +16,107 @@ import (
 var brainClient *brain.BrainClient
 var brainAvailable bool = false
 
+var errBrainUnavailable = errors.New("brain service unavailable")
+
+// brainRecoveryInterval is how often an unavailable Brain is probed.
+const brainRecoveryInterval = 30 * time.Second
+
 func InitBrainClient() {
+        brain.Responses.Configure(config.AppConfig.BrainCacheSize,
+                time.Duration(config.AppConfig.BrainCacheTTLMinutes)*time.Minute)
+        connectBrainClient()
+        learningFeedback = brain.NewFeedbackBatcher(
+                brainClient,
+                config.AppConfig.BrainLearningEnabled,
+                config.AppConfig.BrainLearningBatchSize,
+                time.Duration(config.AppConfig.BrainLearningFlushSeconds)*time.Second,
+        )
+        go watchBrainRecovery()
+}
+
+// watchBrainRecovery probes the Brain while it is marked unavailable and,
+// once it answers again, marks it available and replays the Learn calls
+// queued during the outage.
+func watchBrainRecovery() {
+        ticker := time.NewTicker(brainRecoveryInterval)
+        defer ticker.Stop()
+        for range ticker.C {
+                client := brainClient
+                if brainAvailable || client == nil || !client.IsHealthy() {
+                        continue
+                }
+                log.Println("Brain service recovered")
+                brainRecovered()
+        }
+}
+
+// brainRecovered marks the Brain available and replays queued Learn calls.
+func brainRecovered() {
+        brainAvailable = true
+        if learningFeedback != nil {
+                go learningFeedback.Flush()
+        }
+}
+
+// brainFailed marks the Brain unavailable when err means it could not
+// answer.
+func brainFailed(err error) {
+        if brain.IsOutage(err) {
+                brainAvailable = false
+        }
+}
+
+// connectBrainClient (re)creates the Brain client for the configured service
+// URL and waits for it to become healthy in the background.
+func connectBrainClient() {
         brainClient = brain.NewBrainClient(config.AppConfig.BrainServiceURL)
-        
+        brainAvailable = false
+        client := brainClient
+
         go func() {
                 log.Println("Waiting for Brain service to become available...")
-                err := brainClient.WaitForHealthy(30, 2*time.Second)
+                err := client.WaitForHealthy(30, 2*time.Second)
                 if err != nil {
                         log.Printf("Warning: Brain service not available: %v", err)
                         brainAvailable = false
                 } else {
                         log.Println("Brain service is healthy and ready")
-                        brainAvailable = true
+                        brainRecovered()
                 }
         }()
 }
 
 func checkBrainAvailable(c *fiber.Ctx) error {
         if brainClient == nil {
-                return c.Status(500).JSON(fiber.Map{
-                        "error": "Brain client not initialized",
-                })
+                return apierror.New(500, apierror.BrainUnavailable, "Brain client not initialized")
         }
         
         if !brainAvailable {
                 if brainClient.IsHealthy() {
                         brainAvailable = true
                 } else {
-                        return c.Status(503).JSON(fiber.Map{
-                                "error":   "Brain service temporarily unavailable",
-                                "message": "The AI intelligence service is starting up or unavailable",
-                        })
+                        return brainUnavailable(c)
                 }
         }
         return nil
 }
 
+// brainReachable reports whether the Brain is available, probing it when it
+// was marked unavailable.
+func brainReachable() bool {
+        if brainClient == nil {
+                return false
+        }
+        if !brainAvailable && brainClient.IsHealthy() {
+                brainAvailable = true
+        }
+        return brainAvailable
+}
+
+func brainUnavailable(c *fiber.Ctx) error {
+        return apierror.New(503, apierror.BrainUnavailable, "Brain service temporarily unavailable").With("message", "The AI intelligence service is starting up or unavailable")
+}
+
 func GetBrainStatus(c *fiber.Ctx) error {
         if err := checkBrainAvailable(c); err != nil {
                 return err
@@ -57,10 +125,7 @@ func GetBrainStatus(c *fiber.Ctx) error {
         status, err := brainClient.GetStatus()
         if err != nil {
                 brainAvailable = false
-                return c.Status(503).JSON(fiber.Map{
-                        "error":   "Brain service unavailable",
-                        "details": err.Error(),
-                })
+                return apierror.New(503, apierror.BrainUnavailable, "Brain service unavailable").WithReason(err)
         }
 
         return c.JSON(status)
@@ -68,69 +133,81 @@ func GetBrainStatus(c *fiber.Ctx) error {
 
 func BrainHealth(c *fiber.Ctx) error {
         if brainClient == nil {
-                return c.Status(500).JSON(fiber.Map{
-                        "error": "Brain client not initialized",
-                })
+                return apierror.New(500, apierror.BrainUnavailable, "Brain client not initialized")
         }
 
         health, err := brainClient.Health()
         if err != nil {
                 brainAvailable = false
-                return c.Status(503).JSON(fiber.Map{
-                        "status":  "unhealthy",
-                        "error":   err.Error(),
-                })
+                return apierror.New(503, apierror.BrainUnavailable, err.Error()).With("status", "unhealthy")
         }
 
         brainAvailable = true
         return c.JSON(health)
 }
 
+// BrainThink asks the Brain to think about a situation. With ?async=true it
+// answers 202 with a job to poll at /api/jobs/:id instead of waiting.
 func BrainThink(c *fiber.Ctx) error {
-        if err := checkBrainAvailable(c); err != nil {
+        var req brain.ThinkRequest
+        if err := parseBody(c, &req); err != nil {
                 return err
         }
+        if c.QueryBool("async") {
+                return submitJob(c, jobKindBrainThink, &req)
+        }
 
-        var req brain.ThinkRequest
-        if err := c.BodyParser(&req); err != nil {
-                return c.Status(400).JSON(fiber.Map{
-                        "error": "Invalid request body",
-                })
+        if !brainReachable() {
+                return brainUnavailable(c)
         }
 
         result, err := brainClient.Think(&req)
         if err != nil {
                 brainAvailable = false
-                return c.Status(500).JSON(fiber.Map{
-                        "error":   "Brain thinking failed",
-                        "details": err.Error(),
-                })
+                return apierror.New(500, apierror.Internal, "Brain thinking failed").WithReason(err)
         }
 
         return c.JSON(result)
 }
 
+// BrainClassify classifies a threat. While the Brain is unavailable, the
+// last classification of the same request is returned with "stale": true.
 func BrainClassify(c *fiber.Ctx) error {
-        if err := checkBrainAvailable(c); err != nil {
+        var req brain.ClassifyRequest
+        if err := parseBody(c, &req); err != nil {
                 return err
         }
 
-        var req brain.ClassifyRequest
-        if err := c.BodyParser(&req); err != nil {
-                return c.Status(400).JSON(fiber.Map{
-                        "error": "Invalid request body",
-                })
+        if !brainReachable() {
+                result, _, ok := brain.CachedClassifyThreat(&req)
+                if !ok {
+                        return brainUnavailable(c)
+                }
+                return c.JSON(withInferredCWE(result, req.Description))
         }
 
         result, err := brainClient.ClassifyThreat(&req)
         if err != nil {
-                return c.Status(500).JSON(fiber.Map{
-                        "error":   "Classification failed",
-                        "details": err.Error(),
-                })
+                brainFailed(err)
+                status := 500
+                if brain.IsOutage(err) {
+                        status = 503
+                }
+                return apierror.Status(status, "Classification failed").WithReason(err)
         }
 
-        return c.JSON(result)
+        return c.JSON(withInferredCWE(result, req.Description))
+}
+
+// withInferredCWE fills in the CWE and OWASP category the Brain left blank.
+func withInferredCWE(result *brain.ClassifyResponse, description string) *brain.ClassifyResponse {
+        if result.CWE == "" {
+                result.CWE = models.InferCWE(result.VulnerabilityType + " " + description)
+        }
+        if result.OWASPCategory == "" && result.CWE != "" {
+                result.OWASPCategory = models.OWASPForCWE(result.CWE)
+        }
+        return result
 }
 
 func BrainEvaluate(c *fiber.Ctx) error {
@@ -139,46 +216,56 @@ func BrainEvaluate(c *fiber.Ctx) error {
         }
 
         var req brain.EvaluateRequest
-        if err := c.BodyParser(&req); err != nil {
-                return c.Status(400).JSON(fiber.Map{
-                        "error": "Invalid request body",
-                })
+        if err := parseBody(c, &req); err != nil {
+                return err
         }
 
         result, err := brainClient.EvaluateAction(&req)
         if err != nil {
-                return c.Status(500).JSON(fiber.Map{
-                        "error":   "Evaluation failed",
-                        "details": err.Error(),
-                })
+                return apierror.New(500, apierror.Internal, "Evaluation failed").WithReason(err)
         }
 
         return c.JSON(result)
 }
 
+// BrainStrategy generates a strategy. While the Brain is unavailable, the
+// last strategy generated for the same request is returned with
+// "stale": true.
 func BrainStrategy(c *fiber.Ctx) error {
-        if err := checkBrainAvailable(c); err != nil {
+        var req brain.StrategyRequest
+        if err := parseBody(c, &req); err != nil {
                 return err
         }
 
-        var req brain.StrategyRequest
-        if err := c.BodyParser(&req); err != nil {
-                return c.Status(400).JSON(fiber.Map{
-                        "error": "Invalid request body",
-                })
+        if !brainReachable() {
+                result, ok := brain.CachedStrategy(&req)
+                if !ok {
+                        return brainUnavailable(c)
+                }
+                return c.JSON(result)
         }
 
         result, err := brainClient.GenerateStrategy(&req)
         if err != nil {
-                return c.Status(500).JSON(fiber.Map{
-                        "error":   "Strategy generation failed",
-                        "details": err.Error(),
-                })
+                brainFailed(err)
+                status := 500
+                if brain.IsOutage(err) {
+                        status = 503
+                }
+                return apierror.Status(status, "Strategy generation failed").WithReason(err)
         }
 
         return c.JSON(result)
 }
 
+// GetBrainCache reports the Brain response cache served during outages.
+func GetBrainCache(c *fiber.Ctx) error {
+        return c.JSON(fiber.Map{
+                "available": brainAvailable,
+                "cache":     brain.Responses.Stats(),
+        })
+}
+
 func BrainModels(c *fiber.Ctx) error {
         if err := checkBrainAvailable(c); err != nil {
                 return err
@@ -186,10 +273,7 @@ func BrainModels(c *fiber.Ctx) error {
 
         models, err := brainClient.GetModels()
         if err != nil {
-                return c.Status(500).JSON(fiber.Map{
-                        "error":   "Failed to get models",
-                        "details": err.Error(),
-                })
+                return apierror.New(500, apierror.Internal, "Failed to get models").WithReason(err)
         }
 
         return c.JSON(fiber.Map{
@@ -197,28 +281,35 @@ func BrainModels(c *fiber.Ctx) error {
         })
 }
 
+// BrainLearn reports an action's outcome to the Brain. While the Brain is
+// unavailable, the call is queued and replayed once it recovers.
 func BrainLearn(c *fiber.Ctx) error {
-        if err := checkBrainAvailable(c); err != nil {
-                return err
+        if brainClient == nil {
+                return apierror.New(500, apierror.BrainUnavailable, "Brain client not initialized")
         }
 
         var req struct {
-                Action  map[string]interface{} `json:"action"`
-                Outcome map[string]interface{} `json:"outcome"`
+                Action  map[string]interface{} `json:"action" validate:"required"`
+                Outcome map[string]interface{} `json:"outcome" validate:"required"`
         }
-        if err := c.BodyParser(&req); err != nil {
-                return c.Status(400).JSON(fiber.Map{
-                        "error": "Invalid request body",
-                })
+        if err := parseBody(c, &req); err != nil {
+                return err
         }
 
-        err := brainClient.Learn(req.Action, req.Outcome)
-        if err != nil {
-                return c.Status(500).JSON(fiber.Map{
-                        "error":   "Learning failed",
-                        "details": err.Error(),
+        err := errBrainUnavailable
+        if brainReachable() {
+                err = brainClient.Learn(req.Action, req.Outcome)
+                brainFailed(err)
+        }
+        if brain.IsOutage(err) && learningFeedback != nil {
+                learningFeedback.Replay(req.Action, req.Outcome)
+                return c.Status(202).JSON(fiber.Map{
+                        "status": "queued",
                 })
         }
+        if err != nil {
+                return apierror.New(500, apierror.Internal, "Learning failed").WithReason(err)
+        }
 
         return c.JSON(fiber.Map{
                 "status": "learned",
@@ -232,10 +323,7 @@ func BrainReset(c *fiber.Ctx) error {
 
         err := brainClient.Reset()
         if err != nil {
-                return c.Status(500).JSON(fiber.Map{
-                        "error":   "Reset failed",
-                        "details": err.Error(),
-                })
+                return apierror.New(500, apierror.Internal, "Reset failed").WithReason(err)
         }
 
         return c.JSON(fiber.Map{
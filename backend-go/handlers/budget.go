@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"fmt"
+
+	"performa-backend/apierror"
+	"performa-backend/executor"
+	"performa-backend/models"
+	"performa-backend/openrouter"
+	"performa-backend/timeline"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BudgetStatus is an operation's budget with what its agents spent. A
+// remaining amount is nil when it is not limited.
+type BudgetStatus struct {
+	State            string   `json:"state"`
+	PreviousState    string   `json:"previous_state,omitempty"`
+	MaxTokens        int64    `json:"max_tokens,omitempty"`
+	MaxCostUSD       float64  `json:"max_cost_usd,omitempty"`
+	UsedTokens       int64    `json:"used_tokens"`
+	UsedCostUSD      float64  `json:"used_cost_usd"`
+	RemainingTokens  *int64   `json:"remaining_tokens,omitempty"`
+	RemainingCostUSD *float64 `json:"remaining_cost_usd,omitempty"`
+	UsedFraction     float64  `json:"used_fraction"`
+	Calls            int      `json:"calls"`
+}
+
+func budgetStatus(operationID string, budget *models.Budget, state string) BudgetStatus {
+	spend, _ := openrouter.Spending.Get(operationID)
+	status := BudgetStatus{
+		State:        state,
+		UsedTokens:   spend.Tokens(),
+		UsedCostUSD:  spend.CostUSD,
+		UsedFraction: budget.Used(spend.Tokens(), spend.CostUSD),
+		Calls:        spend.Calls,
+	}
+	if budget == nil {
+		return status
+	}
+	status.MaxTokens, status.MaxCostUSD = budget.MaxTokens, budget.MaxCostUSD
+	if budget.MaxTokens > 0 {
+		remaining := budget.MaxTokens - spend.Tokens()
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.RemainingTokens = &remaining
+	}
+	if budget.MaxCostUSD > 0 {
+		remaining := budget.MaxCostUSD - spend.CostUSD
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.RemainingCostUSD = &remaining
+	}
+	return status
+}
+
+// chargeAgentCall charges one of an agent's model calls to its operation and
+// enforces the operation's budget. It reports whether the budget is spent, in
+// which case the agent has been stopped.
+func chargeAgentCall(agent *models.Agent, stats openrouter.CallStats) bool {
+	if agent.OperationID == "" {
+		return false
+	}
+	openrouter.Spending.Charge(agent.OperationID, stats)
+	return enforceBudget(agent.OperationID) == models.BudgetStateExhausted
+}
+
+// enforceBudget moves an operation to the budget state of its spend and
+// returns it. Reaching the warning threshold pauses the operation's running
+// agents and spending the budget stops them; each change is broadcast and
+// recorded on the operation's timeline.
+func enforceBudget(operationID string) string {
+	op := models.Operations.GetOperation(operationID)
+	if op == nil {
+		return ""
+	}
+	budget := op.Request.Budget
+	spend, _ := openrouter.Spending.Get(operationID)
+	state := budget.State(spend.Tokens(), spend.CostUSD)
+	previous, _ := models.Operations.SetBudgetState(operationID, state)
+	if state == previous {
+		return state
+	}
+
+	var affected int
+	switch {
+	case state == models.BudgetStateExhausted:
+		for _, agent := range models.Manager.GetOperationAgents(operationID) {
+			if stopAgentForBudget(agent) {
+				affected++
+			}
+		}
+	case state == models.BudgetStateWarning && previous == models.BudgetStateOK:
+		for _, agent := range models.Manager.GetOperationAgents(operationID) {
+			if models.Manager.PauseAgent(agent.ID) {
+				ws.BroadcastAgentUpdate(agent.ID, "paused", "Operation budget almost spent")
+				recordAgentStatus(agent, timeline.ActorSystem, models.AgentStatusPaused, "operation budget almost spent")
+				affected++
+			}
+		}
+	}
+
+	status := budgetStatus(operationID, budget, state)
+	status.PreviousState = previous
+	ws.BroadcastBudget(op.WorkspaceID, operationID, status)
+	timeline.Record(timeline.Event{
+		OperationID: operationID,
+		Type:        timeline.EventStatusChanged,
+		Summary:     budgetSummary(state, previous, status, affected),
+		Data: map[string]interface{}{
+			"scope":          "budget",
+			"status":         state,
+			"previous":       previous,
+			"used_fraction":  status.UsedFraction,
+			"agents_changed": affected,
+		},
+	})
+	return state
+}
+
+func budgetSummary(state, previous string, status BudgetStatus, affected int) string {
+	used := fmt.Sprintf("%.0f%% of the budget used", status.UsedFraction*100)
+	switch state {
+	case models.BudgetStateExhausted:
+		return fmt.Sprintf("Budget exhausted (%s), %d agent(s) stopped", used, affected)
+	case models.BudgetStateWarning:
+		if affected > 0 {
+			return fmt.Sprintf("Budget almost spent (%s), %d agent(s) paused", used, affected)
+		}
+		return fmt.Sprintf("Budget almost spent (%s)", used)
+	case "":
+		return "Budget removed"
+	}
+	if previous == "" {
+		return fmt.Sprintf("Budget set (%s)", used)
+	}
+	return fmt.Sprintf("Budget available again (%s)", used)
+}
+
+// stopAgentForBudget stops an agent whose operation spent its budget.
+func stopAgentForBudget(agent *models.Agent) bool {
+	if !models.Manager.StopAgent(agent.ID) {
+		return false
+	}
+	executor.Kill(agent.ID)
+	ws.BroadcastAgentUpdate(agent.ID, "stopped", "Operation budget exhausted")
+	recordAgentStatus(agent, timeline.ActorSystem, models.AgentStatusStopped, "operation budget exhausted")
+	return true
+}
+
+// budgetExhausted reports whether the agent's operation spent its budget, so
+// that it must not make another model call.
+func budgetExhausted(agent *models.Agent) bool {
+	op := models.Operations.GetOperation(agent.OperationID)
+	return op != nil && op.BudgetState == models.BudgetStateExhausted
+}
+
+// UpdateOperationBudget replaces an operation's budget, e.g. to raise it
+// after its agents were paused or stopped. Paused agents stay paused until
+// they are resumed.
+func UpdateOperationBudget(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Operations.GetOperation(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+
+	var budget models.Budget
+	if err := parseBody(c, &budget); err != nil {
+		return err
+	}
+	if err := budget.Validate(); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid budget").WithReason(err)
+	}
+
+	var updated *models.Budget
+	if budget.Enabled() {
+		updated = &budget
+	}
+	models.Operations.SetBudget(id, updated)
+	state := enforceBudget(id)
+	return c.JSON(budgetStatus(id, updated, state))
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/repo"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	bundleFormat  = "performa-bundle"
+	bundleVersion = 1
+
+	bundleKindConfig  = "config"
+	bundleKindSession = "session"
+)
+
+// Bundle is a portable, versioned export of a saved config or session. The
+// checksum covers the canonical JSON encoding of the payload, so bundles stay
+// valid when reformatted.
+type Bundle struct {
+	Format     string          `json:"format"`
+	Version    int             `json:"version"`
+	Kind       string          `json:"kind"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Checksum   string          `json:"checksum"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type BundleImportRequest struct {
+	Bundle
+	// OnConflict decides what happens when the bundle's ID already exists:
+	// "rename" (default) imports under a new ID, "overwrite" replaces the
+	// existing record and "fail" rejects the import.
+	OnConflict string `json:"on_conflict"`
+}
+
+func payloadChecksum(payload json.RawMessage) (string, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return "", err
+	}
+	canonical, err := json.Marshal(decoded)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func newBundle(kind string, payload interface{}) (*Bundle, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := payloadChecksum(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{
+		Format:     bundleFormat,
+		Version:    bundleVersion,
+		Kind:       kind,
+		ExportedAt: time.Now().UTC(),
+		Checksum:   checksum,
+		Payload:    raw,
+	}, nil
+}
+
+// verifyBundle checks the envelope and checksum of an uploaded bundle.
+func verifyBundle(bundle Bundle, kind string) error {
+	if bundle.Format != bundleFormat {
+		return fmt.Errorf("not a %s file", bundleFormat)
+	}
+	if bundle.Version < 1 || bundle.Version > bundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	if bundle.Kind != kind {
+		return fmt.Errorf("expected a %s bundle, got %q", kind, bundle.Kind)
+	}
+	if len(bundle.Payload) == 0 {
+		return fmt.Errorf("bundle has no payload")
+	}
+	checksum, err := payloadChecksum(bundle.Payload)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %v", err)
+	}
+	if checksum != bundle.Checksum {
+		return fmt.Errorf("checksum mismatch: bundle was modified or corrupted")
+	}
+	return nil
+}
+
+// parseBundleImport reads and verifies an import request body.
+func parseBundleImport(c *fiber.Ctx, kind string) (*BundleImportRequest, error) {
+	var req BundleImportRequest
+	if err := parseBody(c, &req); err != nil {
+		return nil, err
+	}
+	if req.OnConflict == "" {
+		req.OnConflict = c.Query("on_conflict", "rename")
+	}
+	switch req.OnConflict {
+	case "rename", "overwrite", "fail":
+	default:
+		return nil, apierror.New(400, apierror.ValidationFailed, "on_conflict must be one of rename, overwrite, fail")
+	}
+	if err := verifyBundle(req.Bundle, kind); err != nil {
+		return nil, apierror.New(422, apierror.ValidationFailed, "Invalid bundle").WithReason(err)
+	}
+	return &req, nil
+}
+
+// importPolicy returns the conflict policy for an imported record whose ID is
+// taken by a record of workspace. A record of another workspace is never
+// overwritten nor reported: the import always gets a new ID.
+func importPolicy(c *fiber.Ctx, workspace, policy string) string {
+	if !inWorkspace(c, workspace) {
+		return "rename"
+	}
+	return policy
+}
+
+// resolveImportID applies the conflict policy to an imported record's ID. It
+// returns the ID to store under and whether the import must be rejected.
+func resolveImportID(id string, exists bool, policy string) (string, bool) {
+	switch {
+	case id == "":
+		return uuid.New().String(), false
+	case !exists || policy == "overwrite":
+		return id, false
+	case policy == "fail":
+		return id, true
+	default:
+		return uuid.New().String(), false
+	}
+}
+
+func sendBundle(c *fiber.Ctx, bundle *Bundle, name string) error {
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	return c.JSON(bundle)
+}
+
+func ExportConfig(c *fiber.Ctx) error {
+	config := resolveSavedConfig(c.Params("id"))
+	if config == nil {
+		return apierror.New(404, apierror.NotFound, "Config not found")
+	}
+
+	bundle, err := newBundle(bundleKindConfig, config)
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to export config").WithReason(err)
+	}
+	return sendBundle(c, bundle, "config-"+config.ID+".json")
+}
+
+func ImportConfig(c *fiber.Ctx) error {
+	req, err := parseBundleImport(c, bundleKindConfig)
+	if req == nil {
+		return err
+	}
+
+	var config repo.Config
+	if err := json.Unmarshal(req.Payload, &config); err != nil {
+		return apierror.New(422, apierror.ValidationFailed, "Invalid bundle").WithReason(err)
+	}
+	if problems := validateMissionConfig(missionConfigFromSaved(&config)); len(problems) > 0 {
+		return configValidationError(c, problems)
+	}
+
+	originalID := config.ID
+	policy := req.OnConflict
+	existing := findSavedConfig(config.ID)
+	if existing != nil {
+		policy = importPolicy(c, existing.WorkspaceID, policy)
+	}
+	id, conflict := resolveImportID(config.ID, existing != nil, policy)
+	if conflict {
+		return apierror.New(409, apierror.Conflict, "A config with this ID already exists").With("config_id", originalID)
+	}
+
+	now := time.Now()
+	config.ID = id
+	if config.CreatedAt.IsZero() {
+		config.CreatedAt = now
+	}
+	config.UpdatedAt = now
+	config.OwnerID = currentUserID(c)
+	config.WorkspaceID = currentWorkspace(c)
+	storeSavedConfig(&config)
+
+	return c.Status(201).JSON(fiber.Map{
+		"status":      "imported",
+		"config_id":   config.ID,
+		"original_id": originalID,
+		"renamed":     originalID != "" && originalID != config.ID,
+		"config":      &config,
+	})
+}
+
+// ExportSession downloads a session as a bundle. With ?async=true it
+// answers 202 with a job whose result is the bundle.
+func ExportSession(c *fiber.Ctx) error {
+	session := findSession(c.Params("id"))
+	if session == nil {
+		return apierror.New(404, apierror.NotFound, "Session not found")
+	}
+	if c.QueryBool("async") {
+		return submitJob(c, jobKindSessionExport, fiber.Map{"session_id": session.ID})
+	}
+
+	bundle, err := newBundle(bundleKindSession, session)
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to export session").WithReason(err)
+	}
+	return sendBundle(c, bundle, "session-"+session.ID+".json")
+}
+
+func ImportSession(c *fiber.Ctx) error {
+	req, err := parseBundleImport(c, bundleKindSession)
+	if req == nil {
+		return err
+	}
+
+	var session repo.Session
+	if err := json.Unmarshal(req.Payload, &session); err != nil {
+		return apierror.New(422, apierror.ValidationFailed, "Invalid bundle").WithReason(err)
+	}
+
+	originalID := session.ID
+	policy := req.OnConflict
+	existing := findSession(session.ID)
+	if existing != nil {
+		policy = importPolicy(c, existing.WorkspaceID, policy)
+	}
+	id, conflict := resolveImportID(session.ID, existing != nil, policy)
+	if conflict {
+		return apierror.New(409, apierror.Conflict, "A session with this ID already exists").With("session_id", originalID)
+	}
+
+	now := time.Now()
+	session.ID = id
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+	session.UpdatedAt = now
+	session.OwnerID = currentUserID(c)
+	session.WorkspaceID = currentWorkspace(c)
+	storeSession(&session)
+
+	return c.Status(201).JSON(fiber.Map{
+		"status":      "imported",
+		"session_id":  session.ID,
+		"original_id": originalID,
+		"renamed":     originalID != "" && originalID != session.ID,
+	})
+}
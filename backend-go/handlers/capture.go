@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/capture"
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/stealth"
+	"performa-backend/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultCapturesLimit = 100
+	maxCapturesLimit     = 1000
+	// maxAutoLinkedCaptures bounds the exchanges attached to a finding
+	// because it mentions their URL.
+	maxAutoLinkedCaptures = 5
+)
+
+// InitCapture applies the capture proxy settings. The proxy itself starts
+// when the first operation captures traffic.
+func InitCapture() {
+	cfg := config.AppConfig
+	capture.Exchanges.Configure(cfg.CaptureMaxExchanges, cfg.CaptureMaxBodyBytes, cfg.CaptureRedactHeaders)
+	capture.Default.Configure(cfg.CaptureProxyAddr, cfg.CaptureCADir)
+}
+
+// agentCapture returns the capture proxy URL and CA file the agent's web
+// tools use, or empty strings when its operation does not capture traffic or
+// the proxy cannot be started.
+func agentCapture(agent *models.Agent, req models.StartRequest, route *stealth.Route, pacer *stealth.Pacer) (string, string) {
+	if !req.CaptureTraffic {
+		return "", ""
+	}
+	proxyURL, caFile, err := capture.Default.Session(agent.OperationID, agent.ID, route, pacer)
+	if err != nil {
+		log.Printf("Capture: traffic of agent %s is not captured: %v", agent.ID, err)
+		return "", ""
+	}
+	return proxyURL, caFile
+}
+
+func captureAttachmentKey(findingID, exchangeID string) string {
+	return attachmentPrefix(findingID) + "capture-" + exchangeID + ".har"
+}
+
+// attachCapture stores an exchange as a HAR attachment of a finding and
+// links the two.
+func attachCapture(finding *models.Finding, exchange *capture.Exchange) (*capture.Exchange, string, error) {
+	if storage.Default == nil {
+		return nil, "", fmt.Errorf("storage backend not configured")
+	}
+	linked := capture.Exchanges.Link(exchange.ID, finding.ID)
+	if linked == nil {
+		return nil, "", fmt.Errorf("exchange %s is no longer captured", exchange.ID)
+	}
+
+	data, _ := json.MarshalIndent(capture.NewHAR([]*capture.Exchange{linked}), "", "  ")
+	key := captureAttachmentKey(finding.ID, exchange.ID)
+	if err := storage.Default.Put(key, data, "application/json"); err != nil {
+		return nil, "", err
+	}
+	return linked, key, nil
+}
+
+// captureMentionURL is the part of an exchange's URL a finding has to
+// mention for the exchange to be evidence of it.
+func captureMentionURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	u.RawQuery, u.Fragment = "", ""
+	if u.Path == "/" {
+		u.Path = ""
+	}
+	return u.String()
+}
+
+// linkFindingCaptures attaches to a finding the most recent exchanges of its
+// agent whose URL the finding mentions.
+func linkFindingCaptures(finding *models.Finding) {
+	if finding.AgentID == "" || storage.Default == nil {
+		return
+	}
+	agent := models.Manager.GetAgent(finding.AgentID)
+	if agent == nil {
+		return
+	}
+
+	text := strings.Join([]string{finding.Title, finding.Description, finding.Evidence}, "\n")
+	exchanges, _ := capture.Exchanges.List(capture.Filter{OperationID: agent.OperationID, AgentID: agent.ID})
+	linked := 0
+	for _, exchange := range exchanges {
+		if linked == maxAutoLinkedCaptures {
+			break
+		}
+		mention := captureMentionURL(exchange.Request.URL)
+		if mention == "" || !strings.Contains(text, mention) {
+			continue
+		}
+		if _, _, err := attachCapture(finding, exchange); err != nil {
+			log.Printf("Capture: failed to attach exchange %s to finding %s: %v", exchange.ID, finding.ID, err)
+			continue
+		}
+		linked++
+	}
+}
+
+// captureInWorkspace returns the exchange with the given ID when it belongs
+// to an operation of the request's workspace.
+func captureInWorkspace(c *fiber.Ctx, id string) *capture.Exchange {
+	exchange := capture.Exchanges.Get(id)
+	if exchange == nil || !inWorkspace(c, operationWorkspace(exchange.OperationID)) {
+		return nil
+	}
+	return exchange
+}
+
+// GetOperationCaptures lists the exchanges captured for an operation, most
+// recent first, optionally filtered by ?agent_id and by ?q in the URL.
+func GetOperationCaptures(c *fiber.Ctx) error {
+	filter := capture.Filter{
+		OperationID: c.Params("id"),
+		AgentID:     c.Query("agent_id"),
+		Query:       c.Query("q"),
+		Limit:       c.QueryInt("limit", defaultCapturesLimit),
+		Offset:      c.QueryInt("offset", 0),
+	}
+	if filter.Limit <= 0 || filter.Limit > maxCapturesLimit {
+		filter.Limit = defaultCapturesLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	exchanges, total := capture.Exchanges.List(filter)
+	summaries := make([]capture.Summary, 0, len(exchanges))
+	for _, exchange := range exchanges {
+		summaries = append(summaries, exchange.Summary())
+	}
+	return c.JSON(fiber.Map{
+		"captures": summaries,
+		"total":    total,
+		"limit":    filter.Limit,
+		"offset":   filter.Offset,
+		"has_more": filter.Offset+len(summaries) < total,
+	})
+}
+
+// ExportOperationCaptures downloads the exchanges captured for an operation,
+// filtered like GetOperationCaptures, as a HAR file in the order they were
+// sent.
+func ExportOperationCaptures(c *fiber.Ctx) error {
+	id := c.Params("id")
+	exchanges, _ := capture.Exchanges.List(capture.Filter{
+		OperationID: id,
+		AgentID:     c.Query("agent_id"),
+		Query:       c.Query("q"),
+	})
+	for i, j := 0, len(exchanges)-1; i < j; i, j = i+1, j-1 {
+		exchanges[i], exchanges[j] = exchanges[j], exchanges[i]
+	}
+
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"operation-%s.har\"", id))
+	return c.JSON(capture.NewHAR(exchanges))
+}
+
+// GetCapture returns a captured exchange with its headers and bodies.
+func GetCapture(c *fiber.Ctx) error {
+	exchange := captureInWorkspace(c, c.Params("id"))
+	if exchange == nil {
+		return apierror.New(404, apierror.NotFound, "Capture not found")
+	}
+	return c.JSON(exchange)
+}
+
+// GetCaptureCA downloads the certificate of the CA the capture proxy signs
+// intercepted HTTPS connections with.
+func GetCaptureCA(c *fiber.Ctx) error {
+	cert, _, err := capture.Default.CACertificate()
+	if err != nil {
+		return apierror.New(503, apierror.ServiceUnavailable, "Capture proxy unavailable").WithReason(err)
+	}
+	c.Set(fiber.HeaderContentType, "application/x-pem-file")
+	c.Set(fiber.HeaderContentDisposition, "attachment; filename=\"performa-capture-ca.pem\"")
+	return c.Send(cert)
+}
+
+// LinkFindingCaptures attaches captured exchanges to a finding as HAR
+// evidence.
+func LinkFindingCaptures(c *fiber.Ctx) error {
+	finding := models.Findings.GetFinding(c.Params("id"))
+	if finding == nil {
+		return apierror.New(404, apierror.NotFound, "Finding not found")
+	}
+
+	var req struct {
+		ExchangeIDs []string `json:"exchange_ids"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if len(req.ExchangeIDs) == 0 {
+		return apierror.New(400, apierror.ValidationFailed, "exchange_ids is required")
+	}
+	if storage.Default == nil {
+		return apierror.New(503, apierror.ServiceUnavailable, "Storage backend not configured")
+	}
+
+	exchanges := make([]*capture.Exchange, 0, len(req.ExchangeIDs))
+	for _, id := range req.ExchangeIDs {
+		exchange := captureInWorkspace(c, id)
+		if exchange == nil {
+			return apierror.New(404, apierror.NotFound, "Capture not found").WithReason(id)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+
+	attachments := make([]fiber.Map, 0, len(exchanges))
+	for _, exchange := range exchanges {
+		linked, key, err := attachCapture(finding, exchange)
+		if err != nil {
+			return apierror.New(500, apierror.Internal, "Failed to attach capture").WithReason(err)
+		}
+		url, _ := storage.Default.PresignGet(key, attachmentLinkExpiry)
+		attachments = append(attachments, fiber.Map{
+			"capture":      linked.Summary(),
+			"key":          key,
+			"download_url": url,
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"finding_id":  finding.ID,
+		"attachments": attachments,
+		"total":       len(attachments),
+	})
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/openrouter"
+	"performa-backend/repo"
+	"performa-backend/timeline"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// saveCheckpoint records the conversation's state after a completed loop
+// iteration so that a failed run can continue from it. A replay leaves the
+// agent's checkpoint alone.
+func (conv *agentConversation) saveCheckpoint() {
+	agent := conv.agent
+	if conv.replay != nil {
+		return
+	}
+	messages := make([]models.CheckpointMessage, 0, len(conv.messages))
+	for _, msg := range conv.messages {
+		messages = append(messages, models.CheckpointMessage{Role: msg.Role, Content: msg.Content})
+	}
+	findingIDs := make([]string, 0)
+	findings, _ := models.Findings.Query(models.FindingFilter{AgentID: agent.ID})
+	for _, finding := range findings {
+		findingIDs = append(findingIDs, finding.ID)
+	}
+
+	checkpoint := models.AgentCheckpoint{
+		AgentID:     agent.ID,
+		OperationID: agent.OperationID,
+		Iteration:   conv.iterations,
+		Phase:       conv.phase,
+		Messages:    messages,
+		FindingIDs:  findingIDs,
+		CreatedAt:   time.Now(),
+	}
+	if current := models.Manager.GetAgent(agent.ID); current != nil {
+		checkpoint.Progress, checkpoint.CurrentTask = current.Progress, current.CurrentTask
+	}
+	if plan := models.Operations.AgentPlan(agent.OperationID, agent.ID); plan != nil && conv.phase >= 0 && conv.phase < len(plan.Phases) {
+		checkpoint.PhaseName = plan.Phases[conv.phase].Name
+	}
+	models.Manager.SaveCheckpoint(checkpoint)
+
+	if err := repo.Agents.SaveCheckpoint(checkpoint); err != nil {
+		log.Printf("Agent %s: failed to persist checkpoint: %v", agent.ID, err)
+	}
+}
+
+// agentCheckpoint returns the agent's latest checkpoint, from memory or,
+// for an agent restored from a session, from the agent repository.
+func agentCheckpoint(agentID string) *models.AgentCheckpoint {
+	if checkpoint := models.Manager.Checkpoint(agentID); checkpoint != nil {
+		return checkpoint
+	}
+	checkpoint, err := repo.Agents.Checkpoint(agentID)
+	if err != nil {
+		log.Printf("Agent %s: failed to load checkpoint: %v", agentID, err)
+		return nil
+	}
+	return checkpoint
+}
+
+// clearAgentCheckpoint drops the checkpoint of an agent whose run completed.
+func clearAgentCheckpoint(agentID string) {
+	models.Manager.ClearCheckpoint(agentID)
+	if err := repo.Agents.DeleteCheckpoint(agentID); err != nil {
+		log.Printf("Agent %s: failed to delete checkpoint: %v", agentID, err)
+	}
+}
+
+// retryAgentTask continues an agent's run from its checkpoint. Commands the
+// model asked for in the checkpoint's last turn, whose output it never got,
+// are run first.
+func retryAgentTask(agent *models.Agent, req models.StartRequest, checkpoint *models.AgentCheckpoint) {
+	defer recoverAgentPanic(agent, "retry")
+	messages := make([]openrouter.Message, 0, len(checkpoint.Messages))
+	for _, msg := range checkpoint.Messages {
+		messages = append(messages, openrouter.Message{Role: msg.Role, Content: msg.Content})
+	}
+	conv := &agentConversation{
+		agent:      agent,
+		req:        req,
+		messages:   messages,
+		iterations: checkpoint.Iteration,
+		phase:      checkpoint.Phase,
+		resumed:    true,
+	}
+
+	if last := len(messages) - 1; last >= 0 && messages[last].Role == "assistant" {
+		if commands := extractToolCommands(messages[last].Content); len(commands) > 0 {
+			models.Manager.UpdateAgentProgress(agent.ID, agent.Progress, fmt.Sprintf("Running %d tool command(s)", len(commands)))
+			output := executeAgentCommands(agent, req, conv.iterations, commands)
+			conv.messages = append(conv.messages, openrouter.Message{Role: "user", Content: output})
+			conv.saveCheckpoint()
+		}
+	}
+
+	runConversation(conv, "retry")
+}
+
+// GetAgentCheckpoint returns the agent's latest checkpoint.
+func GetAgentCheckpoint(c *fiber.Ctx) error {
+	checkpoint := agentCheckpoint(c.Params("id"))
+	if checkpoint == nil {
+		return apierror.New(404, apierror.NotFound, "No checkpoint for this agent")
+	}
+	return c.JSON(checkpoint)
+}
+
+// RetryAgentFromCheckpoint restarts a failed or stopped agent from its latest
+// checkpoint instead of from scratch.
+func RetryAgentFromCheckpoint(c *fiber.Ctx) error {
+	id := c.Params("id")
+	agent := models.Manager.GetAgent(id)
+	if agent == nil {
+		return apierror.New(404, apierror.NotFound, "Agent not found")
+	}
+	checkpoint := agentCheckpoint(id)
+	if checkpoint == nil {
+		return apierror.New(404, apierror.NotFound, "No checkpoint for this agent")
+	}
+	if agent.Status != models.AgentStatusError && agent.Status != models.AgentStatusStopped {
+		return apierror.New(409, apierror.Conflict, "Only failed or stopped agents can be retried").WithReason(fmt.Sprintf("agent is %s", agent.Status))
+	}
+	// A stopped agent's goroutine may still be inside a model or tool call;
+	// reactivating it now would let that loop carry on beside the retry.
+	if agentTaskRunning(id) {
+		return apierror.New(409, apierror.Conflict, "Agent is still finishing its previous run")
+	}
+	if err := CheckBlackout(id); err != nil {
+		return err
+	}
+	if !models.Manager.ReactivateAgent(id) {
+		return apierror.New(409, apierror.Conflict, "Agent is already running")
+	}
+
+	RecordOperatorAction(agent, "retry", map[string]interface{}{
+		"iteration": checkpoint.Iteration,
+		"phase":     checkpoint.Phase,
+	})
+	recordAgentStatus(agent, timeline.ActorOperator, models.AgentStatusRunning, "retried from checkpoint")
+	refreshOperationStatus(agent.OperationID)
+	ws.BroadcastAgentUpdate(id, "running", fmt.Sprintf("Retrying from checkpoint after %d model turns", checkpoint.Iteration))
+
+	go retryAgentTask(agent, agentStartRequest(agent), checkpoint)
+
+	return c.Status(202).JSON(fiber.Map{
+		"status":     "started",
+		"agent_id":   id,
+		"checkpoint": fiber.Map{"iteration": checkpoint.Iteration, "phase": checkpoint.Phase, "created_at": checkpoint.CreatedAt},
+	})
+}
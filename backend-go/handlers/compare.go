@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+
+	"performa-backend/apierror"
+	"performa-backend/assets"
+	"performa-backend/compare"
+	"performa-backend/models"
+	"performa-backend/repo"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sessionAgent is the JSON shape of the agents a session stores.
+type sessionAgent struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Target    string `json:"target"`
+	TaskCount int    `json:"task_count"`
+	Findings  int    `json:"findings"`
+	Usage     struct {
+		LLMCalls int `json:"llm_calls"`
+		ToolRuns int `json:"tool_runs"`
+	} `json:"usage"`
+}
+
+func compareAgent(agent sessionAgent) compare.Agent {
+	return compare.Agent{
+		ID:        agent.ID,
+		Name:      agent.Name,
+		Status:    agent.Status,
+		TaskCount: agent.TaskCount,
+		Findings:  agent.Findings,
+		ToolRuns:  agent.Usage.ToolRuns,
+		LLMCalls:  agent.Usage.LLMCalls,
+	}
+}
+
+// hostAssets lists the distinct hosts of targets as assets, for snapshots
+// that carry no asset inventory of their own.
+func hostAssets(targets []string) []compare.Asset {
+	seen := make(map[string]bool)
+	result := make([]compare.Asset, 0)
+	for _, target := range targets {
+		host, isIP, ok := assets.NormalizeHost(target)
+		if !ok || seen[host] {
+			continue
+		}
+		seen[host] = true
+		kind := assets.KindDomain
+		if isIP {
+			kind = assets.KindIP
+		}
+		result = append(result, compare.Asset{Identifier: host, Kind: kind})
+	}
+	return result
+}
+
+// sessionSnapshot reads the findings and agents a session stores. Its assets
+// are the hosts its findings and agents targeted.
+func sessionSnapshot(session *repo.Session) compare.Snapshot {
+	snapshot := compare.Snapshot{
+		ID:        session.ID,
+		Kind:      "session",
+		Name:      session.Name,
+		CreatedAt: session.CreatedAt,
+	}
+
+	var findings []compare.Finding
+	if data, err := json.Marshal(session.Findings); err == nil {
+		json.Unmarshal(data, &findings)
+	}
+	var agents []sessionAgent
+	if data, err := json.Marshal(session.Agents); err == nil {
+		json.Unmarshal(data, &agents)
+	}
+
+	var targets []string
+	for _, finding := range findings {
+		targets = append(targets, finding.Target)
+	}
+	for _, agent := range agents {
+		targets = append(targets, agent.Target)
+		snapshot.Agents = append(snapshot.Agents, compareAgent(agent))
+	}
+	snapshot.Findings = findings
+	snapshot.Assets = hostAssets(targets)
+	return snapshot
+}
+
+// operationSnapshot collects an operation's findings, the assets it observed
+// and its agents.
+func operationSnapshot(op *models.Operation) compare.Snapshot {
+	snapshot := compare.Snapshot{
+		ID:        op.ID,
+		Kind:      "operation",
+		Name:      op.Target,
+		CreatedAt: op.CreatedAt,
+	}
+
+	for _, agent := range models.Manager.GetOperationAgents(op.ID) {
+		snapshot.Agents = append(snapshot.Agents, compare.Agent{
+			ID:        agent.ID,
+			Name:      agent.Name,
+			Status:    string(agent.Status),
+			TaskCount: agent.TaskCount,
+			Findings:  agent.Findings,
+			ToolRuns:  agent.Usage.ToolRuns,
+			LLMCalls:  agent.Usage.LLMCalls,
+		})
+
+		findings, _ := models.Findings.Query(models.FindingFilter{AgentID: agent.ID})
+		for _, finding := range findings {
+			snapshot.Findings = append(snapshot.Findings, compare.Finding{
+				ID:       finding.ID,
+				Title:    finding.Title,
+				Severity: string(finding.Severity),
+				Category: finding.Category,
+				Target:   finding.Target,
+				Status:   finding.Status,
+			})
+		}
+	}
+
+	observed, _ := assets.Default.Search(assets.Filter{WorkspaceID: op.WorkspaceID, OperationID: op.ID})
+	for _, asset := range observed {
+		var ports []int
+		for _, service := range asset.Services {
+			ports = append(ports, service.Port)
+		}
+		sort.Ints(ports)
+		snapshot.Assets = append(snapshot.Assets, compare.Asset{Identifier: asset.Name, Kind: asset.Kind, Ports: ports})
+	}
+	return snapshot
+}
+
+func compareParams(c *fiber.Ctx) (string, string, error) {
+	a, b := c.Query("a"), c.Query("b")
+	if a == "" || b == "" {
+		return "", "", apierror.New(400, apierror.ValidationFailed, "Query parameters a and b are required")
+	}
+	return a, b, nil
+}
+
+// CompareSessions diffs session b against the baseline session a.
+func CompareSessions(c *fiber.Ctx) error {
+	a, b, err := compareParams(c)
+	if a == "" {
+		return err
+	}
+
+	snapshots := make([]compare.Snapshot, 0, 2)
+	for _, id := range []string{a, b} {
+		session := findSession(id)
+		if session == nil || !inWorkspace(c, session.WorkspaceID) {
+			return apierror.New(404, apierror.NotFound, "Session not found").With("session_id", id)
+		}
+		snapshots = append(snapshots, sessionSnapshot(session))
+	}
+	return c.JSON(compare.Diff(snapshots[0], snapshots[1]))
+}
+
+// CompareOperations diffs operation b against the baseline operation a.
+func CompareOperations(c *fiber.Ctx) error {
+	a, b, err := compareParams(c)
+	if a == "" {
+		return err
+	}
+
+	snapshots := make([]compare.Snapshot, 0, 2)
+	for _, id := range []string{a, b} {
+		op := models.Operations.GetOperation(id)
+		if op == nil || !inWorkspace(c, op.WorkspaceID) {
+			return apierror.New(404, apierror.NotFound, "Operation not found").With("operation_id", id)
+		}
+		snapshots = append(snapshots, operationSnapshot(op))
+	}
+	return c.JSON(compare.Diff(snapshots[0], snapshots[1]))
+}
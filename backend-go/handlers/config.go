@@ -2,215 +2,341 @@ package handlers
 
 import (
         "encoding/json"
-        "sync"
+        "fmt"
+        "log"
+        "strings"
         "time"
 
-        "performa-backend/database"
+        "performa-backend/apierror"
         "performa-backend/models"
+        "performa-backend/repo"
+        "performa-backend/validation"
+        "performa-backend/ws"
 
         "github.com/gofiber/fiber/v2"
         "github.com/google/uuid"
 )
 
 type MissionConfigRequest struct {
-        Name              string                 `json:"name"`
+        Name              string                 `json:"name" validate:"required"`
         Target            string                 `json:"target"`
         Category          string                 `json:"category"`
         CustomInstruction string                 `json:"custom_instruction"`
         StealthMode       bool                   `json:"stealth_mode"`
-        AggressiveLevel   int                    `json:"aggressive_level"`
+        AggressiveLevel   int                    `json:"aggressive_level" validate:"omitempty,min=1,max=5"`
         ModelName         string                 `json:"model_name"`
-        NumAgents         int                    `json:"num_agents"`
-        ExecutionDuration *int                   `json:"execution_duration"`
+        NumAgents         int                    `json:"num_agents" validate:"min=0,max=50"`
+        ExecutionDuration *int                   `json:"execution_duration" validate:"omitempty,min=1"`
         RequestedTools    []string               `json:"requested_tools"`
         AllowedToolsOnly  bool                   `json:"allowed_tools_only"`
         StealthOptions    models.StealthOptions  `json:"stealth_options"`
         Capabilities      models.Capabilities    `json:"capabilities"`
+        RoE               *models.RoE            `json:"roe,omitempty"`
 }
 
-type SavedConfig struct {
-        ID                string                 `json:"id"`
-        Name              string                 `json:"name"`
-        Target            string                 `json:"target"`
-        Category          string                 `json:"category"`
-        CustomInstruction string                 `json:"custom_instruction"`
-        StealthMode       bool                   `json:"stealth_mode"`
-        AggressiveLevel   int                    `json:"aggressive_level"`
-        ModelName         string                 `json:"model_name"`
-        NumAgents         int                    `json:"num_agents"`
-        ExecutionDuration *int                   `json:"execution_duration"`
-        RequestedTools    []string               `json:"requested_tools"`
-        AllowedToolsOnly  bool                   `json:"allowed_tools_only"`
-        StealthOptions    models.StealthOptions  `json:"stealth_options"`
-        Capabilities      models.Capabilities    `json:"capabilities"`
-        CreatedAt         time.Time              `json:"created_at"`
-        UpdatedAt         time.Time              `json:"updated_at"`
+// ConfigFieldError describes one invalid field of a mission config.
+type ConfigFieldError = validation.FieldError
+
+// validateMissionConfig checks a config's fields, its `validate` tags first,
+// and returns every problem found, or nil when the config is valid. Handlers
+// decode configs with decodeBody so that tag and model problems are reported
+// together.
+func validateMissionConfig(req MissionConfigRequest) []ConfigFieldError {
+        problems := validation.Struct(req)
+
+        if req.Name != "" && strings.TrimSpace(req.Name) == "" {
+                problems = append(problems, ConfigFieldError{Field: "name", Message: "name is required"})
+        }
+        if req.ModelName != "" && models.FindModel(req.ModelName) == nil {
+                problems = append(problems, ConfigFieldError{Field: "model_name",
+                        Message: fmt.Sprintf("unknown model %q; see GET /api/models for available models", req.ModelName)})
+        }
+        if req.RoE != nil {
+                if err := req.RoE.Validate(); err != nil {
+                        problems = append(problems, ConfigFieldError{Field: "roe", Message: err.Error()})
+                }
+        }
+        return problems
 }
 
-var (
-        configStore   = make(map[string]*SavedConfig)
-        configStoreMu sync.RWMutex
-)
+func configValidationError(c *fiber.Ctx, problems []ConfigFieldError) error {
+        return validationError("Invalid config", problems)
+}
+
+func missionConfigFromSaved(config *repo.Config) MissionConfigRequest {
+        return MissionConfigRequest{
+                Name:              config.Name,
+                Target:            config.Target,
+                Category:          config.Category,
+                CustomInstruction: config.CustomInstruction,
+                StealthMode:       config.StealthMode,
+                AggressiveLevel:   config.AggressiveLevel,
+                ModelName:         config.ModelName,
+                NumAgents:         config.NumAgents,
+                ExecutionDuration: config.ExecutionDuration,
+                RequestedTools:    config.RequestedTools,
+                AllowedToolsOnly:  config.AllowedToolsOnly,
+                StealthOptions:    config.StealthOptions,
+                Capabilities:      config.Capabilities,
+                RoE:               config.RoE,
+        }
+}
+
+func applyMissionConfig(config *repo.Config, req MissionConfigRequest) {
+        config.Name = req.Name
+        config.Target = req.Target
+        config.Category = req.Category
+        config.CustomInstruction = req.CustomInstruction
+        config.StealthMode = req.StealthMode
+        config.AggressiveLevel = req.AggressiveLevel
+        config.ModelName = req.ModelName
+        config.NumAgents = req.NumAgents
+        config.ExecutionDuration = req.ExecutionDuration
+        config.RequestedTools = req.RequestedTools
+        config.AllowedToolsOnly = req.AllowedToolsOnly
+        config.StealthOptions = req.StealthOptions
+        config.Capabilities = req.Capabilities
+        config.RoE = req.RoE
+}
+
+// storeSavedConfig writes a config to the config repository, logging a
+// failure.
+func storeSavedConfig(config *repo.Config) {
+        if err := repo.Configs.Save(config); err != nil {
+                log.Printf("Failed to save config %s: %v", config.ID, err)
+        }
+}
 
 func SaveConfig(c *fiber.Ctx) error {
         var req MissionConfigRequest
-        if err := c.BodyParser(&req); err != nil {
-                return c.Status(400).JSON(fiber.Map{
-                        "error": "Invalid request body",
-                })
+        if err := decodeBody(c, &req); err != nil {
+                return err
+        }
+        if problems := validateMissionConfig(req); len(problems) > 0 {
+                return configValidationError(c, problems)
         }
 
-        configID := uuid.New().String()
         now := time.Now()
-
-        config := &SavedConfig{
-                ID:                configID,
-                Name:              req.Name,
-                Target:            req.Target,
-                Category:          req.Category,
-                CustomInstruction: req.CustomInstruction,
-                StealthMode:       req.StealthMode,
-                AggressiveLevel:   req.AggressiveLevel,
-                ModelName:         req.ModelName,
-                NumAgents:         req.NumAgents,
-                ExecutionDuration: req.ExecutionDuration,
-                RequestedTools:    req.RequestedTools,
-                AllowedToolsOnly:  req.AllowedToolsOnly,
-                StealthOptions:    req.StealthOptions,
-                Capabilities:      req.Capabilities,
-                CreatedAt:         now,
-                UpdatedAt:         now,
-        }
-
-        configStoreMu.Lock()
-        configStore[configID] = config
-        configStoreMu.Unlock()
-
-        if database.DB != nil {
-                toolsJSON, _ := json.Marshal(req.RequestedTools)
-                stealthJSON, _ := json.Marshal(req.StealthOptions)
-                capsJSON, _ := json.Marshal(req.Capabilities)
-
-                dbConfig := database.SavedConfig{
-                        ID:                configID,
-                        Name:              req.Name,
-                        Target:            req.Target,
-                        Category:          req.Category,
-                        CustomInstruction: req.CustomInstruction,
-                        StealthMode:       req.StealthMode,
-                        AggressiveLevel:   req.AggressiveLevel,
-                        ModelName:         req.ModelName,
-                        NumAgents:         req.NumAgents,
-                        ExecutionDuration: req.ExecutionDuration,
-                        RequestedTools:    toolsJSON,
-                        AllowedToolsOnly:  req.AllowedToolsOnly,
-                        StealthOptions:    stealthJSON,
-                        Capabilities:      capsJSON,
-                        CreatedAt:         now,
-                        UpdatedAt:         now,
-                }
-                database.SaveConfig(dbConfig)
+        config := &repo.Config{
+                ID:          uuid.New().String(),
+                OwnerID:     currentUserID(c),
+                WorkspaceID: currentWorkspace(c),
+                CreatedAt:   now,
+                UpdatedAt:   now,
         }
+        applyMissionConfig(config, req)
+        storeSavedConfig(config)
 
         return c.JSON(fiber.Map{
                 "status":    "saved",
-                "config_id": configID,
+                "config_id": config.ID,
                 "config":    config,
         })
 }
 
-func convertDBConfigToSavedConfig(dbConfig *database.SavedConfig) *SavedConfig {
-        var tools []string
-        var stealthOpts models.StealthOptions
-        var caps models.Capabilities
-
-        json.Unmarshal(dbConfig.RequestedTools, &tools)
-        json.Unmarshal(dbConfig.StealthOptions, &stealthOpts)
-        json.Unmarshal(dbConfig.Capabilities, &caps)
-
-        return &SavedConfig{
-                ID:                dbConfig.ID,
-                Name:              dbConfig.Name,
-                Target:            dbConfig.Target,
-                Category:          dbConfig.Category,
-                CustomInstruction: dbConfig.CustomInstruction,
-                StealthMode:       dbConfig.StealthMode,
-                AggressiveLevel:   dbConfig.AggressiveLevel,
-                ModelName:         dbConfig.ModelName,
-                NumAgents:         dbConfig.NumAgents,
-                ExecutionDuration: dbConfig.ExecutionDuration,
-                RequestedTools:    tools,
-                AllowedToolsOnly:  dbConfig.AllowedToolsOnly,
-                StealthOptions:    stealthOpts,
-                Capabilities:      caps,
-                CreatedAt:         dbConfig.CreatedAt,
-                UpdatedAt:         dbConfig.UpdatedAt,
+// UpdateConfig replaces a saved config's fields in place, keeping its ID and
+// creation time.
+func UpdateConfig(c *fiber.Ctx) error {
+        id := c.Params("id")
+        existing := resolveSavedConfig(id)
+        if existing == nil {
+                return apierror.New(404, apierror.NotFound, "Config not found")
         }
-}
 
-func GetConfigs(c *fiber.Ctx) error {
-        if database.DB != nil {
-                dbConfigs, err := database.GetAllConfigs()
-                if err == nil {
-                        configs := make([]*SavedConfig, 0, len(dbConfigs))
-                        for _, dbConfig := range dbConfigs {
-                                configs = append(configs, convertDBConfigToSavedConfig(&dbConfig))
-                        }
-                        return c.JSON(fiber.Map{
-                                "configs": configs,
-                                "total":   len(configs),
-                        })
-                }
+        var req MissionConfigRequest
+        if err := decodeBody(c, &req); err != nil {
+                return err
+        }
+        if problems := validateMissionConfig(req); len(problems) > 0 {
+                return configValidationError(c, problems)
         }
 
-        configStoreMu.RLock()
-        defer configStoreMu.RUnlock()
-
-        configs := make([]*SavedConfig, 0, len(configStore))
-        for _, config := range configStore {
-                configs = append(configs, config)
+        config := &repo.Config{
+                ID:          existing.ID,
+                OwnerID:     existing.OwnerID,
+                WorkspaceID: currentWorkspace(c),
+                CreatedAt:   existing.CreatedAt,
+                UpdatedAt:   time.Now(),
         }
+        applyMissionConfig(config, req)
+        storeSavedConfig(config)
 
         return c.JSON(fiber.Map{
-                "configs": configs,
-                "total":   len(configs),
+                "status":    "updated",
+                "config_id": config.ID,
+                "config":    config,
         })
 }
 
+type DuplicateConfigRequest struct {
+        Name string `json:"name"`
+}
+
+// DuplicateConfig saves a copy of a config under a new ID, named after the
+// original unless a name is given.
+func DuplicateConfig(c *fiber.Ctx) error {
+        original := resolveSavedConfig(c.Params("id"))
+        if original == nil {
+                return apierror.New(404, apierror.NotFound, "Config not found")
+        }
+
+        var req DuplicateConfigRequest
+        if err := parseBody(c, &req); err != nil {
+                return err
+        }
+
+        now := time.Now()
+        config := *original
+        config.ID = uuid.New().String()
+        config.Name = strings.TrimSpace(req.Name)
+        if config.Name == "" {
+                config.Name = original.Name + " (copy)"
+        }
+        config.RequestedTools = append([]string(nil), original.RequestedTools...)
+        config.OwnerID = currentUserID(c)
+        config.WorkspaceID = currentWorkspace(c)
+        config.CreatedAt = now
+        config.UpdatedAt = now
+        storeSavedConfig(&config)
+
+        return c.Status(201).JSON(fiber.Map{
+                "status":    "duplicated",
+                "config_id": config.ID,
+                "source_id": original.ID,
+                "config":    &config,
+        })
+}
+
+const (
+        defaultSavedLimit = 100
+        maxSavedLimit     = 1000
+)
+
+// parseSavedFilter reads the search, category, sort and paging of a saved
+// config or session listing, scoped to the workspace and, for users other
+// than admins, to their own.
+func parseSavedFilter(c *fiber.Ctx) (repo.ListFilter, error) {
+        filter := repo.ListFilter{
+                WorkspaceID: currentWorkspace(c),
+                OwnerID:     ownerScope(c),
+                Search:      strings.TrimSpace(c.Query("q", c.Query("search"))),
+                Category:    c.Query("category"),
+                SortBy:      c.Query("sort", "updated_at"),
+                SortDesc:    strings.ToLower(c.Query("order", "desc")) != "asc",
+                Limit:       c.QueryInt("limit", defaultSavedLimit),
+                Offset:      c.QueryInt("offset", 0),
+        }
+
+        switch filter.SortBy {
+        case "created_at", "updated_at", "name":
+        default:
+                return filter, fmt.Errorf("invalid sort: must be one of created_at, updated_at, name")
+        }
+        if filter.Limit <= 0 || filter.Limit > maxSavedLimit {
+                filter.Limit = defaultSavedLimit
+        }
+        if filter.Offset < 0 {
+                filter.Offset = 0
+        }
+
+        return filter, nil
+}
+
+// savedPage adds the paging of a saved config or session listing to its
+// response.
+func savedPage(page fiber.Map, returned, total int, filter repo.ListFilter) fiber.Map {
+        page["total"] = total
+        page["limit"] = filter.Limit
+        page["offset"] = filter.Offset
+        page["has_more"] = filter.Offset+returned < total
+        return page
+}
+
+// GetConfigs lists a page of the workspace's saved configs, newest update
+// first unless sorted otherwise; users other than admins only see their own.
+func GetConfigs(c *fiber.Ctx) error {
+        filter, err := parseSavedFilter(c)
+        if err != nil {
+                return apierror.New(400, apierror.ValidationFailed, err.Error())
+        }
+
+        configs, total, err := repo.Configs.Query(filter)
+        if err != nil {
+                return apierror.New(500, apierror.Internal, "Failed to list configs").WithReason(err)
+        }
+
+        return c.JSON(savedPage(fiber.Map{"configs": configs}, len(configs), total, filter))
+}
+
 func GetConfig(c *fiber.Ctx) error {
         id := c.Params("id")
 
-        if database.DB != nil {
-                dbConfig, err := database.GetConfig(id)
-                if err == nil && dbConfig != nil {
-                        return c.JSON(convertDBConfigToSavedConfig(dbConfig))
-                }
+        config := resolveSavedConfig(id)
+        if config == nil {
+                return apierror.New(404, apierror.NotFound, "Config not found")
         }
 
-        configStoreMu.RLock()
-        defer configStoreMu.RUnlock()
+        return c.JSON(config)
+}
 
-        config, exists := configStore[id]
-        if !exists {
-                return c.Status(404).JSON(fiber.Map{
-                        "error": "Config not found",
-                })
+// findSavedConfig returns the config from the config repository, or nil
+// when it does not exist or cannot be read.
+func findSavedConfig(id string) *repo.Config {
+        config, err := repo.Configs.Get(id)
+        if err != nil {
+                log.Printf("Failed to load config %s: %v", id, err)
+                return nil
         }
+        return config
+}
 
-        return c.JSON(config)
+// resolveSavedConfig is findSavedConfig with a final fallback to configs the
+// frontend saved through the Brain service.
+func resolveSavedConfig(id string) *repo.Config {
+        if config := findSavedConfig(id); config != nil {
+                return config
+        }
+
+        if brainClient == nil {
+                return nil
+        }
+        raw, err := brainClient.GetMissionConfig(id)
+        if err != nil {
+                return nil
+        }
+        var config repo.Config
+        if err := json.Unmarshal(raw, &config); err != nil || config.ID == "" {
+                return nil
+        }
+        return &config
+}
+
+func startRequestFromSavedConfig(config *repo.Config) models.StartRequest {
+        return models.StartRequest{
+                Target:            config.Target,
+                Category:          config.Category,
+                Model:             config.ModelName,
+                AgentCount:        config.NumAgents,
+                Instructions:      config.CustomInstruction,
+                StealthMode:       config.StealthMode,
+                AggressiveLevel:   config.AggressiveLevel,
+                RequestedTools:    config.RequestedTools,
+                AllowedToolsOnly:  config.AllowedToolsOnly,
+                StealthOptions:    config.StealthOptions,
+                Capabilities:      config.Capabilities,
+                ExecutionDuration: config.ExecutionDuration,
+                RoE:               config.RoE,
+                WorkspaceID:       config.WorkspaceID,
+        }
 }
 
 func DeleteConfig(c *fiber.Ctx) error {
         id := c.Params("id")
 
-        if database.DB != nil {
-                database.DeleteConfig(id)
+        if err := repo.Configs.Delete(id); err != nil {
+                return apierror.New(500, apierror.Internal, "Failed to delete config").WithReason(err)
         }
 
-        configStoreMu.Lock()
-        delete(configStore, id)
-        configStoreMu.Unlock()
-
         return c.JSON(fiber.Map{
                 "status":  "deleted",
                 "message": "Config deleted successfully",
@@ -224,62 +350,26 @@ type SessionSaveRequest struct {
         Findings interface{} `json:"findings"`
 }
 
-type InMemorySession struct {
-        ID        string      `json:"id"`
-        Name      string      `json:"name"`
-        Config    interface{} `json:"config"`
-        Agents    interface{} `json:"agents"`
-        Findings  interface{} `json:"findings"`
-        CreatedAt time.Time   `json:"created_at"`
-        UpdatedAt time.Time   `json:"updated_at"`
-}
-
-var (
-        sessionStore   = make(map[string]*InMemorySession)
-        sessionStoreMu sync.RWMutex
-)
-
 func SaveSessionHandler(c *fiber.Ctx) error {
         var req SessionSaveRequest
-        if err := c.BodyParser(&req); err != nil {
-                return c.Status(400).JSON(fiber.Map{
-                        "error": "Invalid request body",
-                })
+        if err := parseBody(c, &req); err != nil {
+                return err
         }
 
         sessionID := uuid.New().String()
         now := time.Now()
 
-        inMemSession := &InMemorySession{
+        storeSession(&repo.Session{
                 ID:        sessionID,
                 Name:      req.Name,
                 Config:    req.Config,
                 Agents:    req.Agents,
-                Findings:  req.Findings,
-                CreatedAt: now,
-                UpdatedAt: now,
-        }
-        
-        sessionStoreMu.Lock()
-        sessionStore[sessionID] = inMemSession
-        sessionStoreMu.Unlock()
-
-        if database.DB != nil {
-                configJSON, _ := json.Marshal(req.Config)
-                agentsJSON, _ := json.Marshal(req.Agents)
-                findingsJSON, _ := json.Marshal(req.Findings)
-
-                session := database.SavedSession{
-                        ID:        sessionID,
-                        Name:      req.Name,
-                        Config:    configJSON,
-                        Agents:    agentsJSON,
-                        Findings:  findingsJSON,
-                        CreatedAt: now,
-                        UpdatedAt: now,
-                }
-                database.SaveSession(session)
-        }
+                Findings:    req.Findings,
+                OwnerID:     currentUserID(c),
+                WorkspaceID: currentWorkspace(c),
+                CreatedAt:   now,
+                UpdatedAt:   now,
+        })
 
         return c.JSON(fiber.Map{
                 "status":     "saved",
@@ -288,49 +378,46 @@ func SaveSessionHandler(c *fiber.Ctx) error {
         })
 }
 
-func GetSessionsHandler(c *fiber.Ctx) error {
-        if database.DB != nil {
-                sessions, err := database.GetAllSessions()
-                if err == nil {
-                        return c.JSON(fiber.Map{
-                                "sessions": sessions,
-                                "total":    len(sessions),
-                        })
-                }
+// storeSession writes a session to the session repository, logging a
+// failure.
+func storeSession(session *repo.Session) {
+        if err := repo.Sessions.Save(session); err != nil {
+                log.Printf("Failed to save session %s: %v", session.ID, err)
         }
+}
 
-        sessionStoreMu.RLock()
-        defer sessionStoreMu.RUnlock()
-
-        sessions := make([]*InMemorySession, 0, len(sessionStore))
-        for _, session := range sessionStore {
-                sessions = append(sessions, session)
+// findSession returns the session from the session repository, or nil when
+// it does not exist or cannot be read.
+func findSession(id string) *repo.Session {
+        session, err := repo.Sessions.Get(id)
+        if err != nil {
+                log.Printf("Failed to load session %s: %v", id, err)
+                return nil
         }
-
-        return c.JSON(fiber.Map{
-                "sessions": sessions,
-                "total":    len(sessions),
-        })
+        return session
 }
 
-func GetSessionHandler(c *fiber.Ctx) error {
-        id := c.Params("id")
+// GetSessionsHandler lists a page of the workspace's saved sessions, searched
+// and filtered by the target and category of their config; users other than
+// admins only see their own.
+func GetSessionsHandler(c *fiber.Ctx) error {
+        filter, err := parseSavedFilter(c)
+        if err != nil {
+                return apierror.New(400, apierror.ValidationFailed, err.Error())
+        }
 
-        if database.DB != nil {
-                session, err := database.GetSession(id)
-                if err == nil && session != nil {
-                        return c.JSON(session)
-                }
+        sessions, total, err := repo.Sessions.Query(filter)
+        if err != nil {
+                return apierror.New(500, apierror.Internal, "Failed to list sessions").WithReason(err)
         }
 
-        sessionStoreMu.RLock()
-        defer sessionStoreMu.RUnlock()
+        return c.JSON(savedPage(fiber.Map{"sessions": sessions}, len(sessions), total, filter))
+}
 
-        session, exists := sessionStore[id]
-        if !exists {
-                return c.Status(404).JSON(fiber.Map{
-                        "error": "Session not found",
-                })
+func GetSessionHandler(c *fiber.Ctx) error {
+        session := findSession(c.Params("id"))
+        if session == nil {
+                return apierror.New(404, apierror.NotFound, "Session not found")
         }
 
         return c.JSON(session)
@@ -339,14 +426,10 @@ func GetSessionHandler(c *fiber.Ctx) error {
 func DeleteSessionHandler(c *fiber.Ctx) error {
         id := c.Params("id")
 
-        if database.DB != nil {
-                database.DeleteSession(id)
+        if err := repo.Sessions.Delete(id); err != nil {
+                return apierror.New(500, apierror.Internal, "Failed to delete session").WithReason(err)
         }
 
-        sessionStoreMu.Lock()
-        delete(sessionStore, id)
-        sessionStoreMu.Unlock()
-
         return c.JSON(fiber.Map{
                 "status":  "deleted",
                 "message": "Session deleted successfully",
@@ -354,37 +437,9 @@ func DeleteSessionHandler(c *fiber.Ctx) error {
 }
 
 func LoadSessionHandler(c *fiber.Ctx) error {
-        id := c.Params("id")
-
-        if database.DB != nil {
-                session, err := database.GetSession(id)
-                if err == nil && session != nil {
-                        var config interface{}
-                        var agents interface{}
-                        var findings interface{}
-
-                        json.Unmarshal(session.Config, &config)
-                        json.Unmarshal(session.Agents, &agents)
-                        json.Unmarshal(session.Findings, &findings)
-
-                        return c.JSON(fiber.Map{
-                                "status":   "loaded",
-                                "session":  session,
-                                "config":   config,
-                                "agents":   agents,
-                                "findings": findings,
-                        })
-                }
-        }
-
-        sessionStoreMu.RLock()
-        defer sessionStoreMu.RUnlock()
-
-        session, exists := sessionStore[id]
-        if !exists {
-                return c.Status(404).JSON(fiber.Map{
-                        "error": "Session not found",
-                })
+        session := findSession(c.Params("id"))
+        if session == nil {
+                return apierror.New(404, apierror.NotFound, "Session not found")
         }
 
         return c.JSON(fiber.Map{
@@ -395,3 +450,116 @@ func LoadSessionHandler(c *fiber.Ctx) error {
                 "findings": session.Findings,
         })
 }
+
+type sessionAgentSnapshot struct {
+        models.Agent
+        Messages []models.AgentMessage `json:"messages"`
+}
+
+func loadSessionSnapshot(id string) (config, agents json.RawMessage, found bool) {
+        session := findSession(id)
+        if session == nil {
+                return nil, nil, false
+        }
+        config, _ = json.Marshal(session.Config)
+        agents, _ = json.Marshal(session.Agents)
+        return config, agents, true
+}
+
+// startRequestFromSnapshot accepts either a StartRequest-shaped config or a
+// saved mission config (model_name, num_agents, custom_instruction).
+func startRequestFromSnapshot(raw json.RawMessage) models.StartRequest {
+        var req models.StartRequest
+        json.Unmarshal(raw, &req)
+
+        var mission MissionConfigRequest
+        json.Unmarshal(raw, &mission)
+
+        if req.Model == "" {
+                req.Model = mission.ModelName
+        }
+        if req.AgentCount == 0 {
+                req.AgentCount = mission.NumAgents
+        }
+        if req.Instructions == "" {
+                req.Instructions = mission.CustomInstruction
+        }
+        if req.Model == "" {
+                req.Model = "anthropic/claude-3.5-sonnet"
+        }
+        if req.OSType == "" {
+                req.OSType = "linux"
+        }
+        return req
+}
+
+func ResumeSessionHandler(c *fiber.Ctx) error {
+        id := c.Params("id")
+
+        rawConfig, rawAgents, found := loadSessionSnapshot(id)
+        if !found {
+                return apierror.New(404, apierror.NotFound, "Session not found")
+        }
+
+        var snapshots []sessionAgentSnapshot
+        if err := json.Unmarshal(rawAgents, &snapshots); err != nil || len(snapshots) == 0 {
+                return apierror.New(422, apierror.ValidationFailed, "Session has no agents to resume")
+        }
+
+        req := startRequestFromSnapshot(rawConfig)
+        if req.Target == "" {
+                req.Target = snapshots[0].Target
+        }
+
+        resumed := make([]*models.Agent, 0, len(snapshots))
+        restored := make([]*models.Agent, 0)
+
+        for _, snapshot := range snapshots {
+                agent := snapshot.Agent
+                agent.WorkspaceID = currentWorkspace(c)
+                if agent.Target == "" {
+                        agent.Target = req.Target
+                }
+                if agent.Model == "" {
+                        agent.Model = req.Model
+                }
+                if agent.Config.OSType == "" {
+                        agent.Config = models.AgentConfig{
+                                StealthMode:      req.StealthMode,
+                                AggressiveLevel:  req.AggressiveLevel,
+                                RequestedTools:   req.RequestedTools,
+                                AllowedToolsOnly: req.AllowedToolsOnly,
+                                StealthOptions:   req.StealthOptions,
+                                Capabilities:     req.Capabilities,
+                                OSType:           req.OSType,
+                                Limits:           agentLimits(req.Limits),
+                                Sampling:         req.Sampling,
+                        }
+                }
+
+                if agent.Status == models.AgentStatusComplete {
+                        restored = append(restored, models.Manager.RestoreAgent(agent, snapshot.Messages))
+                        continue
+                }
+
+                agent.Status = models.AgentStatusRunning
+                live := models.Manager.RestoreAgent(agent, snapshot.Messages)
+                resumed = append(resumed, live)
+
+                agentReq := req
+                agentReq.Target = live.Target
+                agentReq.Model = live.Model
+                go resumeAgentTask(live, agentReq)
+        }
+
+        ws.BroadcastWorkspaceMessage(currentWorkspace(c), "system", fmt.Sprintf("Resumed session %s: %d agents restarted, %d restored", id, len(resumed), len(restored)))
+
+        return c.JSON(fiber.Map{
+                "status":     "resumed",
+                "session_id": id,
+                "resumed":    resumed,
+                "restored":   restored,
+                "target":     req.Target,
+                "model":      req.Model,
+        })
+}
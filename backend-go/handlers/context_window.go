@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/openrouter"
+)
+
+// agentContextPolicy is the context policy of the model an agent runs on:
+// its context window, capped by CONTEXT_MAX_TOKENS, with the conversation
+// summarized past CONTEXT_SUMMARIZE_THRESHOLD of it.
+func agentContextPolicy(req models.StartRequest) openrouter.ContextPolicy {
+	limit := config.AppConfig.ContextDefaultTokens
+	if model := models.FindModel(req.Model); model != nil && model.Context > 0 {
+		limit = model.Context
+	}
+	if maxTokens := config.AppConfig.ContextMaxTokens; maxTokens > 0 && maxTokens < limit {
+		limit = maxTokens
+	}
+	ratio := config.AppConfig.ContextThreshold
+	if ratio <= 0 || ratio > 1 {
+		ratio = 0.75
+	}
+	return openrouter.ContextPolicy{
+		Limit:        limit,
+		Threshold:    int(float64(limit) * ratio),
+		KeepRecent:   config.AppConfig.ContextKeepRecent,
+		SummaryModel: config.AppConfig.ContextSummaryModel,
+		CredentialID: req.Credentials["openrouter"],
+	}
+}
+
+// fitContext compacts the conversation to its model's context policy before
+// a model turn and records its size on the agent. The summary request is
+// charged to the agent like its own calls; it reports whether that spent the
+// operation's budget.
+func (conv *agentConversation) fitContext() bool {
+	agent := conv.agent
+	policy := agentContextPolicy(conv.req)
+	compaction := openrouter.FitContext(conv.messages, policy)
+	conv.messages = compaction.Messages
+	conv.compacted += compaction.Summarized + compaction.Dropped
+
+	exhausted := false
+	if compaction.Summarized > 0 || compaction.SummaryErr != nil {
+		stats := compaction.SummaryStats
+		models.Manager.RecordLLMCall(agent.ID, stats.Latency, stats.BytesSent, stats.BytesReceived)
+		models.Manager.RecordLLMUsage(agent.ID, stats.PromptTokens, stats.CompletionTokens, stats.Cost)
+		exhausted = chargeAgentCall(agent, stats)
+	}
+	if compaction.SummaryErr != nil {
+		log.Printf("Agent %s: failed to summarize its conversation: %v", agent.ID, compaction.SummaryErr)
+	}
+	if compaction.Summarized > 0 || compaction.Dropped > 0 {
+		note := fmt.Sprintf("Context: summarized %d earlier message(s)", compaction.Summarized)
+		if compaction.Dropped > 0 {
+			note = fmt.Sprintf("Context: summarized %d and dropped %d earlier message(s)", compaction.Summarized, compaction.Dropped)
+		}
+		models.Manager.AddMessage(agent.ID, "system", fmt.Sprintf("%s to stay within %d of the model's %d tokens", note, policy.Threshold, policy.Limit))
+	}
+
+	models.Manager.RecordContext(agent.ID, models.AgentContext{
+		Limit:        policy.Limit,
+		Threshold:    policy.Threshold,
+		Tokens:       compaction.Tokens,
+		PinnedTokens: compaction.PinnedTokens,
+		Messages:     len(compaction.Messages),
+	}, compaction.Summarized, compaction.Dropped)
+	return exhausted
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxSharedEndpointsPerOutput = 20
+	maxPeerResultsInPrompt      = 50
+)
+
+var (
+	shareLinePattern  = regexp.MustCompile(`(?i)^SHARE\s+([a-z_ ]+):\s*(.+)$`)
+	nmapPortPattern   = regexp.MustCompile(`^(\d+)/(tcp|udp)\s+open\s+(\S+)\s*(.*)$`)
+	urlPattern        = regexp.MustCompile(`https?://[^\s"'<>()\[\]]+`)
+	credentialPattern = regexp.MustCompile(`(?i)login:\s*(\S+)\s+password:\s*(\S+)`)
+)
+
+// shareKinds maps the kinds agents may name in SHARE lines to blackboard kinds.
+var shareKinds = map[string]string{
+	"port":          models.ResultOpenPort,
+	"open port":     models.ResultOpenPort,
+	"open_port":     models.ResultOpenPort,
+	"endpoint":      models.ResultEndpoint,
+	"url":           models.ResultEndpoint,
+	"credential":    models.ResultCredential,
+	"credentials":   models.ResultCredential,
+	"cred":          models.ResultCredential,
+	"creds":         models.ResultCredential,
+	"service":       models.ResultService,
+	"vulnerability": models.ResultVulnerability,
+	"vuln":          models.ResultVulnerability,
+	"technology":    models.ResultTechnology,
+	"tech":          models.ResultTechnology,
+}
+
+const coordinationPrompt = `
+
+COORDINATION:
+You work alongside other agents on this operation. Share each concrete result they can build on on its own line as "SHARE <kind>: <value>", where kind is one of port, endpoint, credential, service, technology or vulnerability (for example "SHARE port: 443/tcp https"). Results shared by other agents will be provided to you as they arrive; use them instead of repeating their work.`
+
+// shareModelResults publishes the results an agent declared with SHARE lines.
+// Shared vulnerabilities are also recorded as findings.
+func shareModelResults(agent *models.Agent, response string) {
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(strings.Trim(strings.TrimSpace(line), "`*-"))
+		match := shareLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		kind, ok := shareKinds[strings.ToLower(strings.TrimSpace(match[1]))]
+		if !ok {
+			continue
+		}
+		if publishResult(agent, kind, match[2]) && kind == models.ResultVulnerability {
+			recordAgentFinding(agent, strings.TrimSpace(match[2]))
+		}
+	}
+}
+
+// shareToolResults publishes the open ports, endpoints and credentials that
+// can be recognised in a tool's output.
+func shareToolResults(agent *models.Agent, output string) {
+	endpoints := 0
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		if match := nmapPortPattern.FindStringSubmatch(line); match != nil {
+			publishResult(agent, models.ResultOpenPort, fmt.Sprintf("%s/%s %s", match[1], match[2], match[3]))
+			if version := strings.TrimSpace(match[4]); version != "" {
+				publishResult(agent, models.ResultService, fmt.Sprintf("%s/%s %s %s", match[1], match[2], match[3], version))
+			}
+			continue
+		}
+
+		if match := credentialPattern.FindStringSubmatch(line); match != nil {
+			publishResult(agent, models.ResultCredential, fmt.Sprintf("%s:%s", match[1], match[2]))
+			continue
+		}
+
+		for _, url := range urlPattern.FindAllString(line, -1) {
+			if endpoints == maxSharedEndpointsPerOutput {
+				break
+			}
+			if publishResult(agent, models.ResultEndpoint, strings.TrimRight(url, ".,;:")) {
+				endpoints++
+			}
+		}
+	}
+}
+
+func publishResult(agent *models.Agent, kind, value string) bool {
+	entry := models.Manager.PublishResult(agent.ID, kind, value)
+	if entry == nil {
+		return false
+	}
+	if kind == models.ResultCredential {
+		vaultSharedCredential(agent, entry.Value)
+	}
+	ws.BroadcastBlackboardUpdate(entry.OperationID, maskedBlackboardEntry(*entry))
+	recordResultAssets(agent, kind, entry.Value)
+	return true
+}
+
+// peerResultsMessage returns a prompt describing results shared by the agent's
+// peers since the cursor, or "" when there are none, and the next cursor.
+func peerResultsMessage(agent *models.Agent, cursor int) (string, int) {
+	peers, next := models.Manager.PeerResults(agent.ID, cursor)
+	if len(peers) == 0 {
+		return "", next
+	}
+	if len(peers) > maxPeerResultsInPrompt {
+		peers = peers[len(peers)-maxPeerResultsInPrompt:]
+	}
+
+	var b strings.Builder
+	b.WriteString("New results shared by other agents in this operation:\n")
+	for _, entry := range peers {
+		fmt.Fprintf(&b, "- [%s] %s (from %s, %s)\n", entry.Kind, entry.Value, entry.AgentName, entry.AgentRole)
+	}
+	b.WriteString("Take these into account in your next step.")
+	return b.String(), next
+}
+
+func GetOperationBlackboard(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Operations.GetOperation(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+
+	entries := models.Manager.GetBlackboard(id)
+	kind := c.Query("kind")
+	filtered := make([]models.BlackboardEntry, 0, len(entries))
+	for _, entry := range entries {
+		if kind == "" || entry.Kind == kind {
+			filtered = append(filtered, maskedBlackboardEntry(entry))
+		}
+	}
+	entries = filtered
+
+	return c.JSON(fiber.Map{
+		"entries": entries,
+		"total":   len(entries),
+	})
+}
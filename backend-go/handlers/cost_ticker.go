@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"time"
+
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/openrouter"
+	"performa-backend/ws"
+)
+
+const (
+	// minCostTickerInterval is the shortest interval between two
+	// cost_update events of an operation, whatever COST_TICKER_SECONDS says.
+	minCostTickerInterval = 2 * time.Second
+	// burnRateWindow is the span of spend the burn rate is measured over.
+	burnRateWindow = 5 * time.Minute
+)
+
+// CostUpdate is what an operation's model calls have spent, with the rate
+// they spent it at over the last few minutes. Budget is set when the
+// operation has one, and ExhaustedInSeconds when it is being spent.
+type CostUpdate struct {
+	OperationID        string        `json:"operation_id"`
+	Calls              int           `json:"calls"`
+	PromptTokens       int64         `json:"prompt_tokens"`
+	CompletionTokens   int64         `json:"completion_tokens"`
+	Tokens             int64         `json:"tokens"`
+	CostUSD            float64       `json:"cost_usd"`
+	TokensPerMinute    float64       `json:"tokens_per_minute"`
+	CostPerMinute      float64       `json:"cost_per_minute"`
+	Budget             *BudgetStatus `json:"budget,omitempty"`
+	ExhaustedInSeconds *float64      `json:"exhausted_in_seconds,omitempty"`
+	Timestamp          time.Time     `json:"timestamp"`
+}
+
+// spendSample is an operation's spend at one tick.
+type spendSample struct {
+	at     time.Time
+	tokens int64
+	cost   float64
+}
+
+// InitCostTicker starts broadcasting the cost_update events of running
+// operations unless COST_TICKER_SECONDS is 0.
+func InitCostTicker() {
+	seconds := config.AppConfig.CostTickerSeconds
+	if seconds <= 0 {
+		return
+	}
+	interval := time.Duration(seconds) * time.Second
+	if interval < minCostTickerInterval {
+		interval = minCostTickerInterval
+	}
+	go runCostTicker(interval)
+}
+
+func runCostTicker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// samples holds the recent spend of the operations that were running at
+	// the last tick, so that each gets a final event once it stops.
+	samples := make(map[string][]spendSample)
+	for now := range ticker.C {
+		running := make(map[string][]spendSample)
+		for _, op := range models.Operations.GetAllOperations() {
+			history, reported := samples[op.ID]
+			if op.Status != models.OperationStatusRunning && !reported {
+				continue
+			}
+			update, history := costUpdate(op, history, now)
+			if op.Status == models.OperationStatusRunning {
+				running[op.ID] = history
+			}
+			ws.BroadcastCostUpdate(op.WorkspaceID, op.ID, update)
+		}
+		samples = running
+	}
+}
+
+// costUpdate adds the operation's current spend to its history, dropping
+// samples older than the burn rate window but the one the rate is measured
+// from, and returns the update with the new history.
+func costUpdate(op *models.Operation, history []spendSample, now time.Time) (CostUpdate, []spendSample) {
+	spend, _ := openrouter.Spending.Get(op.ID)
+	history = append(history, spendSample{at: now, tokens: spend.Tokens(), cost: spend.CostUSD})
+	for len(history) > 2 && !history[1].at.After(now.Add(-burnRateWindow)) {
+		history = history[1:]
+	}
+
+	update := CostUpdate{
+		OperationID:      op.ID,
+		Calls:            spend.Calls,
+		PromptTokens:     spend.PromptTokens,
+		CompletionTokens: spend.CompletionTokens,
+		Tokens:           spend.Tokens(),
+		CostUSD:          spend.CostUSD,
+		Timestamp:        now,
+	}
+	first := history[0]
+	if minutes := now.Sub(first.at).Minutes(); minutes > 0 {
+		update.TokensPerMinute = float64(spend.Tokens()-first.tokens) / minutes
+		update.CostPerMinute = (spend.CostUSD - first.cost) / minutes
+	}
+
+	budget := op.Request.Budget
+	if !budget.Enabled() {
+		return update, history
+	}
+	status := budgetStatus(op.ID, budget, op.BudgetState)
+	update.Budget = &status
+
+	// The budget runs out with whichever of its limits is reached first.
+	var exhaustedIn *float64
+	earliest := func(minutes float64) {
+		seconds := minutes * 60
+		if exhaustedIn == nil || seconds < *exhaustedIn {
+			exhaustedIn = &seconds
+		}
+	}
+	if status.RemainingTokens != nil && update.TokensPerMinute > 0 {
+		earliest(float64(*status.RemainingTokens) / update.TokensPerMinute)
+	}
+	if status.RemainingCostUSD != nil && update.CostPerMinute > 0 {
+		earliest(*status.RemainingCostUSD / update.CostPerMinute)
+	}
+	update.ExhaustedInSeconds = exhaustedIn
+	return update, history
+}
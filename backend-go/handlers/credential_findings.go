@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/credentials"
+	"performa-backend/models"
+	"performa-backend/timeline"
+	"performa-backend/vault"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultCapturedCredentialsLimit = 100
+	maxCapturedCredentialsLimit     = 1000
+)
+
+// Sources of captured credentials.
+const (
+	credentialSourceFinding    = "finding"
+	credentialSourceBlackboard = "blackboard"
+)
+
+// redactFindingCredentials replaces the credentials in a finding's text by
+// placeholders and returns them, to be stored in the vault once the finding
+// has an ID.
+func redactFindingCredentials(finding *models.Finding) []vault.Secret {
+	var secrets, found []vault.Secret
+	finding.Title, found = vault.Redact(finding.Title)
+	secrets = append(secrets, found...)
+	finding.Description, found = vault.Redact(finding.Description)
+	secrets = append(secrets, found...)
+	finding.Evidence, found = vault.Redact(finding.Evidence)
+	return append(secrets, found...)
+}
+
+// vaultCredentials stores secrets captured by an agent, or by the operator
+// when agentID is empty.
+func vaultCredentials(workspaceID, agentID, findingID, target, source string, secrets []vault.Secret) {
+	operationID := ""
+	if agent := models.Manager.GetAgent(agentID); agent != nil {
+		operationID = agent.OperationID
+		if target == "" {
+			target = agent.Target
+		}
+	}
+	for _, secret := range secrets {
+		vault.Default.Add(vault.Credential{
+			WorkspaceID: workspaceID,
+			OperationID: operationID,
+			AgentID:     agentID,
+			FindingID:   findingID,
+			Target:      target,
+			Kind:        secret.Kind,
+			Username:    secret.Username,
+			Source:      source,
+		}, secret.Value)
+	}
+}
+
+// sharedCredentialSecrets reads the secrets out of a credential shared on the
+// blackboard, usually "user:password".
+func sharedCredentialSecrets(value string) []vault.Secret {
+	if _, secrets := vault.Redact(value); len(secrets) > 0 {
+		return secrets
+	}
+	if user, password, ok := strings.Cut(value, ":"); ok && user != "" && password != "" && !strings.ContainsAny(user, " \t") {
+		return []vault.Secret{{Kind: vault.KindPassword, Username: user, Value: password}}
+	}
+	return []vault.Secret{{Kind: vault.KindSecret, Value: value}}
+}
+
+// vaultSharedCredential stores a credential an agent shared on the
+// blackboard. Agents keep reading it from the blackboard in clear.
+func vaultSharedCredential(agent *models.Agent, value string) {
+	vaultCredentials(AgentWorkspace(agent.ID), agent.ID, "", agent.Target, credentialSourceBlackboard,
+		sharedCredentialSecrets(value))
+}
+
+// maskedBlackboardEntry is the form of a blackboard entry shown to operators:
+// shared credentials are masked.
+func maskedBlackboardEntry(entry models.BlackboardEntry) models.BlackboardEntry {
+	if entry.Kind != models.ResultCredential {
+		return entry
+	}
+	secrets := sharedCredentialSecrets(entry.Value)
+	masked := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret.Username != "" {
+			masked = append(masked, secret.Username+":"+vault.Mask(secret.Value))
+		} else {
+			masked = append(masked, vault.Mask(secret.Value))
+		}
+	}
+	entry.Value = strings.Join(masked, ", ")
+	return entry
+}
+
+// capturedCredentialInWorkspace returns the captured credential with the
+// given ID when it belongs to the request's workspace.
+func capturedCredentialInWorkspace(c *fiber.Ctx, id string) *vault.Credential {
+	credential := vault.Default.Get(id)
+	if credential == nil || !inWorkspace(c, credential.WorkspaceID) {
+		return nil
+	}
+	return credential
+}
+
+// GetCapturedCredentials lists the credentials captured in the workspace,
+// masked and most recent first, optionally filtered by ?operation_id,
+// ?finding_id, ?agent_id and ?kind.
+func GetCapturedCredentials(c *fiber.Ctx) error {
+	filter := vault.Filter{
+		WorkspaceID: currentWorkspace(c),
+		OperationID: c.Query("operation_id"),
+		FindingID:   c.Query("finding_id"),
+		AgentID:     c.Query("agent_id"),
+		Kind:        c.Query("kind"),
+		Limit:       c.QueryInt("limit", defaultCapturedCredentialsLimit),
+		Offset:      c.QueryInt("offset", 0),
+	}
+	if filter.Limit <= 0 || filter.Limit > maxCapturedCredentialsLimit {
+		filter.Limit = defaultCapturedCredentialsLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	captured, total := vault.Default.List(filter)
+	return c.JSON(fiber.Map{
+		"credentials": captured,
+		"total":       total,
+		"limit":       filter.Limit,
+		"offset":      filter.Offset,
+		"has_more":    filter.Offset+len(captured) < total,
+		"enabled":     vault.Default.Enabled(),
+	})
+}
+
+// GetCapturedCredential returns a captured credential, masked.
+func GetCapturedCredential(c *fiber.Ctx) error {
+	credential := capturedCredentialInWorkspace(c, c.Params("id"))
+	if credential == nil {
+		return apierror.New(404, apierror.NotFound, "Credential not found")
+	}
+	return c.JSON(credential)
+}
+
+// RevealCapturedCredential returns a captured credential's value in clear.
+// Every reveal is recorded in the credential's audit trail and on its
+// operation's timeline.
+func RevealCapturedCredential(c *fiber.Ctx) error {
+	credential := capturedCredentialInWorkspace(c, c.Params("id"))
+	if credential == nil {
+		return apierror.New(404, apierror.NotFound, "Credential not found")
+	}
+
+	actor := "anonymous"
+	if user := currentUser(c); user != nil {
+		actor = user.Username
+	}
+	value, reveal, err := vault.Default.Reveal(credential.ID, actor, c.IP())
+	switch {
+	case errors.Is(err, credentials.ErrNoMasterKey):
+		return credentialsDisabled(c)
+	case errors.Is(err, vault.ErrNotStored):
+		return apierror.New(410, apierror.ValidationFailed, "Credential value unavailable").WithReason(err)
+	case err != nil:
+		return apierror.New(500, apierror.Internal, "Failed to reveal credential").WithReason(err)
+	case reveal == nil:
+		return apierror.New(404, apierror.NotFound, "Credential not found")
+	}
+
+	if credential.OperationID != "" {
+		timeline.Record(timeline.Event{
+			OperationID: credential.OperationID,
+			AgentID:     credential.AgentID,
+			Type:        timeline.EventOperatorAction,
+			Actor:       timeline.ActorOperator,
+			Summary:     fmt.Sprintf("%s revealed a captured %s", actor, credential.Kind),
+			Data: map[string]interface{}{
+				"action":        "reveal_credential",
+				"credential_id": credential.ID,
+				"username":      credential.Username,
+				"actor":         actor,
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"credential": credential,
+		"value":      value,
+		"reveal":     reveal,
+	})
+}
+
+// GetCapturedCredentialReveals returns who revealed a captured credential and
+// when.
+func GetCapturedCredentialReveals(c *fiber.Ctx) error {
+	credential := capturedCredentialInWorkspace(c, c.Params("id"))
+	if credential == nil {
+		return apierror.New(404, apierror.NotFound, "Credential not found")
+	}
+	reveals := vault.Default.Reveals(credential.ID)
+	return c.JSON(fiber.Map{
+		"reveals": reveals,
+		"total":   len(reveals),
+	})
+}
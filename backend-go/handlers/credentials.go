@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/credentials"
+	"performa-backend/vault"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// InitCredentials unlocks the credentials store and the vault of captured
+// credentials with CREDENTIALS_MASTER_KEY and loads what they hold.
+func InitCredentials() {
+	if err := credentials.Default.SetMasterKey(config.AppConfig.CredentialsMasterKey); err != nil {
+		log.Printf("Warning: credentials store disabled: %v", err)
+		return
+	}
+	if err := vault.Default.SetMasterKey(config.AppConfig.CredentialsMasterKey); err != nil {
+		log.Printf("Warning: credential vault disabled: %v", err)
+		return
+	}
+	if !credentials.Default.Enabled() {
+		log.Println("Credentials store disabled: CREDENTIALS_MASTER_KEY is not set")
+		log.Println("Credential vault: values of captured credentials are redacted and discarded")
+	}
+	credentials.Default.Load()
+	vault.Default.Load()
+}
+
+// validateCredentialSelection checks that every credential an operation asks
+// for exists and belongs to the provider it is selected for.
+func validateCredentialSelection(selection map[string]string) error {
+	for provider, id := range selection {
+		if id == "" {
+			continue
+		}
+		credential := credentials.Default.Get(id)
+		if credential == nil {
+			return fmt.Errorf("credential %s not found", id)
+		}
+		if credential.Provider != provider {
+			return fmt.Errorf("credential %s is for %s, not %s", id, credential.Provider, provider)
+		}
+	}
+	return nil
+}
+
+func credentialsDisabled(c *fiber.Ctx) error {
+	return apierror.New(503, apierror.ServiceUnavailable, "Credentials store unavailable").WithReason(credentials.ErrNoMasterKey.Error())
+}
+
+func GetCredentials(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"credentials": credentials.Default.GetAll(c.Query("provider")),
+		"enabled":     credentials.Default.Enabled(),
+	})
+}
+
+func GetCredential(c *fiber.Ctx) error {
+	credential := credentials.Default.Get(c.Params("id"))
+	if credential == nil {
+		return apierror.New(404, apierror.NotFound, "Credential not found")
+	}
+	return c.JSON(credential)
+}
+
+func CreateCredential(c *fiber.Ctx) error {
+	if !credentials.Default.Enabled() {
+		return credentialsDisabled(c)
+	}
+
+	var req struct {
+		Name      string `json:"name"`
+		Provider  string `json:"provider"`
+		Value     string `json:"value"`
+		IsDefault bool   `json:"is_default"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	credential, err := credentials.Default.Create(req.Name, req.Provider, req.Value, req.IsDefault)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid credential").WithReason(err)
+	}
+	return c.Status(201).JSON(credential)
+}
+
+func UpdateCredential(c *fiber.Ctx) error {
+	if !credentials.Default.Enabled() {
+		return credentialsDisabled(c)
+	}
+
+	var req struct {
+		Name      *string `json:"name"`
+		Value     *string `json:"value"`
+		IsDefault bool    `json:"is_default"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	credential, err := credentials.Default.Update(c.Params("id"), req.Name, req.Value, req.IsDefault)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid credential").WithReason(err)
+	}
+	if credential == nil {
+		return apierror.New(404, apierror.NotFound, "Credential not found")
+	}
+	return c.JSON(credential)
+}
+
+func DeleteCredential(c *fiber.Ctx) error {
+	if !credentials.Default.Delete(c.Params("id")) {
+		return apierror.New(404, apierror.NotFound, "Credential not found")
+	}
+	return c.JSON(fiber.Map{
+		"status": "deleted",
+	})
+}
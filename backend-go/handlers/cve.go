@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/cve"
+	"performa-backend/escalation"
+	"performa-backend/models"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// cveLookupTimeout bounds the lookups of a finding's CVEs, including the
+	// waits for NVD's rate limit.
+	cveLookupTimeout = 3 * time.Minute
+	// maxCVEsPerFinding bounds the CVEs looked up for one finding.
+	maxCVEsPerFinding = 10
+	// Tool output is enriched within a step, so it waits less and for
+	// fewer CVEs; the rest stay with what the agent makes of them.
+	cveToolOutputTimeout = 20 * time.Second
+	maxCVEsPerToolOutput = 5
+	// maxCVEDescriptionInPrompt bounds a CVE's description in a prompt.
+	maxCVEDescriptionInPrompt = 300
+)
+
+// cveEnrichSlots bounds the findings enriched at once in the background, so
+// that a large import queues on them rather than on NVD's rate limit.
+var cveEnrichSlots = make(chan struct{}, 2)
+
+var errNoCVEs = errors.New("the finding references no CVE")
+
+// InitCVE configures the CVE sources and loads the cached records and KEV
+// catalog.
+func InitCVE() {
+	cve.Default.Configure(cve.Config{
+		NVDURL:    config.AppConfig.NVDAPIURL,
+		NVDKey:    config.AppConfig.NVDAPIKey,
+		OSVURL:    config.AppConfig.OSVAPIURL,
+		KEVURL:    config.AppConfig.CISAKEVURL,
+		CacheDir:  config.AppConfig.CVECacheDir,
+		CacheTTL:  time.Duration(config.AppConfig.CVECacheHours) * time.Hour,
+		MirrorDir: config.AppConfig.CVEMirrorDir,
+		Offline:   config.AppConfig.CVEOffline,
+	})
+}
+
+// findingCVEIDs returns the CVEs a finding's title, description and evidence
+// mention.
+func findingCVEIDs(finding *models.Finding) []string {
+	ids := cve.Extract(finding.Title + "\n" + finding.Description + "\n" + finding.Evidence)
+	if len(ids) > maxCVEsPerFinding {
+		ids = ids[:maxCVEsPerFinding]
+	}
+	return ids
+}
+
+// autoEnrichCVEs enriches a new finding that mentions CVEs in the
+// background when CVE_ENRICHMENT is enabled.
+func autoEnrichCVEs(finding *models.Finding) {
+	if !config.AppConfig.CVEEnrichment || len(findingCVEIDs(finding)) == 0 {
+		return
+	}
+	go func() {
+		cveEnrichSlots <- struct{}{}
+		defer func() { <-cveEnrichSlots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), cveLookupTimeout)
+		defer cancel()
+		if _, err := enrichFindingCVEs(ctx, finding.ID, false); err != nil {
+			log.Printf("CVE enrichment failed for %q: %v", finding.Title, err)
+		}
+	}()
+}
+
+// enrichFindingCVEs looks up the CVEs a finding references, attaches what
+// is known about them and recalculates its severity. A finding with its own
+// CVSS vector keeps it; otherwise the highest scored CVE's vector and
+// severity are taken. A CVE exploited in the wild makes the finding at least
+// high. Escalation policies apply when the severity was raised.
+func enrichFindingCVEs(ctx context.Context, id string, refresh bool) (*models.Finding, error) {
+	finding := models.Findings.GetFinding(id)
+	if finding == nil {
+		return nil, fmt.Errorf("finding was deleted")
+	}
+	ids := findingCVEIDs(finding)
+	if len(ids) == 0 {
+		return nil, errNoCVEs
+	}
+
+	var records []*cve.Record
+	errs := make(map[string]string)
+	for _, cveID := range ids {
+		record, err := cve.Default.Lookup(ctx, cveID, refresh)
+		switch {
+		case errors.Is(err, cve.ErrNotFound):
+			errs[cveID] = "unknown CVE"
+		case err != nil:
+			errs[cveID] = err.Error()
+		default:
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no CVE could be looked up: %s", joinErrors(errs))
+	}
+
+	enrichment := &models.FindingCVEEnrichment{
+		CVEs:       make([]models.FindingCVE, 0, len(records)),
+		Applied:    []string{},
+		EnrichedAt: time.Now(),
+	}
+	if len(errs) > 0 {
+		enrichment.Errors = errs
+	}
+	var best *cve.Record
+	exploited := false
+	for _, record := range records {
+		enrichment.CVEs = append(enrichment.CVEs, findingCVE(record))
+		if record.CVSSScore != nil && (best == nil || *record.CVSSScore > *best.CVSSScore) {
+			best = record
+		}
+		exploited = exploited || record.Exploited != nil
+	}
+
+	previous := finding.Severity
+	updated := models.Findings.UpdateFinding(id, func(f *models.Finding) {
+		applyCVEEnrichment(f, enrichment, best, exploited)
+	})
+	if updated == nil {
+		return nil, fmt.Errorf("finding was deleted")
+	}
+	if models.SeverityRank[updated.Severity] > models.SeverityRank[previous] {
+		escalation.Evaluate(updated, previous)
+	}
+	ws.BroadcastMessage("finding_enriched", updated.ID)
+	return updated, nil
+}
+
+// applyCVEEnrichment stores an enrichment on a finding and recalculates the
+// fields it bears on, recording which changed.
+func applyCVEEnrichment(f *models.Finding, enrichment *models.FindingCVEEnrichment, best *cve.Record, exploited bool) {
+	enrichment.PreviousSeverity = f.Severity
+	severity := f.Severity
+	if f.CVSSVector == "" && best != nil {
+		if best.CVSSVector != "" {
+			score := *best.CVSSScore
+			f.CVSSVector, f.CVSSScore = best.CVSSVector, &score
+			enrichment.Applied = append(enrichment.Applied, "cvss_vector")
+		}
+		severity = models.Severity(best.Severity)
+	}
+	if exploited && models.SeverityRank[severity] < models.SeverityRank[models.SeverityHigh] {
+		severity = models.SeverityHigh
+	}
+	enrichment.Severity = severity
+	if severity != f.Severity {
+		f.Severity = severity
+		enrichment.Applied = append(enrichment.Applied, "severity")
+	}
+	if f.CWE == "" && best != nil && len(best.CWEs) > 0 {
+		f.CWE = models.NormalizeCWE(best.CWEs[0])
+		if f.OWASP == "" {
+			f.OWASP = models.OWASPForCWE(f.CWE)
+		}
+		enrichment.Applied = append(enrichment.Applied, "cwe_id")
+	}
+	f.CVEEnrichment = enrichment
+}
+
+// findingCVE converts a looked up CVE for a finding.
+func findingCVE(record *cve.Record) models.FindingCVE {
+	entry := models.FindingCVE{
+		ID:          record.ID,
+		Description: record.Description,
+		CVSSVector:  record.CVSSVector,
+		CVSSScore:   record.CVSSScore,
+		Severity:    models.Severity(record.Severity),
+		CWEs:        record.CWEs,
+		References:  record.References,
+		Sources:     record.Sources,
+	}
+	for _, affected := range record.Affected {
+		entry.Affected = append(entry.Affected, strings.TrimSpace(affected.Product+" "+strings.Join(affected.Versions, "; ")))
+	}
+	if record.Exploited != nil {
+		entry.KnownExploited = true
+		entry.KEVDateAdded = record.Exploited.DateAdded
+		entry.KEVDueDate = record.Exploited.DueDate
+		entry.KnownRansomware = record.Exploited.KnownRansomware
+	}
+	return entry
+}
+
+func joinErrors(errs map[string]string) string {
+	parts := make([]string, 0, len(errs))
+	for id, message := range errs {
+		parts = append(parts, id+": "+message)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "; ")
+}
+
+// cveToolOutputMessage looks up the CVEs a step's tool output mentions and
+// returns what is known about them as a prompt, or "" when there is nothing.
+func cveToolOutputMessage(output string) string {
+	if !config.AppConfig.CVEEnrichment {
+		return ""
+	}
+	ids := cve.Extract(output)
+	if len(ids) == 0 {
+		return ""
+	}
+	more := len(ids) - maxCVEsPerToolOutput
+	if more > 0 {
+		ids = ids[:maxCVEsPerToolOutput]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cveToolOutputTimeout)
+	defer cancel()
+	var lines []string
+	for _, id := range ids {
+		record, err := cve.Default.Lookup(ctx, id, false)
+		if err != nil {
+			continue
+		}
+		lines = append(lines, formatCVERecord(record))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	message := "CVE details for the tool output (NVD, OSV, CISA KEV):\n" + strings.Join(lines, "\n")
+	if more > 0 {
+		message += fmt.Sprintf("\n(%d more CVEs were not looked up)", more)
+	}
+	return message
+}
+
+// formatCVERecord writes a CVE on one line for an agent's prompt.
+func formatCVERecord(record *cve.Record) string {
+	var b strings.Builder
+	b.WriteString("- " + record.ID)
+	if record.CVSSScore != nil {
+		fmt.Fprintf(&b, " (CVSS %.1f %s)", *record.CVSSScore, record.Severity)
+	}
+	if record.Exploited != nil {
+		b.WriteString(" [known exploited in the wild")
+		if record.Exploited.KnownRansomware {
+			b.WriteString(", used by ransomware")
+		}
+		b.WriteString("]")
+	}
+	if description := record.Description; description != "" {
+		if len(description) > maxCVEDescriptionInPrompt {
+			description = description[:maxCVEDescriptionInPrompt] + "..."
+		}
+		b.WriteString(": " + strings.Join(strings.Fields(description), " "))
+	}
+	var affected []string
+	for _, entry := range record.Affected {
+		if len(entry.Versions) > 0 && len(affected) < 3 {
+			affected = append(affected, entry.Product+" "+strings.Join(entry.Versions, "; "))
+		}
+	}
+	if len(affected) > 0 {
+		b.WriteString(" Affects " + strings.Join(affected, ", ") + ".")
+	}
+	return b.String()
+}
+
+// EnrichFindingCVEs looks up the CVEs a finding references again and
+// recalculates its severity. ?refresh=true skips the CVE cache.
+func EnrichFindingCVEs(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), cveLookupTimeout)
+	defer cancel()
+
+	updated, err := enrichFindingCVEs(ctx, c.Params("id"), c.QueryBool("refresh"))
+	switch {
+	case errors.Is(err, errNoCVEs):
+		return apierror.New(400, apierror.ValidationFailed, "Finding references no CVE").
+			With("message", "Mention the CVE IDs in the finding's title, description or evidence")
+	case err != nil:
+		return apierror.New(502, apierror.ProviderError, "CVE enrichment failed").WithReason(err)
+	}
+	return c.JSON(updated)
+}
+
+// GetCVEStatus reports how CVEs are looked up and the state of the KEV
+// catalog.
+func GetCVEStatus(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"enrichment": config.AppConfig.CVEEnrichment,
+		"status":     cve.Default.Status(),
+	})
+}
+
+// GetCVE looks a CVE up. ?refresh=true skips the cache.
+func GetCVE(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), cveLookupTimeout)
+	defer cancel()
+
+	id := c.Params("id")
+	record, err := cve.Default.Lookup(ctx, id, c.QueryBool("refresh"))
+	switch {
+	case errors.Is(err, cve.ErrInvalidID):
+		return apierror.New(400, apierror.ValidationFailed, "Invalid CVE ID").WithReason(err).With("id", id)
+	case errors.Is(err, cve.ErrNotFound):
+		return apierror.New(404, apierror.NotFound, "CVE not found").With("id", id)
+	case errors.Is(err, cve.ErrOffline):
+		return apierror.New(503, apierror.ServiceUnavailable, "CVE not available offline").WithReason(err).With("id", id)
+	case err != nil:
+		return apierror.New(502, apierror.ProviderError, "CVE lookup failed").WithReason(err).With("id", id)
+	}
+	return c.JSON(record)
+}
+
+// SyncKEVCatalog downloads CISA's catalog of known exploited
+// vulnerabilities again.
+func SyncKEVCatalog(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), cveLookupTimeout)
+	defer cancel()
+
+	entries, err := cve.Default.SyncKEV(ctx)
+	switch {
+	case errors.Is(err, cve.ErrOffline):
+		return apierror.New(503, apierror.ServiceUnavailable, "KEV catalog not available offline").WithReason(err)
+	case err != nil:
+		return apierror.New(502, apierror.ProviderError, "KEV catalog download failed").WithReason(err)
+	}
+	return c.JSON(fiber.Map{"entries": entries, "status": cve.Default.Status()})
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/digests"
+	"performa-backend/mailer"
+	"performa-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RecipientRequest creates or updates an email recipient. On update,
+// omitted fields are left unchanged.
+type RecipientRequest struct {
+	Email              *string `json:"email"`
+	Name               *string `json:"name"`
+	MinSeverity        *string `json:"min_severity"`
+	OperationSummaries *bool   `json:"operation_summaries"`
+	DailyDigest        *bool   `json:"daily_digest"`
+	Enabled            *bool   `json:"enabled"`
+}
+
+func (req *RecipientRequest) apply(recipient *digests.Recipient) {
+	if req.Email != nil {
+		recipient.Email = *req.Email
+	}
+	if req.Name != nil {
+		recipient.Name = *req.Name
+	}
+	if req.MinSeverity != nil {
+		recipient.MinSeverity = *req.MinSeverity
+	}
+	if req.OperationSummaries != nil {
+		recipient.OperationSummaries = *req.OperationSummaries
+	}
+	if req.DailyDigest != nil {
+		recipient.DailyDigest = *req.DailyDigest
+	}
+	if req.Enabled != nil {
+		recipient.Enabled = *req.Enabled
+	}
+}
+
+// TestEmailRequest names the address a test email goes to.
+type TestEmailRequest struct {
+	To string `json:"to" validate:"required"`
+}
+
+// InitEmail loads the email recipients and starts the daily digest
+// scheduler.
+func InitEmail() {
+	digests.Default.Load()
+	go digests.Start(digestCheckInterval)
+}
+
+// GetEmailSettings reports the mailer's SMTP settings, without the
+// password. They are changed through the smtp_* runtime settings.
+func GetEmailSettings(c *fiber.Ctx) error {
+	return c.JSON(mailer.Current())
+}
+
+// SendTestEmail sends a short message through the configured SMTP server.
+func SendTestEmail(c *fiber.Ctx) error {
+	var req TestEmailRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	to := strings.TrimSpace(req.To)
+	if !mailer.ValidAddress(to) {
+		return apierror.New(400, apierror.ValidationFailed, "to must be an email address")
+	}
+
+	err := mailer.Send(mailer.Message{
+		To:      []string{to},
+		Subject: "[Performa] Test email",
+		Text:    "This is a test email from Performa. Email digests are configured correctly.",
+		HTML:    "<p>This is a test email from Performa. Email digests are configured correctly.</p>",
+	})
+	if errors.Is(err, mailer.ErrNotConfigured) {
+		return apierror.New(503, apierror.ServiceUnavailable, "Email is not configured").WithReason(err)
+	}
+	if err != nil {
+		return apierror.New(502, apierror.ProviderError, "Failed to send test email").WithReason(err)
+	}
+	return c.JSON(fiber.Map{
+		"message": "Test email sent",
+		"to":      to,
+	})
+}
+
+func GetEmailRecipients(c *fiber.Ctx) error {
+	list := digests.Default.List(currentWorkspace(c))
+	return c.JSON(fiber.Map{
+		"recipients": list,
+		"total":      len(list),
+	})
+}
+
+func GetEmailRecipient(c *fiber.Ctx) error {
+	recipient, err := workspaceRecipient(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(recipient)
+}
+
+// CreateEmailRecipient adds a recipient, by default enabled and subscribed
+// to both operation summaries and daily digests.
+func CreateEmailRecipient(c *fiber.Ctx) error {
+	var req RecipientRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	recipient := digests.Recipient{
+		WorkspaceID:        currentWorkspace(c),
+		OperationSummaries: true,
+		DailyDigest:        true,
+		Enabled:            true,
+	}
+	req.apply(&recipient)
+	created, err := digests.Default.Create(recipient)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid recipient").WithReason(err)
+	}
+	return c.Status(201).JSON(created)
+}
+
+func UpdateEmailRecipient(c *fiber.Ctx) error {
+	var req RecipientRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if _, err := workspaceRecipient(c, c.Params("id")); err != nil {
+		return err
+	}
+
+	updated, err := digests.Default.Update(c.Params("id"), req.apply)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid recipient").WithReason(err)
+	}
+	if updated == nil {
+		return apierror.New(404, apierror.NotFound, "Recipient not found")
+	}
+	return c.JSON(updated)
+}
+
+func DeleteEmailRecipient(c *fiber.Ctx) error {
+	if _, err := workspaceRecipient(c, c.Params("id")); err != nil {
+		return err
+	}
+	digests.Default.Delete(c.Params("id"))
+	return c.JSON(fiber.Map{
+		"message": "Recipient deleted",
+	})
+}
+
+// SendRecipientDigest sends a recipient's daily digest now instead of
+// waiting for the digest hour. The next digest covers the findings reported
+// after it.
+func SendRecipientDigest(c *fiber.Ctx) error {
+	if _, err := workspaceRecipient(c, c.Params("id")); err != nil {
+		return err
+	}
+	if !mailer.Configured() {
+		return apierror.New(503, apierror.ServiceUnavailable, "Email is not configured").WithReason(mailer.ErrNotConfigured)
+	}
+
+	sent, err := digests.SendDigest(c.Params("id"))
+	if err != nil {
+		return apierror.New(502, apierror.ProviderError, "Failed to send digest").WithReason(err)
+	}
+	return c.JSON(fiber.Map{
+		"sent": sent,
+	})
+}
+
+// PreviewRecipientDigest renders the daily digest the recipient would get
+// now, as HTML, without sending it.
+func PreviewRecipientDigest(c *fiber.Ctx) error {
+	recipient, err := workspaceRecipient(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	msg, err := digests.DailyEmail(recipient, time.Now()).Message()
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to render digest").WithReason(err)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.SendString(msg.HTML)
+}
+
+// notifyOperationFinished emails the summary of an operation that just
+// finished to the recipients of its workspace.
+func notifyOperationFinished(op *models.Operation) {
+	if !mailer.Configured() {
+		return
+	}
+	agents := models.Manager.GetOperationAgents(op.ID)
+	summary := digests.Operation{
+		ID:          op.ID,
+		Target:      op.Target,
+		Status:      string(op.Status),
+		Agents:      len(agents),
+		StartedAt:   op.CreatedAt,
+		CompletedAt: op.CompletedAt,
+	}
+	for _, agent := range agents {
+		findings, _ := models.Findings.Query(models.FindingFilter{AgentID: agent.ID})
+		for _, f := range findings {
+			summary.Findings = append(summary.Findings, digests.FromModel(f))
+		}
+	}
+	digests.SendOperationSummary(op.WorkspaceID, summary)
+}
+
+func workspaceRecipient(c *fiber.Ctx, id string) (*digests.Recipient, error) {
+	recipient := digests.Default.Get(id)
+	if recipient == nil || !inWorkspace(c, recipient.WorkspaceID) {
+		return nil, apierror.New(404, apierror.NotFound, "Recipient not found").With("recipient_id", id)
+	}
+	return recipient, nil
+}
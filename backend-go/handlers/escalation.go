@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/escalation"
+	"performa-backend/integrations"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// digestCheckInterval is how often due digests are looked for; digests
+// themselves are sent hourly or daily.
+const digestCheckInterval = time.Minute
+
+// PolicyRequest creates or updates an escalation policy. On update, omitted
+// fields are left unchanged.
+type PolicyRequest struct {
+	Name       *string             `json:"name"`
+	Enabled    *bool               `json:"enabled"`
+	Severities []string            `json:"severities"`
+	Categories []string            `json:"categories"`
+	Actions    []escalation.Action `json:"actions"`
+}
+
+func (req *PolicyRequest) apply(policy *escalation.Policy) {
+	if req.Name != nil {
+		policy.Name = *req.Name
+	}
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.Severities != nil {
+		policy.Severities = req.Severities
+	}
+	if req.Categories != nil {
+		policy.Categories = req.Categories
+	}
+	if req.Actions != nil {
+		policy.Actions = req.Actions
+	}
+}
+
+// validatePolicyIntegrations checks the policy's issue actions reference
+// existing integrations.
+func validatePolicyIntegrations(policy *escalation.Policy) error {
+	for _, action := range policy.Actions {
+		if action.Type == escalation.ActionIssue && integrations.Default.Get(action.IntegrationID) == nil {
+			return fmt.Errorf("integration %s not found", action.IntegrationID)
+		}
+	}
+	return nil
+}
+
+func GetPolicies(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"policies": escalation.Default.GetAll(),
+	})
+}
+
+func GetPolicy(c *fiber.Ctx) error {
+	policy := escalation.Default.Get(c.Params("id"))
+	if policy == nil {
+		return apierror.New(404, apierror.NotFound, "Policy not found")
+	}
+	return c.JSON(policy)
+}
+
+func CreatePolicy(c *fiber.Ctx) error {
+	var req PolicyRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	policy := escalation.Policy{Enabled: true}
+	req.apply(&policy)
+	if err := validatePolicyIntegrations(&policy); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid policy").WithReason(err)
+	}
+
+	created, err := escalation.Default.Create(policy)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid policy").WithReason(err)
+	}
+	return c.Status(201).JSON(created)
+}
+
+func UpdatePolicy(c *fiber.Ctx) error {
+	var req PolicyRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	updated, err := escalation.Default.Update(c.Params("id"), func(policy *escalation.Policy) error {
+		req.apply(policy)
+		return validatePolicyIntegrations(policy)
+	})
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid policy").WithReason(err)
+	}
+	if updated == nil {
+		return apierror.New(404, apierror.NotFound, "Policy not found")
+	}
+	return c.JSON(updated)
+}
+
+func DeletePolicy(c *fiber.Ctx) error {
+	if !escalation.Default.Delete(c.Params("id")) {
+		return apierror.New(404, apierror.NotFound, "Policy not found")
+	}
+	return c.JSON(fiber.Map{
+		"message": "Policy deleted",
+	})
+}
+
+// SendPolicyDigest sends a policy's pending digest now instead of waiting
+// for its interval.
+func SendPolicyDigest(c *fiber.Ctx) error {
+	if escalation.Default.Get(c.Params("id")) == nil {
+		return apierror.New(404, apierror.NotFound, "Policy not found")
+	}
+
+	sent, err := escalation.SendDigest(c.Params("id"))
+	if errors.Is(err, escalation.ErrNoDigest) {
+		return apierror.New(400, apierror.ValidationFailed, "Policy has no digest action")
+	}
+	if err != nil {
+		return apierror.New(502, apierror.ProviderError, "Failed to send digest").WithReason(err)
+	}
+	return c.JSON(fiber.Map{
+		"sent": sent,
+	})
+}
+
+// InitEscalation loads the escalation policies and starts the digest
+// scheduler.
+func InitEscalation() {
+	escalation.Default.Load()
+	go escalation.StartDigests(digestCheckInterval)
+}
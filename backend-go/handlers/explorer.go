@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// explorerTrashDir holds deleted explorer entries inside the findings root.
+// The explorer listing hides it.
+const explorerTrashDir = ".trash"
+
+var errOutsideFindingsRoot = errors.New("path is outside the findings directory")
+
+// explorerDir returns the findings directory of the request's workspace, the
+// root the explorer works in. The default workspace's is the findings
+// directory itself; the directories of the other workspaces inside it are
+// hidden from the default workspace's explorer.
+func explorerDir(c *fiber.Ctx) string {
+	return filepath.Join(config.AppConfig.FindingsDir, filepath.FromSlash(models.WorkspaceDir(currentWorkspace(c))))
+}
+
+// reservedExplorerEntry reports whether rel, relative to the explorer root,
+// is in the trash or the workspaces directory.
+func reservedExplorerEntry(rel, reserved string) bool {
+	return rel == reserved || strings.HasPrefix(rel, reserved+"/")
+}
+
+// findingsRoot returns the absolute explorer root dir with symlinks
+// resolved, creating it if needed.
+func findingsRoot(dir string) (string, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	os.MkdirAll(root, 0755)
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	return root, nil
+}
+
+// resolveExplorerPath maps a path relative to the explorer root dir, or
+// prefixed with dir as the explorer listing returns paths, to an absolute
+// path that is guaranteed to stay inside the root, even through symlinks.
+// The trash is only reachable when allowTrash is set, and the workspaces
+// directory never is.
+func resolveExplorerPath(dir, path string, allowTrash bool) (string, string, error) {
+	root, err := findingsRoot(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	path = filepath.Clean(strings.TrimSpace(path))
+	listed := filepath.Clean(dir)
+	if abs, err := filepath.Abs(listed); err == nil && filepath.IsAbs(path) {
+		listed = abs
+	}
+	if path == listed {
+		path = ""
+	} else if strings.HasPrefix(path, listed+string(filepath.Separator)) {
+		path = strings.TrimPrefix(path, listed+string(filepath.Separator))
+	} else if filepath.IsAbs(path) {
+		return "", "", errOutsideFindingsRoot
+	}
+	if path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", "", errOutsideFindingsRoot
+	}
+
+	clean := filepath.Clean("/" + filepath.ToSlash(path))
+	rel := strings.TrimPrefix(clean, "/")
+	if rel == "" {
+		return root, "", nil
+	}
+	if !allowTrash && reservedExplorerEntry(rel, explorerTrashDir) {
+		return "", "", fmt.Errorf("the trash cannot be modified through this path")
+	}
+	if reservedExplorerEntry(rel, models.WorkspacesDir) {
+		return "", "", errOutsideFindingsRoot
+	}
+
+	full := filepath.Join(root, filepath.FromSlash(rel))
+
+	// Resolve symlinks in the deepest existing ancestor so a link inside the
+	// root cannot lead outside it.
+	existing := full
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", "", err
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", "", errOutsideFindingsRoot
+	}
+	return full, rel, nil
+}
+
+func explorerError(c *fiber.Ctx, status int, message string, err error) error {
+	return apierror.Status(status, message).WithReason(err)
+}
+
+// CreateExplorerFolder creates a folder, and any missing parents, under the
+// findings root.
+func CreateExplorerFolder(c *fiber.Ctx) error {
+	var req struct {
+		Path string `json:"path" validate:"required"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if strings.TrimSpace(req.Path) == "" {
+		return apierror.New(400, apierror.ValidationFailed, "path is required")
+	}
+
+	full, rel, err := resolveExplorerPath(explorerDir(c), req.Path, false)
+	if err != nil {
+		return explorerError(c, 400, "Invalid path", err)
+	}
+	if rel == "" {
+		return apierror.New(400, apierror.ValidationFailed, "path is required")
+	}
+	if info, err := os.Stat(full); err == nil && !info.IsDir() {
+		return apierror.New(409, apierror.Conflict, "A file with that name already exists")
+	}
+	if err := os.MkdirAll(full, 0755); err != nil {
+		return explorerError(c, 500, "Failed to create folder", err)
+	}
+	return c.Status(201).JSON(fiber.Map{
+		"path": rel,
+	})
+}
+
+// MoveExplorerEntry renames or moves a file or folder within the findings
+// root. It refuses to overwrite an existing entry.
+func MoveExplorerEntry(c *fiber.Ctx) error {
+	var req struct {
+		From string `json:"from" validate:"required"`
+		To   string `json:"to" validate:"required"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	from, fromRel, err := resolveExplorerPath(explorerDir(c), req.From, false)
+	if err != nil {
+		return explorerError(c, 400, "Invalid source path", err)
+	}
+	to, toRel, err := resolveExplorerPath(explorerDir(c), req.To, false)
+	if err != nil {
+		return explorerError(c, 400, "Invalid destination path", err)
+	}
+	if fromRel == "" || toRel == "" {
+		return apierror.New(400, apierror.ValidationFailed, "The findings root cannot be moved")
+	}
+	if _, err := os.Lstat(from); err != nil {
+		return apierror.New(404, apierror.NotFound, "Source not found")
+	}
+	if toRel == fromRel || strings.HasPrefix(toRel, fromRel+"/") {
+		return apierror.New(400, apierror.ValidationFailed, "A folder cannot be moved into itself")
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return apierror.New(409, apierror.Conflict, "Destination already exists")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return explorerError(c, 500, "Failed to create destination folder", err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return explorerError(c, 500, "Failed to move", err)
+	}
+	return c.JSON(fiber.Map{
+		"from": fromRel,
+		"to":   toRel,
+	})
+}
+
+// DeleteExplorerEntry moves a file or folder into the trash, or removes it
+// for good with ?permanent=true.
+func DeleteExplorerEntry(c *fiber.Ctx) error {
+	full, rel, err := resolveExplorerPath(explorerDir(c), c.Query("path"), false)
+	if err != nil {
+		return explorerError(c, 400, "Invalid path", err)
+	}
+	if rel == "" {
+		return apierror.New(400, apierror.ValidationFailed, "The findings root cannot be deleted")
+	}
+	if _, err := os.Lstat(full); err != nil {
+		return apierror.New(404, apierror.NotFound, "Not found")
+	}
+
+	if c.QueryBool("permanent") {
+		if err := os.RemoveAll(full); err != nil {
+			return explorerError(c, 500, "Failed to delete", err)
+		}
+		return c.JSON(fiber.Map{
+			"deleted": rel,
+		})
+	}
+
+	root, _ := findingsRoot(explorerDir(c))
+	trashName := time.Now().UTC().Format("20060102T150405.000") + "-" + strings.ReplaceAll(rel, "/", "__")
+	trashPath := filepath.Join(root, explorerTrashDir, trashName)
+	if err := os.MkdirAll(filepath.Dir(trashPath), 0755); err != nil {
+		return explorerError(c, 500, "Failed to create trash", err)
+	}
+	if err := os.Rename(full, trashPath); err != nil {
+		return explorerError(c, 500, "Failed to move to trash", err)
+	}
+	return c.JSON(fiber.Map{
+		"deleted": rel,
+		"trash":   explorerTrashDir + "/" + trashName,
+	})
+}
+
+// GetExplorerTrash lists deleted entries.
+func GetExplorerTrash(c *fiber.Ctx) error {
+	root, err := findingsRoot(explorerDir(c))
+	if err != nil {
+		return explorerError(c, 500, "Failed to read trash", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(root, explorerTrashDir))
+
+	items := make([]fiber.Map, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		deletedAt, original, _ := strings.Cut(entry.Name(), "-")
+		items = append(items, fiber.Map{
+			"name":       entry.Name(),
+			"path":       explorerTrashDir + "/" + entry.Name(),
+			"original":   strings.ReplaceAll(original, "__", "/"),
+			"deleted_at": deletedAt,
+			"is_dir":     entry.IsDir(),
+			"size":       info.Size(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"items": items,
+		"total": len(items),
+	})
+}
+
+// EmptyExplorerTrash permanently removes everything in the trash.
+func EmptyExplorerTrash(c *fiber.Ctx) error {
+	full, _, err := resolveExplorerPath(explorerDir(c), explorerTrashDir, true)
+	if err != nil {
+		return explorerError(c, 500, "Failed to empty trash", err)
+	}
+	if err := os.RemoveAll(full); err != nil {
+		return explorerError(c, 500, "Failed to empty trash", err)
+	}
+	return c.JSON(fiber.Map{
+		"message": "Trash emptied",
+	})
+}
+
+// ArchiveExplorerFolder streams a zip of a folder (the whole findings root
+// when path is empty) as a download. The trash is never included.
+func ArchiveExplorerFolder(c *fiber.Ctx) error {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if len(c.Body()) > 0 {
+		if err := parseBody(c, &req); err != nil {
+			return err
+		}
+	}
+
+	full, rel, err := resolveExplorerPath(explorerDir(c), req.Path, false)
+	if err != nil {
+		return explorerError(c, 400, "Invalid path", err)
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return apierror.New(404, apierror.NotFound, "Folder not found")
+	}
+	if !info.IsDir() {
+		return apierror.New(400, apierror.ValidationFailed, "path must be a folder")
+	}
+
+	name := filepath.Base(rel)
+	if rel == "" {
+		name = "findings"
+	}
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, name))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		archive := zip.NewWriter(w)
+		defer archive.Close()
+
+		filepath.WalkDir(full, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			relPath, _ := filepath.Rel(full, path)
+			if rel == "" && (reservedExplorerEntry(filepath.ToSlash(relPath), explorerTrashDir) || reservedExplorerEntry(filepath.ToSlash(relPath), models.WorkspacesDir)) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+			return addToArchive(archive, path, filepath.ToSlash(filepath.Join(name, relPath)))
+		})
+	})
+	return nil
+}
+
+func addToArchive(archive *zip.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	writer, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"performa-backend/brain"
+	"performa-backend/executor"
+	"performa-backend/failures"
+	"performa-backend/models"
+	"performa-backend/ws"
+)
+
+// backoffTick is how often an agent waiting out a retry backoff checks in.
+const backoffTick = time.Second
+
+// chatWithPolicies runs one model turn and, while it fails, applies the retry
+// policy of the error's class: call again after a backoff, switch to the
+// fallback model, or give up with the error. It reports whether the call
+// spent what was left of the agent's budget. A replayed call costs nothing
+// and its recorded error gets the policy the run applied to it.
+func (conv *agentConversation) chatWithPolicies(operatorWaiting bool) (string, bool, error) {
+	agent := conv.agent
+	conv.retries = make(map[string]int)
+	for {
+		conv.recordPrompt()
+		response, stats, err := conv.chat(operatorWaiting)
+		conv.recordResponse(response, err)
+		if conv.replay != nil {
+			if err == nil || errors.Is(err, errReplayEnded) || !conv.retryAfter(err) {
+				return response, false, err
+			}
+			continue
+		}
+		models.Manager.RecordLLMCall(agent.ID, stats.Latency, stats.BytesSent, stats.BytesReceived)
+		models.Manager.RecordLLMUsage(agent.ID, stats.PromptTokens, stats.CompletionTokens, stats.Cost)
+		exhausted := chargeAgentCall(agent, stats)
+		if err == nil || exhausted || !conv.retryAfter(err) {
+			return response, exhausted, err
+		}
+		if !sleepAgent(agent, 0) {
+			return "", false, errAgentStopped
+		}
+	}
+}
+
+// retryAfter applies the retry policy of err's class to a failed model call
+// and reports whether to call again. A fallback is taken once per turn. A
+// replay only follows the policy, without waiting or noting the failure.
+func (conv *agentConversation) retryAfter(err error) bool {
+	agent := conv.agent
+	class := failures.Classify(err)
+	policy := failures.Resolve(class, conv.req.RetryPolicies)
+	attempt := conv.retries[class] + 1
+	failure := failures.Failure{Class: class, Message: err.Error(), Attempt: attempt, Model: conv.req.Model}
+
+	switch {
+	case policy.Action == failures.ActionRetry && attempt <= policy.MaxRetries:
+		delay := policy.Backoff(attempt)
+		failure.Action = failures.ActionRetry
+		failure.RetryIn = delay.Seconds()
+		conv.retries[class] = attempt
+		if conv.replay != nil {
+			return true
+		}
+		noteAgentFailure(agent, failure)
+		models.Manager.AddMessage(agent.ID, "system", fmt.Sprintf("Model call failed (%s), retrying in %s (%d/%d): %v",
+			class, delay.Round(time.Second), attempt, policy.MaxRetries, err))
+		return sleepAgent(agent, delay)
+	case policy.Action == failures.ActionFallback && attempt == 1 && policy.FallbackModel != conv.req.Model:
+		failure.Action = failures.ActionFallback
+		conv.retries[class] = attempt
+		if conv.replay != nil {
+			conv.req.Model = policy.FallbackModel
+			return true
+		}
+		noteAgentFailure(agent, failure)
+		models.Manager.AddMessage(agent.ID, "system", fmt.Sprintf("Model call failed (%s), falling back from %s to %s: %v",
+			class, conv.req.Model, policy.FallbackModel, err))
+		conv.req.Model = policy.FallbackModel
+		models.Manager.SetAgentModel(agent.ID, policy.FallbackModel)
+		return true
+	}
+	return false
+}
+
+// retryToolRun runs a command and, while it times out or its tool is
+// missing, runs it again as the retry policy of the class says. It returns
+// the last result and how many runs it took; the CPU time of the earlier
+// runs is charged to the agent here.
+func retryToolRun(agent *models.Agent, req models.StartRequest, command string, run func() *executor.Result) (*executor.Result, int) {
+	for attempt := 1; ; attempt++ {
+		result := run()
+		class := failures.ClassifyTool(result.Error)
+		if class == failures.Unknown {
+			return result, attempt
+		}
+		policy := failures.Resolve(class, req.RetryPolicies)
+		if policy.Action != failures.ActionRetry || attempt > policy.MaxRetries {
+			return result, attempt
+		}
+
+		delay := policy.Backoff(attempt)
+		noteAgentFailure(agent, failures.Failure{
+			Class:   class,
+			Message: result.Error,
+			Action:  failures.ActionRetry,
+			Attempt: attempt,
+			Command: command,
+			RetryIn: delay.Seconds(),
+		})
+		models.Manager.RecordToolRun(agent.ID, result.CPUSeconds)
+		if !sleepAgent(agent, delay) {
+			return result, attempt
+		}
+	}
+}
+
+// generateStrategy asks the Brain for an operation's strategy. While the
+// Brain is unavailable it applies the brain_unavailable policy: ask again
+// after a backoff, fall back to the cached strategy, or fail.
+func generateStrategy(req models.StartRequest, strategyReq *brain.StrategyRequest) (*brain.StrategyResponse, error) {
+	policy := failures.Resolve(failures.BrainUnavailable, req.RetryPolicies)
+	for retry := 1; ; retry++ {
+		strategy, err := brainClient.GenerateStrategy(strategyReq)
+		if err == nil {
+			return strategy, nil
+		}
+		brainFailed(err)
+		if !brain.IsOutage(err) {
+			return nil, err
+		}
+
+		switch {
+		case policy.Action == failures.ActionRetry && retry <= policy.MaxRetries:
+			delay := policy.Backoff(retry)
+			log.Printf("Strategy generation failed, retrying in %s (%d/%d): %v", delay, retry, policy.MaxRetries, err)
+			time.Sleep(delay)
+		case policy.Action == failures.ActionFallback:
+			if cached, ok := brain.CachedStrategy(strategyReq); ok {
+				log.Printf("Strategy generation failed, falling back to the cached strategy: %v", err)
+				return cached, nil
+			}
+			return nil, err
+		default:
+			return nil, err
+		}
+	}
+}
+
+// noteAgentFailure records a classified error on the agent and reports it to
+// its subscribers.
+func noteAgentFailure(agent *models.Agent, failure failures.Failure) {
+	failure.At = time.Now()
+	models.Manager.RecordFailure(agent.ID, failure)
+	ws.BroadcastAgentFailure(agent.ID, failure)
+	log.Printf("Agent %s: %s error (%s, attempt %d): %s", agent.ID, failure.Class, failure.Action, failure.Attempt, failure.Message)
+}
+
+// sleepAgent waits out a backoff, keeping the agent's heartbeat and holding
+// while it is paused. It reports false once the agent was stopped.
+func sleepAgent(agent *models.Agent, delay time.Duration) bool {
+	deadline := time.Now().Add(delay)
+	for {
+		if waitWhilePaused(agent) != nil || !agentHeartbeat(agent) {
+			return false
+		}
+		left := time.Until(deadline)
+		if left <= 0 {
+			return true
+		}
+		if left > backoffTick {
+			left = backoffTick
+		}
+		time.Sleep(left)
+	}
+}
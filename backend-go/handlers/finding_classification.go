@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"performa-backend/brain"
+	"performa-backend/config"
+	"performa-backend/escalation"
+	"performa-backend/models"
+)
+
+const maxEvidenceForClassification = 2000
+
+// classifyFinding asks the Brain to classify a finding and fills in the
+// severity, vulnerability type (category), confidence and CWE/OWASP tags the
+// caller left blank. The Brain's raw response is kept on the finding. While
+// the Brain is unavailable, a cached classification of the same finding is
+// used if there is one, flagged stale. Nothing happens when
+// auto-classification is disabled.
+func classifyFinding(finding *models.Finding) {
+	if !config.AppConfig.FindingAutoClassify || brainClient == nil {
+		return
+	}
+
+	needSeverity := finding.Severity == "" && finding.CVSSVector == ""
+	needType := finding.Category == ""
+	needConfidence := finding.Confidence == nil
+	if !needSeverity && !needType && !needConfidence {
+		return
+	}
+
+	evidence := finding.Evidence
+	if len(evidence) > maxEvidenceForClassification {
+		evidence = evidence[:maxEvidenceForClassification]
+	}
+	context := map[string]interface{}{
+		"title":    finding.Title,
+		"target":   finding.Target,
+		"evidence": evidence,
+	}
+	if finding.CWE != "" {
+		context["cwe_id"] = finding.CWE
+	}
+
+	req := &brain.ClassifyRequest{
+		Description:       strings.TrimSpace(finding.Title + "\n\n" + finding.Description),
+		Type:              finding.Category,
+		AdditionalContext: context,
+	}
+	var result *brain.ClassifyResponse
+	var raw json.RawMessage
+	if brainAvailable {
+		var err error
+		if result, raw, err = brainClient.ClassifyThreatRaw(req); err != nil {
+			brainFailed(err)
+			log.Printf("Finding classification failed for %q: %v", finding.Title, err)
+			return
+		}
+	} else {
+		var ok bool
+		if result, raw, ok = brain.CachedClassifyThreat(req); !ok {
+			return
+		}
+	}
+
+	applied := make([]string, 0)
+	severity := models.Severity(strings.ToLower(result.PredictedSeverity))
+	if needSeverity && models.SeverityRank[severity] > 0 {
+		finding.Severity = severity
+		applied = append(applied, "severity")
+	}
+	if needType && result.VulnerabilityType != "" {
+		finding.Category = result.VulnerabilityType
+		applied = append(applied, "vulnerability_type")
+	}
+	if needConfidence {
+		confidence := result.Confidence
+		finding.Confidence = &confidence
+		applied = append(applied, "confidence")
+	}
+	if finding.CWE == "" && result.CWE != "" && models.ValidateCWE(result.CWE) == nil {
+		finding.CWE = result.CWE
+		applied = append(applied, "cwe_id")
+	}
+	if finding.OWASP == "" && result.OWASPCategory != "" {
+		finding.OWASP = result.OWASPCategory
+		applied = append(applied, "owasp_category")
+	}
+
+	finding.Classification = &models.FindingClassification{
+		Source:       "brain",
+		Model:        result.ModelUsed,
+		Severity:     result.PredictedSeverity,
+		Type:         result.VulnerabilityType,
+		Confidence:   result.Confidence,
+		Applied:      applied,
+		Raw:          raw,
+		Stale:        result.Stale,
+		ClassifiedAt: time.Now(),
+	}
+}
+
+// recordFinding classifies and stores a finding, adds it to its operation's
+// timeline, applies the escalation policies and attaches the captured
+// traffic it mentions, then enriches the CVEs it references and generates
+// remediation advice for it if those apply.
+func recordFinding(finding models.Finding) *models.Finding {
+	if finding.WorkspaceID == "" {
+		finding.WorkspaceID = AgentWorkspace(finding.AgentID)
+	}
+	secrets := redactFindingCredentials(&finding)
+	classifyFinding(&finding)
+	stored := models.Findings.InsertFinding(finding)
+	vaultCredentials(stored.WorkspaceID, stored.AgentID, stored.ID, stored.Target, credentialSourceFinding, secrets)
+	recordFindingEvent(stored)
+	escalation.Evaluate(stored, "")
+	linkFindingCaptures(stored)
+	autoEnrichCVEs(stored)
+	autoRemediate(stored)
+	return stored
+}
+
+// recordAgentFinding stores a vulnerability an agent reported and counts it
+// towards the agent's findings.
+func recordAgentFinding(agent *models.Agent, title string) *models.Finding {
+	finding := recordFinding(models.Finding{
+		Title:   title,
+		Target:  agent.Target,
+		AgentID: agent.ID,
+	})
+	models.Manager.IncrementFindings(agent.ID)
+	recordFindingOutcome(agent, finding)
+	return finding
+}
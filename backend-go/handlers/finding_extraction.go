@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"performa-backend/config"
+	"performa-backend/cvss"
+	"performa-backend/models"
+	"performa-backend/openrouter"
+)
+
+const (
+	maxFindingsPerResponse   = 25
+	maxFindingTitleLength    = 300
+	maxFindingEvidenceLength = 8000
+	maxExtractionInput       = 12000
+)
+
+// findingsOutputPrompt asks agents to report vulnerabilities in a block the
+// response parser can turn into findings.
+const findingsOutputPrompt = `
+
+REPORTING FINDINGS:
+Whenever you confirm a vulnerability, report it in a fenced block tagged "findings" holding a JSON array, in addition to your normal explanation:
+` + "```findings" + `
+[{"title": "short name", "severity": "critical|high|medium|low|info", "description": "what is wrong and its impact", "target": "affected host, URL or service", "evidence": "tool output or request/response proving it", "category": "vulnerability type", "cwe_id": "CWE-79", "cvss_vector": "CVSS:3.1/AV:N/..."}]
+` + "```" + `
+Only title and severity are required. Report each vulnerability once; do not repeat findings you already reported.`
+
+const findingExtractionPrompt = `You extract security findings from a penetration tester's report.
+Respond with a single JSON array and nothing else. Each element has the form:
+{"title": "short name", "severity": "critical|high|medium|low|info", "description": "...", "target": "...", "evidence": "...", "category": "...", "cwe_id": "CWE-nnn"}
+Only include vulnerabilities the report states were confirmed or observed, not recommendations, plans or speculation. Respond with [] when there are none.`
+
+// findingsBlockPattern matches ```findings fenced blocks, and ```json blocks
+// that hold a findings array.
+var findingsBlockPattern = regexp.MustCompile("(?s)```(findings|json)\\s*\\n(.*?)```")
+
+// ReportedFinding is a finding as a model reports it, before validation.
+type ReportedFinding struct {
+	Title       string `json:"title"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+	Target      string `json:"target"`
+	Evidence    string `json:"evidence"`
+	Category    string `json:"category"`
+	CWE         string `json:"cwe_id"`
+	CVSSVector  string `json:"cvss_vector"`
+}
+
+// parseReportedFindings decodes a JSON array of findings, or an object with a
+// "findings" array.
+func parseReportedFindings(data string) ([]ReportedFinding, error) {
+	data = strings.TrimSpace(data)
+	var reported []ReportedFinding
+	if strings.HasPrefix(data, "{") {
+		var wrapped struct {
+			Findings []ReportedFinding `json:"findings"`
+		}
+		if err := json.Unmarshal([]byte(data), &wrapped); err != nil {
+			return nil, err
+		}
+		reported = wrapped.Findings
+	} else if err := json.Unmarshal([]byte(data), &reported); err != nil {
+		return nil, err
+	}
+	if len(reported) > maxFindingsPerResponse {
+		reported = reported[:maxFindingsPerResponse]
+	}
+	return reported, nil
+}
+
+// extractFindingsBlocks returns the findings in a response's structured
+// blocks and whether the response had any. Blocks that fail to parse are
+// logged and skipped.
+func extractFindingsBlocks(response string) ([]ReportedFinding, bool) {
+	var all []ReportedFinding
+	found := false
+	for _, match := range findingsBlockPattern.FindAllStringSubmatch(response, -1) {
+		if match[1] == "json" && !strings.Contains(match[2], `"title"`) {
+			continue
+		}
+		found = true
+		reported, err := parseReportedFindings(match[2])
+		if err != nil {
+			log.Printf("Finding extraction: invalid findings block: %v", err)
+			continue
+		}
+		all = append(all, reported...)
+	}
+	return all, found
+}
+
+// validateReportedFinding normalizes a reported finding into a Finding of
+// agentID, targeting target unless it names its own. Invalid CWE IDs and CVSS
+// vectors are dropped rather than rejecting the finding; a missing title or
+// unknown severity rejects it.
+func validateReportedFinding(reported ReportedFinding, agentID, target string) (models.Finding, error) {
+	title := strings.TrimSpace(reported.Title)
+	if title == "" {
+		return models.Finding{}, fmt.Errorf("title is required")
+	}
+	if len(title) > maxFindingTitleLength {
+		title = title[:maxFindingTitleLength]
+	}
+
+	severity := models.Severity(strings.ToLower(strings.TrimSpace(reported.Severity)))
+	if severity == "informational" {
+		severity = models.SeverityInfo
+	}
+	if severity != "" && models.SeverityRank[severity] == 0 {
+		return models.Finding{}, fmt.Errorf("unknown severity %q", reported.Severity)
+	}
+
+	finding := models.Finding{
+		Title:       title,
+		Severity:    severity,
+		Description: strings.TrimSpace(reported.Description),
+		Target:      strings.TrimSpace(reported.Target),
+		Evidence:    strings.TrimSpace(reported.Evidence),
+		Category:    strings.TrimSpace(reported.Category),
+		AgentID:     agentID,
+	}
+	if finding.Target == "" {
+		finding.Target = target
+	}
+	if len(finding.Evidence) > maxFindingEvidenceLength {
+		finding.Evidence = finding.Evidence[:maxFindingEvidenceLength]
+	}
+	if cwe := models.NormalizeCWE(reported.CWE); cwe != "" && models.ValidateCWE(cwe) == nil {
+		finding.CWE = cwe
+	}
+	if vector := strings.TrimSpace(reported.CVSSVector); vector != "" {
+		if _, err := cvss.Parse(vector); err == nil {
+			finding.CVSSVector = vector
+		}
+	}
+	return finding, nil
+}
+
+// agentReportedTitles returns the lower-cased titles of the agent's findings,
+// used to skip findings a model reports again.
+func agentReportedTitles(agentID string) map[string]bool {
+	findings, _ := models.Findings.Query(models.FindingFilter{AgentID: agentID})
+	titles := make(map[string]bool, len(findings))
+	for _, finding := range findings {
+		titles[strings.ToLower(finding.Title)] = true
+	}
+	return titles
+}
+
+// recordReportedFindings validates and stores reported findings for agent and
+// returns how many were created.
+func recordReportedFindings(agent *models.Agent, reported []ReportedFinding, source string) int {
+	if len(reported) == 0 {
+		return 0
+	}
+	seen := agentReportedTitles(agent.ID)
+	created := 0
+	for _, r := range reported {
+		finding, err := validateReportedFinding(r, agent.ID, agent.Target)
+		if err != nil {
+			log.Printf("Agent %s: %s finding rejected: %v", agent.ID, source, err)
+			continue
+		}
+		key := strings.ToLower(finding.Title)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		stored := recordFinding(finding)
+		models.Manager.IncrementFindings(agent.ID)
+		recordFindingOutcome(agent, stored)
+		created++
+	}
+	return created
+}
+
+// processAgentResponse turns the structured findings blocks of a model
+// response into findings.
+func processAgentResponse(agent *models.Agent, response string) int {
+	reported, _ := extractFindingsBlocks(response)
+	return recordReportedFindings(agent, reported, "structured")
+}
+
+// extractFindingsWithModel is the fallback for free-text reports: it asks the
+// agent's model to list the confirmed vulnerabilities in response as JSON.
+func extractFindingsWithModel(agent *models.Agent, req models.StartRequest, response string) int {
+	if !config.AppConfig.FindingLLMExtraction {
+		return 0
+	}
+	credentialID := req.Credentials["openrouter"]
+	if !openrouter.Configured(credentialID) || budgetExhausted(agent) {
+		return 0
+	}
+	if len(response) > maxExtractionInput {
+		response = response[:maxExtractionInput]
+	}
+
+	content, stats, err := openrouter.ChatMeteredWithCredential([]openrouter.Message{
+		{Role: "system", Content: findingExtractionPrompt},
+		{Role: "user", Content: fmt.Sprintf("Target: %s\n\nReport:\n%s", agent.Target, response)},
+	}, req.Model, credentialID)
+	chargeAgentCall(agent, stats)
+	if err != nil {
+		log.Printf("Agent %s: finding extraction failed: %v", agent.ID, err)
+		return 0
+	}
+
+	start, end := strings.Index(content, "["), strings.LastIndex(content, "]")
+	if start < 0 || end <= start {
+		return 0
+	}
+	reported, err := parseReportedFindings(content[start : end+1])
+	if err != nil {
+		log.Printf("Agent %s: finding extraction returned invalid JSON: %v", agent.ID, err)
+		return 0
+	}
+	return recordReportedFindings(agent, reported, "extracted")
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"io"
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/ingest"
+	"performa-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IngestRejection is a finding of an ingested report that failed validation.
+type IngestRejection struct {
+	Index  int    `json:"index"`
+	Title  string `json:"title"`
+	Reason string `json:"reason"`
+}
+
+// IngestReport says what an ingested report added. Duplicates are findings
+// the workspace already had from the same scanner, with the same title and
+// target ignoring case, or that the report lists twice.
+type IngestReport struct {
+	Format     string            `json:"format"`
+	Sources    []string          `json:"sources"`
+	Received   int               `json:"received"`
+	Created    int               `json:"created"`
+	Duplicates int               `json:"duplicates"`
+	FindingIDs []string          `json:"finding_ids"`
+	Rejected   []IngestRejection `json:"rejected"`
+	Errors     []ingest.Problem  `json:"errors"`
+}
+
+// IngestFindings stores the findings of an external scanner's report, sent
+// as the multipart field "file" or as the raw request body. ?format= is one
+// of nuclei, trivy or sarif and is detected when absent; findings that name
+// no target get ?target=.
+func IngestFindings(c *fiber.Ctx) error {
+	data := c.Body()
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Failed to read uploaded file").WithReason(err)
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Failed to read uploaded file").WithReason(err)
+		}
+	}
+
+	format := strings.ToLower(strings.TrimSpace(c.Query("format")))
+	if format == "" {
+		detected, err := ingest.Detect(data)
+		if err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Could not detect the report format").WithReason(err).
+				With("formats", ingest.Formats)
+		}
+		format = detected
+	} else if !ingest.Supported(format) {
+		return apierror.New(400, apierror.ValidationFailed, "Unknown report format").With("formats", ingest.Formats)
+	}
+	records, problems, err := ingest.Parse(format, data)
+	if err != nil {
+		return apierror.New(422, apierror.ValidationFailed, "Invalid report").WithReason(err)
+	}
+
+	workspace := currentWorkspace(c)
+	report := ingestRecords(records, workspace, strings.TrimSpace(c.Query("target")))
+	report.Format = format
+	if problems != nil {
+		report.Errors = problems
+	}
+
+	status := 200
+	if report.Created > 0 {
+		status = 201
+	}
+	return c.Status(status).JSON(report)
+}
+
+// ingestRecords validates and stores records as findings of workspace,
+// skipping the ones it already has.
+func ingestRecords(records []ingest.Record, workspace, target string) IngestReport {
+	report := IngestReport{
+		Sources:    []string{},
+		Received:   len(records),
+		FindingIDs: []string{},
+		Rejected:   []IngestRejection{},
+		Errors:     []ingest.Problem{},
+	}
+
+	existing, _ := models.Findings.Query(models.FindingFilter{WorkspaceID: workspace})
+	seen := make(map[string]bool, len(existing))
+	for _, finding := range existing {
+		if finding.Source != "" {
+			seen[ingestKey(finding.Source, finding.Title, finding.Target)] = true
+		}
+	}
+
+	sources := make(map[string]bool)
+	for i, record := range records {
+		if !sources[record.Source] {
+			sources[record.Source] = true
+			report.Sources = append(report.Sources, record.Source)
+		}
+
+		finding, err := validateReportedFinding(ReportedFinding{
+			Title:       record.Title,
+			Severity:    record.Severity,
+			Description: record.Description,
+			Target:      record.Target,
+			Evidence:    record.Evidence,
+			Category:    record.Category,
+			CWE:         record.CWE,
+			CVSSVector:  record.CVSSVector,
+		}, "", target)
+		if err != nil {
+			report.Rejected = append(report.Rejected, IngestRejection{Index: i, Title: record.Title, Reason: err.Error()})
+			continue
+		}
+
+		key := ingestKey(record.Source, finding.Title, finding.Target)
+		if seen[key] {
+			report.Duplicates++
+			continue
+		}
+		seen[key] = true
+
+		finding.Source = record.Source
+		finding.Remediation = strings.TrimSpace(record.Remediation)
+		finding.WorkspaceID = workspace
+		stored := recordFinding(finding)
+		report.FindingIDs = append(report.FindingIDs, stored.ID)
+		report.Created++
+	}
+	return report
+}
+
+func ingestKey(source, title, target string) string {
+	return strings.ToLower(source) + "\x00" + strings.ToLower(strings.TrimSpace(title)) + "\x00" + strings.ToLower(strings.TrimSpace(target))
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/openrouter"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxEvidenceForRemediation = 4000
+
+const remediationPrompt = `You are a security engineer writing remediation guidance for a penetration test finding.
+Respond with a single JSON object and nothing else, in this form:
+{"summary": "one or two sentences", "steps": ["concrete remediation step", ...], "references": ["https://...", ...]}
+Steps must be specific to the affected technology. References should be authoritative (vendor advisories, OWASP, CWE, NVD).`
+
+// RemediateRequest optionally overrides the model and credential used to
+// generate remediation advice.
+type RemediateRequest struct {
+	Model        string `json:"model"`
+	CredentialID string `json:"credential_id"`
+}
+
+// RemediateFinding asks the model for remediation steps and references for
+// a finding and stores them on it.
+func RemediateFinding(c *fiber.Ctx) error {
+	var req RemediateRequest
+	if len(c.Body()) > 0 {
+		if err := parseBody(c, &req); err != nil {
+			return err
+		}
+	}
+
+	finding := models.Findings.GetFinding(c.Params("id"))
+	if finding == nil {
+		return apierror.New(404, apierror.NotFound, "Finding not found")
+	}
+	if !openrouter.Configured(req.CredentialID) {
+		return apierror.New(503, apierror.ServiceUnavailable, "No model API key configured")
+	}
+
+	updated, err := remediateFinding(finding, req.Model, req.CredentialID)
+	if err != nil {
+		return providerError(502, "Remediation failed", err).WithReason(err)
+	}
+	return c.JSON(updated)
+}
+
+// remediateFinding generates remediation advice for finding with model (the
+// configured remediation model when empty) and stores it.
+func remediateFinding(finding *models.Finding, model, credentialID string) (*models.Finding, error) {
+	if model == "" {
+		model = config.AppConfig.RemediationModel
+	}
+
+	evidence := finding.Evidence
+	if len(evidence) > maxEvidenceForRemediation {
+		evidence = evidence[:maxEvidenceForRemediation]
+	}
+	var details strings.Builder
+	fmt.Fprintf(&details, "Title: %s\nSeverity: %s\nCategory: %s\nTarget: %s\n", finding.Title, finding.Severity, finding.Category, finding.Target)
+	if finding.CWE != "" {
+		fmt.Fprintf(&details, "CWE: %s\n", finding.CWE)
+	}
+	if finding.OWASP != "" {
+		fmt.Fprintf(&details, "OWASP: %s\n", finding.OWASP)
+	}
+	if finding.Description != "" {
+		fmt.Fprintf(&details, "\nDescription:\n%s\n", finding.Description)
+	}
+	if evidence != "" {
+		fmt.Fprintf(&details, "\nEvidence:\n%s\n", evidence)
+	}
+
+	content, _, err := openrouter.ChatMeteredWithCredential([]openrouter.Message{
+		{Role: "system", Content: remediationPrompt},
+		{Role: "user", Content: details.String()},
+	}, model, credentialID)
+	if err != nil {
+		return nil, err
+	}
+
+	remediation := parseRemediation(content)
+	remediation.Model = model
+	remediation.GeneratedAt = time.Now()
+
+	updated := models.Findings.UpdateFinding(finding.ID, func(f *models.Finding) {
+		f.Remediation = formatRemediation(remediation)
+		f.RemediationDetails = remediation
+	})
+	if updated == nil {
+		return nil, fmt.Errorf("finding was deleted")
+	}
+	ws.BroadcastMessage("finding_remediated", updated.ID)
+	return updated, nil
+}
+
+// parseRemediation reads the model's JSON answer. A response that is not
+// JSON is kept whole as the summary.
+func parseRemediation(content string) *models.FindingRemediation {
+	remediation := &models.FindingRemediation{}
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start >= 0 && end > start && json.Unmarshal([]byte(content[start:end+1]), remediation) == nil {
+		if remediation.Steps == nil {
+			remediation.Steps = []string{}
+		}
+		if remediation.References == nil {
+			remediation.References = []string{}
+		}
+		return remediation
+	}
+	return &models.FindingRemediation{
+		Summary:    strings.TrimSpace(content),
+		Steps:      []string{},
+		References: []string{},
+	}
+}
+
+// formatRemediation renders remediation advice as the text stored in the
+// finding's remediation column.
+func formatRemediation(remediation *models.FindingRemediation) string {
+	var text strings.Builder
+	text.WriteString(remediation.Summary)
+	if len(remediation.Steps) > 0 {
+		text.WriteString("\n\nSteps:\n")
+		for i, step := range remediation.Steps {
+			fmt.Fprintf(&text, "%d. %s\n", i+1, step)
+		}
+	}
+	if len(remediation.References) > 0 {
+		text.WriteString("\nReferences:\n")
+		for _, reference := range remediation.References {
+			fmt.Fprintf(&text, "- %s\n", reference)
+		}
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// autoRemediate generates remediation advice in the background for new
+// critical and high findings when FINDING_AUTO_REMEDIATE is enabled.
+func autoRemediate(finding *models.Finding) {
+	if !config.AppConfig.FindingAutoRemediate || finding.Remediation != "" || !openrouter.Configured("") {
+		return
+	}
+	if finding.Severity != models.SeverityCritical && finding.Severity != models.SeverityHigh {
+		return
+	}
+	go func() {
+		if _, err := remediateFinding(finding, "", ""); err != nil {
+			log.Printf("Finding remediation failed for %q: %v", finding.Title, err)
+		}
+	}()
+}
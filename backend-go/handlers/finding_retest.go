@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/storage"
+	"performa-backend/timeline"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxRetestOutput bounds the output kept on a retest record; the whole
+	// output goes to the retest's artifact.
+	maxRetestOutput = 4000
+	// maxRetestIndicators bounds the evidence lines compared with the
+	// retest's output.
+	maxRetestIndicators = 20
+	// minIndicatorLength keeps short evidence lines, which match almost any
+	// output, out of the comparison.
+	minIndicatorLength = 8
+)
+
+// RetestRequest optionally names the command to re-run. By default a retest
+// re-runs the command that produced the finding's evidence.
+type RetestRequest struct {
+	Command string `json:"command"`
+}
+
+// RetestFinding re-runs the check behind a finding against its target in a
+// single-agent task and compares the output with the stored evidence. The
+// finding is resolved when none of its evidence shows up anymore and
+// reopened when most of it still does; the output is kept as the retest's
+// artifact. The retest runs in the background: the response is the pending
+// retest record, completed later on the finding.
+func RetestFinding(c *fiber.Ctx) error {
+	var req RetestRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	finding := models.Findings.GetFinding(c.Params("id"))
+	if finding == nil {
+		return apierror.New(404, apierror.NotFound, "Finding not found")
+	}
+	if !config.AppConfig.ToolExecutionEnabled {
+		return apierror.New(503, apierror.ServiceUnavailable, "Tool execution is disabled; findings cannot be retested")
+	}
+	for _, retest := range finding.Retests {
+		if retest.Status == models.RetestRunning {
+			return apierror.New(409, apierror.Conflict, "A retest of this finding is already running").With("retest_id", retest.ID)
+		}
+	}
+
+	original := models.Manager.GetAgent(finding.AgentID)
+	command := strings.TrimSpace(req.Command)
+	if command == "" {
+		command = retestCommand(finding)
+	}
+	if command == "" {
+		return apierror.New(422, apierror.ValidationFailed, "No recorded command produced this finding").
+			WithReason("send the command to re-run as command")
+	}
+	if original != nil {
+		if err := CheckBlackout(original.ID); err != nil {
+			return err
+		}
+	}
+
+	agent, agentReq := createRetestAgent(finding, original)
+	retest := models.FindingRetest{
+		ID:             uuid.New().String(),
+		AgentID:        agent.ID,
+		Command:        command,
+		Status:         models.RetestRunning,
+		PreviousStatus: finding.Status,
+		StartedAt:      time.Now(),
+	}
+	if user := currentUser(c); user != nil {
+		retest.RequestedBy = user.Username
+	}
+	if models.Findings.UpdateFinding(finding.ID, func(f *models.Finding) {
+		f.Retests = append(append([]models.FindingRetest{}, f.Retests...), retest)
+	}) == nil {
+		return apierror.New(404, apierror.NotFound, "Finding not found")
+	}
+
+	go runFindingRetest(finding.ID, retest.ID, agent, agentReq, command)
+	return c.Status(202).JSON(retest)
+}
+
+// GetFindingRetests lists a finding's retests, the latest last.
+func GetFindingRetests(c *fiber.Ctx) error {
+	finding := models.Findings.GetFinding(c.Params("id"))
+	if finding == nil {
+		return apierror.New(404, apierror.NotFound, "Finding not found")
+	}
+	retests := finding.Retests
+	if retests == nil {
+		retests = []models.FindingRetest{}
+	}
+	return c.JSON(fiber.Map{
+		"retests": retests,
+		"total":   len(retests),
+	})
+}
+
+// retestCommand picks the command that produced the finding from the steps
+// of the agent that reported it: the latest run before the finding, of a
+// tool its evidence names when there is one.
+func retestCommand(finding *models.Finding) string {
+	evidence := strings.ToLower(finding.Evidence)
+	fallback := ""
+	steps := models.Manager.Steps(finding.AgentID)
+	for i := len(steps) - 1; i >= 0; i-- {
+		tools := steps[i].Tools
+		for j := len(tools) - 1; j >= 0; j-- {
+			run := tools[j]
+			if run.Status != models.StepToolRan || run.StartedAt == nil || run.StartedAt.After(finding.CreatedAt) {
+				continue
+			}
+			if run.Tool != "" && strings.Contains(evidence, strings.ToLower(run.Tool)) {
+				return run.Command
+			}
+			if fallback == "" {
+				fallback = run.Command
+			}
+		}
+	}
+	return fallback
+}
+
+// createRetestAgent creates the agent a retest runs as, in the operation and
+// with the config of the agent that reported the finding.
+func createRetestAgent(finding *models.Finding, original *models.Agent) (*models.Agent, models.StartRequest) {
+	target := finding.Target
+	var agentConfig models.AgentConfig
+	role, model := "Validator", ""
+	var req models.StartRequest
+	if original != nil {
+		agentConfig = original.Config
+		role, model = original.Role, original.Model
+		if target == "" {
+			target = original.Target
+		}
+		req = agentStartRequest(original)
+	}
+	req.Target = target
+
+	name := finding.ID
+	if len(name) > 8 {
+		name = name[:8]
+	}
+	agent := models.Manager.CreateAgentWithConfig("Retest-"+name, role, target, model, agentConfig)
+	if original != nil && original.OperationID != "" {
+		models.Manager.AssignOperation(agent.ID, original.OperationID)
+		models.Operations.AddAgent(original.OperationID, agent.ID)
+	}
+	agent = models.Manager.GetAgent(agent.ID)
+	req.Model = agent.Model
+	recordAgentEvent(agent, timeline.EventAgentCreated, timeline.ActorOperator,
+		fmt.Sprintf("%s created to retest finding %s", agent.Name, finding.ID),
+		map[string]interface{}{"role": agent.Role, "target": agent.Target, "finding_id": finding.ID})
+	return agent, req
+}
+
+// runFindingRetest runs the retest's command and records its outcome on the
+// finding.
+func runFindingRetest(findingID, retestID string, agent *models.Agent, req models.StartRequest, command string) {
+	defer recoverAgentPanic(agent, "retest")
+	finished := false
+	defer func() {
+		if !finished {
+			completeRetest(findingID, retestID, func(r *models.FindingRetest) {
+				r.Status = models.RetestInconclusive
+				r.Error = "retest did not finish"
+			})
+		}
+	}()
+
+	models.Manager.UpdateAgentStatus(agent.ID, models.AgentStatusRunning)
+	ws.BroadcastAgentUpdate(agent.ID, "started", "Retesting finding "+findingID)
+	models.Manager.UpdateAgentProgress(agent.ID, 10, "Re-running "+command)
+
+	output := executeAgentCommands(agent, req, 1, []string{command})
+	var run *models.StepToolRun
+	if steps := models.Manager.Steps(agent.ID); len(steps) > 0 && len(steps[len(steps)-1].Tools) > 0 {
+		run = &steps[len(steps)-1].Tools[0]
+	}
+
+	finding := models.Findings.GetFinding(findingID)
+	if finding == nil {
+		finished = true
+		finishRetestAgent(agent, "finding deleted")
+		return
+	}
+	indicators := retestIndicators(finding.Evidence, command)
+	matched := matchIndicators(indicators, output)
+	status, reason := retestOutcome(run, len(indicators), len(matched))
+
+	artifact := ""
+	if storage.Default != nil && output != "" {
+		key := attachmentPrefix(findingID) + "retest-" + retestID + ".txt"
+		if err := storage.Default.Put(key, []byte(output), "text/plain"); err == nil {
+			artifact = key
+		}
+	}
+
+	updated := completeRetest(findingID, retestID, func(r *models.FindingRetest) {
+		r.Status = status
+		r.Error = reason
+		r.Indicators = len(indicators)
+		r.Matched = matched
+		r.Output = output
+		if len(r.Output) > maxRetestOutput {
+			r.Output = r.Output[:maxRetestOutput] + "\n[output truncated]"
+		}
+		r.ArtifactKey = artifact
+	})
+	finished = true
+	if updated == nil {
+		finishRetestAgent(agent, "finding deleted")
+		return
+	}
+
+	summary := fmt.Sprintf("Retest of [%s] %s: %s", updated.Severity, updated.Title, status)
+	if reason != "" {
+		summary += " (" + reason + ")"
+	}
+	recordAgentEvent(agent, timeline.EventStatusChanged, timeline.ActorAgent, summary, map[string]interface{}{
+		"scope":      "finding",
+		"finding_id": findingID,
+		"retest_id":  retestID,
+		"status":     updated.Status,
+		"outcome":    status,
+		"indicators": len(indicators),
+		"matched":    len(matched),
+	})
+	ws.BroadcastMessage("finding_retested", findingID)
+	finishRetestAgent(agent, "")
+}
+
+// completeRetest applies fn to the finding's retest, ends it and moves the
+// finding to the retest's outcome.
+func completeRetest(findingID, retestID string, fn func(r *models.FindingRetest)) *models.Finding {
+	return models.Findings.UpdateFinding(findingID, func(f *models.Finding) {
+		retests := append([]models.FindingRetest{}, f.Retests...)
+		for i := range retests {
+			if retests[i].ID != retestID {
+				continue
+			}
+			fn(&retests[i])
+			now := time.Now()
+			retests[i].FinishedAt = &now
+			switch retests[i].Status {
+			case models.RetestResolved:
+				f.Status = "resolved"
+			case models.RetestReopened:
+				f.Status = "reopened"
+			}
+		}
+		f.Retests = retests
+	})
+}
+
+// finishRetestAgent marks the retest's agent complete, or failed with reason.
+func finishRetestAgent(agent *models.Agent, reason string) {
+	if current := models.Manager.GetAgent(agent.ID); current == nil || current.Status == models.AgentStatusStopped {
+		refreshOperationStatus(agent.OperationID)
+		return
+	}
+	status := models.AgentStatusComplete
+	if reason != "" {
+		status = models.AgentStatusError
+	}
+	models.Manager.UpdateAgentProgress(agent.ID, 100, "Retest complete")
+	models.Manager.UpdateAgentStatus(agent.ID, status)
+	ws.BroadcastAgentUpdate(agent.ID, string(status), reason)
+	recordAgentStatus(agent, timeline.ActorAgent, status, reason)
+	refreshOperationStatus(agent.OperationID)
+}
+
+// retestOutcome decides a retest from its run and how many of the evidence's
+// indicators its output still shows. A finding is only resolved by a run
+// that succeeded, so that an unreachable target does not pass for a fixed
+// one.
+func retestOutcome(run *models.StepToolRun, indicators, matched int) (string, string) {
+	switch {
+	case run == nil || run.Status != models.StepToolRan:
+		reason := "command not run"
+		if run != nil && run.Error != "" {
+			reason = run.Error
+		}
+		return models.RetestInconclusive, reason
+	case indicators == 0:
+		return models.RetestInconclusive, "the finding's evidence has nothing to compare the output with"
+	case matched*2 >= indicators:
+		return models.RetestReopened, ""
+	case matched == 0 && run.ExitCode == 0:
+		return models.RetestResolved, ""
+	case matched == 0 && run.Error != "":
+		return models.RetestInconclusive, run.Error
+	case matched == 0:
+		return models.RetestInconclusive, fmt.Sprintf("command exited with code %d", run.ExitCode)
+	}
+	return models.RetestInconclusive, fmt.Sprintf("%d of %d evidence lines still present", matched, indicators)
+}
+
+// retestIndicators are the distinct lines of evidence worth looking for in a
+// retest's output, lowercased. Lines echoing the command itself are left
+// out since every run repeats them.
+func retestIndicators(evidence, command string) []string {
+	command = strings.ToLower(command)
+	seen := make(map[string]bool)
+	var indicators []string
+	for _, line := range strings.Split(evidence, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if len(line) < minIndicatorLength || strings.HasPrefix(line, "```") || seen[line] {
+			continue
+		}
+		if strings.Contains(line, command) || strings.Contains(command, line) {
+			continue
+		}
+		seen[line] = true
+		indicators = append(indicators, line)
+		if len(indicators) == maxRetestIndicators {
+			break
+		}
+	}
+	return indicators
+}
+
+func matchIndicators(indicators []string, output string) []string {
+	output = strings.ToLower(output)
+	var matched []string
+	for _, indicator := range indicators {
+		if strings.Contains(output, indicator) {
+			matched = append(matched, indicator)
+		}
+	}
+	return matched
+}
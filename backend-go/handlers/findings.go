@@ -1,36 +1,121 @@
 package handlers
 
 import (
+        "fmt"
         "os"
         "path/filepath"
+
+        "performa-backend/apierror"
         "performa-backend/config"
+        "performa-backend/cvss"
+        "performa-backend/escalation"
         "performa-backend/models"
+        "performa-backend/repo"
         "strings"
         "time"
 
         "github.com/gofiber/fiber/v2"
 )
 
-func GetFindings(c *fiber.Ctx) error {
-        findings := models.Findings.GetAllFindings()
+const (
+        defaultFindingsLimit = 100
+        maxFindingsLimit     = 1000
+)
 
-        severitySummary := map[string]int{
-                "critical": 0,
-                "high":     0,
-                "medium":   0,
-                "low":      0,
-                "info":     0,
+func parseFindingFilter(c *fiber.Ctx) (models.FindingFilter, error) {
+        filter := models.FindingFilter{
+                WorkspaceID: currentWorkspace(c),
+                Category:    c.Query("category"),
+                Target:      c.Query("target"),
+                AgentID:     c.Query("agent_id"),
+                Status:      c.Query("status"),
+                Search:      c.Query("q", c.Query("search")),
+                SortBy:      c.Query("sort", "created_at"),
+                SortDesc:    strings.ToLower(c.Query("order", "desc")) != "asc",
+                Limit:       c.QueryInt("limit", defaultFindingsLimit),
+                Offset:      c.QueryInt("offset", 0),
         }
 
-        for _, f := range findings {
-                severitySummary[string(f.Severity)]++
+        if severity := c.Query("severity"); severity != "" {
+                for _, s := range strings.Split(severity, ",") {
+                        if s = strings.TrimSpace(strings.ToLower(s)); s != "" {
+                                filter.Severities = append(filter.Severities, models.Severity(s))
+                        }
+                }
         }
 
-        return c.JSON(fiber.Map{
+        for param, dest := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+                value := c.Query(param)
+                if value == "" {
+                        continue
+                }
+                t, err := parseTimeParam(value)
+                if err != nil {
+                        return filter, fmt.Errorf("invalid %s: expected RFC3339 or YYYY-MM-DD", param)
+                }
+                *dest = &t
+        }
+
+        return filter, NormalizeFindingFilter(&filter)
+}
+
+// NormalizeFindingFilter rejects unknown sort fields and clamps paging to the
+// limits GET /api/findings allows.
+func NormalizeFindingFilter(filter *models.FindingFilter) error {
+        if filter.SortBy == "" {
+                filter.SortBy = "created_at"
+        }
+        switch filter.SortBy {
+        case "created_at", "severity", "title":
+        default:
+                return fmt.Errorf("invalid sort: must be one of created_at, severity, title")
+        }
+
+        if filter.Limit <= 0 || filter.Limit > maxFindingsLimit {
+                filter.Limit = defaultFindingsLimit
+        }
+        if filter.Offset < 0 {
+                filter.Offset = 0
+        }
+
+        return nil
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+        if t, err := time.Parse(time.RFC3339, value); err == nil {
+                return t, nil
+        }
+        return time.Parse("2006-01-02", value)
+}
+
+func GetFindings(c *fiber.Ctx) error {
+        filter, err := parseFindingFilter(c)
+        if err != nil {
+                return apierror.New(400, apierror.ValidationFailed, err.Error())
+        }
+
+        findings, total, severitySummary, err := QueryFindings(filter)
+        if err != nil {
+                return apierror.New(500, apierror.Internal, "Failed to query findings").WithReason(err)
+        }
+        return c.JSON(findingsPage(findings, total, filter, severitySummary))
+}
+
+// QueryFindings returns one page of findings matching filter, the total number
+// of matches and their count per severity, from the finding repository.
+func QueryFindings(filter models.FindingFilter) ([]*models.Finding, int, map[string]int, error) {
+        return repo.Findings.Query(filter)
+}
+
+func findingsPage(findings []*models.Finding, total int, filter models.FindingFilter, summary map[string]int) fiber.Map {
+        return fiber.Map{
                 "findings":         findings,
-                "total":            len(findings),
-                "severity_summary": severitySummary,
-        })
+                "total":            total,
+                "limit":            filter.Limit,
+                "offset":           filter.Offset,
+                "has_more":         filter.Offset+len(findings) < total,
+                "severity_summary": summary,
+        }
 }
 
 func GetFindingsLogs(c *fiber.Ctx) error {
@@ -63,7 +148,7 @@ func GetFindingsLogs(c *fiber.Ctx) error {
 }
 
 func GetFindingsExplorer(c *fiber.Ctx) error {
-        findingsDir := config.AppConfig.FindingsDir
+        findingsDir := explorerDir(c)
         rootFiles := make([]map[string]interface{}, 0)
         folders := make([]map[string]interface{}, 0)
         totalFiles := 0
@@ -79,6 +164,9 @@ func GetFindingsExplorer(c *fiber.Ctx) error {
         }
 
         for _, file := range files {
+                if file.Name() == explorerTrashDir || file.Name() == models.WorkspacesDir {
+                        continue
+                }
                 info, _ := file.Info()
                 if file.IsDir() {
                         subFiles := make([]map[string]interface{}, 0)
@@ -128,9 +216,65 @@ func GetFinding(c *fiber.Ctx) error {
         finding := models.Findings.GetFinding(id)
 
         if finding == nil {
-                return c.Status(404).JSON(fiber.Map{
-                        "error": "Finding not found",
-                })
+                return apierror.New(404, apierror.NotFound, "Finding not found")
+        }
+
+        return c.JSON(finding)
+}
+
+// UpdateFinding changes a finding's severity, status, tags or assignee.
+// Raising the severity re-evaluates the escalation policies for the finding.
+func UpdateFinding(c *fiber.Ctx) error {
+        var req struct {
+                Severity *string  `json:"severity"`
+                Status   *string  `json:"status"`
+                Tags     []string `json:"tags"`
+                Assignee *string  `json:"assignee"`
+        }
+
+        if err := parseBody(c, &req); err != nil {
+                return err
+        }
+
+        existing := models.Findings.GetFinding(c.Params("id"))
+        if existing == nil {
+                return apierror.New(404, apierror.NotFound, "Finding not found")
+        }
+
+        var severity models.Severity
+        if req.Severity != nil {
+                severity = models.Severity(strings.ToLower(strings.TrimSpace(*req.Severity)))
+                if models.SeverityRank[severity] == 0 {
+                        return apierror.New(400, apierror.ValidationFailed, "Invalid severity").WithReason(fmt.Sprintf("unknown severity %q", *req.Severity))
+                }
+        }
+
+        previous := existing.Severity
+        finding := models.Findings.UpdateFinding(existing.ID, func(f *models.Finding) {
+                if severity != "" {
+                        f.Severity = severity
+                }
+                if req.Status != nil {
+                        f.Status = strings.TrimSpace(*req.Status)
+                }
+                if req.Tags != nil {
+                        f.Tags = make([]string, 0, len(req.Tags))
+                        for _, tag := range req.Tags {
+                                if tag = strings.TrimSpace(tag); tag != "" {
+                                        f.Tags = append(f.Tags, tag)
+                                }
+                        }
+                }
+                if req.Assignee != nil {
+                        f.Assignee = strings.TrimSpace(*req.Assignee)
+                }
+        })
+        if finding == nil {
+                return apierror.New(404, apierror.NotFound, "Finding not found")
+        }
+
+        if models.SeverityRank[finding.Severity] > models.SeverityRank[previous] {
+                escalation.Evaluate(finding, previous)
         }
 
         return c.JSON(finding)
@@ -138,30 +282,47 @@ func GetFinding(c *fiber.Ctx) error {
 
 func CreateFinding(c *fiber.Ctx) error {
         var req struct {
-                Title       string `json:"title"`
-                Description string `json:"description"`
-                Severity    string `json:"severity"`
-                Category    string `json:"category"`
-                Target      string `json:"target"`
-                Evidence    string `json:"evidence"`
-                AgentID     string `json:"agent_id"`
-        }
-
-        if err := c.BodyParser(&req); err != nil {
-                return c.Status(400).JSON(fiber.Map{
-                        "error": "Invalid request body",
-                })
+                Title         string `json:"title" validate:"required"`
+                Description   string `json:"description"`
+                Severity      string `json:"severity" validate:"omitempty,oneof=critical high medium low info"`
+                Category      string `json:"category"`
+                Target        string `json:"target"`
+                Evidence      string `json:"evidence"`
+                AgentID       string `json:"agent_id"`
+                CVSSVector    string `json:"cvss_vector"`
+                CWE           string `json:"cwe_id"`
+                OWASPCategory string `json:"owasp_category"`
         }
 
-        finding := models.Findings.AddFinding(
-                req.Title,
-                req.Description,
-                models.Severity(req.Severity),
-                req.Category,
-                req.Target,
-                req.Evidence,
-                req.AgentID,
-        )
+        if err := parseBody(c, &req); err != nil {
+                return err
+        }
+
+        if req.CVSSVector != "" {
+                if _, err := cvss.Parse(req.CVSSVector); err != nil {
+                        return apierror.New(400, apierror.ValidationFailed, "Invalid CVSS vector").WithReason(err)
+                }
+        }
+
+        if req.CWE != "" {
+                if err := models.ValidateCWE(req.CWE); err != nil {
+                        return apierror.New(400, apierror.ValidationFailed, "Invalid CWE ID").WithReason(err)
+                }
+        }
+
+        finding := recordFinding(models.Finding{
+                Title:       req.Title,
+                Description: req.Description,
+                Severity:    models.Severity(req.Severity),
+                Category:    req.Category,
+                Target:      req.Target,
+                Evidence:    req.Evidence,
+                AgentID:     req.AgentID,
+                CVSSVector:  req.CVSSVector,
+                CWE:         req.CWE,
+                OWASP:       req.OWASPCategory,
+                WorkspaceID: currentWorkspace(c),
+        })
 
         return c.Status(201).JSON(finding)
 }
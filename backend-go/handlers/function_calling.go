@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"performa-backend/models"
+	"performa-backend/openrouter"
+	"performa-backend/provider"
+	"performa-backend/ws"
+)
+
+// runCommandTool is the function an agent with native tools calls to run a
+// command, the counterpart of a "RUN:" line.
+const runCommandTool = "run_command"
+
+var agentToolSchemas = []provider.ToolSchema{{
+	Name:        runCommandTool,
+	Description: "Run a security tool command against the target. The command runs without a shell, so pipes and redirection are not available. Its output is returned before your next step.",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"command": map[string]interface{}{
+				"type":        "string",
+				"description": "The full command line, for example \"nmap -sV example.com\".",
+			},
+			"reason": map[string]interface{}{
+				"type":        "string",
+				"description": "Why the command is run.",
+			},
+		},
+		"required": []string{"command"},
+	},
+}}
+
+const nativeToolsPrompt = `
+You can also run a command by calling the ` + runCommandTool + ` function instead of writing a RUN line.`
+
+// chatWithTools runs one model turn offering the agent tools through function
+// calling. The calls the model makes are turned into "RUN:" lines appended to
+// its response, so the rest of the loop handles them like written ones and
+// the conversation history records them.
+func (conv *agentConversation) chatWithTools() (string, openrouter.CallStats, error) {
+	response, calls, stats, err := openrouter.ChatToolsMeteredWithSampling(conv.messages, conv.req.Model, conv.req.Credentials["openrouter"], agentToolSchemas, conv.sampling())
+	if err != nil {
+		return response, stats, err
+	}
+	response = appendToolCallCommands(response, calls)
+	if conv.stream {
+		models.Manager.PublishDelta(conv.agent.ID, response)
+		ws.BroadcastAgentChunk(conv.agent.ID, response)
+	}
+	return response, stats, nil
+}
+
+// appendToolCallCommands adds a "RUN:" line to response for each call of the
+// run_command function. Calls of other functions or without a command are
+// dropped.
+func appendToolCallCommands(response string, calls []provider.ToolCall) string {
+	lines := make([]string, 0, len(calls))
+	for _, call := range calls {
+		if call.Name != runCommandTool {
+			continue
+		}
+		command := strings.Join(strings.Fields(call.String("command")), " ")
+		if command == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("RUN: %s", command))
+	}
+	if len(lines) == 0 {
+		return response
+	}
+	if response = strings.TrimRight(response, "\n"); response != "" {
+		response += "\n\n"
+	}
+	return response + strings.Join(lines, "\n")
+}
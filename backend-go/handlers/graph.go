@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/assets"
+	"performa-backend/graph"
+	"performa-backend/models"
+	"performa-backend/timeline"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxGraphToolRuns bounds the tool runs read from the timeline for a graph,
+// as many as the in-memory timeline keeps.
+const maxGraphToolRuns = 5000
+
+// GetOperationGraph returns the operation as a graph of its agents, the
+// tools they ran, the assets those touched and the findings on them.
+// ?severity= takes a comma-separated list of severities and ?phase= the name
+// of a strategy phase.
+func GetOperationGraph(c *fiber.Ctx) error {
+	op := models.Operations.GetOperation(c.Params("id"))
+	if op == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+
+	var filter graph.Filter
+	if severity := c.Query("severity"); severity != "" {
+		for _, s := range strings.Split(severity, ",") {
+			s = strings.TrimSpace(strings.ToLower(s))
+			if s == "" {
+				continue
+			}
+			if models.SeverityRank[models.Severity(s)] == 0 {
+				return apierror.New(400, apierror.ValidationFailed, "invalid severity: must be one of critical, high, medium, low, info").With("severity", s)
+			}
+			filter.Severities = append(filter.Severities, s)
+		}
+	}
+	if phase := strings.TrimSpace(c.Query("phase")); phase != "" {
+		plan := models.Operations.GetPlan(op.ID)
+		if plan == nil {
+			return apierror.New(400, apierror.ValidationFailed, "Operation has no strategy plan to filter by phase")
+		}
+		names := make([]string, 0, len(plan.Phases))
+		for _, p := range plan.Phases {
+			names = append(names, p.Name)
+			if strings.EqualFold(p.Name, phase) {
+				filter.Phase = p.Name
+			}
+		}
+		if filter.Phase == "" {
+			return apierror.New(400, apierror.ValidationFailed, fmt.Sprintf("invalid phase: must be one of %s", strings.Join(names, ", "))).With("phase", phase)
+		}
+	}
+
+	return c.JSON(graph.Build(operationGraphInput(op), filter))
+}
+
+// operationGraphInput collects an operation's agents with their plans, the
+// tool runs on its timeline, the assets it observed and its findings.
+func operationGraphInput(op *models.Operation) graph.Input {
+	in := graph.Input{OperationID: op.ID, Target: op.Target, Status: string(op.Status)}
+
+	_, assignments := models.Operations.GetAssignments(op.ID)
+	for _, agent := range models.Manager.GetOperationAgents(op.ID) {
+		node := graph.Agent{
+			ID:      agent.ID,
+			Name:    agent.Name,
+			Role:    agent.Role,
+			Status:  string(agent.Status),
+			Targets: assignments[agent.ID],
+		}
+		if len(node.Targets) == 0 {
+			for _, target := range strings.Split(agent.Target, ",") {
+				node.Targets = append(node.Targets, strings.TrimSpace(target))
+			}
+		}
+		if plan := models.Operations.AgentPlan(op.ID, agent.ID); plan != nil {
+			for _, phase := range plan.Phases {
+				node.Phases = append(node.Phases, graph.Phase{Name: phase.Name, StartedAt: phase.StartedAt, CompletedAt: phase.CompletedAt})
+			}
+		}
+		in.Agents = append(in.Agents, node)
+
+		findings, _ := models.Findings.Query(models.FindingFilter{AgentID: agent.ID})
+		for _, finding := range findings {
+			in.Findings = append(in.Findings, graph.Finding{
+				ID:        finding.ID,
+				AgentID:   finding.AgentID,
+				Title:     finding.Title,
+				Severity:  string(finding.Severity),
+				Status:    finding.Status,
+				Target:    finding.Target,
+				CreatedAt: finding.CreatedAt,
+			})
+		}
+	}
+
+	events, _ := timeline.Default.Query(op.ID, timeline.Filter{Types: []string{timeline.EventToolExecuted}, Limit: maxGraphToolRuns})
+	for _, event := range events {
+		tool, _ := event.Data["tool"].(string)
+		if tool == "" || event.AgentID == "" {
+			continue
+		}
+		command, _ := event.Data["command"].(string)
+		errorText, _ := event.Data["error"].(string)
+		// Events read back from the database have their numbers as float64.
+		exitCode := 0
+		switch code := event.Data["exit_code"].(type) {
+		case int:
+			exitCode = code
+		case float64:
+			exitCode = int(code)
+		}
+		in.ToolRuns = append(in.ToolRuns, graph.ToolRun{
+			AgentID:  event.AgentID,
+			Tool:     tool,
+			Command:  command,
+			ExitCode: exitCode,
+			Failed:   exitCode != 0 || errorText != "",
+			At:       event.Timestamp,
+		})
+	}
+
+	observed, _ := assets.Default.Search(assets.Filter{WorkspaceID: op.WorkspaceID, OperationID: op.ID})
+	for _, asset := range observed {
+		node := graph.Asset{ID: asset.ID, Name: asset.Name, Kind: asset.Kind, Identifiers: asset.Identifiers()}
+		for _, service := range asset.Services {
+			node.Ports = append(node.Ports, service.Port)
+		}
+		in.Assets = append(in.Assets, node)
+	}
+	return in
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"performa-backend/config"
+	"performa-backend/database"
+	"performa-backend/openrouter"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Probes must answer within the default Kubernetes probe timeout, so slow
+// dependencies are checked with a deadline and remote ones are cached.
+const (
+	healthCheckTimeout = 2 * time.Second
+	brainHealthTTL     = 15 * time.Second
+	providerHealthTTL  = 5 * time.Minute
+)
+
+// Dependency states.
+const (
+	DependencyUp       = "up"
+	DependencyDown     = "down"
+	DependencyDisabled = "disabled"
+)
+
+var startedAt = time.Now()
+
+// DependencyStatus is the result of checking one dependency. Critical
+// dependencies make the backend unready when they are down; the others only
+// degrade it.
+type DependencyStatus struct {
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	Cached    bool      `json:"cached,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// cachedCheck remembers the last result of an expensive check for ttl, or
+// until the key it was computed for (e.g. the Brain URL) changes.
+type cachedCheck struct {
+	ttl    time.Duration
+	key    string
+	result DependencyStatus
+	mu     sync.Mutex
+}
+
+var (
+	brainHealthCache    = &cachedCheck{ttl: brainHealthTTL}
+	providerHealthCache = &cachedCheck{ttl: providerHealthTTL}
+)
+
+func (c *cachedCheck) get(key string, check func() DependencyStatus) DependencyStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.key == key && !c.result.CheckedAt.IsZero() && time.Since(c.result.CheckedAt) < c.ttl {
+		cached := c.result
+		cached.Cached = true
+		return cached
+	}
+	c.key = key
+	c.result = check()
+	return c.result
+}
+
+// timedCheck runs fn with a deadline and reports the outcome as a dependency
+// status. A nil error means the dependency is up.
+func timedCheck(critical bool, fn func(ctx context.Context) error) DependencyStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timed out after %s", healthCheckTimeout)
+	}
+
+	status := DependencyStatus{
+		Status:    DependencyUp,
+		Critical:  critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		status.Status = DependencyDown
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func checkDatabase() DependencyStatus {
+	if database.DB == nil {
+		return DependencyStatus{Status: DependencyDisabled, Critical: true, CheckedAt: time.Now()}
+	}
+	return timedCheck(true, func(ctx context.Context) error {
+		return database.DB.PingContext(ctx)
+	})
+}
+
+func checkBrain() DependencyStatus {
+	client := brainClient
+	if client == nil {
+		return DependencyStatus{Status: DependencyDown, Error: "brain client not initialized", CheckedAt: time.Now()}
+	}
+	return brainHealthCache.get(config.AppConfig.BrainServiceURL, func() DependencyStatus {
+		return timedCheck(false, func(ctx context.Context) error {
+			_, err := client.Health()
+			return err
+		})
+	})
+}
+
+// checkFindingsDir verifies that findings can be written by creating and
+// removing a probe file.
+func checkFindingsDir() DependencyStatus {
+	return timedCheck(true, func(ctx context.Context) error {
+		probe, err := os.CreateTemp(config.AppConfig.FindingsDir, ".health-*")
+		if err != nil {
+			return err
+		}
+		probe.Close()
+		return os.Remove(probe.Name())
+	})
+}
+
+// checkProvider validates the default OpenRouter key. Without a key agents
+// run on simulated responses, which is reported as disabled rather than down.
+func checkProvider() DependencyStatus {
+	if !openrouter.Configured("") {
+		return DependencyStatus{Status: DependencyDisabled, Error: openrouter.ErrNotConfigured.Error(), CheckedAt: time.Now()}
+	}
+	return providerHealthCache.get("default", func() DependencyStatus {
+		return timedCheck(false, func(ctx context.Context) error {
+			return openrouter.CheckKey(ctx, "")
+		})
+	})
+}
+
+// HealthLive is the liveness probe: it only reports that the process is
+// serving requests.
+func HealthLive(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":         "alive",
+		"service":        "backend-go",
+		"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+	})
+}
+
+// HealthReady is the readiness probe. It checks the database, the Brain
+// service, the findings directory and the provider key, and returns 503 when
+// a critical dependency is down. Non-critical failures report "degraded"
+// with 200 so a probe does not take the backend out of rotation for them.
+func HealthReady(c *fiber.Ctx) error {
+	checks := map[string]DependencyStatus{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range map[string]func() DependencyStatus{
+		"database":     checkDatabase,
+		"brain":        checkBrain,
+		"findings_dir": checkFindingsDir,
+		"openrouter":   checkProvider,
+	} {
+		wg.Add(1)
+		go func(name string, check func() DependencyStatus) {
+			defer wg.Done()
+			result := check()
+			mu.Lock()
+			checks[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	status := "ready"
+	code := fiber.StatusOK
+	for _, check := range checks {
+		if check.Status != DependencyDown {
+			continue
+		}
+		if check.Critical {
+			status = "not_ready"
+			code = fiber.StatusServiceUnavailable
+			break
+		}
+		status = "degraded"
+	}
+
+	return c.Status(code).JSON(fiber.Map{
+		"status":       status,
+		"service":      "backend-go",
+		"dependencies": checks,
+	})
+}
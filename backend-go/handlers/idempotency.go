@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/idempotency"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+)
+
+// InitIdempotency sets how long idempotency keys are remembered.
+func InitIdempotency() {
+	idempotency.Default.SetTTL(time.Duration(config.AppConfig.IdempotencyTTLHours) * time.Hour)
+}
+
+// Idempotent makes POST requests sent with an Idempotency-Key header safe to
+// retry: the first request with a key is carried out and its response
+// recorded, and later ones with the same key and body get that response back,
+// marked with Idempotent-Replayed. Keys are scoped to the workspace and user.
+// Server errors are not recorded, so a request that failed with one can be
+// retried under the same key.
+func Idempotent(c *fiber.Ctx) error {
+	key := strings.TrimSpace(c.Get(idempotencyKeyHeader))
+	if key == "" || c.Method() != fiber.MethodPost {
+		return c.Next()
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return apierror.New(400, apierror.ValidationFailed, "Idempotency-Key is too long").With("max_length", maxIdempotencyKeyLength)
+	}
+
+	scoped := currentWorkspace(c) + "\n" + currentUserID(c) + "\n" + key
+	recorded, err := idempotency.Default.Begin(scoped, idempotency.Hash(c.Method(), c.Path(), c.Body()))
+	switch {
+	case errors.Is(err, idempotency.ErrInFlight):
+		return apierror.New(409, apierror.Conflict, "A request with this Idempotency-Key is still in progress")
+	case errors.Is(err, idempotency.ErrMismatch):
+		return apierror.New(422, apierror.ValidationFailed, "Idempotency-Key was already used for a different request")
+	case recorded != nil:
+		c.Set(idempotencyReplayedHeader, "true")
+		c.Set(fiber.HeaderContentType, recorded.ContentType)
+		return c.Status(recorded.Status).Send(recorded.Body)
+	}
+
+	finished := false
+	defer func() {
+		if !finished {
+			idempotency.Default.Abandon(scoped)
+		}
+	}()
+
+	if err := c.Next(); err != nil {
+		if err := c.App().Config().ErrorHandler(c, err); err != nil {
+			return err
+		}
+	}
+	status := c.Response().StatusCode()
+	if status >= 500 {
+		return nil
+	}
+	idempotency.Default.Finish(scoped, &idempotency.Response{
+		Status:      status,
+		ContentType: string(c.Response().Header.ContentType()),
+		Body:        append([]byte(nil), c.Response().Body()...),
+	})
+	finished = true
+	return nil
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/credentials"
+	"performa-backend/integrations"
+	"performa-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IntegrationRequest creates or updates an integration. Token, when set, is
+// stored as a new credential of the integration's type and used instead of
+// CredentialID. On update, omitted fields are left unchanged.
+type IntegrationRequest struct {
+	Name         *string           `json:"name"`
+	Type         *string           `json:"type"`
+	BaseURL      *string           `json:"base_url"`
+	Project      *string           `json:"project"`
+	IssueType    *string           `json:"issue_type"`
+	Username     *string           `json:"username"`
+	CredentialID *string           `json:"credential_id"`
+	Token        string            `json:"token"`
+	PriorityMap  map[string]string `json:"priority_map"`
+	Labels       []string          `json:"labels"`
+	Enabled      *bool             `json:"enabled"`
+}
+
+func (req *IntegrationRequest) apply(integration *integrations.Integration) {
+	set := func(field *string, value *string) {
+		if value != nil {
+			*field = *value
+		}
+	}
+	set(&integration.Name, req.Name)
+	set(&integration.Type, req.Type)
+	set(&integration.BaseURL, req.BaseURL)
+	set(&integration.Project, req.Project)
+	set(&integration.IssueType, req.IssueType)
+	set(&integration.Username, req.Username)
+	set(&integration.CredentialID, req.CredentialID)
+	if req.PriorityMap != nil {
+		integration.PriorityMap = req.PriorityMap
+	}
+	if req.Labels != nil {
+		integration.Labels = req.Labels
+	}
+	if req.Enabled != nil {
+		integration.Enabled = *req.Enabled
+	}
+}
+
+// storeIntegrationToken saves req.Token as a credential for the integration
+// and points the integration at it.
+func storeIntegrationToken(req *IntegrationRequest, integration *integrations.Integration) error {
+	if req.Token == "" {
+		return nil
+	}
+	credential, err := credentials.Default.Create(integration.Name+" token", integration.Type, req.Token, false)
+	if err != nil {
+		return err
+	}
+	integration.CredentialID = credential.ID
+	return nil
+}
+
+// validateIntegrationCredential checks a selected credential belongs to the
+// integration's tracker.
+func validateIntegrationCredential(integration *integrations.Integration) error {
+	if integration.CredentialID == "" {
+		return nil
+	}
+	return validateCredentialSelection(map[string]string{integration.Type: integration.CredentialID})
+}
+
+func GetIntegrations(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"integrations":  integrations.Default.GetAll(),
+		"sync_interval": config.AppConfig.IntegrationSyncSeconds,
+	})
+}
+
+func GetIntegration(c *fiber.Ctx) error {
+	integration := integrations.Default.Get(c.Params("id"))
+	if integration == nil {
+		return apierror.New(404, apierror.NotFound, "Integration not found")
+	}
+	return c.JSON(integration)
+}
+
+func CreateIntegration(c *fiber.Ctx) error {
+	var req IntegrationRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	integration := integrations.Integration{Enabled: true}
+	req.apply(&integration)
+	if err := integration.Validate(); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid integration").WithReason(err)
+	}
+	if req.Token != "" && !credentials.Default.Enabled() {
+		return credentialsDisabled(c)
+	}
+	if err := validateIntegrationCredential(&integration); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid credential").WithReason(err)
+	}
+	if err := storeIntegrationToken(&req, &integration); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Failed to store token").WithReason(err)
+	}
+
+	created, err := integrations.Default.Create(integration)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid integration").WithReason(err)
+	}
+	return c.Status(201).JSON(created)
+}
+
+func UpdateIntegration(c *fiber.Ctx) error {
+	var req IntegrationRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if req.Token != "" && !credentials.Default.Enabled() {
+		return credentialsDisabled(c)
+	}
+
+	updated, err := integrations.Default.Update(c.Params("id"), func(integration *integrations.Integration) error {
+		req.apply(integration)
+		if err := validateIntegrationCredential(integration); err != nil {
+			return err
+		}
+		return storeIntegrationToken(&req, integration)
+	})
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid integration").WithReason(err)
+	}
+	if updated == nil {
+		return apierror.New(404, apierror.NotFound, "Integration not found")
+	}
+	return c.JSON(updated)
+}
+
+func DeleteIntegration(c *fiber.Ctx) error {
+	if !integrations.Default.Delete(c.Params("id")) {
+		return apierror.New(404, apierror.NotFound, "Integration not found")
+	}
+	return c.JSON(fiber.Map{
+		"message": "Integration deleted",
+	})
+}
+
+// PushResult reports the outcome of pushing one finding.
+type PushResult struct {
+	FindingID string               `json:"finding_id"`
+	Issue     *models.FindingIssue `json:"issue,omitempty"`
+	Created   bool                 `json:"created"`
+	Error     string               `json:"error,omitempty"`
+}
+
+// PushFindings files issues for the selected findings. Findings already
+// filed through the integration keep their existing issue.
+func PushFindings(c *fiber.Ctx) error {
+	integration := integrations.Default.Get(c.Params("id"))
+	if integration == nil {
+		return apierror.New(404, apierror.NotFound, "Integration not found")
+	}
+
+	var req struct {
+		FindingIDs []string `json:"finding_ids"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if len(req.FindingIDs) == 0 {
+		return apierror.New(400, apierror.ValidationFailed, "finding_ids is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	results := make([]PushResult, 0, len(req.FindingIDs))
+	pushed, failed := 0, 0
+	for _, id := range req.FindingIDs {
+		result := PushResult{FindingID: id}
+		finding := models.Findings.GetFinding(id)
+		if finding == nil {
+			result.Error = "finding not found"
+		} else {
+			issue, created, err := integrations.Push(ctx, integration, finding)
+			result.Issue, result.Created = issue, created
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}
+		if result.Error != "" {
+			failed++
+		} else if result.Created {
+			pushed++
+		}
+		results = append(results, result)
+	}
+
+	return c.JSON(fiber.Map{
+		"results": results,
+		"pushed":  pushed,
+		"failed":  failed,
+	})
+}
+
+// SyncIntegrations polls every enabled tracker for issue status now instead
+// of waiting for the next scheduled sync.
+func SyncIntegrations(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	changed := integrations.Sync(ctx)
+	return c.JSON(fiber.Map{
+		"changed":      changed,
+		"integrations": integrations.Default.GetAll(),
+	})
+}
+
+// InitIntegrations loads the configured integrations and starts polling
+// their trackers for issue status.
+func InitIntegrations() {
+	integrations.Default.Load()
+	if seconds := config.AppConfig.IntegrationSyncSeconds; seconds > 0 {
+		go integrations.StartSync(time.Duration(seconds) * time.Second)
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"performa-backend/apierror"
+	"performa-backend/brain"
+	"performa-backend/config"
+	"performa-backend/jobs"
+	"performa-backend/workspaces"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Job kinds.
+const (
+	jobKindBrainThink     = "brain_think"
+	jobKindBrainStrategy  = "brain_strategy"
+	jobKindSessionExport  = "session_export"
+	jobKindModelBenchmark = "model_benchmark"
+	jobKindReportSummary  = "report_summary"
+	jobKindAgentReplay    = "agent_replay"
+)
+
+// InitJobs registers the job kinds, resumes the jobs left unfinished by the
+// last run and starts the workers.
+func InitJobs() {
+	jobs.Default.Register(jobKindBrainThink, runBrainThinkJob)
+	jobs.Default.Register(jobKindBrainStrategy, runBrainStrategyJob)
+	jobs.Default.Register(jobKindSessionExport, runSessionExportJob)
+	jobs.Default.Register(jobKindModelBenchmark, runModelBenchmarkJob)
+	jobs.Default.Register(jobKindReportSummary, runReportSummaryJob)
+	jobs.Default.Register(jobKindAgentReplay, runAgentReplayJob)
+	jobs.Default.SetNotifier(func(job *jobs.Job) {
+		ws.BroadcastJob(job.WorkspaceID, job.ID, job.Status, job)
+	})
+	jobs.Default.Load()
+	jobs.Default.Start(config.AppConfig.JobWorkers)
+}
+
+func runBrainThinkJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	var req brain.ThinkRequest
+	if err := json.Unmarshal(job.Input, &req); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	if !brainReachable() {
+		return nil, errBrainUnavailable
+	}
+	result, err := brainClient.Think(&req)
+	if err != nil {
+		brainFailed(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+func runBrainStrategyJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	var req brain.StrategyRequest
+	if err := json.Unmarshal(job.Input, &req); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	if !brainReachable() {
+		if result, ok := brain.CachedStrategy(&req); ok {
+			return result, nil
+		}
+		return nil, errBrainUnavailable
+	}
+	result, err := brainClient.GenerateStrategy(&req)
+	if err != nil {
+		brainFailed(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// runSessionExportJob builds the export bundle of a session of the job's
+// workspace.
+func runSessionExportJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	var input struct {
+		SessionID string `json:"session_id"`
+	}
+	if err := json.Unmarshal(job.Input, &input); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	session := findSession(input.SessionID)
+	if session == nil || workspaces.Normalize(session.WorkspaceID) != job.WorkspaceID {
+		return nil, fmt.Errorf("session %s not found", input.SessionID)
+	}
+	return newBundle(bundleKindSession, session)
+}
+
+// submitJob queues a job for the request's workspace and answers 202 with
+// it.
+func submitJob(c *fiber.Ctx, kind string, input interface{}) error {
+	raw, err := json.Marshal(input)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid job input").WithReason(err)
+	}
+
+	actor := ""
+	if user := currentUser(c); user != nil {
+		actor = user.Username
+	}
+	job, err := jobs.Default.Submit(kind, currentWorkspace(c), actor, raw)
+	switch {
+	case errors.Is(err, jobs.ErrUnknownKind):
+		return apierror.New(400, apierror.ValidationFailed, "Unknown job kind").WithReason(kind).With("kinds", jobs.Default.Kinds())
+	case errors.Is(err, jobs.ErrQueueFull):
+		return apierror.New(503, apierror.ServiceUnavailable, "Job queue is full, retry later")
+	case err != nil:
+		return apierror.New(500, apierror.Internal, "Failed to submit job").WithReason(err)
+	}
+	return c.Status(202).JSON(fiber.Map{
+		"job_id": job.ID,
+		"job":    job,
+	})
+}
+
+// CreateJob submits a job of any registered kind.
+func CreateJob(c *fiber.Ctx) error {
+	var req struct {
+		Kind  string          `json:"kind"`
+		Input json.RawMessage `json:"input"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if req.Kind == "" {
+		return apierror.New(400, apierror.ValidationFailed, "kind is required").With("kinds", jobs.Default.Kinds())
+	}
+	if len(req.Input) == 0 {
+		req.Input = json.RawMessage("{}")
+	}
+	return submitJob(c, req.Kind, req.Input)
+}
+
+// GetJobs lists the jobs of the request's workspace, most recent first,
+// optionally filtered by ?kind and ?status.
+func GetJobs(c *fiber.Ctx) error {
+	list := jobs.Default.List(jobs.Filter{
+		WorkspaceID: currentWorkspace(c),
+		Kind:        c.Query("kind"),
+		Status:      c.Query("status"),
+	})
+	return c.JSON(fiber.Map{
+		"jobs":  list,
+		"total": len(list),
+		"kinds": jobs.Default.Kinds(),
+	})
+}
+
+// GetJob reports a job's status and, once it finished, its result or error.
+func GetJob(c *fiber.Ctx) error {
+	job := jobs.Default.Get(c.Params("id"))
+	if job == nil || !inWorkspace(c, job.WorkspaceID) {
+		return apierror.New(404, apierror.NotFound, "Job not found")
+	}
+	return c.JSON(job)
+}
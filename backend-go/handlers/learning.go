@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"performa-backend/apierror"
+	"performa-backend/brain"
+	"performa-backend/executor"
+	"performa-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// learningFeedback batches action/outcome pairs from the agent loop for the
+// Brain's learning endpoint.
+var learningFeedback *brain.FeedbackBatcher
+
+func agentAction(agent *models.Agent, actionType string) map[string]interface{} {
+	action := map[string]interface{}{
+		"type":         actionType,
+		"target":       agent.Target,
+		"agent_role":   agent.Role,
+		"operation_id": agent.OperationID,
+		"stealth_mode": agent.Config.StealthMode,
+	}
+	if plan := models.Operations.GetPlan(agent.OperationID); plan != nil {
+		action["strategy"] = plan.Strategy
+		action["mode"] = plan.Mode
+	}
+	return action
+}
+
+// recordToolOutcome reports whether a tool run by an agent succeeded.
+func recordToolOutcome(agent *models.Agent, tool string, result *executor.Result) {
+	if learningFeedback == nil {
+		return
+	}
+
+	action := agentAction(agent, "tool_run")
+	action["tool"] = tool
+	learningFeedback.Record(action, map[string]interface{}{
+		"success":      result.Error == "" && result.ExitCode == 0,
+		"exit_code":    result.ExitCode,
+		"duration_ms":  result.DurationMs,
+		"output_bytes": len(result.Stdout),
+	})
+}
+
+// recordFindingOutcome reports a finding produced by an agent.
+func recordFindingOutcome(agent *models.Agent, finding *models.Finding) {
+	if learningFeedback == nil {
+		return
+	}
+
+	action := agentAction(agent, "finding")
+	action["category"] = finding.Category
+	learningFeedback.Record(action, map[string]interface{}{
+		"success":    true,
+		"finding_id": finding.ID,
+		"severity":   string(finding.Severity),
+		"cwe_id":     finding.CWE,
+	})
+}
+
+func GetBrainLearning(c *fiber.Ctx) error {
+	if learningFeedback == nil {
+		return apierror.New(500, apierror.BrainUnavailable, "Brain client not initialized")
+	}
+	return c.JSON(learningFeedback.Stats())
+}
+
+func UpdateBrainLearning(c *fiber.Ctx) error {
+	if learningFeedback == nil {
+		return apierror.New(500, apierror.BrainUnavailable, "Brain client not initialized")
+	}
+
+	var req struct {
+		Enabled *bool `json:"enabled" validate:"required"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	learningFeedback.SetEnabled(*req.Enabled)
+	return c.JSON(learningFeedback.Stats())
+}
+
+func FlushBrainLearning(c *fiber.Ctx) error {
+	if err := checkBrainAvailable(c); err != nil {
+		return err
+	}
+	if learningFeedback == nil {
+		return apierror.New(500, apierror.BrainUnavailable, "Brain client not initialized")
+	}
+
+	learningFeedback.Flush()
+	return c.JSON(learningFeedback.Stats())
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+const (
+	defaultLogReadLimit = 64 * 1024
+	maxLogReadLimit     = 1024 * 1024
+	logTailBacklog      = 16 * 1024
+	logPollInterval     = 500 * time.Millisecond
+)
+
+var errLogNotFound = errors.New("log file not found")
+
+// resolveLogFile maps a log name to a regular file directly inside the log
+// directory. Names with path separators, parent references or hidden files
+// are rejected, as are symlinks pointing outside the directory.
+func resolveLogFile(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid log name %q", name)
+	}
+
+	dir, err := filepath.Abs(config.AppConfig.LogDir)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(dir, name))
+	if err != nil {
+		return "", errLogNotFound
+	}
+	if filepath.Dir(path) != dir {
+		return "", fmt.Errorf("invalid log name %q", name)
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", errLogNotFound
+	}
+	return path, nil
+}
+
+func logFileError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errLogNotFound) {
+		return apierror.New(404, apierror.NotFound, "Log file not found")
+	}
+	return apierror.New(400, apierror.ValidationFailed, "Invalid log name").WithReason(err)
+}
+
+// GetLogFiles lists the log files that can be read or tailed.
+func GetLogFiles(c *fiber.Ctx) error {
+	return GetFindingsLogs(c)
+}
+
+// ReadLogFile returns up to limit bytes of a log file starting at offset. A
+// negative offset counts back from the end of the file.
+func ReadLogFile(c *fiber.Ctx) error {
+	path, err := resolveLogFile(c.Params("name"))
+	if err != nil {
+		return logFileError(c, err)
+	}
+
+	limit := c.QueryInt("limit", defaultLogReadLimit)
+	if limit <= 0 || limit > maxLogReadLimit {
+		limit = defaultLogReadLimit
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return logFileError(c, errLogNotFound)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return logFileError(c, errLogNotFound)
+	}
+	size := info.Size()
+
+	offset := int64(c.QueryInt("offset", 0))
+	if offset < 0 {
+		offset = max(size+offset, 0)
+	}
+	if offset > size {
+		offset = size
+	}
+
+	buf := make([]byte, limit)
+	n, err := file.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return apierror.New(500, apierror.Internal, "Failed to read log file").WithReason(err)
+	}
+
+	next := offset + int64(n)
+	return c.JSON(fiber.Map{
+		"name":        c.Params("name"),
+		"offset":      offset,
+		"next_offset": next,
+		"size":        size,
+		"eof":         next >= size,
+		"content":     string(buf[:n]),
+	})
+}
+
+// logChunk is a piece of a followed log file. Truncated is set when the file
+// shrank and is being read again from the start.
+type logChunk struct {
+	Offset    int64  `json:"offset"`
+	Content   string `json:"content,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// followLog sends what is appended to the file at path from offset on until
+// emit or idle fails or stop is closed. idle, if set, is called on every poll
+// and lets the caller write keep-alives. A negative offset starts at the last
+// logTailBacklog bytes, from the first full line.
+func followLog(path string, offset int64, emit func(logChunk) error, idle func() error, stop <-chan struct{}) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if offset < 0 {
+		if info, err := file.Stat(); err == nil {
+			offset = startOfTail(file, info.Size())
+		} else {
+			offset = 0
+		}
+	}
+
+	buf := make([]byte, 32*1024)
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+
+	for {
+		info, err := file.Stat()
+		if err != nil {
+			return
+		}
+		if info.Size() < offset {
+			offset = 0
+			if emit(logChunk{Offset: 0, Truncated: true}) != nil {
+				return
+			}
+		}
+		for offset < info.Size() {
+			n, err := file.ReadAt(buf, offset)
+			if n > 0 {
+				if emit(logChunk{Offset: offset, Content: string(buf[:n])}) != nil {
+					return
+				}
+				offset += int64(n)
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		if idle != nil && idle() != nil {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startOfTail returns where to begin tailing a file of the given size: the
+// first line boundary within the last logTailBacklog bytes.
+func startOfTail(file *os.File, size int64) int64 {
+	if size <= logTailBacklog {
+		return 0
+	}
+	start := size - logTailBacklog
+	buf := make([]byte, logTailBacklog)
+	n, _ := file.ReadAt(buf, start)
+	if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+		return start + int64(i) + 1
+	}
+	return start
+}
+
+// TailLogFile streams a log file with follow semantics, over WebSocket when
+// the request is an upgrade and as server-sent events otherwise. ?offset=
+// resumes from a byte offset; by default the stream starts with the end of
+// the file.
+func TailLogFile(c *fiber.Ctx) error {
+	path, err := resolveLogFile(c.Params("name"))
+	if err != nil {
+		return logFileError(c, err)
+	}
+	offset := int64(c.QueryInt("offset", -1))
+
+	if websocket.IsWebSocketUpgrade(c) {
+		return websocket.New(func(conn *websocket.Conn) {
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+			followLog(path, offset, func(chunk logChunk) error {
+				return conn.WriteJSON(chunk)
+			}, nil, closed)
+		})(c)
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		lastWrite := time.Now()
+		emit := func(chunk logChunk) error {
+			data, _ := json.Marshal(chunk)
+			event := "log"
+			if chunk.Truncated {
+				event = "truncated"
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", chunk.Offset+int64(len(chunk.Content)), event, data)
+			lastWrite = time.Now()
+			return w.Flush()
+		}
+		idle := func() error {
+			if time.Since(lastWrite) < 15*time.Second {
+				return nil
+			}
+			fmt.Fprint(w, ": keep-alive\n\n")
+			lastWrite = time.Now()
+			return w.Flush()
+		}
+		followLog(path, offset, emit, idle, nil)
+	})
+	return nil
+}
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"errors"
+	"performa-backend/apierror"
+	"performa-backend/credentials"
 	"performa-backend/models"
 	"performa-backend/openrouter"
 	"time"
@@ -16,10 +19,8 @@ func GetModels(c *fiber.Ctx) error {
 
 func ModelChat(c *fiber.Ctx) error {
 	var req models.ChatRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	if req.Model == "" {
@@ -39,10 +40,7 @@ func ModelChat(c *fiber.Ctx) error {
 	latency := time.Since(start)
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error":   err.Error(),
-			"latency": latency.String(),
-		})
+		return providerError(500, err.Error(), err).With("latency", latency.String())
 	}
 
 	return c.JSON(fiber.Map{
@@ -52,27 +50,68 @@ func ModelChat(c *fiber.Ctx) error {
 	})
 }
 
+// TestModel checks that a model answers with the given key, stored
+// credential or configured default. A key that works can be saved as a named
+// credential with save_as.
 func TestModel(c *fiber.Ctx) error {
 	var req struct {
-		Provider string `json:"provider"`
-		Model    string `json:"model"`
-		APIKey   string `json:"api_key,omitempty"`
+		Provider     string `json:"provider"`
+		Model        string `json:"model"`
+		APIKey       string `json:"api_key,omitempty"`
+		CredentialID string `json:"credential_id,omitempty"`
+		SaveAs       string `json:"save_as,omitempty"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if req.Provider == "" {
+		req.Provider = "openrouter"
+	}
+	if req.Model == "" {
+		req.Model = "openai/gpt-4-turbo"
 	}
 
 	start := time.Now()
+	var err error
+	if req.Provider == "openrouter" {
+		messages := []openrouter.Message{{Role: "user", Content: "Reply with OK."}}
+		if req.APIKey != "" {
+			_, err = openrouter.ChatWithKey(messages, req.Model, req.APIKey)
+		} else {
+			_, _, err = openrouter.ChatMeteredWithCredential(messages, req.Model, req.CredentialID)
+		}
+	}
 	latency := time.Since(start)
 
-	return c.JSON(fiber.Map{
+	if err != nil {
+		return providerError(502, err.Error(), err).With("status", "error").With("provider", req.Provider).With("model", req.Model).With("latency", latency.String())
+	}
+
+	response := fiber.Map{
 		"status":   "success",
 		"message":  "Model is available",
 		"provider": req.Provider,
 		"model":    req.Model,
 		"latency":  latency.String(),
-	})
+	}
+
+	if req.SaveAs != "" && req.APIKey != "" {
+		credential, err := credentials.Default.Create(req.SaveAs, req.Provider, req.APIKey, false)
+		if err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Key works but could not be saved").WithReason(err)
+		}
+		response["credential"] = credential
+	}
+
+	return c.JSON(response)
+}
+
+// providerError reports a failed model provider call, as
+// PROVIDER_RATE_LIMITED when the provider throttled it.
+func providerError(status int, message string, err error) *apierror.Error {
+	if errors.Is(err, openrouter.ErrRateLimited) {
+		return apierror.New(429, apierror.ProviderRateLimited, message).WithReason(err)
+	}
+	return apierror.Status(status, message)
 }
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/stealth"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// buildRoute returns the stealth route requested by req, or nil when its
+// traffic should go out directly with system DNS. Per-request proxies override
+// STEALTH_PROXIES and a per-request DoH endpoint overrides DOH_ENDPOINT.
+func buildRoute(req models.StartRequest) (*stealth.Route, error) {
+	if !req.StealthMode {
+		return nil, nil
+	}
+	resolver, err := buildResolver(req)
+	if err != nil {
+		return nil, err
+	}
+	if !req.StealthOptions.ProxyChain && !req.StealthOptions.TorRouting {
+		if resolver == nil {
+			return nil, nil
+		}
+		return &stealth.Route{Resolver: resolver}, nil
+	}
+
+	var proxies []string
+	if req.StealthOptions.ProxyChain {
+		proxies = req.Proxies
+		if len(proxies) == 0 {
+			proxies = config.AppConfig.StealthProxies
+		}
+		if len(proxies) == 0 && !req.StealthOptions.TorRouting {
+			return nil, fmt.Errorf("proxy chaining requested but no proxies are configured")
+		}
+	}
+
+	torAddr := req.TorSOCKSAddr
+	if torAddr == "" {
+		torAddr = config.AppConfig.TorSOCKSAddr
+	}
+	route, err := stealth.NewRoute(proxies, req.StealthOptions.TorRouting, torAddr)
+	if err != nil {
+		return nil, err
+	}
+	route.Resolver = resolver
+	return route, nil
+}
+
+// buildResolver returns the DNS-over-HTTPS resolver requested by req, or nil
+// when it does not ask for one.
+func buildResolver(req models.StartRequest) (*stealth.Resolver, error) {
+	if !req.StealthOptions.DNSOverHTTPS {
+		return nil, nil
+	}
+	endpoint := req.DoHEndpoint
+	if endpoint == "" {
+		endpoint = config.AppConfig.DoHEndpoint
+	}
+	return stealth.DoHResolver(endpoint, config.AppConfig.DoHFallback)
+}
+
+// agentRoute returns the route registered for the agent's operation, rebuilding
+// it from the request when the operation is not known (e.g. after a resume).
+func agentRoute(agent *models.Agent, req models.StartRequest) (*stealth.Route, error) {
+	if route := stealth.RouteFor(agent.OperationID); route != nil {
+		return route, nil
+	}
+	return buildRoute(req)
+}
+
+// agentFingerprinter returns the agent session's fingerprinter, registering
+// a new one on first use, or nil when req does not ask for user-agent
+// rotation or header randomization.
+func agentFingerprinter(agent *models.Agent, req models.StartRequest) *stealth.Fingerprinter {
+	if !req.StealthMode || (!req.StealthOptions.UserAgentRot && !req.StealthOptions.HeaderRandom) {
+		return nil
+	}
+	if fingerprinter := stealth.FingerprinterFor(agent.ID); fingerprinter != nil {
+		return fingerprinter
+	}
+	rotateEvery := req.FingerprintRotation
+	if rotateEvery == 0 {
+		rotateEvery = config.AppConfig.FingerprintRotation
+	}
+	fingerprinter := stealth.NewFingerprinter(rotateEvery, req.StealthOptions.UserAgentRot, req.StealthOptions.HeaderRandom)
+	stealth.SetFingerprinter(agent.ID, fingerprinter)
+	return fingerprinter
+}
+
+// buildPacer returns the pacer enforcing req's rate limit and timing jitter,
+// or nil when its requests are unpaced. With timing jitter, the aggressiveness
+// level's timing profile schedules the requests; with traffic padding, an
+// unlimited pacer is still returned so the operation's noise is measured.
+func buildPacer(req models.StartRequest) *stealth.Pacer {
+	rps := 0
+	if req.RateLimitEnabled && req.RateLimitRps > 0 {
+		rps = req.RateLimitRps
+	}
+	jitter := req.StealthMode && req.StealthOptions.TimingJitter
+	padding := req.StealthMode && req.StealthOptions.TrafficPadding
+	if rps == 0 && !jitter && !padding {
+		return nil
+	}
+	pacer := stealth.NewPacer(rps, jitter)
+	if jitter {
+		if profile := stealth.TimingProfileFor(req.AggressiveLevel); profile != nil {
+			pacer.SetProfile(profile)
+		}
+	}
+	return pacer
+}
+
+// agentPacer returns the pacer shared by the agent's operation, registering a
+// new one when the operation has none yet (e.g. after a resume).
+func agentPacer(agent *models.Agent, req models.StartRequest) *stealth.Pacer {
+	if pacer := stealth.PacerFor(agent.OperationID); pacer != nil {
+		return pacer
+	}
+	pacer := buildPacer(req)
+	if pacer != nil && agent.OperationID != "" {
+		stealth.SetPacer(agent.OperationID, pacer)
+	}
+	return pacer
+}
+
+// buildPadder returns the padder interleaving decoy requests with the
+// operation's traffic, or nil when req does not ask for traffic padding.
+// Decoys follow the operation's route and pacer.
+func buildPadder(req models.StartRequest, route *stealth.Route, pacer *stealth.Pacer) *stealth.Padder {
+	if !req.StealthMode || !req.StealthOptions.TrafficPadding {
+		return nil
+	}
+	targets, err := operationTargets(req)
+	if err != nil {
+		log.Printf("Stealth: traffic padding disabled: %v", err)
+		return nil
+	}
+	client, err := route.Client(pacer, stealth.NewFingerprinter(0, true, true))
+	if err != nil {
+		log.Printf("Stealth: traffic padding disabled: %v", err)
+		return nil
+	}
+	ratio := req.PaddingRatio
+	if ratio <= 0 {
+		ratio = config.AppConfig.TrafficPaddingRatio
+	}
+	return stealth.NewPadder(ratio, targets, client)
+}
+
+// agentPadder returns the padder of the agent's operation, registering a new
+// one when the operation has none yet (e.g. after a resume).
+func agentPadder(agent *models.Agent, req models.StartRequest, route *stealth.Route, pacer *stealth.Pacer) *stealth.Padder {
+	if padder := stealth.PadderFor(agent.OperationID); padder != nil {
+		return padder
+	}
+	padder := buildPadder(req, route, pacer)
+	if padder != nil && agent.OperationID != "" {
+		stealth.SetPadder(agent.OperationID, padder)
+	}
+	return padder
+}
+
+// checkOperationRoute probes the route and records the exit IP on the operation.
+func checkOperationRoute(operationID string, route *stealth.Route) stealth.ConnectivityReport {
+	report := route.Check(config.AppConfig.ExitIPCheckURL)
+	models.Operations.SetNetwork(operationID, report)
+
+	if report.Error != "" {
+		ws.BroadcastWorkspaceMessage(operationWorkspace(operationID), "system", fmt.Sprintf("Operation %s: stealth route check failed: %s", operationID, report.Error))
+	} else {
+		ws.BroadcastWorkspaceMessage(operationWorkspace(operationID), "system", fmt.Sprintf("Operation %s: traffic exits via %s (%d hop(s))", operationID, report.ExitIP, report.Hops))
+	}
+	return report
+}
+
+type routeCheckRequest struct {
+	Proxies      []string `json:"proxies"`
+	TorRouting   bool     `json:"tor_routing"`
+	TorSOCKSAddr string   `json:"tor_socks_addr"`
+}
+
+// CheckStealthRoute tests a proxy/Tor configuration before it is used by an
+// operation. An empty body checks the direct route.
+func CheckStealthRoute(c *fiber.Ctx) error {
+	var req routeCheckRequest
+	if len(c.Body()) > 0 {
+		if err := parseBody(c, &req); err != nil {
+			return err
+		}
+	}
+
+	if req.TorSOCKSAddr == "" {
+		req.TorSOCKSAddr = config.AppConfig.TorSOCKSAddr
+	}
+	route, err := stealth.NewRoute(req.Proxies, req.TorRouting, req.TorSOCKSAddr)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid proxy configuration").WithReason(err)
+	}
+
+	return c.JSON(route.Check(config.AppConfig.ExitIPCheckURL))
+}
+
+// GetOperationNetwork re-runs the connectivity check for an operation's route.
+func GetOperationNetwork(c *fiber.Ctx) error {
+	id := c.Params("id")
+	op := models.Operations.GetOperation(id)
+	if op == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+
+	route := stealth.RouteFor(id)
+	if route == nil {
+		var err error
+		if route, err = buildRoute(op.Request); err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Invalid proxy configuration").WithReason(err)
+		}
+	}
+
+	return c.JSON(checkOperationRoute(id, route))
+}
+
+// GetAgentFingerprint returns the browser fingerprint the agent's HTTP
+// requests currently carry.
+func GetAgentFingerprint(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Manager.GetAgent(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Agent not found")
+	}
+	fingerprinter := stealth.FingerprinterFor(id)
+	if fingerprinter == nil {
+		return apierror.New(404, apierror.NotFound, "Agent has no fingerprint")
+	}
+	return c.JSON(fingerprinter.Stats())
+}
+
+// GetOperationNoise reports the traffic the operation sent: requests, share
+// of padding decoys and average gap between requests.
+func GetOperationNoise(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Operations.GetOperation(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+	return c.JSON(stealth.Noise(stealth.PacerFor(id), stealth.PadderFor(id)))
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/nuclei"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultTemplatesLimit = 100
+	maxTemplatesLimit     = 1000
+	// nucleiSyncTimeout bounds a clone of the templates repository.
+	nucleiSyncTimeout = 10 * time.Minute
+)
+
+// InitNuclei points the template store at NUCLEI_TEMPLATES_DIR and indexes
+// the templates already checked out there.
+func InitNuclei() {
+	nuclei.Default.Configure(config.AppConfig.NucleiTemplatesDir, config.AppConfig.NucleiTemplatesRepo)
+	go nuclei.Default.Load()
+}
+
+// nucleiTemplates returns the absolute paths of the templates req is pinned
+// to, if any.
+func nucleiTemplates(req models.StartRequest) []string {
+	if req.Nuclei == nil {
+		return nil
+	}
+	return nuclei.Default.Paths(*req.Nuclei)
+}
+
+// queryList splits a comma separated query parameter.
+func queryList(c *fiber.Ctx, key string) []string {
+	var values []string
+	for _, value := range strings.Split(c.Query(key), ",") {
+		if value = strings.TrimSpace(strings.ToLower(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// GetNucleiTemplates searches the indexed templates by ?q, ?tags and
+// ?severity, the latter two comma separated.
+func GetNucleiTemplates(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultTemplatesLimit)
+	if limit <= 0 || limit > maxTemplatesLimit {
+		limit = defaultTemplatesLimit
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	templates, total := nuclei.Default.Search(nuclei.Filter{
+		Query:      c.Query("q"),
+		Tags:       queryList(c, "tags"),
+		Severities: queryList(c, "severity"),
+		Limit:      limit,
+		Offset:     offset,
+	})
+	status := nuclei.Default.Status()
+	return c.JSON(fiber.Map{
+		"templates": templates,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+		"commit":    status.Commit,
+		"synced_at": status.SyncedAt,
+	})
+}
+
+// GetNucleiTemplate returns a template, by ID or by its path in ?path.
+func GetNucleiTemplate(c *fiber.Ctx) error {
+	key := c.Params("id")
+	if path := c.Query("path"); path != "" {
+		key = path
+	}
+	template := nuclei.Default.Get(key)
+	if template == nil {
+		return apierror.New(404, apierror.NotFound, "Template not found")
+	}
+	return c.JSON(template)
+}
+
+func GetNucleiStatus(c *fiber.Ctx) error {
+	return c.JSON(nuclei.Default.Status())
+}
+
+// SyncNucleiTemplates starts pulling the templates repository in the
+// background; GET /api/tools/nuclei/status reports its progress.
+func SyncNucleiTemplates(c *fiber.Ctx) error {
+	if nuclei.Default.Status().Syncing {
+		return apierror.New(409, apierror.Conflict, "A template sync is already running")
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), nucleiSyncTimeout)
+		defer cancel()
+		if err := nuclei.Default.Sync(ctx); err != nil {
+			log.Printf("Nuclei: template sync failed: %v", err)
+			return
+		}
+		status := nuclei.Default.Status()
+		log.Printf("Nuclei: synced %d templates at %s", status.Templates, status.Commit)
+	}()
+
+	return c.Status(202).JSON(fiber.Map{
+		"status":  "syncing",
+		"message": "Template sync started",
+	})
+}
+
+// PinNucleiTemplates previews the templates a selection pins an operation
+// to.
+func PinNucleiTemplates(c *fiber.Ctx) error {
+	var selection nuclei.Selection
+	if err := parseBody(c, &selection); err != nil {
+		return err
+	}
+	if selection.Empty() {
+		return apierror.New(400, apierror.ValidationFailed, "templates, tags or severities are required")
+	}
+
+	pinned, warning, err := nuclei.Default.Pin(selection)
+	if err != nil {
+		return apierror.New(422, apierror.ValidationFailed, "Invalid nuclei templates").WithReason(err)
+	}
+	response := fiber.Map{
+		"selection": pinned,
+		"total":     len(pinned.Templates),
+	}
+	if warning != "" {
+		response["warning"] = warning
+	}
+	return c.JSON(response)
+}
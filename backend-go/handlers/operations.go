@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/stealth"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetOperations lists the operations of the request's workspace; users other
+// than admins only see their own.
+func GetOperations(c *fiber.Ctx) error {
+	owner := ownerScope(c)
+	operations := make([]*models.Operation, 0)
+	for _, op := range models.Operations.GetAllOperations() {
+		if inWorkspace(c, op.WorkspaceID) && (owner == "" || op.OwnerID == owner) {
+			operations = append(operations, op)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"operations": operations,
+		"total":      len(operations),
+	})
+}
+
+func GetOperation(c *fiber.Ctx) error {
+	id := c.Params("id")
+	op := models.Operations.GetOperation(id)
+	if op == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+
+	response := fiber.Map{
+		"operation": op,
+		"agents":    models.Manager.GetOperationAgents(id),
+		"rate":      stealth.PacerFor(id).Stats(),
+		"progress":  operationProgress(op),
+	}
+	if len(op.Targets) > 0 {
+		response["targets"] = targetRollups(op)
+	}
+	if op.Request.Budget.Enabled() {
+		response["budget"] = budgetStatus(id, op.Request.Budget, op.BudgetState)
+	}
+	return c.JSON(response)
+}
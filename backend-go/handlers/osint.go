@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/assets"
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/osint"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// osintLookupTimeout bounds a lookup, including the waits for the
+	// providers' rate limits.
+	osintLookupTimeout = 2 * time.Minute
+	// maxOSINTHostsPerAgent bounds the IPs looked up for an agent's targets.
+	maxOSINTHostsPerAgent = 4
+	// maxOSINTLinkedHostnames is the most hostnames a report may give an IP
+	// for them to be linked to its asset; shared hosting and CDN addresses
+	// serve many unrelated sites, whose assets must not be merged.
+	maxOSINTLinkedHostnames = 5
+	// maxOSINTVulnsInPrompt bounds the CVEs listed to an agent per report.
+	maxOSINTVulnsInPrompt = 20
+)
+
+// InitOSINT configures the OSINT providers' fallback keys and rate limits.
+func InitOSINT() {
+	osint.Default.Configure(osint.Config{
+		ShodanKey:    config.AppConfig.ShodanAPIKey,
+		ShodanURL:    config.AppConfig.ShodanAPIURL,
+		ShodanRate:   config.AppConfig.ShodanRateLimit,
+		CensysID:     config.AppConfig.CensysAPIID,
+		CensysSecret: config.AppConfig.CensysAPISecret,
+		CensysURL:    config.AppConfig.CensysAPIURL,
+		CensysRate:   config.AppConfig.CensysRateLimit,
+		CacheTTL:     time.Duration(config.AppConfig.OSINTCacheMinutes) * time.Minute,
+	})
+}
+
+// recordOSINTAssets adds what OSINT reports say about an IP to a workspace's
+// inventory and returns its asset.
+func recordOSINTAssets(workspace, operationID string, reports []*osint.HostReport) *assets.Asset {
+	var asset *assets.Asset
+	for _, report := range reports {
+		observed := assets.Default.Observe(assets.Observation{WorkspaceID: workspace, Host: report.IP, OperationID: operationID})
+		if observed != nil {
+			asset = observed
+		}
+		if len(report.Hostnames) <= maxOSINTLinkedHostnames {
+			for _, hostname := range report.Hostnames {
+				if observed := assets.Default.Observe(assets.Observation{WorkspaceID: workspace, Host: hostname, IP: report.IP, OperationID: operationID}); observed != nil {
+					asset = observed
+				}
+			}
+		}
+		for _, service := range report.Services {
+			version := strings.TrimSpace(service.Product + " " + service.Version)
+			observed := assets.Default.Observe(assets.Observation{
+				WorkspaceID: workspace,
+				Host:        report.IP,
+				Port:        service.Port,
+				Protocol:    service.Protocol,
+				Service:     service.Name,
+				Version:     version,
+				Banner:      firstLine(service.Banner),
+				Technology:  service.Product,
+				OperationID: operationID,
+			})
+			if observed != nil {
+				asset = observed
+			}
+		}
+	}
+	return asset
+}
+
+// firstLine returns the first non-empty line of a banner.
+func firstLine(banner string) string {
+	for _, line := range strings.Split(banner, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// osintContextMessage looks the agent's targets up in the configured OSINT
+// providers when its operation asks for it, adding what they know to the
+// inventory, and returns it as a prompt, or "" when there is nothing.
+// Hostnames are looked up by the addresses they resolve to.
+func osintContextMessage(agent *models.Agent, req models.StartRequest) string {
+	if !req.OSINTLookup {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), osintLookupTimeout)
+	defer cancel()
+
+	var ips []string
+	names := make(map[string]string)
+	for _, target := range strings.Split(agent.Target, ",") {
+		host, isIP, ok := assets.NormalizeHost(target)
+		if !ok {
+			continue
+		}
+		if isIP {
+			ips = append(ips, host)
+			continue
+		}
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			log.Printf("Agent %s: OSINT lookup: cannot resolve %s: %v", agent.ID, host, err)
+			continue
+		}
+		for _, addr := range addrs {
+			if _, seen := names[addr]; !seen {
+				names[addr] = host
+				ips = append(ips, addr)
+			}
+		}
+	}
+	if len(ips) > maxOSINTHostsPerAgent {
+		ips = ips[:maxOSINTHostsPerAgent]
+	}
+
+	workspace := operationWorkspace(agent.OperationID)
+	var sections []string
+	for _, ip := range ips {
+		reports, errs, err := osint.Default.LookupHost(ctx, ip, osint.Options{Credentials: req.Credentials})
+		if err != nil {
+			log.Printf("Agent %s: OSINT lookup of %s failed: %v", agent.ID, ip, err)
+			continue
+		}
+		for provider, message := range errs {
+			log.Printf("Agent %s: OSINT lookup of %s in %s failed: %s", agent.ID, ip, provider, message)
+		}
+		recordOSINTAssets(workspace, agent.OperationID, reports)
+		for _, report := range reports {
+			sections = append(sections, formatOSINTReport(report, names[ip]))
+		}
+	}
+	if len(sections) == 0 {
+		return ""
+	}
+	return "Passive OSINT on your targets from internet-wide scan services. It may be outdated: confirm it before relying on it, and do not rescan what it already answers.\n\n" +
+		strings.Join(sections, "\n\n")
+}
+
+// formatOSINTReport writes a report for an agent's prompt.
+func formatOSINTReport(report *osint.HostReport, hostname string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s on %s", report.Provider, report.IP)
+	if hostname != "" {
+		fmt.Fprintf(&b, " (%s)", hostname)
+	}
+	if report.UpdatedAt != nil {
+		fmt.Fprintf(&b, ", last scanned %s", report.UpdatedAt.Format("2006-01-02"))
+	}
+	b.WriteString(":\n")
+
+	var about []string
+	for _, value := range []string{report.Org, report.ASN, report.Country, report.OS} {
+		if value != "" {
+			about = append(about, value)
+		}
+	}
+	if len(about) > 0 {
+		fmt.Fprintf(&b, "- %s\n", strings.Join(about, ", "))
+	}
+	if len(report.Hostnames) > 0 && len(report.Hostnames) <= maxOSINTLinkedHostnames {
+		fmt.Fprintf(&b, "- Hostnames: %s\n", strings.Join(report.Hostnames, ", "))
+	}
+	for _, service := range report.Services {
+		line := fmt.Sprintf("- %d/%s", service.Port, service.Protocol)
+		if service.Name != "" {
+			line += " " + service.Name
+		}
+		if product := strings.TrimSpace(service.Product + " " + service.Version); product != "" {
+			line += " " + product
+		}
+		fmt.Fprintln(&b, line)
+	}
+	if len(report.Vulns) > 0 {
+		vulns := report.Vulns
+		more := ""
+		if len(vulns) > maxOSINTVulnsInPrompt {
+			more = fmt.Sprintf(" and %d more", len(vulns)-maxOSINTVulnsInPrompt)
+			vulns = vulns[:maxOSINTVulnsInPrompt]
+		}
+		fmt.Fprintf(&b, "- Reported vulnerabilities (unverified): %s%s\n", strings.Join(vulns, ", "), more)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// GetOSINTProviders reports which OSINT providers have a key and how they
+// are rate limited.
+func GetOSINTProviders(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"providers": osint.Default.Status()})
+}
+
+// GetOSINTHost looks an IP up in the OSINT providers in ?providers=, every
+// configured one by default, and records the results in the workspace's
+// inventory. ?refresh=true skips the cache.
+func GetOSINTHost(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), osintLookupTimeout)
+	defer cancel()
+
+	ip := c.Params("ip")
+	reports, errs, err := osint.Default.LookupHost(ctx, ip, osint.Options{
+		Providers: queryList(c, "providers"),
+		Refresh:   c.QueryBool("refresh"),
+	})
+	switch {
+	case errors.Is(err, osint.ErrNoProviders):
+		return apierror.New(503, apierror.ServiceUnavailable, "No OSINT provider is configured").
+			With("message", "Store a shodan or censys credential, or set SHODAN_API_KEY or CENSYS_API_ID and CENSYS_API_SECRET")
+	case err != nil:
+		return apierror.New(400, apierror.ValidationFailed, "Invalid OSINT lookup").WithReason(err).With("ip", ip)
+	case len(reports) == 0 && len(errs) > 0:
+		return apierror.New(502, apierror.ProviderError, "OSINT lookup failed").With("errors", errs)
+	}
+
+	response := fiber.Map{
+		"ip":      ip,
+		"reports": reports,
+		"errors":  errs,
+	}
+	if reports == nil {
+		response["reports"] = []*osint.HostReport{}
+	}
+	if asset := recordOSINTAssets(currentWorkspace(c), "", reports); asset != nil {
+		response["asset"] = asset
+	}
+	return c.JSON(response)
+}
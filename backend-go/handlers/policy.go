@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/executor"
+	"performa-backend/models"
+	"performa-backend/policy"
+	"performa-backend/tools"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetCommandPolicy returns the global command policy and where it was
+// loaded from.
+func GetCommandPolicy(c *fiber.Ctx) error {
+	rules, source := policy.Default.Rules()
+	return c.JSON(fiber.Map{
+		"rules":  rules,
+		"source": source,
+	})
+}
+
+// UpdateCommandPolicy replaces the global command policy. The body is JSON
+// ({"rules": [...]}) or, with a YAML content type, a policy file.
+func UpdateCommandPolicy(c *fiber.Ctx) error {
+	var rules []policy.Rule
+	contentType := string(c.Request().Header.ContentType())
+	if strings.Contains(contentType, "yaml") {
+		parsed, err := policy.Parse(c.Body())
+		if err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Invalid policy").WithReason(err)
+		}
+		rules = parsed
+	} else {
+		var req struct {
+			Rules []policy.Rule `json:"rules"`
+		}
+		if err := parseBody(c, &req); err != nil {
+			return err
+		}
+		rules = req.Rules
+	}
+
+	saved, err := policy.Default.Replace(rules)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid policy").WithReason(err)
+	}
+	_, source := policy.Default.Rules()
+	return c.JSON(fiber.Map{
+		"rules":  saved,
+		"source": source,
+	})
+}
+
+// ValidateCommandRequest is a dry run of the checks an agent command goes
+// through. OperationID applies that operation's policy overrides and
+// capabilities; Rules adds overrides of its own, checked first.
+type ValidateCommandRequest struct {
+	Command     string        `json:"command"`
+	OperationID string        `json:"operation_id"`
+	Rules       []policy.Rule `json:"rules"`
+}
+
+// ValidateCommand explains whether a command would be allowed to run and,
+// if not, which rule or check blocked it.
+func ValidateCommand(c *fiber.Ctx) error {
+	var req ValidateCommandRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if strings.TrimSpace(req.Command) == "" {
+		return apierror.New(400, apierror.ValidationFailed, "command is required")
+	}
+	if _, err := policy.Compile(req.Rules); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid rules").WithReason(err)
+	}
+
+	overrides := req.Rules
+	var op *models.Operation
+	if req.OperationID != "" {
+		if op = models.Operations.GetOperation(req.OperationID); op == nil {
+			return apierror.New(404, apierror.NotFound, "Operation not found")
+		}
+		overrides = append(append([]policy.Rule{}, req.Rules...), op.Request.CommandPolicy...)
+	}
+
+	decision := policy.Default.Evaluate(req.Command, overrides)
+	response := fiber.Map{
+		"allowed":  decision.Allowed,
+		"decision": decision,
+	}
+
+	args, err := executor.ParseCommandLine(req.Command)
+	if err != nil {
+		response["allowed"] = false
+		response["parse_error"] = err.Error()
+	} else if op != nil {
+		if denial := tools.CheckCapabilities(args, op.Request.Capabilities.Enabled()); denial != nil {
+			response["allowed"] = false
+			response["capability_denied"] = denial
+		}
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/presets"
+	"performa-backend/repo"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type PresetRequest struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Config      presets.Settings `json:"config"`
+}
+
+type InstantiatePresetRequest struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+}
+
+func missionConfigFromPreset(name, target string, settings presets.Settings) MissionConfigRequest {
+	return MissionConfigRequest{
+		Name:              name,
+		Target:            target,
+		Category:          settings.Category,
+		CustomInstruction: settings.CustomInstruction,
+		StealthMode:       settings.StealthMode,
+		AggressiveLevel:   settings.AggressiveLevel,
+		ModelName:         settings.ModelName,
+		NumAgents:         settings.NumAgents,
+		ExecutionDuration: settings.ExecutionDuration,
+		RequestedTools:    append([]string(nil), settings.RequestedTools...),
+		AllowedToolsOnly:  settings.AllowedToolsOnly,
+		StealthOptions:    settings.StealthOptions,
+		Capabilities:      settings.Capabilities,
+	}
+}
+
+func GetPresets(c *fiber.Ctx) error {
+	all := presets.Default.GetAll()
+	return c.JSON(fiber.Map{
+		"presets": all,
+		"total":   len(all),
+	})
+}
+
+func GetPreset(c *fiber.Ctx) error {
+	preset := presets.Default.Get(c.Params("id"))
+	if preset == nil {
+		return apierror.New(404, apierror.NotFound, "Preset not found")
+	}
+	return c.JSON(preset)
+}
+
+// CreatePreset registers a custom preset. Its settings are validated like a
+// saved config so every preset can be instantiated.
+func CreatePreset(c *fiber.Ctx) error {
+	var req PresetRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if problems := validateMissionConfig(missionConfigFromPreset(req.Name, "", req.Config)); len(problems) > 0 {
+		return configValidationError(c, problems)
+	}
+
+	preset, err := presets.Default.Create(req.Name, req.Description, req.Config)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid preset").WithReason(err)
+	}
+	return c.Status(201).JSON(preset)
+}
+
+func DeletePreset(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if preset := presets.Default.Get(id); preset != nil && preset.BuiltIn {
+		return apierror.New(400, apierror.ValidationFailed, "Built-in presets cannot be deleted")
+	}
+
+	if !presets.Default.Delete(id) {
+		return apierror.New(404, apierror.NotFound, "Preset not found")
+	}
+	return c.JSON(fiber.Map{
+		"status":  "deleted",
+		"message": "Preset deleted successfully",
+	})
+}
+
+// InstantiatePreset creates a saved config from a preset, filling in the
+// name and target the preset leaves open.
+func InstantiatePreset(c *fiber.Ctx) error {
+	preset := presets.Default.Get(c.Params("id"))
+	if preset == nil {
+		return apierror.New(404, apierror.NotFound, "Preset not found")
+	}
+
+	var req InstantiatePresetRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = preset.Name
+	}
+	mission := missionConfigFromPreset(name, req.Target, preset.Settings)
+	if problems := validateMissionConfig(mission); len(problems) > 0 {
+		return configValidationError(c, problems)
+	}
+
+	now := time.Now()
+	config := &repo.Config{
+		ID:          uuid.New().String(),
+		OwnerID:     currentUserID(c),
+		WorkspaceID: currentWorkspace(c),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	applyMissionConfig(config, mission)
+	storeSavedConfig(config)
+
+	return c.Status(201).JSON(fiber.Map{
+		"status":    "saved",
+		"config_id": config.ID,
+		"preset_id": preset.ID,
+		"config":    config,
+	})
+}
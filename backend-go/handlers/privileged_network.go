@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/netpriv"
+	"performa-backend/timeline"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultNetworkAuditLimit = 100
+
+// InitPrivilegedNetwork configures MAC, ARP and DNS spoofing and undoes what
+// a previous run left changed. While enabled, an interrupt or termination
+// stops every spoofing session and restores every changed address before the
+// process exits.
+func InitPrivilegedNetwork() {
+	cfg := config.AppConfig
+	netpriv.Default.Configure(netpriv.Config{
+		Enabled:              cfg.PrivilegedNetworkEnabled,
+		TestInterface:        cfg.NetworkTestInterface,
+		ManagementInterfaces: cfg.NetworkManagementInterfaces,
+		StateFile:            cfg.NetworkStateFile,
+		SessionDuration:      time.Duration(cfg.SpoofSessionSeconds) * time.Second,
+		MaxSessionDuration:   time.Duration(cfg.SpoofMaxSessionSeconds) * time.Second,
+		ReportInterval:       time.Duration(cfg.SpoofReportSeconds) * time.Second,
+	})
+	netpriv.Default.SetNotify(reportSpoofing)
+	for _, err := range netpriv.Default.Recover() {
+		log.Printf("Warning: Network: %v", err)
+	}
+	if !cfg.PrivilegedNetworkEnabled {
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Network: %s received, restoring spoofed interfaces", sig)
+		netpriv.Default.StopAllSpoofing("system:shutdown")
+		for _, err := range netpriv.Default.RestoreAll("system:shutdown") {
+			log.Printf("Warning: Network: %v", err)
+		}
+		os.Exit(1)
+	}()
+}
+
+// networkActor names the admin making a privileged network change.
+func networkActor(c *fiber.Ctx) string {
+	if user := currentUser(c); user != nil {
+		return user.Username
+	}
+	if hasAdminToken(c) {
+		return "admin-token"
+	}
+	return "anonymous"
+}
+
+func wantsMacSpoofing(req models.StartRequest) bool {
+	return req.StealthMode && req.StealthOptions.MacSpoofing
+}
+
+// checkMacSpoofing rejects an operation asking for MAC spoofing unless the
+// caller is an admin.
+func checkMacSpoofing(c *fiber.Ctx, req models.StartRequest) error {
+	if !wantsMacSpoofing(req) {
+		return nil
+	}
+	return checkAdmin(c)
+}
+
+// spoofOperationMAC gives the test interface a random MAC address for the
+// operation's lifetime. A failure is reported as an operation warning.
+func spoofOperationMAC(op *models.Operation) {
+	spoof, err := netpriv.Default.SpoofMAC("", "", op.ID, "operation:"+op.ID)
+	if err != nil {
+		warning := fmt.Sprintf("MAC spoofing failed, traffic uses the interface's own address: %v", err)
+		models.Operations.AddWarning(op.ID, warning)
+		ws.BroadcastWorkspaceMessage(op.WorkspaceID, "system", warning)
+		return
+	}
+	recordNetworkEvent(op.ID, fmt.Sprintf("MAC address of %s spoofed to %s", spoof.Interface, spoof.MAC), spoof)
+}
+
+// restoreOperationNetwork stops the spoofing sessions of an operation that is
+// no longer running and puts back the addresses changed for it.
+func restoreOperationNetwork(operationID string) {
+	netpriv.Default.StopOperationSpoofing(operationID, "operation:"+operationID)
+	for _, err := range netpriv.Default.RestoreOperation(operationID, "operation:"+operationID) {
+		log.Printf("Warning: Network: operation %s: %v", operationID, err)
+		ws.BroadcastWorkspaceMessage(operationWorkspace(operationID), "system", fmt.Sprintf("Operation %s: failed to restore MAC address: %v", operationID, err))
+	}
+}
+
+func recordNetworkEvent(operationID, summary string, spoof *netpriv.Spoof) {
+	timeline.Record(timeline.Event{
+		OperationID: operationID,
+		Type:        timeline.EventStatusChanged,
+		Summary:     summary,
+		Data: map[string]interface{}{
+			"scope":     "network",
+			"interface": spoof.Interface,
+			"mac":       spoof.MAC,
+		},
+	})
+}
+
+// GetNetworkInterfaces lists the host's interfaces, marking the management
+// interfaces that are never changed and the test interface that may be.
+func GetNetworkInterfaces(c *fiber.Ctx) error {
+	interfaces, err := netpriv.Default.Interfaces()
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to list network interfaces").WithReason(err)
+	}
+	return c.JSON(fiber.Map{
+		"enabled":    netpriv.Default.Enabled(),
+		"interfaces": interfaces,
+		"spoofs":     netpriv.Default.Spoofs(),
+	})
+}
+
+type spoofMACRequest struct {
+	MAC string `json:"mac" validate:"omitempty,mac"`
+}
+
+// SpoofInterfaceMAC changes the MAC address of the test interface, to a
+// random one when the body names none. It stays until restored.
+func SpoofInterfaceMAC(c *fiber.Ctx) error {
+	var req spoofMACRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	spoof, err := netpriv.Default.SpoofMAC(c.Params("name"), req.MAC, "", networkActor(c))
+	if err != nil {
+		return networkError(err)
+	}
+	return c.JSON(spoof)
+}
+
+// RestoreInterfaceMAC puts back the original MAC address of an interface.
+func RestoreInterfaceMAC(c *fiber.Ctx) error {
+	restored, err := netpriv.Default.RestoreMAC(c.Params("name"), networkActor(c))
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to restore MAC address").WithReason(err)
+	}
+	if !restored {
+		return apierror.New(404, apierror.NotFound, "Interface is not spoofed")
+	}
+	return c.JSON(fiber.Map{"message": "MAC address restored"})
+}
+
+// GetNetworkAudit lists the privileged network actions, newest first.
+func GetNetworkAudit(c *fiber.Ctx) error {
+	entries := netpriv.Default.Audit(c.QueryInt("limit", defaultNetworkAuditLimit))
+	return c.JSON(fiber.Map{"entries": entries, "total": len(entries)})
+}
+
+func networkError(err error) error {
+	switch {
+	case errors.Is(err, netpriv.ErrDisabled), errors.Is(err, netpriv.ErrUnsupported):
+		return apierror.New(503, apierror.ServiceUnavailable, "Privileged network actions unavailable").WithReason(err)
+	case errors.Is(err, netpriv.ErrManagementInterface), errors.Is(err, netpriv.ErrNotTestInterface):
+		return apierror.New(403, apierror.Forbidden, "Interface may not be changed").WithReason(err)
+	case errors.Is(err, netpriv.ErrNoTestInterface):
+		return apierror.New(400, apierror.ValidationFailed, "No test interface designated").WithReason(err)
+	}
+	return apierror.New(500, apierror.Internal, "Failed to change MAC address").WithReason(err)
+}
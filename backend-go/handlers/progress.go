@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"math"
+	"time"
+
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/ws"
+)
+
+// ETA sources, from the most to the least informed.
+const (
+	etaSourcePlan     = "plan"
+	etaSourceRate     = "rate"
+	etaSourceDeadline = "deadline"
+)
+
+// runningPhaseShare is how much of a running phase without an estimate counts
+// as done, and the most a running phase with one counts before it completes.
+const (
+	runningPhaseShare    = 0.5
+	runningPhaseMaxShare = 0.95
+)
+
+// ProgressCount is a count of done out of planned work.
+type ProgressCount struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// TimeProgress is an operation's running time against its execution
+// duration.
+type TimeProgress struct {
+	ElapsedSeconds  int     `json:"elapsed_seconds"`
+	DurationSeconds int     `json:"duration_seconds"`
+	Fraction        float64 `json:"fraction"`
+}
+
+// AgentProgress is one agent's share of an operation's progress.
+type AgentProgress struct {
+	AgentID  string             `json:"agent_id"`
+	Status   models.AgentStatus `json:"status"`
+	Percent  int                `json:"percent"`
+	Phase    string             `json:"phase,omitempty"`
+	Phases   ProgressCount      `json:"phases"`
+	ToolRuns ProgressCount      `json:"tool_runs"`
+
+	fraction  float64
+	remaining float64
+	estimated bool
+}
+
+// OperationProgress rolls an operation's agents up into one percentage with
+// an estimated completion time. Percent never falls behind the share of the
+// execution duration already spent, since the operation ends with it.
+type OperationProgress struct {
+	OperationID string                 `json:"operation_id"`
+	Status      models.OperationStatus `json:"status"`
+	Percent     int                    `json:"percent"`
+	Phases      ProgressCount          `json:"phases"`
+	ToolRuns    ProgressCount          `json:"tool_runs"`
+	Time        *TimeProgress          `json:"time,omitempty"`
+	Agents      []AgentProgress        `json:"agents"`
+	ETA         *time.Time             `json:"eta,omitempty"`
+	ETASeconds  *int                   `json:"eta_seconds,omitempty"`
+	ETASource   string                 `json:"eta_source,omitempty"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// operationProgress computes an operation's progress from its agents' plan
+// phases, their tool runs against the tools their phases plan, and its
+// elapsed time against its execution duration.
+func operationProgress(op *models.Operation) OperationProgress {
+	now := time.Now()
+	progress := OperationProgress{
+		OperationID: op.ID,
+		Status:      op.Status,
+		Agents:      make([]AgentProgress, 0),
+		UpdatedAt:   now,
+	}
+
+	work := 0.0
+	planned, remaining := false, 0.0
+	for _, agent := range models.Manager.GetOperationAgents(op.ID) {
+		agentProgress := newAgentProgress(agent, models.Operations.AgentPlan(op.ID, agent.ID), now)
+		progress.Agents = append(progress.Agents, agentProgress)
+		progress.Phases.Done += agentProgress.Phases.Done
+		progress.Phases.Total += agentProgress.Phases.Total
+		progress.ToolRuns.Done += agentProgress.ToolRuns.Done
+		progress.ToolRuns.Total += agentProgress.ToolRuns.Total
+		work += agentProgress.fraction
+		// Agents run side by side: the slowest one finishes the operation.
+		if agentProgress.estimated {
+			planned = true
+			remaining = math.Max(remaining, agentProgress.remaining)
+		}
+	}
+	if len(progress.Agents) > 0 {
+		work /= float64(len(progress.Agents))
+	}
+
+	elapsed := now.Sub(op.CreatedAt).Seconds()
+	if op.CompletedAt != nil {
+		elapsed = op.CompletedAt.Sub(op.CreatedAt).Seconds()
+	}
+	var deadline time.Time
+	if duration := op.Request.ExecutionDuration; duration != nil && *duration > 0 {
+		seconds := *duration * 60
+		progress.Time = &TimeProgress{
+			ElapsedSeconds:  int(elapsed),
+			DurationSeconds: seconds,
+			Fraction:        math.Min(elapsed/float64(seconds), 1),
+		}
+		deadline = op.CreatedAt.Add(time.Duration(seconds) * time.Second)
+		work = math.Max(work, progress.Time.Fraction)
+	}
+
+	if op.Status == models.OperationStatusComplete {
+		work = 1
+	}
+	progress.Percent = int(math.Round(work * 100))
+	if op.Status != models.OperationStatusRunning {
+		return progress
+	}
+
+	switch {
+	case planned:
+		progress.ETASource = etaSourcePlan
+	case work > 0:
+		progress.ETASource = etaSourceRate
+		remaining = elapsed * (1 - work) / work
+	default:
+		if deadline.IsZero() {
+			return progress
+		}
+		progress.ETASource = etaSourceDeadline
+		remaining = deadline.Sub(now).Seconds()
+	}
+	eta := now.Add(time.Duration(remaining * float64(time.Second)))
+	if !deadline.IsZero() && eta.After(deadline) {
+		eta = deadline
+		progress.ETASource = etaSourceDeadline
+	}
+	if eta.Before(now) {
+		eta = now
+	}
+	seconds := int(math.Ceil(eta.Sub(now).Seconds()))
+	progress.ETA, progress.ETASeconds = &eta, &seconds
+	return progress
+}
+
+// newAgentProgress computes an agent's progress. An agent with a plan is as
+// far along as the mean of its phases and its planned tool runs; one without
+// reports its own progress. An agent that is no longer active is done.
+func newAgentProgress(agent *models.Agent, plan *models.AgentPlan, now time.Time) AgentProgress {
+	progress := AgentProgress{
+		AgentID:  agent.ID,
+		Status:   agent.Status,
+		ToolRuns: ProgressCount{Done: agent.Usage.ToolRuns},
+		fraction: float64(agent.Progress) / 100,
+	}
+
+	if plan != nil && len(plan.Phases) > 0 {
+		progress.Phases = ProgressCount{Done: plan.Done(), Total: len(plan.Phases)}
+		phases := float64(progress.Phases.Done)
+		for _, phase := range plan.Phases {
+			progress.ToolRuns.Total += len(phase.Tools)
+			if phase.Status == models.PhaseStatusComplete || phase.Status == models.PhaseStatusSkipped {
+				continue
+			}
+
+			left := float64(phase.EstimatedDuration)
+			if phase.Status == models.PhaseStatusRunning {
+				share := runningPhaseShare
+				if phase.EstimatedDuration > 0 && phase.StartedAt != nil {
+					spent := now.Sub(*phase.StartedAt).Seconds()
+					share = math.Min(spent/float64(phase.EstimatedDuration), runningPhaseMaxShare)
+					left = math.Max(float64(phase.EstimatedDuration)-spent, 0)
+				}
+				phases += share
+				progress.Phase = phase.Name
+			}
+			if phase.EstimatedDuration > 0 {
+				progress.estimated = true
+				progress.remaining += left
+			}
+		}
+
+		progress.fraction = phases / float64(len(plan.Phases))
+		if progress.ToolRuns.Total > 0 {
+			tools := math.Min(float64(progress.ToolRuns.Done)/float64(progress.ToolRuns.Total), 1)
+			progress.fraction = (progress.fraction + tools) / 2
+		}
+	}
+
+	if !agent.Active() {
+		progress.fraction = 1
+		progress.estimated, progress.remaining = false, 0
+	}
+	progress.fraction = math.Max(0, math.Min(progress.fraction, 1))
+	progress.Percent = int(math.Round(progress.fraction * 100))
+	return progress
+}
+
+// InitOperationProgress starts publishing the progress of running operations
+// every OPERATION_PROGRESS_SECONDS.
+func InitOperationProgress() {
+	if seconds := config.AppConfig.OperationProgressSeconds; seconds > 0 {
+		go runOperationProgress(time.Duration(seconds) * time.Second)
+	}
+}
+
+func runOperationProgress(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// reported holds the operations that were running at the last tick, so
+	// that each gets a final event once it stops.
+	reported := make(map[string]bool)
+	for range ticker.C {
+		running := make(map[string]bool)
+		for _, op := range models.Operations.GetAllOperations() {
+			if op.Status != models.OperationStatusRunning && !reported[op.ID] {
+				continue
+			}
+			if op.Status == models.OperationStatusRunning {
+				running[op.ID] = true
+			}
+			ws.BroadcastOperationProgress(op.WorkspaceID, op.ID, operationProgress(op))
+		}
+		reported = running
+	}
+}
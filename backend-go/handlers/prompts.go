@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"performa-backend/apierror"
+	"performa-backend/prompts"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PromptTemplateRequest struct {
+	Role         string `json:"role"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	SystemPrompt string `json:"system_prompt"`
+	UserPrompt   string `json:"user_prompt"`
+	Comment      string `json:"comment"`
+}
+
+type PromptRollbackRequest struct {
+	Version int `json:"version" validate:"required,min=1"`
+}
+
+func GetPromptTemplates(c *fiber.Ctx) error {
+	templates := prompts.Default.GetAll()
+	return c.JSON(fiber.Map{
+		"templates": templates,
+		"total":     len(templates),
+		"default": fiber.Map{
+			"system_prompt": prompts.DefaultSystemPrompt,
+			"user_prompt":   prompts.DefaultUserPrompt,
+		},
+		"variables": prompts.SampleData,
+	})
+}
+
+func GetPromptTemplate(c *fiber.Ctx) error {
+	tmpl := prompts.Default.Get(c.Params("id"))
+	if tmpl == nil {
+		return apierror.New(404, apierror.NotFound, "Prompt template not found")
+	}
+	return c.JSON(tmpl)
+}
+
+func CreatePromptTemplate(c *fiber.Ctx) error {
+	var req PromptTemplateRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.Role == "" || req.SystemPrompt == "" {
+		return apierror.New(400, apierror.ValidationFailed, "role and system_prompt are required")
+	}
+
+	if prompts.Default.ForRole(req.Role) != nil {
+		return apierror.New(409, apierror.Conflict, "A prompt template for this role already exists")
+	}
+
+	tmpl, err := prompts.Default.Create(req.Role, req.Name, req.Description, req.SystemPrompt, req.UserPrompt, req.Comment)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid prompt template").WithReason(err)
+	}
+
+	return c.Status(201).JSON(tmpl)
+}
+
+// UpdatePromptTemplate stores the submitted prompts as a new version and
+// makes it active.
+func UpdatePromptTemplate(c *fiber.Ctx) error {
+	var req PromptTemplateRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	id := c.Params("id")
+	current := prompts.Default.Get(id)
+	if current == nil {
+		return apierror.New(404, apierror.NotFound, "Prompt template not found")
+	}
+
+	if req.SystemPrompt == "" {
+		if active := current.Active(); active != nil {
+			req.SystemPrompt = active.SystemPrompt
+			if req.UserPrompt == "" {
+				req.UserPrompt = active.UserPrompt
+			}
+		}
+	}
+
+	tmpl, err := prompts.Default.AddVersion(id, req.Name, req.Description, req.SystemPrompt, req.UserPrompt, req.Comment)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid prompt template").WithReason(err)
+	}
+	if tmpl == nil {
+		return apierror.New(404, apierror.NotFound, "Prompt template not found")
+	}
+	return c.JSON(tmpl)
+}
+
+func DeletePromptTemplate(c *fiber.Ctx) error {
+	if !prompts.Default.Delete(c.Params("id")) {
+		return apierror.New(404, apierror.NotFound, "Prompt template not found")
+	}
+	return c.JSON(fiber.Map{
+		"status":  "deleted",
+		"message": "Prompt template deleted successfully",
+	})
+}
+
+func GetPromptTemplateVersions(c *fiber.Ctx) error {
+	tmpl := prompts.Default.Get(c.Params("id"))
+	if tmpl == nil {
+		return apierror.New(404, apierror.NotFound, "Prompt template not found")
+	}
+
+	versions := make([]prompts.Version, len(tmpl.Versions))
+	for i, version := range tmpl.Versions {
+		versions[len(versions)-1-i] = version
+	}
+	return c.JSON(fiber.Map{
+		"versions":       versions,
+		"active_version": tmpl.ActiveVersion,
+		"total":          len(versions),
+	})
+}
+
+func RollbackPromptTemplate(c *fiber.Ctx) error {
+	var req PromptRollbackRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	tmpl, err := prompts.Default.Rollback(c.Params("id"), req.Version)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Cannot roll back prompt template").WithReason(err)
+	}
+	if tmpl == nil {
+		return apierror.New(404, apierror.NotFound, "Prompt template not found")
+	}
+	return c.JSON(tmpl)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/timeline"
+	"performa-backend/ws"
+)
+
+const (
+	// maxAgentPanics is how many recovered agent panics /api/admin/runtime
+	// keeps.
+	maxAgentPanics = 20
+	// maxPanicStack bounds the stack kept for each of them.
+	maxPanicStack = 16 << 10
+)
+
+// agentPanic is a panic recovered in an agent goroutine. The stack is only
+// logged and shown to admins; the agent's messages get the panic value.
+type agentPanic struct {
+	AgentID     string    `json:"agent_id"`
+	OperationID string    `json:"operation_id,omitempty"`
+	Kind        string    `json:"kind"`
+	Value       string    `json:"value"`
+	Stack       string    `json:"stack"`
+	At          time.Time `json:"at"`
+}
+
+var (
+	agentPanics   []agentPanic
+	agentPanicsMu sync.Mutex
+)
+
+// InitAgentReaper starts the loop that flags running agents whose loop went
+// silent and fails them once they stay silent.
+func InitAgentReaper() {
+	cfg := config.AppConfig
+	if cfg.AgentReaperSeconds <= 0 || (cfg.AgentStaleSeconds <= 0 && cfg.AgentReapSeconds <= 0) {
+		return
+	}
+	go runAgentReaper(time.Duration(cfg.AgentReaperSeconds) * time.Second)
+}
+
+func runAgentReaper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		reapSilentAgents(time.Now())
+	}
+}
+
+// reapSilentAgents flags the running agents silent for AgentStaleSeconds and
+// fails those silent for AgentReapSeconds.
+func reapSilentAgents(now time.Time) {
+	staleAfter := time.Duration(config.AppConfig.AgentStaleSeconds) * time.Second
+	reapAfter := time.Duration(config.AppConfig.AgentReapSeconds) * time.Second
+
+	window := staleAfter
+	if window <= 0 || (reapAfter > 0 && reapAfter < window) {
+		window = reapAfter
+	}
+	for _, agent := range models.Manager.SilentAgents(now.Add(-window)) {
+		silence := now.Sub(agent.UpdatedAt)
+		if agent.LastHeartbeat != nil {
+			silence = now.Sub(*agent.LastHeartbeat)
+		}
+
+		if reapAfter > 0 && silence >= reapAfter {
+			if models.Manager.ReapAgent(agent.ID, now.Add(-reapAfter)) {
+				reason := fmt.Sprintf("no heartbeat for %s", silence.Round(time.Second))
+				if agentTaskRunning(agent.ID) {
+					reason += " while its goroutine was still running"
+				}
+				log.Printf("Reaped agent %s: %s", agent.ID, reason)
+				failAgent(&agent, "reaped", reason)
+			}
+			continue
+		}
+		if staleAfter > 0 && models.Manager.MarkAgentStale(agent.ID, now.Add(-staleAfter)) {
+			message := fmt.Sprintf("Agent has not reported for %s", silence.Round(time.Second))
+			log.Printf("Agent %s is stale: %s", agent.ID, message)
+			ws.BroadcastAgentReaper(agent.ID, "stale", message, models.Manager.GetAgent(agent.ID))
+		}
+	}
+}
+
+// agentTaskRunning reports whether a goroutine is registered as working on
+// the agent.
+func agentTaskRunning(agentID string) bool {
+	agentTasksMu.Lock()
+	defer agentTasksMu.Unlock()
+	_, ok := agentTasks[agentID]
+	return ok
+}
+
+// failAgent records an agent the reaper or a panic took down. The agent's
+// status has already been set.
+func failAgent(agent *models.Agent, status, reason string) {
+	models.Manager.AddMessage(agent.ID, "system", "Error: agent "+status+": "+reason)
+	ws.BroadcastAgentUpdate(agent.ID, "error", reason)
+	ws.BroadcastAgentReaper(agent.ID, status, reason, models.Manager.GetAgent(agent.ID))
+	recordAgentStatus(agent, timeline.ActorSystem, models.AgentStatusError, reason)
+	refreshOperationStatus(agent.OperationID)
+}
+
+// agentHeartbeat is called by the agent loop as it makes progress. It
+// reports false once the agent was reaped or deleted, so the loop stops
+// instead of racing the reaper's verdict.
+func agentHeartbeat(agent *models.Agent) bool {
+	recovered, ok := models.Manager.Heartbeat(agent.ID)
+	if recovered {
+		log.Printf("Agent %s reported in again", agent.ID)
+		ws.BroadcastAgentReaper(agent.ID, "recovered", "Agent reported in again", models.Manager.GetAgent(agent.ID))
+	}
+	return ok
+}
+
+// recoverAgentPanic is deferred by the agent goroutines. The HTTP recover
+// middleware does not cover them, so without it a panic would take the whole
+// server down. It marks the agent as failed.
+func recoverAgentPanic(agent *models.Agent, kind string) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	noteAgentPanic(agent, kind, value)
+
+	// A stopped or deleted agent keeps its status.
+	if current := models.Manager.GetAgent(agent.ID); current == nil || current.Status == models.AgentStatusStopped {
+		refreshOperationStatus(agent.OperationID)
+		return
+	}
+	models.Manager.UpdateAgentStatus(agent.ID, models.AgentStatusError)
+	failAgent(agent, "crashed", fmt.Sprintf("internal error: %v", value))
+}
+
+// noteAgentPanic logs a panic recovered from one of the agent's goroutines
+// with its stack and keeps it for the runtime report. It must be called from
+// the deferred function that recovered it, for the stack to show where.
+func noteAgentPanic(agent *models.Agent, kind string, value interface{}) {
+	stack := debug.Stack()
+	log.Printf("Agent %s panicked in %s: %v\n%s", agent.ID, kind, value, stack)
+	if len(stack) > maxPanicStack {
+		stack = stack[:maxPanicStack]
+	}
+
+	agentPanicsMu.Lock()
+	defer agentPanicsMu.Unlock()
+	agentPanics = append(agentPanics, agentPanic{
+		AgentID:     agent.ID,
+		OperationID: agent.OperationID,
+		Kind:        kind,
+		Value:       fmt.Sprint(value),
+		Stack:       string(stack),
+		At:          time.Now(),
+	})
+	if len(agentPanics) > maxAgentPanics {
+		agentPanics = agentPanics[len(agentPanics)-maxAgentPanics:]
+	}
+}
+
+func recentAgentPanics() []agentPanic {
+	agentPanicsMu.Lock()
+	defer agentPanicsMu.Unlock()
+	return append([]agentPanic(nil), agentPanics...)
+}
@@ -0,0 +1,614 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/jobs"
+	"performa-backend/models"
+	"performa-backend/openrouter"
+	"performa-backend/repo"
+	"performa-backend/workspaces"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Replay modes.
+const (
+	replayModeReplay = "replay"
+	replayModeDiff   = "diff"
+)
+
+const (
+	// defaultDiffTurns bounds the prompts a diff replay sends to its model
+	// unless the request sets max_turns.
+	defaultDiffTurns = 10
+	// maxDiffLines bounds the changed lines reported for a response.
+	maxDiffLines = 200
+)
+
+// ReplayRequest selects how an agent's run is replayed. The replay mode
+// runs the agent loop with the recorded model responses and tool outputs in
+// place of the model and the tools, and reports where the run no longer follows
+// its recording. The diff mode sends the recorded prompts to Model and
+// compares its responses with the recorded ones. MaxTurns limits the model
+// turns replayed.
+type ReplayRequest struct {
+	Mode         string `json:"mode"`
+	Model        string `json:"model"`
+	CredentialID string `json:"credential_id"`
+	MaxTurns     int    `json:"max_turns"`
+}
+
+// ReplayTurn is one replayed model turn. Commands are those the replay
+// extracted from the response and RecordedCommands those the run recorded;
+// in diff mode they are extracted from the new and the recorded response,
+// and Diff lists the lines that changed between them.
+type ReplayTurn struct {
+	Turn             int      `json:"turn"`
+	Iteration        int      `json:"iteration"`
+	PromptSeq        int      `json:"prompt_seq"`
+	ResponseSeq      int      `json:"response_seq,omitempty"`
+	Model            string   `json:"model"`
+	Messages         int      `json:"messages"`
+	Error            string   `json:"error,omitempty"`
+	Commands         []string `json:"commands"`
+	RecordedCommands []string `json:"recorded_commands"`
+	Findings         int      `json:"findings"`
+	Notes            []string `json:"notes,omitempty"`
+	Divergences      []string `json:"divergences,omitempty"`
+	Response         string   `json:"response,omitempty"`
+	Diff             []string `json:"diff,omitempty"`
+	CostUSD          float64  `json:"cost_usd,omitempty"`
+}
+
+// ReplayResult is the outcome of replaying an agent's run. Reproduced is set
+// when no turn diverged from the recording.
+type ReplayResult struct {
+	AgentID     string       `json:"agent_id"`
+	Mode        string       `json:"mode"`
+	Model       string       `json:"model,omitempty"`
+	Entries     int          `json:"entries"`
+	Turns       []ReplayTurn `json:"turns"`
+	Divergences int          `json:"divergences"`
+	Reproduced  bool         `json:"reproduced"`
+	CostUSD     float64      `json:"cost_usd,omitempty"`
+}
+
+// agentReplayJob is the input of an agent_replay job.
+type agentReplayJob struct {
+	AgentID string        `json:"agent_id"`
+	Request ReplayRequest `json:"request"`
+}
+
+// recordedTurn groups the recorded entries of one model call: its prompt,
+// its response and the commands run on it with their outputs.
+type recordedTurn struct {
+	prompt   models.RecordedEntry
+	response *models.RecordedEntry
+	commands []models.RecordedEntry
+	outputs  []models.RecordedEntry
+}
+
+// recordEntry appends an entry to the recording of the agent's run.
+func recordEntry(agent *models.Agent, entry models.RecordedEntry) {
+	entry.AgentID = agent.ID
+	entry.OperationID = agent.OperationID
+	entry.CreatedAt = time.Now()
+	if _, err := repo.Recordings.Append(entry); err != nil {
+		log.Printf("Agent %s: failed to record %s: %v", agent.ID, entry.Kind, err)
+	}
+}
+
+// recordPrompt records the conversation about to be sent to the model.
+func (conv *agentConversation) recordPrompt() {
+	if conv.replay != nil {
+		return
+	}
+	messages := make([]models.CheckpointMessage, 0, len(conv.messages))
+	for _, msg := range conv.messages {
+		messages = append(messages, models.CheckpointMessage{Role: msg.Role, Content: msg.Content})
+	}
+	recordEntry(conv.agent, models.RecordedEntry{
+		Kind:      models.RecordPrompt,
+		Iteration: conv.iterations,
+		Model:     conv.req.Model,
+		Messages:  messages,
+		Compacted: conv.compacted,
+	})
+	conv.compacted = 0
+}
+
+// recordResponse records the model's answer to the last prompt, or the error
+// of the call.
+func (conv *agentConversation) recordResponse(response string, err error) {
+	if conv.replay != nil {
+		return
+	}
+	entry := models.RecordedEntry{
+		Kind:      models.RecordResponse,
+		Iteration: conv.iterations,
+		Model:     conv.req.Model,
+		Content:   response,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	recordEntry(conv.agent, entry)
+}
+
+// recordCommand records a tool command of a step and the report of it fed
+// back to the model.
+func recordCommand(agent *models.Agent, iteration int, run models.StepToolRun, output string) {
+	recordEntry(agent, models.RecordedEntry{
+		Kind:      models.RecordCommand,
+		Iteration: iteration,
+		Command:   run.Command,
+		Status:    run.Status,
+	})
+	recordEntry(agent, models.RecordedEntry{
+		Kind:      models.RecordOutput,
+		Iteration: iteration,
+		Command:   run.Command,
+		Content:   output,
+	})
+}
+
+// GetAgentRecording returns the recording of the agent's run in sequence
+// order, optionally only the entries of ?kind= after ?after_seq=.
+func GetAgentRecording(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Manager.GetAgent(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Agent not found")
+	}
+	entries, err := repo.Recordings.Recording(id)
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to load recording").WithReason(err)
+	}
+
+	kind, after := c.Query("kind"), c.QueryInt("after_seq", 0)
+	filtered := make([]models.RecordedEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Seq > after && (kind == "" || entry.Kind == kind) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"entries": filtered,
+		"total":   len(filtered),
+	})
+}
+
+// ReplayAgent replays the agent's recorded run. A diff replay calls its
+// model once per turn, charged to the agent's operation; with ?async=true it
+// runs as a background job instead.
+func ReplayAgent(c *fiber.Ctx) error {
+	agent := models.Manager.GetAgent(c.Params("id"))
+	if agent == nil {
+		return apierror.New(404, apierror.NotFound, "Agent not found")
+	}
+	var req ReplayRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if err := validateReplayRequest(agent, &req); err != nil {
+		return err
+	}
+
+	if req.Mode == replayModeDiff && c.QueryBool("async") {
+		return submitJob(c, jobKindAgentReplay, agentReplayJob{AgentID: agent.ID, Request: req})
+	}
+	result, err := replayAgent(context.Background(), agent, req)
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Replay failed").WithReason(err)
+	}
+	if len(result.Turns) == 0 {
+		return apierror.New(404, apierror.NotFound, "No recorded run for this agent")
+	}
+	return c.JSON(result)
+}
+
+func validateReplayRequest(agent *models.Agent, req *ReplayRequest) error {
+	req.Mode = strings.ToLower(strings.TrimSpace(req.Mode))
+	req.Model = strings.TrimSpace(req.Model)
+	if req.Mode == "" {
+		req.Mode = replayModeReplay
+	}
+	if req.MaxTurns < 0 {
+		return apierror.New(400, apierror.ValidationFailed, "max_turns must not be negative")
+	}
+	switch req.Mode {
+	case replayModeReplay:
+	case replayModeDiff:
+		if req.Model == "" {
+			return apierror.New(400, apierror.ValidationFailed, "model is required in diff mode")
+		}
+		if req.CredentialID == "" {
+			req.CredentialID = agentStartRequest(agent).Credentials["openrouter"]
+		}
+		if !openrouter.Configured(req.CredentialID) {
+			return apierror.New(503, apierror.ServiceUnavailable, "No model API key configured")
+		}
+	default:
+		return apierror.New(400, apierror.ValidationFailed, "mode must be replay or diff").With("mode", req.Mode)
+	}
+	return nil
+}
+
+func runAgentReplayJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	var input agentReplayJob
+	if err := json.Unmarshal(job.Input, &input); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	agent := models.Manager.GetAgent(input.AgentID)
+	if agent == nil || workspaces.Normalize(AgentWorkspace(agent.ID)) != job.WorkspaceID {
+		return nil, fmt.Errorf("agent %s not found", input.AgentID)
+	}
+	if err := validateReplayRequest(agent, &input.Request); err != nil {
+		return nil, err
+	}
+	return replayAgent(ctx, agent, input.Request)
+}
+
+// replayAgent loads the agent's recording and replays it as req says.
+func replayAgent(ctx context.Context, agent *models.Agent, req ReplayRequest) (*ReplayResult, error) {
+	entries, err := repo.Recordings.Recording(agent.ID)
+	if err != nil {
+		return nil, err
+	}
+	turns := groupRecordedTurns(entries)
+	if req.MaxTurns > 0 && len(turns) > req.MaxTurns {
+		turns = turns[:req.MaxTurns]
+	}
+
+	result := &ReplayResult{AgentID: agent.ID, Mode: req.Mode, Entries: len(entries), Turns: make([]ReplayTurn, 0, len(turns))}
+	if req.Mode == replayModeDiff {
+		result.Model = req.Model
+		diffRecordedTurns(ctx, agent, req, turns, result)
+	} else {
+		replayRecordedTurns(agent, turns, result)
+	}
+	for _, turn := range result.Turns {
+		result.Divergences += len(turn.Divergences)
+	}
+	result.Reproduced = result.Divergences == 0
+	return result, nil
+}
+
+// groupRecordedTurns splits a recording into model turns. Commands recorded
+// before the first prompt, run on a checkpoint's last turn, are left out.
+func groupRecordedTurns(entries []models.RecordedEntry) []*recordedTurn {
+	var turns []*recordedTurn
+	for i := range entries {
+		entry := entries[i]
+		if entry.Kind == models.RecordPrompt {
+			turns = append(turns, &recordedTurn{prompt: entry})
+			continue
+		}
+		if len(turns) == 0 {
+			continue
+		}
+		turn := turns[len(turns)-1]
+		switch entry.Kind {
+		case models.RecordResponse:
+			turn.response = &entry
+		case models.RecordCommand:
+			turn.commands = append(turn.commands, entry)
+		case models.RecordOutput:
+			turn.outputs = append(turn.outputs, entry)
+		}
+	}
+	return turns
+}
+
+// errReplayEnded ends a replayed loop once the recording has no model turn
+// left to answer it with.
+var errReplayEnded = errors.New("recording replayed")
+
+// loopReplay feeds a recorded run through the agent loop. It stands in for
+// the model, answering each prompt with the recorded response or error, and
+// for the tools, answering the commands with their recorded outputs, and
+// notes where the loop no longer follows the recording.
+type loopReplay struct {
+	turns  []*recordedTurn
+	next   int
+	result *ReplayResult
+	// ran is set once the loop ran the commands of the turn in progress.
+	ran bool
+	// reportIndex is the index in the conversation of the tool report the
+	// loop added last, -1 without one.
+	reportIndex int
+}
+
+// replayRecordedTurns runs the agent loop on the recorded turns. The loop
+// handles each recorded response as in the run, and the conversation it
+// builds from them must be where the next recorded prompt starts. Context
+// the run added between turns, such as peer results, operator messages or a
+// compaction, is taken from the recorded prompts.
+func replayRecordedTurns(agent *models.Agent, turns []*recordedTurn, result *ReplayResult) {
+	if len(turns) == 0 {
+		return
+	}
+	replay := &loopReplay{turns: turns, result: result, reportIndex: -1}
+	req := agentStartRequest(agent)
+	req.Model = turns[0].prompt.Model
+	conv := &agentConversation{
+		agent:      agent,
+		req:        req,
+		phase:      -1,
+		osintGiven: true,
+		iterations: turns[0].prompt.Iteration,
+		replay:     replay,
+	}
+
+	// Each phase of a plan and each batch of operator messages got its own
+	// run of steps.
+	maxSteps := agentMaxSteps()
+	var err error
+	for err == nil && replay.next < len(turns) {
+		err = conv.runSteps(maxSteps, 0, 0, 0)
+	}
+	replay.finishTurn()
+	if err != nil && !errors.Is(err, errReplayEnded) && replay.next < len(turns) {
+		last := &result.Turns[len(result.Turns)-1]
+		last.Divergences = append(last.Divergences, fmt.Sprintf("the loop stopped (%v), the run went on for %d more turn(s)",
+			err, len(turns)-replay.next))
+	}
+}
+
+// chat answers the loop's model call with the next recorded turn, after
+// checking the loop's conversation against the recorded prompt.
+func (r *loopReplay) chat(conv *agentConversation) (string, openrouter.CallStats, error) {
+	r.finishTurn()
+	if r.next == len(r.turns) {
+		return "", openrouter.CallStats{}, errReplayEnded
+	}
+	turn := r.turns[r.next]
+	r.next++
+
+	replayed := ReplayTurn{
+		Turn:      r.next,
+		Iteration: turn.prompt.Iteration,
+		PromptSeq: turn.prompt.Seq,
+		Model:     turn.prompt.Model,
+		Messages:  len(turn.prompt.Messages),
+	}
+	prompt := turn.prompt.Messages
+	switch {
+	case r.next == 1:
+	case turn.prompt.Compacted > 0:
+		replayed.Notes = append(replayed.Notes, fmt.Sprintf("context compacted %d earlier message(s) before this prompt", turn.prompt.Compacted))
+	default:
+		if divergence := r.promptDivergence(conv.messages, prompt); divergence != "" {
+			replayed.Divergences = append(replayed.Divergences, divergence)
+		}
+	}
+	if r.next > 1 && conv.req.Model != turn.prompt.Model {
+		replayed.Divergences = append(replayed.Divergences, fmt.Sprintf("the loop calls %s, the run called %s", conv.req.Model, turn.prompt.Model))
+	}
+
+	// The loop goes on from the recorded prompt, with the context the run
+	// added to it.
+	conv.messages = make([]openrouter.Message, 0, len(prompt))
+	for _, msg := range prompt {
+		conv.messages = append(conv.messages, openrouter.Message{Role: msg.Role, Content: msg.Content})
+	}
+	r.reportIndex = -1
+
+	switch {
+	case turn.response == nil:
+		replayed.Notes = append(replayed.Notes, "no response recorded")
+		r.result.Turns = append(r.result.Turns, replayed)
+		return "", openrouter.CallStats{}, errReplayEnded
+	case turn.response.Error != "":
+		replayed.ResponseSeq = turn.response.Seq
+		replayed.Error = turn.response.Error
+		r.result.Turns = append(r.result.Turns, replayed)
+		return "", openrouter.CallStats{}, errors.New(turn.response.Error)
+	}
+	replayed.ResponseSeq = turn.response.Seq
+	r.result.Turns = append(r.result.Turns, replayed)
+	return turn.response.Content, openrouter.CallStats{}, nil
+}
+
+// responded takes the response of the turn in progress as the loop handled
+// it, counting the findings it reports.
+func (r *loopReplay) responded(response string) {
+	reported, _ := extractFindingsBlocks(response)
+	r.result.Turns[len(r.result.Turns)-1].Findings = len(reported)
+}
+
+// run answers the commands the loop runs on the turn in progress with their
+// recorded outputs, in the loop's order, as the report fed to the model.
+func (r *loopReplay) run(conv *agentConversation, commands []string) string {
+	replayed := &r.result.Turns[len(r.result.Turns)-1]
+	replayed.Commands = commands
+	r.ran = true
+
+	pending := make(map[string][]string)
+	for _, output := range r.turns[r.next-1].outputs {
+		pending[output.Command] = append(pending[output.Command], output.Content)
+	}
+	var report strings.Builder
+	for _, command := range commands {
+		queue := pending[command]
+		if len(queue) == 0 {
+			replayed.Divergences = append(replayed.Divergences, fmt.Sprintf("no recorded output for command `%s`", command))
+			continue
+		}
+		pending[command] = queue[1:]
+		report.WriteString(queue[0])
+		report.WriteString("\n\n")
+	}
+	r.reportIndex = len(conv.messages)
+	return strings.TrimSpace(report.String())
+}
+
+// finishTurn compares the commands the loop ran on the turn in progress with
+// those the run executed.
+func (r *loopReplay) finishTurn() {
+	if len(r.result.Turns) == 0 {
+		return
+	}
+	replayed := &r.result.Turns[len(r.result.Turns)-1]
+	turn := r.turns[r.next-1]
+	ran := r.ran
+	r.ran = false
+	if replayed.RecordedCommands != nil || turn.response == nil || turn.response.Error != "" {
+		return
+	}
+
+	replayed.RecordedCommands = make([]string, 0, len(turn.commands))
+	for _, command := range turn.commands {
+		replayed.RecordedCommands = append(replayed.RecordedCommands, command.Command)
+	}
+	switch {
+	case !ran && len(turn.commands) > 0:
+		replayed.Divergences = append(replayed.Divergences, fmt.Sprintf("the loop ran no commands, the run executed %q", replayed.RecordedCommands))
+	case ran && len(turn.commands) == 0:
+		replayed.Notes = append(replayed.Notes, "commands not run by the recorded run: it ended first")
+	case ran && !sameCommands(replayed.Commands, replayed.RecordedCommands):
+		replayed.Divergences = append(replayed.Divergences, fmt.Sprintf("the loop ran commands %q, the run executed %q",
+			replayed.Commands, replayed.RecordedCommands))
+	}
+}
+
+// promptDivergence reports how a recorded prompt fails to continue the
+// loop's conversation, or "" when it does. Messages the run added between
+// turns may follow, and notes may be appended to the last tool report.
+func (r *loopReplay) promptDivergence(messages []openrouter.Message, prompt []models.CheckpointMessage) string {
+	if len(prompt) < len(messages) {
+		return fmt.Sprintf("prompt has %d message(s), the loop's conversation %d", len(prompt), len(messages))
+	}
+	for i, msg := range messages {
+		got := prompt[i]
+		same := got.Role == msg.Role && got.Content == msg.Content
+		if i == r.reportIndex {
+			same = got.Role == msg.Role && strings.HasPrefix(got.Content, msg.Content)
+		}
+		if !same {
+			return fmt.Sprintf("prompt message %d (%s) differs from the loop's conversation", i+1, got.Role)
+		}
+	}
+	return ""
+}
+
+// diffRecordedTurns sends each recorded prompt to the request's model and
+// compares its answer with the recorded one. Failed calls that were retried
+// are skipped since their prompt is sent again by the next turn.
+func diffRecordedTurns(ctx context.Context, agent *models.Agent, req ReplayRequest, turns []*recordedTurn, result *ReplayResult) {
+	maxTurns := req.MaxTurns
+	if maxTurns == 0 {
+		maxTurns = defaultDiffTurns
+	}
+	for i, turn := range turns {
+		if len(result.Turns) == maxTurns || ctx.Err() != nil {
+			break
+		}
+		if turn.response != nil && turn.response.Error != "" && i < len(turns)-1 {
+			continue
+		}
+
+		messages := make([]openrouter.Message, 0, len(turn.prompt.Messages))
+		for _, msg := range turn.prompt.Messages {
+			messages = append(messages, openrouter.Message{Role: msg.Role, Content: msg.Content})
+		}
+		content, stats, err := openrouter.ChatMeteredWithSampling(messages, req.Model, req.CredentialID, agent.Config.Sampling)
+		openrouter.Spending.Charge(agent.OperationID, stats)
+		result.CostUSD += stats.Cost
+
+		recorded := ""
+		diffed := ReplayTurn{
+			Turn:      i + 1,
+			Iteration: turn.prompt.Iteration,
+			PromptSeq: turn.prompt.Seq,
+			Model:     req.Model,
+			Messages:  len(turn.prompt.Messages),
+			Response:  content,
+			CostUSD:   stats.Cost,
+		}
+		if turn.response != nil {
+			diffed.ResponseSeq = turn.response.Seq
+			recorded = turn.response.Content
+		}
+		if err != nil {
+			diffed.Error = err.Error()
+			result.Turns = append(result.Turns, diffed)
+			continue
+		}
+
+		reported, _ := extractFindingsBlocks(content)
+		diffed.Findings = len(reported)
+		diffed.Commands = extractToolCommands(content)
+		diffed.RecordedCommands = extractToolCommands(recorded)
+		diffed.Diff = diffLines(recorded, content)
+		if !sameCommands(diffed.Commands, diffed.RecordedCommands) {
+			diffed.Divergences = append(diffed.Divergences, fmt.Sprintf("%s asks for commands %q, %s asked for %q",
+				req.Model, diffed.Commands, turn.prompt.Model, diffed.RecordedCommands))
+		}
+		result.Turns = append(result.Turns, diffed)
+	}
+}
+
+func sameCommands(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffLines returns the lines removed from a ("- ") and added in b ("+ "),
+// in order, from their longest common subsequence of lines.
+func diffLines(a, b string) []string {
+	before, after := strings.Split(a, "\n"), strings.Split(b, "\n")
+	if a == "" {
+		before = nil
+	}
+	if b == "" {
+		after = nil
+	}
+
+	// common[i][j] is the length of the longest common subsequence of
+	// before[i:] and after[j:].
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = maxInt(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]string, 0)
+	i, j := 0, 0
+	for (i < len(before) || j < len(after)) && len(diff) < maxDiffLines {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			i++
+			j++
+		case i < len(before) && (j == len(after) || common[i+1][j] >= common[i][j+1]):
+			diff = append(diff, "- "+before[i])
+			i++
+		default:
+			diff = append(diff, "+ "+after[j])
+			j++
+		}
+	}
+	return diff
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/jobs"
+	"performa-backend/models"
+	"performa-backend/openrouter"
+	"performa-backend/reports"
+	"performa-backend/workspaces"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxSummaryFindings bounds the aggregated findings sent to the model.
+const maxSummaryFindings = 200
+
+const reportSummaryPrompt = `You are a security consultant writing the executive summary of a penetration test report for a non-technical audience.
+You are given the assessed target and its findings aggregated by title, severity and category.
+Respond with a single JSON object and nothing else, in this form:
+{"executive_summary": "two or three short paragraphs separated by blank lines", "risk_narrative": "one or two paragraphs on what an attacker could achieve and what to fix first"}
+Only discuss the findings listed; do not invent others.`
+
+// ReportSummaryRequest optionally overrides the model and credential used to
+// generate an executive summary.
+type ReportSummaryRequest struct {
+	Model        string `json:"model"`
+	CredentialID string `json:"credential_id"`
+}
+
+// ReportSummaryUpdate edits a summary under review. Edited text moves an
+// approved summary back to draft unless approved is set along with it.
+type ReportSummaryUpdate struct {
+	ExecutiveSummary *string `json:"executive_summary"`
+	RiskNarrative    *string `json:"risk_narrative"`
+	Approved         *bool   `json:"approved"`
+}
+
+// reportSummaryJob is the input of a report_summary job.
+type reportSummaryJob struct {
+	OperationID  string `json:"operation_id"`
+	Model        string `json:"model,omitempty"`
+	CredentialID string `json:"credential_id,omitempty"`
+}
+
+// GenerateReportSummary has the model draft the executive summary and risk
+// narrative of an operation's report from its findings, replacing any
+// previous summary. With ?async=true it runs as a background job instead.
+func GenerateReportSummary(c *fiber.Ctx) error {
+	op := models.Operations.GetOperation(c.Params("id"))
+	if op == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+	var req ReportSummaryRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if !openrouter.Configured(req.CredentialID) {
+		return apierror.New(503, apierror.ServiceUnavailable, "No model API key configured")
+	}
+
+	if c.QueryBool("async") {
+		return submitJob(c, jobKindReportSummary, reportSummaryJob{OperationID: op.ID, Model: req.Model, CredentialID: req.CredentialID})
+	}
+	summary, err := generateReportSummary(op, req.Model, req.CredentialID)
+	if err != nil {
+		return providerError(502, "Summary generation failed", err).WithReason(err)
+	}
+	return c.Status(201).JSON(summary)
+}
+
+func runReportSummaryJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	var input reportSummaryJob
+	if err := json.Unmarshal(job.Input, &input); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	op := models.Operations.GetOperation(input.OperationID)
+	if op == nil || workspaces.Normalize(op.WorkspaceID) != job.WorkspaceID {
+		return nil, fmt.Errorf("operation %s not found", input.OperationID)
+	}
+	return generateReportSummary(op, input.Model, input.CredentialID)
+}
+
+// generateReportSummary drafts the operation's summary with model (the
+// configured report summary model when empty) and keeps it. The model sees
+// the titles, severities and categories of the findings, not their
+// evidence; the call is charged to the operation.
+func generateReportSummary(op *models.Operation, model, credentialID string) (*reports.Summary, error) {
+	if model == "" {
+		model = config.AppConfig.ReportSummaryModel
+	}
+
+	content, stats, err := openrouter.ChatMeteredWithCredential([]openrouter.Message{
+		{Role: "system", Content: reportSummaryPrompt},
+		{Role: "user", Content: reportSummaryInput(operationReportData(op))},
+	}, model, credentialID)
+	if err != nil {
+		return nil, err
+	}
+	openrouter.Spending.Charge(op.ID, stats)
+
+	executive, risk := parseReportSummary(content)
+	now := time.Now()
+	reports.Summaries.Put(reports.Summary{
+		OperationID:      op.ID,
+		WorkspaceID:      workspaces.Normalize(op.WorkspaceID),
+		ExecutiveSummary: executive,
+		RiskNarrative:    risk,
+		Status:           reports.SummaryDraft,
+		Model:            model,
+		GeneratedAt:      now,
+	})
+	return reports.Summaries.Get(op.ID), nil
+}
+
+// reportSummaryInput lists the report's findings for the model, counted by
+// severity and grouped by title, severity and category, most severe first.
+func reportSummaryInput(data reports.Data) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Target: %s\nFindings: %d", data.Operation.Target, data.Total)
+	for _, count := range data.Severities {
+		fmt.Fprintf(&b, ", %d %s", count.Count, count.Severity)
+	}
+	b.WriteString("\n")
+
+	type group struct{ severity, title, category string }
+	counts := make(map[group]int)
+	var order []group
+	for _, f := range data.Findings {
+		g := group{strings.ToLower(f.Severity), strings.TrimSpace(f.Title), strings.TrimSpace(f.Category)}
+		if counts[g] == 0 {
+			order = append(order, g)
+		}
+		counts[g]++
+	}
+	for i, g := range order {
+		if i == maxSummaryFindings {
+			fmt.Fprintf(&b, "- and %d more\n", len(order)-i)
+			break
+		}
+		fmt.Fprintf(&b, "- [%s] %s", g.severity, g.title)
+		if g.category != "" {
+			fmt.Fprintf(&b, " (%s)", g.category)
+		}
+		if counts[g] > 1 {
+			fmt.Fprintf(&b, " x%d", counts[g])
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// parseReportSummary reads the model's JSON answer. A response that is not
+// JSON is kept whole as the executive summary.
+func parseReportSummary(content string) (string, string) {
+	var parsed struct {
+		ExecutiveSummary string `json:"executive_summary"`
+		RiskNarrative    string `json:"risk_narrative"`
+	}
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start >= 0 && end > start && json.Unmarshal([]byte(content[start:end+1]), &parsed) == nil && parsed.ExecutiveSummary != "" {
+		return strings.TrimSpace(parsed.ExecutiveSummary), strings.TrimSpace(parsed.RiskNarrative)
+	}
+	return strings.TrimSpace(content), ""
+}
+
+// GetReportSummary returns the operation's summary.
+func GetReportSummary(c *fiber.Ctx) error {
+	summary := reports.Summaries.Get(c.Params("id"))
+	if summary == nil {
+		return apierror.New(404, apierror.NotFound, "Report summary not found").
+			WithReason("generate one with POST /api/operations/:id/report/summary")
+	}
+	return c.JSON(summary)
+}
+
+// UpdateReportSummary edits, approves or withdraws the approval of the
+// operation's summary. Only an approved summary goes into the reports.
+func UpdateReportSummary(c *fiber.Ctx) error {
+	summary := reports.Summaries.Get(c.Params("id"))
+	if summary == nil {
+		return apierror.New(404, apierror.NotFound, "Report summary not found")
+	}
+	var req ReportSummaryUpdate
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	edited := false
+	if req.ExecutiveSummary != nil {
+		summary.ExecutiveSummary = strings.TrimSpace(*req.ExecutiveSummary)
+		edited = true
+	}
+	if req.RiskNarrative != nil {
+		summary.RiskNarrative = strings.TrimSpace(*req.RiskNarrative)
+		edited = true
+	}
+	summary.Edited = summary.Edited || edited
+
+	approve := summary.Status == reports.SummaryApproved && !edited
+	if req.Approved != nil {
+		approve = *req.Approved
+	}
+	if approve && summary.ExecutiveSummary == "" {
+		return apierror.New(400, apierror.ValidationFailed, "An empty executive summary cannot be approved")
+	}
+	if approve && (summary.Status != reports.SummaryApproved || edited) {
+		now := time.Now()
+		summary.Status = reports.SummaryApproved
+		summary.ReviewedAt = &now
+		summary.ReviewedBy = ""
+		if user := currentUser(c); user != nil {
+			summary.ReviewedBy = user.Username
+		}
+	} else if !approve {
+		summary.Status = reports.SummaryDraft
+		summary.ReviewedAt = nil
+		summary.ReviewedBy = ""
+	}
+
+	reports.Summaries.Put(*summary)
+	return c.JSON(reports.Summaries.Get(summary.OperationID))
+}
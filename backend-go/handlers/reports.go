@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/reports"
+	"performa-backend/suppressions"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReportTemplateRequest is an uploaded report template. A JSON body carries
+// the logo as a data: URI; a multipart upload may send the body, the cover
+// and the logo as files of those names and the severity colors as a JSON
+// field.
+type ReportTemplateRequest struct {
+	Name           string            `json:"name" form:"name"`
+	Description    string            `json:"description" form:"description"`
+	Body           string            `json:"body" form:"body"`
+	Cover          string            `json:"cover" form:"cover"`
+	Logo           string            `json:"logo" form:"-"`
+	SeverityColors map[string]string `json:"severity_colors" form:"-"`
+}
+
+// InitReports restores the uploaded report templates and the reports'
+// summaries.
+func InitReports() {
+	reports.Default.Load()
+	reports.Summaries.Load()
+}
+
+// GetReportTemplates lists the built-in template and the workspace's own,
+// with the sample data templates are previewed with.
+func GetReportTemplates(c *fiber.Ctx) error {
+	templates := reports.Default.List(currentWorkspace(c))
+	return c.JSON(fiber.Map{
+		"templates":      templates,
+		"total":          len(templates),
+		"default_colors": reports.DefaultColors,
+		"variables":      reports.SampleData,
+	})
+}
+
+func GetReportTemplate(c *fiber.Ctx) error {
+	t, err := workspaceReportTemplate(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(t)
+}
+
+// CreateReportTemplate stores a template once it renders the sample data.
+func CreateReportTemplate(c *fiber.Ctx) error {
+	t := &reports.Template{WorkspaceID: currentWorkspace(c)}
+	if err := readReportTemplate(c, t); err != nil {
+		return err
+	}
+	if err := reports.Default.Save(t); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid report template").WithReason(err)
+	}
+	return c.Status(201).JSON(t)
+}
+
+// UpdateReportTemplate replaces the parts of a template the request sets.
+func UpdateReportTemplate(c *fiber.Ctx) error {
+	current, err := workspaceReportTemplate(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if current.BuiltIn {
+		return apierror.New(409, apierror.Conflict, "The built-in report template cannot be changed")
+	}
+
+	updated := *current
+	if err := readReportTemplate(c, &updated); err != nil {
+		return err
+	}
+	if err := reports.Default.Save(&updated); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid report template").WithReason(err)
+	}
+	return c.JSON(updated)
+}
+
+func DeleteReportTemplate(c *fiber.Ctx) error {
+	t, err := workspaceReportTemplate(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if t.BuiltIn {
+		return apierror.New(409, apierror.Conflict, "The built-in report template cannot be deleted")
+	}
+	reports.Default.Delete(t.ID)
+	return c.JSON(fiber.Map{
+		"status":  "deleted",
+		"message": "Report template deleted successfully",
+	})
+}
+
+// PreviewReportTemplate renders a template that is not stored yet against
+// the sample data, reporting why it is invalid if it is.
+func PreviewReportTemplate(c *fiber.Ctx) error {
+	t := &reports.Template{Name: "Preview"}
+	if err := readReportTemplate(c, t); err != nil {
+		return err
+	}
+	return renderReportTemplate(c, t)
+}
+
+// GetReportTemplatePreview renders a stored template against the sample
+// data.
+func GetReportTemplatePreview(c *fiber.Ctx) error {
+	t, err := workspaceReportTemplate(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return renderReportTemplate(c, t)
+}
+
+func renderReportTemplate(c *fiber.Ctx, t *reports.Template) error {
+	if err := reports.Validate(t); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid report template").WithReason(err)
+	}
+	html, err := reports.Render(t, reports.SampleData)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid report template").WithReason(err)
+	}
+	c.Type("html", "utf-8")
+	return c.Send(html)
+}
+
+// GetOperationReport renders the report of an operation with the template
+// ?template= names, the built-in one by default. The operation's summary is
+// included once approved, or as a draft to review it with ?draft=true.
+// ?download=true serves the report as an attachment.
+func GetOperationReport(c *fiber.Ctx) error {
+	op := models.Operations.GetOperation(c.Params("id"))
+	if op == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+	t, err := workspaceReportTemplate(c, c.Query("template", reports.DefaultTemplateID))
+	if err != nil {
+		return err
+	}
+
+	data := operationReportData(op)
+	if summary := reports.Summaries.Get(op.ID); summary != nil && (summary.Status == reports.SummaryApproved || c.QueryBool("draft")) {
+		data.ExecutiveSummary = summary.ExecutiveSummary
+		data.RiskNarrative = summary.RiskNarrative
+	}
+	html, err := reports.Render(t, data)
+	if err != nil {
+		return apierror.New(422, apierror.ValidationFailed, "Report template failed to render").
+			With("template_id", t.ID).
+			WithReason(err)
+	}
+	c.Type("html", "utf-8")
+	if c.QueryBool("download") {
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "report-"+op.ID+".html"))
+	}
+	return c.Send(html)
+}
+
+// operationReportData collects the findings of an operation's agents, with
+// the accepted risks behind those suppressed.
+func operationReportData(op *models.Operation) reports.Data {
+	agents := models.Manager.GetOperationAgents(op.ID)
+	var findings []reports.Finding
+	for _, agent := range agents {
+		agentFindings, _ := models.Findings.Query(models.FindingFilter{AgentID: agent.ID})
+		for _, f := range agentFindings {
+			finding := reports.Finding{
+				ID:          f.ID,
+				Title:       f.Title,
+				Description: f.Description,
+				Severity:    string(f.Severity),
+				Category:    f.Category,
+				Target:      f.Target,
+				Evidence:    f.Evidence,
+				Status:      f.Status,
+				CVSSScore:   f.CVSSScore,
+				CVSSVector:  f.CVSSVector,
+				CWE:         f.CWE,
+				Remediation: f.Remediation,
+				CreatedAt:   f.CreatedAt,
+			}
+			if suppression := suppressions.Default.Get(f.SuppressionID); suppression != nil {
+				finding.Justification = suppression.Justification
+				finding.Approver = suppression.Approver
+				finding.AcceptedUntil = suppression.ExpiresAt
+			}
+			findings = append(findings, finding)
+		}
+	}
+
+	return reports.NewData("Security Assessment: "+op.Target, reports.Operation{
+		ID:        op.ID,
+		Target:    op.Target,
+		Status:    string(op.Status),
+		Agents:    len(agents),
+		CreatedAt: op.CreatedAt,
+	}, findings)
+}
+
+// workspaceReportTemplate returns the built-in template or one of the
+// request's workspace.
+func workspaceReportTemplate(c *fiber.Ctx, id string) (*reports.Template, error) {
+	t := reports.Default.Get(id)
+	if t == nil || (!t.BuiltIn && !inWorkspace(c, t.WorkspaceID)) {
+		return nil, apierror.New(404, apierror.NotFound, "Report template not found").With("template_id", id)
+	}
+	return t, nil
+}
+
+// readReportTemplate sets the parts of t the request sets.
+func readReportTemplate(c *fiber.Ctx, t *reports.Template) error {
+	var req ReportTemplateRequest
+	if err := decodeBody(c, &req); err != nil {
+		return err
+	}
+
+	var logo *reports.Asset
+	if form, err := c.MultipartForm(); err == nil {
+		for name, field := range map[string]*string{"body": &req.Body, "cover": &req.Cover} {
+			data, err := readFormFile(form, name)
+			if err != nil {
+				return err
+			}
+			if data != nil {
+				*field = string(data)
+			}
+		}
+		data, err := readFormFile(form, "logo")
+		if err != nil {
+			return err
+		}
+		if data != nil {
+			contentType := form.File["logo"][0].Header.Get("Content-Type")
+			if contentType == "" || contentType == "application/octet-stream" {
+				if contentType = mime.TypeByExtension(filepath.Ext(form.File["logo"][0].Filename)); contentType == "" {
+					contentType = http.DetectContentType(data)
+				}
+			}
+			logo = &reports.Asset{ContentType: strings.TrimSpace(strings.Split(contentType, ";")[0]), Data: data}
+		}
+		if colors := c.FormValue("severity_colors"); colors != "" {
+			if err := json.Unmarshal([]byte(colors), &req.SeverityColors); err != nil {
+				return apierror.New(400, apierror.ValidationFailed, "severity_colors must be a JSON object").WithReason(err)
+			}
+		}
+	} else if req.Logo != "" {
+		asset, err := parseDataURI(req.Logo)
+		if err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Invalid logo").WithReason(err)
+		}
+		logo = asset
+	}
+
+	if req.Name != "" {
+		t.Name = req.Name
+	}
+	if req.Description != "" {
+		t.Description = req.Description
+	}
+	if req.Body != "" {
+		t.Body = req.Body
+	}
+	if req.Cover != "" {
+		t.Cover = req.Cover
+	}
+	if logo != nil {
+		t.Logo = logo
+	}
+	if req.SeverityColors != nil {
+		t.SeverityColors = req.SeverityColors
+	}
+	return nil
+}
+
+// readFormFile returns the content of the multipart file name, or nil when
+// the form has none.
+func readFormFile(form *multipart.Form, name string) ([]byte, error) {
+	files := form.File[name]
+	if len(files) == 0 {
+		return nil, nil
+	}
+	limit := int64(reports.MaxTemplateBytes)
+	if name == "logo" {
+		limit = reports.MaxLogoBytes
+	}
+	if files[0].Size > limit {
+		return nil, apierror.New(413, apierror.ValidationFailed, fmt.Sprintf("%s is larger than %d bytes", name, limit))
+	}
+	file, err := files[0].Open()
+	if err != nil {
+		return nil, apierror.New(400, apierror.ValidationFailed, "Failed to read upload").With("field", name)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, apierror.New(400, apierror.ValidationFailed, "Failed to read upload").With("field", name)
+	}
+	return data, nil
+}
+
+// parseDataURI decodes a base64 data: URI.
+func parseDataURI(uri string) (*reports.Asset, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(uri), "data:")
+	if !ok {
+		return nil, fmt.Errorf("expected a data: URI")
+	}
+	header, encoded, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return nil, fmt.Errorf("expected a base64 data: URI")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	contentType := strings.TrimSuffix(header, ";base64")
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return &reports.Asset{ContentType: contentType, Data: data}, nil
+}
@@ -1,53 +1,226 @@
 package handlers
 
 import (
+        "sort"
+        "sync"
         "time"
 
+        "performa-backend/alerts"
+        "performa-backend/config"
+
         "github.com/gofiber/fiber/v2"
         "github.com/shirou/gopsutil/v3/cpu"
         "github.com/shirou/gopsutil/v3/disk"
+        "github.com/shirou/gopsutil/v3/host"
+        "github.com/shirou/gopsutil/v3/load"
         "github.com/shirou/gopsutil/v3/mem"
         "github.com/shirou/gopsutil/v3/net"
 )
 
+// ResourceStats is a snapshot of host resources. Disk is the used percentage of
+// the first monitored mount and Network the total throughput across all
+// interfaces in KB/s; the slices carry the per-mount and per-NIC breakdown.
 type ResourceStats struct {
-        CPU       float64 `json:"cpu"`
-        Memory    float64 `json:"memory"`
-        Disk      float64 `json:"disk"`
-        Network   float64 `json:"network"`
-        Timestamp string  `json:"timestamp"`
+        CPU          float64           `json:"cpu"`
+        Memory       float64           `json:"memory"`
+        Disk         float64           `json:"disk"`
+        Network      float64           `json:"network"`
+        Disks        []DiskStats       `json:"disks"`
+        Interfaces   []InterfaceStats  `json:"interfaces"`
+        Load         *LoadStats        `json:"load,omitempty"`
+        Swap         *SwapStats        `json:"swap,omitempty"`
+        Temperatures []TemperatureStat `json:"temperatures,omitempty"`
+        Timestamp    string            `json:"timestamp"`
 }
 
-func GetResources(c *fiber.Ctx) error {
-        cpuPercent, _ := cpu.Percent(0, false)
-        cpuUsage := 0.0
-        if len(cpuPercent) > 0 {
-                cpuUsage = cpuPercent[0]
+type DiskStats struct {
+        Mountpoint  string  `json:"mountpoint"`
+        TotalBytes  uint64  `json:"total_bytes"`
+        UsedBytes   uint64  `json:"used_bytes"`
+        UsedPercent float64 `json:"used_percent"`
+}
+
+type InterfaceStats struct {
+        Name      string  `json:"name"`
+        RxKBps    float64 `json:"rx_kbps"`
+        TxKBps    float64 `json:"tx_kbps"`
+        BytesRecv uint64  `json:"bytes_recv"`
+        BytesSent uint64  `json:"bytes_sent"`
+}
+
+type LoadStats struct {
+        Load1  float64 `json:"load1"`
+        Load5  float64 `json:"load5"`
+        Load15 float64 `json:"load15"`
+}
+
+type SwapStats struct {
+        TotalBytes  uint64  `json:"total_bytes"`
+        UsedBytes   uint64  `json:"used_bytes"`
+        UsedPercent float64 `json:"used_percent"`
+}
+
+type TemperatureStat struct {
+        Sensor  string  `json:"sensor"`
+        Celsius float64 `json:"celsius"`
+}
+
+// resourceCollector keeps the previous NIC counters so throughput can be
+// reported as a rate between consecutive collections.
+type resourceCollector struct {
+        lastNet  map[string]net.IOCountersStat
+        lastTime time.Time
+        mu       sync.Mutex
+}
+
+var collector = &resourceCollector{}
+
+// CollectResources samples host resources. Network rates cover the time since
+// the previous call, whether it came from the monitor or an API request.
+func CollectResources() ResourceStats {
+        stats := ResourceStats{
+                Disks:      []DiskStats{},
+                Interfaces: []InterfaceStats{},
+                Timestamp:  time.Now().Format(time.RFC3339),
+        }
+
+        if cpuPercent, _ := cpu.Percent(0, false); len(cpuPercent) > 0 {
+                stats.CPU = cpuPercent[0]
+        }
+
+        if memInfo, _ := mem.VirtualMemory(); memInfo != nil {
+                stats.Memory = memInfo.UsedPercent
         }
 
-        memInfo, _ := mem.VirtualMemory()
-        memUsage := 0.0
-        if memInfo != nil {
-                memUsage = memInfo.UsedPercent
+        for _, mount := range monitoredMounts() {
+                usage, err := disk.Usage(mount)
+                if err != nil {
+                        continue
+                }
+                stats.Disks = append(stats.Disks, DiskStats{
+                        Mountpoint:  usage.Path,
+                        TotalBytes:  usage.Total,
+                        UsedBytes:   usage.Used,
+                        UsedPercent: usage.UsedPercent,
+                })
+        }
+        if len(stats.Disks) > 0 {
+                stats.Disk = stats.Disks[0].UsedPercent
+        }
+
+        stats.Interfaces = collector.networkRates()
+        for _, iface := range stats.Interfaces {
+                stats.Network += iface.RxKBps + iface.TxKBps
         }
 
-        diskInfo, _ := disk.Usage("/")
-        diskUsage := 0.0
-        if diskInfo != nil {
-                diskUsage = diskInfo.UsedPercent
+        if avg, err := load.Avg(); err == nil {
+                stats.Load = &LoadStats{Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}
         }
 
-        netIO, _ := net.IOCounters(false)
-        networkUsage := 0.0
-        if len(netIO) > 0 {
-                networkUsage = float64(netIO[0].BytesSent+netIO[0].BytesRecv) / 1024 / 1024
+        if swap, err := mem.SwapMemory(); err == nil && swap.Total > 0 {
+                stats.Swap = &SwapStats{TotalBytes: swap.Total, UsedBytes: swap.Used, UsedPercent: swap.UsedPercent}
         }
 
-        return c.JSON(ResourceStats{
-                CPU:       cpuUsage,
-                Memory:    memUsage,
-                Disk:      diskUsage,
-                Network:   networkUsage,
-                Timestamp: time.Now().Format(time.RFC3339),
+        // Sensors are often unavailable (VMs, containers); partial results are
+        // still returned alongside a warning error.
+        sensors, _ := host.SensorsTemperatures()
+        for _, sensor := range sensors {
+                if sensor.Temperature <= 0 {
+                        continue
+                }
+                stats.Temperatures = append(stats.Temperatures, TemperatureStat{
+                        Sensor:  sensor.SensorKey,
+                        Celsius: sensor.Temperature,
+                })
+        }
+
+        return stats
+}
+
+func monitoredMounts() []string {
+        if len(config.AppConfig.ResourceMonitorMounts) > 0 {
+                return config.AppConfig.ResourceMonitorMounts
+        }
+        return []string{"/"}
+}
+
+func (rc *resourceCollector) networkRates() []InterfaceStats {
+        counters, err := net.IOCounters(true)
+        if err != nil {
+                return []InterfaceStats{}
+        }
+
+        rc.mu.Lock()
+        defer rc.mu.Unlock()
+
+        now := time.Now()
+        elapsed := now.Sub(rc.lastTime).Seconds()
+        current := make(map[string]net.IOCountersStat, len(counters))
+        interfaces := make([]InterfaceStats, 0, len(counters))
+
+        for _, counter := range counters {
+                current[counter.Name] = counter
+                iface := InterfaceStats{
+                        Name:      counter.Name,
+                        BytesRecv: counter.BytesRecv,
+                        BytesSent: counter.BytesSent,
+                }
+                // Counters reset when an interface goes down; skip that interval.
+                if previous, ok := rc.lastNet[counter.Name]; ok && elapsed > 0 &&
+                        counter.BytesRecv >= previous.BytesRecv && counter.BytesSent >= previous.BytesSent {
+                        iface.RxKBps = float64(counter.BytesRecv-previous.BytesRecv) / 1024 / elapsed
+                        iface.TxKBps = float64(counter.BytesSent-previous.BytesSent) / 1024 / elapsed
+                }
+                interfaces = append(interfaces, iface)
+        }
+
+        rc.lastNet = current
+        rc.lastTime = now
+
+        sort.Slice(interfaces, func(i, j int) bool { return interfaces[i].Name < interfaces[j].Name })
+        return interfaces
+}
+
+func GetResources(c *fiber.Ctx) error {
+        return c.JSON(CollectResources())
+}
+
+// InitResourceAlerts applies the configured thresholds and notification
+// targets to the default alert monitor.
+func InitResourceAlerts() {
+        alerts.Configure(alerts.Config{
+                Thresholds: map[string]float64{
+                        "cpu":    config.AppConfig.AlertCPUThreshold,
+                        "memory": config.AppConfig.AlertMemoryThreshold,
+                        "disk":   config.AppConfig.AlertDiskThreshold,
+                },
+                Hysteresis:      config.AppConfig.AlertHysteresis,
+                WebhookURL:      config.AppConfig.AlertWebhookURL,
+                SlackWebhookURL: config.AppConfig.AlertSlackWebhookURL,
+        })
+}
+
+// EvaluateResourceAlerts checks a resource snapshot against the alert
+// thresholds. Each monitored mount is evaluated separately as "disk:<mount>".
+func EvaluateResourceAlerts(stats ResourceStats) []alerts.Alert {
+        values := map[string]float64{
+                "cpu":    stats.CPU,
+                "memory": stats.Memory,
+        }
+        for _, d := range stats.Disks {
+                values["disk:"+d.Mountpoint] = d.UsedPercent
+        }
+        return alerts.Default.Evaluate(values)
+}
+
+func GetResourceAlerts(c *fiber.Ctx) error {
+        limit := c.QueryInt("limit", 100)
+        thresholds, hysteresis := alerts.Default.Thresholds()
+
+        return c.JSON(fiber.Map{
+                "active":     alerts.Default.Active(),
+                "history":    alerts.Default.History(limit),
+                "thresholds": thresholds,
+                "hysteresis": hysteresis,
         })
 }
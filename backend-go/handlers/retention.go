@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/repo"
+	"performa-backend/retention"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultRetentionReportLimit = 20
+
+// InitRetention sets up the retention janitor and starts purging what the
+// policy no longer keeps every RETENTION_INTERVAL_MINUTES.
+func InitRetention() {
+	retention.Default.Configure(config.AppConfig.RetentionArchiveDir,
+		logSource{}, findingSource{}, sessionSource{}, messageSource{})
+	retention.Default.SetNotify(reportRetention)
+	if minutes := config.AppConfig.RetentionIntervalMinutes; minutes > 0 {
+		go runRetention(time.Duration(minutes) * time.Minute)
+	}
+}
+
+func runRetention(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		retention.Default.Run(retentionPolicy(), retention.TriggerSchedule, false)
+	}
+}
+
+// retentionPolicy reads the policy from the current settings, so changes
+// through /api/admin/settings apply from the next run.
+func retentionPolicy() retention.Policy {
+	cfg := config.AppConfig
+	return retention.Policy{
+		Days: map[string]int{
+			retention.TypeLogs:     cfg.RetentionLogsDays,
+			retention.TypeFindings: cfg.RetentionFindingsDays,
+			retention.TypeSessions: cfg.RetentionSessionsDays,
+			retention.TypeMessages: cfg.RetentionMessagesDays,
+		},
+		MaxDiskBytes: int64(cfg.RetentionMaxDiskMB) * 1024 * 1024,
+	}
+}
+
+// reportRetention notifies clients of a run that purged something or failed.
+func reportRetention(report retention.Report) {
+	types := make([]string, 0, len(report.Purged))
+	for t := range report.Purged {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	parts := make([]string, 0, len(types))
+	for _, t := range types {
+		parts = append(parts, fmt.Sprintf("%d %s (%d bytes)", report.Purged[t].Count, t, report.Purged[t].Bytes))
+	}
+	summary := "Retention: nothing purged"
+	if len(parts) > 0 {
+		summary = "Retention: purged " + strings.Join(parts, ", ")
+	}
+	if report.Archive != "" {
+		summary += ", archived to " + report.Archive
+	}
+	if len(report.Errors) > 0 {
+		summary += fmt.Sprintf(", %d errors", len(report.Errors))
+	}
+	ws.BroadcastRetention(summary, report)
+}
+
+// GetRetention returns the retention policy and the reports of past runs.
+func GetRetention(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"policy":           retentionPolicy(),
+		"interval_minutes": config.AppConfig.RetentionIntervalMinutes,
+		"archive_dir":      config.AppConfig.RetentionArchiveDir,
+		"reports":          retention.Default.Reports(c.QueryInt("limit", defaultRetentionReportLimit)),
+	})
+}
+
+// PreviewRetention reports what a run would purge now, without purging.
+func PreviewRetention(c *fiber.Ctx) error {
+	return c.JSON(retention.Default.Run(retentionPolicy(), retention.TriggerManual, true))
+}
+
+// RunRetention purges what the policy no longer keeps now.
+func RunRetention(c *fiber.Ctx) error {
+	return c.JSON(retention.Default.Run(retentionPolicy(), retention.TriggerManual, false))
+}
+
+// logSource purges the .log files in the log directory.
+type logSource struct{}
+
+func (logSource) Type() string { return retention.TypeLogs }
+
+func (logSource) Items() ([]retention.Item, error) {
+	entries, err := os.ReadDir(config.AppConfig.LogDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	items := make([]retention.Item, 0)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), ".log") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		items = append(items, retention.Item{
+			ID:         entry.Name(),
+			Path:       entry.Name(),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+			OnDisk:     true,
+		})
+	}
+	return items, nil
+}
+
+func (logSource) Archive(item retention.Item) ([]byte, error) {
+	file, err := resolveLogFile(item.ID)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(file)
+}
+
+func (logSource) Delete(item retention.Item) error {
+	file, err := resolveLogFile(item.ID)
+	if err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// findingSource purges findings by when they were created.
+type findingSource struct{}
+
+func (findingSource) Type() string { return retention.TypeFindings }
+
+func (findingSource) Items() ([]retention.Item, error) {
+	findings := models.Findings.GetAllFindings()
+	items := make([]retention.Item, 0, len(findings))
+	for _, finding := range findings {
+		data, _ := json.MarshalIndent(finding, "", "  ")
+		items = append(items, retention.Item{
+			ID:         finding.ID,
+			Parent:     finding.WorkspaceID,
+			Path:       path.Join(models.WorkspaceDir(finding.WorkspaceID), finding.ID+".json"),
+			Size:       int64(len(data)),
+			ModifiedAt: finding.CreatedAt,
+			OnDisk:     true,
+		})
+	}
+	return items, nil
+}
+
+func (findingSource) Archive(item retention.Item) ([]byte, error) {
+	finding := models.Findings.GetFinding(item.ID)
+	if finding == nil {
+		return nil, fmt.Errorf("finding not found")
+	}
+	return json.MarshalIndent(finding, "", "  ")
+}
+
+func (findingSource) Delete(item retention.Item) error {
+	if !models.Findings.DeleteFinding(item.ID) {
+		return fmt.Errorf("finding not found")
+	}
+	return nil
+}
+
+// sessionSource purges saved sessions and snapshots by when they were last
+// updated.
+type sessionSource struct{}
+
+func (sessionSource) Type() string { return retention.TypeSessions }
+
+func (sessionSource) Items() ([]retention.Item, error) {
+	sessions, err := repo.Sessions.List()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]retention.Item, 0, len(sessions))
+	for _, session := range sessions {
+		data, _ := json.Marshal(session)
+		items = append(items, retention.Item{
+			ID:         session.ID,
+			Parent:     session.OperationID,
+			Path:       session.ID + ".json",
+			Size:       int64(len(data)),
+			ModifiedAt: session.UpdatedAt,
+		})
+	}
+	return items, nil
+}
+
+func (sessionSource) Archive(item retention.Item) ([]byte, error) {
+	session := findSession(item.ID)
+	if session == nil {
+		return nil, fmt.Errorf("session not found")
+	}
+	return json.MarshalIndent(session, "", "  ")
+}
+
+func (sessionSource) Delete(item retention.Item) error {
+	return repo.Sessions.Delete(item.ID)
+}
+
+// messageSource purges the messages of agents that are no longer active.
+type messageSource struct{}
+
+func (messageSource) Type() string { return retention.TypeMessages }
+
+func (messageSource) Items() ([]retention.Item, error) {
+	items := make([]retention.Item, 0)
+	for _, agent := range models.Manager.GetAllAgents() {
+		if agent.Active() {
+			continue
+		}
+		for _, msg := range models.Manager.GetMessages(agent.ID) {
+			items = append(items, retention.Item{
+				ID:         msg.ID,
+				Parent:     agent.ID,
+				Path:       path.Join(agent.ID, msg.ID+".json"),
+				Size:       int64(len(msg.Content)),
+				ModifiedAt: msg.Timestamp,
+			})
+		}
+	}
+	return items, nil
+}
+
+func (messageSource) Archive(item retention.Item) ([]byte, error) {
+	for _, msg := range models.Manager.GetMessages(item.Parent) {
+		if msg.ID == item.ID {
+			return json.MarshalIndent(msg, "", "  ")
+		}
+	}
+	return nil, fmt.Errorf("message not found")
+}
+
+func (messageSource) Delete(item retention.Item) error {
+	if !models.Manager.DeleteMessage(item.Parent, item.ID) {
+		return fmt.Errorf("message not found or agent active")
+	}
+	return nil
+}
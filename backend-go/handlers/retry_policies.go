@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"performa-backend/apierror"
+	"performa-backend/failures"
+	"performa-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// InitRetryPolicies loads the global retry policies.
+func InitRetryPolicies() {
+	failures.Default.Load()
+}
+
+// GetRetryPolicies returns the global retry policy of every error class and
+// which of them were set rather than defaulted. Operations override them
+// through retry_policies in their start request.
+func GetRetryPolicies(c *fiber.Ctx) error {
+	policies, custom := failures.Default.All()
+	return c.JSON(fiber.Map{
+		"policies": policies,
+		"custom":   custom,
+		"defaults": failures.Defaults,
+		"classes":  failures.Classes,
+	})
+}
+
+func UpdateRetryPolicy(c *fiber.Ctx) error {
+	class := c.Params("class")
+	if !failures.Known(class) {
+		return apierror.New(404, apierror.NotFound, "Unknown error class").With("class", class)
+	}
+	var policy failures.Policy
+	if err := parseBody(c, &policy); err != nil {
+		return err
+	}
+
+	updated, err := failures.Default.Set(class, policy)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid retry policy").With("class", class).WithReason(err)
+	}
+	return c.JSON(fiber.Map{
+		"class":  class,
+		"policy": updated,
+	})
+}
+
+// ResetRetryPolicy returns an error class to its default policy.
+func ResetRetryPolicy(c *fiber.Ctx) error {
+	class := c.Params("class")
+	if !failures.Known(class) {
+		return apierror.New(404, apierror.NotFound, "Unknown error class").With("class", class)
+	}
+	failures.Default.Reset(class)
+	return c.JSON(fiber.Map{
+		"class":  class,
+		"policy": failures.Default.Get(class),
+	})
+}
+
+// GetAgentFailures returns the classified errors the agent ran into, oldest
+// first, and the class it failed with, if it did.
+func GetAgentFailures(c *fiber.Ctx) error {
+	id := c.Params("id")
+	agent := models.Manager.GetAgent(id)
+	if agent == nil {
+		return apierror.New(404, apierror.NotFound, "Agent not found")
+	}
+	list := models.Manager.GetFailures(id)
+	return c.JSON(fiber.Map{
+		"failures":    list,
+		"error_class": agent.ErrorClass,
+		"total":       len(list),
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"performa-backend/models"
+	"performa-backend/workspaces"
+	"performa-backend/ws"
+)
+
+// checkStartRoE validates the request's rules of engagement and checks the
+// launch against them. A launch breaking any rule is refused with a
+// *StartError; each violation is logged and broadcast to the workspace.
+func checkStartRoE(req models.StartRequest, targetList []string, source string) error {
+	if req.RoE == nil {
+		return nil
+	}
+	if err := req.RoE.Validate(); err != nil {
+		return &StartError{"Invalid rules of engagement", err}
+	}
+
+	violations := req.RoE.CheckStart(req, targetList, time.Now())
+	if len(violations) == 0 {
+		return nil
+	}
+	reasons := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		log.Printf("RoE: refused %s launch against %s: %s", source, req.Target, violation.Reason)
+		ws.BroadcastRoEViolation(workspaces.Normalize(req.WorkspaceID), "", violation)
+		reasons = append(reasons, violation.Reason)
+	}
+	return &StartError{"Rules of engagement violated", fmt.Errorf("%s", strings.Join(reasons, "; "))}
+}
+
+// reportRoEViolation records a violation on the operation, logs it and
+// broadcasts it to the operation's workspace.
+func reportRoEViolation(operationID, workspace string, violation models.RoEViolation) {
+	log.Printf("RoE: operation %s, agent %s: %s", operationID, violation.AgentID, violation.Reason)
+	models.Operations.AddRoEViolation(operationID, violation)
+	ws.BroadcastRoEViolation(workspace, operationID, violation)
+}
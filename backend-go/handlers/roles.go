@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"performa-backend/apierror"
+	"performa-backend/prompts"
+	"performa-backend/roles"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RoleRequest struct {
+	Name             string    `json:"name"`
+	Description      *string   `json:"description"`
+	PromptTemplateID *string   `json:"prompt_template_id"`
+	ToolCategories   *[]string `json:"tool_categories"`
+}
+
+func GetRoles(c *fiber.Ctx) error {
+	all := roles.Default.GetAll()
+	return c.JSON(fiber.Map{
+		"roles": all,
+		"total": len(all),
+	})
+}
+
+func GetRole(c *fiber.Ctx) error {
+	role := roles.Default.Get(c.Params("id"))
+	if role == nil {
+		return apierror.New(404, apierror.NotFound, "Role not found")
+	}
+	return c.JSON(role)
+}
+
+func CreateRole(c *fiber.Ctx) error {
+	var req RoleRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.Name == "" {
+		return apierror.New(400, apierror.ValidationFailed, "name is required")
+	}
+
+	var description, templateID string
+	var categories []string
+	if req.Description != nil {
+		description = *req.Description
+	}
+	if req.PromptTemplateID != nil {
+		templateID = *req.PromptTemplateID
+	}
+	if req.ToolCategories != nil {
+		categories = *req.ToolCategories
+	}
+
+	if templateID != "" && prompts.Default.Get(templateID) == nil {
+		return apierror.New(404, apierror.NotFound, "Prompt template not found")
+	}
+
+	role, err := roles.Default.Create(req.Name, description, templateID, categories)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid role").WithReason(err)
+	}
+
+	return c.Status(201).JSON(role)
+}
+
+func UpdateRole(c *fiber.Ctx) error {
+	var req RoleRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	id := c.Params("id")
+	if role := roles.Default.Get(id); role != nil && role.BuiltIn {
+		return apierror.New(400, apierror.ValidationFailed, "Built-in roles cannot be modified")
+	}
+
+	if req.PromptTemplateID != nil && *req.PromptTemplateID != "" && prompts.Default.Get(*req.PromptTemplateID) == nil {
+		return apierror.New(404, apierror.NotFound, "Prompt template not found")
+	}
+
+	role, err := roles.Default.Update(id, func(r *roles.Role) error {
+		if req.Name != "" {
+			r.Name = req.Name
+		}
+		if req.Description != nil {
+			r.Description = *req.Description
+		}
+		if req.PromptTemplateID != nil {
+			r.PromptTemplateID = *req.PromptTemplateID
+		}
+		if req.ToolCategories != nil {
+			r.ToolCategories = *req.ToolCategories
+		}
+		return nil
+	})
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid role").WithReason(err)
+	}
+	if role == nil {
+		return apierror.New(404, apierror.NotFound, "Role not found")
+	}
+	return c.JSON(role)
+}
+
+func DeleteRole(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if role := roles.Default.Get(id); role != nil && role.BuiltIn {
+		return apierror.New(400, apierror.ValidationFailed, "Built-in roles cannot be deleted")
+	}
+
+	if !roles.Default.Delete(id) {
+		return apierror.New(404, apierror.NotFound, "Role not found")
+	}
+	return c.JSON(fiber.Map{
+		"status":  "deleted",
+		"message": "Role deleted successfully",
+	})
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/rules"
+	"performa-backend/suppressions"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultRuleTestLimit = 200
+	maxRuleTestLimit     = 1000
+)
+
+// RuleRequest creates or updates a finding rule. On update, omitted fields
+// are left unchanged.
+type RuleRequest struct {
+	Name       *string           `json:"name"`
+	Enabled    *bool             `json:"enabled"`
+	Conditions *rules.Conditions `json:"conditions"`
+	Actions    []rules.Action    `json:"actions"`
+	Stop       *bool             `json:"stop"`
+}
+
+func (req *RuleRequest) apply(rule *rules.Rule) {
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.Conditions != nil {
+		rule.Conditions = *req.Conditions
+	}
+	if req.Actions != nil {
+		rule.Actions = req.Actions
+	}
+	if req.Stop != nil {
+		rule.Stop = *req.Stop
+	}
+}
+
+// RuleOrderRequest lists rules in the order they should run.
+type RuleOrderRequest struct {
+	IDs []string `json:"ids" validate:"required,min=1"`
+}
+
+// RuleTestRequest dry-runs rules. Rule tests an unsaved rule and RuleID a
+// stored one; without either the workspace's enabled rules are tested in
+// order. The rules run against Finding, a sample, or the stored finding
+// FindingID, or else the workspace's latest findings up to Limit.
+type RuleTestRequest struct {
+	Rule      *RuleRequest    `json:"rule"`
+	RuleID    string          `json:"rule_id"`
+	Finding   *models.Finding `json:"finding"`
+	FindingID string          `json:"finding_id"`
+	Limit     int             `json:"limit"`
+}
+
+// RuleTestResult is what the tested rules would do to one finding.
+type RuleTestResult struct {
+	FindingID string         `json:"finding_id,omitempty"`
+	Title     string         `json:"title"`
+	Severity  string         `json:"severity"`
+	Changes   []rules.Change `json:"changes"`
+}
+
+// InitRules loads the finding rules and applies them, after the suppression
+// register, to findings as they are stored.
+func InitRules() {
+	rules.Default.Load()
+	models.Findings.SetProcessor(processFinding)
+}
+
+// processFinding suppresses a newly reported finding matching an accepted
+// risk, then applies the rules to it.
+func processFinding(before, finding *models.Finding) {
+	suppressions.Default.Apply(before, finding)
+	rules.Evaluate(before, finding)
+}
+
+func GetRules(c *fiber.Ctx) error {
+	list := rules.Default.List(currentWorkspace(c))
+	return c.JSON(fiber.Map{
+		"rules": list,
+		"total": len(list),
+	})
+}
+
+func GetRule(c *fiber.Ctx) error {
+	rule, err := workspaceRule(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(rule)
+}
+
+// CreateRule adds a rule after the workspace's other rules.
+func CreateRule(c *fiber.Ctx) error {
+	var req RuleRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	rule := rules.Rule{WorkspaceID: currentWorkspace(c), Enabled: true}
+	req.apply(&rule)
+	created, err := rules.Default.Create(rule)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid rule").WithReason(err)
+	}
+	return c.Status(201).JSON(created)
+}
+
+func UpdateRule(c *fiber.Ctx) error {
+	var req RuleRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if _, err := workspaceRule(c, c.Params("id")); err != nil {
+		return err
+	}
+
+	updated, err := rules.Default.Update(c.Params("id"), req.apply)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid rule").WithReason(err)
+	}
+	if updated == nil {
+		return apierror.New(404, apierror.NotFound, "Rule not found")
+	}
+	return c.JSON(updated)
+}
+
+func DeleteRule(c *fiber.Ctx) error {
+	if _, err := workspaceRule(c, c.Params("id")); err != nil {
+		return err
+	}
+	rules.Default.Delete(c.Params("id"))
+	return c.JSON(fiber.Map{
+		"message": "Rule deleted",
+	})
+}
+
+// ReorderRules sets the order the workspace's rules run in. Rules left out
+// of the list run after the listed ones, in their current order.
+func ReorderRules(c *fiber.Ctx) error {
+	var req RuleOrderRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	list, err := rules.Default.Reorder(currentWorkspace(c), req.IDs)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid rule order").WithReason(err)
+	}
+	return c.JSON(fiber.Map{
+		"rules": list,
+		"total": len(list),
+	})
+}
+
+// TestRules reports what rules would do to findings as they are created,
+// without changing the findings or sending notifications.
+func TestRules(c *fiber.Ctx) error {
+	var req RuleTestRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	workspaceID := currentWorkspace(c)
+
+	var tested []*rules.Rule
+	switch {
+	case req.Rule != nil:
+		rule := rules.Rule{ID: "dry-run", WorkspaceID: workspaceID, Enabled: true}
+		req.Rule.apply(&rule)
+		if err := rule.Validate(); err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Invalid rule").WithReason(err)
+		}
+		tested = []*rules.Rule{&rule}
+	case req.RuleID != "":
+		rule, err := workspaceRule(c, req.RuleID)
+		if err != nil {
+			return err
+		}
+		tested = []*rules.Rule{rule}
+	default:
+		tested = rules.Default.Enabled(workspaceID)
+	}
+
+	var findings []*models.Finding
+	switch {
+	case req.Finding != nil:
+		req.Finding.WorkspaceID = workspaceID
+		if req.Finding.Status == "" {
+			req.Finding.Status = "new"
+		}
+		findings = []*models.Finding{req.Finding}
+	case req.FindingID != "":
+		finding := models.Findings.GetFinding(req.FindingID)
+		if finding == nil || !inWorkspace(c, finding.WorkspaceID) {
+			return apierror.New(404, apierror.NotFound, "Finding not found").With("finding_id", req.FindingID)
+		}
+		findings = []*models.Finding{finding}
+	default:
+		limit := req.Limit
+		if limit <= 0 {
+			limit = defaultRuleTestLimit
+		}
+		if limit > maxRuleTestLimit {
+			limit = maxRuleTestLimit
+		}
+		findings, _ = models.Findings.Query(models.FindingFilter{
+			WorkspaceID: workspaceID,
+			SortBy:      "created_at",
+			SortDesc:    true,
+			Limit:       limit,
+		})
+	}
+
+	results := make([]RuleTestResult, 0)
+	for _, finding := range findings {
+		changes := rules.DryRun(tested, finding)
+		if len(changes) == 0 {
+			continue
+		}
+		results = append(results, RuleTestResult{
+			FindingID: finding.ID,
+			Title:     finding.Title,
+			Severity:  string(finding.Severity),
+			Changes:   changes,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"rules":     len(tested),
+		"evaluated": len(findings),
+		"matched":   len(results),
+		"results":   results,
+	})
+}
+
+func workspaceRule(c *fiber.Ctx, id string) (*rules.Rule, error) {
+	rule := rules.Default.Get(id)
+	if rule == nil || !inWorkspace(c, rule.WorkspaceID) {
+		return nil, apierror.New(404, apierror.NotFound, "Rule not found").With("rule_id", id)
+	}
+	return rule, nil
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/telemetry"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// recentGCPauses is how many of the latest GC pauses the runtime report lists.
+const recentGCPauses = 10
+
+// agentTask is a running agent goroutine, kept so leaked or stuck
+// conversations show up in /api/admin/runtime.
+type agentTask struct {
+	AgentID     string    `json:"agent_id"`
+	OperationID string    `json:"operation_id,omitempty"`
+	Kind        string    `json:"kind"`
+	StartedAt   time.Time `json:"started_at"`
+	RunningSecs float64   `json:"running_seconds"`
+}
+
+var (
+	agentTasks   = make(map[string]*agentTask)
+	agentTasksMu sync.Mutex
+)
+
+// trackAgentTask registers a goroutine working on agentID and returns the
+// function that unregisters it.
+func trackAgentTask(agentID, operationID, kind string) func() {
+	task := &agentTask{AgentID: agentID, OperationID: operationID, Kind: kind, StartedAt: time.Now()}
+	agentTasksMu.Lock()
+	agentTasks[agentID] = task
+	agentTasksMu.Unlock()
+
+	return func() {
+		agentTasksMu.Lock()
+		defer agentTasksMu.Unlock()
+		if agentTasks[agentID] == task {
+			delete(agentTasks, agentID)
+		}
+	}
+}
+
+func runningAgentTasks() []agentTask {
+	agentTasksMu.Lock()
+	tasks := make([]agentTask, 0, len(agentTasks))
+	for _, task := range agentTasks {
+		copied := *task
+		copied.RunningSecs = time.Since(task.StartedAt).Seconds()
+		tasks = append(tasks, copied)
+	}
+	agentTasksMu.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].StartedAt.Before(tasks[j].StartedAt) })
+	return tasks
+}
+
+func monitoredAgentIDs() []string {
+	ids := make([]string, 0)
+	monitoredAgents.Range(func(key, _ interface{}) bool {
+		ids = append(ids, key.(string))
+		return true
+	})
+	sort.Strings(ids)
+	return ids
+}
+
+// GetRuntime reports goroutine, heap and GC statistics along with the open
+// WebSocket connections, the agent goroutines currently running and the
+// latest panics recovered from them.
+func GetRuntime(c *fiber.Ctx) error {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	pauses := make([]float64, 0, recentGCPauses)
+	for i := 0; i < recentGCPauses && uint32(i) < mem.NumGC; i++ {
+		idx := (int(mem.NumGC) - 1 - i + len(mem.PauseNs)) % len(mem.PauseNs)
+		pauses = append(pauses, float64(mem.PauseNs[idx])/1e6)
+	}
+
+	var lastGC *time.Time
+	if mem.LastGC > 0 {
+		t := time.Unix(0, int64(mem.LastGC))
+		lastGC = &t
+	}
+
+	return c.JSON(fiber.Map{
+		"go_version":     runtime.Version(),
+		"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+		"cpus":           runtime.NumCPU(),
+		"heap": fiber.Map{
+			"alloc_bytes":    mem.HeapAlloc,
+			"inuse_bytes":    mem.HeapInuse,
+			"idle_bytes":     mem.HeapIdle,
+			"released_bytes": mem.HeapReleased,
+			"objects":        mem.HeapObjects,
+			"sys_bytes":      mem.Sys,
+		},
+		"gc": fiber.Map{
+			"count":            mem.NumGC,
+			"pause_total_ms":   float64(mem.PauseTotalNs) / 1e6,
+			"recent_pauses_ms": pauses,
+			"last_gc":          lastGC,
+			"cpu_fraction":     mem.GCCPUFraction,
+			"next_gc_bytes":    mem.NextGC,
+		},
+		"websocket": ws.MainHub.Stats(),
+		"agents": fiber.Map{
+			"tasks":             runningAgentTasks(),
+			"resource_monitors": monitoredAgentIDs(),
+			"panics":            recentAgentPanics(),
+		},
+	})
+}
+
+// GetWSClients lists the WebSocket connections to this instance with who
+// made them, what they watch and when they were last active. ?workspace=
+// limits the list to one workspace.
+func GetWSClients(c *fiber.Ctx) error {
+	clients := ws.MainHub.Clients()
+	if workspace := c.Query("workspace"); workspace != "" {
+		filtered := make([]ws.ClientInfo, 0, len(clients))
+		for _, client := range clients {
+			if client.Workspace == workspace {
+				filtered = append(filtered, client)
+			}
+		}
+		clients = filtered
+	}
+	return c.JSON(fiber.Map{"clients": clients, "count": len(clients)})
+}
+
+// DisconnectWSClient force-disconnects a WebSocket connection by the ID the
+// hub gave it. ?reason= is passed on to the client.
+func DisconnectWSClient(c *fiber.Ctx) error {
+	id := c.Params("id")
+	reason := strings.TrimSpace(c.Query("reason"))
+	if reason == "" {
+		reason = "Disconnected by an administrator"
+	}
+
+	target, ok := ws.MainHub.Disconnect(id, reason)
+	if !ok {
+		return apierror.New(404, apierror.NotFound, "WebSocket client not found").With("id", id)
+	}
+
+	actor := "admin"
+	if user := currentUser(c); user != nil {
+		actor = user.Username
+	}
+	telemetry.Emit(telemetry.Event{
+		Category:  telemetry.CategoryAuth,
+		Action:    "ws_disconnect",
+		Severity:  4,
+		Outcome:   telemetry.OutcomeSuccess,
+		Actor:     actor,
+		SourceIP:  c.IP(),
+		Workspace: target.Workspace,
+		Message:   "WebSocket client disconnected: " + reason,
+		Fields: map[string]string{
+			"client_id":   target.ID,
+			"client_user": target.Identity.Username,
+			"client_addr": target.RemoteAddr,
+		},
+	})
+	return c.JSON(fiber.Map{"disconnected": target})
+}
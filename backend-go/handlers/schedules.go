@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"fmt"
+
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/scheduler"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ScheduleRequest struct {
+	Name     string `json:"name"`
+	ConfigID string `json:"config_id"`
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+// InitScheduler wires the scheduler to launchOperation and starts dispatching.
+func InitScheduler() {
+	scheduler.Default.SetDispatcher(dispatchSchedule)
+	scheduler.Default.OnTick(enforceBlackouts)
+	scheduler.Default.Start()
+}
+
+func dispatchSchedule(schedule *scheduler.Schedule) (string, error) {
+	config := resolveSavedConfig(schedule.ConfigID)
+	if config == nil {
+		return "", fmt.Errorf("saved config %s not found", schedule.ConfigID)
+	}
+
+	req := startRequestFromSavedConfig(config)
+	if req.Target == "" {
+		return "", fmt.Errorf("saved config %s has no target", schedule.ConfigID)
+	}
+	if targetList, err := operationTargets(req); err == nil {
+		if err := checkStartRoE(req, targetList, "schedule:"+schedule.ID); err != nil {
+			return "", err
+		}
+	}
+
+	op, _, err := launchOperation(req, "schedule:"+schedule.ID)
+	if err != nil {
+		return "", err
+	}
+	models.Operations.SetOwner(op.ID, config.OwnerID)
+	return op.ID, nil
+}
+
+// scheduleConfigInWorkspace reports whether the saved config exists in the
+// request's workspace.
+func scheduleConfigInWorkspace(c *fiber.Ctx, configID string) bool {
+	config := resolveSavedConfig(configID)
+	return config != nil && inWorkspace(c, config.WorkspaceID)
+}
+
+// scheduleWorkspace returns the workspace of the schedule's saved config; a
+// schedule whose config is gone stays in the default workspace.
+func scheduleWorkspace(schedule *scheduler.Schedule) string {
+	if config := resolveSavedConfig(schedule.ConfigID); config != nil {
+		return config.WorkspaceID
+	}
+	return ""
+}
+
+// ScheduleInWorkspace scopes /schedules/:id routes to the schedules of the
+// request's workspace.
+var ScheduleInWorkspace = scopeToWorkspace("Schedule not found", func(id string) (string, bool) {
+	schedule := scheduler.Default.Get(id)
+	if schedule == nil {
+		return "", false
+	}
+	return scheduleWorkspace(schedule), true
+})
+
+func CreateSchedule(c *fiber.Ctx) error {
+	var req ScheduleRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.ConfigID == "" || req.Cron == "" {
+		return apierror.New(400, apierror.ValidationFailed, "config_id and cron are required")
+	}
+
+	if !scheduleConfigInWorkspace(c, req.ConfigID) {
+		return apierror.New(404, apierror.NotFound, "Config not found")
+	}
+
+	if req.Name == "" {
+		req.Name = "Scheduled " + req.ConfigID
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	schedule, err := scheduler.Default.Create(req.Name, req.ConfigID, req.Cron, req.Timezone, enabled)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid schedule").WithReason(err)
+	}
+
+	return c.Status(201).JSON(schedule)
+}
+
+func GetSchedules(c *fiber.Ctx) error {
+	schedules := make([]*scheduler.Schedule, 0)
+	for _, schedule := range scheduler.Default.GetAll() {
+		if inWorkspace(c, scheduleWorkspace(schedule)) {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"schedules": schedules,
+		"total":     len(schedules),
+	})
+}
+
+func GetSchedule(c *fiber.Ctx) error {
+	schedule := scheduler.Default.Get(c.Params("id"))
+	if schedule == nil {
+		return apierror.New(404, apierror.NotFound, "Schedule not found")
+	}
+	return c.JSON(schedule)
+}
+
+func UpdateSchedule(c *fiber.Ctx) error {
+	var req ScheduleRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.ConfigID != "" && !scheduleConfigInWorkspace(c, req.ConfigID) {
+		return apierror.New(404, apierror.NotFound, "Config not found")
+	}
+
+	schedule, err := scheduler.Default.Update(c.Params("id"), func(s *scheduler.Schedule) error {
+		if req.Name != "" {
+			s.Name = req.Name
+		}
+		if req.ConfigID != "" {
+			s.ConfigID = req.ConfigID
+		}
+		if req.Cron != "" {
+			s.CronExpr = req.Cron
+		}
+		if req.Timezone != "" {
+			s.Timezone = req.Timezone
+		}
+		if req.Enabled != nil {
+			s.Enabled = *req.Enabled
+		}
+		return nil
+	})
+	return scheduleUpdateResponse(c, schedule, err)
+}
+
+func DeleteSchedule(c *fiber.Ctx) error {
+	if !scheduler.Default.Delete(c.Params("id")) {
+		return apierror.New(404, apierror.NotFound, "Schedule not found")
+	}
+	return c.JSON(fiber.Map{
+		"status":  "deleted",
+		"message": "Schedule deleted successfully",
+	})
+}
+
+func setScheduleState(c *fiber.Ctx, fn func(s *scheduler.Schedule)) error {
+	schedule, err := scheduler.Default.Update(c.Params("id"), func(s *scheduler.Schedule) error {
+		fn(s)
+		return nil
+	})
+	return scheduleUpdateResponse(c, schedule, err)
+}
+
+func scheduleUpdateResponse(c *fiber.Ctx, schedule *scheduler.Schedule, err error) error {
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid schedule").WithReason(err)
+	}
+	if schedule == nil {
+		return apierror.New(404, apierror.NotFound, "Schedule not found")
+	}
+	return c.JSON(schedule)
+}
+
+func EnableSchedule(c *fiber.Ctx) error {
+	return setScheduleState(c, func(s *scheduler.Schedule) { s.Enabled = true })
+}
+
+func DisableSchedule(c *fiber.Ctx) error {
+	return setScheduleState(c, func(s *scheduler.Schedule) { s.Enabled = false })
+}
+
+func PauseSchedule(c *fiber.Ctx) error {
+	return setScheduleState(c, func(s *scheduler.Schedule) { s.Paused = true })
+}
+
+func ResumeSchedule(c *fiber.Ctx) error {
+	return setScheduleState(c, func(s *scheduler.Schedule) { s.Paused = false })
+}
+
+func RunScheduleNow(c *fiber.Ctx) error {
+	run, err := scheduler.Default.RunNow(c.Params("id"))
+	if err != nil {
+		return apierror.New(404, apierror.NotFound, "Schedule not found")
+	}
+	if run.Status == scheduler.RunStatusFailed {
+		return apierror.New(422, apierror.ValidationFailed, "Scheduled run failed to start").With("run", run)
+	}
+	return c.JSON(run)
+}
+
+func GetScheduleRuns(c *fiber.Ctx) error {
+	schedule := scheduler.Default.Get(c.Params("id"))
+	if schedule == nil {
+		return apierror.New(404, apierror.NotFound, "Schedule not found")
+	}
+
+	runs := make([]scheduler.Run, len(schedule.Runs))
+	for i, run := range schedule.Runs {
+		runs[len(runs)-1-i] = run
+	}
+	return c.JSON(fiber.Map{
+		"runs":  runs,
+		"total": len(runs),
+	})
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"log"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SettingsUpdateRequest struct {
+	// Settings maps setting keys to new values; null removes an override.
+	Settings map[string]*string `json:"settings"`
+}
+
+// InitSettings applies the runtime setting overrides persisted in the
+// database over the environment configuration. It runs before the clients
+// that read the configuration are created.
+func InitSettings() {
+	stored, err := database.GetAllSettings()
+	if err != nil {
+		log.Printf("Settings: failed to load overrides: %v", err)
+		return
+	}
+
+	changes := make(map[string]*string, len(stored))
+	for key, value := range stored {
+		if !config.IsSetting(key) {
+			log.Printf("Settings: ignoring unknown stored setting %q", key)
+			continue
+		}
+		value := value
+		changes[key] = &value
+	}
+	if len(changes) == 0 {
+		return
+	}
+	if _, _, err := config.ApplyOverrides(changes); err != nil {
+		log.Printf("Settings: failed to apply stored overrides: %v", err)
+	}
+}
+
+func GetSettings(c *fiber.Ctx) error {
+	values := config.SettingValues()
+	return c.JSON(fiber.Map{
+		"settings": values,
+		"total":    len(values),
+	})
+}
+
+// UpdateSettings changes runtime settings, persists the overrides and
+// re-initializes the clients affected by the change.
+func UpdateSettings(c *fiber.Ctx) error {
+	var req SettingsUpdateRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if len(req.Settings) == 0 {
+		return apierror.New(400, apierror.ValidationFailed, "settings is required")
+	}
+
+	previous, next, err := config.ApplyOverrides(req.Settings)
+	if err != nil {
+		return apierror.New(422, apierror.ValidationFailed, "Invalid settings").WithReason(err)
+	}
+
+	for key, value := range req.Settings {
+		if value == nil {
+			err = database.DeleteSetting(key)
+		} else {
+			err = database.SaveSetting(key, config.Overrides()[key])
+		}
+		if err != nil {
+			log.Printf("Settings: failed to persist %s: %v", key, err)
+		}
+	}
+
+	reloaded := applySettingChanges(previous, next)
+
+	values := config.SettingValues()
+	return c.JSON(fiber.Map{
+		"status":   "updated",
+		"reloaded": reloaded,
+		"settings": values,
+		"total":    len(values),
+	})
+}
+
+// applySettingChanges re-initializes whatever depends on changed settings and
+// returns the names of the components it reloaded. Provider API keys and tool
+// settings are read per call and need no reload.
+func applySettingChanges(previous, next *config.Config) []string {
+	reloaded := make([]string, 0)
+
+	if previous.BrainServiceURL != next.BrainServiceURL {
+		connectBrainClient()
+		if learningFeedback != nil {
+			learningFeedback.SetClient(brainClient)
+		}
+		reloaded = append(reloaded, "brain_client")
+	}
+	if previous.BrainLearningEnabled != next.BrainLearningEnabled && learningFeedback != nil {
+		learningFeedback.SetEnabled(next.BrainLearningEnabled)
+		reloaded = append(reloaded, "brain_learning")
+	}
+	if previous.AlertCPUThreshold != next.AlertCPUThreshold ||
+		previous.AlertMemoryThreshold != next.AlertMemoryThreshold ||
+		previous.AlertDiskThreshold != next.AlertDiskThreshold ||
+		previous.AlertWebhookURL != next.AlertWebhookURL ||
+		previous.AlertSlackWebhookURL != next.AlertSlackWebhookURL {
+		InitResourceAlerts()
+		reloaded = append(reloaded, "resource_alerts")
+	}
+	if previous.OpenRouterAPIKey != next.OpenRouterAPIKey ||
+		previous.AnthropicAPIKey != next.AnthropicAPIKey ||
+		previous.OpenAIAPIKey != next.OpenAIAPIKey {
+		reloaded = append(reloaded, "provider_keys")
+	}
+
+	if len(reloaded) > 0 {
+		log.Printf("Settings: reloaded %v", reloaded)
+	}
+	return reloaded
+}
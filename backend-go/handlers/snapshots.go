@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/repo"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Snapshot sources.
+const (
+	snapshotSourceAuto   = "auto"
+	snapshotSourceFinal  = "final"
+	snapshotSourceManual = "manual"
+)
+
+// snapshotState remembers, per operation, what its last snapshot captured so
+// that ticks with nothing new store no duplicate restore points.
+var (
+	snapshotState   = make(map[string]string)
+	snapshotStateMu sync.Mutex
+)
+
+// InitSessionSnapshots starts snapshotting running operations into the
+// sessions store every SESSION_SNAPSHOT_SECONDS.
+func InitSessionSnapshots() {
+	if seconds := config.AppConfig.SessionSnapshotSeconds; seconds > 0 {
+		go runSessionSnapshots(time.Duration(seconds) * time.Second)
+	}
+}
+
+func runSessionSnapshots(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		snapshotOperations()
+	}
+}
+
+// snapshotOperations snapshots every operation that changed since its last
+// snapshot, which takes a final one of operations that finished since.
+func snapshotOperations() {
+	for _, op := range models.Operations.GetAllOperations() {
+		source := snapshotSourceAuto
+		if op.Status != models.OperationStatusRunning {
+			source = snapshotSourceFinal
+		}
+		snapshotOperation(op, source, false)
+	}
+}
+
+// snapshotOperation stores the operation's request, agents with their
+// message histories, and findings as a session, then prunes the operation's
+// older snapshots. Unless force is set, nothing is stored when the operation
+// has not changed since its last snapshot.
+func snapshotOperation(op *models.Operation, source string, force bool) *repo.Session {
+	agents := make([]sessionAgentSnapshot, 0)
+	findings := make([]*models.Finding, 0)
+	messages := 0
+	var state strings.Builder
+
+	for _, agent := range models.Manager.GetOperationAgents(op.ID) {
+		history := append([]models.AgentMessage(nil), models.Manager.GetMessages(agent.ID)...)
+		agentFindings, _ := models.Findings.Query(models.FindingFilter{AgentID: agent.ID})
+
+		agents = append(agents, sessionAgentSnapshot{Agent: *agent, Messages: history})
+		findings = append(findings, agentFindings...)
+		messages += len(history)
+		fmt.Fprintf(&state, "%s:%s:%d:%d;", agent.ID, agent.Status, len(history), len(agentFindings))
+	}
+	fmt.Fprintf(&state, "%s", op.Status)
+
+	snapshotStateMu.Lock()
+	unchanged := snapshotState[op.ID] == state.String()
+	snapshotState[op.ID] = state.String()
+	snapshotStateMu.Unlock()
+	if unchanged && !force {
+		return nil
+	}
+
+	now := time.Now()
+	session := &repo.Session{
+		ID:          uuid.New().String(),
+		Name:        fmt.Sprintf("%s snapshot of %s at %s", source, op.Target, now.UTC().Format(time.RFC3339)),
+		Config:      op.Request,
+		Agents:      agents,
+		Findings:    findings,
+		OwnerID:     op.OwnerID,
+		WorkspaceID: op.WorkspaceID,
+		OperationID: op.ID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	storeSession(session)
+	pruneOperationSnapshots(op.ID, config.AppConfig.SessionSnapshotKeep)
+
+	log.Printf("Snapshots: stored %s snapshot %s of operation %s (%d agents, %d messages, %d findings)",
+		source, session.ID, op.ID, len(agents), messages, len(findings))
+	return session
+}
+
+// operationSnapshots returns the sessions snapshotted from an operation,
+// newest first.
+func operationSnapshots(operationID string) []*repo.Session {
+	snapshots, err := repo.Sessions.ListByOperation(operationID)
+	if err != nil {
+		log.Printf("Snapshots: failed to list snapshots of operation %s: %v", operationID, err)
+		return nil
+	}
+	return snapshots
+}
+
+// pruneOperationSnapshots deletes all but the keep newest snapshots of an
+// operation. A keep of zero or less keeps every snapshot.
+func pruneOperationSnapshots(operationID string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	snapshots := operationSnapshots(operationID)
+	if len(snapshots) <= keep {
+		return
+	}
+
+	for _, session := range snapshots[keep:] {
+		if err := repo.Sessions.Delete(session.ID); err != nil {
+			log.Printf("Snapshots: failed to prune snapshot %s: %v", session.ID, err)
+		}
+	}
+}
+
+// restorePoint summarises a snapshot without its agents and findings.
+type restorePoint struct {
+	SessionID  string    `json:"session_id"`
+	Name       string    `json:"name"`
+	Agents     int       `json:"agents"`
+	Findings   int       `json:"findings"`
+	Messages   int       `json:"messages"`
+	ResumePath string    `json:"resume_path"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newRestorePoint(session *repo.Session) restorePoint {
+	point := restorePoint{
+		SessionID:  session.ID,
+		Name:       session.Name,
+		ResumePath: "/api/session/" + session.ID + "/resume",
+		CreatedAt:  session.CreatedAt,
+	}
+	var agents []sessionAgentSnapshot
+	var findings []models.Finding
+	if data, err := json.Marshal(session.Agents); err == nil {
+		json.Unmarshal(data, &agents)
+	}
+	if data, err := json.Marshal(session.Findings); err == nil {
+		json.Unmarshal(data, &findings)
+	}
+	point.Agents = len(agents)
+	point.Findings = len(findings)
+	for _, agent := range agents {
+		point.Messages += len(agent.Messages)
+	}
+	return point
+}
+
+// GetOperationSnapshots lists an operation's restore points, newest first.
+// Each resumes through POST /api/session/:id/resume.
+func GetOperationSnapshots(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Operations.GetOperation(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+
+	points := make([]restorePoint, 0)
+	for _, session := range operationSnapshots(id) {
+		points = append(points, newRestorePoint(session))
+	}
+	return c.JSON(fiber.Map{
+		"snapshots": points,
+		"total":     len(points),
+		"keep":      config.AppConfig.SessionSnapshotKeep,
+		"interval":  config.AppConfig.SessionSnapshotSeconds,
+	})
+}
+
+// CreateOperationSnapshot takes a snapshot of an operation on demand.
+func CreateOperationSnapshot(c *fiber.Ctx) error {
+	op := models.Operations.GetOperation(c.Params("id"))
+	if op == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+
+	session := snapshotOperation(op, snapshotSourceManual, true)
+	return c.Status(201).JSON(newRestorePoint(session))
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/netpriv"
+	"performa-backend/timeline"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type spoofingRequest struct {
+	Capability      string            `json:"capability" validate:"required,oneof=arp_spoof dns_spoof"`
+	Targets         []string          `json:"targets" validate:"required,min=1,dive,ip"`
+	Gateway         string            `json:"gateway" validate:"omitempty,ip"`
+	Records         map[string]string `json:"records" validate:"omitempty,dive,ip"`
+	DurationSeconds int               `json:"duration_seconds" validate:"min=0"`
+}
+
+// reportSpoofing broadcasts a spoofing session's state to its operation's
+// workspace and records on the timeline when it stopped.
+func reportSpoofing(session netpriv.Session) {
+	ws.BroadcastSpoofing(operationWorkspace(session.OperationID), session.OperationID, session)
+	if session.State == netpriv.SessionActive || session.OperationID == "" {
+		return
+	}
+	summary := fmt.Sprintf("%s session %s %s", session.Capability, session.ID, session.State)
+	if session.Error != "" {
+		summary += ": " + session.Error
+	}
+	timeline.Record(timeline.Event{
+		OperationID: session.OperationID,
+		Type:        timeline.EventStatusChanged,
+		Summary:     summary,
+		Data: map[string]interface{}{
+			"scope":      "spoofing",
+			"session_id": session.ID,
+			"capability": session.Capability,
+			"status":     session.State,
+			"stopped_by": session.StoppedBy,
+		},
+	})
+}
+
+// operationScope returns the subnets an operation's spoofing may touch: its
+// targets that are IP addresses or CIDR ranges.
+func operationScope(req models.StartRequest) []netip.Prefix {
+	var scope []netip.Prefix
+	for _, target := range append([]string{req.Target}, req.Targets...) {
+		target = strings.TrimSpace(target)
+		if prefix, err := netip.ParsePrefix(target); err == nil {
+			scope = append(scope, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(target); err == nil {
+			scope = append(scope, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return scope
+}
+
+// StartOperationSpoofing runs an ARP or DNS spoofing driver for a running
+// operation. The operation must have the capability enabled, its rules of
+// engagement must explicitly permit it, and every address must be in the
+// operation's scope and not excluded. The session is torn down when its
+// duration runs out or the operation ends.
+func StartOperationSpoofing(c *fiber.Ctx) error {
+	op := models.Operations.GetOperation(c.Params("id"))
+	if op == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+	var req spoofingRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if op.Status != models.OperationStatusRunning {
+		return apierror.New(409, apierror.Conflict, "Operation is not running")
+	}
+	if !op.Request.Capabilities.Enabled()[req.Capability] {
+		return apierror.New(403, apierror.Forbidden, "Capability not enabled for the operation").WithReason(req.Capability)
+	}
+	if !op.Request.RoE.Permits(req.Capability) {
+		violation := models.RoEViolation{
+			Rule:   models.RoERuleCapability,
+			Reason: fmt.Sprintf("capability %s is not permitted by the rules of engagement", req.Capability),
+			At:     time.Now(),
+		}
+		reportRoEViolation(op.ID, op.WorkspaceID, violation)
+		return apierror.New(403, apierror.Forbidden, "Rules of engagement violated").WithReason(violation.Reason)
+	}
+	for _, addr := range append(append([]string(nil), req.Targets...), req.Gateway) {
+		if addr != "" && op.Request.RoE.ExcludesHost(addr) {
+			violation := models.RoEViolation{
+				Rule:   models.RoERuleExcluded,
+				Reason: fmt.Sprintf("%s is an excluded host", addr),
+				At:     time.Now(),
+			}
+			reportRoEViolation(op.ID, op.WorkspaceID, violation)
+			return apierror.New(403, apierror.Forbidden, "Rules of engagement violated").WithReason(violation.Reason)
+		}
+	}
+
+	session, err := netpriv.Default.StartSpoofing(netpriv.SpoofSpec{
+		Capability: req.Capability,
+		Targets:    req.Targets,
+		Gateway:    req.Gateway,
+		Records:    req.Records,
+		Duration:   time.Duration(req.DurationSeconds) * time.Second,
+		Scope:      operationScope(op.Request),
+	}, op.ID, networkActor(c))
+	if err != nil {
+		return spoofingError(err)
+	}
+
+	timeline.Record(timeline.Event{
+		OperationID: op.ID,
+		Type:        timeline.EventOperatorAction,
+		Actor:       timeline.ActorOperator,
+		Summary:     fmt.Sprintf("%s started %s against %s until %s", session.Actor, session.Capability, strings.Join(session.Targets, ", "), session.ExpiresAt.Format(time.RFC3339)),
+		Data: map[string]interface{}{
+			"action":     "start_spoofing",
+			"session_id": session.ID,
+			"capability": session.Capability,
+			"targets":    session.Targets,
+		},
+	})
+	return c.JSON(session)
+}
+
+// GetOperationSpoofing lists an operation's spoofing sessions.
+func GetOperationSpoofing(c *fiber.Ctx) error {
+	sessions := netpriv.Default.SpoofingSessions(c.Params("id"))
+	return c.JSON(fiber.Map{"sessions": sessions, "total": len(sessions)})
+}
+
+// StopOperationSpoofing tears down one of an operation's spoofing sessions.
+func StopOperationSpoofing(c *fiber.Ctx) error {
+	session, ok := netpriv.Default.SpoofingSession(c.Params("sessionId"))
+	if !ok || session.OperationID != c.Params("id") {
+		return apierror.New(404, apierror.NotFound, "Spoofing session not found")
+	}
+	if !netpriv.Default.StopSpoofing(session.ID, networkActor(c)) {
+		return apierror.New(409, apierror.Conflict, "Spoofing session is not active")
+	}
+	session, _ = netpriv.Default.SpoofingSession(session.ID)
+	return c.JSON(session)
+}
+
+func spoofingError(err error) error {
+	switch {
+	case errors.Is(err, netpriv.ErrOutOfScope):
+		return apierror.New(403, apierror.Forbidden, "Address out of scope").WithReason(err)
+	case errors.Is(err, netpriv.ErrSessionActive):
+		return apierror.New(409, apierror.Conflict, "Spoofing session already running").WithReason(err)
+	case errors.Is(err, netpriv.ErrInvalidSpec), errors.Is(err, netpriv.ErrUnknownCapability):
+		return apierror.New(400, apierror.ValidationFailed, "Invalid spoofing session").WithReason(err)
+	case errors.Is(err, netpriv.ErrDisabled), errors.Is(err, netpriv.ErrUnsupported),
+		errors.Is(err, netpriv.ErrManagementInterface), errors.Is(err, netpriv.ErrNotTestInterface),
+		errors.Is(err, netpriv.ErrNoTestInterface):
+		return networkError(err)
+	}
+	return apierror.New(500, apierror.Internal, "Failed to start spoofing").WithReason(err)
+}
@@ -1,35 +1,193 @@
 package handlers
 
 import (
+        "context"
+        "errors"
         "fmt"
+        "log"
         "math/rand"
+
+        "performa-backend/apierror"
+        "performa-backend/config"
+        "performa-backend/executor"
+        "performa-backend/failures"
         "performa-backend/models"
+        "performa-backend/netpriv"
+        "performa-backend/nuclei"
         "performa-backend/openrouter"
+        "performa-backend/osint"
+        "performa-backend/policy"
+        "performa-backend/prompts"
+        "performa-backend/provider"
+        "performa-backend/roles"
+        "performa-backend/stealth"
+        "performa-backend/timeline"
         "performa-backend/tools"
+        "performa-backend/validation"
+        "performa-backend/wordlists"
         "performa-backend/ws"
         "strings"
+        "sync"
         "time"
 
         "github.com/gofiber/fiber/v2"
 )
 
+var errAgentStopped = errors.New("agent was stopped")
+
+const (
+        maxCommandsPerStep    = 3
+        maxToolOutputInPrompt = 8000
+        maxAgentsPerOperation = 50
+)
+
 func StartOperation(c *fiber.Ctx) error {
         var req models.StartRequest
-        if err := c.BodyParser(&req); err != nil {
-                return c.Status(400).JSON(fiber.Map{
-                        "error": "Invalid request body",
-                })
+        if err := parseBody(c, &req); err != nil {
+                return err
         }
 
-        if req.Target == "" {
-                return c.Status(400).JSON(fiber.Map{
-                        "error": "Target is required",
-                })
+        if err := checkMacSpoofing(c, req); err != nil {
+                return err
+        }
+
+        req.WorkspaceID = currentWorkspace(c)
+        op, agents, err := LaunchOperation(req, "api")
+        var invalid *StartError
+        if errors.As(err, &invalid) {
+                return apierror.New(400, apierror.ValidationFailed, invalid.Summary).WithReason(invalid.Err.Error())
+        }
+        models.Operations.SetOwner(op.ID, currentUserID(c))
+
+        return c.JSON(fiber.Map{
+                "message":       "Operation started successfully",
+                "operation_id":  op.ID,
+                "plan":          models.Operations.GetPlan(op.ID),
+                "agents":        agents,
+                "target":        op.Request.Target,
+                "model":         op.Request.Model,
+                "stealth_mode":  op.Request.StealthMode,
+                "tools_enabled": len(op.Request.RequestedTools),
+                "warnings":      op.Warnings,
+        })
+}
+
+// LaunchOperation validates req and launches it like POST /api/start does,
+// for callers outside the HTTP API. It fails with a *StartError.
+func LaunchOperation(req models.StartRequest, source string) (*models.Operation, []*models.Agent, error) {
+        if problems := validation.Struct(req); len(problems) > 0 {
+                return nil, nil, &StartError{"Invalid request", validation.Join(problems)}
+        }
+
+        checked := req
+        applyStartDefaults(&checked)
+        targetList, err := operationTargets(checked)
+        if err == nil {
+                _, err = allocateTargets(targetList, checked.AgentCount, checked.TargetAllocation)
+        }
+        if err != nil {
+                return nil, nil, &StartError{"Invalid targets", err}
+        }
+
+        if incompatible := tools.Incompatible(req.RequestedTools, executor.OS()); len(incompatible) > 0 {
+                return nil, nil, &StartError{"Requested tools incompatible with the execution environment",
+                        fmt.Errorf("%s not available on %s", strings.Join(incompatible, ", "), executor.OS())}
+        }
+
+        if _, _, err := runnableRequestedTools(req); err != nil {
+                return nil, nil, &StartError{"Requested tools unavailable", err}
+        }
+
+        if _, err := roles.Default.Assign(req.Roles, 1); err != nil {
+                return nil, nil, &StartError{"Invalid roles", err}
+        }
+
+        if err := validateCredentialSelection(req.Credentials); err != nil {
+                return nil, nil, &StartError{"Invalid credentials", err}
+        }
+
+        if _, err := policy.Compile(req.CommandPolicy); err != nil {
+                return nil, nil, &StartError{"Invalid command policy", err}
+        }
+
+        if req.Nuclei != nil && !req.Nuclei.Empty() {
+                if _, _, err := nuclei.Default.Pin(*req.Nuclei); err != nil {
+                        return nil, nil, &StartError{"Invalid nuclei templates", err}
+                }
+        }
+
+        if err := validateWordlistSelection(req.Wordlists); err != nil {
+                return nil, nil, &StartError{"Invalid wordlists", err}
         }
 
+        if req.OSINTLookup && len(osint.Default.Configured(req.Credentials)) == 0 {
+                return nil, nil, &StartError{"OSINT lookup unavailable", osint.ErrNoProviders}
+        }
+
+        if req.Budget != nil {
+                if err := req.Budget.Validate(); err != nil {
+                        return nil, nil, &StartError{"Invalid budget", err}
+                }
+        }
+
+        if err := req.RetryPolicies.Validate(); err != nil {
+                return nil, nil, &StartError{"Invalid retry policies", err}
+        }
+        if req.Blackout != nil {
+                if err := req.Blackout.Validate(); err != nil {
+                        return nil, nil, &StartError{"Invalid blackout", err}
+                }
+        }
+
+        if wantsMacSpoofing(req) {
+                if err := netpriv.Default.CheckSpoof(""); err != nil {
+                        return nil, nil, &StartError{"MAC spoofing unavailable", err}
+                }
+        }
+
+        if err := checkStartRoE(checked, targetList, source); err != nil {
+                return nil, nil, err
+        }
+
+        op, agents, err := launchOperation(req, source)
+        if err != nil {
+                return nil, nil, &StartError{"Invalid stealth configuration", err}
+        }
+        return op, agents, nil
+}
+
+// StartError reports why an operation could not be launched: Summary says
+// which part of the request was invalid and Err gives the details.
+type StartError struct {
+        Summary string
+        Err     error
+}
+
+func (e *StartError) Error() string { return e.Summary + ": " + e.Err.Error() }
+func (e *StartError) Unwrap() error { return e.Err }
+
+// runnableRequestedTools drops requested tools that are not installed. An
+// operation restricted to its requested tools fails when none of them are, as
+// it would otherwise fall back to every allowed tool.
+func runnableRequestedTools(req models.StartRequest) ([]string, []string, error) {
+        if executor.Backend() == executor.BackendDocker {
+                // Tools run inside the sandbox images, not on this host.
+                return req.RequestedTools, nil, nil
+        }
+        runnable, missing := tools.Runnable(req.RequestedTools)
+        if req.AllowedToolsOnly && len(req.RequestedTools) > 0 && len(runnable) == 0 {
+                return nil, nil, fmt.Errorf("none of the requested tools are installed: %s", strings.Join(missing, ", "))
+        }
+        return runnable, missing, nil
+}
+
+func applyStartDefaults(req *models.StartRequest) {
         if req.AgentCount <= 0 {
                 req.AgentCount = 3
         }
+        if req.AgentCount > maxAgentsPerOperation {
+                req.AgentCount = maxAgentsPerOperation
+        }
 
         if req.Model == "" {
                 req.Model = "anthropic/claude-3.5-sonnet"
@@ -38,6 +196,56 @@ func StartOperation(c *fiber.Ctx) error {
         if req.OSType == "" {
                 req.OSType = "linux"
         }
+}
+
+// launchOperation creates an operation for req, spawns its agents and starts
+// their task goroutines. source records who started it ("api", "schedule:<id>").
+func launchOperation(req models.StartRequest, source string) (*models.Operation, []*models.Agent, error) {
+        applyStartDefaults(&req)
+
+        targetList, err := operationTargets(req)
+        if err != nil {
+                return nil, nil, err
+        }
+        if len(req.Targets) > 0 {
+                req.Targets = targetList
+                if req.TargetAllocation == "" {
+                        req.TargetAllocation = TargetAllocationShard
+                }
+                if req.Target == "" {
+                        req.Target = summarizeTargets(targetList)
+                }
+        }
+
+        route, err := buildRoute(req)
+        if err != nil {
+                return nil, nil, err
+        }
+
+        agentTargets, err := allocateTargets(targetList, req.AgentCount, req.TargetAllocation)
+        if err != nil {
+                return nil, nil, err
+        }
+
+        runnableTools, missingTools, err := runnableRequestedTools(req)
+        if err != nil {
+                return nil, nil, err
+        }
+        req.RequestedTools = runnableTools
+
+        var nucleiWarning string
+        if req.Nuclei != nil && !req.Nuclei.Empty() {
+                pinned, warning, err := nuclei.Default.Pin(*req.Nuclei)
+                if err != nil {
+                        return nil, nil, err
+                }
+                req.Nuclei, nucleiWarning = &pinned, warning
+        }
+
+        agentRoles, err := roles.Default.Assign(req.Roles, len(agentTargets))
+        if err != nil {
+                return nil, nil, err
+        }
 
         agentConfig := models.AgentConfig{
                 StealthMode:      req.StealthMode,
@@ -47,83 +255,237 @@ func StartOperation(c *fiber.Ctx) error {
                 StealthOptions:   req.StealthOptions,
                 Capabilities:     req.Capabilities,
                 OSType:           req.OSType,
+                Limits:           agentLimits(req.Limits),
         }
 
-        agents := make([]*models.Agent, 0)
-        roles := []string{"Scanner", "Analyzer", "Reporter", "Exploiter", "Validator"}
+        op := models.Operations.CreateOperation(req, source)
+        timeline.Record(timeline.Event{
+                OperationID: op.ID,
+                Type:        timeline.EventStatusChanged,
+                Summary:     fmt.Sprintf("Operation started against %s", req.Target),
+                Data:        map[string]interface{}{"scope": "operation", "status": op.Status, "source": op.Source},
+        })
+        if route != nil {
+                stealth.SetRoute(op.ID, route)
+        }
+        if route.Enabled() {
+                go checkOperationRoute(op.ID, route)
+        }
+        pacer := buildPacer(req)
+        if pacer != nil {
+                stealth.SetPacer(op.ID, pacer)
+        }
+        if padder := buildPadder(req, route, pacer); padder != nil {
+                stealth.SetPadder(op.ID, padder)
+        }
+        if wantsMacSpoofing(req) {
+                spoofOperationMAC(op)
+        }
+
+        recordTargetAssets(op.ID, targetList)
+        if len(missingTools) > 0 {
+                warning := fmt.Sprintf("Requested tools not installed on this host, agents will not use them: %s", strings.Join(missingTools, ", "))
+                models.Operations.AddWarning(op.ID, warning)
+                ws.BroadcastWorkspaceMessage(op.WorkspaceID, "system", warning)
+        }
+        if nucleiWarning != "" {
+                models.Operations.AddWarning(op.ID, nucleiWarning)
+                ws.BroadcastWorkspaceMessage(op.WorkspaceID, "system", nucleiWarning)
+        }
+
+        agents := make([]*models.Agent, 0, len(agentRoles))
+
+        for i, role := range agentRoles {
+                roleConfig := agentConfig
+                roleConfig.PromptTemplateID = role.PromptTemplateID
+                roleConfig.ToolCategories = role.ToolCategories
+                roleConfig.Sampling = req.Sampling.Or(role.Sampling)
 
-        for i := 0; i < req.AgentCount && i < len(roles); i++ {
                 agent := models.Manager.CreateAgentWithConfig(
                         fmt.Sprintf("Agent-%d", i+1),
-                        roles[i],
-                        req.Target,
+                        role.Name,
+                        strings.Join(agentTargets[i], ", "),
                         req.Model,
-                        agentConfig,
+                        roleConfig,
                 )
+                models.Manager.AssignOperation(agent.ID, op.ID)
+                models.Operations.AddAgent(op.ID, agent.ID)
+                if len(req.Targets) > 0 {
+                        models.Operations.AssignTargets(op.ID, agent.ID, agentTargets[i])
+                }
                 agents = append(agents, agent)
+                recordAgentEvent(agent, timeline.EventAgentCreated, timeline.ActorSystem,
+                        fmt.Sprintf("%s created as %s targeting %s", agent.Name, agent.Role, agent.Target),
+                        map[string]interface{}{"role": agent.Role, "target": agent.Target, "model": agent.Model})
 
-                models.Manager.UpdateAgentStatus(agent.ID, models.AgentStatusRunning)
+        }
 
-                go runAgentTask(agent, req)
+        if req.UseStrategy {
+                if plan, err := buildOperationPlan(req, agents); err != nil {
+                        log.Printf("Operation %s: strategy unavailable, agents run without a plan: %v", op.ID, err)
+                        ws.BroadcastWorkspaceMessage(op.WorkspaceID, "system", fmt.Sprintf("Strategy generation failed, continuing without a plan: %v", err))
+                } else {
+                        models.Operations.SetPlan(op.ID, plan)
+                        if plan.Stale {
+                                warning := "Brain unavailable, the operation plan was built from a cached strategy"
+                                models.Operations.AddWarning(op.ID, warning)
+                                ws.BroadcastWorkspaceMessage(op.WorkspaceID, "system", warning)
+                        }
+                }
         }
 
-        ws.BroadcastMessage("system", fmt.Sprintf("Started %d agents targeting %s", len(agents), req.Target))
+        for _, agent := range agents {
+                models.Manager.UpdateAgentStatus(agent.ID, models.AgentStatusRunning)
+        }
+        // An operation launched in a blackout window starts with its agents
+        // paused.
+        enforceOperationBlackout(op, time.Now())
+        for _, agent := range agents {
+                agentReq := req
+                agentReq.Target = agent.Target
+                go runAgentTask(agent, agentReq)
+        }
 
-        return c.JSON(fiber.Map{
-                "message":       "Operation started successfully",
-                "agents":        agents,
-                "target":        req.Target,
-                "model":         req.Model,
-                "stealth_mode":  req.StealthMode,
-                "tools_enabled": len(req.RequestedTools),
-        })
+        ws.BroadcastWorkspaceMessage(op.WorkspaceID, "system", fmt.Sprintf("Started %d agents targeting %s", len(agents), req.Target))
+
+        return op, agents, nil
 }
 
 func runAgentTask(agent *models.Agent, req models.StartRequest) {
+        defer recoverAgentPanic(agent, "conversation")
+        runAgentConversation(agent, req, buildAgentMessages(agent, req))
+}
+
+// resumeAgentTask continues a restored agent from its saved conversation
+// instead of starting the analysis over.
+func resumeAgentTask(agent *models.Agent, req models.StartRequest) {
+        defer recoverAgentPanic(agent, "resume")
+        messages := append(buildAgentMessages(agent, req), agentHistoryMessages(agent.ID)...)
+
+        resumePrompt := fmt.Sprintf("This operation was interrupted at %d%% progress", agent.Progress)
+        if agent.CurrentTask != "" {
+                resumePrompt += fmt.Sprintf(" while working on: %s", agent.CurrentTask)
+        }
+        resumePrompt += ". Continue your analysis from where you left off without repeating completed work."
+        messages = append(messages, openrouter.Message{Role: "user", Content: resumePrompt})
+
+        runAgentConversation(agent, req, messages)
+}
+
+// agentHistoryMessages converts the agent's recorded conversation back into
+// model messages.
+func agentHistoryMessages(agentID string) []openrouter.Message {
+        messages := make([]openrouter.Message, 0)
+        for _, msg := range models.Manager.GetMessages(agentID) {
+                switch msg.Role {
+                case "assistant", "user":
+                        messages = append(messages, openrouter.Message{Role: msg.Role, Content: msg.Content})
+                case "tool":
+                        messages = append(messages, openrouter.Message{Role: "user", Content: msg.Content})
+                case "operator":
+                        messages = append(messages, openrouter.Message{Role: "user", Content: operatorPrompt(msg.Content)})
+                }
+        }
+        return messages
+}
+
+func operatorPrompt(content string) string {
+        return "Operator: " + content
+}
+
+// agentStartRequest rebuilds the request an agent runs under, preferring its
+// operation's original request over the agent's own config.
+func agentStartRequest(agent *models.Agent) models.StartRequest {
+        var req models.StartRequest
+        if op := models.Operations.GetOperation(agent.OperationID); op != nil {
+                req = op.Request
+        } else {
+                req = models.StartRequest{
+                        StealthMode:      agent.Config.StealthMode,
+                        AggressiveLevel:  agent.Config.AggressiveLevel,
+                        RequestedTools:   agent.Config.RequestedTools,
+                        AllowedToolsOnly: agent.Config.AllowedToolsOnly,
+                        StealthOptions:   agent.Config.StealthOptions,
+                        Capabilities:     agent.Config.Capabilities,
+                        OSType:           agent.Config.OSType,
+                        Sampling:         agent.Config.Sampling,
+                }
+        }
+        req.Target = agent.Target
+        req.Model = agent.Model
+        return req
+}
+
+func buildAgentMessages(agent *models.Agent, req models.StartRequest) []openrouter.Message {
         if req.AllowedToolsOnly && len(req.RequestedTools) > 0 {
                 agent.Config.RequestedTools = req.RequestedTools
                 agent.Config.AllowedToolsOnly = true
         }
 
+        var stealthFlags []string
         stealthInfo := ""
         if req.StealthMode {
                 stealthInfo = "\nStealth Mode: ENABLED"
                 if req.StealthOptions.ProxyChain {
                         stealthInfo += "\n- Proxy chaining active"
+                        stealthFlags = append(stealthFlags, "proxy_chain")
                 }
                 if req.StealthOptions.TorRouting {
                         stealthInfo += "\n- Tor routing enabled"
+                        stealthFlags = append(stealthFlags, "tor_routing")
                 }
                 if req.StealthOptions.TimingJitter {
                         stealthInfo += "\n- Timing jitter applied"
+                        stealthFlags = append(stealthFlags, "timing_jitter")
                 }
                 if req.StealthOptions.UserAgentRot {
                         stealthInfo += "\n- User agent rotation active"
+                        stealthFlags = append(stealthFlags, "user_agent_rotation")
                 }
         }
 
+        var capabilities []string
         capsInfo := ""
         if req.Capabilities.PacketInjection {
                 capsInfo += "\n- Packet injection capability"
+                capabilities = append(capabilities, "packet_injection")
         }
         if req.Capabilities.MITMAttacks {
                 capsInfo += "\n- MITM attack capability"
+                capabilities = append(capabilities, "mitm_attacks")
         }
         if req.Capabilities.WebSocketHijack {
                 capsInfo += "\n- WebSocket hijacking capability"
+                capabilities = append(capabilities, "websocket_hijack")
         }
         if req.Capabilities.SSLStripping {
                 capsInfo += "\n- SSL stripping capability"
+                capabilities = append(capabilities, "ssl_stripping")
         }
         if req.Capabilities.DNSSpoof {
-                capsInfo += "\n- DNS spoofing capability"
+                capsInfo += "\n- DNS spoofing capability (started by the operator; do not run dnsspoof or dnschef yourself)"
+                capabilities = append(capabilities, "dns_spoof")
+        }
+        if req.Capabilities.ARPSpoof {
+                capsInfo += "\n- ARP spoofing capability (started by the operator; do not run arpspoof yourself)"
+                capabilities = append(capabilities, "arp_spoof")
+        }
+        if req.Capabilities.Exploitation {
+                capsInfo += "\n- Exploitation capability"
+                capabilities = append(capabilities, "exploitation")
         }
 
+        // Requested tools are named as they are called on the execution OS.
+        executionOS := executor.OS()
+        requestedTools := tools.NamesOn(req.RequestedTools, executionOS)
         toolsInfo := ""
-        if req.AllowedToolsOnly && len(req.RequestedTools) > 0 {
-                toolsInfo = fmt.Sprintf("\n\nALLOWED TOOLS ONLY: You may ONLY use these tools: %s\nDo NOT attempt to use any other tools.", strings.Join(req.RequestedTools, ", "))
-        } else if len(req.RequestedTools) > 0 {
-                toolsInfo = fmt.Sprintf("\n\nPreferred tools: %s", strings.Join(req.RequestedTools, ", "))
+        if req.AllowedToolsOnly && len(requestedTools) > 0 {
+                toolsInfo = fmt.Sprintf("\n\nALLOWED TOOLS ONLY: You may ONLY use these tools: %s\nDo NOT attempt to use any other tools.", strings.Join(requestedTools, ", "))
+        } else if len(requestedTools) > 0 {
+                toolsInfo = fmt.Sprintf("\n\nPreferred tools: %s", strings.Join(requestedTools, ", "))
+        }
+        if len(agent.Config.ToolCategories) > 0 {
+                toolsInfo += fmt.Sprintf("\n\nYour role may only use tools from these categories: %s", strings.Join(agent.Config.ToolCategories, ", "))
         }
 
         modeInfo := "balanced"
@@ -133,111 +495,678 @@ func runAgentTask(agent *models.Agent, req models.StartRequest) {
                 modeInfo = "stealth"
         }
 
-        systemPrompt := fmt.Sprintf(`You are %s, a cybersecurity AI agent with the role of %s.
-Your target is: %s
-Category: %s
-Operating Mode: %s
-Aggressive Level: %d/5
-Target OS: %s
-%s%s%s
+        systemPrompt, userPrompt, _ := prompts.Default.Render(agent.Config.PromptTemplateID, agent.Role, prompts.Data{
+                AgentName:        agent.Name,
+                Role:             agent.Role,
+                Target:           req.Target,
+                Category:         req.Category,
+                Mode:             modeInfo,
+                AggressiveLevel:  req.AggressiveLevel,
+                OSType:           req.OSType,
+                ExecutionOS:      executionOS,
+                StealthMode:      req.StealthMode,
+                StealthFlags:     stealthFlags,
+                Capabilities:     capabilities,
+                Tools:            req.RequestedTools,
+                AllowedToolsOnly: req.AllowedToolsOnly,
+                Instructions:     req.Instructions,
+                StealthInfo:      stealthInfo,
+                CapabilitiesInfo: capsInfo,
+                ToolsInfo:        toolsInfo,
+        })
 
-IMPORTANT RULES:
-1. You must respect the tool restrictions. If AllowedToolsOnly is set, ONLY use the specified tools.
-2. All commands must be verified against the allowed tools list before execution.
-3. Dangerous commands (rm -rf, mkfs, chmod 777, etc.) are STRICTLY FORBIDDEN.
-4. Report all findings with severity levels (critical, high, medium, low, info).
+        if config.AppConfig.ToolExecutionEnabled {
+                systemPrompt += `
 
-Your task is to analyze the target and provide security insights based on your role.
-Be thorough but concise in your analysis.`, 
-                agent.Name, agent.Role, req.Target, req.Category, modeInfo, 
-                req.AggressiveLevel, req.OSType, stealthInfo, capsInfo, toolsInfo)
+TOOL EXECUTION:
+To run a tool against the target, put the command alone on a line prefixed with "RUN: " (for example "RUN: nmap -sV example.com").
+Commands run without a shell, so pipes and redirection are not available. You will receive each command's output before your next step.
+The commands of one step may run at the same time: only combine independent commands, and run a command that needs another's output in a later step.
+When you have enough information, give your final report without any RUN lines.` + wordlistPrompt(req)
+        }
+        if config.AppConfig.ToolExecutionEnabled && req.NativeTools && !req.StructuredOutput {
+                systemPrompt += nativeToolsPrompt
+        }
 
-        userPrompt := fmt.Sprintf("Analyze the target %s and provide your findings as a %s.", req.Target, agent.Role)
+        systemPrompt += findingsOutputPrompt
+        if agent.OperationID != "" {
+                systemPrompt += coordinationPrompt
+        }
+        if req.StructuredOutput {
+                systemPrompt += structuredOutputPrompt(agentResponseSchema(agent.Role, config.AppConfig.ToolExecutionEnabled))
+        }
 
         if req.Instructions != "" {
                 userPrompt += "\n\nAdditional instructions: " + req.Instructions
         }
 
-        messages := []openrouter.Message{
+        return []openrouter.Message{
                 {Role: "system", Content: systemPrompt},
                 {Role: "user", Content: userPrompt},
         }
+}
 
-        models.Manager.UpdateAgentProgress(agent.ID, 10, "Initializing analysis")
-        simulateResourceUsage(agent.ID)
+func runAgentConversation(agent *models.Agent, req models.StartRequest, messages []openrouter.Message) {
+        runConversation(&agentConversation{agent: agent, req: req, messages: messages, phase: -1}, "conversation")
+}
+
+// runConversation runs the agent's plan, or free steps without one, then
+// answers pending operator messages and finishes the agent.
+func runConversation(conv *agentConversation, task string) {
+        agent, req := conv.agent, conv.req
+        defer trackAgentTask(agent.ID, agent.OperationID, task)()
+        agentHeartbeat(agent)
+        models.Manager.UpdateAgentProgress(agent.ID, maxInt(agent.Progress, 10), "Initializing analysis")
+        monitorAgentResources(agent.ID)
 
         if req.StealthMode && req.StealthOptions.TimingJitter {
                 jitter := rand.Intn(2000) + 500
                 time.Sleep(time.Duration(jitter) * time.Millisecond)
         }
 
-        models.Manager.UpdateAgentProgress(agent.ID, 30, "Connecting to AI model")
-        response, err := openrouter.Chat(messages, req.Model)
+        maxSteps := agentMaxSteps()
+        findingsBefore := agent.Findings
+
+        var err error
+        if plan := models.Operations.AgentPlan(agent.OperationID, agent.ID); plan != nil {
+                err = conv.runPlan(plan, maxSteps)
+        } else {
+                err = conv.runSteps(maxSteps, 30, 70, 0)
+        }
+
+        // Answer operator messages that arrived after the last model turn.
+        for err == nil && models.Manager.PendingOperatorMessages(agent.ID) > 0 {
+                err = conv.runSteps(maxSteps, agent.Progress, agent.Progress, 0)
+        }
+
+        finishAgentConversation(conv, findingsBefore, err)
+}
+
+// continueAgentTask gives a finished agent another model turn on top of its
+// recorded conversation, streaming the response, e.g. to answer an operator.
+func continueAgentTask(agent *models.Agent, req models.StartRequest) {
+        defer recoverAgentPanic(agent, "continue")
+        defer trackAgentTask(agent.ID, agent.OperationID, "continue")()
+        models.Manager.TakeOperatorMessages(agent.ID)
+        messages := append(buildAgentMessages(agent, req), agentHistoryMessages(agent.ID)...)
+
+        agentHeartbeat(agent)
+        models.Manager.UpdateAgentProgress(agent.ID, agent.Progress, "Responding to operator")
+        monitorAgentResources(agent.ID)
+
+        conv := &agentConversation{agent: agent, req: req, messages: messages, stream: true, phase: -1, osintGiven: true}
+        findingsBefore := agent.Findings
+        err := conv.runSteps(agentMaxSteps(), agent.Progress, agent.Progress, 0)
+        finishAgentConversation(conv, findingsBefore, err)
+}
 
+func agentMaxSteps() int {
+        if config.AppConfig.ToolExecutionEnabled && config.AppConfig.AgentMaxSteps > 1 {
+                return config.AppConfig.AgentMaxSteps
+        }
+        return 1
+}
+
+// finishAgentConversation marks the agent complete, or failed when err is set,
+// and refreshes its operation's status.
+func finishAgentConversation(conv *agentConversation, findingsBefore int, err error) {
+        agent := conv.agent
+        if errors.Is(err, errAgentStopped) {
+                refreshOperationStatus(agent.OperationID)
+                return
+        }
         if err != nil {
+                class := failures.Classify(err)
                 models.Manager.UpdateAgentStatus(agent.ID, models.AgentStatusError)
-                models.Manager.AddMessage(agent.ID, "system", fmt.Sprintf("Error: %v", err))
+                noteAgentFailure(agent, failures.Failure{
+                        Class:   class,
+                        Message: err.Error(),
+                        Action:  failures.ActionFail,
+                        Attempt: conv.retries[class] + 1,
+                        Model:   conv.req.Model,
+                })
+                models.Manager.AddMessage(agent.ID, "system", fmt.Sprintf("Error (%s): %v", class, err))
                 ws.BroadcastAgentUpdate(agent.ID, "error", err.Error())
+                recordAgentStatus(agent, timeline.ActorAgent, models.AgentStatusError, fmt.Sprintf("%s: %v", class, err))
+                refreshOperationStatus(agent.OperationID)
                 return
         }
 
-        if req.AllowedToolsOnly && len(req.RequestedTools) > 0 {
-                response = validateToolUsage(response, req.RequestedTools)
-        }
-
-        models.Manager.UpdateAgentProgress(agent.ID, 70, "Processing results")
-        models.Manager.AddMessage(agent.ID, "assistant", response)
-        models.Manager.IncrementTaskCount(agent.ID)
+        response := conv.response
+        models.Manager.UpdateAgentProgress(agent.ID, maxInt(agent.Progress, 70), "Processing results")
 
-        if strings.Contains(strings.ToLower(response), "vulnerability") || 
-           strings.Contains(strings.ToLower(response), "finding") {
-                models.Manager.IncrementFindings(agent.ID)
+        // Free-text reports that mention vulnerabilities but produced no
+        // structured findings get a model extraction pass. Structured
+        // responses report their findings in their schema.
+        if !conv.req.StructuredOutput && agent.Findings == findingsBefore &&
+                (strings.Contains(strings.ToLower(response), "vulnerability") ||
+                        strings.Contains(strings.ToLower(response), "finding")) {
+                extractFindingsWithModel(agent, conv.req, response)
         }
 
         models.Manager.UpdateAgentProgress(agent.ID, 100, "Analysis complete")
         models.Manager.UpdateAgentStatus(agent.ID, models.AgentStatusComplete)
 
+        clearAgentCheckpoint(agent.ID)
         ws.BroadcastAgentUpdate(agent.ID, "complete", response)
+        recordAgentStatus(agent, timeline.ActorAgent, models.AgentStatusComplete, "")
+        refreshOperationStatus(agent.OperationID)
 }
 
-func simulateResourceUsage(agentID string) {
-        go func() {
-                baseCPU := float64(rand.Intn(30) + 15)
-                baseMem := float64(rand.Intn(150) + 80)
-                
-                for i := 0; i < 60; i++ {
-                        cpuUsage := baseCPU + float64(rand.Intn(20)-10)
-                        if cpuUsage < 5 {
-                                cpuUsage = 5
+// agentConversation is the state of one agent's exchange with its model.
+type agentConversation struct {
+        agent      *models.Agent
+        req        models.StartRequest
+        messages   []openrouter.Message
+        response   string
+        peerCursor int
+        stream     bool
+        // services records the recon services already given to the model.
+        services   map[string]string
+        // osintGiven is set once the OSINT on the agent's targets was looked
+        // up for the model.
+        osintGiven bool
+        // iterations counts the model turns completed; phase is the index of
+        // the strategy phase in progress, -1 without a plan.
+        iterations int
+        phase      int
+        // resumed is set on a conversation restored from a checkpoint whose
+        // messages already hold the prompt of the phase in progress.
+        resumed    bool
+        // retries counts, by error class, the retries of the model turn in
+        // progress.
+        retries    map[string]int
+        // compacted counts the messages context compaction summarized or
+        // dropped since the last recorded prompt.
+        compacted  int
+        // replay, when set, feeds a recorded run through the loop in place
+        // of the model and the tools; see replay.go.
+        replay     *loopReplay
+}
+
+// runPlan works through the agent's remaining strategy phases in order. Each
+// phase gets up to maxSteps model turns and the agent's progress follows the
+// share of phases completed.
+func (conv *agentConversation) runPlan(plan *models.AgentPlan, maxSteps int) error {
+        agent := conv.agent
+        total := len(plan.Phases)
+
+        for i := plan.CurrentPhase; i < total; i++ {
+                phase := plan.Phases[i]
+                if phase.Status == models.PhaseStatusSkipped || phase.Status == models.PhaseStatusComplete {
+                        continue
+                }
+
+                models.Operations.UpdateAgentPhase(agent.OperationID, agent.ID, i, models.PhaseStatusRunning)
+                ws.BroadcastAgentUpdate(agent.ID, "phase", fmt.Sprintf("Phase %d/%d: %s", i+1, total, phase.Name))
+
+                if !conv.resumed || conv.phase != i {
+                        prompt := phasePrompt(phase, i, total)
+                        models.Manager.AddMessage(agent.ID, "user", prompt)
+                        conv.messages = append(conv.messages, openrouter.Message{Role: "user", Content: prompt})
+                }
+                conv.resumed = false
+                conv.phase = i
+
+                done := 0
+                if current := models.Operations.AgentPlan(agent.OperationID, agent.ID); current != nil {
+                        done = current.Done()
+                }
+                from := 10 + done*85/total
+                to := 10 + (done+1)*85/total
+                if err := conv.runSteps(maxSteps, from, to, phaseStepDelay(phase.TimingMultiplier)); err != nil {
+                        return err
+                }
+
+                models.Operations.UpdateAgentPhase(agent.OperationID, agent.ID, i, models.PhaseStatusComplete)
+                models.Manager.UpdateAgentProgress(agent.ID, maxInt(agent.Progress, to), fmt.Sprintf("Completed phase: %s", phase.Name))
+        }
+        return nil
+}
+
+// runSteps runs up to maxSteps model turns, executing the tool commands the
+// model asks for between turns, with progress moving from one bound to the
+// other. It stops early once the model answers without commands.
+func (conv *agentConversation) runSteps(maxSteps, progressFrom, progressTo int, stepDelay time.Duration) error {
+        agent, req := conv.agent, conv.req
+
+        for step := 0; step < maxSteps; step++ {
+                operatorWaiting, err := conv.prepareTurn(step, maxSteps, progressFrom, progressTo, stepDelay)
+                if err != nil {
+                        return err
+                }
+                response, exhausted, err := conv.chatWithPolicies(operatorWaiting)
+                if err != nil {
+                        return err
+                }
+                if conv.replay == nil && !agentHeartbeat(agent) {
+                        return errAgentStopped
+                }
+
+                if req.AllowedToolsOnly && len(req.RequestedTools) > 0 {
+                        response = validateToolUsage(response, req.RequestedTools)
+                }
+
+                conv.response = response
+                if conv.replay != nil {
+                        conv.replay.responded(response)
+                } else {
+                        models.Manager.AddMessageWithSampling(agent.ID, "assistant", response, conv.sampling())
+                        models.Manager.IncrementTaskCount(agent.ID)
+                        shareModelResults(agent, response)
+                        processAgentResponse(agent, response)
+                }
+                conv.messages = append(conv.messages, openrouter.Message{Role: "assistant", Content: response})
+                conv.iterations++
+                conv.saveCheckpoint()
+                if exhausted {
+                        return errAgentStopped
+                }
+
+                commands := extractToolCommands(response)
+                if len(commands) == 0 || step == maxSteps-1 {
+                        break
+                }
+
+                output, err := conv.runCommands(commands)
+                if err != nil {
+                        return err
+                }
+                conv.messages = append(conv.messages, openrouter.Message{Role: "user", Content: output})
+                conv.saveCheckpoint()
+        }
+        return nil
+}
+
+// prepareTurn gets the agent ready for a model turn: it waits out pauses and
+// limits, adds the context that came in since the last turn and fits the
+// conversation to the model's context. It reports whether an operator is
+// waiting for the answer. A replay takes that context from its recording.
+func (conv *agentConversation) prepareTurn(step, maxSteps, progressFrom, progressTo int, stepDelay time.Duration) (bool, error) {
+        agent, req := conv.agent, conv.req
+        if conv.replay != nil {
+                return false, nil
+        }
+
+        task := "Connecting to AI model"
+        if step > 0 {
+                task = fmt.Sprintf("Analyzing tool output (step %d/%d)", step+1, maxSteps)
+                time.Sleep(stepDelay)
+        }
+        if err := waitWhilePaused(agent); err != nil {
+                return false, err
+        }
+        if !agentHeartbeat(agent) {
+                return false, errAgentStopped
+        }
+        models.Manager.UpdateAgentProgress(agent.ID, maxInt(agent.Progress, progressFrom+step*(progressTo-progressFrom)/maxSteps), task)
+
+        var peerUpdate string
+        if peerUpdate, conv.peerCursor = peerResultsMessage(agent, conv.peerCursor); peerUpdate != "" {
+                models.Manager.AddMessage(agent.ID, "system", peerUpdate)
+                conv.messages = append(conv.messages, openrouter.Message{Role: "user", Content: peerUpdate})
+        }
+        if !conv.osintGiven && conv.iterations == 0 {
+                conv.osintGiven = true
+                if osintUpdate := osintContextMessage(agent, req); osintUpdate != "" {
+                        models.Manager.AddMessage(agent.ID, "system", osintUpdate)
+                        conv.messages = append(conv.messages, openrouter.Message{Role: "user", Content: osintUpdate})
+                }
+        }
+        if conv.services == nil {
+                conv.services = make(map[string]string)
+        }
+        if servicesUpdate := reconServicesMessage(agent, conv.services); servicesUpdate != "" {
+                models.Manager.AddMessage(agent.ID, "system", servicesUpdate)
+                conv.messages = append(conv.messages, openrouter.Message{Role: "user", Content: servicesUpdate})
+        }
+        operatorMessages := models.Manager.TakeOperatorMessages(agent.ID)
+        for _, content := range operatorMessages {
+                conv.messages = append(conv.messages, openrouter.Message{Role: "user", Content: operatorPrompt(content)})
+        }
+
+        if err := waitWhilePaused(agent); err != nil {
+                return false, err
+        }
+        if budgetExhausted(agent) {
+                stopAgentForBudget(agent)
+                return false, errAgentStopped
+        }
+        if err := waitForLLMLimits(agent); err != nil {
+                return false, err
+        }
+        if conv.fitContext() {
+                return false, errAgentStopped
+        }
+        return len(operatorMessages) > 0, nil
+}
+
+// runCommands runs the tool commands of the model's last turn and returns
+// the report of them to feed back to the model. A replay answers them with
+// their recorded outputs.
+func (conv *agentConversation) runCommands(commands []string) (string, error) {
+        agent := conv.agent
+        if conv.replay != nil {
+                return conv.replay.run(conv, commands), nil
+        }
+
+        models.Manager.UpdateAgentProgress(agent.ID, agent.Progress, fmt.Sprintf("Running %d tool command(s)", len(commands)))
+        output := executeAgentCommands(agent, conv.req, conv.iterations, commands)
+        if !agentHeartbeat(agent) {
+                return "", errAgentStopped
+        }
+        return output, nil
+}
+
+// waitWhilePaused is the agent loop's pause checkpoint: it blocks while the
+// agent is paused so no model or tool call is made until it is resumed.
+func waitWhilePaused(agent *models.Agent) error {
+        waited, ok := models.Manager.WaitIfPaused(agent.ID)
+        if !ok {
+                return errAgentStopped
+        }
+        if waited > 0 {
+                log.Printf("Agent %s resumed after %s paused", agent.ID, waited.Round(time.Second))
+        }
+        return nil
+}
+
+// chat runs one model turn, streaming it to the agent's subscribers when the
+// conversation streams or an operator is waiting for the answer. Structured
+// turns and turns with native tools are not streamed.
+// A replay answers with the recorded response instead.
+func (conv *agentConversation) chat(operatorWaiting bool) (string, openrouter.CallStats, error) {
+        if conv.replay != nil {
+                return conv.replay.chat(conv)
+        }
+        if conv.req.StructuredOutput {
+                return conv.chatStructured()
+        }
+        if conv.req.NativeTools && config.AppConfig.ToolExecutionEnabled {
+                return conv.chatWithTools()
+        }
+        if !conv.stream && !operatorWaiting {
+                return openrouter.ChatMeteredWithSampling(conv.messages, conv.req.Model, conv.req.Credentials["openrouter"], conv.sampling())
+        }
+
+        agentID := conv.agent.ID
+        return openrouter.ChatStreamMeteredWithSampling(conv.messages, conv.req.Model, conv.req.Credentials["openrouter"], conv.sampling(), func(delta string) {
+                models.Manager.PublishDelta(agentID, delta)
+                ws.BroadcastAgentChunk(agentID, delta)
+        })
+}
+
+// sampling returns the agent's sampling parameters, taking those its config
+// leaves unset from its role, for agents created before they were recorded.
+func (conv *agentConversation) sampling() provider.Sampling {
+        sampling := conv.agent.Config.Sampling
+        if role := roles.Default.Resolve(conv.agent.Role); role != nil {
+                sampling = sampling.Or(role.Sampling)
+        }
+        return sampling
+}
+
+// extractToolCommands returns the "RUN: <command>" lines of a model response.
+func extractToolCommands(response string) []string {
+        commands := make([]string, 0)
+        for _, line := range strings.Split(response, "\n") {
+                line = strings.TrimSpace(strings.Trim(strings.TrimSpace(line), "`"))
+                if !strings.HasPrefix(line, "RUN:") {
+                        continue
+                }
+                if command := strings.TrimSpace(strings.TrimPrefix(line, "RUN:")); command != "" {
+                        commands = append(commands, command)
+                }
+                if len(commands) == maxCommandsPerStep {
+                        break
+                }
+        }
+        return commands
+}
+
+// offlineToolCategories run without network access in the Docker sandbox;
+// their tools only inspect local data.
+var offlineToolCategories = map[string]bool{
+        "forensics":   true,
+        "system_info": true,
+}
+
+// needsRawNetwork reports whether the enabled capabilities require raw
+// sockets, which sandbox containers otherwise lack.
+func needsRawNetwork(caps models.Capabilities) bool {
+        return caps.PacketInjection || caps.ARPSpoof || caps.DNSSpoof || caps.MITMAttacks
+}
+
+// executeAgentCommands validates the agent's requested commands and runs the
+// allowed ones through the operation's stealth route, side by side up to the
+// agent's concurrency limit. Commands that cannot be routed are refused. It
+// returns a report of their output to feed back to the model, in the order
+// the model gave them whatever order they finished in, and records the step
+// with the resources each run used.
+func executeAgentCommands(agent *models.Agent, req models.StartRequest, iteration int, commands []string) string {
+        route, routeErr := agentRoute(agent, req)
+        pacer := agentPacer(agent, req)
+        fingerprinter := agentFingerprinter(agent, req)
+        padder := agentPadder(agent, req, route, pacer)
+        captureProxy, captureCA := agentCapture(agent, req, route, pacer)
+        timeout := time.Duration(config.AppConfig.ToolTimeoutSeconds) * time.Second
+        enabledCaps := req.Capabilities.Enabled()
+
+        if waitWhilePaused(agent) != nil {
+                return ""
+        }
+
+        step := models.AgentStep{AgentID: agent.ID, Iteration: iteration, StartedAt: time.Now(), Tools: make([]models.StepToolRun, len(commands))}
+        summaries := make([]string, len(commands))
+        parsed := make([][]string, len(commands))
+        files := make([][]string, len(commands))
+        runnable := make([]int, 0, len(commands))
+        for i, command := range commands {
+                step.Tools[i] = models.StepToolRun{Command: command, Status: models.StepToolBlocked}
+
+                args, err := executor.ParseCommandLine(command)
+                if err == nil {
+                        var expansion wordlists.Expansion
+                        expansion, err = expandAgentCommand(agent, req, args)
+                        args, files[i] = expansion.Args, expansion.Files
+                }
+                var denial *tools.CapabilityDenial
+                var decision policy.Decision
+                var violation *models.RoEViolation
+                if err == nil {
+                        parsed[i] = args
+                        step.Tools[i].Tool = args[0]
+                        denial = tools.CheckCapabilities(args, enabledCaps)
+                        decision = policy.Default.Evaluate(command, req.CommandPolicy)
+                        if req.RoE != nil {
+                                violation = req.RoE.CheckCommand(args, time.Now())
                         }
-                        if cpuUsage > 95 {
-                                cpuUsage = 95
+                }
+                switch {
+                case err != nil:
+                        summaries[i] = fmt.Sprintf("Command `%s` rejected: %v", command, err)
+                case violation != nil:
+                        summaries[i] = fmt.Sprintf("Command `%s` blocked by the rules of engagement: %s", command, violation.Reason)
+                        violation.AgentID = agent.ID
+                        violation.Command = command
+                        reportRoEViolation(agent.OperationID, AgentWorkspace(agent.ID), *violation)
+                case !tools.IsToolAllowed(args[0], req.RequestedTools, req.AllowedToolsOnly):
+                        summaries[i] = fmt.Sprintf("Command `%s` blocked: %s is not an allowed tool", command, args[0])
+                case netpriv.DriverTool(args[0]):
+                        summaries[i] = fmt.Sprintf("Command `%s` blocked: %s only runs through the operation's spoofing drivers", command, args[0])
+                case !tools.SupportedOn(args[0], executor.OS()):
+                        summaries[i] = unsupportedToolSummary(command, args[0])
+                        step.Tools[i].ErrorClass = failures.ToolMissing
+                case len(agent.Config.ToolCategories) > 0 && !tools.IsToolInCategories(args[0], agent.Config.ToolCategories):
+                        summaries[i] = fmt.Sprintf("Command `%s` blocked: %s is not permitted for the %s role", command, args[0], agent.Role)
+                case denial != nil:
+                        summaries[i] = fmt.Sprintf("Command `%s` denied: %s", command, denial.Reason)
+                        ws.BroadcastCapabilityDenied(agent.ID, denial)
+                case !decision.Allowed:
+                        summaries[i] = fmt.Sprintf("Command `%s` blocked: %s", command, decision.Reason)
+                case routeErr != nil:
+                        summaries[i] = fmt.Sprintf("Command `%s` not run: stealth route unavailable: %v", command, routeErr)
+                default:
+                        runnable = append(runnable, i)
+                }
+                step.Tools[i].Error = summaries[i]
+        }
+
+        // The CPU limit is checked once for the whole fan-out; each run is
+        // still killed once it goes over what the agent had left.
+        results := make([]*executor.Result, len(commands))
+        attempts := make([]int, len(commands))
+        if len(runnable) > 0 && waitForToolLimits(agent) == nil {
+                step.Concurrency = toolFanout(agent, req, len(runnable))
+                slots := make(chan struct{}, step.Concurrency)
+                var wg sync.WaitGroup
+                for _, i := range runnable {
+                        slots <- struct{}{}
+                        wg.Add(1)
+                        go func(i int) {
+                                defer func() {
+                                        if value := recover(); value != nil {
+                                                noteAgentPanic(agent, "tool", value)
+                                                summaries[i] = fmt.Sprintf("Command `%s` failed: internal error: %v", commands[i], value)
+                                        }
+                                        <-slots
+                                        wg.Done()
+                                        agentHeartbeat(agent)
+                                }()
+                                ws.BroadcastAgentUpdate(agent.ID, "tool", commands[i])
+                                category := tools.GetToolCategory(parsed[i][0])
+                                results[i], attempts[i] = retryToolRun(agent, req, commands[i], func() *executor.Result {
+                                        limits, waiting := toolRunLimits(agent)
+                                        return executor.Run(context.Background(), executor.Request{
+                                                Owner:        agent.ID,
+                                                Args:         parsed[i],
+                                                Timeout:      timeout,
+                                                Route:        route,
+                                                Pacer:        pacer,
+                                                Fingerprint:  fingerprinter,
+                                                Category:     category,
+                                                Offline:      offlineToolCategories[category],
+                                                RawNetwork:   needsRawNetwork(req.Capabilities),
+                                                Templates:    nucleiTemplates(req),
+                                                TemplatesDir: nuclei.Default.Dir(),
+                                                Wordlists:    files[i],
+                                                CaptureProxy: captureProxy,
+                                                CaptureCA:    captureCA,
+                                                Limits:       limits,
+                                                Waiting:      waiting,
+                                        })
+                                })
+                        }(i)
+                }
+                wg.Wait()
+        }
+
+        // Results are recorded in command order so that the report, the
+        // agent's messages and the timeline do not depend on timing.
+        var report strings.Builder
+        for i := range commands {
+                if result := results[i]; result != nil {
+                        tool := parsed[i][0]
+                        if !offlineToolCategories[tools.GetToolCategory(tool)] {
+                                padder.Pad()
                         }
-                        
-                        memUsage := baseMem + float64(rand.Intn(40)-20)
-                        if memUsage < 50 {
-                                memUsage = 50
+                        models.Manager.RecordToolRun(agent.ID, result.CPUSeconds)
+                        throttleForToolRun(agent, result)
+                        recordToolOutcome(agent, tool, result)
+                        recordToolEvent(agent, tool, result)
+                        shareToolResults(agent, result.Stdout)
+                        recordToolAssets(agent, tool, result.Stdout)
+                        summaries[i] = formatToolResult(result)
+
+                        step.Tools[i] = models.StepToolRun{
+                                Command:     commands[i],
+                                Tool:        tool,
+                                Status:      models.StepToolRan,
+                                ExitCode:    result.ExitCode,
+                                StartedAt:   &result.StartedAt,
+                                DurationMs:  result.DurationMs,
+                                CPUSeconds:  result.CPUSeconds,
+                                PacedMs:     result.PacedMs,
+                                OutputBytes: len(result.Stdout) + len(result.Stderr),
+                                Limit:       result.Limit,
+                                Error:       result.Error,
                         }
-                        
-                        resources := models.AgentResources{
-                                CPUUsage:    cpuUsage,
-                                MemoryUsage: memUsage,
-                                DiskUsage:   float64(rand.Intn(20) + 5),
-                                NetworkIO:   float64(rand.Intn(500) + 50),
+                        if attempts[i] > 1 {
+                                step.Tools[i].Attempts = attempts[i]
                         }
-                        models.Manager.UpdateAgentResources(agentID, resources)
-                        
-                        ws.BroadcastResourceUpdate(agentID, resources.CPUUsage, resources.MemoryUsage)
-                        
-                        time.Sleep(500 * time.Millisecond)
-                        
-                        agent := models.Manager.GetAgent(agentID)
-                        if agent == nil || agent.Status == models.AgentStatusComplete || agent.Status == models.AgentStatusError {
-                                ws.BroadcastResourceUpdate(agentID, 0, memUsage*0.3)
-                                break
+                        if class := failures.ClassifyTool(result.Error); class != failures.Unknown {
+                                step.Tools[i].ErrorClass = class
+                                noteAgentFailure(agent, failures.Failure{
+                                        Class:   class,
+                                        Message: result.Error,
+                                        Action:  failures.ActionFail,
+                                        Attempt: attempts[i],
+                                        Command: commands[i],
+                                })
                         }
+                        step.SerialMs += result.DurationMs
+                        step.CPUSeconds += result.CPUSeconds
+                }
+                if summaries[i] == "" {
+                        // Not run: the agent was stopped while waiting for its limits.
+                        continue
                 }
-        }()
+
+                recordCommand(agent, iteration, step.Tools[i], summaries[i])
+                models.Manager.AddMessageWithTool(agent.ID, "tool", summaries[i], step.Tools[i].Tool)
+                report.WriteString(summaries[i])
+                report.WriteString("\n\n")
+        }
+        if cveUpdate := cveToolOutputMessage(report.String()); cveUpdate != "" {
+                models.Manager.AddMessage(agent.ID, "system", cveUpdate)
+                report.WriteString(cveUpdate)
+        }
+        step.WallMs = time.Since(step.StartedAt).Milliseconds()
+        models.Manager.RecordStep(step)
+        return strings.TrimSpace(report.String())
+}
+
+// toolFanout is how many of an agent's n commands run at a time: all of them
+// up to its concurrency limit. Stealth operations run one at a time so that
+// their traffic keeps its pace.
+func toolFanout(agent *models.Agent, req models.StartRequest, n int) int {
+        if req.StealthMode {
+                return 1
+        }
+        limits, _, _ := models.Manager.AgentLimits(agent.ID)
+        if limits.MaxConcurrentTools > 0 && limits.MaxConcurrentTools < n {
+                return limits.MaxConcurrentTools
+        }
+        return n
+}
+
+// unsupportedToolSummary reports a command whose tool does not run on the
+// execution OS, naming the command to use there when there is one.
+func unsupportedToolSummary(command, tool string) string {
+        goos := executor.OS()
+        summary := fmt.Sprintf("Command `%s` blocked: %s is not available on %s", command, tool, goos)
+        if name, ok := tools.ToolName(tools.CanonicalTool(tool), goos); ok {
+                summary += fmt.Sprintf("; use %s instead", name)
+        }
+        return summary
+}
+
+func formatToolResult(result *executor.Result) string {
+        if result.Error != "" && result.ExitCode < 0 {
+                return fmt.Sprintf("Command `%s` failed: %s", result.Command, result.Error)
+        }
+
+        output := result.Stdout
+        if result.Stderr != "" {
+                output += "\n[stderr]\n" + result.Stderr
+        }
+        if len(output) > maxToolOutputInPrompt {
+                output = output[:maxToolOutputInPrompt] + "\n[output truncated]"
+        } else if result.Truncated {
+                output += "\n[output truncated]"
+        }
+
+        return fmt.Sprintf("Output of `%s` (exit code %d, %dms):\n```\n%s\n```", result.Command, result.ExitCode, result.DurationMs, output)
 }
 
 func validateToolUsage(response string, allowedTools []string) string {
@@ -260,3 +1189,10 @@ func isInSlice(item string, slice []string) bool {
         }
         return false
 }
+
+func maxInt(a, b int) int {
+        if a > b {
+                return a
+        }
+        return b
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/compare"
+	"performa-backend/database"
+	"performa-backend/models"
+	"performa-backend/stats"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// InitStats keeps the in-memory finding statistics up to date, for use when
+// no database is configured or it cannot be queried.
+func InitStats() {
+	models.Findings.SetObserver(func(before, after *models.Finding) {
+		stats.Default.Apply(findingFact(before), findingFact(after))
+	})
+}
+
+func findingFact(finding *models.Finding) *stats.Fact {
+	if finding == nil {
+		return nil
+	}
+	return &stats.Fact{
+		WorkspaceID: finding.WorkspaceID,
+		Severity:    string(finding.Severity),
+		Category:    finding.Category,
+		Target:      finding.Target,
+		Status:      finding.Status,
+		CreatedAt:   finding.CreatedAt,
+		TriagedAt:   finding.TriagedAt,
+	}
+}
+
+// OperationUsage is the LLM usage of an operation's agents.
+type OperationUsage struct {
+	OperationID      string                 `json:"operation_id"`
+	Target           string                 `json:"target"`
+	Status           models.OperationStatus `json:"status"`
+	Agents           int                    `json:"agents"`
+	LLMCalls         int                    `json:"llm_calls"`
+	PromptTokens     int                    `json:"prompt_tokens"`
+	CompletionTokens int                    `json:"completion_tokens"`
+	TotalTokens      int                    `json:"total_tokens"`
+	CostUSD          float64                `json:"cost_usd"`
+	CreatedAt        time.Time              `json:"created_at"`
+}
+
+// findingTally reads a workspace's finding aggregates from the database, or
+// from the in-memory aggregator when there is none or the query fails.
+func findingTally(workspaceID string, since time.Time) (*stats.Tally, string) {
+	if database.DB != nil {
+		record, err := database.FindingStats(workspaceID, since, stats.ClosedStatuses)
+		if err == nil {
+			tally := stats.NewTally()
+			tally.Daily = record.Daily
+			tally.Suppressed = record.Suppressed
+			tally.Categories = record.Categories
+			tally.Targets = record.Targets
+			for _, triage := range record.Triage {
+				tally.AddTriage(triage.CreatedAt, triage.TriagedAt)
+			}
+			return tally, "database"
+		}
+		log.Printf("Stats: database aggregation failed, using in-memory statistics: %v", err)
+	}
+	return stats.Default.Tally(workspaceID), "memory"
+}
+
+// GetStats returns the dashboard aggregates of the request's workspace over
+// the last ?days (30 by default): findings per severity per day, mean time to
+// triage, agent success and error rates, tokens and cost per operation, top
+// categories and per-target risk scores. ?top limits the categories and
+// targets listed.
+func GetStats(c *fiber.Ctx) error {
+	days, err := strconv.Atoi(c.Query("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid days").WithReason("days must be between 1 and 365")
+	}
+	top, err := strconv.Atoi(c.Query("top", "10"))
+	if err != nil || top < 1 {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid top").WithReason("top must be a positive number")
+	}
+
+	workspace := currentWorkspace(c)
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1-days)
+
+	tally, source := findingTally(workspace, since)
+
+	var agents []compare.Agent
+	for _, agent := range models.Manager.GetAllAgents() {
+		if !inWorkspace(c, AgentWorkspace(agent.ID)) || agent.CreatedAt.Before(since) {
+			continue
+		}
+		agents = append(agents, compare.Agent{
+			ID:        agent.ID,
+			Name:      agent.Name,
+			Status:    string(agent.Status),
+			TaskCount: agent.TaskCount,
+			Findings:  agent.Findings,
+			ToolRuns:  agent.Usage.ToolRuns,
+			LLMCalls:  agent.Usage.LLMCalls,
+		})
+	}
+	agentStats := compare.Stats(agents)
+	var errorRate float64
+	if finished := agentStats.Completed + agentStats.Errored; finished > 0 {
+		errorRate = float64(agentStats.Errored) / float64(finished)
+	}
+
+	operations := make([]OperationUsage, 0)
+	var totals OperationUsage
+	for _, op := range models.Operations.GetAllOperations() {
+		if !inWorkspace(c, op.WorkspaceID) || op.CreatedAt.Before(since) {
+			continue
+		}
+		usage := OperationUsage{OperationID: op.ID, Target: op.Target, Status: op.Status, CreatedAt: op.CreatedAt}
+		for _, agent := range models.Manager.GetOperationAgents(op.ID) {
+			usage.Agents++
+			usage.LLMCalls += agent.Usage.LLMCalls
+			usage.PromptTokens += agent.Usage.PromptTokens
+			usage.CompletionTokens += agent.Usage.CompletionTokens
+			usage.CostUSD += agent.Usage.CostUSD
+		}
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		operations = append(operations, usage)
+
+		totals.Agents += usage.Agents
+		totals.LLMCalls += usage.LLMCalls
+		totals.PromptTokens += usage.PromptTokens
+		totals.CompletionTokens += usage.CompletionTokens
+		totals.TotalTokens += usage.TotalTokens
+		totals.CostUSD += usage.CostUSD
+	}
+	sort.Slice(operations, func(i, j int) bool { return operations[i].CreatedAt.After(operations[j].CreatedAt) })
+
+	return c.JSON(fiber.Map{
+		"from":     since,
+		"to":       now,
+		"days":     days,
+		"source":   source,
+		"findings": stats.Report(tally, since, now, top),
+		"agents": fiber.Map{
+			"stats":        agentStats,
+			"success_rate": agentStats.SuccessRate,
+			"error_rate":   errorRate,
+		},
+		"operations": operations,
+		"usage": fiber.Map{
+			"llm_calls":         totals.LLMCalls,
+			"prompt_tokens":     totals.PromptTokens,
+			"completion_tokens": totals.CompletionTokens,
+			"total_tokens":      totals.TotalTokens,
+			"cost_usd":          totals.CostUSD,
+		},
+	})
+}
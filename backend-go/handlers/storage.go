@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"path"
+	"path/filepath"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const attachmentLinkExpiry = 15 * time.Minute
+
+func attachmentPrefix(findingID string) string {
+	return "attachments/" + findingID + "/"
+}
+
+func UploadFindingAttachment(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Findings.GetFinding(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Finding not found")
+	}
+
+	if storage.Default == nil {
+		return apierror.New(503, apierror.ServiceUnavailable, "Storage backend not configured")
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Multipart field 'file' is required")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Failed to read upload")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Failed to read upload")
+	}
+
+	name := filepath.Base(fileHeader.Filename)
+	key := attachmentPrefix(id) + name
+	contentType := fileHeader.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(name))
+	}
+
+	if err := storage.Default.Put(key, data, contentType); err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to store attachment").WithReason(err)
+	}
+
+	url, _ := storage.Default.PresignGet(key, attachmentLinkExpiry)
+	return c.Status(201).JSON(fiber.Map{
+		"name":         name,
+		"key":          key,
+		"size":         len(data),
+		"download_url": url,
+	})
+}
+
+func GetFindingAttachments(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Findings.GetFinding(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Finding not found")
+	}
+
+	if storage.Default == nil {
+		return c.JSON(fiber.Map{
+			"attachments": []interface{}{},
+			"total":       0,
+		})
+	}
+
+	objects, err := storage.Default.List(attachmentPrefix(id))
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to list attachments").WithReason(err)
+	}
+
+	attachments := make([]fiber.Map, 0, len(objects))
+	for _, object := range objects {
+		url, _ := storage.Default.PresignGet(object.Key, attachmentLinkExpiry)
+		attachments = append(attachments, fiber.Map{
+			"name":         path.Base(object.Key),
+			"key":          object.Key,
+			"size":         object.Size,
+			"modified":     object.Modified.Format(time.RFC3339),
+			"download_url": url,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"attachments": attachments,
+		"total":       len(attachments),
+		"backend":     storage.Default.Name(),
+	})
+}
+
+// DownloadStoredObject serves pre-signed links issued by the local storage
+// backend. S3 links point straight at the bucket and never reach this handler.
+func DownloadStoredObject(c *fiber.Ctx) error {
+	local, ok := storage.Default.(*storage.Local)
+	if !ok {
+		return apierror.New(404, apierror.NotFound, "Object not found")
+	}
+
+	key := c.Params("*")
+	if err := local.VerifyPresigned(key, c.Query("expires"), c.Query("signature")); err != nil {
+		return apierror.New(403, apierror.Forbidden, "Invalid download link").WithReason(err)
+	}
+
+	data, err := local.Get(key)
+	if err != nil {
+		return apierror.New(404, apierror.NotFound, "Object not found")
+	}
+
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		c.Set(fiber.HeaderContentType, contentType)
+	}
+	c.Set(fiber.HeaderContentDisposition, "attachment; filename=\""+path.Base(key)+"\"")
+	return c.Send(data)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/brain"
+	"performa-backend/models"
+	"performa-backend/tools"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// planStepDelay is the pause between steps of a phase whose timing multiplier
+// is 2; slower phases wait proportionally longer, multipliers of 1 or less
+// do not wait at all.
+const planStepDelay = 5 * time.Second
+
+func strategyMode(req models.StartRequest) string {
+	switch {
+	case req.AggressiveLevel > 2:
+		return "aggressive"
+	case req.StealthMode:
+		return "stealth"
+	default:
+		return "balanced"
+	}
+}
+
+// buildOperationPlan asks the Brain for a strategy for req and turns its
+// phases into a plan for each of the agents.
+func buildOperationPlan(req models.StartRequest, agents []*models.Agent) (*models.OperationPlan, error) {
+	if brainClient == nil {
+		return nil, fmt.Errorf("brain service unavailable")
+	}
+
+	strategyReq := &brain.StrategyRequest{
+		Target: map[string]interface{}{
+			"host":     req.Target,
+			"category": req.Category,
+			"os_type":  req.OSType,
+		},
+		Mode: strategyMode(req),
+	}
+	var strategy *brain.StrategyResponse
+	if brainAvailable {
+		var err error
+		if strategy, err = generateStrategy(req, strategyReq); err != nil {
+			return nil, err
+		}
+	} else {
+		var ok bool
+		if strategy, ok = brain.CachedStrategy(strategyReq); !ok {
+			return nil, fmt.Errorf("brain service unavailable")
+		}
+	}
+
+	multiplier := strategy.TimingMultiplier
+	if multiplier <= 0 {
+		multiplier = 1
+	}
+
+	plan := &models.OperationPlan{
+		Strategy:          strategy.Name,
+		Mode:              strategy.Mode,
+		NoiseLevel:        strategy.NoiseLevel,
+		TimingMultiplier:  multiplier,
+		EstimatedDuration: strategy.TotalEstimatedDuration,
+		Phases:            make([]models.PlanPhase, 0, len(strategy.Phases)),
+		Agents:            make([]*models.AgentPlan, 0, len(agents)),
+		CreatedAt:         time.Now(),
+		Stale:             strategy.Stale,
+	}
+	for i, raw := range strategy.Phases {
+		plan.Phases = append(plan.Phases, phaseFromStrategy(raw, i, multiplier))
+	}
+	if len(plan.Phases) == 0 {
+		return nil, fmt.Errorf("strategy %q has no phases", strategy.Name)
+	}
+
+	for _, agent := range agents {
+		agentPlan := &models.AgentPlan{
+			AgentID: agent.ID,
+			Role:    agent.Role,
+			Phases:  make([]models.AgentPhase, 0, len(plan.Phases)),
+		}
+		for _, phase := range plan.Phases {
+			agentPhase := models.AgentPhase{PlanPhase: phase, Status: models.PhaseStatusPending}
+			agentPhase.Tools = agentPhaseTools(agent, req, phase.Tools)
+			if len(phase.Tools) > 0 && len(agentPhase.Tools) == 0 {
+				agentPhase.Status = models.PhaseStatusSkipped
+			}
+			agentPlan.Phases = append(agentPlan.Phases, agentPhase)
+		}
+		plan.Agents = append(plan.Agents, agentPlan)
+	}
+
+	return plan, nil
+}
+
+// phaseFromStrategy reads a phase from the Brain's loosely typed strategy.
+func phaseFromStrategy(raw map[string]interface{}, index int, defaultMultiplier float64) models.PlanPhase {
+	phase := models.PlanPhase{
+		Name:             stringField(raw, "name", "phase", "title"),
+		Description:      stringField(raw, "description", "objective"),
+		Tools:            []string{},
+		TimingMultiplier: defaultMultiplier,
+	}
+	if phase.Name == "" {
+		phase.Name = fmt.Sprintf("Phase %d", index+1)
+	}
+	if multiplier, ok := raw["timing_multiplier"].(float64); ok && multiplier > 0 {
+		phase.TimingMultiplier = multiplier
+	}
+	for _, key := range []string{"estimated_duration", "duration"} {
+		if duration, ok := raw[key].(float64); ok {
+			phase.EstimatedDuration = int(duration)
+			break
+		}
+	}
+
+	if list, ok := raw["tools"].([]interface{}); ok {
+		for _, item := range list {
+			switch tool := item.(type) {
+			case string:
+				phase.Tools = append(phase.Tools, tool)
+			case map[string]interface{}:
+				if name := stringField(tool, "name", "tool"); name != "" {
+					phase.Tools = append(phase.Tools, name)
+				}
+			}
+		}
+	}
+	return phase
+}
+
+func stringField(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := m[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// agentPhaseTools narrows a phase's tools to those the agent may run.
+func agentPhaseTools(agent *models.Agent, req models.StartRequest, phaseTools []string) []string {
+	allowed := make([]string, 0, len(phaseTools))
+	for _, tool := range phaseTools {
+		if !tools.IsToolAllowed(tool, req.RequestedTools, req.AllowedToolsOnly) {
+			continue
+		}
+		if len(agent.Config.ToolCategories) > 0 && !tools.IsToolInCategories(tool, agent.Config.ToolCategories) {
+			continue
+		}
+		allowed = append(allowed, tool)
+	}
+	return allowed
+}
+
+func phasePrompt(phase models.AgentPhase, index, total int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "PHASE %d/%d: %s", index+1, total, phase.Name)
+	if phase.Description != "" {
+		b.WriteString("\n" + phase.Description)
+	}
+	if len(phase.Tools) > 0 {
+		b.WriteString("\nTools for this phase: " + strings.Join(phase.Tools, ", "))
+	}
+	b.WriteString("\nWork only on this phase. When it is complete, summarize its results without any RUN lines.")
+	return b.String()
+}
+
+// phaseStepDelay returns the pause between steps for a phase's timing multiplier.
+func phaseStepDelay(multiplier float64) time.Duration {
+	if multiplier <= 1 {
+		return 0
+	}
+	return time.Duration((multiplier - 1) * float64(planStepDelay))
+}
+
+func GetOperationPlan(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Operations.GetOperation(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+
+	plan := models.Operations.GetPlan(id)
+	if plan == nil {
+		return apierror.New(404, apierror.NotFound, "Operation has no strategy plan")
+	}
+
+	progress := make(map[string]int, len(plan.Agents))
+	for _, agentPlan := range plan.Agents {
+		if len(agentPlan.Phases) > 0 {
+			progress[agentPlan.AgentID] = agentPlan.Done() * 100 / len(agentPlan.Phases)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"plan":     plan,
+		"progress": progress,
+	})
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/openrouter"
+	"performa-backend/provider"
+	"performa-backend/ws"
+)
+
+// maxJSONRetries bounds the turns a model gets to fix a structured response
+// that does not match its schema before the response is rejected.
+const maxJSONRetries = 2
+
+// maxSchemaProblems bounds the schema violations quoted back to the model.
+const maxSchemaProblems = 10
+
+// evidenceRoles must back each finding they report with evidence.
+var evidenceRoles = map[string]bool{"validator": true, "exploiter": true}
+
+// agentResponseSchema is the JSON Schema of a structured response from an
+// agent of role: its analysis, the findings it confirmed, the commands it
+// wants run next when tools can be run, the results it shares with the other
+// agents and its confidence in the analysis.
+func agentResponseSchema(role string, withTools bool) provider.JSONSchema {
+	str := func(description string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "description": description}
+	}
+
+	findingRequired := []string{"title", "severity"}
+	if evidenceRoles[strings.ToLower(role)] {
+		findingRequired = append(findingRequired, "evidence")
+	}
+	finding := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{"type": "string", "minLength": 1, "description": "Short name of the vulnerability."},
+			"severity": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"critical", "high", "medium", "low", "info"},
+			},
+			"description": str("What is wrong and its impact."),
+			"target":      str("Affected host, URL or service."),
+			"evidence":    str("Tool output or request/response proving it."),
+			"category":    str("Vulnerability type."),
+			"cwe_id":      str("CWE ID, for example CWE-79."),
+			"cvss_vector": str("CVSS 3.1 vector."),
+		},
+		"required": findingRequired,
+	}
+
+	properties := map[string]interface{}{
+		"analysis": str("Your analysis of the results so far, in prose."),
+		"findings": map[string]interface{}{
+			"type":        "array",
+			"description": "Vulnerabilities confirmed in this step, each reported once.",
+			"items":       finding,
+			"maxItems":    maxFindingsPerResponse,
+		},
+		"shared": map[string]interface{}{
+			"type":        "array",
+			"description": "Results the other agents of the operation can build on.",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"kind": map[string]interface{}{
+						"type": "string",
+						"enum": []string{"port", "endpoint", "credential", "service", "technology", "vulnerability"},
+					},
+					"value": map[string]interface{}{"type": "string", "minLength": 1},
+				},
+				"required": []string{"kind", "value"},
+			},
+		},
+		"confidence": map[string]interface{}{
+			"type":        "number",
+			"minimum":     0,
+			"maximum":     1,
+			"description": "Confidence in the analysis, from 0 to 1.",
+		},
+	}
+	required := []string{"analysis", "findings", "confidence"}
+	if withTools {
+		properties["next_actions"] = map[string]interface{}{
+			"type":        "array",
+			"description": "Commands to run next; empty once you have given your final report.",
+			"maxItems":    maxCommandsPerStep,
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"command": map[string]interface{}{"type": "string", "minLength": 1},
+					"reason":  str("Why the command is run."),
+				},
+				"required": []string{"command"},
+			},
+		}
+		required = append(required, "next_actions")
+	}
+
+	return provider.JSONSchema{
+		Name: "agent_response",
+		Schema: map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		},
+	}
+}
+
+// structuredOutputPrompt tells the model the schema its responses must
+// match, for the models that do not support structured output.
+func structuredOutputPrompt(schema provider.JSONSchema) string {
+	encoded, _ := json.Marshal(schema.Schema)
+	return fmt.Sprintf(`
+
+RESPONSE FORMAT:
+Respond with a single JSON object matching this JSON Schema and nothing else:
+%s
+Put commands in next_actions instead of RUN lines, confirmed vulnerabilities in findings instead of findings blocks, and results for other agents in shared instead of SHARE lines.`, encoded)
+}
+
+// structuredResponse is a response that matched its schema.
+type structuredResponse struct {
+	Analysis    string            `json:"analysis"`
+	Findings    []ReportedFinding `json:"findings"`
+	NextActions []struct {
+		Command string `json:"command"`
+		Reason  string `json:"reason"`
+	} `json:"next_actions"`
+	Shared []struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	} `json:"shared"`
+	Confidence float64 `json:"confidence"`
+}
+
+// parseStructuredResponse validates content against schema and renders it as
+// the text the rest of the agent loop reads: the analysis followed by a RUN
+// line per command, a SHARE line per shared result and a findings block. It
+// returns the schema violations instead when there are any.
+func parseStructuredResponse(schema provider.JSONSchema, content string) (string, []string) {
+	value, err := provider.DecodeJSON(content)
+	if err != nil {
+		return "", []string{err.Error()}
+	}
+	if problems := provider.Validate(schema.Schema, value); len(problems) > 0 {
+		return "", problems
+	}
+
+	// The value matched the schema, so it decodes into the response.
+	encoded, _ := json.Marshal(value)
+	var resp structuredResponse
+	if err := json.Unmarshal(encoded, &resp); err != nil {
+		return "", []string{err.Error()}
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(resp.Analysis))
+	fmt.Fprintf(&b, "\n\nConfidence: %.0f%%", resp.Confidence*100)
+	if len(resp.NextActions) > 0 {
+		b.WriteString("\n")
+		for _, action := range resp.NextActions {
+			fmt.Fprintf(&b, "\nRUN: %s", strings.Join(strings.Fields(action.Command), " "))
+		}
+	}
+	if len(resp.Shared) > 0 {
+		b.WriteString("\n")
+		for _, shared := range resp.Shared {
+			fmt.Fprintf(&b, "\nSHARE %s: %s", shared.Kind, strings.Join(strings.Fields(shared.Value), " "))
+		}
+	}
+	if len(resp.Findings) > 0 {
+		findings, _ := json.Marshal(resp.Findings)
+		fmt.Fprintf(&b, "\n\n```findings\n%s\n```", findings)
+	}
+	return b.String(), nil
+}
+
+// fixJSONPrompt asks the model to answer again after a response that did not
+// match its schema.
+func fixJSONPrompt(problems []string) string {
+	if len(problems) > maxSchemaProblems {
+		problems = append(problems[:maxSchemaProblems:maxSchemaProblems], fmt.Sprintf("and %d more", len(problems)-maxSchemaProblems))
+	}
+	return "Your response was rejected because it does not match the required JSON Schema:\n- " +
+		strings.Join(problems, "\n- ") +
+		"\nFix your JSON: respond again with only the corrected JSON object."
+}
+
+// chatStructured runs one model turn asking for a structured response. A
+// response that does not match the schema gets up to maxJSONRetries turns to
+// be fixed and is rejected after that, stopping the agent with an error. The
+// retries are charged to the agent as they are made; the stats returned are
+// those of the last call.
+func (conv *agentConversation) chatStructured() (string, openrouter.CallStats, error) {
+	agent := conv.agent
+	schema := agentResponseSchema(agent.Role, config.AppConfig.ToolExecutionEnabled)
+	messages := append([]openrouter.Message(nil), conv.messages...)
+
+	for attempt := 0; ; attempt++ {
+		content, stats, err := openrouter.ChatStructuredWithSampling(messages, conv.req.Model, conv.req.Credentials["openrouter"], schema, conv.sampling())
+		if err != nil {
+			return "", stats, err
+		}
+		response, problems := parseStructuredResponse(schema, content)
+		if len(problems) == 0 {
+			if conv.stream {
+				models.Manager.PublishDelta(agent.ID, response)
+				ws.BroadcastAgentChunk(agent.ID, response)
+			}
+			return response, stats, nil
+		}
+		if attempt == maxJSONRetries {
+			return "", stats, fmt.Errorf("model response rejected: it did not match the response schema after %d attempts: %s", attempt+1, strings.Join(problems, "; "))
+		}
+
+		log.Printf("Agent %s: structured response rejected (attempt %d): %s", agent.ID, attempt+1, strings.Join(problems, "; "))
+		models.Manager.RecordLLMCall(agent.ID, stats.Latency, stats.BytesSent, stats.BytesReceived)
+		models.Manager.RecordLLMUsage(agent.ID, stats.PromptTokens, stats.CompletionTokens, stats.Cost)
+		if chargeAgentCall(agent, stats) {
+			return "", openrouter.CallStats{}, errAgentStopped
+		}
+		messages = append(messages,
+			openrouter.Message{Role: "assistant", Content: content},
+			openrouter.Message{Role: "user", Content: fixJSONPrompt(problems)},
+		)
+	}
+}
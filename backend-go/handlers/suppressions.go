@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/suppressions"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SuppressionRequest creates or updates a suppression. On update, omitted
+// fields are left unchanged. On create, FindingID takes the criteria from a
+// stored finding: its fingerprint, unless other criteria are given.
+type SuppressionRequest struct {
+	FindingID     string     `json:"finding_id"`
+	Fingerprint   *string    `json:"fingerprint"`
+	Target        *string    `json:"target"`
+	Category      *string    `json:"category"`
+	Justification *string    `json:"justification"`
+	Approver      *string    `json:"approver"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+}
+
+func (req *SuppressionRequest) apply(suppression *suppressions.Suppression) {
+	if req.Fingerprint != nil {
+		suppression.Fingerprint = *req.Fingerprint
+	}
+	if req.Target != nil {
+		suppression.Target = *req.Target
+	}
+	if req.Category != nil {
+		suppression.Category = *req.Category
+	}
+	if req.Justification != nil {
+		suppression.Justification = *req.Justification
+	}
+	if req.Approver != nil {
+		suppression.Approver = *req.Approver
+	}
+	if req.ExpiresAt != nil {
+		suppression.ExpiresAt = req.ExpiresAt
+	}
+}
+
+// InitSuppressions loads the accepted-risk register.
+func InitSuppressions() {
+	suppressions.Default.Load()
+}
+
+// GetSuppressions is the workspace's register of accepted risks: its active
+// suppressions, or with ?all=true its expired ones too.
+func GetSuppressions(c *fiber.Ctx) error {
+	list := suppressions.Default.List(currentWorkspace(c), c.QueryBool("all"))
+	return c.JSON(fiber.Map{
+		"suppressions": list,
+		"total":        len(list),
+	})
+}
+
+func GetSuppression(c *fiber.Ctx) error {
+	suppression, err := workspaceSuppression(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(suppression)
+}
+
+// CreateSuppression accepts a risk and suppresses the workspace's untriaged
+// findings that match it. The approver defaults to the requesting user.
+func CreateSuppression(c *fiber.Ctx) error {
+	var req SuppressionRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid suppression").
+			WithReason("expires_at must be in the future")
+	}
+
+	suppression := suppressions.Suppression{WorkspaceID: currentWorkspace(c)}
+	if user := currentUser(c); user != nil {
+		suppression.CreatedBy = user.Username
+		suppression.Approver = user.Username
+	}
+	if req.FindingID != "" {
+		finding := models.Findings.GetFinding(req.FindingID)
+		if finding == nil || !inWorkspace(c, finding.WorkspaceID) {
+			return apierror.New(404, apierror.NotFound, "Finding not found").With("finding_id", req.FindingID)
+		}
+		if req.Fingerprint == nil && req.Target == nil && req.Category == nil {
+			suppression.Fingerprint = finding.Fingerprint
+		}
+	}
+	req.apply(&suppression)
+
+	created, err := suppressions.Default.Create(suppression)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid suppression").WithReason(err)
+	}
+
+	swept := sweepSuppression(created)
+	result := suppressions.Default.Get(created.ID)
+	if result == nil {
+		result = created
+	}
+	return c.Status(201).JSON(fiber.Map{
+		"suppression": result,
+		"suppressed":  swept,
+	})
+}
+
+func UpdateSuppression(c *fiber.Ctx) error {
+	var req SuppressionRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if _, err := workspaceSuppression(c, c.Params("id")); err != nil {
+		return err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid suppression").
+			WithReason("expires_at must be in the future")
+	}
+
+	updated, err := suppressions.Default.Update(c.Params("id"), req.apply)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid suppression").WithReason(err)
+	}
+	if updated == nil {
+		return apierror.New(404, apierror.NotFound, "Suppression not found")
+	}
+	return c.JSON(updated)
+}
+
+// DeleteSuppression revokes a suppression. Findings it already suppressed
+// keep their status; later matching findings are reported as new again.
+func DeleteSuppression(c *fiber.Ctx) error {
+	if _, err := workspaceSuppression(c, c.Params("id")); err != nil {
+		return err
+	}
+	suppressions.Default.Delete(c.Params("id"))
+	return c.JSON(fiber.Map{
+		"message": "Suppression deleted",
+	})
+}
+
+// sweepSuppression suppresses the stored untriaged findings of the
+// suppression's workspace that match it and returns how many it suppressed.
+func sweepSuppression(suppression *suppressions.Suppression) int {
+	findings, _ := models.Findings.Query(models.FindingFilter{
+		WorkspaceID: suppression.WorkspaceID,
+		Status:      "new",
+	})
+	swept := 0
+	for _, finding := range findings {
+		if !suppression.Matches(finding) {
+			continue
+		}
+		if models.Findings.UpdateFinding(finding.ID, func(f *models.Finding) {
+			if f.Status == "new" {
+				suppressions.Suppress(f, suppression)
+			}
+		}) != nil {
+			swept++
+		}
+	}
+	if swept > 0 {
+		suppressions.Default.RecordMatches(suppression.ID, swept)
+	}
+	return swept
+}
+
+func workspaceSuppression(c *fiber.Ctx, id string) (*suppressions.Suppression, error) {
+	suppression := suppressions.Default.Get(id)
+	if suppression == nil || !inWorkspace(c, suppression.WorkspaceID) {
+		return nil, apierror.New(404, apierror.NotFound, "Suppression not found").With("suppression_id", id)
+	}
+	return suppression, nil
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/targets"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	TargetAllocationShard     = "shard"
+	TargetAllocationPerTarget = "per_target"
+)
+
+// operationTargets returns the targets an operation runs against. A request
+// with only the single target field keeps it as is; a targets list (plus
+// target, if set) is validated and CIDRs are expanded.
+func operationTargets(req models.StartRequest) ([]string, error) {
+	if len(req.Targets) == 0 {
+		if req.Target == "" {
+			return nil, fmt.Errorf("target is required")
+		}
+		return []string{req.Target}, nil
+	}
+
+	entries := req.Targets
+	if req.Target != "" {
+		entries = append([]string{req.Target}, entries...)
+	}
+	return targets.Expand(entries)
+}
+
+// allocateTargets decides which targets each agent covers. Sharding keeps the
+// requested agent count: with fewer targets than agents several agents share
+// a target, otherwise targets are dealt out round-robin. Per-target
+// allocation gives every target its own agentCount agents.
+func allocateTargets(operationTargets []string, agentCount int, allocation string) ([][]string, error) {
+	switch allocation {
+	case "", TargetAllocationShard:
+		shards := make([][]string, agentCount)
+		if len(operationTargets) <= agentCount {
+			for i := range shards {
+				shards[i] = []string{operationTargets[i%len(operationTargets)]}
+			}
+			return shards, nil
+		}
+		for i, target := range operationTargets {
+			shards[i%agentCount] = append(shards[i%agentCount], target)
+		}
+		return shards, nil
+
+	case TargetAllocationPerTarget:
+		total := len(operationTargets) * agentCount
+		if total > maxAgentsPerOperation {
+			return nil, fmt.Errorf("per_target allocation needs %d agents for %d targets, the limit is %d", total, len(operationTargets), maxAgentsPerOperation)
+		}
+		shards := make([][]string, 0, total)
+		for _, target := range operationTargets {
+			for i := 0; i < agentCount; i++ {
+				shards = append(shards, []string{target})
+			}
+		}
+		return shards, nil
+
+	default:
+		return nil, fmt.Errorf("unknown target_allocation %q, expected %s or %s", allocation, TargetAllocationShard, TargetAllocationPerTarget)
+	}
+}
+
+// summarizeTargets is the operation's display target for a target list.
+func summarizeTargets(operationTargets []string) string {
+	if len(operationTargets) == 1 {
+		return operationTargets[0]
+	}
+	return fmt.Sprintf("%s (+%d more)", operationTargets[0], len(operationTargets)-1)
+}
+
+// ImportTargets parses an uploaded targets file, newline-delimited or CSV,
+// sent either as the multipart field "file" or as the raw request body. With
+// ?expand=true CIDRs are expanded as they would be for an operation.
+func ImportTargets(c *fiber.Ctx) error {
+	data := c.Body()
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Failed to read uploaded file").WithReason(err)
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Failed to read uploaded file").WithReason(err)
+		}
+	}
+
+	entries, err := targets.Parse(data)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid targets file").WithReason(err)
+	}
+
+	validated, err := targets.Expand(entries)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid targets").WithReason(err)
+	}
+
+	response := fiber.Map{
+		"targets": entries,
+		"count":   len(entries),
+	}
+	if c.QueryBool("expand") {
+		response["expanded"] = validated
+		response["expanded_count"] = len(validated)
+	}
+	return c.JSON(response)
+}
+
+// TargetRollup summarizes the progress and findings of the agents working on
+// one target of an operation.
+type TargetRollup struct {
+	Target   string         `json:"target"`
+	AgentIDs []string       `json:"agent_ids"`
+	Status   string         `json:"status"`
+	Progress int            `json:"progress"`
+	Findings int            `json:"findings"`
+	Severity map[string]int `json:"severity_summary"`
+}
+
+// targetRollups groups an operation's agents and findings by target. A
+// finding counts towards the target it names, or towards its agent's target
+// when the agent covers only one.
+func targetRollups(op *models.Operation) []TargetRollup {
+	operationTargets := op.Targets
+	if len(operationTargets) == 0 {
+		operationTargets = []string{op.Target}
+	}
+
+	rollups := make([]TargetRollup, len(operationTargets))
+	index := make(map[string]int, len(operationTargets))
+	for i, target := range operationTargets {
+		rollups[i] = TargetRollup{Target: target, AgentIDs: []string{}, Severity: map[string]int{}}
+		index[target] = i
+	}
+
+	progress := make([]int, len(rollups))
+	states := make([]map[models.AgentStatus]int, len(rollups))
+	for i := range states {
+		states[i] = make(map[models.AgentStatus]int)
+	}
+
+	agentIDs, assignments := models.Operations.GetAssignments(op.ID)
+	for _, agentID := range agentIDs {
+		agent := models.Manager.GetAgent(agentID)
+		if agent == nil {
+			continue
+		}
+		assigned := assignments[agentID]
+		if len(assigned) == 0 {
+			assigned = operationTargets
+		}
+
+		for _, target := range assigned {
+			i, ok := index[target]
+			if !ok {
+				continue
+			}
+			rollups[i].AgentIDs = append(rollups[i].AgentIDs, agentID)
+			progress[i] += agent.Progress
+			states[i][agent.Status]++
+		}
+
+		findings, _ := models.Findings.Query(models.FindingFilter{AgentID: agentID})
+		for _, finding := range findings {
+			i, ok := index[finding.Target]
+			if !ok {
+				if len(assigned) != 1 {
+					continue
+				}
+				i = index[assigned[0]]
+			}
+			rollups[i].Findings++
+			rollups[i].Severity[string(finding.Severity)]++
+		}
+	}
+
+	for i := range rollups {
+		if n := len(rollups[i].AgentIDs); n > 0 {
+			rollups[i].Progress = progress[i] / n
+		}
+		rollups[i].Status = rollupStatus(states[i])
+	}
+	return rollups
+}
+
+func rollupStatus(states map[models.AgentStatus]int) string {
+	switch {
+	case len(states) == 0:
+		return "pending"
+	case states[models.AgentStatusRunning] > 0 || states[models.AgentStatusIdle] > 0:
+		return string(models.AgentStatusRunning)
+	case states[models.AgentStatusPaused] > 0:
+		return string(models.AgentStatusPaused)
+	case states[models.AgentStatusThrottled] > 0:
+		return string(models.AgentStatusThrottled)
+	case states[models.AgentStatusError] > 0 && states[models.AgentStatusComplete] == 0:
+		return string(models.AgentStatusError)
+	default:
+		return string(models.AgentStatusComplete)
+	}
+}
+
+func GetOperationTargets(c *fiber.Ctx) error {
+	op := models.Operations.GetOperation(c.Params("id"))
+	if op == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+
+	rollups := targetRollups(op)
+	return c.JSON(fiber.Map{
+		"operation_id": op.ID,
+		"allocation":   op.Request.TargetAllocation,
+		"targets":      rollups,
+		"total":        len(rollups),
+	})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+
+	"performa-backend/apierror"
+	"performa-backend/telemetry"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// TraceRequests records a server span for every request when tracing is
+// enabled, continuing the caller's trace when it sends a traceparent header.
+// Handlers reach the span through c.UserContext(). Errors are rendered here,
+// as the logger middleware does, so that the span carries the status the
+// client gets.
+func TraceRequests(c *fiber.Ctx) error {
+	if !telemetry.TracingEnabled() {
+		return c.Next()
+	}
+
+	ctx := telemetry.Extract(c.UserContext(), c.Get(telemetry.TraceparentHeader))
+	ctx, span := telemetry.Start(ctx, c.Method(), telemetry.SpanServer)
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+	if err != nil {
+		if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+			c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+
+	status := c.Response().StatusCode()
+	route := c.Route().Path
+	span.SetAttribute("http.request.method", c.Method())
+	span.SetAttribute("http.route", route)
+	span.SetAttribute("url.path", c.Path())
+	span.SetAttribute("http.response.status_code", status)
+	span.SetAttribute("client.address", c.IP())
+	span.SetAttribute("user_agent.original", c.Get(fiber.HeaderUserAgent))
+	if requestID, ok := c.Locals(apierror.RequestIDLocalsKey).(string); ok {
+		span.SetAttribute("performa.request_id", requestID)
+	}
+	span.SetAttribute("performa.workspace", currentWorkspace(c))
+	span.SetName(c.Method() + " " + route)
+
+	if status >= fiber.StatusInternalServerError {
+		span.End(fmt.Errorf("%d %s", status, utils.StatusMessage(status)))
+	} else {
+		span.End(nil)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/executor"
+	"performa-backend/models"
+	"performa-backend/timeline"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultTimelineLimit = 200
+	maxTimelineLimit     = 1000
+)
+
+// recordAgentEvent adds an event about agent to its operation's timeline.
+func recordAgentEvent(agent *models.Agent, eventType, actor, summary string, data map[string]interface{}) {
+	if agent == nil {
+		return
+	}
+	timeline.Record(timeline.Event{
+		OperationID: agent.OperationID,
+		AgentID:     agent.ID,
+		Type:        eventType,
+		Actor:       actor,
+		Summary:     summary,
+		Data:        data,
+	})
+}
+
+// recordAgentStatus records an agent moving to status.
+func recordAgentStatus(agent *models.Agent, actor string, status models.AgentStatus, reason string) {
+	data := map[string]interface{}{"scope": "agent", "status": status}
+	summary := fmt.Sprintf("%s is now %s", agent.Name, status)
+	if reason != "" {
+		data["reason"] = reason
+		summary += ": " + reason
+	}
+	recordAgentEvent(agent, timeline.EventStatusChanged, actor, summary, data)
+}
+
+// RecordOperatorAction records an operator acting on an agent, from the REST
+// or gRPC API.
+func RecordOperatorAction(agent *models.Agent, action string, data map[string]interface{}) {
+	if agent == nil {
+		return
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["action"] = action
+	recordAgentEvent(agent, timeline.EventOperatorAction, timeline.ActorOperator,
+		fmt.Sprintf("Operator %s %s", pastTense(action), agent.Name), data)
+}
+
+func pastTense(action string) string {
+	switch action {
+	case "stop":
+		return "stopped"
+	case "chat":
+		return "messaged"
+	case "retry":
+		return "retried"
+	}
+	if strings.HasSuffix(action, "e") {
+		return action + "d"
+	}
+	return action + "ed"
+}
+
+func recordToolEvent(agent *models.Agent, tool string, result *executor.Result) {
+	data := map[string]interface{}{
+		"tool":        tool,
+		"command":     result.Command,
+		"exit_code":   result.ExitCode,
+		"duration_ms": result.DurationMs,
+	}
+	if result.Error != "" {
+		data["error"] = result.Error
+	}
+	recordAgentEvent(agent, timeline.EventToolExecuted, timeline.ActorAgent,
+		fmt.Sprintf("%s ran %s (exit %d)", agent.Name, tool, result.ExitCode), data)
+}
+
+func recordFindingEvent(finding *models.Finding) {
+	agent := models.Manager.GetAgent(finding.AgentID)
+	if agent == nil {
+		return
+	}
+	recordAgentEvent(agent, timeline.EventFindingCreated, timeline.ActorAgent,
+		fmt.Sprintf("[%s] %s", finding.Severity, finding.Title), map[string]interface{}{
+			"finding_id": finding.ID,
+			"severity":   finding.Severity,
+			"target":     finding.Target,
+		})
+}
+
+// refreshOperationStatus recomputes an operation's status from its agents and
+// records the change on its timeline.
+func refreshOperationStatus(operationID string) {
+	op := models.Operations.GetOperation(operationID)
+	if op == nil {
+		return
+	}
+	before := op.Status
+	models.Operations.RefreshStatus(operationID)
+	if op = models.Operations.GetOperation(operationID); op == nil || op.Status == before {
+		return
+	}
+	if op.Status != models.OperationStatusRunning {
+		restoreOperationNetwork(operationID)
+		if before == models.OperationStatusRunning {
+			go notifyOperationFinished(op)
+		}
+	}
+	timeline.Record(timeline.Event{
+		OperationID: operationID,
+		Type:        timeline.EventStatusChanged,
+		Summary:     fmt.Sprintf("Operation is now %s", op.Status),
+		Data: map[string]interface{}{
+			"scope":    "operation",
+			"status":   op.Status,
+			"previous": before,
+		},
+	})
+}
+
+// GetOperationTimeline lists an operation's events in chronological order.
+// ?type= takes a comma-separated list of event types; agent_id, since, until,
+// limit and offset narrow the page further.
+func GetOperationTimeline(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if models.Operations.GetOperation(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Operation not found")
+	}
+
+	filter := timeline.Filter{
+		AgentID: c.Query("agent_id"),
+		Limit:   c.QueryInt("limit", defaultTimelineLimit),
+		Offset:  c.QueryInt("offset", 0),
+	}
+	if filter.Limit <= 0 || filter.Limit > maxTimelineLimit {
+		filter.Limit = defaultTimelineLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	if types := c.Query("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			t = strings.TrimSpace(strings.ToLower(t))
+			if t == "" {
+				continue
+			}
+			if !isInSlice(t, timeline.EventTypes) {
+				return apierror.New(400, apierror.ValidationFailed, fmt.Sprintf("invalid type: must be one of %s", strings.Join(timeline.EventTypes, ", ")))
+			}
+			filter.Types = append(filter.Types, t)
+		}
+	}
+
+	for param, dest := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeParam(value)
+		if err != nil {
+			return apierror.New(400, apierror.ValidationFailed, fmt.Sprintf("invalid %s: expected RFC3339 or YYYY-MM-DD", param))
+		}
+		*dest = &t
+	}
+
+	events, total := timeline.Default.Query(id, filter)
+	return c.JSON(fiber.Map{
+		"operation_id": id,
+		"events":       events,
+		"total":        total,
+		"limit":        filter.Limit,
+		"offset":       filter.Offset,
+		"has_more":     filter.Offset+len(events) < total,
+	})
+}
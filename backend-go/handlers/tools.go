@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/executor"
+	"performa-backend/tools"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetAvailableTools reports which allowed tools are installed and their
+// versions. ?refresh=true probes again instead of using the startup report.
+func GetAvailableTools(c *fiber.Ctx) error {
+	var report *tools.Report
+	if c.QueryBool("refresh") {
+		report = tools.Probe()
+	} else {
+		report = tools.Availability()
+	}
+
+	return c.JSON(fiber.Map{
+		"os":           report.OS,
+		"execution_os": executor.OS(),
+		"tools":        report.Tools,
+		"total":        len(report.Tools),
+		"available":    report.Available,
+		"missing":      report.Missing,
+		"probed_at":    report.ProbedAt,
+	})
+}
+
+const maxInstallLogLines = 200
+
+// ToolInstallJob tracks the installation of one tool.
+type ToolInstallJob struct {
+	ID         string                 `json:"id"`
+	Tool       string                 `json:"tool"`
+	Location   string                 `json:"location"`
+	Status     string                 `json:"status"`
+	Strategy   *tools.InstallStrategy `json:"strategy,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Log        []string               `json:"log"`
+	CreatedAt  time.Time              `json:"created_at"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+}
+
+var (
+	installJobs   = make(map[string]*ToolInstallJob)
+	installJobsMu sync.RWMutex
+	// installMu runs one installation at a time; package managers take
+	// exclusive locks anyway.
+	installMu sync.Mutex
+)
+
+type ToolInstallRequest struct {
+	Tools []string `json:"tools"`
+	// Container installs into TOOL_INSTALL_CONTAINER instead of the host.
+	Container bool `json:"container"`
+}
+
+// installAllowed reports whether tool may be installed: it must be in the
+// manifest and, when TOOL_INSTALL_ALLOWLIST is set, in the allowlist.
+func installAllowed(tool string) bool {
+	if _, ok := tools.InstallManifest[tool]; !ok {
+		return false
+	}
+	allowlist := config.AppConfig.ToolInstallAllowlist
+	if len(allowlist) == 0 {
+		return true
+	}
+	for _, allowed := range allowlist {
+		if allowed == tool {
+			return true
+		}
+	}
+	return false
+}
+
+// GetInstallableTools lists the tools the installer may install and whether
+// installation is enabled.
+func GetInstallableTools(c *fiber.Ctx) error {
+	installable := make([]fiber.Map, 0)
+	for _, name := range tools.Installable() {
+		if installAllowed(name) {
+			installable = append(installable, fiber.Map{
+				"name":       name,
+				"strategies": tools.InstallManifest[name],
+			})
+		}
+	}
+	return c.JSON(fiber.Map{
+		"enabled":   config.AppConfig.ToolInstallEnabled,
+		"container": config.AppConfig.ToolInstallContainer,
+		"tools":     installable,
+		"total":     len(installable),
+	})
+}
+
+// InstallTools queues installation of the requested tools. Output streams over
+// WebSocket as "tool_install" messages and the jobs can be polled.
+func InstallTools(c *fiber.Ctx) error {
+	if !config.AppConfig.ToolInstallEnabled {
+		return apierror.New(403, apierror.Forbidden, "Tool installation is disabled; set tool_install_enabled to allow it")
+	}
+
+	var req ToolInstallRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if len(req.Tools) == 0 {
+		return apierror.New(400, apierror.ValidationFailed, "tools is required")
+	}
+
+	installer := tools.Installer{}
+	location := "host"
+	if req.Container {
+		if config.AppConfig.ToolInstallContainer == "" {
+			return apierror.New(400, apierror.ValidationFailed, "No install container configured (TOOL_INSTALL_CONTAINER)")
+		}
+		installer.Container = config.AppConfig.ToolInstallContainer
+		location = "container:" + installer.Container
+	}
+
+	var rejected []string
+	for _, tool := range req.Tools {
+		if !installAllowed(tool) {
+			rejected = append(rejected, tool)
+		}
+	}
+	if len(rejected) > 0 {
+		return apierror.New(400, apierror.ValidationFailed, "Tools not installable").WithReason(strings.Join(rejected, ", "))
+	}
+
+	jobs := make([]*ToolInstallJob, 0, len(req.Tools))
+	installJobsMu.Lock()
+	for _, tool := range req.Tools {
+		job := &ToolInstallJob{
+			ID:        uuid.New().String(),
+			Tool:      tool,
+			Location:  location,
+			Status:    "queued",
+			Log:       []string{},
+			CreatedAt: time.Now(),
+		}
+		installJobs[job.ID] = job
+		jobs = append(jobs, job)
+	}
+	installJobsMu.Unlock()
+
+	for _, job := range jobs {
+		go runInstallJob(installer, job.ID)
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"jobs": jobs,
+	})
+}
+
+func runInstallJob(installer tools.Installer, jobID string) {
+	installMu.Lock()
+	defer installMu.Unlock()
+
+	job := getInstallJob(jobID)
+	updateInstallJob(jobID, func(job *ToolInstallJob) { job.Status = "running" })
+	ws.BroadcastToolInstall(jobID, job.Tool, "running", "Installation started")
+
+	strategy, err := installer.Install(context.Background(), job.Tool, func(line string) {
+		updateInstallJob(jobID, func(job *ToolInstallJob) {
+			job.Log = append(job.Log, line)
+			if len(job.Log) > maxInstallLogLines {
+				job.Log = job.Log[len(job.Log)-maxInstallLogLines:]
+			}
+		})
+		ws.BroadcastToolInstall(jobID, job.Tool, "running", line)
+	})
+
+	status, message := "succeeded", fmt.Sprintf("%s installed", job.Tool)
+	if err != nil {
+		status, message = "failed", err.Error()
+		log.Printf("Tool install %s (%s) failed: %v", job.Tool, job.Location, err)
+	}
+	updateInstallJob(jobID, func(job *ToolInstallJob) {
+		now := time.Now()
+		job.Status = status
+		job.FinishedAt = &now
+		if strategy.Manager != "" {
+			job.Strategy = &strategy
+		}
+		if err != nil {
+			job.Error = err.Error()
+		}
+	})
+	ws.BroadcastToolInstall(jobID, job.Tool, status, message)
+
+	if err == nil && installer.Container == "" {
+		tools.Probe()
+	}
+}
+
+func getInstallJob(id string) *ToolInstallJob {
+	installJobsMu.RLock()
+	defer installJobsMu.RUnlock()
+
+	job, ok := installJobs[id]
+	if !ok {
+		return nil
+	}
+	copied := *job
+	copied.Log = append([]string{}, job.Log...)
+	return &copied
+}
+
+func updateInstallJob(id string, update func(*ToolInstallJob)) {
+	installJobsMu.Lock()
+	defer installJobsMu.Unlock()
+
+	if job, ok := installJobs[id]; ok {
+		update(job)
+	}
+}
+
+func GetToolInstallJob(c *fiber.Ctx) error {
+	job := getInstallJob(c.Params("id"))
+	if job == nil {
+		return apierror.New(404, apierror.NotFound, "Install job not found")
+	}
+	return c.JSON(job)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"performa-backend/apierror"
+	"performa-backend/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseBody decodes the request body into out and validates it against its
+// `validate` tags. An empty body leaves out as it is and is validated as such,
+// so that requests whose fields are all optional may omit it.
+func parseBody(c *fiber.Ctx, out interface{}) error {
+	if err := decodeBody(c, out); err != nil {
+		return err
+	}
+	if problems := validation.Struct(out); len(problems) > 0 {
+		return validationError("Validation failed", problems)
+	}
+	return nil
+}
+
+// decodeBody decodes the request body into out without validating it, for
+// handlers that validate it along with checks the tags cannot express.
+func decodeBody(c *fiber.Ctx, out interface{}) error {
+	if len(c.Body()) == 0 {
+		return nil
+	}
+	if err := c.BodyParser(out); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid request body").WithReason(err)
+	}
+	return nil
+}
+
+// validationError reports invalid fields as a 422 with their problems listed
+// under the "fields" detail.
+func validationError(message string, problems []validation.FieldError) error {
+	return apierror.New(422, apierror.ValidationFailed, message).With("fields", problems)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/wordlists"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultWordlistPreview = 50
+	maxWordlistPreview     = 1000
+	// maxPromptWordlists bounds the lists named in an agent's prompt.
+	maxPromptWordlists = 20
+)
+
+// InitWordlists points the wordlist store at WORDLISTS_DIR, writing out the
+// built-in lists and loading the uploaded ones.
+func InitWordlists() {
+	wordlists.Default.Configure(config.AppConfig.WordlistsDir)
+	if err := wordlists.Default.Load(); err != nil {
+		log.Printf("Wordlists: %v", err)
+	}
+}
+
+// validateWordlistSelection checks that the lists an operation selects exist,
+// lowercasing their names.
+func validateWordlistSelection(names []string) error {
+	var unknown []string
+	for i, name := range names {
+		names[i] = strings.ToLower(strings.TrimSpace(name))
+		if wordlists.Default.Get(names[i]) == nil {
+			unknown = append(unknown, names[i])
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown wordlists: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// expandAgentCommand replaces the wordlist and target placeholders of a
+// command with the lists the operation selects and the agent's target.
+func expandAgentCommand(agent *models.Agent, req models.StartRequest, args []string) (wordlists.Expansion, error) {
+	return wordlists.Default.ExpandArgs(args, wordlists.ParseTarget(agentHost(agent)), req.Wordlists)
+}
+
+// wordlistPrompt tells an agent how to reference wordlists and target
+// placeholders in its commands.
+func wordlistPrompt(req models.StartRequest) string {
+	names := req.Wordlists
+	if len(names) == 0 {
+		for _, list := range wordlists.Default.List() {
+			names = append(names, list.Name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	more := ""
+	if len(names) > maxPromptWordlists {
+		more = fmt.Sprintf(" and %d more", len(names)-maxPromptWordlists)
+		names = names[:maxPromptWordlists]
+	}
+	return fmt.Sprintf(`
+Wordlists: pass "{{wordlist:NAME}}" where a tool expects a wordlist file (for example "RUN: ffuf -u {{url}}/FUZZ -w {{wordlist:common-dirs}}"). Available: %s%s.
+"{{target}}", "{{url}}", "{{host}}" and "{{domain}}" in a command are replaced with your target.`, strings.Join(names, ", "), more)
+}
+
+// GetWordlists lists the stored wordlists.
+func GetWordlists(c *fiber.Ctx) error {
+	lists := wordlists.Default.List()
+	return c.JSON(fiber.Map{
+		"wordlists": lists,
+		"total":     len(lists),
+	})
+}
+
+// GetWordlist returns a wordlist with its first ?limit entries, expanded for
+// ?target when the list is templated.
+func GetWordlist(c *fiber.Ctx) error {
+	name := strings.ToLower(c.Params("name"))
+	list := wordlists.Default.Get(name)
+	if list == nil {
+		return apierror.New(404, apierror.NotFound, "Wordlist not found")
+	}
+	limit := c.QueryInt("limit", defaultWordlistPreview)
+	if limit <= 0 || limit > maxWordlistPreview {
+		limit = defaultWordlistPreview
+	}
+
+	entries, err := wordlists.Default.Preview(name, wordlists.ParseTarget(c.Query("target")), limit)
+	if err != nil {
+		return apierror.New(409, apierror.Conflict, "Wordlist failed its integrity check").WithReason(err)
+	}
+	return c.JSON(fiber.Map{
+		"wordlist": list,
+		"entries":  entries,
+	})
+}
+
+// UploadWordlist stores a wordlist sent as the multipart field "file" or as
+// the raw request body, named by the "name" form field or ?name=.
+func UploadWordlist(c *fiber.Ctx) error {
+	name := c.FormValue("name", c.Query("name"))
+	description := c.FormValue("description", c.Query("description"))
+	if strings.TrimSpace(name) == "" {
+		return apierror.New(400, apierror.ValidationFailed, "name is required")
+	}
+
+	data := c.Body()
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Multipart field 'file' is required")
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Failed to read uploaded file").WithReason(err)
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(io.LimitReader(file, wordlists.MaxSize+1)); err != nil {
+			return apierror.New(400, apierror.ValidationFailed, "Failed to read uploaded file").WithReason(err)
+		}
+	}
+
+	list, err := wordlists.Default.Add(name, description, data)
+	switch {
+	case errors.Is(err, wordlists.ErrExists), errors.Is(err, wordlists.ErrBuiltin):
+		return apierror.New(409, apierror.Conflict, "Wordlist already exists").WithReason(err).With("name", name)
+	case err != nil:
+		return apierror.New(422, apierror.ValidationFailed, "Invalid wordlist").WithReason(err)
+	}
+	return c.Status(201).JSON(list)
+}
+
+// DeleteWordlist removes an uploaded wordlist; built-in lists stay.
+func DeleteWordlist(c *fiber.Ctx) error {
+	err := wordlists.Default.Delete(strings.ToLower(c.Params("name")))
+	switch {
+	case errors.Is(err, wordlists.ErrNotFound):
+		return apierror.New(404, apierror.NotFound, "Wordlist not found")
+	case errors.Is(err, wordlists.ErrBuiltin):
+		return apierror.New(409, apierror.Conflict, "Built-in wordlists cannot be deleted")
+	case err != nil:
+		return apierror.New(500, apierror.Internal, "Failed to delete wordlist").WithReason(err)
+	}
+	return c.JSON(fiber.Map{"message": "Wordlist deleted"})
+}
+
+// VerifyWordlists re-hashes every wordlist, or those in ?names=, against
+// its recorded SHA-256; built-in lists that fail are restored.
+func VerifyWordlists(c *fiber.Ctx) error {
+	checks := wordlists.Default.Verify(queryList(c, "names")...)
+	failed := 0
+	for _, check := range checks {
+		if !check.OK {
+			failed++
+		}
+	}
+	return c.JSON(fiber.Map{
+		"checks": checks,
+		"failed": failed,
+	})
+}
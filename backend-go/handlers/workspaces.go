@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"strings"
+
+	"performa-backend/apierror"
+	"performa-backend/models"
+	"performa-backend/workspaces"
+	"performa-backend/ws"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	workspaceLocalsKey = "workspace"
+	apiKeyLocalsKey    = "api_key_workspace"
+
+	apiKeyHeader    = "X-API-Key"
+	workspaceHeader = "X-Workspace-ID"
+)
+
+// currentWorkspace returns the workspace the request selected.
+func currentWorkspace(c *fiber.Ctx) string {
+	if id, ok := c.Locals(workspaceLocalsKey).(string); ok && id != "" {
+		return id
+	}
+	return workspaces.DefaultID
+}
+
+// inWorkspace reports whether a resource of workspaceID belongs to the
+// request's workspace. Resources without a workspace belong to the default
+// one.
+func inWorkspace(c *fiber.Ctx, workspaceID string) bool {
+	return workspaces.Normalize(workspaceID) == currentWorkspace(c)
+}
+
+// authenticateAPIKey checks a workspace API key and pins the request to the
+// key's workspace. It reports false for an unknown key.
+func authenticateAPIKey(c *fiber.Ctx, key string) bool {
+	workspace := workspaces.Default.ResolveAPIKey(key)
+	if workspace == nil {
+		return false
+	}
+	c.Locals(apiKeyLocalsKey, workspace.ID)
+	return true
+}
+
+// canAccessWorkspace reports whether the request may select a workspace: an
+// API key only reaches its own, and users other than admins only the
+// workspaces they are members of.
+func canAccessWorkspace(c *fiber.Ctx, workspace *workspaces.Workspace) bool {
+	if pinned, ok := c.Locals(apiKeyLocalsKey).(string); ok {
+		return workspace.ID == pinned
+	}
+	if claims := currentUser(c); claims != nil && !claims.IsAdmin() {
+		return workspace.HasMember(claims.UserID())
+	}
+	return true
+}
+
+// ResolveWorkspace selects the workspace of a request from the X-Workspace-ID
+// header or the ?workspace= parameter, defaulting to the default workspace;
+// requests made with an API key use the key's workspace.
+func ResolveWorkspace(c *fiber.Ctx) error {
+	if isPublicPath(c.Path()) || c.Method() == fiber.MethodOptions {
+		return c.Next()
+	}
+
+	requested := strings.TrimSpace(c.Get(workspaceHeader, c.Query("workspace")))
+	if pinned, ok := c.Locals(apiKeyLocalsKey).(string); ok && requested == "" {
+		requested = pinned
+	}
+
+	workspace := workspaces.Default.Get(requested)
+	if workspace == nil {
+		return apierror.New(404, apierror.NotFound, "Workspace not found")
+	}
+	if !canAccessWorkspace(c, workspace) {
+		return apierror.New(403, apierror.Forbidden, "Access to this workspace is not allowed")
+	}
+
+	c.Locals(workspaceLocalsKey, workspace.ID)
+	return c.Next()
+}
+
+func operationWorkspace(operationID string) string {
+	if op := models.Operations.GetOperation(operationID); op != nil {
+		return op.WorkspaceID
+	}
+	return workspaces.DefaultID
+}
+
+// AgentWorkspace returns the workspace an agent belongs to: its own, else
+// its operation's, else the default one.
+func AgentWorkspace(agentID string) string {
+	agent := models.Manager.GetAgent(agentID)
+	switch {
+	case agent == nil:
+		return workspaces.DefaultID
+	case agent.WorkspaceID != "":
+		return agent.WorkspaceID
+	case agent.OperationID != "":
+		return operationWorkspace(agent.OperationID)
+	}
+	return workspaces.DefaultID
+}
+
+// scopeToWorkspace returns middleware for routes addressing a resource by
+// :id. A resource of another workspace is reported as not found, exactly like
+// one that does not exist. lookup returns the resource's workspace, or false
+// when there is no such resource, which the handler then reports itself.
+func scopeToWorkspace(notFound string, lookup func(id string) (string, bool)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if workspace, ok := lookup(c.Params("id")); ok && !inWorkspace(c, workspace) {
+			return apierror.New(404, apierror.NotFound, notFound)
+		}
+		return c.Next()
+	}
+}
+
+var (
+	OperationInWorkspace = scopeToWorkspace("Operation not found", func(id string) (string, bool) {
+		op := models.Operations.GetOperation(id)
+		if op == nil {
+			return "", false
+		}
+		return op.WorkspaceID, true
+	})
+	AgentInWorkspace = scopeToWorkspace("Agent not found", func(id string) (string, bool) {
+		if models.Manager.GetAgent(id) == nil {
+			return "", false
+		}
+		return AgentWorkspace(id), true
+	})
+	FindingInWorkspace = scopeToWorkspace("Finding not found", func(id string) (string, bool) {
+		finding := models.Findings.GetFinding(id)
+		if finding == nil {
+			return "", false
+		}
+		return finding.WorkspaceID, true
+	})
+	ConfigInWorkspace = scopeToWorkspace("Config not found", func(id string) (string, bool) {
+		config := resolveSavedConfig(id)
+		if config == nil {
+			return "", false
+		}
+		return config.WorkspaceID, true
+	})
+	SessionInWorkspace = scopeToWorkspace("Session not found", func(id string) (string, bool) {
+		session := findSession(id)
+		if session == nil {
+			return "", false
+		}
+		return session.WorkspaceID, true
+	})
+)
+
+// messageWorkspace maps WebSocket messages about an agent or operation to
+// its workspace so that only that workspace's clients receive them.
+func messageWorkspace(message ws.WSMessage) string {
+	switch {
+	case message.AgentID != "":
+		return AgentWorkspace(message.AgentID)
+	case message.Type == "timeline_event" || message.Type == "blackboard_update":
+		return operationWorkspace(message.Message)
+	case message.Type == "finding_remediated" || message.Type == "finding_retested":
+		if finding := models.Findings.GetFinding(message.Message); finding != nil {
+			return finding.WorkspaceID
+		}
+	}
+	return ""
+}
+
+// InitWorkspaces loads the workspaces and scopes WebSocket broadcasts and
+// commands to them.
+func InitWorkspaces() {
+	workspaces.Default.Load()
+	ws.WorkspaceOf = messageWorkspace
+	ws.ExecuteCommand = executeWSCommand
+	ws.IdentifyClient = identifyWSClient
+}
+
+type WorkspaceRequest struct {
+	ID          string   `json:"id"`
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Members     []string `json:"members"`
+}
+
+// GetWorkspaces lists the workspaces the request may select.
+func GetWorkspaces(c *fiber.Ctx) error {
+	visible := make([]*workspaces.Workspace, 0)
+	for _, workspace := range workspaces.Default.GetAll() {
+		if canAccessWorkspace(c, workspace) {
+			visible = append(visible, workspace)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"workspaces": visible,
+		"current":    currentWorkspace(c),
+		"total":      len(visible),
+	})
+}
+
+func GetWorkspace(c *fiber.Ctx) error {
+	workspace := workspaces.Default.Get(c.Params("id"))
+	if workspace == nil || !canAccessWorkspace(c, workspace) {
+		return apierror.New(404, apierror.NotFound, "Workspace not found")
+	}
+	return c.JSON(workspace)
+}
+
+func CreateWorkspace(c *fiber.Ctx) error {
+	var req WorkspaceRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	workspace := workspaces.Workspace{
+		ID:      strings.TrimSpace(req.ID),
+		Members: req.Members,
+	}
+	if req.Name != nil {
+		workspace.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		workspace.Description = *req.Description
+	}
+
+	created, err := workspaces.Default.Create(workspace)
+	if err != nil {
+		status := 400
+		if workspaces.Default.Get(workspace.ID) != nil {
+			status = 409
+		}
+		return apierror.Status(status, "Invalid workspace").WithReason(err)
+	}
+	return c.Status(201).JSON(created)
+}
+
+func UpdateWorkspace(c *fiber.Ctx) error {
+	var req WorkspaceRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	workspace, err := workspaces.Default.Update(c.Params("id"), req.Name, req.Description, req.Members)
+	if err != nil {
+		return apierror.New(400, apierror.ValidationFailed, "Invalid workspace").WithReason(err)
+	}
+	if workspace == nil {
+		return apierror.New(404, apierror.NotFound, "Workspace not found")
+	}
+	return c.JSON(workspace)
+}
+
+// DeleteWorkspace removes an empty workspace. Workspaces that still hold
+// operations or findings cannot be deleted, so their data is never orphaned
+// or exposed to a workspace later created with the same ID.
+func DeleteWorkspace(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if workspaces.Default.Get(id) == nil {
+		return apierror.New(404, apierror.NotFound, "Workspace not found")
+	}
+
+	for _, op := range models.Operations.GetAllOperations() {
+		if op.WorkspaceID == id {
+			return apierror.New(409, apierror.Conflict, "Workspace still has operations")
+		}
+	}
+	if findings, _ := models.Findings.Query(models.FindingFilter{WorkspaceID: id, Limit: 1}); len(findings) > 0 {
+		return apierror.New(409, apierror.Conflict, "Workspace still has findings")
+	}
+
+	if _, err := workspaces.Default.Delete(id); err != nil {
+		return apierror.New(400, apierror.ValidationFailed, err.Error())
+	}
+	return c.JSON(fiber.Map{
+		"message": "Workspace deleted",
+	})
+}
+
+// CreateWorkspaceAPIKey issues an API key for the workspace. The key is only
+// returned by this call.
+func CreateWorkspaceAPIKey(c *fiber.Ctx) error {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if workspaces.Default.Get(c.Params("id")) == nil {
+		return apierror.New(404, apierror.NotFound, "Workspace not found")
+	}
+	key, record, err := workspaces.Default.CreateAPIKey(c.Params("id"), req.Name)
+	if err != nil {
+		return apierror.New(500, apierror.Internal, "Failed to create API key").WithReason(err)
+	}
+	return c.Status(201).JSON(fiber.Map{
+		"key":     key,
+		"api_key": record,
+	})
+}
+
+func DeleteWorkspaceAPIKey(c *fiber.Ctx) error {
+	if !workspaces.Default.RevokeAPIKey(c.Params("id"), c.Params("keyId")) {
+		return apierror.New(404, apierror.NotFound, "API key not found")
+	}
+	return c.JSON(fiber.Map{
+		"message": "API key revoked",
+	})
+}
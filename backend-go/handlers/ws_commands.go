@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"performa-backend/auth"
+	"performa-backend/config"
+	"performa-backend/models"
+	"performa-backend/timeline"
+	"performa-backend/workspaces"
+	"performa-backend/ws"
+)
+
+// wsAgentActions maps WebSocket agent commands to the bulk agent actions
+// they share with the REST API.
+var wsAgentActions = map[string]string{
+	"pause_agent":  "pause",
+	"resume_agent": "resume",
+	"stop_agent":   "stop",
+}
+
+func commandError(code int, format string, args ...interface{}) ws.CommandResult {
+	return ws.CommandResult{Code: code, Error: fmt.Sprintf(format, args...)}
+}
+
+// authorizeCommand checks that the connection is still authenticated: a
+// workspace API key, or an access token that has not expired since the
+// connection was opened.
+func authorizeCommand(session ws.Session) *ws.CommandResult {
+	if _, ok := session.Locals(apiKeyLocalsKey).(string); ok || !config.AppConfig.AuthEnabled {
+		return nil
+	}
+	claims, ok := session.Locals(userLocalsKey).(*auth.Claims)
+	if !ok || claims == nil {
+		result := commandError(401, "authentication required")
+		return &result
+	}
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(time.Now()) {
+		result := commandError(401, "access token expired, reconnect with a fresh token")
+		return &result
+	}
+	return nil
+}
+
+// identifyWSClient returns who a WebSocket connection authenticated as, for
+// its presence.
+func identifyWSClient(locals func(key string) interface{}) ws.Identity {
+	if _, ok := locals(apiKeyLocalsKey).(string); ok {
+		return ws.Identity{APIKey: true}
+	}
+	if claims, ok := locals(userLocalsKey).(*auth.Claims); ok && claims != nil {
+		return ws.Identity{UserID: claims.UserID(), Username: claims.Username, Role: claims.Role}
+	}
+	return ws.Identity{}
+}
+
+// commandAudit returns the data recorded with an operator action taken over
+// WebSocket: the channel and who the connection authenticated as.
+func commandAudit(session ws.Session) map[string]interface{} {
+	data := map[string]interface{}{"channel": "websocket"}
+	switch identity := identifyWSClient(session.Locals); {
+	case identity.APIKey:
+		data["user"] = "api_key"
+	case identity.UserID != "":
+		data["user"] = identity.Username
+		data["user_id"] = identity.UserID
+	}
+	return data
+}
+
+// executeWSCommand runs an operator command sent over WebSocket. Commands
+// only reach agents and findings of the connection's workspace, like the
+// REST routes.
+func executeWSCommand(session ws.Session, command ws.Command) ws.CommandResult {
+	if denied := authorizeCommand(session); denied != nil {
+		return *denied
+	}
+	workspace := workspaces.Normalize(session.Workspace)
+
+	switch command.Action {
+	case "start_agent", "pause_agent", "resume_agent", "stop_agent":
+		agent := models.Manager.GetAgent(command.AgentID)
+		if agent == nil || AgentWorkspace(agent.ID) != workspace {
+			return commandError(404, "agent not found")
+		}
+		if command.Action == "start_agent" {
+			return startAgentCommand(session, agent)
+		}
+		return agentCommand(session, agent, wsAgentActions[command.Action])
+	case "acknowledge_finding":
+		finding := models.Findings.GetFinding(command.FindingID)
+		if finding == nil || workspaces.Normalize(finding.WorkspaceID) != workspace {
+			return commandError(404, "finding not found")
+		}
+		updated := models.Findings.UpdateFinding(finding.ID, func(f *models.Finding) {
+			f.Status = "acknowledged"
+		})
+		if updated == nil {
+			return commandError(404, "finding not found")
+		}
+		audit := commandAudit(session)
+		audit["action"] = "acknowledge"
+		audit["finding_id"] = updated.ID
+		recordAgentEvent(models.Manager.GetAgent(updated.AgentID), timeline.EventOperatorAction, timeline.ActorOperator,
+			fmt.Sprintf("Operator acknowledged finding %s", updated.Title), audit)
+		return ws.CommandResult{OK: true, Code: 200, Data: updated}
+	}
+	return commandError(400, "unknown action %q", command.Action)
+}
+
+// agentCommand applies a pause, resume or stop action to an agent.
+func agentCommand(session ws.Session, agent *models.Agent, action string) ws.CommandResult {
+	done, reason := bulkAgentActions[action](agent.ID)
+	if !done {
+		return commandError(409, "%s", reason)
+	}
+	RecordOperatorAction(agent, action, commandAudit(session))
+	refreshOperationStatus(agent.OperationID)
+
+	current := models.Manager.GetAgent(agent.ID)
+	ws.BroadcastAgentUpdate(agent.ID, string(current.Status), fmt.Sprintf("Agent %s", pastTense(action)))
+	return ws.CommandResult{OK: true, Code: 200, Data: current}
+}
+
+// startAgentCommand runs an agent that is not running or paused again from
+// the start of its analysis.
+func startAgentCommand(session ws.Session, agent *models.Agent) ws.CommandResult {
+	if err := CheckBlackout(agent.ID); err != nil {
+		return commandError(err.Status, "%s", err.Message)
+	}
+	if agentTaskRunning(agent.ID) {
+		return commandError(409, "agent is still finishing its previous run")
+	}
+	if !models.Manager.ReactivateAgent(agent.ID) {
+		return commandError(409, "agent is already running")
+	}
+	RecordOperatorAction(agent, "start", commandAudit(session))
+	recordAgentStatus(agent, timeline.ActorOperator, models.AgentStatusRunning, "started by operator")
+	refreshOperationStatus(agent.OperationID)
+	ws.BroadcastAgentUpdate(agent.ID, "running", "Agent started")
+
+	go runAgentTask(agent, agentStartRequest(agent))
+	return ws.CommandResult{OK: true, Code: 202, Data: models.Manager.GetAgent(agent.ID)}
+}
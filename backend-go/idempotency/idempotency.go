@@ -0,0 +1,127 @@
+// Package idempotency remembers the responses to requests sent with an
+// Idempotency-Key, so that a client retrying a request gets the original
+// response back instead of the request being carried out twice.
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+const DefaultTTL = 24 * time.Hour
+
+var (
+	// ErrInFlight is returned for a key whose first request has not finished.
+	ErrInFlight = errors.New("a request with this idempotency key is still in progress")
+	// ErrMismatch is returned for a key already used for a different request.
+	ErrMismatch = errors.New("idempotency key was already used for a different request")
+)
+
+// Response is a recorded response.
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type entry struct {
+	hash     string
+	response *Response
+	storedAt time.Time
+}
+
+// Store holds the requests seen per key until their TTL passes.
+type Store struct {
+	entries map[string]*entry
+	ttl     time.Duration
+	mu      sync.Mutex
+}
+
+var Default = NewStore(DefaultTTL)
+
+func NewStore(ttl time.Duration) *Store {
+	s := &Store{entries: make(map[string]*entry)}
+	s.SetTTL(ttl)
+	return s
+}
+
+// SetTTL sets how long keys are remembered; zero or less keeps the default.
+func (s *Store) SetTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	s.mu.Lock()
+	s.ttl = ttl
+	s.mu.Unlock()
+}
+
+// Hash identifies a request by its method, path and body.
+func Hash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin claims key for the request hashing to hash. It returns the recorded
+// response when the request was already carried out, ErrInFlight or
+// ErrMismatch when it cannot go ahead, and nil, nil when the caller should
+// carry it out and then call Finish or Abandon.
+func (s *Store) Begin(key, hash string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.expire(now)
+	if e, ok := s.entries[key]; ok {
+		switch {
+		case e.hash != hash:
+			return nil, ErrMismatch
+		case e.response == nil:
+			return nil, ErrInFlight
+		}
+		return e.response, nil
+	}
+	s.entries[key] = &entry{hash: hash, storedAt: now}
+	return nil, nil
+}
+
+// Finish records the response to the request key was claimed for.
+func (s *Store) Finish(key string, response *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.response = response
+		e.storedAt = time.Now()
+	}
+}
+
+// Abandon releases key without recording a response, so that the request
+// may be retried with it.
+func (s *Store) Abandon(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.response == nil {
+		delete(s.entries, key)
+	}
+}
+
+// Len returns the number of keys remembered.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(time.Now())
+	return len(s.entries)
+}
+
+// expire must be called with s.mu held.
+func (s *Store) expire(now time.Time) {
+	for key, e := range s.entries {
+		if now.Sub(e.storedAt) > s.ttl {
+			delete(s.entries, key)
+		}
+	}
+}
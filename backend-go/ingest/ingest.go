@@ -0,0 +1,178 @@
+// Package ingest reads the reports of scanners run outside Performa (nuclei
+// JSONL, trivy JSON and SARIF, as semgrep writes it) into records shaped like
+// the findings agents report, so that they go through the same validation.
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Report formats.
+const (
+	FormatNuclei = "nuclei"
+	FormatTrivy  = "trivy"
+	FormatSARIF  = "sarif"
+)
+
+// Formats lists the supported report formats.
+var Formats = []string{FormatNuclei, FormatTrivy, FormatSARIF}
+
+// Supported reports whether format is one of Formats.
+func Supported(format string) bool {
+	for _, supported := range Formats {
+		if format == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxRecords bounds how many records one report may hold.
+const MaxRecords = 5000
+
+// Record is one finding of a report. Source names the scanner that reported
+// it; Severity is one of critical, high, medium, low and info.
+type Record struct {
+	Source      string `json:"source"`
+	Title       string `json:"title"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+	Target      string `json:"target"`
+	Evidence    string `json:"evidence"`
+	Category    string `json:"category"`
+	CWE         string `json:"cwe_id"`
+	CVSSVector  string `json:"cvss_vector"`
+	Remediation string `json:"remediation"`
+}
+
+// Problem is an entry of a report that could not be read. Index counts
+// entries from zero in the order the format lists them: lines for nuclei,
+// results for SARIF, and vulnerabilities, misconfigurations and secrets for
+// trivy.
+type Problem struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// Detect guesses the format of a report from its content.
+func Detect(data []byte) (string, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return "", fmt.Errorf("empty report")
+	}
+
+	var probe struct {
+		Schema       string          `json:"$schema"`
+		Runs         json.RawMessage `json:"runs"`
+		Results      json.RawMessage `json:"Results"`
+		ArtifactName string          `json:"ArtifactName"`
+		TemplateID   string          `json:"template-id"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		// Several JSON documents: nuclei JSONL. Its first line says so.
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i]
+		}
+		if json.Unmarshal(bytes.TrimSpace(line), &probe) == nil && probe.TemplateID != "" {
+			return FormatNuclei, nil
+		}
+		return "", fmt.Errorf("not a JSON or JSONL report: %w", err)
+	}
+
+	switch {
+	case probe.Runs != nil || strings.Contains(strings.ToLower(probe.Schema), "sarif"):
+		return FormatSARIF, nil
+	case probe.Results != nil || probe.ArtifactName != "":
+		return FormatTrivy, nil
+	case probe.TemplateID != "":
+		return FormatNuclei, nil
+	}
+	return "", fmt.Errorf("unrecognized report format; expected one of %s", strings.Join(Formats, ", "))
+}
+
+// Parse reads a report in format. Entries that cannot be read are returned
+// as problems; an error means the report as a whole is unreadable.
+func Parse(format string, data []byte) ([]Record, []Problem, error) {
+	var records []Record
+	var problems []Problem
+	var err error
+	switch format {
+	case FormatNuclei:
+		records, problems, err = parseNuclei(data)
+	case FormatTrivy:
+		records, problems, err = parseTrivy(data)
+	case FormatSARIF:
+		records, problems, err = parseSARIF(data)
+	default:
+		return nil, nil, fmt.Errorf("unknown format %q; expected one of %s", format, strings.Join(Formats, ", "))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) > MaxRecords {
+		return nil, nil, fmt.Errorf("report holds %d findings, more than the %d allowed", len(records), MaxRecords)
+	}
+	return records, problems, nil
+}
+
+// normalizeSeverity maps a scanner's severity onto Performa's, or returns ""
+// when it is unknown.
+func normalizeSeverity(severity string) string {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "critical":
+		return "critical"
+	case "high", "error":
+		return "high"
+	case "medium", "moderate", "warning":
+		return "medium"
+	case "low", "note":
+		return "low"
+	case "info", "informational", "unknown", "none":
+		return "info"
+	}
+	return ""
+}
+
+// severityFromScore maps a CVSS-like score from 0 to 10 onto a severity.
+func severityFromScore(score float64) string {
+	switch {
+	case score >= 9:
+		return "critical"
+	case score >= 7:
+		return "high"
+	case score >= 4:
+		return "medium"
+	case score > 0:
+		return "low"
+	}
+	return "info"
+}
+
+// firstCWE returns the first CWE ID among values such as "CWE-79" or
+// "CWE-89: Improper Neutralization...", or "".
+func firstCWE(values []string) string {
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.HasPrefix(strings.ToUpper(value), "CWE-") {
+			continue
+		}
+		if i := strings.IndexAny(value, ": "); i > 0 {
+			value = value[:i]
+		}
+		return strings.ToUpper(value)
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type nucleiResult struct {
+	TemplateID string `json:"template-id"`
+	Info       struct {
+		Name           string          `json:"name"`
+		Severity       string          `json:"severity"`
+		Description    string          `json:"description"`
+		Remediation    string          `json:"remediation"`
+		Tags           json.RawMessage `json:"tags"`
+		Classification struct {
+			CWE         json.RawMessage `json:"cwe-id"`
+			CVSSMetrics string          `json:"cvss-metrics"`
+		} `json:"classification"`
+	} `json:"info"`
+	Type             string   `json:"type"`
+	Host             string   `json:"host"`
+	MatchedAt        string   `json:"matched-at"`
+	MatcherName      string   `json:"matcher-name"`
+	ExtractedResults []string `json:"extracted-results"`
+	CurlCommand      string   `json:"curl-command"`
+	Request          string   `json:"request"`
+}
+
+// parseNuclei reads nuclei's -jsonl output, one result per line. A JSON array
+// of results, as -json-export writes, is read too.
+func parseNuclei(data []byte) ([]Record, []Problem, error) {
+	data = bytes.TrimSpace(data)
+	records := make([]Record, 0)
+	var problems []Problem
+
+	if bytes.HasPrefix(data, []byte("[")) {
+		var results []nucleiResult
+		if err := json.Unmarshal(data, &results); err != nil {
+			return nil, nil, fmt.Errorf("invalid nuclei JSON export: %w", err)
+		}
+		for i, result := range results {
+			if record, err := result.record(); err != nil {
+				problems = append(problems, Problem{Index: i, Reason: err.Error()})
+			} else {
+				records = append(records, record)
+			}
+		}
+		return records, problems, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for index := 0; scanner.Scan(); index++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var result nucleiResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			problems = append(problems, Problem{Index: index, Reason: "invalid JSON: " + err.Error()})
+			continue
+		}
+		record, err := result.record()
+		if err != nil {
+			problems = append(problems, Problem{Index: index, Reason: err.Error()})
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("read nuclei report: %w", err)
+	}
+	return records, problems, nil
+}
+
+func (r nucleiResult) record() (Record, error) {
+	if r.TemplateID == "" && r.Info.Name == "" {
+		return Record{}, fmt.Errorf("result has neither template-id nor info.name")
+	}
+
+	evidence := make([]string, 0, 3)
+	if r.MatcherName != "" {
+		evidence = append(evidence, "Matcher: "+r.MatcherName)
+	}
+	if len(r.ExtractedResults) > 0 {
+		evidence = append(evidence, "Extracted: "+strings.Join(r.ExtractedResults, ", "))
+	}
+	if r.CurlCommand != "" {
+		evidence = append(evidence, r.CurlCommand)
+	} else if r.Request != "" {
+		evidence = append(evidence, r.Request)
+	}
+
+	category := r.Type
+	if tags := stringList(r.Info.Tags); len(tags) > 0 {
+		category = tags[0]
+	}
+
+	return Record{
+		Source:      FormatNuclei,
+		Title:       firstNonEmpty(r.Info.Name, r.TemplateID),
+		Severity:    normalizeSeverity(r.Info.Severity),
+		Description: firstNonEmpty(r.Info.Description, "Nuclei template "+r.TemplateID+" matched."),
+		Target:      firstNonEmpty(r.MatchedAt, r.Host),
+		Evidence:    strings.Join(evidence, "\n"),
+		Category:    category,
+		CWE:         firstCWE(stringList(r.Info.Classification.CWE)),
+		CVSSVector:  r.Info.Classification.CVSSMetrics,
+		Remediation: r.Info.Remediation,
+	}, nil
+}
+
+// stringList reads a field nuclei writes either as a list or as one
+// comma-separated string.
+func stringList(raw json.RawMessage) []string {
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		return list
+	}
+	var joined string
+	if json.Unmarshal(raw, &joined) != nil || joined == "" {
+		return nil
+	}
+	for _, value := range strings.Split(joined, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,147 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type sarifLog struct {
+	Runs []struct {
+		Tool struct {
+			Driver struct {
+				Name  string      `json:"name"`
+				Rules []sarifRule `json:"rules"`
+			} `json:"driver"`
+		} `json:"tool"`
+		Results []struct {
+			RuleID    string `json:"ruleId"`
+			RuleIndex *int   `json:"ruleIndex"`
+			Level     string `json:"level"`
+			Message   struct {
+				Text string `json:"text"`
+			} `json:"message"`
+			Locations []struct {
+				PhysicalLocation struct {
+					ArtifactLocation struct {
+						URI string `json:"uri"`
+					} `json:"artifactLocation"`
+					Region struct {
+						StartLine int `json:"startLine"`
+						Snippet   struct {
+							Text string `json:"text"`
+						} `json:"snippet"`
+					} `json:"region"`
+				} `json:"physicalLocation"`
+			} `json:"locations"`
+		} `json:"results"`
+	} `json:"runs"`
+}
+
+type sarifRule struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	ShortDescription struct {
+		Text string `json:"text"`
+	} `json:"shortDescription"`
+	FullDescription struct {
+		Text string `json:"text"`
+	} `json:"fullDescription"`
+	Help struct {
+		Text string `json:"text"`
+	} `json:"help"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+	Properties struct {
+		Tags             []string        `json:"tags"`
+		SecuritySeverity json.RawMessage `json:"security-severity"`
+	} `json:"properties"`
+}
+
+// parseSARIF reads a SARIF 2.1 log. Each result is attributed to the tool of
+// its run, such as semgrep; its severity comes from its rule's
+// security-severity score when there is one and from its level otherwise.
+func parseSARIF(data []byte) ([]Record, []Problem, error) {
+	var log sarifLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, nil, fmt.Errorf("invalid SARIF log: %w", err)
+	}
+
+	records := make([]Record, 0)
+	var problems []Problem
+	index := 0
+	for _, run := range log.Runs {
+		source := strings.ToLower(firstNonEmpty(run.Tool.Driver.Name, FormatSARIF))
+		rules := make(map[string]sarifRule, len(run.Tool.Driver.Rules))
+		for _, rule := range run.Tool.Driver.Rules {
+			rules[rule.ID] = rule
+		}
+
+		for _, result := range run.Results {
+			current := index
+			index++
+
+			rule, ok := rules[result.RuleID]
+			if !ok && result.RuleIndex != nil && *result.RuleIndex >= 0 && *result.RuleIndex < len(run.Tool.Driver.Rules) {
+				rule = run.Tool.Driver.Rules[*result.RuleIndex]
+			}
+			ruleID := firstNonEmpty(result.RuleID, rule.ID)
+			if ruleID == "" && result.Message.Text == "" {
+				problems = append(problems, Problem{Index: current, Reason: "result has neither ruleId nor message"})
+				continue
+			}
+
+			target, snippet := "", ""
+			if len(result.Locations) > 0 {
+				location := result.Locations[0].PhysicalLocation
+				target = location.ArtifactLocation.URI
+				if location.Region.StartLine > 0 {
+					target += ":" + strconv.Itoa(location.Region.StartLine)
+				}
+				snippet = location.Region.Snippet.Text
+			}
+
+			severity := normalizeSeverity(firstNonEmpty(result.Level, rule.DefaultConfiguration.Level, "warning"))
+			if score, ok := securitySeverity(rule.Properties.SecuritySeverity); ok {
+				severity = severityFromScore(score)
+			}
+
+			evidence := result.Message.Text
+			if snippet != "" {
+				evidence += "\n" + snippet
+			}
+			records = append(records, Record{
+				Source:      source,
+				Title:       firstNonEmpty(rule.ShortDescription.Text, rule.Name, ruleID),
+				Severity:    severity,
+				Description: firstNonEmpty(rule.FullDescription.Text, result.Message.Text),
+				Target:      target,
+				Evidence:    strings.TrimSpace(evidence),
+				Category:    ruleID,
+				CWE:         firstCWE(rule.Properties.Tags),
+				Remediation: rule.Help.Text,
+			})
+		}
+	}
+	return records, problems, nil
+}
+
+// securitySeverity reads a rule's security-severity, which tools write either
+// as a number or as a numeric string.
+func securitySeverity(raw json.RawMessage) (float64, bool) {
+	if len(raw) == 0 {
+		return 0, false
+	}
+	var score float64
+	if json.Unmarshal(raw, &score) == nil {
+		return score, true
+	}
+	var text string
+	if json.Unmarshal(raw, &text) != nil {
+		return 0, false
+	}
+	score, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	return score, err == nil
+}
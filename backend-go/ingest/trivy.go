@@ -0,0 +1,147 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type trivyReport struct {
+	ArtifactName string `json:"ArtifactName"`
+	Results      []struct {
+		Target          string `json:"Target"`
+		Vulnerabilities []struct {
+			VulnerabilityID  string   `json:"VulnerabilityID"`
+			PkgName          string   `json:"PkgName"`
+			InstalledVersion string   `json:"InstalledVersion"`
+			FixedVersion     string   `json:"FixedVersion"`
+			Title            string   `json:"Title"`
+			Description      string   `json:"Description"`
+			Severity         string   `json:"Severity"`
+			PrimaryURL       string   `json:"PrimaryURL"`
+			CweIDs           []string `json:"CweIDs"`
+			CVSS             map[string]struct {
+				V3Vector string `json:"V3Vector"`
+			} `json:"CVSS"`
+		} `json:"Vulnerabilities"`
+		Misconfigurations []struct {
+			ID          string `json:"ID"`
+			AVDID       string `json:"AVDID"`
+			Title       string `json:"Title"`
+			Description string `json:"Description"`
+			Message     string `json:"Message"`
+			Resolution  string `json:"Resolution"`
+			Severity    string `json:"Severity"`
+			Status      string `json:"Status"`
+		} `json:"Misconfigurations"`
+		Secrets []struct {
+			RuleID    string `json:"RuleID"`
+			Category  string `json:"Category"`
+			Title     string `json:"Title"`
+			Severity  string `json:"Severity"`
+			StartLine int    `json:"StartLine"`
+			Match     string `json:"Match"`
+		} `json:"Secrets"`
+	} `json:"Results"`
+}
+
+// parseTrivy reads trivy's JSON report: vulnerabilities in packages,
+// misconfigurations that failed, and secrets.
+func parseTrivy(data []byte) ([]Record, []Problem, error) {
+	var report trivyReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, nil, fmt.Errorf("invalid trivy report: %w", err)
+	}
+
+	records := make([]Record, 0)
+	var problems []Problem
+	index := 0
+	for _, result := range report.Results {
+		target := firstNonEmpty(result.Target, report.ArtifactName)
+
+		for _, v := range result.Vulnerabilities {
+			current := index
+			index++
+			if v.VulnerabilityID == "" {
+				problems = append(problems, Problem{Index: current, Reason: "vulnerability has no VulnerabilityID"})
+				continue
+			}
+
+			title := v.VulnerabilityID + " in " + v.PkgName
+			if v.Title != "" {
+				title = v.VulnerabilityID + ": " + v.Title
+			}
+			evidence := fmt.Sprintf("Package %s %s", v.PkgName, v.InstalledVersion)
+			remediation := ""
+			if v.FixedVersion != "" {
+				remediation = fmt.Sprintf("Upgrade %s to %s.", v.PkgName, v.FixedVersion)
+			}
+			if v.PrimaryURL != "" {
+				evidence += "\n" + v.PrimaryURL
+			}
+			vector := ""
+			for _, source := range []string{"nvd", "redhat", "ghsa"} {
+				if cvss, ok := v.CVSS[source]; ok && cvss.V3Vector != "" {
+					vector = cvss.V3Vector
+					break
+				}
+			}
+			records = append(records, Record{
+				Source:      FormatTrivy,
+				Title:       title,
+				Severity:    normalizeSeverity(v.Severity),
+				Description: firstNonEmpty(v.Description, title),
+				Target:      target + " (" + v.PkgName + ")",
+				Evidence:    evidence,
+				Category:    "vulnerable-dependency",
+				CWE:         firstCWE(v.CweIDs),
+				CVSSVector:  vector,
+				Remediation: remediation,
+			})
+		}
+
+		for _, m := range result.Misconfigurations {
+			if strings.EqualFold(m.Status, "PASS") {
+				continue
+			}
+			id := firstNonEmpty(m.AVDID, m.ID)
+			current := index
+			index++
+			if id == "" && m.Title == "" {
+				problems = append(problems, Problem{Index: current, Reason: "misconfiguration has neither ID nor Title"})
+				continue
+			}
+			records = append(records, Record{
+				Source:      FormatTrivy,
+				Title:       strings.TrimPrefix(id+": "+m.Title, ": "),
+				Severity:    normalizeSeverity(m.Severity),
+				Description: firstNonEmpty(m.Description, m.Title),
+				Target:      target,
+				Evidence:    m.Message,
+				Category:    "misconfiguration",
+				Remediation: m.Resolution,
+			})
+		}
+
+		for _, s := range result.Secrets {
+			current := index
+			index++
+			if s.RuleID == "" && s.Title == "" {
+				problems = append(problems, Problem{Index: current, Reason: "secret has neither RuleID nor Title"})
+				continue
+			}
+			records = append(records, Record{
+				Source:      FormatTrivy,
+				Title:       firstNonEmpty(s.Title, s.RuleID),
+				Severity:    normalizeSeverity(s.Severity),
+				Description: fmt.Sprintf("Secret (%s) found in %s.", firstNonEmpty(s.Category, s.RuleID), target),
+				Target:      fmt.Sprintf("%s:%d", target, s.StartLine),
+				Evidence:    s.Match,
+				Category:    "secret",
+				CWE:         "CWE-798",
+				Remediation: "Remove the secret from the artifact and rotate it.",
+			})
+		}
+	}
+	return records, problems, nil
+}
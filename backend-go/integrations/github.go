@@ -0,0 +1,74 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultGitHubAPI = "https://api.github.com"
+
+type githubTracker struct {
+	integration *Integration
+	token       string
+}
+
+func (t *githubTracker) auth(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+}
+
+func (t *githubTracker) issuesURL() string {
+	base := strings.TrimRight(t.integration.BaseURL, "/")
+	if base == "" {
+		base = defaultGitHubAPI
+	}
+	return base + "/repos/" + t.integration.Project + "/issues"
+}
+
+type githubIssue struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+}
+
+func (i githubIssue) remote() *RemoteIssue {
+	return &RemoteIssue{
+		Key:    strconv.Itoa(i.Number),
+		URL:    i.HTMLURL,
+		Status: i.State,
+		Closed: i.State == "closed",
+	}
+}
+
+func (t *githubTracker) CreateIssue(ctx context.Context, issue Issue) (*RemoteIssue, error) {
+	labels := append([]string{}, issue.Labels...)
+	if issue.Priority != "" {
+		labels = append(labels, issue.Priority)
+	}
+
+	var created githubIssue
+	err := doJSON(ctx, "POST", t.issuesURL(), map[string]interface{}{
+		"title":  issue.Title,
+		"body":   issue.Body,
+		"labels": labels,
+	}, t.auth, &created)
+	if err != nil {
+		return nil, err
+	}
+	return created.remote(), nil
+}
+
+func (t *githubTracker) GetIssue(ctx context.Context, key string) (*RemoteIssue, error) {
+	if _, err := strconv.Atoi(key); err != nil {
+		return nil, fmt.Errorf("invalid GitHub issue number %q", key)
+	}
+	var issue githubIssue
+	if err := doJSON(ctx, "GET", t.issuesURL()+"/"+key, nil, t.auth, &issue); err != nil {
+		return nil, err
+	}
+	return issue.remote(), nil
+}
@@ -0,0 +1,271 @@
+// Package integrations pushes findings to external issue trackers (Jira and
+// GitHub Issues) and reads the status of the filed issues back.
+package integrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+
+	"github.com/google/uuid"
+)
+
+// Integration types.
+const (
+	TypeJira   = "jira"
+	TypeGitHub = "github"
+)
+
+// Integration is a configured issue tracker. Project is the Jira project key
+// or the GitHub "owner/repo". The API token is a stored credential of the
+// integration's type; Username is the Jira account email used with it.
+type Integration struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	BaseURL      string            `json:"base_url,omitempty"`
+	Project      string            `json:"project"`
+	IssueType    string            `json:"issue_type,omitempty"`
+	Username     string            `json:"username,omitempty"`
+	CredentialID string            `json:"credential_id,omitempty"`
+	PriorityMap  map[string]string `json:"priority_map"`
+	Labels       []string          `json:"labels"`
+	Enabled      bool              `json:"enabled"`
+	LastSyncAt   *time.Time        `json:"last_sync_at,omitempty"`
+	LastError    string            `json:"last_error,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// DefaultPriorities maps finding severities to Jira priorities and GitHub
+// labels.
+var DefaultPriorities = map[string]map[string]string{
+	TypeJira: {
+		"critical": "Highest",
+		"high":     "High",
+		"medium":   "Medium",
+		"low":      "Low",
+		"info":     "Lowest",
+	},
+	TypeGitHub: {
+		"critical": "priority: critical",
+		"high":     "priority: high",
+		"medium":   "priority: medium",
+		"low":      "priority: low",
+		"info":     "priority: info",
+	},
+}
+
+// Validate checks the integration is complete enough to file issues.
+func (i *Integration) Validate() error {
+	if strings.TrimSpace(i.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch i.Type {
+	case TypeJira:
+		if i.BaseURL == "" {
+			return fmt.Errorf("base_url is required for Jira")
+		}
+		if i.Project == "" {
+			return fmt.Errorf("project is required")
+		}
+	case TypeGitHub:
+		if owner, repo, ok := strings.Cut(i.Project, "/"); !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return fmt.Errorf("project must be a GitHub repository as owner/repo")
+		}
+	default:
+		return fmt.Errorf("type must be %q or %q", TypeJira, TypeGitHub)
+	}
+	return nil
+}
+
+// Priority returns the priority (Jira) or label (GitHub) for a severity.
+func (i *Integration) Priority(severity string) string {
+	if priority, ok := i.PriorityMap[severity]; ok {
+		return priority
+	}
+	return DefaultPriorities[i.Type][severity]
+}
+
+func (i *Integration) clone() *Integration {
+	copied := *i
+	copied.PriorityMap = make(map[string]string, len(i.PriorityMap))
+	for severity, priority := range i.PriorityMap {
+		copied.PriorityMap[severity] = priority
+	}
+	copied.Labels = append([]string{}, i.Labels...)
+	return &copied
+}
+
+type Store struct {
+	integrations map[string]*Integration
+	mu           sync.RWMutex
+}
+
+var Default = &Store{
+	integrations: make(map[string]*Integration),
+}
+
+func (s *Store) Create(integration Integration) (*Integration, error) {
+	if err := integration.Validate(); err != nil {
+		return nil, err
+	}
+	if integration.PriorityMap == nil {
+		integration.PriorityMap = map[string]string{}
+	}
+	if integration.Labels == nil {
+		integration.Labels = []string{}
+	}
+
+	now := time.Now()
+	integration.ID = uuid.New().String()
+	integration.CreatedAt = now
+	integration.UpdatedAt = now
+	stored := integration.clone()
+
+	s.mu.Lock()
+	s.integrations[stored.ID] = stored
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return stored.clone(), nil
+}
+
+func (s *Store) Get(id string) *Integration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if integration, ok := s.integrations[id]; ok {
+		return integration.clone()
+	}
+	return nil
+}
+
+// GetAll returns the integrations sorted by name.
+func (s *Store) GetAll() []*Integration {
+	s.mu.RLock()
+	all := make([]*Integration, 0, len(s.integrations))
+	for _, integration := range s.integrations {
+		all = append(all, integration.clone())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool { return strings.ToLower(all[i].Name) < strings.ToLower(all[j].Name) })
+	return all
+}
+
+// Update applies fn to a copy of the integration, validates it and stores
+// the result. It returns nil, nil when the integration does not exist.
+func (s *Store) Update(id string, fn func(integration *Integration) error) (*Integration, error) {
+	s.mu.Lock()
+	existing, ok := s.integrations[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	updated := existing.clone()
+	if err := fn(updated); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if err := updated.Validate(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	updated.ID = id
+	updated.UpdatedAt = time.Now()
+	s.integrations[id] = updated
+	s.mu.Unlock()
+
+	s.persist(updated)
+	return updated.clone(), nil
+}
+
+// RecordSync notes the outcome of a status sync.
+func (s *Store) RecordSync(id string, syncErr error) {
+	s.mu.Lock()
+	integration, ok := s.integrations[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	integration.LastSyncAt = &now
+	integration.LastError = ""
+	if syncErr != nil {
+		integration.LastError = syncErr.Error()
+	}
+	stored := integration.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+}
+
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.integrations[id]
+	delete(s.integrations, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		database.DeleteIntegration(id)
+	}
+	return exists
+}
+
+func (s *Store) persist(integration *Integration) {
+	if database.DB == nil {
+		return
+	}
+
+	data, _ := json.Marshal(integration)
+	record := database.IntegrationRecord{
+		ID:        integration.ID,
+		Type:      integration.Type,
+		Name:      integration.Name,
+		Data:      data,
+		CreatedAt: integration.CreatedAt,
+		UpdatedAt: integration.UpdatedAt,
+	}
+	if err := database.SaveIntegration(record); err != nil {
+		log.Printf("Integrations: failed to persist integration %s: %v", integration.ID, err)
+	}
+}
+
+// Load restores integrations from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllIntegrations()
+	if err != nil {
+		log.Printf("Integrations: failed to load integrations: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		var integration Integration
+		if err := json.Unmarshal(record.Data, &integration); err != nil {
+			log.Printf("Integrations: skipping invalid integration %s: %v", record.ID, err)
+			continue
+		}
+		integration.ID = record.ID
+		if integration.PriorityMap == nil {
+			integration.PriorityMap = map[string]string{}
+		}
+		if integration.Labels == nil {
+			integration.Labels = []string{}
+		}
+		s.integrations[record.ID] = &integration
+	}
+}
@@ -0,0 +1,84 @@
+package integrations
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type jiraTracker struct {
+	integration *Integration
+	token       string
+}
+
+func (t *jiraTracker) auth(req *http.Request) {
+	if t.integration.Username != "" {
+		req.SetBasicAuth(t.integration.Username, t.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+}
+
+func (t *jiraTracker) baseURL() string {
+	return strings.TrimRight(t.integration.BaseURL, "/")
+}
+
+func (t *jiraTracker) CreateIssue(ctx context.Context, issue Issue) (*RemoteIssue, error) {
+	issueType := t.integration.IssueType
+	if issueType == "" {
+		issueType = "Bug"
+	}
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": t.integration.Project},
+		"summary":     issue.Title,
+		"description": issue.Body,
+		"issuetype":   map[string]string{"name": issueType},
+		"labels":      jiraLabels(issue.Labels),
+	}
+	if issue.Priority != "" {
+		fields["priority"] = map[string]string{"name": issue.Priority}
+	}
+
+	var created struct {
+		Key string `json:"key"`
+	}
+	err := doJSON(ctx, "POST", t.baseURL()+"/rest/api/2/issue", map[string]interface{}{"fields": fields}, t.auth, &created)
+	if err != nil {
+		return nil, err
+	}
+	return t.GetIssue(ctx, created.Key)
+}
+
+func (t *jiraTracker) GetIssue(ctx context.Context, key string) (*RemoteIssue, error) {
+	var issue struct {
+		Key    string `json:"key"`
+		Fields struct {
+			Status struct {
+				Name           string `json:"name"`
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	err := doJSON(ctx, "GET", t.baseURL()+"/rest/api/2/issue/"+url.PathEscape(key)+"?fields=status", nil, t.auth, &issue)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteIssue{
+		Key:    issue.Key,
+		URL:    t.baseURL() + "/browse/" + issue.Key,
+		Status: issue.Fields.Status.Name,
+		Closed: issue.Fields.Status.StatusCategory.Key == "done",
+	}, nil
+}
+
+// jiraLabels replaces spaces, which Jira does not allow in labels.
+func jiraLabels(labels []string) []string {
+	cleaned := make([]string, len(labels))
+	for i, label := range labels {
+		cleaned[i] = strings.ReplaceAll(label, " ", "-")
+	}
+	return cleaned
+}
@@ -0,0 +1,196 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"performa-backend/models"
+)
+
+const maxEvidenceInIssue = 10000
+
+// Push files an issue for the finding in the integration's tracker and
+// records the link on the finding. A finding already filed there is not
+// filed again; its existing link is returned.
+func Push(ctx context.Context, integration *Integration, finding *models.Finding) (*models.FindingIssue, bool, error) {
+	for _, issue := range finding.Issues {
+		if issue.IntegrationID == integration.ID {
+			existing := issue
+			return &existing, false, nil
+		}
+	}
+
+	tracker, err := NewTracker(integration)
+	if err != nil {
+		return nil, false, err
+	}
+	remote, err := tracker.CreateIssue(ctx, buildIssue(integration, finding))
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	link := models.FindingIssue{
+		IntegrationID: integration.ID,
+		Type:          integration.Type,
+		Key:           remote.Key,
+		URL:           remote.URL,
+		Status:        remote.Status,
+		Closed:        remote.Closed,
+		CreatedAt:     now,
+		SyncedAt:      now,
+	}
+	models.Findings.UpdateFinding(finding.ID, func(f *models.Finding) {
+		f.Issues = append(append([]models.FindingIssue{}, f.Issues...), link)
+	})
+	return &link, true, nil
+}
+
+func buildIssue(integration *Integration, finding *models.Finding) Issue {
+	severity := string(finding.Severity)
+	if severity == "" {
+		severity = "info"
+	}
+
+	code := func(text string) string { return "```\n" + text + "\n```" }
+	heading := func(text string) string { return "### " + text }
+	if integration.Type == TypeJira {
+		code = func(text string) string { return "{noformat}\n" + text + "\n{noformat}" }
+		heading = func(text string) string { return "h3. " + text }
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Severity: %s\n", severity)
+	if finding.Target != "" {
+		fmt.Fprintf(&body, "Target: %s\n", finding.Target)
+	}
+	if finding.Category != "" {
+		fmt.Fprintf(&body, "Category: %s\n", finding.Category)
+	}
+	if finding.CVSSScore != nil {
+		fmt.Fprintf(&body, "CVSS: %.1f (%s)\n", *finding.CVSSScore, finding.CVSSVector)
+	}
+	if finding.CWE != "" {
+		fmt.Fprintf(&body, "CWE: %s\n", finding.CWE)
+	}
+	if finding.OWASP != "" {
+		fmt.Fprintf(&body, "OWASP: %s\n", finding.OWASP)
+	}
+	if finding.Description != "" {
+		fmt.Fprintf(&body, "\n%s\n%s\n", heading("Description"), finding.Description)
+	}
+	if finding.Evidence != "" {
+		evidence := finding.Evidence
+		if len(evidence) > maxEvidenceInIssue {
+			evidence = evidence[:maxEvidenceInIssue] + "\n[truncated]"
+		}
+		fmt.Fprintf(&body, "\n%s\n%s\n", heading("Evidence"), code(evidence))
+	}
+	if finding.Remediation != "" {
+		fmt.Fprintf(&body, "\n%s\n%s\n", heading("Remediation"), finding.Remediation)
+	}
+	fmt.Fprintf(&body, "\nPerforma finding %s", finding.ID)
+
+	labels := append([]string{"performa", "severity:" + severity}, integration.Labels...)
+	return Issue{
+		Title:    fmt.Sprintf("[%s] %s", strings.ToUpper(severity), finding.Title),
+		Body:     body.String(),
+		Priority: integration.Priority(severity),
+		Labels:   labels,
+	}
+}
+
+// Sync refreshes the status of every issue filed through enabled
+// integrations. A finding whose issue was closed is marked resolved, and a
+// resolved finding whose issue was reopened goes back to open. It returns
+// the number of findings changed.
+func Sync(ctx context.Context) int {
+	changed := 0
+	for _, integration := range Default.GetAll() {
+		if !integration.Enabled {
+			continue
+		}
+		n, err := syncIntegration(ctx, integration)
+		changed += n
+		Default.RecordSync(integration.ID, err)
+		if err != nil {
+			log.Printf("Integrations: sync of %s failed: %v", integration.Name, err)
+		}
+	}
+	return changed
+}
+
+func syncIntegration(ctx context.Context, integration *Integration) (int, error) {
+	tracker, err := NewTracker(integration)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	var lastErr error
+	for _, finding := range models.Findings.GetAllFindings() {
+		for _, issue := range finding.Issues {
+			if issue.IntegrationID != integration.ID {
+				continue
+			}
+			remote, err := tracker.GetIssue(ctx, issue.Key)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if remote.Status == issue.Status && remote.Closed == issue.Closed {
+				continue
+			}
+			if applyRemoteStatus(finding.ID, integration.ID, remote) {
+				changed++
+			}
+		}
+	}
+	return changed, lastErr
+}
+
+// applyRemoteStatus records the issue's status on the finding and reports
+// whether the finding's own status changed.
+func applyRemoteStatus(findingID, integrationID string, remote *RemoteIssue) bool {
+	statusChanged := false
+	models.Findings.UpdateFinding(findingID, func(f *models.Finding) {
+		issues := append([]models.FindingIssue{}, f.Issues...)
+		for i := range issues {
+			if issues[i].IntegrationID != integrationID {
+				continue
+			}
+			wasClosed := issues[i].Closed
+			issues[i].Status = remote.Status
+			issues[i].Closed = remote.Closed
+			issues[i].SyncedAt = time.Now()
+
+			switch {
+			case remote.Closed && !wasClosed && f.Status != "resolved":
+				f.Status = "resolved"
+				statusChanged = true
+			case !remote.Closed && wasClosed && f.Status == "resolved":
+				f.Status = "open"
+				statusChanged = true
+			}
+		}
+		f.Issues = issues
+	})
+	return statusChanged
+}
+
+// StartSync polls the trackers for issue status every interval.
+func StartSync(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if changed := Sync(ctx); changed > 0 {
+			log.Printf("Integrations: %d findings changed status from tracker sync", changed)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,97 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"performa-backend/credentials"
+)
+
+// Issue is a finding as it is filed in an issue tracker.
+type Issue struct {
+	Title    string
+	Body     string
+	Priority string
+	Labels   []string
+}
+
+// RemoteIssue identifies an issue created in a tracker.
+type RemoteIssue struct {
+	Key    string
+	URL    string
+	Status string
+	Closed bool
+}
+
+// Tracker files issues in, and reads their status back from, an external
+// issue tracker.
+type Tracker interface {
+	CreateIssue(ctx context.Context, issue Issue) (*RemoteIssue, error)
+	GetIssue(ctx context.Context, key string) (*RemoteIssue, error)
+}
+
+// NewTracker returns the tracker client for an integration, authenticated
+// with its stored credential.
+func NewTracker(integration *Integration) (Tracker, error) {
+	token := credentials.Default.Resolve(integration.Type, integration.CredentialID)
+	if token == "" {
+		return nil, fmt.Errorf("no %s credential available", integration.Type)
+	}
+	switch integration.Type {
+	case TypeJira:
+		return &jiraTracker{integration: integration, token: token}, nil
+	case TypeGitHub:
+		return &githubTracker{integration: integration, token: token}, nil
+	}
+	return nil, fmt.Errorf("unknown integration type %q", integration.Type)
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// doJSON sends body as JSON and decodes a JSON response into out. Non-2xx
+// responses are returned as errors carrying the start of the response body.
+func doJSON(ctx context.Context, method, url string, body interface{}, setAuth func(*http.Request), out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	setAuth(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if len(data) > 300 {
+			data = data[:300]
+		}
+		return fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, bytes.TrimSpace(data))
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("invalid response from %s: %v", url, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+// Package jobs runs long tasks in the background. A job is submitted with a
+// kind and a JSON input and gets an ID right away; a pool of workers runs it
+// with the handler registered for its kind and keeps the result. Jobs are
+// persisted, so those still queued or running when the server stops are run
+// again after a restart.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+
+	DefaultWorkers = 2
+	// DefaultMaxJobs bounds the jobs kept in memory; the oldest finished
+	// ones are dropped first.
+	DefaultMaxJobs = 1000
+	queueSize      = 1024
+)
+
+var (
+	ErrUnknownKind = errors.New("unknown job kind")
+	ErrQueueFull   = errors.New("job queue is full")
+)
+
+// Job is a background task and, once it finished, its result or error.
+type Job struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	WorkspaceID string          `json:"workspace_id"`
+	Status      string          `json:"status"`
+	Input       json.RawMessage `json:"input,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreatedBy   string          `json:"created_by,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job succeeded or failed.
+func (j *Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+func (j *Job) clone() *Job {
+	copied := *j
+	return &copied
+}
+
+// Handler runs a job and returns its result, which is stored as JSON.
+type Handler func(ctx context.Context, job *Job) (interface{}, error)
+
+// Filter selects jobs. Empty fields match everything.
+type Filter struct {
+	WorkspaceID string
+	Kind        string
+	Status      string
+}
+
+func (f Filter) matches(j *Job) bool {
+	return (f.WorkspaceID == "" || j.WorkspaceID == f.WorkspaceID) &&
+		(f.Kind == "" || j.Kind == f.Kind) &&
+		(f.Status == "" || j.Status == f.Status)
+}
+
+// Queue holds the jobs and the workers running them.
+type Queue struct {
+	jobs     map[string]*Job
+	handlers map[string]Handler
+	notify   func(*Job)
+	pending  chan string
+	maxJobs  int
+	started  bool
+	mu       sync.RWMutex
+}
+
+var Default = NewQueue()
+
+func NewQueue() *Queue {
+	return &Queue{
+		jobs:     make(map[string]*Job),
+		handlers: make(map[string]Handler),
+		pending:  make(chan string, queueSize),
+		maxJobs:  DefaultMaxJobs,
+	}
+}
+
+// Register sets the handler of a job kind.
+func (q *Queue) Register(kind string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = handler
+}
+
+// Kinds lists the registered job kinds, sorted.
+func (q *Queue) Kinds() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// SetNotifier sets the function told about each job that starts or
+// finishes.
+func (q *Queue) SetNotifier(notify func(*Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.notify = notify
+}
+
+// Start runs workers goroutines processing the queue. Zero or less uses
+// DefaultWorkers. Only the first call has an effect.
+func (q *Queue) Start(workers int) {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.started {
+		return
+	}
+	q.started = true
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+}
+
+// Submit queues a job of a registered kind.
+func (q *Queue) Submit(kind, workspaceID, createdBy string, input json.RawMessage) (*Job, error) {
+	q.mu.Lock()
+	if _, ok := q.handlers[kind]; !ok {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+	job := &Job{
+		ID:          uuid.New().String(),
+		Kind:        kind,
+		WorkspaceID: workspaceID,
+		Status:      StatusQueued,
+		Input:       input,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}
+	q.jobs[job.ID] = job
+	q.evict()
+	queued := job.clone()
+	q.mu.Unlock()
+
+	q.persist(queued)
+	select {
+	case q.pending <- job.ID:
+	default:
+		q.mu.Lock()
+		delete(q.jobs, job.ID)
+		q.mu.Unlock()
+		now := time.Now()
+		queued.Status, queued.Error, queued.FinishedAt = StatusFailed, ErrQueueFull.Error(), &now
+		q.persist(queued)
+		return nil, ErrQueueFull
+	}
+	return queued, nil
+}
+
+// Get returns a copy of the job with the given ID.
+func (q *Queue) Get(id string) *Job {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if job, ok := q.jobs[id]; ok {
+		return job.clone()
+	}
+	return nil
+}
+
+// List returns the jobs matching filter, most recent first.
+func (q *Queue) List(filter Filter) []*Job {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	jobs := make([]*Job, 0)
+	for _, job := range q.jobs {
+		if filter.matches(job) {
+			jobs = append(jobs, job.clone())
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return jobs
+}
+
+func (q *Queue) work() {
+	for id := range q.pending {
+		q.run(id)
+	}
+}
+
+func (q *Queue) run(id string) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok || job.Status != StatusQueued {
+		q.mu.Unlock()
+		return
+	}
+	handler := q.handlers[job.Kind]
+	now := time.Now()
+	job.Status = StatusRunning
+	job.StartedAt = &now
+	running := job.clone()
+	q.mu.Unlock()
+	q.persist(running)
+	q.notifyJob(running)
+
+	result, err := q.call(handler, running)
+	var raw json.RawMessage
+	if err == nil && result != nil {
+		if raw, err = json.Marshal(result); err != nil {
+			err = fmt.Errorf("encoding result: %w", err)
+		}
+	}
+
+	q.mu.Lock()
+	finished := time.Now()
+	job.FinishedAt = &finished
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		log.Printf("Jobs: %s job %s failed: %v", job.Kind, job.ID, err)
+	} else {
+		job.Status = StatusSucceeded
+		job.Result = raw
+	}
+	done := job.clone()
+	q.mu.Unlock()
+	q.persist(done)
+	q.notifyJob(done)
+}
+
+// call runs handler, turning a panic into an error so that one bad job does
+// not take a worker down.
+func (q *Queue) call(handler Handler, job *Job) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	if handler == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKind, job.Kind)
+	}
+	return handler(context.Background(), job)
+}
+
+func (q *Queue) notifyJob(job *Job) {
+	q.mu.RLock()
+	notify := q.notify
+	q.mu.RUnlock()
+	if notify != nil {
+		notify(job)
+	}
+}
+
+// evict must be called with q.mu held.
+func (q *Queue) evict() {
+	excess := len(q.jobs) - q.maxJobs
+	if excess <= 0 {
+		return
+	}
+	finished := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		if job.Finished() {
+			finished = append(finished, job)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].CreatedAt.Before(finished[j].CreatedAt) })
+	for i := 0; i < excess && i < len(finished); i++ {
+		delete(q.jobs, finished[i].ID)
+	}
+}
+
+func (q *Queue) persist(job *Job) {
+	if database.DB == nil {
+		return
+	}
+	if err := database.SaveJob(database.JobRecord(*job)); err != nil {
+		log.Printf("Jobs: failed to persist job %s: %v", job.ID, err)
+	}
+}
+
+// Load restores the jobs from the database. Jobs that were queued or running
+// when the server stopped are queued again; handlers must be registered
+// first.
+func (q *Queue) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetRecentJobs(q.maxJobs)
+	if err != nil {
+		log.Printf("Jobs: failed to load jobs: %v", err)
+		return
+	}
+
+	requeued := make([]*Job, 0)
+	q.mu.Lock()
+	for _, record := range records {
+		job := Job(record)
+		if !job.Finished() {
+			job.Status = StatusQueued
+			job.StartedAt, job.FinishedAt, job.Error = nil, nil, ""
+			requeued = append(requeued, &job)
+		}
+		q.jobs[job.ID] = &job
+	}
+	q.mu.Unlock()
+
+	sort.Slice(requeued, func(i, j int) bool { return requeued[i].CreatedAt.Before(requeued[j].CreatedAt) })
+	for _, job := range requeued {
+		select {
+		case q.pending <- job.ID:
+		default:
+			log.Printf("Jobs: queue full, job %s not resumed", job.ID)
+		}
+	}
+	if len(requeued) > 0 {
+		log.Printf("Jobs: resumed %d unfinished jobs", len(requeued))
+	}
+}
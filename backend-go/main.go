@@ -6,22 +6,32 @@ import (
         "os"
         "time"
 
+        "performa-backend/apierror"
+        "performa-backend/assets"
         "performa-backend/config"
         "performa-backend/database"
+        "performa-backend/executor"
+        "performa-backend/grpcapi"
         "performa-backend/handlers"
         "performa-backend/models"
+        "performa-backend/policy"
+        "performa-backend/presets"
+        "performa-backend/prompts"
+        "performa-backend/repo"
+        "performa-backend/roles"
+        "performa-backend/storage"
+        "performa-backend/telemetry"
+        "performa-backend/tools"
         "performa-backend/ws"
 
         "github.com/gofiber/fiber/v2"
         "github.com/gofiber/fiber/v2/middleware/cors"
         "github.com/gofiber/fiber/v2/middleware/logger"
+        "github.com/gofiber/fiber/v2/middleware/pprof"
         "github.com/gofiber/fiber/v2/middleware/proxy"
         "github.com/gofiber/fiber/v2/middleware/recover"
+        "github.com/gofiber/fiber/v2/middleware/requestid"
         "github.com/gofiber/websocket/v2"
-        "github.com/shirou/gopsutil/v3/cpu"
-        "github.com/shirou/gopsutil/v3/disk"
-        "github.com/shirou/gopsutil/v3/mem"
-        "github.com/shirou/gopsutil/v3/net"
 )
 
 func main() {
@@ -29,21 +39,128 @@ func main() {
 
         config.Load()
 
-        if err := database.Init(); err != nil {
+        if err := telemetry.Init(telemetry.Config{
+                ServiceName:    config.AppConfig.OTelServiceName,
+                ServiceVersion: config.AppConfig.OTelServiceVersion,
+                OTLPEndpoint:   config.AppConfig.OTLPEndpoint,
+                OTLPHeaders:    config.AppConfig.OTLPHeaders,
+                SampleRatio:    config.AppConfig.TraceSampleRatio,
+                FlushInterval:  time.Duration(config.AppConfig.OTLPFlushSeconds) * time.Second,
+                SyslogNetwork:  config.AppConfig.SyslogNetwork,
+                SyslogAddress:  config.AppConfig.SyslogAddress,
+                SyslogFormat:   config.AppConfig.SyslogFormat,
+        }); err != nil {
+                log.Printf("Warning: Telemetry initialization failed: %v", err)
+        }
+        defer telemetry.Shutdown()
+
+        if err := database.Init(database.PoolConfig{
+                MaxOpenConns:    config.AppConfig.DBMaxOpenConns,
+                MaxIdleConns:    config.AppConfig.DBMaxIdleConns,
+                ConnMaxLifetime: time.Duration(config.AppConfig.DBConnMaxLifetimeSecs) * time.Second,
+                ConnMaxIdleTime: time.Duration(config.AppConfig.DBConnMaxIdleTimeSecs) * time.Second,
+                QueryTimeout:    time.Duration(config.AppConfig.DBQueryTimeoutSeconds) * time.Second,
+                MaxRetries:      config.AppConfig.DBMaxRetries,
+        }); err != nil {
                 log.Printf("Warning: Database initialization failed: %v", err)
         }
         defer database.Close()
+        repo.Init()
+
+        handlers.InitSettings()
 
         os.MkdirAll(config.AppConfig.LogDir, 0755)
         os.MkdirAll(config.AppConfig.FindingsDir, 0755)
 
         models.Findings.SetFindingsDir(config.AppConfig.FindingsDir)
+
+        store, err := storage.Init(storage.Config{
+                Backend:     config.AppConfig.StorageBackend,
+                LocalRoot:   config.AppConfig.FindingsDir,
+                SigningKey:  config.AppConfig.StorageSigningKey,
+                S3Endpoint:  config.AppConfig.S3Endpoint,
+                S3Region:    config.AppConfig.S3Region,
+                S3Bucket:    config.AppConfig.S3Bucket,
+                S3AccessKey: config.AppConfig.S3AccessKeyID,
+                S3SecretKey: config.AppConfig.S3SecretAccessKey,
+                S3Prefix:    config.AppConfig.S3Prefix,
+                S3PathStyle: config.AppConfig.S3UsePathStyle,
+        })
+        if err != nil {
+                log.Printf("Warning: Storage backend initialization failed, using local findings directory: %v", err)
+        } else {
+                models.Findings.SetStorage(store)
+        }
         models.Findings.LoadFindings()
 
-        handlers.InitBrainClient()
+        prompts.Default.Load()
+        roles.Default.Load()
+        presets.Default.Load()
+        assets.Default.Load()
+        if path := config.AppConfig.CommandPolicyFile; path != "" {
+                if err := policy.Default.LoadFile(path); err != nil {
+                        log.Printf("Warning: Command policy file not loaded, using built-in rules: %v", err)
+                }
+        }
+        policy.Default.Load()
+        handlers.InitCredentials()
+        handlers.InitAuth()
+        handlers.InitWorkspaces()
+        handlers.InitIntegrations()
+        handlers.InitEscalation()
+        handlers.InitEmail()
+        handlers.InitSuppressions()
+        handlers.InitRules()
+        handlers.InitRetryPolicies()
 
+        handlers.InitBrainClient()
+        handlers.InitBenchmarks()
+        handlers.InitReports()
+        handlers.InitJobs()
+        handlers.InitScheduler()
+        handlers.InitSessionSnapshots()
+        handlers.InitOperationProgress()
+        handlers.InitCostTicker()
+        handlers.InitAgentReaper()
+        handlers.InitStats()
+        handlers.InitNuclei()
+        handlers.InitWordlists()
+        handlers.InitOSINT()
+        handlers.InitCVE()
+        handlers.InitCapture()
+        handlers.InitIdempotency()
+        handlers.InitPrivilegedNetwork()
+        handlers.InitRetention()
+
+        if config.AppConfig.RedisURL != "" {
+                if err := ws.MainHub.UseRedis(config.AppConfig.RedisURL, config.AppConfig.RedisWSChannel); err != nil {
+                        log.Printf("Warning: WebSocket backplane unavailable, broadcasts stay local to this instance: %v", err)
+                } else {
+                        defer ws.MainHub.CloseBackplane()
+                }
+        }
         go ws.MainHub.Run()
 
+        if err := executor.Configure(executor.SandboxConfig{
+                Backend:      config.AppConfig.ExecutionBackend,
+                DefaultImage: config.AppConfig.DockerSandboxImage,
+                Images:       config.AppConfig.DockerSandboxImages,
+                CPUs:         config.AppConfig.DockerSandboxCPUs,
+                MemoryMB:     config.AppConfig.DockerSandboxMemoryMB,
+                PidsLimit:    256,
+                Network:      config.AppConfig.DockerSandboxNetwork,
+        }); err != nil {
+                log.Printf("Warning: %v; running tools on the host", err)
+        } else {
+                log.Printf("Tools: using %s execution backend", executor.Backend())
+        }
+
+        go func() {
+                report := tools.Probe()
+                log.Printf("Tools: %d of %d allowed tools installed", report.Available, len(report.Tools))
+        }()
+
+        handlers.InitResourceAlerts()
         go startResourceMonitor()
 
         app := fiber.New(fiber.Config{
@@ -51,13 +168,16 @@ func main() {
                 ServerHeader:  "Performa",
                 StrictRouting: false,
                 CaseSensitive: false,
+                ErrorHandler:  apierror.Handler,
         })
 
         app.Use(recover.New())
+        app.Use(requestid.New(requestid.Config{ContextKey: apierror.RequestIDLocalsKey}))
         app.Use(logger.New(logger.Config{
                 Format:     "${time} | ${status} | ${latency} | ${method} ${path}\n",
                 TimeFormat: "2006-01-02 15:04:05",
         }))
+        app.Use(handlers.TraceRequests)
 
         app.Use(cors.New(cors.Config{
                 AllowOrigins: "*",
@@ -65,6 +185,9 @@ func main() {
                 AllowHeaders: "*",
         }))
 
+        app.Use("/api/admin/debug/pprof", handlers.RequireAdmin)
+        app.Use(pprof.New(pprof.Config{Prefix: "/api/admin"}))
+
         app.Get("/", func(c *fiber.Ctx) error {
                 return c.JSON(fiber.Map{
                         "message": "Performa Backend Infrastructure",
@@ -81,25 +204,290 @@ func main() {
         })
 
         app.Get("/api/health", func(c *fiber.Ctx) error {
+                db := database.Health()
+                status := "healthy"
+                if db.Enabled && !db.Reachable {
+                        status = "degraded"
+                }
                 return c.JSON(fiber.Map{
-                        "status":  "healthy",
-                        "service": "backend-go",
+                        "status":   status,
+                        "service":  "backend-go",
+                        "database": db,
                 })
         })
+        app.Get("/api/health/live", handlers.HealthLive)
+        app.Get("/api/health/ready", handlers.HealthReady)
 
-        api := app.Group("/api")
+        api := app.Group("/api", handlers.Authenticate, handlers.ResolveWorkspace, handlers.Idempotent)
         {
+                api.Post("/auth/login", handlers.Login)
+                api.Post("/auth/refresh", handlers.RefreshToken)
+                api.Post("/auth/logout", handlers.Logout)
+                api.Get("/auth/me", handlers.GetCurrentUser)
+                api.Put("/auth/password", handlers.ChangePassword)
+
+                accounts := api.Group("/users", handlers.RequireAdmin)
+                accounts.Get("/", handlers.GetUsers)
+                accounts.Post("/", handlers.CreateUser)
+                accounts.Put("/:id", handlers.UpdateUser)
+                accounts.Delete("/:id", handlers.DeleteUser)
+
+                api.Get("/workspaces", handlers.GetWorkspaces)
+                api.Post("/workspaces", handlers.RequireAdmin, handlers.CreateWorkspace)
+                api.Get("/workspaces/:id", handlers.GetWorkspace)
+                api.Put("/workspaces/:id", handlers.RequireAdmin, handlers.UpdateWorkspace)
+                api.Delete("/workspaces/:id", handlers.RequireAdmin, handlers.DeleteWorkspace)
+                api.Post("/workspaces/:id/keys", handlers.RequireAdmin, handlers.CreateWorkspaceAPIKey)
+                api.Delete("/workspaces/:id/keys/:keyId", handlers.RequireAdmin, handlers.DeleteWorkspaceAPIKey)
+
+                api.Get("/admin/settings", handlers.RequireAdmin, handlers.GetSettings)
+                api.Put("/admin/settings", handlers.RequireAdmin, handlers.UpdateSettings)
+                api.Get("/admin/runtime", handlers.RequireAdmin, handlers.GetRuntime)
+                api.Get("/admin/ws/clients", handlers.RequireAdmin, handlers.GetWSClients)
+                api.Delete("/admin/ws/clients/:id", handlers.RequireAdmin, handlers.DisconnectWSClient)
+
+                network := api.Group("/admin/network", handlers.RequireAdmin)
+                {
+                        network.Get("/interfaces", handlers.GetNetworkInterfaces)
+                        network.Post("/interfaces/:name/mac", handlers.SpoofInterfaceMAC)
+                        network.Delete("/interfaces/:name/mac", handlers.RestoreInterfaceMAC)
+                        network.Get("/audit", handlers.GetNetworkAudit)
+                }
+
+                api.Get("/admin/retention", handlers.RequireAdmin, handlers.GetRetention)
+                api.Get("/admin/retention/preview", handlers.RequireAdmin, handlers.PreviewRetention)
+                api.Post("/admin/retention/run", handlers.RequireAdmin, handlers.RunRetention)
+                api.Post("/admin/backup", handlers.RequireAdmin, handlers.CreateBackup)
+                api.Post("/admin/restore", handlers.RequireAdmin, handlers.RestoreBackup)
+
+                api.Get("/credentials", handlers.GetCredentials)
+                api.Post("/credentials", handlers.CreateCredential)
+                api.Get("/credentials/:id", handlers.GetCredential)
+                api.Put("/credentials/:id", handlers.UpdateCredential)
+                api.Delete("/credentials/:id", handlers.DeleteCredential)
+
+                api.Get("/credential-findings", handlers.GetCapturedCredentials)
+                api.Get("/credential-findings/:id", handlers.GetCapturedCredential)
+                api.Post("/credential-findings/:id/reveal", handlers.RequireAdmin, handlers.RevealCapturedCredential)
+                api.Get("/credential-findings/:id/reveals", handlers.RequireAdmin, handlers.GetCapturedCredentialReveals)
+
                 api.Get("/resources", handlers.GetResources)
+                api.Get("/resources/alerts", handlers.GetResourceAlerts)
 
                 api.Get("/models", handlers.GetModels)
                 api.Post("/models/chat", handlers.ModelChat)
                 api.Post("/models/test", handlers.TestModel)
-
+                api.Post("/models/benchmark", handlers.BenchmarkModels)
+                api.Get("/models/benchmarks", handlers.GetModelBenchmarks)
+                api.Get("/models/benchmarks/:id", handlers.GetModelBenchmark)
+
+                api.Get("/reports/templates", handlers.GetReportTemplates)
+                api.Post("/reports/templates", handlers.CreateReportTemplate)
+                api.Post("/reports/templates/preview", handlers.PreviewReportTemplate)
+                api.Get("/reports/templates/:id", handlers.GetReportTemplate)
+                api.Put("/reports/templates/:id", handlers.UpdateReportTemplate)
+                api.Delete("/reports/templates/:id", handlers.DeleteReportTemplate)
+                api.Get("/reports/templates/:id/preview", handlers.GetReportTemplatePreview)
+
+                api.Get("/stats", handlers.GetStats)
                 api.Get("/findings", handlers.GetFindings)
                 api.Get("/findings/logs", handlers.GetFindingsLogs)
                 api.Get("/findings/explorer", handlers.GetFindingsExplorer)
-                api.Get("/findings/:id", handlers.GetFinding)
+                api.Post("/findings/explorer/folders", handlers.CreateExplorerFolder)
+                api.Post("/findings/explorer/move", handlers.MoveExplorerEntry)
+                api.Delete("/findings/explorer", handlers.DeleteExplorerEntry)
+                api.Get("/findings/explorer/trash", handlers.GetExplorerTrash)
+                api.Delete("/findings/explorer/trash", handlers.EmptyExplorerTrash)
+                api.Post("/findings/explorer/archive", handlers.ArchiveExplorerFolder)
+                api.Get("/findings/:id", handlers.FindingInWorkspace, handlers.GetFinding)
                 api.Post("/findings", handlers.CreateFinding)
+                api.Post("/findings/ingest", handlers.IngestFindings)
+                api.Patch("/findings/:id", handlers.FindingInWorkspace, handlers.UpdateFinding)
+                api.Post("/findings/:id/remediate", handlers.FindingInWorkspace, handlers.RemediateFinding)
+                api.Post("/findings/:id/enrich", handlers.FindingInWorkspace, handlers.EnrichFindingCVEs)
+                api.Post("/findings/:id/retest", handlers.FindingInWorkspace, handlers.RetestFinding)
+                api.Get("/findings/:id/retests", handlers.FindingInWorkspace, handlers.GetFindingRetests)
+
+                api.Get("/integrations", handlers.GetIntegrations)
+                api.Post("/integrations", handlers.CreateIntegration)
+                api.Post("/integrations/sync", handlers.SyncIntegrations)
+                api.Get("/integrations/:id", handlers.GetIntegration)
+                api.Put("/integrations/:id", handlers.UpdateIntegration)
+                api.Delete("/integrations/:id", handlers.DeleteIntegration)
+                api.Post("/integrations/:id/push", handlers.PushFindings)
+
+                api.Get("/policies", handlers.GetPolicies)
+                api.Post("/policies", handlers.CreatePolicy)
+                api.Get("/policies/:id", handlers.GetPolicy)
+                api.Put("/policies/:id", handlers.UpdatePolicy)
+                api.Delete("/policies/:id", handlers.DeletePolicy)
+                api.Post("/policies/:id/digest", handlers.SendPolicyDigest)
+                api.Get("/email/settings", handlers.GetEmailSettings)
+                api.Post("/email/test", handlers.SendTestEmail)
+                api.Get("/email/recipients", handlers.GetEmailRecipients)
+                api.Post("/email/recipients", handlers.CreateEmailRecipient)
+                api.Get("/email/recipients/:id", handlers.GetEmailRecipient)
+                api.Put("/email/recipients/:id", handlers.UpdateEmailRecipient)
+                api.Delete("/email/recipients/:id", handlers.DeleteEmailRecipient)
+                api.Post("/email/recipients/:id/digest", handlers.SendRecipientDigest)
+                api.Get("/email/recipients/:id/digest/preview", handlers.PreviewRecipientDigest)
+                api.Get("/rules", handlers.GetRules)
+                api.Post("/rules", handlers.CreateRule)
+                api.Put("/rules/order", handlers.ReorderRules)
+                api.Post("/rules/test", handlers.TestRules)
+                api.Get("/rules/:id", handlers.GetRule)
+                api.Put("/rules/:id", handlers.UpdateRule)
+                api.Delete("/rules/:id", handlers.DeleteRule)
+                api.Get("/retry-policies", handlers.GetRetryPolicies)
+                api.Put("/retry-policies/:class", handlers.RequireAdmin, handlers.UpdateRetryPolicy)
+                api.Delete("/retry-policies/:class", handlers.RequireAdmin, handlers.ResetRetryPolicy)
+                api.Get("/suppressions", handlers.GetSuppressions)
+                api.Post("/suppressions", handlers.CreateSuppression)
+                api.Get("/suppressions/:id", handlers.GetSuppression)
+                api.Put("/suppressions/:id", handlers.UpdateSuppression)
+                api.Delete("/suppressions/:id", handlers.DeleteSuppression)
+
+                api.Get("/logs", handlers.GetLogFiles)
+                api.Get("/logs/:name", handlers.ReadLogFile)
+                api.Get("/logs/:name/tail", handlers.TailLogFile)
+                api.Get("/findings/:id/attachments", handlers.FindingInWorkspace, handlers.GetFindingAttachments)
+                api.Post("/findings/:id/attachments", handlers.FindingInWorkspace, handlers.UploadFindingAttachment)
+                api.Post("/findings/:id/captures", handlers.FindingInWorkspace, handlers.LinkFindingCaptures)
+
+                api.Get("/storage/*", handlers.DownloadStoredObject)
+
+                api.Post("/agents/bulk", handlers.BulkAgentAction)
+                api.Get("/agents/:id/messages", handlers.AgentInWorkspace, handlers.GetAgentMessages)
+                api.Post("/agents/:id/chat", handlers.AgentInWorkspace, handlers.ChatWithAgent)
+                api.Post("/agents/:id/pause", handlers.AgentInWorkspace, handlers.PauseAgent)
+                api.Post("/agents/:id/resume", handlers.AgentInWorkspace, handlers.ResumeAgent)
+                api.Get("/agents/:id/checkpoint", handlers.AgentInWorkspace, handlers.GetAgentCheckpoint)
+                api.Get("/agents/:id/fingerprint", handlers.AgentInWorkspace, handlers.GetAgentFingerprint)
+                api.Get("/agents/:id/limits", handlers.AgentInWorkspace, handlers.GetAgentLimits)
+                api.Get("/agents/:id/steps", handlers.AgentInWorkspace, handlers.GetAgentSteps)
+                api.Get("/agents/:id/failures", handlers.AgentInWorkspace, handlers.GetAgentFailures)
+                api.Get("/agents/:id/recording", handlers.AgentInWorkspace, handlers.GetAgentRecording)
+                api.Post("/agents/:id/replay", handlers.AgentInWorkspace, handlers.ReplayAgent)
+                api.Put("/agents/:id/limits", handlers.AgentInWorkspace, handlers.UpdateAgentLimits)
+                api.Post("/agents/:id/retry-from-checkpoint", handlers.AgentInWorkspace, handlers.RetryAgentFromCheckpoint)
+
+                api.Get("/sessions/compare", handlers.CompareSessions)
+                api.Post("/session/import", handlers.ImportSession)
+                api.Get("/session/:id/export", handlers.SessionInWorkspace, handlers.ExportSession)
+                api.Post("/session/:id/resume", handlers.SessionInWorkspace, handlers.ResumeSessionHandler)
+
+                api.Get("/config/presets", handlers.GetPresets)
+                api.Post("/config/presets", handlers.CreatePreset)
+                api.Get("/config/presets/:id", handlers.GetPreset)
+                api.Delete("/config/presets/:id", handlers.DeletePreset)
+                api.Post("/config/presets/:id/instantiate", handlers.InstantiatePreset)
+
+                api.Post("/config/import", handlers.ImportConfig)
+
+                api.Get("/config", handlers.GetConfigs)
+                api.Post("/config", handlers.SaveConfig)
+                api.Get("/config/:id", handlers.ConfigInWorkspace, handlers.GetConfig)
+                api.Put("/config/:id", handlers.ConfigInWorkspace, handlers.UpdateConfig)
+                api.Delete("/config/:id", handlers.ConfigInWorkspace, handlers.DeleteConfig)
+                api.Post("/config/:id/duplicate", handlers.ConfigInWorkspace, handlers.DuplicateConfig)
+                api.Get("/config/:id/export", handlers.ConfigInWorkspace, handlers.ExportConfig)
+
+                api.Get("/operations", handlers.GetOperations)
+                api.Post("/operations", handlers.StartOperation)
+                api.Get("/operations/compare", handlers.CompareOperations)
+                api.Get("/operations/:id", handlers.OperationInWorkspace, handlers.GetOperation)
+                api.Get("/operations/:id/network", handlers.OperationInWorkspace, handlers.GetOperationNetwork)
+                api.Get("/operations/:id/noise", handlers.OperationInWorkspace, handlers.GetOperationNoise)
+                api.Get("/operations/:id/blackboard", handlers.OperationInWorkspace, handlers.GetOperationBlackboard)
+                api.Get("/operations/:id/plan", handlers.OperationInWorkspace, handlers.GetOperationPlan)
+                api.Get("/operations/:id/targets", handlers.OperationInWorkspace, handlers.GetOperationTargets)
+                api.Get("/operations/:id/timeline", handlers.OperationInWorkspace, handlers.GetOperationTimeline)
+                api.Get("/operations/:id/graph", handlers.OperationInWorkspace, handlers.GetOperationGraph)
+                api.Get("/operations/:id/report", handlers.OperationInWorkspace, handlers.GetOperationReport)
+                api.Get("/operations/:id/report/summary", handlers.OperationInWorkspace, handlers.GetReportSummary)
+                api.Post("/operations/:id/report/summary", handlers.OperationInWorkspace, handlers.GenerateReportSummary)
+                api.Put("/operations/:id/report/summary", handlers.OperationInWorkspace, handlers.UpdateReportSummary)
+                api.Put("/operations/:id/budget", handlers.OperationInWorkspace, handlers.UpdateOperationBudget)
+                api.Get("/operations/:id/snapshots", handlers.OperationInWorkspace, handlers.GetOperationSnapshots)
+                api.Post("/operations/:id/snapshots", handlers.OperationInWorkspace, handlers.CreateOperationSnapshot)
+                api.Get("/operations/:id/captures", handlers.OperationInWorkspace, handlers.GetOperationCaptures)
+                api.Get("/operations/:id/captures/har", handlers.OperationInWorkspace, handlers.ExportOperationCaptures)
+                api.Get("/operations/:id/spoofing", handlers.OperationInWorkspace, handlers.GetOperationSpoofing)
+                api.Post("/operations/:id/spoofing", handlers.OperationInWorkspace, handlers.RequireAdmin, handlers.StartOperationSpoofing)
+                api.Delete("/operations/:id/spoofing/:sessionId", handlers.OperationInWorkspace, handlers.RequireAdmin, handlers.StopOperationSpoofing)
+                api.Get("/captures/ca", handlers.GetCaptureCA)
+                api.Get("/captures/:id", handlers.GetCapture)
+                api.Post("/targets/import", handlers.ImportTargets)
+
+                api.Get("/tools/available", handlers.GetAvailableTools)
+                api.Get("/tools/install", handlers.GetInstallableTools)
+                api.Post("/tools/install", handlers.RequireAdmin, handlers.InstallTools)
+                api.Get("/tools/install/:id", handlers.GetToolInstallJob)
+                api.Get("/tools/policy", handlers.GetCommandPolicy)
+                api.Put("/tools/policy", handlers.RequireAdmin, handlers.UpdateCommandPolicy)
+                api.Post("/tools/validate", handlers.ValidateCommand)
+                api.Get("/tools/nuclei/status", handlers.GetNucleiStatus)
+                api.Get("/tools/nuclei/templates", handlers.GetNucleiTemplates)
+                api.Post("/tools/nuclei/templates/sync", handlers.RequireAdmin, handlers.SyncNucleiTemplates)
+                api.Post("/tools/nuclei/templates/pin", handlers.PinNucleiTemplates)
+                api.Get("/tools/nuclei/templates/:id", handlers.GetNucleiTemplate)
+
+                api.Get("/wordlists", handlers.GetWordlists)
+                api.Post("/wordlists", handlers.RequireAdmin, handlers.UploadWordlist)
+                api.Post("/wordlists/verify", handlers.RequireAdmin, handlers.VerifyWordlists)
+                api.Get("/wordlists/:name", handlers.GetWordlist)
+                api.Delete("/wordlists/:name", handlers.RequireAdmin, handlers.DeleteWordlist)
+
+                api.Get("/osint/providers", handlers.GetOSINTProviders)
+                api.Get("/osint/host/:ip", handlers.GetOSINTHost)
+
+                api.Get("/cves/status", handlers.GetCVEStatus)
+                api.Post("/cves/kev/sync", handlers.RequireAdmin, handlers.SyncKEVCatalog)
+                api.Get("/cves/:id", handlers.GetCVE)
+
+                api.Get("/assets", handlers.GetAssets)
+                api.Get("/assets/:id", handlers.GetAsset)
+                api.Get("/assets/:id/services", handlers.GetAssetServices)
+                api.Post("/stealth/check", handlers.CheckStealthRoute)
+
+                api.Get("/jobs", handlers.GetJobs)
+                api.Post("/jobs", handlers.CreateJob)
+                api.Get("/jobs/:id", handlers.GetJob)
+
+                schedules := api.Group("/schedules")
+                {
+                        schedules.Get("/", handlers.GetSchedules)
+                        schedules.Post("/", handlers.CreateSchedule)
+                        schedules.Get("/:id", handlers.ScheduleInWorkspace, handlers.GetSchedule)
+                        schedules.Put("/:id", handlers.ScheduleInWorkspace, handlers.UpdateSchedule)
+                        schedules.Delete("/:id", handlers.ScheduleInWorkspace, handlers.DeleteSchedule)
+                        schedules.Post("/:id/enable", handlers.ScheduleInWorkspace, handlers.EnableSchedule)
+                        schedules.Post("/:id/disable", handlers.ScheduleInWorkspace, handlers.DisableSchedule)
+                        schedules.Post("/:id/pause", handlers.ScheduleInWorkspace, handlers.PauseSchedule)
+                        schedules.Post("/:id/resume", handlers.ScheduleInWorkspace, handlers.ResumeSchedule)
+                        schedules.Post("/:id/run", handlers.ScheduleInWorkspace, handlers.RunScheduleNow)
+                        schedules.Get("/:id/runs", handlers.ScheduleInWorkspace, handlers.GetScheduleRuns)
+                }
+
+                promptTemplates := api.Group("/prompts")
+                {
+                        promptTemplates.Get("/", handlers.GetPromptTemplates)
+                        promptTemplates.Post("/", handlers.CreatePromptTemplate)
+                        promptTemplates.Get("/:id", handlers.GetPromptTemplate)
+                        promptTemplates.Put("/:id", handlers.UpdatePromptTemplate)
+                        promptTemplates.Delete("/:id", handlers.DeletePromptTemplate)
+                        promptTemplates.Get("/:id/versions", handlers.GetPromptTemplateVersions)
+                        promptTemplates.Post("/:id/rollback", handlers.RollbackPromptTemplate)
+                }
+
+                agentRoles := api.Group("/roles")
+                {
+                        agentRoles.Get("/", handlers.GetRoles)
+                        agentRoles.Post("/", handlers.CreateRole)
+                        agentRoles.Get("/:id", handlers.GetRole)
+                        agentRoles.Put("/:id", handlers.UpdateRole)
+                        agentRoles.Delete("/:id", handlers.DeleteRole)
+                }
 
                 brain := api.Group("/brain")
                 {
@@ -111,53 +499,67 @@ func main() {
                         brain.Post("/strategy", handlers.BrainStrategy)
                         brain.Get("/models", handlers.BrainModels)
                         brain.Post("/learn", handlers.BrainLearn)
+                        brain.Get("/learning", handlers.GetBrainLearning)
+                        brain.Put("/learning", handlers.UpdateBrainLearning)
+                        brain.Post("/learning/flush", handlers.FlushBrainLearning)
+                        brain.Get("/cache", handlers.GetBrainCache)
                         brain.Post("/reset", handlers.BrainReset)
                 }
         }
 
-        brainURL := config.AppConfig.BrainServiceURL
         
         app.All("/api/config", func(c *fiber.Ctx) error {
-                return proxy.Do(c, brainURL+"/api/config")
+                return proxyToBrain(c, "/api/config")
         })
         app.All("/api/config/*", func(c *fiber.Ctx) error {
-                return proxy.Do(c, brainURL+"/api/config/"+c.Params("*"))
+                return proxyToBrain(c, "/api/config/"+c.Params("*"))
         })
         
         app.All("/api/agents", func(c *fiber.Ctx) error {
-                return proxy.Do(c, brainURL+"/api/agents")
+                return proxyToBrain(c, "/api/agents")
         })
         app.All("/api/agents/*", func(c *fiber.Ctx) error {
-                return proxy.Do(c, brainURL+"/api/agents/"+c.Params("*"))
+                return proxyToBrain(c, "/api/agents/"+c.Params("*"))
         })
         
         app.All("/api/mission", func(c *fiber.Ctx) error {
-                return proxy.Do(c, brainURL+"/api/mission")
+                return proxyToBrain(c, "/api/mission")
         })
         app.All("/api/mission/*", func(c *fiber.Ctx) error {
-                return proxy.Do(c, brainURL+"/api/mission/"+c.Params("*"))
+                return proxyToBrain(c, "/api/mission/"+c.Params("*"))
         })
         
         app.All("/api/session", func(c *fiber.Ctx) error {
-                return proxy.Do(c, brainURL+"/api/session")
+                return proxyToBrain(c, "/api/session")
         })
         app.All("/api/session/*", func(c *fiber.Ctx) error {
-                return proxy.Do(c, brainURL+"/api/session/"+c.Params("*"))
+                return proxyToBrain(c, "/api/session/"+c.Params("*"))
         })
 
         app.All("/api/start", func(c *fiber.Ctx) error {
-                return proxy.Do(c, brainURL+"/api/start")
+                return proxyToBrain(c, "/api/start")
         })
 
         app.All("/api/stop", func(c *fiber.Ctx) error {
-                return proxy.Do(c, brainURL+"/api/stop")
+                return proxyToBrain(c, "/api/stop")
         })
 
-        app.Use("/ws", ws.WebSocketUpgrade)
-        app.Get("/ws/live", websocket.New(ws.HandleWebSocket))
+        app.Use("/ws", handlers.AuthenticateWebSocket, handlers.ResolveWorkspace, ws.WebSocketUpgrade)
+        app.Get("/ws/live", websocket.New(ws.HandleWebSocket, websocket.Config{
+                EnableCompression: true,
+        }))
 
         printStartupInfo()
 
+        if config.AppConfig.GRPCPort > 0 {
+                grpcAddr := fmt.Sprintf("%s:%d", config.AppConfig.Host, config.AppConfig.GRPCPort)
+                go func() {
+                        if err := grpcapi.Serve(grpcAddr); err != nil {
+                                log.Printf("Warning: gRPC API stopped: %v", err)
+                        }
+                }()
+        }
+
         addr := fmt.Sprintf("%s:%d", config.AppConfig.Host, config.AppConfig.Port)
         log.Printf("Server starting on http://%s", addr)
 
@@ -182,6 +584,7 @@ func printStartupInfo() {
         fmt.Println("Performa Backend Infrastructure Starting...")
         fmt.Printf("Log Directory: %s\n", config.AppConfig.LogDir)
         fmt.Printf("Findings Directory: %s\n", config.AppConfig.FindingsDir)
+        fmt.Printf("Storage Backend: %s\n", config.AppConfig.StorageBackend)
 
         if config.AppConfig.OpenRouterAPIKey != "" && config.AppConfig.OpenRouterAPIKey != "your_key" {
                 fmt.Println("OpenRouter API Key: Configured")
@@ -201,34 +604,31 @@ func printStartupInfo() {
 }
 
 func startResourceMonitor() {
-        ticker := time.NewTicker(5 * time.Second)
+        interval := time.Duration(config.AppConfig.ResourceMonitorInterval) * time.Second
+        if interval <= 0 {
+                interval = 5 * time.Second
+        }
+
+        ticker := time.NewTicker(interval)
         defer ticker.Stop()
 
-        for range ticker.C {
-                cpuPercent, _ := cpu.Percent(0, false)
-                cpuUsage := 0.0
-                if len(cpuPercent) > 0 {
-                        cpuUsage = cpuPercent[0]
-                }
+        // Prime the network counters so the first broadcast reports a rate.
+        handlers.CollectResources()
 
-                memInfo, _ := mem.VirtualMemory()
-                memUsage := 0.0
-                if memInfo != nil {
-                        memUsage = memInfo.UsedPercent
-                }
-
-                diskInfo, _ := disk.Usage("/")
-                diskUsage := 0.0
-                if diskInfo != nil {
-                        diskUsage = diskInfo.UsedPercent
-                }
+        for range ticker.C {
+                stats := handlers.CollectResources()
+                ws.BroadcastResources(stats.CPU, stats.Memory, stats.Disk, stats.Network, stats)
 
-                netIO, _ := net.IOCounters(false)
-                networkUsage := 0.0
-                if len(netIO) > 0 {
-                        networkUsage = float64(netIO[0].BytesSent+netIO[0].BytesRecv) / 1024 / 1024
+                for _, alert := range handlers.EvaluateResourceAlerts(stats) {
+                        ws.BroadcastResourceAlert(alert)
                 }
+        }
+}
 
-                ws.BroadcastResources(cpuUsage, memUsage, diskUsage, networkUsage)
+// proxyToBrain forwards the request to path on the Brain service.
+func proxyToBrain(c *fiber.Ctx, path string) error {
+        if err := proxy.Do(c, config.AppConfig.BrainServiceURL+path); err != nil {
+                return apierror.New(503, apierror.BrainUnavailable, "Brain service unavailable").WithReason(err)
         }
+        return nil
 }
@@ -1,9 +1,13 @@
 package models
 
 import (
+	"math"
 	"sync"
 	"time"
 
+	"performa-backend/failures"
+	"performa-backend/provider"
+
 	"github.com/google/uuid"
 )
 
@@ -15,6 +19,10 @@ const (
 	AgentStatusPaused   AgentStatus = "paused"
 	AgentStatusComplete AgentStatus = "complete"
 	AgentStatusError    AgentStatus = "error"
+	AgentStatusStopped  AgentStatus = "stopped"
+	// AgentStatusThrottled is a pause imposed by the agent's resource
+	// limits; Agent.ThrottleReasons says which.
+	AgentStatusThrottled AgentStatus = "throttled"
 )
 
 type AgentConfig struct {
@@ -25,13 +33,36 @@ type AgentConfig struct {
 	StealthOptions   StealthOptions `json:"stealth_options"`
 	Capabilities     Capabilities   `json:"capabilities"`
 	OSType           string         `json:"os_type"`
+	PromptTemplateID string         `json:"prompt_template_id,omitempty"`
+	ToolCategories   []string       `json:"tool_categories,omitempty"`
+	Limits           AgentLimits    `json:"limits"`
+	// Sampling is the agent's sampling parameters, the request's over its
+	// role's defaults.
+	Sampling provider.Sampling `json:"sampling,omitempty"`
+}
+
+// AgentLimits caps an agent's resource use; zero leaves a limit off.
+// MaxCPUSeconds is the CPU time of all of the agent's tool processes together
+// and MaxMemoryMB the memory of any one of its tool runs. MaxConcurrentTools
+// caps the agent's tool runs at a time and MaxLLMCalls its model calls.
+type AgentLimits struct {
+	MaxCPUSeconds      float64 `json:"max_cpu_seconds,omitempty" validate:"min=0"`
+	MaxMemoryMB        int     `json:"max_memory_mb,omitempty" validate:"min=0"`
+	MaxConcurrentTools int     `json:"max_concurrent_tools,omitempty" validate:"min=0"`
+	MaxLLMCalls        int     `json:"max_llm_calls,omitempty" validate:"min=0"`
 }
 
+// AgentResources is the latest sample of an agent's resource usage: CPU percent
+// and RSS (MB) of its tool processes, their disk I/O (KB/s) and LLM traffic (KB/s).
 type AgentResources struct {
-	CPUUsage    float64 `json:"cpu_usage"`
-	MemoryUsage float64 `json:"memory_usage"`
-	DiskUsage   float64 `json:"disk_usage"`
-	NetworkIO   float64 `json:"network_io"`
+	CPUUsage          float64 `json:"cpu_usage"`
+	MemoryUsage       float64 `json:"memory_usage"`
+	DiskUsage         float64 `json:"disk_usage"`
+	NetworkIO         float64 `json:"network_io"`
+	RequestRate       float64 `json:"request_rate"`
+	RateLimitRps      int     `json:"rate_limit_rps"`
+	ThrottledRequests int64   `json:"throttled_requests"`
+	Processes         int     `json:"processes"`
 }
 
 type Agent struct {
@@ -49,6 +80,80 @@ type Agent struct {
 	Config      AgentConfig    `json:"config"`
 	Resources   AgentResources `json:"resources"`
 	Progress    int            `json:"progress"`
+	OperationID string         `json:"operation_id,omitempty"`
+	// WorkspaceID is set on agents restored from a saved session, which have
+	// no live operation; other agents belong to their operation's workspace.
+	WorkspaceID string     `json:"workspace_id,omitempty"`
+	Usage       AgentUsage `json:"usage"`
+	// Context describes the conversation the agent last sent to its model.
+	Context AgentContext `json:"context"`
+	// ElapsedSeconds is the agent's running time since creation, excluding
+	// the time it spent paused.
+	ElapsedSeconds float64    `json:"elapsed_seconds"`
+	PausedSeconds  float64    `json:"paused_seconds"`
+	PausedAt       *time.Time `json:"paused_at,omitempty"`
+	// ThrottleReasons lists the limits a throttled agent hit.
+	ThrottleReasons []string `json:"throttle_reasons,omitempty"`
+	// LastHeartbeat is when the agent's loop last reported in. A running
+	// agent silent for too long is flagged stale at StaleSince, and failed by
+	// the reaper at ReapedAt.
+	LastHeartbeat *time.Time `json:"last_heartbeat,omitempty"`
+	StaleSince    *time.Time `json:"stale_since,omitempty"`
+	ReapedAt      *time.Time `json:"reaped_at,omitempty"`
+	// Failures lists the classified errors the agent ran into and what
+	// their retry policies did, newest last; ErrorClass is the class of the
+	// error an agent in error status failed with.
+	Failures   []failures.Failure `json:"failures,omitempty"`
+	ErrorClass string             `json:"error_class,omitempty"`
+}
+
+// Active reports whether the agent's loop is still going: running, paused or
+// throttled.
+func (a *Agent) Active() bool {
+	return a.Status == AgentStatusRunning || a.Status == AgentStatusPaused || a.Status == AgentStatusThrottled
+}
+
+// refreshElapsed must be called with the manager's lock held. A paused agent's
+// clock stops at the moment it was paused.
+func (a *Agent) refreshElapsed(now time.Time) {
+	end := now
+	if a.PausedAt != nil {
+		end = *a.PausedAt
+	}
+	a.ElapsedSeconds = end.Sub(a.CreatedAt).Seconds() - a.PausedSeconds
+	if a.ElapsedSeconds < 0 {
+		a.ElapsedSeconds = 0
+	}
+}
+
+// AgentUsage accumulates the measured cost of an agent's LLM calls and tool runs.
+type AgentUsage struct {
+	LLMCalls         int     `json:"llm_calls"`
+	LLMLatencyMs     int64   `json:"llm_latency_ms"`
+	LastLLMLatencyMs int64   `json:"last_llm_latency_ms"`
+	BytesSent        int64   `json:"bytes_sent"`
+	BytesReceived    int64   `json:"bytes_received"`
+	ToolRuns         int     `json:"tool_runs"`
+	ToolCPUSeconds   float64 `json:"tool_cpu_seconds"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// AgentContext is the size of an agent's conversation against its model's
+// context window, in estimated tokens, and how often older turns had to be
+// summarized or dropped to keep it under the threshold.
+type AgentContext struct {
+	Limit              int        `json:"limit"`
+	Threshold          int        `json:"threshold"`
+	Tokens             int        `json:"tokens"`
+	PinnedTokens       int        `json:"pinned_tokens"`
+	Messages           int        `json:"messages"`
+	UsedPercent        float64    `json:"used_percent"`
+	Summarizations     int        `json:"summarizations"`
+	SummarizedMessages int        `json:"summarized_messages"`
+	DroppedMessages    int        `json:"dropped_messages"`
+	LastCompactedAt    *time.Time `json:"last_compacted_at,omitempty"`
 }
 
 type AgentMessage struct {
@@ -58,17 +163,32 @@ type AgentMessage struct {
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
 	ToolUsed  string    `json:"tool_used,omitempty"`
+	// Sampling is the sampling parameters of the model call that produced
+	// an assistant message.
+	Sampling *provider.Sampling `json:"sampling,omitempty"`
 }
 
 type AgentManager struct {
-	agents   map[string]*Agent
-	messages map[string][]AgentMessage
-	mu       sync.RWMutex
+	agents      map[string]*Agent
+	messages    map[string][]AgentMessage
+	subscribers map[string]map[chan AgentMessage]struct{}
+	blackboards map[string][]BlackboardEntry
+	inbox       map[string][]string
+	pauseGates  map[string]chan struct{}
+	checkpoints map[string]*AgentCheckpoint
+	steps       map[string][]AgentStep
+	mu          sync.RWMutex
 }
 
 var Manager = &AgentManager{
-	agents:   make(map[string]*Agent),
-	messages: make(map[string][]AgentMessage),
+	agents:      make(map[string]*Agent),
+	messages:    make(map[string][]AgentMessage),
+	subscribers: make(map[string]map[chan AgentMessage]struct{}),
+	blackboards: make(map[string][]BlackboardEntry),
+	inbox:       make(map[string][]string),
+	pauseGates:  make(map[string]chan struct{}),
+	checkpoints: make(map[string]*AgentCheckpoint),
+	steps:       make(map[string][]AgentStep),
 }
 
 func (m *AgentManager) CreateAgent(name, role, target, model string) *Agent {
@@ -137,6 +257,45 @@ func (m *AgentManager) CreateAgentWithConfig(name, role, target, model string, c
 	return agent
 }
 
+// RestoreAgent re-registers an agent from a saved snapshot together with its
+// message history. The snapshot ID is kept unless an agent with that ID is
+// already live, in which case a fresh ID is assigned.
+func (m *AgentManager) RestoreAgent(snapshot Agent, history []AgentMessage) *Agent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent := snapshot
+	if _, exists := m.agents[agent.ID]; exists || agent.ID == "" {
+		agent.ID = uuid.New().String()
+	}
+	if agent.CreatedAt.IsZero() {
+		agent.CreatedAt = time.Now()
+	}
+	agent.UpdatedAt = time.Now()
+	if agent.Status == AgentStatusPaused || agent.Status == AgentStatusThrottled {
+		m.pauseGates[agent.ID] = make(chan struct{})
+	} else {
+		agent.PausedAt = nil
+	}
+	if agent.Status == AgentStatusRunning {
+		agent.revive(agent.UpdatedAt)
+	}
+
+	messages := make([]AgentMessage, 0, len(history))
+	for _, msg := range history {
+		msg.AgentID = agent.ID
+		if msg.ID == "" {
+			msg.ID = uuid.New().String()
+		}
+		messages = append(messages, msg)
+	}
+
+	m.agents[agent.ID] = &agent
+	m.messages[agent.ID] = messages
+
+	return &agent
+}
+
 func (m *AgentManager) GetAgent(id string) *Agent {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -161,19 +320,35 @@ func (m *AgentManager) DeleteAgent(id string) bool {
 	if _, exists := m.agents[id]; exists {
 		delete(m.agents, id)
 		delete(m.messages, id)
+		for ch := range m.subscribers[id] {
+			close(ch)
+		}
+		delete(m.subscribers, id)
+		delete(m.inbox, id)
+		delete(m.checkpoints, id)
+		delete(m.steps, id)
+		m.openPauseGate(id)
 		return true
 	}
 	return false
 }
 
+// PauseAgent pauses a running agent. Its loop blocks at the next checkpoint in
+// WaitIfPaused until the agent is resumed.
 func (m *AgentManager) PauseAgent(id string) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if agent, exists := m.agents[id]; exists {
 		if agent.Status == AgentStatusRunning {
+			now := time.Now()
 			agent.Status = AgentStatusPaused
-			agent.UpdatedAt = time.Now()
+			agent.PausedAt = &now
+			agent.UpdatedAt = now
+			agent.refreshElapsed(now)
+			if _, gated := m.pauseGates[id]; !gated {
+				m.pauseGates[id] = make(chan struct{})
+			}
 			return true
 		}
 	}
@@ -185,22 +360,158 @@ func (m *AgentManager) ResumeAgent(id string) bool {
 	defer m.mu.Unlock()
 
 	if agent, exists := m.agents[id]; exists {
-		if agent.Status == AgentStatusPaused {
+		if agent.Status == AgentStatusPaused || agent.Status == AgentStatusThrottled {
+			now := time.Now()
+			if agent.PausedAt != nil {
+				agent.PausedSeconds += now.Sub(*agent.PausedAt).Seconds()
+				agent.PausedAt = nil
+			}
+			agent.ThrottleReasons = nil
+			agent.Status = AgentStatusRunning
+			agent.UpdatedAt = now
+			agent.refreshElapsed(now)
+			agent.revive(now)
+			m.openPauseGate(id)
+			return true
+		}
+	}
+	return false
+}
+
+// StopAgent halts a running, paused or throttled agent. Its loop exits at the next
+// checkpoint in WaitIfPaused.
+func (m *AgentManager) StopAgent(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agent, exists := m.agents[id]; exists {
+		if agent.Active() {
+			now := time.Now()
+			if agent.PausedAt != nil {
+				agent.PausedSeconds += now.Sub(*agent.PausedAt).Seconds()
+				agent.PausedAt = nil
+			}
+			agent.ThrottleReasons = nil
+			agent.Status = AgentStatusStopped
+			agent.UpdatedAt = now
+			agent.refreshElapsed(now)
+			m.openPauseGate(id)
+			return true
+		}
+	}
+	return false
+}
+
+// openPauseGate must be called with m.mu held.
+func (m *AgentManager) openPauseGate(id string) {
+	if gate, exists := m.pauseGates[id]; exists {
+		close(gate)
+		delete(m.pauseGates, id)
+	}
+}
+
+// WaitIfPaused blocks while the agent is paused and returns how long it
+// waited. It reports false when the agent was stopped or deleted, in which
+// case the caller should stop working on it.
+func (m *AgentManager) WaitIfPaused(id string) (time.Duration, bool) {
+	var waited time.Duration
+	for {
+		m.mu.RLock()
+		agent, exists := m.agents[id]
+		stopped := exists && agent.Status == AgentStatusStopped
+		gate := m.pauseGates[id]
+		m.mu.RUnlock()
+
+		if !exists || stopped {
+			return waited, false
+		}
+		if gate == nil {
+			return waited, true
+		}
+		start := time.Now()
+		<-gate
+		waited += time.Since(start)
+	}
+}
+
+// ReactivateAgent marks an agent that is not running, paused or throttled as
+// running and reports whether it did, so only one caller restarts a finished
+// agent.
+func (m *AgentManager) ReactivateAgent(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agent, exists := m.agents[id]; exists {
+		if agent.Status != AgentStatusRunning && agent.Status != AgentStatusPaused && agent.Status != AgentStatusThrottled {
 			agent.Status = AgentStatusRunning
 			agent.UpdatedAt = time.Now()
+			agent.revive(agent.UpdatedAt)
 			return true
 		}
 	}
 	return false
 }
 
+// SetAgentWorkspace places a standalone agent in a workspace.
+func (m *AgentManager) SetAgentWorkspace(id, workspaceID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agent, exists := m.agents[id]; exists {
+		agent.WorkspaceID = workspaceID
+		return true
+	}
+	return false
+}
+
+func (m *AgentManager) AssignOperation(id, operationID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agent, exists := m.agents[id]; exists {
+		agent.OperationID = operationID
+		return true
+	}
+	return false
+}
+
+// GetOperationAgents returns the agents launched by an operation.
+func (m *AgentManager) GetOperationAgents(operationID string) []*Agent {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	agents := make([]*Agent, 0)
+	for _, agent := range m.agents {
+		if agent.OperationID == operationID {
+			agents = append(agents, agent)
+		}
+	}
+	return agents
+}
+
 func (m *AgentManager) UpdateAgentStatus(id string, status AgentStatus) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if agent, exists := m.agents[id]; exists {
+		now := time.Now()
+		if status != AgentStatusPaused && agent.PausedAt != nil {
+			agent.PausedSeconds += now.Sub(*agent.PausedAt).Seconds()
+			agent.PausedAt = nil
+			m.openPauseGate(id)
+		}
+		if status != AgentStatusThrottled {
+			agent.ThrottleReasons = nil
+		}
+		if status != AgentStatusError {
+			agent.ErrorClass = ""
+		}
 		agent.Status = status
-		agent.UpdatedAt = time.Now()
+		agent.UpdatedAt = now
+		agent.refreshElapsed(now)
+		if status == AgentStatusRunning {
+			agent.revive(now)
+		}
 		return true
 	}
 	return false
@@ -226,6 +537,7 @@ func (m *AgentManager) UpdateAgentProgress(id string, progress int, currentTask
 		agent.Progress = progress
 		agent.CurrentTask = currentTask
 		agent.UpdatedAt = time.Now()
+		agent.refreshElapsed(agent.UpdatedAt)
 		return true
 	}
 	return false
@@ -243,6 +555,80 @@ func (m *AgentManager) IncrementTaskCount(id string) bool {
 	return false
 }
 
+func (m *AgentManager) RecordLLMCall(id string, latency time.Duration, bytesSent, bytesReceived int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agent, exists := m.agents[id]; exists {
+		agent.Usage.LLMCalls++
+		agent.Usage.LastLLMLatencyMs = latency.Milliseconds()
+		agent.Usage.LLMLatencyMs += latency.Milliseconds()
+		agent.Usage.BytesSent += bytesSent
+		agent.Usage.BytesReceived += bytesReceived
+		return true
+	}
+	return false
+}
+
+// RecordContext records the size of the conversation the agent last sent to
+// its model, given in size, and the older messages that were summarized or
+// dropped to fit it.
+func (m *AgentManager) RecordContext(id string, size AgentContext, summarized, dropped int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[id]
+	if !exists {
+		return false
+	}
+	context := &agent.Context
+	context.Limit = size.Limit
+	context.Threshold = size.Threshold
+	context.Tokens = size.Tokens
+	context.PinnedTokens = size.PinnedTokens
+	context.Messages = size.Messages
+	context.UsedPercent = 0
+	if size.Limit > 0 {
+		context.UsedPercent = math.Round(float64(size.Tokens)*1000/float64(size.Limit)) / 10
+	}
+	if summarized > 0 {
+		context.Summarizations++
+		context.SummarizedMessages += summarized
+	}
+	context.DroppedMessages += dropped
+	if summarized > 0 || dropped > 0 {
+		now := time.Now()
+		context.LastCompactedAt = &now
+	}
+	return true
+}
+
+// RecordLLMUsage adds the tokens and cost the provider reported for a call.
+func (m *AgentManager) RecordLLMUsage(id string, promptTokens, completionTokens int, cost float64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agent, exists := m.agents[id]; exists {
+		agent.Usage.PromptTokens += promptTokens
+		agent.Usage.CompletionTokens += completionTokens
+		agent.Usage.CostUSD += cost
+		return true
+	}
+	return false
+}
+
+func (m *AgentManager) RecordToolRun(id string, cpuSeconds float64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agent, exists := m.agents[id]; exists {
+		agent.Usage.ToolRuns++
+		agent.Usage.ToolCPUSeconds += cpuSeconds
+		return true
+	}
+	return false
+}
+
 func (m *AgentManager) IncrementFindings(id string) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -268,6 +654,7 @@ func (m *AgentManager) AddMessage(agentID string, role, content string) {
 			Timestamp: time.Now(),
 		}
 		m.messages[agentID] = append(m.messages[agentID], msg)
+		m.publish(msg)
 	}
 }
 
@@ -285,11 +672,173 @@ func (m *AgentManager) AddMessageWithTool(agentID string, role, content, toolUse
 			ToolUsed:  toolUsed,
 		}
 		m.messages[agentID] = append(m.messages[agentID], msg)
+		m.publish(msg)
 	}
 }
 
+// AddMessageWithSampling records a model response with the sampling
+// parameters it was produced with.
+func (m *AgentManager) AddMessageWithSampling(agentID string, role, content string, sampling provider.Sampling) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.messages[agentID]; exists {
+		msg := AgentMessage{
+			ID:        uuid.New().String(),
+			AgentID:   agentID,
+			Role:      role,
+			Content:   content,
+			Timestamp: time.Now(),
+		}
+		if !sampling.IsZero() {
+			msg.Sampling = &sampling
+		}
+		m.messages[agentID] = append(m.messages[agentID], msg)
+		m.publish(msg)
+	}
+}
+
+// QueueOperatorMessage holds an operator message for the agent's running loop
+// to pick up before its next model turn.
+func (m *AgentManager) QueueOperatorMessage(agentID, content string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.agents[agentID]; !exists {
+		return false
+	}
+	m.inbox[agentID] = append(m.inbox[agentID], content)
+	return true
+}
+
+// PendingOperatorMessages returns how many operator messages are queued.
+func (m *AgentManager) PendingOperatorMessages(agentID string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.inbox[agentID])
+}
+
+// TakeOperatorMessages returns and clears the agent's queued operator messages.
+func (m *AgentManager) TakeOperatorMessages(agentID string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queued := m.inbox[agentID]
+	delete(m.inbox, agentID)
+	return queued
+}
+
 func (m *AgentManager) GetMessages(agentID string) []AgentMessage {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	return m.messages[agentID]
 }
+
+// GetMessagesAfter returns up to limit messages that follow the message with
+// ID afterID (or the start of the history when afterID is empty), and whether
+// more messages remain after the returned page.
+func (m *AgentManager) GetMessagesAfter(agentID, afterID string, limit int) ([]AgentMessage, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	history := m.messages[agentID]
+	start := 0
+	if afterID != "" {
+		for i, msg := range history {
+			if msg.ID == afterID {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	end := len(history)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	page := make([]AgentMessage, end-start)
+	copy(page, history[start:end])
+	return page, end < len(history)
+}
+
+// DeleteMessage removes a message from an agent's history. The histories of
+// running, paused and throttled agents are left alone, as their loops still
+// send them to the model. It reports whether the message was removed.
+func (m *AgentManager) DeleteMessage(agentID, messageID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agent, exists := m.agents[agentID]; exists && agent.Active() {
+		return false
+	}
+	history := m.messages[agentID]
+	for i, msg := range history {
+		if msg.ID == messageID {
+			m.messages[agentID] = append(history[:i:i], history[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *AgentManager) MessageCount(agentID string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.messages[agentID])
+}
+
+// Subscribe returns a channel that receives every message added to the agent
+// from now on, and a function that cancels the subscription. The channel is
+// closed when the agent is deleted or the subscription is cancelled.
+func (m *AgentManager) Subscribe(agentID string) (<-chan AgentMessage, func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ch := make(chan AgentMessage, 64)
+	if m.subscribers[agentID] == nil {
+		m.subscribers[agentID] = make(map[chan AgentMessage]struct{})
+	}
+	m.subscribers[agentID][ch] = struct{}{}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if subs, ok := m.subscribers[agentID]; ok {
+				if _, ok := subs[ch]; ok {
+					delete(subs, ch)
+					close(ch)
+				}
+			}
+		})
+	}
+	return ch, cancel
+}
+
+// PublishDelta sends a partial model response to the agent's subscribers
+// without adding it to the history; the full response is added once complete.
+func (m *AgentManager) PublishDelta(agentID, content string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.publish(AgentMessage{
+		ID:        uuid.New().String(),
+		AgentID:   agentID,
+		Role:      "assistant_delta",
+		Content:   content,
+		Timestamp: time.Now(),
+	})
+}
+
+// publish must be called with m.mu held. Slow subscribers drop messages rather
+// than blocking the agent loop.
+func (m *AgentManager) publish(msg AgentMessage) {
+	for ch := range m.subscribers[msg.AgentID] {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
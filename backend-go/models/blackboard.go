@@ -0,0 +1,101 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of structured results agents share on an operation's blackboard.
+const (
+	ResultOpenPort      = "open_port"
+	ResultEndpoint      = "endpoint"
+	ResultCredential    = "credential"
+	ResultService       = "service"
+	ResultVulnerability = "vulnerability"
+	ResultTechnology    = "technology"
+)
+
+// BlackboardEntry is a structured result published by one agent of an
+// operation so that its peers can build on it.
+type BlackboardEntry struct {
+	ID          string    `json:"id"`
+	OperationID string    `json:"operation_id"`
+	AgentID     string    `json:"agent_id"`
+	AgentName   string    `json:"agent_name"`
+	AgentRole   string    `json:"agent_role"`
+	Kind        string    `json:"kind"`
+	Value       string    `json:"value"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// PublishResult adds a result to the blackboard of the agent's operation and
+// returns the new entry, or nil if the agent has no operation or the same
+// result is already on the blackboard.
+func (m *AgentManager) PublishResult(agentID, kind, value string) *BlackboardEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[agentID]
+	value = strings.TrimSpace(value)
+	if !exists || agent.OperationID == "" || value == "" {
+		return nil
+	}
+
+	board := m.blackboards[agent.OperationID]
+	for _, entry := range board {
+		if entry.Kind == kind && strings.EqualFold(entry.Value, value) {
+			return nil
+		}
+	}
+
+	entry := BlackboardEntry{
+		ID:          uuid.New().String(),
+		OperationID: agent.OperationID,
+		AgentID:     agent.ID,
+		AgentName:   agent.Name,
+		AgentRole:   agent.Role,
+		Kind:        kind,
+		Value:       value,
+		Timestamp:   time.Now(),
+	}
+	m.blackboards[agent.OperationID] = append(board, entry)
+	return &entry
+}
+
+// GetBlackboard returns every result shared within an operation, oldest first.
+func (m *AgentManager) GetBlackboard(operationID string) []BlackboardEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	board := m.blackboards[operationID]
+	entries := make([]BlackboardEntry, len(board))
+	copy(entries, board)
+	return entries
+}
+
+// PeerResults returns the results other agents of the agent's operation have
+// published since the cursor, and the cursor to pass on the next call.
+func (m *AgentManager) PeerResults(agentID string, cursor int) ([]BlackboardEntry, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	agent, exists := m.agents[agentID]
+	if !exists || agent.OperationID == "" {
+		return nil, cursor
+	}
+
+	board := m.blackboards[agent.OperationID]
+	if cursor > len(board) {
+		cursor = len(board)
+	}
+
+	peers := make([]BlackboardEntry, 0)
+	for _, entry := range board[cursor:] {
+		if entry.AgentID != agentID {
+			peers = append(peers, entry)
+		}
+	}
+	return peers, len(board)
+}
@@ -0,0 +1,67 @@
+package models
+
+import "fmt"
+
+// Budget states of an operation, from its agents' model spend.
+const (
+	BudgetStateOK        = "ok"
+	BudgetStateWarning   = "warning"
+	BudgetStateExhausted = "exhausted"
+
+	// BudgetWarningFraction is the share of a budget at which the
+	// operation's agents are paused.
+	BudgetWarningFraction = 0.8
+)
+
+// Budget caps what an operation may spend on model calls, in tokens, in USD
+// or both. A zero limit is not enforced.
+type Budget struct {
+	MaxTokens  int64   `json:"max_tokens,omitempty"`
+	MaxCostUSD float64 `json:"max_cost_usd,omitempty"`
+}
+
+func (b *Budget) Validate() error {
+	if b.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative, got %d", b.MaxTokens)
+	}
+	if b.MaxCostUSD < 0 {
+		return fmt.Errorf("max_cost_usd must not be negative, got %g", b.MaxCostUSD)
+	}
+	return nil
+}
+
+// Enabled reports whether the budget limits anything.
+func (b *Budget) Enabled() bool {
+	return b != nil && (b.MaxTokens > 0 || b.MaxCostUSD > 0)
+}
+
+// Used returns the share of the budget spent: the larger of the token and
+// cost shares.
+func (b *Budget) Used(tokens int64, costUSD float64) float64 {
+	if !b.Enabled() {
+		return 0
+	}
+	used := 0.0
+	if b.MaxTokens > 0 {
+		used = float64(tokens) / float64(b.MaxTokens)
+	}
+	if b.MaxCostUSD > 0 {
+		if share := costUSD / b.MaxCostUSD; share > used {
+			used = share
+		}
+	}
+	return used
+}
+
+// State returns the budget state for what was spent.
+func (b *Budget) State(tokens int64, costUSD float64) string {
+	switch used := b.Used(tokens, costUSD); {
+	case !b.Enabled():
+		return ""
+	case used >= 1:
+		return BudgetStateExhausted
+	case used >= BudgetWarningFraction:
+		return BudgetStateWarning
+	}
+	return BudgetStateOK
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// CheckpointMessage is one message of the conversation an agent sends its
+// model.
+type CheckpointMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// AgentCheckpoint is the state of an agent's run after its latest completed
+// loop iteration, enough to continue the run from there instead of from the
+// start.
+type AgentCheckpoint struct {
+	AgentID     string `json:"agent_id"`
+	OperationID string `json:"operation_id,omitempty"`
+	// Iteration counts the model turns completed in the run.
+	Iteration int `json:"iteration"`
+	// Phase is the index of the strategy phase in progress, or -1 for an
+	// agent without a plan.
+	Phase       int                 `json:"phase"`
+	PhaseName   string              `json:"phase_name,omitempty"`
+	Progress    int                 `json:"progress"`
+	CurrentTask string              `json:"current_task,omitempty"`
+	Messages    []CheckpointMessage `json:"messages"`
+	// FindingIDs are the findings the agent had recorded so far.
+	FindingIDs []string  `json:"finding_ids"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SaveCheckpoint replaces the agent's checkpoint.
+func (m *AgentManager) SaveCheckpoint(checkpoint AgentCheckpoint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.agents[checkpoint.AgentID]; exists {
+		m.checkpoints[checkpoint.AgentID] = &checkpoint
+	}
+}
+
+// Checkpoint returns a copy of the agent's latest checkpoint, or nil.
+func (m *AgentManager) Checkpoint(agentID string) *AgentCheckpoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	checkpoint, ok := m.checkpoints[agentID]
+	if !ok {
+		return nil
+	}
+	copied := *checkpoint
+	copied.Messages = append([]CheckpointMessage{}, checkpoint.Messages...)
+	copied.FindingIDs = append([]string{}, checkpoint.FindingIDs...)
+	return &copied
+}
+
+// ClearCheckpoint drops the agent's checkpoint.
+func (m *AgentManager) ClearCheckpoint(agentID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.checkpoints, agentID)
+}
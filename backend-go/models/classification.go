@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+type weaknessPattern struct {
+	Keywords []string
+	CWE      string
+}
+
+// weaknessPatterns is checked in order, so more specific phrases come first.
+var weaknessPatterns = []weaknessPattern{
+	{Keywords: []string{"sql injection", "sqli", "sql_injection"}, CWE: "CWE-89"},
+	{Keywords: []string{"command injection", "os command", "command_injection"}, CWE: "CWE-78"},
+	{Keywords: []string{"remote code execution", "rce", "code injection"}, CWE: "CWE-94"},
+	{Keywords: []string{"cross-site scripting", "xss"}, CWE: "CWE-79"},
+	{Keywords: []string{"cross-site request forgery", "csrf"}, CWE: "CWE-352"},
+	{Keywords: []string{"server-side request forgery", "ssrf"}, CWE: "CWE-918"},
+	{Keywords: []string{"xml external entity", "xxe"}, CWE: "CWE-611"},
+	{Keywords: []string{"deserialization"}, CWE: "CWE-502"},
+	{Keywords: []string{"path traversal", "directory traversal", "path_traversal"}, CWE: "CWE-22"},
+	{Keywords: []string{"file inclusion", "lfi", "rfi"}, CWE: "CWE-98"},
+	{Keywords: []string{"open redirect", "open_redirect"}, CWE: "CWE-601"},
+	{Keywords: []string{"authentication bypass", "auth bypass"}, CWE: "CWE-287"},
+	{Keywords: []string{"privilege escalation"}, CWE: "CWE-269"},
+	{Keywords: []string{"idor", "insecure direct object", "broken access control"}, CWE: "CWE-639"},
+	{Keywords: []string{"default credential", "weak password", "default password"}, CWE: "CWE-521"},
+	{Keywords: []string{"hardcoded credential", "hard-coded credential"}, CWE: "CWE-798"},
+	{Keywords: []string{"clickjacking"}, CWE: "CWE-1021"},
+	{Keywords: []string{"missing headers", "security header"}, CWE: "CWE-693"},
+	{Keywords: []string{"weak tls", "weak cipher", "ssl", "tls"}, CWE: "CWE-326"},
+	{Keywords: []string{"cleartext", "plaintext transmission"}, CWE: "CWE-319"},
+	{Keywords: []string{"outdated", "vulnerable version", "end of life", "eol"}, CWE: "CWE-1104"},
+	{Keywords: []string{"version disclosure", "verbose error", "information disclosure", "stack trace"}, CWE: "CWE-200"},
+	{Keywords: []string{"misconfiguration", "directory listing"}, CWE: "CWE-16"},
+}
+
+// owaspByCWE maps common CWE IDs onto the OWASP Top 10 (2021) categories.
+var owaspByCWE = map[string]string{
+	"CWE-22":   "A01:2021-Broken Access Control",
+	"CWE-269":  "A01:2021-Broken Access Control",
+	"CWE-352":  "A01:2021-Broken Access Control",
+	"CWE-601":  "A01:2021-Broken Access Control",
+	"CWE-639":  "A01:2021-Broken Access Control",
+	"CWE-200":  "A01:2021-Broken Access Control",
+	"CWE-319":  "A02:2021-Cryptographic Failures",
+	"CWE-326":  "A02:2021-Cryptographic Failures",
+	"CWE-327":  "A02:2021-Cryptographic Failures",
+	"CWE-78":   "A03:2021-Injection",
+	"CWE-79":   "A03:2021-Injection",
+	"CWE-89":   "A03:2021-Injection",
+	"CWE-94":   "A03:2021-Injection",
+	"CWE-98":   "A03:2021-Injection",
+	"CWE-1021": "A04:2021-Insecure Design",
+	"CWE-16":   "A05:2021-Security Misconfiguration",
+	"CWE-611":  "A05:2021-Security Misconfiguration",
+	"CWE-693":  "A05:2021-Security Misconfiguration",
+	"CWE-1104": "A06:2021-Vulnerable and Outdated Components",
+	"CWE-287":  "A07:2021-Identification and Authentication Failures",
+	"CWE-521":  "A07:2021-Identification and Authentication Failures",
+	"CWE-798":  "A07:2021-Identification and Authentication Failures",
+	"CWE-502":  "A08:2021-Software and Data Integrity Failures",
+	"CWE-778":  "A09:2021-Security Logging and Monitoring Failures",
+	"CWE-918":  "A10:2021-Server-Side Request Forgery",
+}
+
+// InferCWE guesses a CWE ID from free text such as a finding title or a
+// Brain vulnerability type. It returns "" when nothing matches.
+func InferCWE(text string) string {
+	lower := strings.ToLower(text)
+	for _, pattern := range weaknessPatterns {
+		for _, keyword := range pattern.Keywords {
+			if containsWord(lower, keyword) {
+				return pattern.CWE
+			}
+		}
+	}
+	return ""
+}
+
+// OWASPForCWE returns the OWASP Top 10 category for a CWE ID, or "".
+func OWASPForCWE(cwe string) string {
+	return owaspByCWE[NormalizeCWE(cwe)]
+}
+
+// NormalizeCWE accepts "79", "cwe-79" or "CWE-79" and returns "CWE-79".
+func NormalizeCWE(cwe string) string {
+	cwe = strings.ToUpper(strings.TrimSpace(cwe))
+	if cwe == "" {
+		return ""
+	}
+	if !strings.HasPrefix(cwe, "CWE-") {
+		cwe = "CWE-" + cwe
+	}
+	return cwe
+}
+
+func ValidateCWE(cwe string) error {
+	id := strings.TrimPrefix(NormalizeCWE(cwe), "CWE-")
+	if id == "" {
+		return fmt.Errorf("empty CWE ID")
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("invalid CWE ID %q", cwe)
+		}
+	}
+	return nil
+}
+
+// containsWord reports whether keyword occurs in text on word boundaries, so
+// that short tokens like "rce" do not match inside "source".
+func containsWord(text, keyword string) bool {
+	for start := 0; ; {
+		idx := strings.Index(text[start:], keyword)
+		if idx < 0 {
+			return false
+		}
+		idx += start
+		end := idx + len(keyword)
+		beforeOK := idx == 0 || !isWordChar(text[idx-1])
+		afterOK := end == len(text) || !isWordChar(text[end])
+		if beforeOK && afterOK {
+			return true
+		}
+		start = idx + 1
+	}
+}
+
+func isWordChar(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9'
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"performa-backend/failures"
+)
+
+// maxFailuresPerAgent bounds the failures kept for each agent.
+const maxFailuresPerAgent = 20
+
+// RecordFailure adds a classified error to the agent's failures. A failure
+// its policy gave up on, other than a command's, also sets the class the
+// agent failed with.
+func (m *AgentManager) RecordFailure(id string, failure failures.Failure) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[id]
+	if !exists {
+		return false
+	}
+	if failure.At.IsZero() {
+		failure.At = time.Now()
+	}
+	agent.Failures = append(agent.Failures, failure)
+	if len(agent.Failures) > maxFailuresPerAgent {
+		agent.Failures = append([]failures.Failure(nil), agent.Failures[len(agent.Failures)-maxFailuresPerAgent:]...)
+	}
+	if failure.Action == failures.ActionFail && failure.Command == "" {
+		agent.ErrorClass = failure.Class
+	}
+	agent.UpdatedAt = failure.At
+	return true
+}
+
+// GetFailures returns a copy of the agent's failures, oldest first.
+func (m *AgentManager) GetFailures(id string) []failures.Failure {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	agent, exists := m.agents[id]
+	if !exists {
+		return nil
+	}
+	return append(make([]failures.Failure, 0, len(agent.Failures)), agent.Failures...)
+}
+
+// SetAgentModel switches the model the agent calls, as a fallback policy
+// does.
+func (m *AgentManager) SetAgentModel(id, model string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agent, exists := m.agents[id]; exists {
+		agent.Model = model
+		agent.UpdatedAt = time.Now()
+		return true
+	}
+	return false
+}
@@ -1,12 +1,23 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"performa-backend/cvss"
+	"performa-backend/database"
+	"performa-backend/storage"
+	"performa-backend/workspaces"
+
 	"github.com/google/uuid"
 )
 
@@ -20,6 +31,10 @@ const (
 	SeverityInfo     Severity = "info"
 )
 
+// FindingStatusSuppressed is the status of a finding that matched an accepted
+// risk when it was reported.
+const FindingStatusSuppressed = "suppressed"
+
 type Finding struct {
 	ID          string    `json:"id"`
 	Title       string    `json:"title"`
@@ -31,11 +46,206 @@ type Finding struct {
 	AgentID     string    `json:"agent_id"`
 	CreatedAt   time.Time `json:"created_at"`
 	Status      string    `json:"status"`
+	CVSSVector  string    `json:"cvss_vector,omitempty"`
+	CVSSScore   *float64  `json:"cvss_score,omitempty"`
+	CWE         string    `json:"cwe_id,omitempty"`
+	OWASP       string    `json:"owasp_category,omitempty"`
+	Confidence  *float64  `json:"confidence,omitempty"`
+	Remediation string    `json:"remediation,omitempty"`
+	WorkspaceID string    `json:"workspace_id"`
+	// Source names the external scanner a finding was ingested from; it is
+	// empty for findings Performa's agents reported.
+	Source string `json:"source,omitempty"`
+	// TriagedAt is when the finding's status first moved on from "new".
+	TriagedAt *time.Time `json:"triaged_at,omitempty"`
+	// Tags and Assignee are set by hand or by the finding rules.
+	Tags     []string `json:"tags,omitempty"`
+	Assignee string   `json:"assignee,omitempty"`
+	// Fingerprint identifies the finding across runs; see FindingFingerprint.
+	Fingerprint string `json:"fingerprint"`
+	// SuppressionID is the accepted risk that suppressed the finding.
+	SuppressionID string `json:"suppression_id,omitempty"`
+
+	Classification     *FindingClassification `json:"classification,omitempty"`
+	RemediationDetails *FindingRemediation    `json:"remediation_details,omitempty"`
+	CVEEnrichment      *FindingCVEEnrichment  `json:"cve_enrichment,omitempty"`
+	Issues             []FindingIssue         `json:"issues,omitempty"`
+	Retests            []FindingRetest        `json:"retests,omitempty"`
+}
+
+// FindingIssue links a finding to an issue filed for it in an external
+// tracker.
+type FindingIssue struct {
+	IntegrationID string    `json:"integration_id"`
+	Type          string    `json:"type"`
+	Key           string    `json:"key"`
+	URL           string    `json:"url"`
+	Status        string    `json:"status"`
+	Closed        bool      `json:"closed"`
+	CreatedAt     time.Time `json:"created_at"`
+	SyncedAt      time.Time `json:"synced_at"`
+}
+
+// Retest outcomes. A retest that can neither confirm nor rule out the
+// finding leaves its status alone.
+const (
+	RetestRunning      = "running"
+	RetestResolved     = "resolved"
+	RetestReopened     = "reopened"
+	RetestInconclusive = "inconclusive"
+)
+
+// FindingRetest records re-running the check that reported a finding to
+// verify its remediation.
+type FindingRetest struct {
+	ID             string     `json:"id"`
+	AgentID        string     `json:"agent_id"`
+	Command        string     `json:"command"`
+	Status         string     `json:"status"`
+	PreviousStatus string     `json:"previous_status"`
+	Output         string     `json:"output,omitempty"`
+	ArtifactKey    string     `json:"artifact_key,omitempty"`
+	Indicators     int        `json:"indicators"`
+	Matched        []string   `json:"matched,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	RequestedBy    string     `json:"requested_by,omitempty"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+// FindingRemediation records remediation advice generated for a finding.
+// Finding.Remediation holds the same advice rendered as text.
+type FindingRemediation struct {
+	Summary     string    `json:"summary"`
+	Steps       []string  `json:"steps"`
+	References  []string  `json:"references"`
+	Model       string    `json:"model"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// FindingCVEEnrichment records what NVD, OSV and CISA's catalog of known
+// exploited vulnerabilities say about the CVEs a finding references, and
+// which of the finding's fields were recalculated from it.
+type FindingCVEEnrichment struct {
+	CVEs []FindingCVE `json:"cves"`
+	// Severity is the severity the CVEs call for, and PreviousSeverity the
+	// finding's before it was applied.
+	Severity         Severity          `json:"severity,omitempty"`
+	PreviousSeverity Severity          `json:"previous_severity,omitempty"`
+	Applied          []string          `json:"applied"`
+	Errors           map[string]string `json:"errors,omitempty"`
+	EnrichedAt       time.Time         `json:"enriched_at"`
+}
+
+// FindingCVE is one CVE of a finding's enrichment. Affected lists products
+// with their vulnerable versions, such as "apache:log4j >= 2.0.1, < 2.15.0".
+type FindingCVE struct {
+	ID              string   `json:"id"`
+	Description     string   `json:"description,omitempty"`
+	CVSSVector      string   `json:"cvss_vector,omitempty"`
+	CVSSScore       *float64 `json:"cvss_score,omitempty"`
+	Severity        Severity `json:"severity,omitempty"`
+	CWEs            []string `json:"cwes,omitempty"`
+	Affected        []string `json:"affected,omitempty"`
+	References      []string `json:"references,omitempty"`
+	KnownExploited  bool     `json:"known_exploited"`
+	KEVDateAdded    string   `json:"kev_date_added,omitempty"`
+	KEVDueDate      string   `json:"kev_due_date,omitempty"`
+	KnownRansomware bool     `json:"known_ransomware,omitempty"`
+	Sources         []string `json:"sources"`
+}
+
+// FindingClassification records the automatic classification applied to a
+// finding, keeping the classifier's raw response for audit.
+type FindingClassification struct {
+	Source     string          `json:"source"`
+	Model      string          `json:"model,omitempty"`
+	Severity   string          `json:"severity"`
+	Type       string          `json:"vulnerability_type,omitempty"`
+	Confidence float64         `json:"confidence"`
+	Applied    []string        `json:"applied"`
+	Raw        json.RawMessage `json:"raw,omitempty"`
+	// Stale marks a classification cached from an earlier response because
+	// the Brain was unavailable.
+	Stale        bool      `json:"stale,omitempty"`
+	ClassifiedAt time.Time `json:"classified_at"`
+}
+
+// SeverityRank orders severities from most to least severe; unknown values sort last.
+var SeverityRank = map[Severity]int{
+	SeverityCritical: 5,
+	SeverityHigh:     4,
+	SeverityMedium:   3,
+	SeverityLow:      2,
+	SeverityInfo:     1,
+}
+
+type FindingFilter struct {
+	WorkspaceID string
+	Severities  []Severity
+	Category    string
+	Target      string
+	AgentID     string
+	Status      string
+	Search      string
+	Since       *time.Time
+	Until       *time.Time
+	SortBy      string
+	SortDesc    bool
+	Limit       int
+	Offset      int
+}
+
+func (q FindingFilter) Matches(f *Finding) bool {
+	if q.WorkspaceID != "" && f.WorkspaceID != q.WorkspaceID {
+		return false
+	}
+	if len(q.Severities) > 0 {
+		matched := false
+		for _, s := range q.Severities {
+			if f.Severity == s {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if q.Category != "" && !strings.EqualFold(f.Category, q.Category) {
+		return false
+	}
+	if q.Target != "" && !strings.Contains(strings.ToLower(f.Target), strings.ToLower(q.Target)) {
+		return false
+	}
+	if q.AgentID != "" && f.AgentID != q.AgentID {
+		return false
+	}
+	if q.Status != "" && f.Status != q.Status {
+		return false
+	}
+	if q.Search != "" {
+		needle := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(f.Title), needle) &&
+			!strings.Contains(strings.ToLower(f.Description), needle) {
+			return false
+		}
+	}
+	if q.Since != nil && f.CreatedAt.Before(*q.Since) {
+		return false
+	}
+	if q.Until != nil && f.CreatedAt.After(*q.Until) {
+		return false
+	}
+	return true
 }
 
 type FindingsManager struct {
 	findings    map[string]*Finding
 	findingsDir string
+	store       storage.Backend
+	observer    func(before, after *Finding)
+	processor   func(before, finding *Finding)
 	mu          sync.RWMutex
 }
 
@@ -49,12 +259,48 @@ func (f *FindingsManager) SetFindingsDir(dir string) {
 	os.MkdirAll(dir, 0755)
 }
 
-func (f *FindingsManager) AddFinding(title, description string, severity Severity, category, target, evidence, agentID string) *Finding {
+// SetStorage routes finding persistence through backend instead of writing
+// JSON files directly into the findings directory.
+func (f *FindingsManager) SetStorage(backend storage.Backend) {
+	f.store = backend
+}
+
+// SetObserver registers fn to be called under lock with the previous and new
+// version of every finding stored, before being nil for new findings. The
+// findings already stored are replayed to fn as new.
+func (f *FindingsManager) SetObserver(fn func(before, after *Finding)) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	finding := &Finding{
-		ID:          uuid.New().String(),
+	f.observer = fn
+	for _, finding := range f.findings {
+		fn(nil, finding)
+	}
+}
+
+// SetProcessor registers fn to be called under lock on every finding about to
+// be stored, with its previous version or nil for a new finding. fn may
+// change the finding before it is stored.
+func (f *FindingsManager) SetProcessor(fn func(before, finding *Finding)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.processor = fn
+}
+
+func (f *FindingsManager) process(before, finding *Finding) {
+	if f.processor != nil {
+		f.processor(before, finding)
+	}
+}
+
+func (f *FindingsManager) notify(before, after *Finding) {
+	if f.observer != nil {
+		f.observer(before, after)
+	}
+}
+
+func (f *FindingsManager) AddFinding(title, description string, severity Severity, category, target, evidence, agentID string) *Finding {
+	return f.InsertFinding(Finding{
 		Title:       title,
 		Description: description,
 		Severity:    severity,
@@ -62,14 +308,62 @@ func (f *FindingsManager) AddFinding(title, description string, severity Severit
 		Target:      target,
 		Evidence:    evidence,
 		AgentID:     agentID,
-		CreatedAt:   time.Now(),
-		Status:      "new",
+	})
+}
+
+// InsertFinding stores a fully populated finding. ID, timestamp and status are
+// filled in when empty, the CVSS score is computed from the vector, severity
+// follows the CVSS score when one is present, and CWE/OWASP tags are inferred
+// from the title and description when the caller left them blank.
+func (f *FindingsManager) InsertFinding(finding Finding) *Finding {
+	if finding.ID == "" {
+		finding.ID = uuid.New().String()
+	}
+	if finding.CreatedAt.IsZero() {
+		finding.CreatedAt = time.Now()
 	}
+	if finding.Status == "" {
+		finding.Status = "new"
+	}
+	finding.WorkspaceID = workspaces.Normalize(finding.WorkspaceID)
+	finding.Fingerprint = FindingFingerprint(finding.Title, finding.Target)
+	applyClassification(&finding)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	f.findings[finding.ID] = finding
-	f.saveFinding(finding)
+	previous := f.findings[finding.ID]
+	f.process(previous, &finding)
+	f.findings[finding.ID] = &finding
+	f.saveFinding(&finding)
+	f.notify(previous, &finding)
 
-	return finding
+	return &finding
+}
+
+// FindingFingerprint identifies a finding across runs by its title and
+// target, ignoring case, as its ID differs from run to run.
+func FindingFingerprint(title, target string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(title)) + "\x00" + strings.ToLower(strings.TrimSpace(target))))
+	return hex.EncodeToString(sum[:16])
+}
+
+func applyClassification(finding *Finding) {
+	if finding.CVSSVector != "" {
+		if score, severity, err := cvss.Score(finding.CVSSVector); err == nil {
+			finding.CVSSScore = &score
+			finding.Severity = Severity(severity)
+		}
+	}
+
+	if finding.CWE == "" {
+		finding.CWE = InferCWE(finding.Title + " " + finding.Description)
+	} else {
+		finding.CWE = NormalizeCWE(finding.CWE)
+	}
+	if finding.OWASP == "" && finding.CWE != "" {
+		finding.OWASP = OWASPForCWE(finding.CWE)
+	}
 }
 
 func (f *FindingsManager) GetAllFindings() []*Finding {
@@ -83,35 +377,256 @@ func (f *FindingsManager) GetAllFindings() []*Finding {
 	return findings
 }
 
+// Query returns the page of findings selected by filter along with the total
+// number of matches before pagination was applied.
+func (f *FindingsManager) Query(filter FindingFilter) ([]*Finding, int) {
+	f.mu.RLock()
+	matched := make([]*Finding, 0)
+	for _, finding := range f.findings {
+		if filter.Matches(finding) {
+			matched = append(matched, finding)
+		}
+	}
+	f.mu.RUnlock()
+
+	sortFindings(matched, filter.SortBy, filter.SortDesc)
+
+	total := len(matched)
+	if filter.Offset >= total {
+		return []*Finding{}, total
+	}
+	end := total
+	if filter.Limit > 0 && filter.Offset+filter.Limit < total {
+		end = filter.Offset + filter.Limit
+	}
+	return matched[filter.Offset:end], total
+}
+
+func sortFindings(findings []*Finding, sortBy string, desc bool) {
+	less := func(a, b *Finding) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	switch sortBy {
+	case "severity":
+		less = func(a, b *Finding) bool {
+			if SeverityRank[a.Severity] == SeverityRank[b.Severity] {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+			return SeverityRank[a.Severity] < SeverityRank[b.Severity]
+		}
+	case "title":
+		less = func(a, b *Finding) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if desc {
+			return less(findings[j], findings[i])
+		}
+		return less(findings[i], findings[j])
+	})
+}
+
 func (f *FindingsManager) GetFinding(id string) *Finding {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 	return f.findings[id]
 }
 
+// UpdateFinding applies fn to a copy of the finding under lock, then stores
+// and returns the result. It returns nil when the finding does not exist.
+func (f *FindingsManager) UpdateFinding(id string, fn func(finding *Finding)) *Finding {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.findings[id]
+	if !ok {
+		return nil
+	}
+	updated := *existing
+	fn(&updated)
+	f.process(existing, &updated)
+	if updated.TriagedAt == nil && existing.Status == "new" && updated.Status != "new" {
+		now := time.Now()
+		updated.TriagedAt = &now
+	}
+	f.findings[id] = &updated
+	f.saveFinding(&updated)
+	f.notify(existing, &updated)
+	return &updated
+}
+
+// DeleteFinding removes a finding along with its JSON file or storage object
+// and database row. It reports whether the finding existed.
+func (f *FindingsManager) DeleteFinding(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.findings[id]
+	if !ok {
+		return false
+	}
+	delete(f.findings, id)
+
+	key := path.Join(WorkspaceDir(existing.WorkspaceID), existing.ID+".json")
+	if f.store != nil {
+		if err := f.store.Delete(key); err != nil {
+			log.Printf("Failed to delete stored finding %s: %v", id, err)
+		}
+	} else {
+		os.Remove(filepath.Join(f.findingsDir, filepath.FromSlash(key)))
+	}
+	if database.DB != nil {
+		if err := database.DeleteFinding(id); err != nil {
+			log.Printf("Failed to delete finding %s from database: %v", id, err)
+		}
+	}
+	f.notify(existing, nil)
+	return true
+}
+
+// WorkspacesDir is the subdirectory of the findings directory holding the
+// findings directories of workspaces other than the default one.
+const WorkspacesDir = "workspaces"
+
+// WorkspaceDir returns the directory, relative to the findings directory,
+// holding a workspace's findings. The default workspace keeps them at the top
+// level, where they were written before workspaces existed.
+func WorkspaceDir(workspaceID string) string {
+	if workspaceID == "" || workspaceID == workspaces.DefaultID {
+		return ""
+	}
+	return path.Join(WorkspacesDir, workspaceID)
+}
+
 func (f *FindingsManager) saveFinding(finding *Finding) {
 	data, _ := json.MarshalIndent(finding, "", "  ")
-	filename := filepath.Join(f.findingsDir, finding.ID+".json")
-	os.WriteFile(filename, data, 0644)
+	key := path.Join(WorkspaceDir(finding.WorkspaceID), finding.ID+".json")
+	if f.store != nil {
+		if err := f.store.Put(key, data, "application/json"); err != nil {
+			log.Printf("Failed to store finding %s: %v", finding.ID, err)
+		}
+	} else {
+		filename := filepath.Join(f.findingsDir, filepath.FromSlash(key))
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		os.WriteFile(filename, data, 0644)
+	}
+
+	if database.DB != nil {
+		var classification json.RawMessage
+		if finding.Classification != nil {
+			classification, _ = json.Marshal(finding.Classification)
+		}
+		var issues json.RawMessage
+		if len(finding.Issues) > 0 {
+			issues, _ = json.Marshal(finding.Issues)
+		}
+		var retests json.RawMessage
+		if len(finding.Retests) > 0 {
+			retests, _ = json.Marshal(finding.Retests)
+		}
+		var tags json.RawMessage
+		if len(finding.Tags) > 0 {
+			tags, _ = json.Marshal(finding.Tags)
+		}
+		var remediation json.RawMessage
+		if finding.RemediationDetails != nil {
+			remediation, _ = json.Marshal(finding.RemediationDetails)
+		}
+		var enrichment json.RawMessage
+		if finding.CVEEnrichment != nil {
+			enrichment, _ = json.Marshal(finding.CVEEnrichment)
+		}
+		database.SaveFinding(database.FindingRecord{
+			ID:          finding.ID,
+			AgentID:     finding.AgentID,
+			Title:       finding.Title,
+			Description: finding.Description,
+			Severity:    string(finding.Severity),
+			Category:    finding.Category,
+			Target:      finding.Target,
+			Evidence:    finding.Evidence,
+			Status:      finding.Status,
+			CVSSVector:  finding.CVSSVector,
+			CVSSScore:   finding.CVSSScore,
+			CWE:         finding.CWE,
+			OWASP:       finding.OWASP,
+			Confidence:  finding.Confidence,
+			Remediation: finding.Remediation,
+			WorkspaceID: finding.WorkspaceID,
+			Source:      finding.Source,
+			CreatedAt:   finding.CreatedAt,
+			TriagedAt:   finding.TriagedAt,
+			Assignee:    finding.Assignee,
+			Suppression: finding.SuppressionID,
+
+			Classification:     classification,
+			Issues:             issues,
+			Retests:            retests,
+			Tags:               tags,
+			RemediationDetails: remediation,
+			CVEEnrichment:      enrichment,
+		})
+	}
 }
 
 func (f *FindingsManager) LoadFindings() {
+	if f.store != nil {
+		f.loadFromStorage()
+		return
+	}
+
 	files, err := filepath.Glob(filepath.Join(f.findingsDir, "*.json"))
 	if err != nil {
 		return
 	}
+	workspaceFiles, _ := filepath.Glob(filepath.Join(f.findingsDir, WorkspacesDir, "*", "*.json"))
+	files = append(files, workspaceFiles...)
 
 	for _, file := range files {
 		data, err := os.ReadFile(file)
 		if err != nil {
 			continue
 		}
+		f.loadFinding(data)
+	}
+}
 
-		var finding Finding
-		if err := json.Unmarshal(data, &finding); err == nil {
-			f.mu.Lock()
-			f.findings[finding.ID] = &finding
-			f.mu.Unlock()
+func (f *FindingsManager) loadFromStorage() {
+	objects, err := f.store.List("")
+	if err != nil {
+		log.Printf("Failed to list stored findings: %v", err)
+		return
+	}
+
+	for _, object := range objects {
+		if !isFindingKey(object.Key) {
+			continue
 		}
+		data, err := f.store.Get(object.Key)
+		if err != nil {
+			continue
+		}
+		f.loadFinding(data)
+	}
+}
+
+// isFindingKey reports whether a storage key holds a finding, either at the
+// top level or in a workspace's directory, rather than an attachment.
+func isFindingKey(key string) bool {
+	if !strings.HasSuffix(key, ".json") {
+		return false
+	}
+	parts := strings.Split(key, "/")
+	return len(parts) == 1 || (len(parts) == 3 && parts[0] == WorkspacesDir)
+}
+
+func (f *FindingsManager) loadFinding(data []byte) {
+	var finding Finding
+	if err := json.Unmarshal(data, &finding); err == nil && finding.ID != "" {
+		finding.WorkspaceID = workspaces.Normalize(finding.WorkspaceID)
+		finding.Fingerprint = FindingFingerprint(finding.Title, finding.Target)
+		f.mu.Lock()
+		previous := f.findings[finding.ID]
+		f.findings[finding.ID] = &finding
+		f.notify(previous, &finding)
+		f.mu.Unlock()
 	}
 }
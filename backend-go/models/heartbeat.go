@@ -0,0 +1,93 @@
+package models
+
+import "time"
+
+// revive starts an agent's heartbeat over when it is set running, so the
+// time it spent finished, paused or throttled does not count as silence. It
+// must be called with the manager's lock held.
+func (a *Agent) revive(now time.Time) {
+	a.LastHeartbeat = &now
+	a.StaleSince = nil
+	a.ReapedAt = nil
+}
+
+// Heartbeat records that the agent's loop is alive. recovered reports that
+// the agent had been flagged stale; ok is false once the agent was deleted or
+// reaped, in which case its loop should stop.
+func (m *AgentManager) Heartbeat(id string) (recovered, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[id]
+	if !exists || agent.ReapedAt != nil {
+		return false, false
+	}
+	now := time.Now()
+	agent.LastHeartbeat = &now
+	recovered = agent.StaleSince != nil
+	agent.StaleSince = nil
+	return recovered, true
+}
+
+// SilentAgents returns copies of the running agents whose last heartbeat is
+// older than cutoff. Paused and throttled agents wait on purpose and are left
+// out.
+func (m *AgentManager) SilentAgents(cutoff time.Time) []Agent {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	agents := make([]Agent, 0)
+	for _, agent := range m.agents {
+		if agent.Status == AgentStatusRunning && agent.silentSince(cutoff) {
+			agents = append(agents, *agent)
+		}
+	}
+	return agents
+}
+
+// silentSince reports whether the agent has not reported since cutoff. An
+// agent that never did counts from when it was last updated.
+func (a *Agent) silentSince(cutoff time.Time) bool {
+	last := a.UpdatedAt
+	if a.LastHeartbeat != nil {
+		last = *a.LastHeartbeat
+	}
+	return last.Before(cutoff)
+}
+
+// MarkAgentStale flags a running agent that has been silent since cutoff and
+// reports whether it was not flagged already.
+func (m *AgentManager) MarkAgentStale(id string, cutoff time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[id]
+	if !exists || agent.Status != AgentStatusRunning || agent.StaleSince != nil || !agent.silentSince(cutoff) {
+		return false
+	}
+	now := time.Now()
+	agent.StaleSince = &now
+	return true
+}
+
+// ReapAgent marks a running agent that has been silent since cutoff as
+// failed and reports whether it did. The check and the change are atomic, so
+// an agent that reported in meanwhile is left alone.
+func (m *AgentManager) ReapAgent(id string, cutoff time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[id]
+	if !exists || agent.Status != AgentStatusRunning || !agent.silentSince(cutoff) {
+		return false
+	}
+	now := time.Now()
+	if agent.StaleSince == nil {
+		agent.StaleSince = &now
+	}
+	agent.ReapedAt = &now
+	agent.Status = AgentStatusError
+	agent.UpdatedAt = now
+	agent.refreshElapsed(now)
+	return true
+}
@@ -1,5 +1,13 @@
 package models
 
+import (
+	"performa-backend/failures"
+	"performa-backend/nuclei"
+	"performa-backend/policy"
+	"performa-backend/provider"
+	"performa-backend/scheduler"
+)
+
 type AIModel struct {
 	ID       string `json:"id"`
 	Name     string `json:"name"`
@@ -23,6 +31,16 @@ var AvailableModels = []AIModel{
 	{ID: "deepseek/deepseek-chat", Name: "DeepSeek Chat", Provider: "DeepSeek", Context: 128000, Pricing: "$0.14/$0.28"},
 }
 
+// FindModel returns the available model with the given ID, or nil.
+func FindModel(id string) *AIModel {
+	for i := range AvailableModels {
+		if AvailableModels[i].ID == id {
+			return &AvailableModels[i]
+		}
+	}
+	return nil
+}
+
 type StealthOptions struct {
 	ProxyChain     bool `json:"proxy_chain"`
 	TorRouting     bool `json:"tor_routing"`
@@ -43,26 +61,118 @@ type Capabilities struct {
 	ARPSpoof          bool `json:"arp_spoof"`
 	SessionHijack     bool `json:"session_hijack"`
 	CredentialCapture bool `json:"credential_capture"`
+	Exploitation      bool `json:"exploitation"`
+}
+
+// Enabled returns the names of the enabled capabilities, keyed by their JSON
+// names.
+func (c Capabilities) Enabled() map[string]bool {
+	enabled := make(map[string]bool)
+	for name, on := range map[string]bool{
+		"packet_injection":   c.PacketInjection,
+		"mitm_attacks":       c.MITMAttacks,
+		"websocket_hijack":   c.WebSocketHijack,
+		"ssl_stripping":      c.SSLStripping,
+		"dns_spoof":          c.DNSSpoof,
+		"arp_spoof":          c.ARPSpoof,
+		"session_hijack":     c.SessionHijack,
+		"credential_capture": c.CredentialCapture,
+		"exploitation":       c.Exploitation,
+	} {
+		if on {
+			enabled[name] = true
+		}
+	}
+	return enabled
 }
 
 type StartRequest struct {
-	Target            string         `json:"target"`
+	Target            string         `json:"target" validate:"required_without=Targets"`
 	Category          string         `json:"category"`
 	Model             string         `json:"model"`
-	AgentCount        int            `json:"agent_count"`
+	AgentCount        int            `json:"agent_count" validate:"min=0"`
 	Instructions      string         `json:"instructions"`
 	Mode              string         `json:"mode"`
 	StealthMode       bool           `json:"stealth_mode"`
-	AggressiveLevel   int            `json:"aggressive_level"`
+	AggressiveLevel   int            `json:"aggressive_level" validate:"omitempty,min=1,max=5"`
 	RequestedTools    []string       `json:"requested_tools"`
 	AllowedToolsOnly  bool           `json:"allowed_tools_only"`
 	StealthOptions    StealthOptions `json:"stealth_options"`
 	Capabilities      Capabilities   `json:"capabilities"`
-	ExecutionDuration *int           `json:"execution_duration"`
+	ExecutionDuration *int           `json:"execution_duration" validate:"omitempty,min=1"`
 	OSType            string         `json:"os_type"`
-	BatchSize         int            `json:"batch_size"`
-	RateLimitRps      int            `json:"rate_limit_rps"`
+	BatchSize         int            `json:"batch_size" validate:"min=0"`
+	RateLimitRps      int            `json:"rate_limit_rps" validate:"min=0"`
 	RateLimitEnabled  bool           `json:"rate_limit_enabled"`
+	Proxies           []string       `json:"proxies,omitempty" validate:"omitempty,dive,url"`
+	TorSOCKSAddr      string         `json:"tor_socks_addr,omitempty" validate:"omitempty,hostname_port"`
+	DoHEndpoint       string         `json:"doh_endpoint,omitempty"`
+	Roles             []string       `json:"roles,omitempty"`
+	UseStrategy       bool           `json:"use_strategy"`
+	// Targets lists additional hosts, CIDRs or URLs to run against; Target,
+	// when set, is included too. TargetAllocation is "shard" (default) to
+	// split the targets across AgentCount agents, or "per_target" to launch
+	// AgentCount agents for every target.
+	Targets          []string `json:"targets,omitempty"`
+	TargetAllocation string   `json:"target_allocation,omitempty" validate:"omitempty,oneof=shard per_target"`
+	// Credentials maps a provider to the stored credential this operation
+	// uses; providers not listed use their default key.
+	Credentials map[string]string `json:"credentials,omitempty"`
+	// CommandPolicy holds rules checked before the global command policy
+	// for this operation's commands.
+	CommandPolicy []policy.Rule `json:"command_policy,omitempty"`
+	// RoE binds the operation to rules of engagement, enforced when it is
+	// launched and before each of its agents' commands.
+	RoE *RoE `json:"roe,omitempty"`
+	// Blackout lists the windows in which the operation must not run. Its
+	// agents are paused when one starts and resumed when it ends, and
+	// cannot be resumed by hand in between.
+	Blackout *scheduler.Blackout `json:"blackout,omitempty"`
+	// Nuclei selects the nuclei templates the operation's scans run. It is
+	// pinned to the exact templates when the operation is launched.
+	Nuclei *nuclei.Selection `json:"nuclei,omitempty"`
+	// Wordlists selects the wordlists the operation's commands may name
+	// with {{wordlist:NAME}}; empty allows every stored list.
+	Wordlists []string `json:"wordlists,omitempty"`
+	// OSINTLookup looks the agents' targets up in the configured OSINT
+	// providers before their first turn, giving them what is known.
+	OSINTLookup bool `json:"osint_lookup,omitempty"`
+	// CaptureTraffic sends the HTTP traffic of the operation's web tools
+	// through the capture proxy, recording it as evidence.
+	CaptureTraffic bool `json:"capture_traffic,omitempty"`
+	// Budget caps the tokens and cost of the operation's model calls. Its
+	// agents are paused at 80% of it and stopped once it is spent.
+	Budget *Budget `json:"budget,omitempty"`
+	// FingerprintRotation is the number of requests after which an agent
+	// switches to a new browser fingerprint when user-agent rotation or
+	// header randomization is on: 0 uses FINGERPRINT_ROTATE_EVERY, a
+	// negative value keeps one fingerprint for the whole session.
+	FingerprintRotation int `json:"fingerprint_rotation,omitempty"`
+	// PaddingRatio is the average number of decoy requests sent per real
+	// request when traffic padding is on; 0 uses TRAFFIC_PADDING_RATIO.
+	PaddingRatio float64 `json:"padding_ratio,omitempty" validate:"min=0"`
+	// Limits caps each agent's resource use; limits left at 0 use the
+	// AGENT_MAX_* defaults.
+	Limits AgentLimits `json:"limits,omitempty"`
+	// NativeTools offers the agents their commands as a function the model
+	// calls through the provider's function calling, besides "RUN:" lines.
+	NativeTools bool `json:"native_tools,omitempty"`
+	// StructuredOutput has the agents answer with JSON objects matching a
+	// response schema of their role, asking the provider for structured
+	// output where the model supports it. Responses that still do not
+	// match after retries are rejected. It takes precedence over
+	// NativeTools.
+	StructuredOutput bool `json:"structured_output,omitempty"`
+	// Sampling sets the temperature, top_p, max_tokens and stop sequences
+	// of the agents' model calls. Parameters left unset take the defaults
+	// of each agent's role.
+	Sampling provider.Sampling `json:"sampling,omitempty"`
+	// RetryPolicies overrides, by error class, the global retry policies
+	// applied when the agents' model calls, tool runs or strategy fail.
+	RetryPolicies failures.Policies `json:"retry_policies,omitempty"`
+	// WorkspaceID is the workspace the operation runs in. It is set from the
+	// request's workspace rather than the body.
+	WorkspaceID string `json:"-"`
 }
 
 type ChatMessage struct {
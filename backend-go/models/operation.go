@@ -0,0 +1,307 @@
+package models
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"performa-backend/stealth"
+	"performa-backend/workspaces"
+
+	"github.com/google/uuid"
+)
+
+type OperationStatus string
+
+const (
+	OperationStatusRunning  OperationStatus = "running"
+	OperationStatusComplete OperationStatus = "complete"
+	OperationStatusStopped  OperationStatus = "stopped"
+	OperationStatusError    OperationStatus = "error"
+)
+
+// Operation groups the agents launched by a single start request. Targets is
+// the expanded target list and Assignments maps each agent to the targets it
+// covers.
+type Operation struct {
+	ID          string                      `json:"id"`
+	Target      string                      `json:"target"`
+	Targets     []string                    `json:"targets,omitempty"`
+	Assignments map[string][]string         `json:"assignments,omitempty"`
+	Source      string                      `json:"source"`
+	Status      OperationStatus             `json:"status"`
+	Request     StartRequest                `json:"request"`
+	AgentIDs    []string                    `json:"agent_ids"`
+	Network     *stealth.ConnectivityReport `json:"network,omitempty"`
+	Plan        *OperationPlan              `json:"plan,omitempty"`
+	Warnings    []string                    `json:"warnings,omitempty"`
+	OwnerID     string                      `json:"owner_id,omitempty"`
+	WorkspaceID string                      `json:"workspace_id"`
+	CreatedAt   time.Time                   `json:"created_at"`
+	UpdatedAt   time.Time                   `json:"updated_at"`
+	CompletedAt *time.Time                  `json:"completed_at,omitempty"`
+
+	// RoEViolations lists what the rules of engagement refused, newest last.
+	RoEViolations []RoEViolation `json:"roe_violations,omitempty"`
+
+	// BudgetState is the state of Request.Budget, empty without one.
+	BudgetState string `json:"budget_state,omitempty"`
+
+	// BlackoutUntil is set while a blackout window of Request.Blackout
+	// holds the operation, to when it ends; BlackoutAgents are the agents
+	// it paused, resumed when it ends.
+	BlackoutUntil  *time.Time `json:"blackout_until,omitempty"`
+	BlackoutAgents []string   `json:"blackout_agents,omitempty"`
+}
+
+type OperationManager struct {
+	operations map[string]*Operation
+	mu         sync.RWMutex
+}
+
+var Operations = &OperationManager{
+	operations: make(map[string]*Operation),
+}
+
+func (m *OperationManager) CreateOperation(req StartRequest, source string) *Operation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if source == "" {
+		source = "api"
+	}
+
+	op := &Operation{
+		ID:          uuid.New().String(),
+		Target:      req.Target,
+		Targets:     req.Targets,
+		Source:      source,
+		Status:      OperationStatusRunning,
+		Request:     req,
+		AgentIDs:    []string{},
+		WorkspaceID: workspaces.Normalize(req.WorkspaceID),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if req.Budget.Enabled() {
+		op.BudgetState = BudgetStateOK
+	}
+
+	m.operations[op.ID] = op
+	return op
+}
+
+func (m *OperationManager) GetOperation(id string) *Operation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.operations[id]
+}
+
+// GetAllOperations returns operations newest first.
+func (m *OperationManager) GetAllOperations() []*Operation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ops := make([]*Operation, 0, len(m.operations))
+	for _, op := range m.operations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].CreatedAt.After(ops[j].CreatedAt) })
+	return ops
+}
+
+// SetOwner records the user who started an operation.
+func (m *OperationManager) SetOwner(id, ownerID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, exists := m.operations[id]
+	if !exists {
+		return false
+	}
+	op.OwnerID = ownerID
+	return true
+}
+
+func (m *OperationManager) AddAgent(operationID, agentID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if op, exists := m.operations[operationID]; exists {
+		op.AgentIDs = append(op.AgentIDs, agentID)
+		op.UpdatedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// AssignTargets records which of the operation's targets an agent covers.
+func (m *OperationManager) AssignTargets(operationID, agentID string, targets []string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if op, exists := m.operations[operationID]; exists {
+		if op.Assignments == nil {
+			op.Assignments = make(map[string][]string)
+		}
+		op.Assignments[agentID] = targets
+		op.UpdatedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// AddRoEViolation records something the operation's rules of engagement
+// refused.
+func (m *OperationManager) AddRoEViolation(id string, violation RoEViolation) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if op, exists := m.operations[id]; exists {
+		op.RoEViolations = append(op.RoEViolations, violation)
+		op.UpdatedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// AddWarning records something the operator should know about how the
+// operation was launched, e.g. requested tools that are not installed.
+func (m *OperationManager) AddWarning(id, warning string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if op, exists := m.operations[id]; exists {
+		op.Warnings = append(op.Warnings, warning)
+		op.UpdatedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// GetAssignments returns copies of the operation's agent IDs and their target
+// assignments.
+func (m *OperationManager) GetAssignments(id string) ([]string, map[string][]string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	op, exists := m.operations[id]
+	if !exists {
+		return nil, nil
+	}
+	assignments := make(map[string][]string, len(op.Assignments))
+	for agentID, targets := range op.Assignments {
+		assignments[agentID] = append([]string(nil), targets...)
+	}
+	return append([]string(nil), op.AgentIDs...), assignments
+}
+
+// SetBudget replaces the operation's budget.
+func (m *OperationManager) SetBudget(id string, budget *Budget) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if op, exists := m.operations[id]; exists {
+		op.Request.Budget = budget
+		op.UpdatedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// SetBudgetState records the operation's budget state and returns the
+// previous one.
+func (m *OperationManager) SetBudgetState(id, state string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, exists := m.operations[id]
+	if !exists {
+		return "", false
+	}
+	previous := op.BudgetState
+	if state != previous {
+		op.BudgetState = state
+		op.UpdatedAt = time.Now()
+	}
+	return previous, true
+}
+
+// SetBlackout records that a blackout holds the operation until until, with
+// the agents it paused, or with a nil until that it ended.
+func (m *OperationManager) SetBlackout(id string, until *time.Time, agentIDs []string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, exists := m.operations[id]
+	if !exists {
+		return false
+	}
+	op.BlackoutUntil = until
+	op.BlackoutAgents = agentIDs
+	op.UpdatedAt = time.Now()
+	return true
+}
+
+// SetNetwork records the latest connectivity check for the operation's route.
+func (m *OperationManager) SetNetwork(id string, report stealth.ConnectivityReport) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if op, exists := m.operations[id]; exists {
+		op.Network = &report
+		op.UpdatedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+func (m *OperationManager) UpdateStatus(id string, status OperationStatus) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if op, exists := m.operations[id]; exists {
+		op.Status = status
+		op.UpdatedAt = time.Now()
+		if status != OperationStatusRunning && op.CompletedAt == nil {
+			now := time.Now()
+			op.CompletedAt = &now
+		}
+		return true
+	}
+	return false
+}
+
+// RefreshStatus marks a running operation complete (or error, if every agent
+// failed) once none of its agents are still active.
+func (m *OperationManager) RefreshStatus(id string) {
+	op := m.GetOperation(id)
+	if op == nil || op.Status != OperationStatusRunning {
+		return
+	}
+
+	m.mu.RLock()
+	agentIDs := append([]string(nil), op.AgentIDs...)
+	m.mu.RUnlock()
+
+	failed := 0
+	for _, agentID := range agentIDs {
+		agent := Manager.GetAgent(agentID)
+		if agent == nil {
+			continue
+		}
+		switch agent.Status {
+		case AgentStatusComplete, AgentStatusStopped:
+		case AgentStatusError:
+			failed++
+		default:
+			return
+		}
+	}
+
+	if len(agentIDs) > 0 && failed == len(agentIDs) {
+		m.UpdateStatus(id, OperationStatusError)
+		return
+	}
+	m.UpdateStatus(id, OperationStatusComplete)
+}
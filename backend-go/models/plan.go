@@ -0,0 +1,147 @@
+package models
+
+import "time"
+
+type PhaseStatus string
+
+const (
+	PhaseStatusPending  PhaseStatus = "pending"
+	PhaseStatusRunning  PhaseStatus = "running"
+	PhaseStatusComplete PhaseStatus = "complete"
+	PhaseStatusSkipped  PhaseStatus = "skipped"
+)
+
+// PlanPhase is one phase of a strategy generated by the Brain.
+type PlanPhase struct {
+	Name              string   `json:"name"`
+	Description       string   `json:"description,omitempty"`
+	Tools             []string `json:"tools"`
+	TimingMultiplier  float64  `json:"timing_multiplier"`
+	EstimatedDuration int      `json:"estimated_duration,omitempty"`
+}
+
+// AgentPhase is a strategy phase as it applies to one agent: its tools are
+// narrowed to what the agent may use, and it carries the agent's progress.
+type AgentPhase struct {
+	PlanPhase
+	Status      PhaseStatus `json:"status"`
+	StartedAt   *time.Time  `json:"started_at,omitempty"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+}
+
+type AgentPlan struct {
+	AgentID      string       `json:"agent_id"`
+	Role         string       `json:"role"`
+	Phases       []AgentPhase `json:"phases"`
+	CurrentPhase int          `json:"current_phase"`
+}
+
+// Done reports how many phases are complete or skipped.
+func (p *AgentPlan) Done() int {
+	done := 0
+	for _, phase := range p.Phases {
+		if phase.Status == PhaseStatusComplete || phase.Status == PhaseStatusSkipped {
+			done++
+		}
+	}
+	return done
+}
+
+// OperationPlan is the Brain strategy an operation's agents follow.
+type OperationPlan struct {
+	Strategy          string       `json:"strategy"`
+	Mode              string       `json:"mode"`
+	NoiseLevel        string       `json:"noise_level,omitempty"`
+	TimingMultiplier  float64      `json:"timing_multiplier"`
+	EstimatedDuration int          `json:"estimated_duration,omitempty"`
+	Phases            []PlanPhase  `json:"phases"`
+	Agents            []*AgentPlan `json:"agents"`
+	CreatedAt         time.Time    `json:"created_at"`
+	// Stale marks a plan built from a cached strategy because the Brain was
+	// unavailable.
+	Stale bool `json:"stale,omitempty"`
+}
+
+func (p *AgentPlan) clone() *AgentPlan {
+	clone := *p
+	clone.Phases = append([]AgentPhase(nil), p.Phases...)
+	return &clone
+}
+
+func (m *OperationManager) SetPlan(id string, plan *OperationPlan) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if op, exists := m.operations[id]; exists {
+		op.Plan = plan
+		op.UpdatedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// GetPlan returns a copy of the operation's plan, or nil if it has none.
+func (m *OperationManager) GetPlan(id string) *OperationPlan {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	op, exists := m.operations[id]
+	if !exists || op.Plan == nil {
+		return nil
+	}
+
+	plan := *op.Plan
+	plan.Agents = make([]*AgentPlan, 0, len(op.Plan.Agents))
+	for _, agentPlan := range op.Plan.Agents {
+		plan.Agents = append(plan.Agents, agentPlan.clone())
+	}
+	return &plan
+}
+
+// AgentPlan returns a copy of one agent's part of the operation plan.
+func (m *OperationManager) AgentPlan(operationID, agentID string) *AgentPlan {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if op, exists := m.operations[operationID]; exists && op.Plan != nil {
+		for _, agentPlan := range op.Plan.Agents {
+			if agentPlan.AgentID == agentID {
+				return agentPlan.clone()
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateAgentPhase records a phase status change for an agent and moves its
+// current phase past the phase once it is complete or skipped.
+func (m *OperationManager) UpdateAgentPhase(operationID, agentID string, index int, status PhaseStatus) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, exists := m.operations[operationID]
+	if !exists || op.Plan == nil {
+		return false
+	}
+
+	for _, agentPlan := range op.Plan.Agents {
+		if agentPlan.AgentID != agentID || index < 0 || index >= len(agentPlan.Phases) {
+			continue
+		}
+
+		now := time.Now()
+		phase := &agentPlan.Phases[index]
+		phase.Status = status
+		switch status {
+		case PhaseStatusRunning:
+			phase.StartedAt = &now
+			agentPlan.CurrentPhase = index
+		case PhaseStatusComplete, PhaseStatusSkipped:
+			phase.CompletedAt = &now
+			agentPlan.CurrentPhase = index + 1
+		}
+		op.UpdatedAt = now
+		return true
+	}
+	return false
+}
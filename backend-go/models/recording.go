@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Kinds of recorded entries of an agent's run.
+const (
+	RecordPrompt   = "prompt"
+	RecordResponse = "response"
+	RecordCommand  = "command"
+	RecordOutput   = "output"
+)
+
+// RecordedEntry is one step of an agent's run as it happened, numbered in
+// order by Seq, so that the run can be replayed without calling its model or
+// running its tools. A prompt holds the whole conversation sent to the model
+// and Compacted counts the earlier messages context compaction summarized or
+// dropped just before it; a response holds what the model answered, or the
+// error of the call; a command and its output hold a tool command the model
+// asked for and the report of it fed back to the model.
+type RecordedEntry struct {
+	AgentID     string              `json:"agent_id"`
+	OperationID string              `json:"operation_id,omitempty"`
+	Seq         int                 `json:"seq"`
+	Kind        string              `json:"kind"`
+	Iteration   int                 `json:"iteration"`
+	Model       string              `json:"model,omitempty"`
+	Messages    []CheckpointMessage `json:"messages,omitempty"`
+	Compacted   int                 `json:"compacted,omitempty"`
+	Content     string              `json:"content,omitempty"`
+	Command     string              `json:"command,omitempty"`
+	Status      string              `json:"status,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
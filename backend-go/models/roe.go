@@ -0,0 +1,318 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RoE violation rules.
+const (
+	RoERuleWindow     = "time_window"
+	RoERuleAggressive = "aggressive_level"
+	RoERuleCapability = "forbidden_capability"
+	RoERuleExcluded   = "excluded_host"
+	RoERuleStealth    = "required_stealth"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// RoEWindow is a daily period in which an operation may run. Start and End
+// are "HH:MM"; an End before Start spans midnight. Days limits the window to
+// some weekdays ("mon" to "sun"), any day when empty.
+type RoEWindow struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// RoE holds the rules of engagement an operation is bound to. Every field
+// is optional: no windows allows any time, a zero MaxAggressiveLevel any
+// level. ExcludedHosts takes hostnames, "*.example.com" wildcards, IP
+// addresses and CIDR ranges; ForbiddenCapabilities, PermittedCapabilities
+// and RequiredStealth take the JSON names of Capabilities and StealthOptions
+// fields. Capabilities that are only allowed when explicitly permitted, such
+// as ARP and DNS spoofing, must be listed in PermittedCapabilities.
+type RoE struct {
+	Timezone              string      `json:"timezone,omitempty"`
+	Windows               []RoEWindow `json:"windows,omitempty"`
+	MaxAggressiveLevel    int         `json:"max_aggressive_level,omitempty"`
+	ForbiddenCapabilities []string    `json:"forbidden_capabilities,omitempty"`
+	PermittedCapabilities []string    `json:"permitted_capabilities,omitempty"`
+	ExcludedHosts         []string    `json:"excluded_hosts,omitempty"`
+	RequiredStealth       []string    `json:"required_stealth,omitempty"`
+}
+
+// RoEViolation records something the rules of engagement refused.
+type RoEViolation struct {
+	Rule    string    `json:"rule"`
+	Reason  string    `json:"reason"`
+	AgentID string    `json:"agent_id,omitempty"`
+	Command string    `json:"command,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Validate checks the rules' timezone, windows and names.
+func (r *RoE) Validate() error {
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", r.Timezone)
+	}
+	for i, window := range r.Windows {
+		if _, err := parseClock(window.Start); err != nil {
+			return fmt.Errorf("window %d: %v", i+1, err)
+		}
+		if _, err := parseClock(window.End); err != nil {
+			return fmt.Errorf("window %d: %v", i+1, err)
+		}
+		for _, day := range window.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("window %d: unknown day %q", i+1, day)
+			}
+		}
+	}
+	if r.MaxAggressiveLevel < 0 {
+		return fmt.Errorf("max_aggressive_level must not be negative")
+	}
+
+	knownCaps := (Capabilities{}).names()
+	for _, name := range append(append([]string(nil), r.ForbiddenCapabilities...), r.PermittedCapabilities...) {
+		if !knownCaps[name] {
+			return fmt.Errorf("unknown capability %q", name)
+		}
+	}
+	knownStealth := (StealthOptions{}).names()
+	for _, name := range r.RequiredStealth {
+		if !knownStealth[name] {
+			return fmt.Errorf("unknown stealth option %q", name)
+		}
+	}
+	for _, host := range r.ExcludedHosts {
+		if strings.TrimSpace(host) == "" {
+			return fmt.Errorf("excluded_hosts must not contain empty entries")
+		}
+	}
+	return nil
+}
+
+func (c Capabilities) names() map[string]bool {
+	return (Capabilities{
+		PacketInjection: true, MITMAttacks: true, WebSocketHijack: true, SSLStripping: true, DNSSpoof: true,
+		ARPSpoof: true, SessionHijack: true, CredentialCapture: true, Exploitation: true,
+	}).Enabled()
+}
+
+// Enabled returns the names of the enabled stealth options, keyed by their
+// JSON names.
+func (s StealthOptions) Enabled() map[string]bool {
+	enabled := make(map[string]bool)
+	for name, on := range map[string]bool{
+		"proxy_chain":          s.ProxyChain,
+		"tor_routing":          s.TorRouting,
+		"mac_spoofing":         s.MacSpoofing,
+		"timing_jitter":        s.TimingJitter,
+		"user_agent_rotation":  s.UserAgentRot,
+		"header_randomization": s.HeaderRandom,
+		"dns_over_https":       s.DNSOverHTTPS,
+		"traffic_padding":      s.TrafficPadding,
+	} {
+		if on {
+			enabled[name] = true
+		}
+	}
+	return enabled
+}
+
+func (s StealthOptions) names() map[string]bool {
+	return (StealthOptions{
+		ProxyChain: true, TorRouting: true, MacSpoofing: true, TimingJitter: true,
+		UserAgentRot: true, HeaderRandom: true, DNSOverHTTPS: true, TrafficPadding: true,
+	}).Enabled()
+}
+
+// Permits reports whether the rules explicitly permit a capability: it is
+// listed in PermittedCapabilities and not forbidden.
+func (r *RoE) Permits(capability string) bool {
+	if r == nil {
+		return false
+	}
+	for _, name := range r.ForbiddenCapabilities {
+		if name == capability {
+			return false
+		}
+	}
+	for _, name := range r.PermittedCapabilities {
+		if name == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// InWindow reports whether t falls in one of the windows.
+func (r *RoE) InWindow(t time.Time) bool {
+	if len(r.Windows) == 0 {
+		return true
+	}
+	if loc, err := time.LoadLocation(r.Timezone); err == nil {
+		t = t.In(loc)
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, window := range r.Windows {
+		start, err1 := parseClock(window.Start)
+		end, err2 := parseClock(window.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		day := t.Weekday()
+		// The part of an overnight window after midnight belongs to the
+		// day it started.
+		if start > end && minute < end {
+			day = (day + 6) % 7
+		}
+		if !windowOnDay(window, day) {
+			continue
+		}
+		switch {
+		case start == end:
+			return true
+		case start < end && minute >= start && minute < end:
+			return true
+		case start > end && (minute >= start || minute < end):
+			return true
+		}
+	}
+	return false
+}
+
+func windowOnDay(window RoEWindow, day time.Weekday) bool {
+	if len(window.Days) == 0 {
+		return true
+	}
+	for _, name := range window.Days {
+		if weekdays[strings.ToLower(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludesHost reports whether target, a hostname, IP address or URL, is one
+// of the excluded hosts.
+func (r *RoE) ExcludesHost(target string) bool {
+	host := targetHost(target)
+	if host == "" {
+		return false
+	}
+	addr, addrErr := netip.ParseAddr(host)
+	for _, excluded := range r.ExcludedHosts {
+		excluded = strings.ToLower(strings.TrimSpace(excluded))
+		if prefix, err := netip.ParsePrefix(excluded); err == nil {
+			if addrErr == nil && prefix.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if strings.HasPrefix(excluded, "*.") {
+			if strings.HasSuffix(host, excluded[1:]) || host == excluded[2:] {
+				return true
+			}
+			continue
+		}
+		if host == targetHost(excluded) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetHost extracts the lower-cased host of a hostname, host:port, IP
+// address or URL.
+func targetHost(target string) string {
+	target = strings.TrimSpace(target)
+	if strings.Contains(target, "://") {
+		if u, err := url.Parse(target); err == nil {
+			return strings.ToLower(u.Hostname())
+		}
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		target = host
+	}
+	return strings.ToLower(strings.TrimSuffix(target, "."))
+}
+
+// CheckStart returns every rule req breaks: launching outside the windows,
+// a higher aggressive level than allowed, enabling a forbidden capability,
+// leaving out a required stealth option or targeting an excluded host.
+func (r *RoE) CheckStart(req StartRequest, targets []string, now time.Time) []RoEViolation {
+	var violations []RoEViolation
+	add := func(rule, reason string) {
+		violations = append(violations, RoEViolation{Rule: rule, Reason: reason, At: now})
+	}
+
+	if !r.InWindow(now) {
+		add(RoERuleWindow, "outside the allowed time windows")
+	}
+	if r.MaxAggressiveLevel > 0 && req.AggressiveLevel > r.MaxAggressiveLevel {
+		add(RoERuleAggressive, fmt.Sprintf("aggressive level %d exceeds the maximum of %d", req.AggressiveLevel, r.MaxAggressiveLevel))
+	}
+	enabled := req.Capabilities.Enabled()
+	for _, name := range r.ForbiddenCapabilities {
+		if enabled[name] {
+			add(RoERuleCapability, fmt.Sprintf("capability %s is forbidden", name))
+		}
+	}
+	stealth := req.StealthOptions.Enabled()
+	var missing []string
+	for _, name := range r.RequiredStealth {
+		if !stealth[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		add(RoERuleStealth, "required stealth options not enabled: "+strings.Join(missing, ", "))
+	}
+	for _, target := range targets {
+		if r.ExcludesHost(target) {
+			add(RoERuleExcluded, fmt.Sprintf("target %s is excluded", target))
+		}
+	}
+	return violations
+}
+
+// CheckCommand returns the rule a tool command breaks, or nil: running
+// outside the windows or naming an excluded host in its arguments.
+func (r *RoE) CheckCommand(args []string, now time.Time) *RoEViolation {
+	if !r.InWindow(now) {
+		return &RoEViolation{Rule: RoERuleWindow, Reason: "outside the allowed time windows", At: now}
+	}
+	if len(r.ExcludedHosts) == 0 {
+		return nil
+	}
+	for _, arg := range args {
+		// Flags carry their value after "=", as in --url=https://host.
+		if i := strings.Index(arg, "="); strings.HasPrefix(arg, "-") && i > 0 {
+			arg = arg[i+1:]
+		}
+		if r.ExcludesHost(arg) {
+			return &RoEViolation{Rule: RoERuleExcluded, Reason: fmt.Sprintf("%s is an excluded host", arg), At: now}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// maxStepsPerAgent bounds the step records kept for each agent.
+const maxStepsPerAgent = 200
+
+// Tool run statuses of a step.
+const (
+	StepToolRan     = "ran"
+	StepToolBlocked = "blocked"
+)
+
+// StepToolRun is one command of a step with the resources its run used.
+// Blocked commands were refused before running and used nothing.
+type StepToolRun struct {
+	Command     string     `json:"command"`
+	Tool        string     `json:"tool,omitempty"`
+	Status      string     `json:"status"`
+	ExitCode    int        `json:"exit_code"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	DurationMs  int64      `json:"duration_ms"`
+	CPUSeconds  float64    `json:"cpu_seconds"`
+	PacedMs     int64      `json:"paced_ms"`
+	OutputBytes int        `json:"output_bytes"`
+	Limit       string     `json:"limit,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	// ErrorClass classifies Error; Attempts counts the runs when the
+	// command was retried.
+	ErrorClass string `json:"error_class,omitempty"`
+	Attempts   int    `json:"attempts,omitempty"`
+}
+
+// AgentStep records the tool commands an agent ran after one model turn.
+// Concurrency is how many ran at a time; WallMs is how long the step took
+// and SerialMs how long its runs would have taken one after the other.
+type AgentStep struct {
+	AgentID     string        `json:"agent_id"`
+	Iteration   int           `json:"iteration"`
+	StartedAt   time.Time     `json:"started_at"`
+	WallMs      int64         `json:"wall_ms"`
+	SerialMs    int64         `json:"serial_ms"`
+	Concurrency int           `json:"concurrency"`
+	CPUSeconds  float64       `json:"cpu_seconds"`
+	Tools       []StepToolRun `json:"tools"`
+}
+
+// RecordStep adds a step to the agent's records.
+func (m *AgentManager) RecordStep(step AgentStep) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.agents[step.AgentID]; !exists {
+		return
+	}
+	steps := append(m.steps[step.AgentID], step)
+	if len(steps) > maxStepsPerAgent {
+		steps = steps[len(steps)-maxStepsPerAgent:]
+	}
+	m.steps[step.AgentID] = steps
+}
+
+// Steps returns the agent's step records, oldest first.
+func (m *AgentManager) Steps(agentID string) []AgentStep {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	steps := make([]AgentStep, len(m.steps[agentID]))
+	copy(steps, m.steps[agentID])
+	return steps
+}
@@ -0,0 +1,94 @@
+package models
+
+import "time"
+
+// ThrottleAgent records that a running or throttled agent hit a limit and
+// holds it like a pause until the reason is cleared or the agent is resumed.
+// It reports whether reason is new.
+func (m *AgentManager) ThrottleAgent(id, reason string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[id]
+	if !exists || (agent.Status != AgentStatusRunning && agent.Status != AgentStatusThrottled) {
+		return false
+	}
+	for _, existing := range agent.ThrottleReasons {
+		if existing == reason {
+			return false
+		}
+	}
+	now := time.Now()
+	if agent.Status == AgentStatusRunning {
+		agent.Status = AgentStatusThrottled
+		agent.PausedAt = &now
+		if _, gated := m.pauseGates[id]; !gated {
+			m.pauseGates[id] = make(chan struct{})
+		}
+	}
+	agent.ThrottleReasons = append(agent.ThrottleReasons, reason)
+	agent.UpdatedAt = now
+	agent.refreshElapsed(now)
+	return true
+}
+
+// ClearThrottle drops reason from a throttled agent and lets it run again once
+// no reason is left. It reports whether the agent was released.
+func (m *AgentManager) ClearThrottle(id, reason string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[id]
+	if !exists || agent.Status != AgentStatusThrottled {
+		return false
+	}
+	reasons := agent.ThrottleReasons[:0]
+	for _, existing := range agent.ThrottleReasons {
+		if existing != reason {
+			reasons = append(reasons, existing)
+		}
+	}
+	agent.ThrottleReasons = reasons
+	if len(reasons) > 0 {
+		return false
+	}
+
+	now := time.Now()
+	if agent.PausedAt != nil {
+		agent.PausedSeconds += now.Sub(*agent.PausedAt).Seconds()
+		agent.PausedAt = nil
+	}
+	agent.ThrottleReasons = nil
+	agent.Status = AgentStatusRunning
+	agent.UpdatedAt = now
+	agent.refreshElapsed(now)
+	agent.revive(now)
+	m.openPauseGate(id)
+	return true
+}
+
+// UpdateAgentLimits replaces the agent's resource limits.
+func (m *AgentManager) UpdateAgentLimits(id string, limits AgentLimits) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agent, exists := m.agents[id]; exists {
+		agent.Config.Limits = limits
+		agent.UpdatedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// AgentLimits returns the agent's resource limits and what it used against
+// them so far.
+func (m *AgentManager) AgentLimits(id string) (AgentLimits, AgentUsage, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	agent, exists := m.agents[id]
+	if !exists {
+		return AgentLimits{}, AgentUsage{}, false
+	}
+	return agent.Config.Limits, agent.Usage, true
+}
@@ -0,0 +1,112 @@
+package netpriv
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"performa-backend/database"
+	"performa-backend/telemetry"
+
+	"github.com/google/uuid"
+)
+
+// Audited actions.
+const (
+	ActionSpoofMAC   = "spoof_mac"
+	ActionRestoreMAC = "restore_mac"
+)
+
+// ActorRecovery is the actor of restores done on startup for a previous run.
+const ActorRecovery = "system:recovery"
+
+// maxAuditEntries caps the audit entries kept in memory when there is no
+// database.
+const maxAuditEntries = 1000
+
+// AuditEntry records a privileged network action, whether it succeeded or
+// was refused.
+type AuditEntry struct {
+	ID          string    `json:"id"`
+	Action      string    `json:"action"`
+	Actor       string    `json:"actor"`
+	Interface   string    `json:"interface,omitempty"`
+	OperationID string    `json:"operation_id,omitempty"`
+	From        string    `json:"from,omitempty"`
+	To          string    `json:"to,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// record adds entry to the audit log. The caller holds m.mu.
+func (m *Manager) record(entry AuditEntry) {
+	entry.ID = uuid.New().String()
+	entry.CreatedAt = time.Now()
+
+	m.audit = append(m.audit, entry)
+	if len(m.audit) > maxAuditEntries {
+		m.audit = m.audit[len(m.audit)-maxAuditEntries:]
+	}
+
+	if entry.Error != "" {
+		log.Printf("Network: %s on %q by %s refused: %s", entry.Action, entry.Interface, entry.Actor, entry.Error)
+	} else {
+		log.Printf("Network: %s on %s by %s: %s -> %s", entry.Action, entry.Interface, entry.Actor, entry.From, entry.To)
+	}
+	if err := database.SaveNetworkAudit(database.NetworkAuditRecord(entry)); err != nil {
+		log.Printf("Network: failed to persist audit entry: %v", err)
+	}
+	ship(entry)
+}
+
+// ship sends entry to syslog. Privileged network changes are always
+// notable, and refused ones more so.
+func ship(entry AuditEntry) {
+	event := telemetry.Event{
+		Time:        entry.CreatedAt,
+		Category:    telemetry.CategoryNetwork,
+		Action:      entry.Action,
+		Severity:    6,
+		Outcome:     telemetry.OutcomeSuccess,
+		Actor:       entry.Actor,
+		OperationID: entry.OperationID,
+		Message:     fmt.Sprintf("%s on %s: %s -> %s", entry.Action, entry.Interface, entry.From, entry.To),
+		Fields: map[string]string{
+			"audit_id":  entry.ID,
+			"interface": entry.Interface,
+			"from":      entry.From,
+			"to":        entry.To,
+		},
+	}
+	if entry.Error != "" {
+		event.Severity = 7
+		event.Outcome = telemetry.OutcomeFailure
+		event.Message = fmt.Sprintf("%s on %s refused: %s", entry.Action, entry.Interface, entry.Error)
+		event.Fields["error"] = entry.Error
+	}
+	telemetry.Emit(event)
+}
+
+// Audit returns the most recent audit entries, newest first.
+func (m *Manager) Audit(limit int) []AuditEntry {
+	if database.DB != nil {
+		records, err := database.GetNetworkAudit(limit)
+		if err == nil {
+			entries := make([]AuditEntry, 0, len(records))
+			for _, record := range records {
+				entries = append(entries, AuditEntry(record))
+			}
+			return entries
+		}
+		log.Printf("Network: failed to load audit log: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]AuditEntry, 0, len(m.audit))
+	for i := len(m.audit) - 1; i >= 0 && (limit <= 0 || len(entries) < limit); i-- {
+		entries = append(entries, m.audit[i])
+	}
+	return entries
+}
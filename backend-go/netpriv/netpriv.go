@@ -0,0 +1,453 @@
+// Package netpriv makes privileged changes to the host's network for
+// operations: it spoofs the MAC address of a designated test interface and
+// puts it back afterwards, and drives ARP and DNS spoofing from it for a
+// limited time. It is off unless explicitly enabled, never touches the
+// management interface (the one carrying the default route, plus any
+// configured), and records every action in an audit log. Original addresses
+// and spoofing processes are kept in a state file so that a restart after a
+// crash restores and stops them.
+package netpriv
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDisabled            = errors.New("privileged network actions are disabled (PRIVILEGED_NETWORK_ENABLED)")
+	ErrNoTestInterface     = errors.New("no test interface is designated (NETWORK_TEST_INTERFACE)")
+	ErrNotTestInterface    = errors.New("only the designated test interface may be changed")
+	ErrManagementInterface = errors.New("refusing to change the management interface")
+	ErrUnsupported         = errors.New("privileged network actions are only supported on linux")
+)
+
+// Config enables the module and names the interfaces it may and may not
+// change.
+type Config struct {
+	Enabled bool
+	// TestInterface is the only interface whose address may be changed.
+	TestInterface string
+	// ManagementInterfaces are never changed, in addition to the interface
+	// of the default route.
+	ManagementInterfaces []string
+	// StateFile keeps the original addresses of spoofed interfaces and the
+	// processes of spoofing sessions.
+	StateFile string
+	// SessionDuration is the time a spoofing session runs when it asks for
+	// none, MaxSessionDuration the most it may ask for.
+	SessionDuration    time.Duration
+	MaxSessionDuration time.Duration
+	// ReportInterval is how often running sessions report their state.
+	ReportInterval time.Duration
+}
+
+// Interface is a network interface of the host.
+type Interface struct {
+	Name        string   `json:"name"`
+	MAC         string   `json:"mac"`
+	OriginalMAC string   `json:"original_mac,omitempty"`
+	Up          bool     `json:"up"`
+	Loopback    bool     `json:"loopback"`
+	Addresses   []string `json:"addresses,omitempty"`
+	Management  bool     `json:"management"`
+	Test        bool     `json:"test"`
+	Spoofed     bool     `json:"spoofed"`
+}
+
+// Spoof is a MAC address change in effect.
+type Spoof struct {
+	Interface   string    `json:"interface"`
+	OriginalMAC string    `json:"original_mac"`
+	MAC         string    `json:"mac"`
+	OperationID string    `json:"operation_id,omitempty"`
+	Actor       string    `json:"actor"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Manager struct {
+	config   Config
+	spoofs   map[string]*Spoof
+	sessions map[string]*Session
+	audit    []AuditEntry
+	notify   func(Session)
+	mu       sync.Mutex
+}
+
+var Default = NewManager()
+
+func NewManager() *Manager {
+	return &Manager{
+		spoofs:   make(map[string]*Spoof),
+		sessions: make(map[string]*Session),
+	}
+}
+
+func (m *Manager) Configure(config Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.config = config
+}
+
+func (m *Manager) Enabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.config.Enabled
+}
+
+// Interfaces lists the host's interfaces and whether each may be changed.
+func (m *Manager) Interfaces() ([]Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	management := m.managementInterfaces()
+	list := make([]Interface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		info := Interface{
+			Name:       iface.Name,
+			MAC:        iface.HardwareAddr.String(),
+			Up:         iface.Flags&net.FlagUp != 0,
+			Loopback:   iface.Flags&net.FlagLoopback != 0,
+			Management: management[iface.Name],
+			Test:       iface.Name == m.config.TestInterface,
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				info.Addresses = append(info.Addresses, addr.String())
+			}
+		}
+		if spoof, ok := m.spoofs[iface.Name]; ok {
+			info.Spoofed = true
+			info.OriginalMAC = spoof.OriginalMAC
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+// Spoofs returns the MAC address changes in effect.
+func (m *Manager) Spoofs() []Spoof {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	spoofs := make([]Spoof, 0, len(m.spoofs))
+	for _, spoof := range m.spoofs {
+		spoofs = append(spoofs, *spoof)
+	}
+	sort.Slice(spoofs, func(i, j int) bool { return spoofs[i].CreatedAt.Before(spoofs[j].CreatedAt) })
+	return spoofs
+}
+
+// CheckSpoof reports why the MAC address of name (the test interface when
+// empty) could not be spoofed, without changing anything.
+func (m *Manager) CheckSpoof(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.checkInterface(name)
+	return err
+}
+
+// checkInterface returns the interface name (the test interface when empty)
+// stands for, or why it may not be changed.
+func (m *Manager) checkInterface(name string) (string, error) {
+	if !m.config.Enabled {
+		return "", ErrDisabled
+	}
+	if runtime.GOOS != "linux" {
+		return "", ErrUnsupported
+	}
+	if m.config.TestInterface == "" {
+		return "", ErrNoTestInterface
+	}
+	if name == "" {
+		name = m.config.TestInterface
+	}
+	if m.managementInterfaces()[name] {
+		return "", fmt.Errorf("%w %s", ErrManagementInterface, name)
+	}
+	if name != m.config.TestInterface {
+		return "", fmt.Errorf("%w (%s, not %s)", ErrNotTestInterface, m.config.TestInterface, name)
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("interface %s: %w", name, err)
+	}
+	if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) != 6 {
+		return "", fmt.Errorf("interface %s has no MAC address", name)
+	}
+	return name, nil
+}
+
+// SpoofMAC sets the MAC address of name (the test interface when empty) to
+// mac, or to a random locally administered address when mac is empty. The
+// change is tied to operationID, if any, and restored with it.
+func (m *Manager) SpoofMAC(name, mac, operationID, actor string) (*Spoof, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	checked, err := m.checkInterface(name)
+	if err != nil {
+		m.record(AuditEntry{Action: ActionSpoofMAC, Actor: actor, Interface: name, OperationID: operationID, To: mac, Error: err.Error()})
+		return nil, err
+	}
+	name = checked
+
+	if mac == "" {
+		mac = RandomMAC()
+	} else if hw, err := net.ParseMAC(mac); err != nil || len(hw) != 6 {
+		err = fmt.Errorf("invalid MAC address %q", mac)
+		m.record(AuditEntry{Action: ActionSpoofMAC, Actor: actor, Interface: name, OperationID: operationID, To: mac, Error: err.Error()})
+		return nil, err
+	} else {
+		mac = hw.String()
+	}
+
+	iface, _ := net.InterfaceByName(name)
+	current := iface.HardwareAddr.String()
+	original := current
+	if existing, ok := m.spoofs[name]; ok {
+		original = existing.OriginalMAC
+	}
+
+	if err := setMAC(name, mac); err != nil {
+		m.record(AuditEntry{Action: ActionSpoofMAC, Actor: actor, Interface: name, OperationID: operationID, From: current, To: mac, Error: err.Error()})
+		return nil, err
+	}
+
+	spoof := &Spoof{
+		Interface:   name,
+		OriginalMAC: original,
+		MAC:         mac,
+		OperationID: operationID,
+		Actor:       actor,
+		CreatedAt:   time.Now(),
+	}
+	m.spoofs[name] = spoof
+	m.saveState()
+	m.record(AuditEntry{Action: ActionSpoofMAC, Actor: actor, Interface: name, OperationID: operationID, From: current, To: mac})
+	return spoof, nil
+}
+
+// RestoreMAC puts back the original MAC address of name. It reports false
+// when name is not spoofed.
+func (m *Manager) RestoreMAC(name, actor string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	spoof, ok := m.spoofs[name]
+	if !ok {
+		return false, nil
+	}
+	return true, m.restore(spoof, actor)
+}
+
+// RestoreOperation puts back the addresses changed for operationID.
+func (m *Manager) RestoreOperation(operationID, actor string) []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, spoof := range m.spoofs {
+		if spoof.OperationID == operationID {
+			if err := m.restore(spoof, actor); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// RestoreAll puts back every changed address, e.g. on shutdown.
+func (m *Manager) RestoreAll(actor string) []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, spoof := range m.spoofs {
+		if err := m.restore(spoof, actor); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (m *Manager) restore(spoof *Spoof, actor string) error {
+	if err := setMAC(spoof.Interface, spoof.OriginalMAC); err != nil {
+		m.record(AuditEntry{Action: ActionRestoreMAC, Actor: actor, Interface: spoof.Interface, OperationID: spoof.OperationID, From: spoof.MAC, To: spoof.OriginalMAC, Error: err.Error()})
+		return fmt.Errorf("restore %s: %w", spoof.Interface, err)
+	}
+	delete(m.spoofs, spoof.Interface)
+	m.saveState()
+	m.record(AuditEntry{Action: ActionRestoreMAC, Actor: actor, Interface: spoof.Interface, OperationID: spoof.OperationID, From: spoof.MAC, To: spoof.OriginalMAC})
+	return nil
+}
+
+// state is what the state file keeps for a restart after a crash.
+type state struct {
+	MAC       []*Spoof         `json:"mac,omitempty"`
+	Processes []sessionProcess `json:"processes,omitempty"`
+}
+
+// sessionProcess is a running process of a spoofing session.
+type sessionProcess struct {
+	PID     int    `json:"pid"`
+	Tool    string `json:"tool"`
+	Session string `json:"session"`
+}
+
+// Recover restores the addresses left changed and stops the spoofing
+// processes left running by a previous run that did not shut down cleanly,
+// as recorded in the state file.
+func (m *Manager) Recover() []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.config.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.config.StateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return []error{err}
+	}
+	var leftover state
+	if err := json.Unmarshal(data, &leftover); err != nil {
+		return []error{fmt.Errorf("state file %s: %w", m.config.StateFile, err)}
+	}
+
+	var errs []error
+	for _, proc := range leftover.Processes {
+		if err := stopLeftover(proc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, spoof := range leftover.MAC {
+		m.spoofs[spoof.Interface] = spoof
+		if err := m.restore(spoof, ActorRecovery); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	m.saveState()
+	return errs
+}
+
+// saveState writes the spoofs in effect and the processes of running
+// sessions to the state file, removing it when there are none.
+func (m *Manager) saveState() {
+	if m.config.StateFile == "" {
+		return
+	}
+
+	var current state
+	for _, spoof := range m.spoofs {
+		current.MAC = append(current.MAC, spoof)
+	}
+	for _, session := range m.sessions {
+		if session.State != SessionActive {
+			continue
+		}
+		for _, cmd := range session.cmds {
+			current.Processes = append(current.Processes, sessionProcess{
+				PID:     cmd.Process.Pid,
+				Tool:    filepath.Base(cmd.Path),
+				Session: session.ID,
+			})
+		}
+	}
+	if len(current.MAC) == 0 && len(current.Processes) == 0 {
+		if err := os.Remove(m.config.StateFile); err != nil && !os.IsNotExist(err) {
+			log.Printf("Network: failed to remove state file: %v", err)
+		}
+		return
+	}
+
+	data, _ := json.MarshalIndent(current, "", "  ")
+	if dir := filepath.Dir(m.config.StateFile); dir != "" {
+		os.MkdirAll(dir, 0700)
+	}
+	if err := os.WriteFile(m.config.StateFile, data, 0600); err != nil {
+		log.Printf("Network: failed to write state file: %v", err)
+	}
+}
+
+// managementInterfaces returns the configured management interfaces and the
+// interface of the default route.
+func (m *Manager) managementInterfaces() map[string]bool {
+	management := make(map[string]bool)
+	for _, name := range m.config.ManagementInterfaces {
+		management[name] = true
+	}
+	if name := defaultRouteInterface(); name != "" {
+		management[name] = true
+	}
+	return management
+}
+
+// defaultRouteInterface returns the interface of the IPv4 default route, read
+// from /proc/net/route, or "" when it cannot be told.
+func defaultRouteInterface() string {
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) > 2 && fields[1] == "00000000" {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// setMAC changes the address of an interface. An interface that is up is
+// taken down for the change and brought back up afterwards, even when the
+// change failed.
+var setMAC = func(name, mac string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	up := iface.Flags&net.FlagUp != 0
+
+	if up {
+		if err := ipLink(name, "down"); err != nil {
+			return err
+		}
+		defer ipLink(name, "up")
+	}
+	return ipLink(name, "address", mac)
+}
+
+func ipLink(name string, args ...string) error {
+	args = append([]string{"link", "set", "dev", name}, args...)
+	if output, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ip %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// RandomMAC returns a random unicast, locally administered MAC address.
+func RandomMAC() string {
+	mac := make(net.HardwareAddr, 6)
+	rand.Read(mac)
+	mac[0] = mac[0]&0xfe | 0x02
+	return mac.String()
+}
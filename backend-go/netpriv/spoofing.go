@@ -0,0 +1,514 @@
+package netpriv
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// Spoofing capabilities, named like the operation capabilities they drive.
+const (
+	CapabilityARPSpoof = "arp_spoof"
+	CapabilityDNSSpoof = "dns_spoof"
+)
+
+// Session states.
+const (
+	SessionActive  = "active"
+	SessionStopped = "stopped"
+	SessionFailed  = "failed"
+)
+
+// ActorTimer is the actor of sessions stopped because their time ran out.
+const ActorTimer = "system:timer"
+
+const (
+	DefaultSessionDuration    = 5 * time.Minute
+	DefaultMaxSessionDuration = 30 * time.Minute
+	DefaultReportInterval     = 5 * time.Second
+
+	// stopGrace is how long a stopped tool gets to undo its poisoning, e.g.
+	// arpspoof re-announcing the real addresses, before it is killed.
+	stopGrace = 5 * time.Second
+)
+
+var (
+	ErrUnknownCapability = errors.New("no driver for this capability")
+	ErrOutOfScope        = errors.New("address is not in an in-scope subnet")
+	ErrSessionActive     = errors.New("a session of this capability is already running on the interface")
+	ErrInvalidSpec       = errors.New("invalid spoofing session")
+)
+
+// SpoofSpec describes a spoofing session. Targets are the victims' IP
+// addresses. ARP spoofing impersonates Gateway to them; DNS spoofing answers
+// their queries for the Records hostnames with the given addresses.
+type SpoofSpec struct {
+	Capability string            `json:"capability"`
+	Targets    []string          `json:"targets"`
+	Gateway    string            `json:"gateway,omitempty"`
+	Records    map[string]string `json:"records,omitempty"`
+	Duration   time.Duration     `json:"-"`
+	// Scope lists the subnets the targets and gateway must be in.
+	Scope []netip.Prefix `json:"-"`
+}
+
+// Session is a spoofing capability run by its driver. It stops on its own
+// when ExpiresAt passes.
+type Session struct {
+	ID          string            `json:"id"`
+	Capability  string            `json:"capability"`
+	OperationID string            `json:"operation_id,omitempty"`
+	Interface   string            `json:"interface"`
+	Targets     []string          `json:"targets"`
+	Gateway     string            `json:"gateway,omitempty"`
+	Records     map[string]string `json:"records,omitempty"`
+	Actor       string            `json:"actor"`
+	State       string            `json:"state"`
+	Error       string            `json:"error,omitempty"`
+	StartedAt   time.Time         `json:"started_at"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+	// RemainingSeconds is the time left before the session is torn down.
+	RemainingSeconds int        `json:"remaining_seconds"`
+	StoppedAt        *time.Time `json:"stopped_at,omitempty"`
+	StoppedBy        string     `json:"stopped_by,omitempty"`
+
+	cmds   []*exec.Cmd
+	dir    string
+	timer  *time.Timer
+	exited chan struct{}
+}
+
+func (s *Session) snapshot() Session {
+	copied := *s
+	copied.Targets = append([]string(nil), s.Targets...)
+	if s.State == SessionActive {
+		copied.RemainingSeconds = int(time.Until(s.ExpiresAt).Seconds())
+		if copied.RemainingSeconds < 0 {
+			copied.RemainingSeconds = 0
+		}
+	}
+	copied.cmds, copied.timer, copied.exited = nil, nil, nil
+	return copied
+}
+
+// Driver turns a spoofing spec into the tool commands that carry it out on
+// an interface. Each command runs until it is stopped; dir holds the files
+// they need.
+type Driver interface {
+	Commands(spec SpoofSpec, iface, dir string) ([][]string, error)
+}
+
+// Drivers maps each spoofing capability to its driver.
+var Drivers = map[string]Driver{
+	CapabilityARPSpoof: arpDriver{},
+	CapabilityDNSSpoof: dnsDriver{},
+}
+
+// driverTools are the tools the drivers wrap. They only run through a
+// driver, never as an agent's command.
+var driverTools = map[string]bool{
+	"arpspoof": true,
+	"dnsspoof": true,
+	"dnschef":  true,
+}
+
+// DriverTool reports whether tool is only run through a spoofing driver.
+func DriverTool(tool string) bool {
+	return driverTools[filepath.Base(tool)]
+}
+
+// arpDriver poisons the ARP caches of the targets with arpspoof, one process
+// per target, so that their traffic to the gateway goes through this host.
+type arpDriver struct{}
+
+func (arpDriver) Commands(spec SpoofSpec, iface, dir string) ([][]string, error) {
+	if spec.Gateway == "" {
+		return nil, fmt.Errorf("%w: ARP spoofing needs a gateway to impersonate", ErrInvalidSpec)
+	}
+	commands := make([][]string, 0, len(spec.Targets))
+	for _, target := range spec.Targets {
+		commands = append(commands, []string{"arpspoof", "-i", iface, "-t", target, spec.Gateway})
+	}
+	return commands, nil
+}
+
+// dnsDriver answers the targets' DNS queries for the spoofed hostnames with
+// dnsspoof, reading the answers from a hosts file.
+type dnsDriver struct{}
+
+func (dnsDriver) Commands(spec SpoofSpec, iface, dir string) ([][]string, error) {
+	if len(spec.Records) == 0 {
+		return nil, fmt.Errorf("%w: DNS spoofing needs at least one record", ErrInvalidSpec)
+	}
+	hosts := make([]string, 0, len(spec.Records))
+	for host, addr := range spec.Records {
+		if _, err := netip.ParseAddr(addr); err != nil {
+			return nil, fmt.Errorf("%w: record %s: invalid address %q", ErrInvalidSpec, host, addr)
+		}
+		hosts = append(hosts, addr+"\t"+host)
+	}
+	sort.Strings(hosts)
+	hostsFile := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(hostsFile, []byte(strings.Join(hosts, "\n")+"\n"), 0600); err != nil {
+		return nil, err
+	}
+
+	sources := make([]string, 0, len(spec.Targets))
+	for _, target := range spec.Targets {
+		sources = append(sources, "src host "+target)
+	}
+	filter := fmt.Sprintf("udp dst port 53 and (%s)", strings.Join(sources, " or "))
+	return [][]string{{"dnsspoof", "-i", iface, "-f", hostsFile, filter}}, nil
+}
+
+// inScope checks that every address is in one of the prefixes.
+func inScope(addrs []string, scope []netip.Prefix) error {
+	for _, value := range addrs {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return fmt.Errorf("%w: invalid IP address %q", ErrInvalidSpec, value)
+		}
+		contained := false
+		for _, prefix := range scope {
+			if prefix.Contains(addr) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			return fmt.Errorf("%w: %s", ErrOutOfScope, value)
+		}
+	}
+	return nil
+}
+
+// SetNotify sets the function told about every change of a session, and
+// periodically about each running one.
+func (m *Manager) SetNotify(notify func(Session)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notify = notify
+}
+
+func (m *Manager) report(session Session) {
+	m.mu.Lock()
+	notify := m.notify
+	m.mu.Unlock()
+	if notify != nil {
+		notify(session)
+	}
+}
+
+// StartSpoofing runs the driver of spec's capability on the test interface
+// for spec.Duration (the configured default when 0). The targets and gateway
+// must be in spec.Scope; the session is tied to operationID and stopped
+// with it.
+func (m *Manager) StartSpoofing(spec SpoofSpec, operationID, actor string) (*Session, error) {
+	m.mu.Lock()
+	session, err := m.startSpoofing(spec, operationID, actor)
+	audit := AuditEntry{
+		Action:      "start_" + spec.Capability,
+		Actor:       actor,
+		OperationID: operationID,
+		To:          strings.Join(spec.Targets, ","),
+		From:        spec.Gateway,
+	}
+	if err != nil {
+		audit.Error = err.Error()
+		m.record(audit)
+		m.mu.Unlock()
+		return nil, err
+	}
+	audit.Interface = session.Interface
+	m.record(audit)
+	m.saveState()
+	snapshot := session.snapshot()
+	m.mu.Unlock()
+
+	m.report(snapshot)
+	go m.watch(session)
+	return &snapshot, nil
+}
+
+func (m *Manager) startSpoofing(spec SpoofSpec, operationID, actor string) (*Session, error) {
+	driver, ok := Drivers[spec.Capability]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCapability, spec.Capability)
+	}
+	iface, err := m.checkInterface("")
+	if err != nil {
+		return nil, err
+	}
+	if len(spec.Targets) == 0 {
+		return nil, fmt.Errorf("%w: at least one target is required", ErrInvalidSpec)
+	}
+	addrs := spec.Targets
+	if spec.Gateway != "" {
+		addrs = append(append([]string(nil), addrs...), spec.Gateway)
+	}
+	if err := inScope(addrs, spec.Scope); err != nil {
+		return nil, err
+	}
+
+	duration := spec.Duration
+	if duration <= 0 {
+		duration = m.config.SessionDuration
+	}
+	if duration <= 0 {
+		duration = DefaultSessionDuration
+	}
+	maxDuration := m.config.MaxSessionDuration
+	if maxDuration <= 0 {
+		maxDuration = DefaultMaxSessionDuration
+	}
+	if duration > maxDuration {
+		return nil, fmt.Errorf("%w: duration %s exceeds the maximum of %s", ErrInvalidSpec, duration, maxDuration)
+	}
+
+	for _, existing := range m.sessions {
+		if existing.State == SessionActive && existing.Capability == spec.Capability && existing.Interface == iface {
+			return nil, fmt.Errorf("%w (session %s)", ErrSessionActive, existing.ID)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "performa-spoof-")
+	if err != nil {
+		return nil, err
+	}
+	commands, err := driver.Commands(spec, iface, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:          uuid.New().String(),
+		Capability:  spec.Capability,
+		OperationID: operationID,
+		Interface:   iface,
+		Targets:     spec.Targets,
+		Gateway:     spec.Gateway,
+		Records:     spec.Records,
+		Actor:       actor,
+		State:       SessionActive,
+		StartedAt:   now,
+		ExpiresAt:   now.Add(duration),
+		dir:         dir,
+		exited:      make(chan struct{}),
+	}
+	for _, args := range commands {
+		cmd := exec.Command(args[0], args[1:]...)
+		if err := cmd.Start(); err != nil {
+			for _, started := range session.cmds {
+				started.Process.Kill()
+				started.Wait()
+			}
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("start %s: %w", args[0], err)
+		}
+		session.cmds = append(session.cmds, cmd)
+	}
+
+	id := session.ID
+	session.timer = time.AfterFunc(duration, func() {
+		m.StopSpoofing(id, ActorTimer)
+	})
+	m.sessions[id] = session
+	return session, nil
+}
+
+// watch waits for the session's processes, failing the session when one
+// exits while it is active, and reports the running session every
+// ReportInterval.
+func (m *Manager) watch(session *Session) {
+	failures := make(chan error, len(session.cmds))
+	for _, cmd := range session.cmds {
+		go func(cmd *exec.Cmd) {
+			err := cmd.Wait()
+			if err == nil {
+				err = fmt.Errorf("exited")
+			}
+			failures <- fmt.Errorf("%s %v", filepath.Base(cmd.Path), err)
+		}(cmd)
+	}
+
+	m.mu.Lock()
+	interval := m.config.ReportInterval
+	m.mu.Unlock()
+	if interval <= 0 {
+		interval = DefaultReportInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for remaining := len(session.cmds); remaining > 0; {
+		select {
+		case err := <-failures:
+			remaining--
+			m.fail(session, err)
+		case <-ticker.C:
+			m.mu.Lock()
+			active := session.State == SessionActive
+			snapshot := session.snapshot()
+			m.mu.Unlock()
+			if active {
+				m.report(snapshot)
+			}
+		}
+	}
+	os.RemoveAll(session.dir)
+	close(session.exited)
+}
+
+// fail stops a session one of whose processes exited on its own.
+func (m *Manager) fail(session *Session, err error) {
+	m.mu.Lock()
+	if session.State != SessionActive {
+		m.mu.Unlock()
+		return
+	}
+	session.Error = err.Error()
+	m.stop(session, SessionFailed, "system:driver")
+	snapshot := session.snapshot()
+	m.mu.Unlock()
+
+	log.Printf("Network: %s session %s failed: %v", session.Capability, session.ID, err)
+	m.report(snapshot)
+}
+
+// StopSpoofing tears the session down. It reports false when the session is
+// unknown or no longer active.
+func (m *Manager) StopSpoofing(id, actor string) bool {
+	m.mu.Lock()
+	session, ok := m.sessions[id]
+	if !ok || session.State != SessionActive {
+		m.mu.Unlock()
+		return false
+	}
+	m.stop(session, SessionStopped, actor)
+	snapshot := session.snapshot()
+	m.mu.Unlock()
+
+	m.report(snapshot)
+	return true
+}
+
+// stop ends an active session: its timer is cancelled and its processes are
+// asked to terminate, then killed after stopGrace. The caller holds m.mu.
+func (m *Manager) stop(session *Session, state, actor string) {
+	now := time.Now()
+	session.State = state
+	session.StoppedAt = &now
+	session.StoppedBy = actor
+	session.timer.Stop()
+
+	for _, cmd := range session.cmds {
+		cmd.Process.Signal(syscall.SIGTERM)
+	}
+	go func() {
+		select {
+		case <-session.exited:
+		case <-time.After(stopGrace):
+			for _, cmd := range session.cmds {
+				cmd.Process.Kill()
+			}
+		}
+	}()
+
+	m.saveState()
+	m.record(AuditEntry{
+		Action:      "stop_" + session.Capability,
+		Actor:       actor,
+		Interface:   session.Interface,
+		OperationID: session.OperationID,
+		From:        session.Gateway,
+		To:          strings.Join(session.Targets, ","),
+		Error:       session.Error,
+	})
+}
+
+// StopOperationSpoofing tears down the sessions of an operation.
+func (m *Manager) StopOperationSpoofing(operationID, actor string) int {
+	stopped := 0
+	for _, session := range m.SpoofingSessions(operationID) {
+		if session.State == SessionActive && m.StopSpoofing(session.ID, actor) {
+			stopped++
+		}
+	}
+	return stopped
+}
+
+// StopAllSpoofing tears down every session and waits for their processes to
+// exit, e.g. on shutdown.
+func (m *Manager) StopAllSpoofing(actor string) {
+	m.mu.Lock()
+	var exited []chan struct{}
+	for _, session := range m.sessions {
+		if session.State == SessionActive {
+			m.stop(session, SessionStopped, actor)
+			exited = append(exited, session.exited)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, ch := range exited {
+		<-ch
+	}
+}
+
+// SpoofingSessions returns the sessions of an operation, or every session
+// when operationID is empty, oldest first.
+func (m *Manager) SpoofingSessions(operationID string) []Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := make([]Session, 0)
+	for _, session := range m.sessions {
+		if operationID == "" || session.OperationID == operationID {
+			sessions = append(sessions, session.snapshot())
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].StartedAt.Before(sessions[j].StartedAt) })
+	return sessions
+}
+
+// SpoofingSession returns a session by ID.
+func (m *Manager) SpoofingSession(id string) (Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	return session.snapshot(), true
+}
+
+// stopLeftover terminates a spoofing process a previous run left behind,
+// provided the PID still belongs to the same tool.
+func stopLeftover(proc sessionProcess) error {
+	p, err := process.NewProcess(int32(proc.PID))
+	if err != nil {
+		return nil
+	}
+	if name, err := p.Name(); err != nil || name != proc.Tool {
+		return nil
+	}
+	log.Printf("Network: stopping %s (pid %d) left running by session %s", proc.Tool, proc.PID, proc.Session)
+	if err := p.Terminate(); err != nil {
+		return fmt.Errorf("stop leftover %s (pid %d): %w", proc.Tool, proc.PID, err)
+	}
+	return nil
+}
@@ -0,0 +1,397 @@
+// Package nuclei manages a local checkout of the nuclei templates repository:
+// syncing it, indexing the templates by tag and severity, and resolving a
+// template selection into the exact list of templates an operation is pinned
+// to, so that its scans can be reproduced.
+package nuclei
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRepo is the official templates repository.
+const DefaultRepo = "https://github.com/projectdiscovery/nuclei-templates.git"
+
+// Template is one indexed template. Path is relative to the templates
+// directory.
+type Template struct {
+	ID          string   `json:"id"`
+	Path        string   `json:"path"`
+	Name        string   `json:"name"`
+	Author      string   `json:"author,omitempty"`
+	Severity    string   `json:"severity"`
+	Tags        []string `json:"tags"`
+	Description string   `json:"description,omitempty"`
+}
+
+// Status describes the local checkout.
+type Status struct {
+	Dir       string     `json:"dir"`
+	Repo      string     `json:"repo"`
+	Commit    string     `json:"commit,omitempty"`
+	Templates int        `json:"templates"`
+	Syncing   bool       `json:"syncing"`
+	SyncedAt  *time.Time `json:"synced_at,omitempty"`
+	IndexedAt *time.Time `json:"indexed_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Filter selects templates. Tags match any of the given tags and Severities
+// any of the given severities; Query matches the ID, name or path.
+type Filter struct {
+	Query      string
+	Tags       []string
+	Severities []string
+	Limit      int
+	Offset     int
+}
+
+// Selection chooses the templates an operation runs: the templates named in
+// Templates, by ID or path, plus those matching Tags and Severities. Once
+// pinned, Templates lists the exact paths and Commit the checkout they came
+// from.
+type Selection struct {
+	Templates  []string `json:"templates,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Severities []string `json:"severities,omitempty"`
+	Commit     string   `json:"commit,omitempty"`
+}
+
+// Empty reports whether the selection chooses nothing.
+func (s Selection) Empty() bool {
+	return len(s.Templates) == 0 && len(s.Tags) == 0 && len(s.Severities) == 0
+}
+
+type Store struct {
+	dir       string
+	repo      string
+	templates []Template
+	byKey     map[string]*Template
+	status    Status
+	mu        sync.RWMutex
+}
+
+var Default = &Store{byKey: make(map[string]*Template)}
+
+// Configure sets the templates directory and the repository it syncs from.
+func (s *Store) Configure(dir, repo string) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if repo == "" {
+		repo = DefaultRepo
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir, s.repo = dir, repo
+	s.status.Dir, s.status.Repo = dir, repo
+}
+
+// Dir returns the absolute templates directory.
+func (s *Store) Dir() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dir
+}
+
+func (s *Store) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+// Sync clones the repository into the templates directory, or fetches its
+// latest revision when it is already there, then re-indexes the templates.
+// Only one sync runs at a time.
+func (s *Store) Sync(ctx context.Context) error {
+	s.mu.Lock()
+	if s.status.Syncing {
+		s.mu.Unlock()
+		return fmt.Errorf("a sync is already running")
+	}
+	s.status.Syncing = true
+	dir, repo := s.dir, s.repo
+	s.mu.Unlock()
+
+	err := syncRepo(ctx, dir, repo)
+	if err == nil {
+		err = s.Reindex()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Syncing = false
+	if err != nil {
+		s.status.Error = err.Error()
+		return err
+	}
+	now := time.Now()
+	s.status.SyncedAt = &now
+	s.status.Error = ""
+	return nil
+}
+
+func syncRepo(ctx context.Context, dir, repo string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git is not installed")
+	}
+
+	var commands [][]string
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		commands = [][]string{
+			{"git", "-C", dir, "fetch", "--depth", "1", "origin"},
+			{"git", "-C", dir, "reset", "--hard", "FETCH_HEAD"},
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return err
+		}
+		commands = [][]string{{"git", "clone", "--depth", "1", repo, dir}}
+	}
+
+	for _, args := range commands {
+		output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s failed: %v: %s", strings.Join(args[:4], " "), err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// templateFile is the part of a template file that is indexed.
+type templateFile struct {
+	ID   string `yaml:"id"`
+	Info struct {
+		Name        string    `yaml:"name"`
+		Author      yaml.Node `yaml:"author"`
+		Severity    string    `yaml:"severity"`
+		Tags        yaml.Node `yaml:"tags"`
+		Description string    `yaml:"description"`
+	} `yaml:"info"`
+}
+
+// splitList reads a field that templates write either as a comma separated
+// string or as a list.
+func splitList(node yaml.Node) []string {
+	var values []string
+	switch node.Kind {
+	case yaml.ScalarNode:
+		values = strings.Split(node.Value, ",")
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			values = append(values, item.Value)
+		}
+	}
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// Reindex reads every template in the templates directory.
+func (s *Store) Reindex() error {
+	dir := s.Dir()
+	templates := make([]Template, 0)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var file templateFile
+		if yaml.Unmarshal(data, &file) != nil || file.ID == "" || file.Info.Severity == "" {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		templates = append(templates, Template{
+			ID:          file.ID,
+			Path:        filepath.ToSlash(rel),
+			Name:        file.Info.Name,
+			Author:      strings.Join(splitList(file.Info.Author), ", "),
+			Severity:    strings.ToLower(strings.TrimSpace(file.Info.Severity)),
+			Tags:        splitList(file.Info.Tags),
+			Description: strings.TrimSpace(file.Info.Description),
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index templates: %w", err)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Path < templates[j].Path })
+
+	byKey := make(map[string]*Template, 2*len(templates))
+	for i := range templates {
+		byKey[templates[i].Path] = &templates[i]
+		if _, taken := byKey[templates[i].ID]; !taken {
+			byKey[templates[i].ID] = &templates[i]
+		}
+	}
+	commit := ""
+	if output, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output(); err == nil {
+		commit = strings.TrimSpace(string(output))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.templates, s.byKey = templates, byKey
+	s.status.Templates = len(templates)
+	s.status.Commit = commit
+	s.status.IndexedAt = &now
+	return nil
+}
+
+// Load indexes the templates directory when it exists.
+func (s *Store) Load() {
+	if _, err := os.Stat(s.Dir()); err != nil {
+		return
+	}
+	if err := s.Reindex(); err != nil {
+		log.Printf("Nuclei: %v", err)
+		return
+	}
+	log.Printf("Nuclei: indexed %d templates", s.Status().Templates)
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, w := range wanted {
+		for _, v := range values {
+			if strings.EqualFold(v, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f Filter) matches(t *Template) bool {
+	if len(f.Tags) > 0 && !containsAny(t.Tags, f.Tags) {
+		return false
+	}
+	if len(f.Severities) > 0 && !containsAny([]string{t.Severity}, f.Severities) {
+		return false
+	}
+	if q := strings.ToLower(strings.TrimSpace(f.Query)); q != "" {
+		return strings.Contains(strings.ToLower(t.ID), q) ||
+			strings.Contains(strings.ToLower(t.Name), q) ||
+			strings.Contains(strings.ToLower(t.Path), q)
+	}
+	return true
+}
+
+// Search returns the page of templates matching filter and the number of
+// matches.
+func (s *Store) Search(filter Filter) ([]Template, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := make([]Template, 0)
+	for i := range s.templates {
+		if filter.matches(&s.templates[i]) {
+			matched = append(matched, s.templates[i])
+		}
+	}
+	total := len(matched)
+	if filter.Offset >= total {
+		return []Template{}, total
+	}
+	end := total
+	if filter.Limit > 0 && filter.Offset+filter.Limit < total {
+		end = filter.Offset + filter.Limit
+	}
+	return matched[filter.Offset:end], total
+}
+
+// Get returns a template by ID or path.
+func (s *Store) Get(key string) *Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if t, ok := s.byKey[key]; ok {
+		copied := *t
+		return &copied
+	}
+	return nil
+}
+
+// Pin resolves sel against the indexed templates into the exact template
+// paths it selects, stamped with the checkout's commit. A warning is
+// returned when sel was pinned to a different commit than the one checked
+// out.
+func (s *Store) Pin(sel Selection) (Selection, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.templates) == 0 {
+		return sel, "", fmt.Errorf("no nuclei templates are indexed; sync them first")
+	}
+
+	paths := make(map[string]bool)
+	for _, key := range sel.Templates {
+		t, ok := s.byKey[strings.TrimPrefix(filepath.ToSlash(key), "/")]
+		if !ok {
+			return sel, "", fmt.Errorf("template %q not found", key)
+		}
+		paths[t.Path] = true
+	}
+	if len(sel.Tags) > 0 || len(sel.Severities) > 0 {
+		filter := Filter{Tags: sel.Tags, Severities: sel.Severities}
+		for i := range s.templates {
+			if filter.matches(&s.templates[i]) {
+				paths[s.templates[i].Path] = true
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return sel, "", fmt.Errorf("the selection matches no templates")
+	}
+
+	pinned := Selection{Templates: make([]string, 0, len(paths)), Commit: s.status.Commit}
+	for path := range paths {
+		pinned.Templates = append(pinned.Templates, path)
+	}
+	sort.Strings(pinned.Templates)
+
+	var warning string
+	if sel.Commit != "" && sel.Commit != s.status.Commit {
+		warning = fmt.Sprintf("nuclei templates were pinned at commit %s but %s is checked out", sel.Commit, s.status.Commit)
+	}
+	return pinned, warning, nil
+}
+
+// Paths returns the absolute paths of a pinned selection's templates.
+func (s *Store) Paths(sel Selection) []string {
+	dir := s.Dir()
+	paths := make([]string, 0, len(sel.Templates))
+	for _, path := range sel.Templates {
+		paths = append(paths, filepath.Join(dir, filepath.FromSlash(path)))
+	}
+	return paths
+}
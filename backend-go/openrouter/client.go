@@ -1,12 +1,20 @@
 package openrouter
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"performa-backend/config"
+	"performa-backend/credentials"
+	"performa-backend/provider"
+	"performa-backend/telemetry"
+	"strings"
+	"time"
 )
 
 const BaseURL = "https://openrouter.ai/api/v1"
@@ -17,8 +25,45 @@ type Message struct {
 }
 
 type ChatRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model    string        `json:"model"`
+	Messages []Message     `json:"messages"`
+	Stream   bool          `json:"stream,omitempty"`
+	Usage    *UsageOptions `json:"usage,omitempty"`
+	// Tools are the functions the model may call, in the OpenAI format
+	// OpenRouter takes for every model.
+	Tools []map[string]interface{} `json:"tools,omitempty"`
+	// ResponseFormat asks for a JSON response matching a schema, for the
+	// models that support structured output.
+	ResponseFormat map[string]interface{} `json:"response_format,omitempty"`
+	provider.Sampling
+}
+
+// UsageOptions asks OpenRouter to report token counts and cost with the
+// completion.
+type UsageOptions struct {
+	Include bool `json:"include"`
+}
+
+// Usage is the token count and cost, in USD, OpenRouter reports for a
+// completion.
+type Usage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// streamChunk is one server-sent event of a streamed completion.
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
 }
 
 type ChatResponse struct {
@@ -29,62 +74,352 @@ type ChatResponse struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage *Usage `json:"usage,omitempty"`
 	Error *struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
+// CallStats describes the cost of a single chat completion request. Token
+// counts and Cost stay zero for simulated responses.
+type CallStats struct {
+	Latency          time.Duration
+	BytesSent        int64
+	BytesReceived    int64
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+}
+
+func (stats *CallStats) addUsage(usage *Usage) {
+	if usage == nil {
+		return
+	}
+	stats.PromptTokens = usage.PromptTokens
+	stats.CompletionTokens = usage.CompletionTokens
+	stats.Cost = usage.Cost
+}
+
 func Chat(messages []Message, model string) (string, error) {
-	if config.AppConfig.OpenRouterAPIKey == "" || config.AppConfig.OpenRouterAPIKey == "your_key" {
-		return simulateResponse(messages, model), nil
+	content, _, err := ChatMetered(messages, model)
+	return content, err
+}
+
+// ChatWithKey is Chat with an explicit API key instead of a stored one, used to
+// test a key before it is saved.
+func ChatWithKey(messages []Message, model, apiKey string) (string, error) {
+	var stats CallStats
+	return chat(messages, model, apiKey, &stats)
+}
+
+// ChatMetered behaves like Chat and also reports latency and bytes transferred.
+func ChatMetered(messages []Message, model string) (string, CallStats, error) {
+	return ChatMeteredWithCredential(messages, model, "")
+}
+
+// ChatMeteredWithCredential is ChatMetered authenticated with the stored
+// credential credentialID, or the provider default when it is empty or unknown.
+func ChatMeteredWithCredential(messages []Message, model, credentialID string) (string, CallStats, error) {
+	return ChatMeteredWithSampling(messages, model, credentialID, provider.Sampling{})
+}
+
+// ChatMeteredWithSampling is ChatMeteredWithCredential with the sampling
+// parameters of the completion set.
+func ChatMeteredWithSampling(messages []Message, model, credentialID string, sampling provider.Sampling) (string, CallStats, error) {
+	var stats CallStats
+	start := time.Now()
+	content, _, err := complete(ChatRequest{Model: model, Messages: messages, Sampling: sampling}, apiKey(credentialID), &stats)
+	stats.Latency = time.Since(start)
+	return content, stats, err
+}
+
+// ChatToolsMeteredWithSampling is ChatMeteredWithSampling offering the model
+// tools to call. The calls it makes are returned normalized, next to whatever
+// text it answered with.
+func ChatToolsMeteredWithSampling(messages []Message, model, credentialID string, tools []provider.ToolSchema, sampling provider.Sampling) (string, []provider.ToolCall, CallStats, error) {
+	var stats CallStats
+	encoded, err := provider.EncodeTools(provider.OpenRouter, tools)
+	if err != nil {
+		return "", nil, stats, err
 	}
+	start := time.Now()
+	content, calls, err := complete(ChatRequest{Model: model, Messages: messages, Tools: encoded, Sampling: sampling}, apiKey(credentialID), &stats)
+	stats.Latency = time.Since(start)
+	return content, calls, stats, err
+}
 
-	reqBody := ChatRequest{
-		Model:    model,
-		Messages: messages,
+// ChatStructuredWithSampling is ChatMeteredWithSampling asking the model for
+// a JSON object matching schema. Models without structured output ignore the
+// request, so the response must still be validated.
+func ChatStructuredWithSampling(messages []Message, model, credentialID string, schema provider.JSONSchema, sampling provider.Sampling) (string, CallStats, error) {
+	var stats CallStats
+	format, err := provider.EncodeResponseFormat(provider.OpenRouter, schema)
+	if err != nil {
+		return "", stats, err
 	}
+	start := time.Now()
+	content, _, err := complete(ChatRequest{Model: model, Messages: messages, ResponseFormat: format, Sampling: sampling}, apiKey(credentialID), &stats)
+	stats.Latency = time.Since(start)
+	return content, stats, err
+}
+
+// ChatStreamMetered is ChatMetered with the completion streamed: onDelta is
+// called with each piece of content as it arrives, and the full response is
+// returned at the end.
+func ChatStreamMetered(messages []Message, model string, onDelta func(string)) (string, CallStats, error) {
+	return ChatStreamMeteredWithCredential(messages, model, "", onDelta)
+}
 
-	jsonBody, err := json.Marshal(reqBody)
+// ChatStreamMeteredWithCredential is ChatStreamMetered authenticated like
+// ChatMeteredWithCredential.
+func ChatStreamMeteredWithCredential(messages []Message, model, credentialID string, onDelta func(string)) (string, CallStats, error) {
+	return ChatStreamMeteredWithSampling(messages, model, credentialID, provider.Sampling{}, onDelta)
+}
+
+// ChatStreamMeteredWithSampling is ChatStreamMeteredWithCredential with the
+// sampling parameters of the completion set.
+func ChatStreamMeteredWithSampling(messages []Message, model, credentialID string, sampling provider.Sampling, onDelta func(string)) (string, CallStats, error) {
+	var stats CallStats
+	start := time.Now()
+	content, err := chatStream(messages, model, apiKey(credentialID), sampling, onDelta, &stats)
+	stats.Latency = time.Since(start)
+	return content, stats, err
+}
+
+// apiKey picks the OpenRouter key for a request: a stored credential when one
+// applies, otherwise OPENROUTER_API_KEY.
+func apiKey(credentialID string) string {
+	if key := credentials.Default.Resolve("openrouter", credentialID); key != "" {
+		return key
+	}
+	return config.AppConfig.OpenRouterAPIKey
+}
+
+// Configured reports whether a real API key is available for credentialID;
+// without one, chat calls return simulated responses.
+func Configured(credentialID string) bool {
+	return !simulated(apiKey(credentialID))
+}
+
+// ErrNotConfigured is returned by CheckKey when no real API key is set.
+var ErrNotConfigured = errors.New("no OpenRouter API key configured")
+
+// ErrRateLimited is wrapped by the errors of calls OpenRouter refused with
+// status 429.
+var ErrRateLimited = errors.New("OpenRouter rate limit exceeded")
+
+// CheckKey asks OpenRouter whether the key for credentialID is accepted,
+// without spending a completion.
+func CheckKey(ctx context.Context, credentialID string) error {
+	key := apiKey(credentialID)
+	if simulated(key) {
+		return ErrNotConfigured
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", BaseURL+"/auth/key", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: status %d", ErrRateLimited, resp.StatusCode)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("API key rejected: status %d", resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("API error: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func simulated(apiKey string) bool {
+	return apiKey == "" || apiKey == "your_key"
+}
+
+func newChatRequest(body ChatRequest, apiKey string) (*http.Request, []byte, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", BaseURL+"/chat/completions", bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.AppConfig.OpenRouterAPIKey)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
 	req.Header.Set("HTTP-Referer", "https://performa.ai")
 	req.Header.Set("X-Title", "Performa AI Agent")
+	return req, jsonBody, nil
+}
+
+// startChatSpan traces a chat completion request sent to OpenRouter. Trace
+// context is not propagated to the provider.
+func startChatSpan(model string, stream bool, sampling provider.Sampling) *telemetry.Span {
+	_, span := telemetry.Start(context.Background(), "chat "+model, telemetry.SpanClient)
+	span.SetAttribute("gen_ai.operation.name", "chat")
+	span.SetAttribute("gen_ai.system", "openrouter")
+	span.SetAttribute("gen_ai.request.model", model)
+	span.SetAttribute("performa.llm.stream", stream)
+	if sampling.Temperature != nil {
+		span.SetAttribute("gen_ai.request.temperature", *sampling.Temperature)
+	}
+	if sampling.TopP != nil {
+		span.SetAttribute("gen_ai.request.top_p", *sampling.TopP)
+	}
+	if sampling.MaxTokens > 0 {
+		span.SetAttribute("gen_ai.request.max_tokens", sampling.MaxTokens)
+	}
+	return span
+}
+
+func endChatSpan(span *telemetry.Span, stats *CallStats, err error) {
+	span.SetAttribute("gen_ai.usage.input_tokens", stats.PromptTokens)
+	span.SetAttribute("gen_ai.usage.output_tokens", stats.CompletionTokens)
+	span.SetAttribute("performa.llm.cost", stats.Cost)
+	span.SetAttribute("performa.llm.bytes_sent", stats.BytesSent)
+	span.SetAttribute("performa.llm.bytes_received", stats.BytesReceived)
+	span.End(err)
+}
+
+func chatStream(messages []Message, model, apiKey string, sampling provider.Sampling, onDelta func(string), stats *CallStats) (_ string, err error) {
+	if simulated(apiKey) {
+		content := simulateResponse(messages, model)
+		onDelta(content)
+		return content, nil
+	}
+	span := startChatSpan(model, true, sampling)
+	defer func() { endChatSpan(span, stats, err) }()
+
+	req, jsonBody, err := newChatRequest(ChatRequest{Model: model, Messages: messages, Stream: true, Usage: &UsageOptions{Include: true}, Sampling: sampling}, apiKey)
+	if err != nil {
+		return "", err
+	}
 
 	client := &http.Client{}
+	stats.BytesSent = int64(len(jsonBody))
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		stats.BytesReceived = int64(len(body))
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return "", fmt.Errorf("%w: %s", ErrRateLimited, string(body))
+		}
+		return "", fmt.Errorf("API error: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		stats.BytesReceived += int64(len(line)) + 1
+
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != nil {
+			return content.String(), fmt.Errorf("API error: %s", chunk.Error.Message)
+		}
+		// The last chunk before [DONE] carries the usage of the whole
+		// completion.
+		stats.addUsage(chunk.Usage)
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return content.String(), fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if content.Len() == 0 {
+		return "", fmt.Errorf("no response from model")
+	}
+	return content.String(), nil
+}
+
+func chat(messages []Message, model, apiKey string, stats *CallStats) (string, error) {
+	content, _, err := complete(ChatRequest{Model: model, Messages: messages}, apiKey, stats)
+	return content, err
+}
+
+// complete sends a completion request that is not streamed and returns the
+// text of the response with the tool calls it makes.
+func complete(request ChatRequest, apiKey string, stats *CallStats) (_ string, _ []provider.ToolCall, err error) {
+	if simulated(apiKey) {
+		if request.ResponseFormat != nil {
+			return simulateStructuredResponse(request.Model), nil, nil
+		}
+		return simulateResponse(request.Messages, request.Model), nil, nil
+	}
+	span := startChatSpan(request.Model, false, request.Sampling)
+	defer func() { endChatSpan(span, stats, err) }()
+
+	request.Usage = &UsageOptions{Include: true}
+	req, jsonBody, err := newChatRequest(request, apiKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	client := &http.Client{}
+	stats.BytesSent = int64(len(jsonBody))
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
 	body, err := io.ReadAll(resp.Body)
+	stats.BytesReceived = int64(len(body))
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", nil, fmt.Errorf("%w: %s", ErrRateLimited, string(body))
 	}
 
 	var chatResp ChatResponse
 	if err := json.Unmarshal(body, &chatResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return "", nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	if chatResp.Error != nil {
-		return "", fmt.Errorf("API error: %s", chatResp.Error.Message)
+		return "", nil, fmt.Errorf("API error: %s", chatResp.Error.Message)
 	}
+	stats.addUsage(chatResp.Usage)
 
 	if len(chatResp.Choices) == 0 {
-		return "", fmt.Errorf("no response from model")
+		return "", nil, fmt.Errorf("no response from model")
 	}
 
-	return chatResp.Choices[0].Message.Content, nil
+	content, calls, err := provider.DecodeResponse(provider.OpenRouter, body)
+	if err != nil {
+		return "", nil, err
+	}
+	return content, calls, nil
 }
 
 func simulateResponse(messages []Message, model string) string {
@@ -105,3 +440,9 @@ This is a simulated response. To get real AI-powered security analysis, please c
 The system is functioning correctly. This simulation demonstrates the expected output format.
 `, model)
 }
+
+// simulateStructuredResponse is the structured counterpart of
+// simulateResponse: a JSON object with no findings or actions.
+func simulateStructuredResponse(model string) string {
+	return fmt.Sprintf(`{"analysis": "Simulated response from %s (no API key). Set OPENROUTER_API_KEY to get real analysis.", "findings": [], "next_actions": [], "confidence": 0}`, model)
+}
@@ -0,0 +1,201 @@
+package openrouter
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// bytesPerToken approximates the tokenizers of the supported models on
+	// English text and tool output; counts err on the high side elsewhere.
+	bytesPerToken = 4
+	// messageOverheadTokens is what a message costs beyond its content: its
+	// role and the separators around it.
+	messageOverheadTokens = 4
+	// maxSummarizedMessageBytes and maxSummaryTranscriptBytes bound what is
+	// sent to the summary model, so that summarizing never overflows it.
+	maxSummarizedMessageBytes = 6000
+	maxSummaryTranscriptBytes = 240000
+)
+
+// SummaryPrefix starts the message that replaces summarized turns.
+const SummaryPrefix = "Summary of the earlier conversation"
+
+const summarySystemPrompt = `You condense the transcript of an authorized security assessment agent so that it can continue its work with less context.
+Keep every concrete fact: targets, hosts, open ports, services and versions, credentials found, vulnerabilities and their evidence, commands already run and what they showed, dead ends, and the task still in progress.
+Drop pleasantries, repetition and raw output that adds nothing. Answer with the summary only, as terse bullet points.`
+
+// EstimateTokens approximates the number of tokens text is encoded to.
+func EstimateTokens(text string) int {
+	return (len(text) + bytesPerToken - 1) / bytesPerToken
+}
+
+// MessageTokens approximates the prompt tokens a message takes.
+func MessageTokens(message Message) int {
+	return EstimateTokens(message.Content) + messageOverheadTokens
+}
+
+// CountTokens approximates the prompt tokens of a conversation.
+func CountTokens(messages []Message) int {
+	total := 0
+	for _, message := range messages {
+		total += MessageTokens(message)
+	}
+	return total
+}
+
+// ContextPolicy says how much of a model's context window a conversation may
+// fill. Once its messages exceed Threshold tokens, the older turns are
+// replaced by a summary written by SummaryModel. System messages, which hold
+// the instructions and tool schemas, and the first other message, the task,
+// are pinned and never summarized; neither are the KeepRecent latest
+// messages.
+type ContextPolicy struct {
+	Limit        int
+	Threshold    int
+	KeepRecent   int
+	SummaryModel string
+	CredentialID string
+}
+
+// Compaction is the outcome of fitting a conversation to a ContextPolicy.
+// SummaryStats is the cost of the summary request, and SummaryErr why it
+// failed; when it does, or the summary is not enough, the oldest unpinned
+// messages are dropped instead.
+type Compaction struct {
+	Messages     []Message
+	Tokens       int
+	PinnedTokens int
+	Summarized   int
+	Dropped      int
+	SummaryStats CallStats
+	SummaryErr   error
+}
+
+// pinned reports which messages FitContext keeps as they are.
+func pinned(messages []Message) []bool {
+	pins := make([]bool, len(messages))
+	taskPinned := false
+	for i, message := range messages {
+		switch {
+		case message.Role == "system":
+			pins[i] = true
+		case !taskPinned:
+			pins[i] = true
+			taskPinned = true
+		}
+	}
+	return pins
+}
+
+// FitContext returns messages compacted to stay under policy's threshold.
+// Messages under it are returned unchanged.
+func FitContext(messages []Message, policy ContextPolicy) Compaction {
+	pins := pinned(messages)
+	result := Compaction{Messages: messages, Tokens: CountTokens(messages)}
+	for i, message := range messages {
+		if pins[i] {
+			result.PinnedTokens += MessageTokens(message)
+		}
+	}
+	if policy.Threshold <= 0 || result.Tokens <= policy.Threshold {
+		return result
+	}
+
+	// The unpinned messages before the KeepRecent latest are summarized.
+	keep := policy.KeepRecent
+	if keep < 1 {
+		keep = 1
+	}
+	var older []int
+	unpinned := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		if pins[i] {
+			continue
+		}
+		if unpinned++; unpinned > keep {
+			older = append([]int{i}, older...)
+		}
+	}
+
+	if len(older) > 0 {
+		summary, stats, err := summarize(messages, older, policy)
+		result.SummaryStats = stats
+		if err != nil {
+			result.SummaryErr = err
+		} else {
+			replaced := make(map[int]bool, len(older))
+			for _, i := range older {
+				replaced[i] = true
+			}
+			compacted := make([]Message, 0, len(messages)-len(older)+1)
+			for i, message := range messages {
+				switch {
+				case i == older[0]:
+					compacted = append(compacted, Message{Role: "user", Content: SummaryPrefix + ":\n" + summary})
+				case replaced[i]:
+				default:
+					compacted = append(compacted, message)
+				}
+			}
+			result.Messages = compacted
+			result.Summarized = len(older)
+		}
+	}
+
+	// Without a summary, or when it is not enough, the oldest unpinned
+	// messages go, down to the latest one.
+	messages = result.Messages
+	tokens := CountTokens(messages)
+	pins = pinned(messages)
+	for tokens > policy.Threshold {
+		drop := -1
+		for i := range messages {
+			if !pins[i] && i < len(messages)-1 {
+				drop = i
+				break
+			}
+		}
+		if drop < 0 {
+			break
+		}
+		tokens -= MessageTokens(messages[drop])
+		messages = append(messages[:drop:drop], messages[drop+1:]...)
+		pins = append(pins[:drop:drop], pins[drop+1:]...)
+		result.Dropped++
+	}
+	result.Messages = messages
+	result.Tokens = tokens
+	return result
+}
+
+// summarize asks policy's summary model to condense the messages at indexes.
+func summarize(messages []Message, indexes []int, policy ContextPolicy) (string, CallStats, error) {
+	var transcript strings.Builder
+	for _, i := range indexes {
+		content := messages[i].Content
+		if len(content) > maxSummarizedMessageBytes {
+			content = content[:maxSummarizedMessageBytes] + "\n[...truncated]"
+		}
+		entry := fmt.Sprintf("[%s]\n%s\n\n", messages[i].Role, content)
+		if transcript.Len()+len(entry) > maxSummaryTranscriptBytes {
+			// Keep the latest turns, which matter most to what comes next.
+			transcript.Reset()
+			transcript.WriteString("[earlier turns omitted]\n\n")
+		}
+		transcript.WriteString(entry)
+	}
+
+	content, stats, err := ChatMeteredWithCredential([]Message{
+		{Role: "system", Content: summarySystemPrompt},
+		{Role: "user", Content: "Summarize this part of the conversation:\n\n" + transcript.String()},
+	}, policy.SummaryModel, policy.CredentialID)
+	if err != nil {
+		return "", stats, fmt.Errorf("summary model %s failed: %w", policy.SummaryModel, err)
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", stats, fmt.Errorf("summary model %s returned nothing", policy.SummaryModel)
+	}
+	return content, stats, nil
+}
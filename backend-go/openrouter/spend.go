@@ -0,0 +1,62 @@
+package openrouter
+
+import "sync"
+
+// Spend is what the completions charged to an account used.
+type Spend struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func (s Spend) Tokens() int64 {
+	return s.PromptTokens + s.CompletionTokens
+}
+
+// Ledger accumulates spend per account, such as an operation ID.
+type Ledger struct {
+	accounts map[string]*Spend
+	mu       sync.Mutex
+}
+
+// Spending is the ledger operations are charged to.
+var Spending = NewLedger()
+
+func NewLedger() *Ledger {
+	return &Ledger{accounts: make(map[string]*Spend)}
+}
+
+// Charge adds the usage of a call to account and returns its new total.
+func (l *Ledger) Charge(account string, stats CallStats) Spend {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	spend := l.account(account)
+	spend.Calls++
+	spend.PromptTokens += int64(stats.PromptTokens)
+	spend.CompletionTokens += int64(stats.CompletionTokens)
+	spend.CostUSD += stats.Cost
+	return *spend
+}
+
+// Get returns the spend of an account and whether it was ever charged.
+func (l *Ledger) Get(account string) (Spend, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if spend, exists := l.accounts[account]; exists {
+		return *spend, true
+	}
+	return Spend{}, false
+}
+
+// account must be called with l.mu held.
+func (l *Ledger) account(account string) *Spend {
+	spend, exists := l.accounts[account]
+	if !exists {
+		spend = &Spend{}
+		l.accounts[account] = spend
+	}
+	return spend
+}
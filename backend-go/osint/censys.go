@@ -0,0 +1,128 @@
+package osint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultCensysURL = "https://search.censys.io/api"
+
+// censysProvider calls the Censys Search v2 API. Its key is the API ID and
+// secret joined by a colon.
+type censysProvider struct {
+	baseURL string
+}
+
+type censysResponse struct {
+	Result censysHost `json:"result"`
+}
+
+type censysHost struct {
+	IP       string          `json:"ip"`
+	Services []censysService `json:"services"`
+	Location struct {
+		Country string `json:"country"`
+		City    string `json:"city"`
+	} `json:"location"`
+	AutonomousSystem struct {
+		ASN  int    `json:"asn"`
+		Name string `json:"name"`
+	} `json:"autonomous_system"`
+	OperatingSystem struct {
+		Vendor  string `json:"vendor"`
+		Product string `json:"product"`
+	} `json:"operating_system"`
+	DNS struct {
+		Names      []string `json:"names"`
+		ReverseDNS struct {
+			Names []string `json:"names"`
+		} `json:"reverse_dns"`
+	} `json:"dns"`
+	Labels        []string `json:"labels"`
+	LastUpdatedAt string   `json:"last_updated_at"`
+}
+
+type censysService struct {
+	Port                int    `json:"port"`
+	ServiceName         string `json:"service_name"`
+	ExtendedServiceName string `json:"extended_service_name"`
+	TransportProtocol   string `json:"transport_protocol"`
+	Banner              string `json:"banner"`
+	ObservedAt          string `json:"observed_at"`
+	Software            []struct {
+		Vendor  string `json:"vendor"`
+		Product string `json:"product"`
+		Version string `json:"version"`
+		URI     string `json:"uniform_resource_identifier"`
+	} `json:"software"`
+}
+
+func parseCensysTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func (p *censysProvider) lookup(ctx context.Context, c *Client, key, ip string) (*HostReport, error) {
+	id, secret, ok := strings.Cut(key, ":")
+	if !ok || id == "" || secret == "" {
+		return nil, fmt.Errorf("the key must be the API ID and secret joined by a colon")
+	}
+	data, err := c.get(ctx, Censys, p.baseURL+"/v2/hosts/"+url.PathEscape(ip), func(req *http.Request) {
+		req.SetBasicAuth(id, secret)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var response censysResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	host := response.Result
+
+	report := &HostReport{
+		Hostnames: append(host.DNS.Names, host.DNS.ReverseDNS.Names...),
+		Org:       host.AutonomousSystem.Name,
+		Country:   host.Location.Country,
+		City:      host.Location.City,
+		OS:        strings.TrimSpace(host.OperatingSystem.Vendor + " " + host.OperatingSystem.Product),
+		Tags:      host.Labels,
+		UpdatedAt: parseCensysTime(host.LastUpdatedAt),
+	}
+	if host.AutonomousSystem.ASN > 0 {
+		report.ASN = "AS" + strconv.Itoa(host.AutonomousSystem.ASN)
+	}
+	for _, entry := range host.Services {
+		service := Service{
+			Port:     entry.Port,
+			Protocol: entry.TransportProtocol,
+			Name:     strings.ToLower(entry.ServiceName),
+			Banner:   entry.Banner,
+			SeenAt:   parseCensysTime(entry.ObservedAt),
+		}
+		if service.Name == "unknown" {
+			service.Name = ""
+		}
+		// The first product named is the service's own; the rest are what
+		// it runs on.
+		for _, software := range entry.Software {
+			if service.Product == "" && software.Product != "" {
+				service.Product, service.Version = software.Product, software.Version
+			}
+			if strings.HasPrefix(software.URI, "cpe:") {
+				service.CPEs = append(service.CPEs, software.URI)
+			}
+		}
+		report.Services = append(report.Services, service)
+	}
+	return report, nil
+}
@@ -0,0 +1,443 @@
+// Package osint looks hosts up in the internet-wide scan services Shodan and
+// Censys through their APIs, normalizing what each knows about a host into
+// one report. Requests are paced to each service's rate limit, back off when
+// it answers 429, and are cached so that repeated lookups spend no quota.
+package osint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/credentials"
+)
+
+const (
+	Shodan = "shodan"
+	Censys = "censys"
+)
+
+// Providers are the services hosts can be looked up in.
+var Providers = []string{Shodan, Censys}
+
+const (
+	// maxAttempts bounds the requests of a lookup a service rate limits.
+	maxAttempts = 3
+	// maxRetryAfter caps how long a rate limited lookup waits to retry.
+	maxRetryAfter = time.Minute
+	// maxBannerBytes bounds the banner kept per service.
+	maxBannerBytes = 512
+	// maxCacheEntries bounds the cached lookups.
+	maxCacheEntries = 2000
+)
+
+var (
+	ErrNotFound = errors.New("the service has no data on this host")
+	ErrNoKey    = errors.New("no API key is configured")
+	// ErrNoProviders is returned by lookups when no provider has a key.
+	ErrNoProviders = errors.New("no OSINT provider has an API key")
+)
+
+// Service is an open port a provider saw on the host.
+type Service struct {
+	Port     int        `json:"port"`
+	Protocol string     `json:"protocol"`
+	Name     string     `json:"name,omitempty"`
+	Product  string     `json:"product,omitempty"`
+	Version  string     `json:"version,omitempty"`
+	Banner   string     `json:"banner,omitempty"`
+	CPEs     []string   `json:"cpes,omitempty"`
+	Vulns    []string   `json:"vulns,omitempty"`
+	SeenAt   *time.Time `json:"seen_at,omitempty"`
+}
+
+// HostReport is what one provider knows about an IP. Cached is set when it
+// was served from the cache, fetched at FetchedAt.
+type HostReport struct {
+	Provider  string     `json:"provider"`
+	IP        string     `json:"ip"`
+	Hostnames []string   `json:"hostnames"`
+	Org       string     `json:"org,omitempty"`
+	ISP       string     `json:"isp,omitempty"`
+	ASN       string     `json:"asn,omitempty"`
+	Country   string     `json:"country,omitempty"`
+	City      string     `json:"city,omitempty"`
+	OS        string     `json:"os,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+	Vulns     []string   `json:"vulns,omitempty"`
+	Services  []Service  `json:"services"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	FetchedAt time.Time  `json:"fetched_at"`
+	Cached    bool       `json:"cached"`
+}
+
+// Config holds the API keys used when the credentials store has none for a
+// provider, the rate each provider is called at, in requests per second,
+// and how long lookups are cached.
+type Config struct {
+	ShodanKey    string
+	ShodanURL    string
+	ShodanRate   float64
+	CensysID     string
+	CensysSecret string
+	CensysURL    string
+	CensysRate   float64
+	CacheTTL     time.Duration
+}
+
+// Options selects the providers a lookup asks, all configured ones when
+// empty, and the stored credential to use for each. Refresh skips the cache.
+type Options struct {
+	Providers   []string
+	Credentials map[string]string
+	Refresh     bool
+}
+
+// ProviderStatus says whether a provider can be used and how it is paced.
+// KeySource is "credentials" or "environment".
+type ProviderStatus struct {
+	Name           string     `json:"name"`
+	Configured     bool       `json:"configured"`
+	KeySource      string     `json:"key_source,omitempty"`
+	RatePerSecond  float64    `json:"rate_per_second"`
+	ThrottledUntil *time.Time `json:"throttled_until,omitempty"`
+}
+
+// provider is the API of one service.
+type provider interface {
+	lookup(ctx context.Context, c *Client, key, ip string) (*HostReport, error)
+}
+
+type cacheEntry struct {
+	report *HostReport
+	err    error
+	at     time.Time
+}
+
+type Client struct {
+	cfg       Config
+	providers map[string]provider
+	limiters  map[string]*limiter
+	http      *http.Client
+	cache     map[string]cacheEntry
+	mu        sync.RWMutex
+}
+
+var Default = &Client{http: &http.Client{Timeout: 30 * time.Second}}
+
+// Configure sets the client's keys, endpoints and rates.
+func (c *Client) Configure(cfg Config) {
+	if cfg.ShodanURL == "" {
+		cfg.ShodanURL = defaultShodanURL
+	}
+	if cfg.CensysURL == "" {
+		cfg.CensysURL = defaultCensysURL
+	}
+	if cfg.ShodanRate <= 0 {
+		cfg.ShodanRate = 1
+	}
+	if cfg.CensysRate <= 0 {
+		cfg.CensysRate = 0.4
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = cfg
+	c.providers = map[string]provider{
+		Shodan: &shodanProvider{baseURL: strings.TrimRight(cfg.ShodanURL, "/")},
+		Censys: &censysProvider{baseURL: strings.TrimRight(cfg.CensysURL, "/")},
+	}
+	c.limiters = map[string]*limiter{
+		Shodan: newLimiter(cfg.ShodanRate),
+		Censys: newLimiter(cfg.CensysRate),
+	}
+	c.cache = make(map[string]cacheEntry)
+}
+
+// ValidProvider reports whether name is a known provider.
+func ValidProvider(name string) bool {
+	for _, known := range Providers {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the API key of a provider: the stored credential with the
+// given ID, the provider's default stored credential, or the environment.
+func (c *Client) key(provider, credentialID string) (key, source string) {
+	if key := credentials.Default.Resolve(provider, credentialID); key != "" {
+		return key, "credentials"
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	switch provider {
+	case Shodan:
+		key = c.cfg.ShodanKey
+	case Censys:
+		if c.cfg.CensysID != "" && c.cfg.CensysSecret != "" {
+			key = c.cfg.CensysID + ":" + c.cfg.CensysSecret
+		}
+	}
+	if key == "" {
+		return "", ""
+	}
+	return key, "environment"
+}
+
+// Status reports the providers and whether each has a key.
+func (c *Client) Status() []ProviderStatus {
+	statuses := make([]ProviderStatus, 0, len(Providers))
+	for _, name := range Providers {
+		_, source := c.key(name, "")
+		c.mu.RLock()
+		status := ProviderStatus{Name: name, Configured: source != "", KeySource: source}
+		if l := c.limiters[name]; l != nil {
+			status.RatePerSecond = l.rate
+			status.ThrottledUntil = l.throttledUntil()
+		}
+		c.mu.RUnlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Configured returns the providers that have a key.
+func (c *Client) Configured(credentialIDs map[string]string) []string {
+	var configured []string
+	for _, name := range Providers {
+		if key, _ := c.key(name, credentialIDs[name]); key != "" {
+			configured = append(configured, name)
+		}
+	}
+	return configured
+}
+
+// LookupHost asks each selected provider about ip, side by side. Providers
+// that fail are left out of the reports with their error in errs; a provider
+// without data on the host is not an error.
+func (c *Client) LookupHost(ctx context.Context, ip string, opts Options) (reports []*HostReport, errs map[string]string, err error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+	ip = addr.Unmap().String()
+
+	names := opts.Providers
+	if len(names) == 0 {
+		names = c.Configured(opts.Credentials)
+		if len(names) == 0 {
+			return nil, nil, ErrNoProviders
+		}
+	}
+	for _, name := range names {
+		if !ValidProvider(name) {
+			return nil, nil, fmt.Errorf("unknown provider %q, expected one of %s", name, strings.Join(Providers, ", "))
+		}
+	}
+
+	results := make([]*HostReport, len(names))
+	failures := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i], failures[i] = c.lookup(ctx, name, ip, opts)
+		}(i, name)
+	}
+	wg.Wait()
+
+	errs = make(map[string]string)
+	for i, name := range names {
+		switch {
+		case errors.Is(failures[i], ErrNotFound):
+		case failures[i] != nil:
+			errs[name] = failures[i].Error()
+		case results[i] != nil:
+			reports = append(reports, results[i])
+		}
+	}
+	return reports, errs, nil
+}
+
+// lookup asks one provider about ip, through the cache.
+func (c *Client) lookup(ctx context.Context, name, ip string, opts Options) (*HostReport, error) {
+	key, _ := c.key(name, opts.Credentials[name])
+	if key == "" {
+		return nil, ErrNoKey
+	}
+
+	cacheKey := name + "/" + ip
+	c.mu.RLock()
+	entry, cached := c.cache[cacheKey]
+	ttl, p := c.cfg.CacheTTL, c.providers[name]
+	c.mu.RUnlock()
+	if cached && !opts.Refresh && time.Since(entry.at) < ttl {
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		report := *entry.report
+		report.Cached = true
+		return &report, nil
+	}
+
+	report, err := p.lookup(ctx, c, key, ip)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if report != nil {
+		report.Provider = name
+		report.IP = ip
+		report.FetchedAt = time.Now().UTC()
+		normalize(report)
+	}
+	if ttl > 0 {
+		c.store(cacheKey, cacheEntry{report: report, err: err, at: time.Now()})
+	}
+	return report, err
+}
+
+func (c *Client) store(key string, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= maxCacheEntries {
+		oldest := ""
+		for k, e := range c.cache {
+			if oldest == "" || e.at.Before(c.cache[oldest].at) {
+				oldest = k
+			}
+		}
+		delete(c.cache, oldest)
+	}
+	c.cache[key] = entry
+}
+
+// get makes a paced GET request to a provider and returns its body. Rate
+// limited requests are retried after the delay the service asks for, which
+// holds back every other request to it too. A 404 is ErrNotFound.
+func (c *Client) get(ctx context.Context, name, url string, setAuth func(*http.Request)) ([]byte, error) {
+	c.mu.RLock()
+	l := c.limiters[name]
+	c.mu.RUnlock()
+
+	for attempt := 1; ; attempt++ {
+		if err := l.wait(ctx); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		setAuth(req)
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			// The error names the URL, which may hold the key.
+			var urlErr *neturl.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return nil, fmt.Errorf("request failed: %v", err)
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return data, nil
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, ErrNotFound
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+			delay := retryAfter(resp.Header.Get("Retry-After"), attempt)
+			l.backoff(delay)
+			if attempt < maxAttempts {
+				continue
+			}
+			return nil, fmt.Errorf("rate limited: %s, retry after %s", resp.Status, delay.Round(time.Second))
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			return nil, fmt.Errorf("API key rejected: %s", resp.Status)
+		}
+		if len(data) > 300 {
+			data = data[:300]
+		}
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+}
+
+// retryAfter reads a Retry-After header, in seconds or as a date, falling
+// back to an exponential delay.
+func retryAfter(value string, attempt int) time.Duration {
+	delay := time.Duration(1<<attempt) * time.Second
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = time.Until(at)
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay
+}
+
+// normalize sorts and de-duplicates a report and bounds its banners.
+func normalize(report *HostReport) {
+	report.Hostnames = uniqueSorted(report.Hostnames, true)
+	report.Tags = uniqueSorted(report.Tags, false)
+	var vulns []string
+	for i := range report.Services {
+		service := &report.Services[i]
+		service.Protocol = strings.ToLower(service.Protocol)
+		if service.Protocol == "" {
+			service.Protocol = "tcp"
+		}
+		if len(service.Banner) > maxBannerBytes {
+			service.Banner = service.Banner[:maxBannerBytes]
+		}
+		service.Banner = strings.TrimSpace(service.Banner)
+		service.Vulns = uniqueSorted(service.Vulns, false)
+		vulns = append(vulns, service.Vulns...)
+	}
+	report.Vulns = uniqueSorted(append(report.Vulns, vulns...), false)
+	sort.SliceStable(report.Services, func(i, j int) bool {
+		if report.Services[i].Port != report.Services[j].Port {
+			return report.Services[i].Port < report.Services[j].Port
+		}
+		return report.Services[i].Protocol < report.Services[j].Protocol
+	})
+	if report.Services == nil {
+		report.Services = []Service{}
+	}
+	if report.Hostnames == nil {
+		report.Hostnames = []string{}
+	}
+}
+
+func uniqueSorted(values []string, lower bool) []string {
+	seen := make(map[string]bool, len(values))
+	var result []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if lower {
+			value = strings.ToLower(strings.TrimSuffix(value, "."))
+		}
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,71 @@
+package osint
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter spaces the requests to one service at its rate, and holds them
+// all back while the service has asked to be left alone.
+type limiter struct {
+	rate     float64
+	interval time.Duration
+
+	mu        sync.Mutex
+	next      time.Time
+	throttled time.Time
+}
+
+func newLimiter(rate float64) *limiter {
+	return &limiter{rate: rate, interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until the next request may be sent.
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoff holds every request back for delay.
+func (l *limiter) backoff(delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := time.Now().Add(delay)
+	if until.After(l.next) {
+		l.next = until
+	}
+	if until.After(l.throttled) {
+		l.throttled = until
+	}
+}
+
+// throttledUntil returns when the last backoff ends, if it has not yet.
+func (l *limiter) throttledUntil() *time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.throttled.After(time.Now()) {
+		until := l.throttled
+		return &until
+	}
+	return nil
+}
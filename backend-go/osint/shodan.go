@@ -0,0 +1,115 @@
+package osint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultShodanURL = "https://api.shodan.io"
+
+// shodanTimeLayout is how Shodan writes timestamps, in UTC.
+const shodanTimeLayout = "2006-01-02T15:04:05.999999"
+
+type shodanProvider struct {
+	baseURL string
+}
+
+type shodanHost struct {
+	IP         string        `json:"ip_str"`
+	Hostnames  []string      `json:"hostnames"`
+	Domains    []string      `json:"domains"`
+	Org        string        `json:"org"`
+	ISP        string        `json:"isp"`
+	ASN        string        `json:"asn"`
+	Country    string        `json:"country_name"`
+	City       string        `json:"city"`
+	OS         string        `json:"os"`
+	Tags       []string      `json:"tags"`
+	Vulns      []string      `json:"vulns"`
+	LastUpdate string        `json:"last_update"`
+	Data       []shodanEntry `json:"data"`
+}
+
+// shodanEntry is one banner Shodan collected from the host.
+type shodanEntry struct {
+	Port      int                        `json:"port"`
+	Transport string                     `json:"transport"`
+	Product   string                     `json:"product"`
+	Version   string                     `json:"version"`
+	Data      string                     `json:"data"`
+	CPE23     []string                   `json:"cpe23"`
+	CPE       []string                   `json:"cpe"`
+	Vulns     map[string]json.RawMessage `json:"vulns"`
+	Timestamp string                     `json:"timestamp"`
+	Meta      struct {
+		Module string `json:"module"`
+	} `json:"_shodan"`
+}
+
+func parseShodanTime(value string) *time.Time {
+	t, err := time.Parse(shodanTimeLayout, value)
+	if err != nil {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func (p *shodanProvider) lookup(ctx context.Context, c *Client, key, ip string) (*HostReport, error) {
+	endpoint := p.baseURL + "/shodan/host/" + url.PathEscape(ip) + "?key=" + url.QueryEscape(key)
+	data, err := c.get(ctx, Shodan, endpoint, func(*http.Request) {})
+	if err != nil {
+		return nil, err
+	}
+	var host shodanHost
+	if err := json.Unmarshal(data, &host); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+
+	report := &HostReport{
+		Hostnames: append(host.Hostnames, host.Domains...),
+		Org:       host.Org,
+		ISP:       host.ISP,
+		ASN:       host.ASN,
+		Country:   host.Country,
+		City:      host.City,
+		OS:        host.OS,
+		Tags:      host.Tags,
+		Vulns:     host.Vulns,
+		UpdatedAt: parseShodanTime(host.LastUpdate),
+	}
+	for _, entry := range host.Data {
+		service := Service{
+			Port:     entry.Port,
+			Protocol: entry.Transport,
+			Name:     shodanServiceName(entry.Meta.Module),
+			Product:  entry.Product,
+			Version:  entry.Version,
+			Banner:   entry.Data,
+			CPEs:     entry.CPE23,
+			SeenAt:   parseShodanTime(entry.Timestamp),
+		}
+		if len(service.CPEs) == 0 {
+			service.CPEs = entry.CPE
+		}
+		for cve := range entry.Vulns {
+			service.Vulns = append(service.Vulns, cve)
+		}
+		report.Services = append(report.Services, service)
+	}
+	return report, nil
+}
+
+// shodanServiceName reduces the name of the Shodan module that grabbed a
+// banner, such as "https-simple-new", to the service it speaks.
+func shodanServiceName(module string) string {
+	if i := strings.IndexByte(module, '-'); i > 0 {
+		module = module[:i]
+	}
+	return strings.ToLower(module)
+}
@@ -0,0 +1,63 @@
+package policy
+
+// BuiltinRules is the policy used when neither a policy file nor a stored
+// policy is configured. It denies commands that destroy the host rather
+// than test the target.
+var BuiltinRules = []Rule{
+	{
+		ID:          "rm-recursive-root",
+		Description: "recursive delete of the root or home directory",
+		Action:      ActionDeny,
+		Tools:       []string{"rm"},
+		Args: []ArgMatcher{
+			{Flags: []string{"-r", "-R", "--recursive"}},
+			{Value: `^(/|/\*|~|~/|~/\*|\$HOME/?)$`},
+		},
+	},
+	{
+		ID:          "rm-no-preserve-root",
+		Description: "delete with root protection disabled",
+		Action:      ActionDeny,
+		Tools:       []string{"rm"},
+		Args:        []ArgMatcher{{Flags: []string{"--no-preserve-root"}}},
+	},
+	{
+		ID:          "mkfs",
+		Description: "formats a filesystem",
+		Action:      ActionDeny,
+		Tools:       []string{"mkfs", "mkfs.*", "mke2fs", "mkswap", "wipefs"},
+	},
+	{
+		ID:          "dd-device",
+		Description: "writes directly to a block device",
+		Action:      ActionDeny,
+		Tools:       []string{"dd"},
+		Args:        []ArgMatcher{{Value: `^of=/dev/`}},
+	},
+	{
+		ID:          "chmod-world-writable",
+		Description: "makes files world writable",
+		Action:      ActionDeny,
+		Tools:       []string{"chmod"},
+		Args:        []ArgMatcher{{Value: `^0?777$|^(a|o|ugo)\+[rwx]*w`}},
+	},
+	{
+		ID:          "power",
+		Description: "reboots or powers off the host",
+		Action:      ActionDeny,
+		Tools:       []string{"reboot", "shutdown", "halt", "poweroff"},
+	},
+	{
+		ID:          "init-runlevel",
+		Description: "changes the host runlevel",
+		Action:      ActionDeny,
+		Tools:       []string{"init", "telinit"},
+		Args:        []ArgMatcher{{Value: `^[06]$`}},
+	},
+	{
+		ID:          "fork-bomb",
+		Description: "fork bomb",
+		Action:      ActionDeny,
+		Pattern:     `:\s*\(\s*\)\s*\{.*:\s*\|\s*:`,
+	},
+}
@@ -0,0 +1,382 @@
+// Package policy decides whether agent commands may run. A policy is an
+// ordered list of allow and deny rules; the first rule matching a command
+// decides it, and commands no rule matches are allowed.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"performa-backend/database"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule actions.
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// ArgMatcher matches a command's arguments. With Flags set it requires one
+// of the flags to be present and, if Value is set, the flag's value to match
+// it. Without Flags, Value must match one of the arguments.
+type ArgMatcher struct {
+	Flags []string `json:"flags,omitempty" yaml:"flags,omitempty"`
+	Value string   `json:"value,omitempty" yaml:"value,omitempty"`
+
+	value *regexp.Regexp
+}
+
+// Rule allows or denies the commands it matches. A command matches when its
+// tool is one of Tools (glob patterns, any tool if empty), the whole command
+// line matches Pattern, and every matcher in Args matches.
+type Rule struct {
+	ID          string       `json:"id" yaml:"id"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+	Action      string       `json:"action" yaml:"action"`
+	Tools       []string     `json:"tools,omitempty" yaml:"tools,omitempty"`
+	Pattern     string       `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Args        []ArgMatcher `json:"args,omitempty" yaml:"args,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// File is the layout of a YAML policy file.
+type File struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Compile validates rules and prepares their regular expressions. It
+// returns compiled copies, leaving the input untouched.
+func Compile(rules []Rule) ([]Rule, error) {
+	compiled := make([]Rule, len(rules))
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		if rule.ID == "" {
+			rule.ID = fmt.Sprintf("rule-%d", i+1)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("duplicate rule id %q", rule.ID)
+		}
+		seen[rule.ID] = true
+
+		rule.Action = strings.ToLower(strings.TrimSpace(rule.Action))
+		if rule.Action != ActionAllow && rule.Action != ActionDeny {
+			return nil, fmt.Errorf("rule %s: action must be %q or %q", rule.ID, ActionAllow, ActionDeny)
+		}
+		if len(rule.Tools) == 0 && rule.Pattern == "" && len(rule.Args) == 0 {
+			return nil, fmt.Errorf("rule %s: needs tools, a pattern or argument matchers", rule.ID)
+		}
+		for _, tool := range rule.Tools {
+			if _, err := path.Match(tool, ""); err != nil {
+				return nil, fmt.Errorf("rule %s: bad tool pattern %q", rule.ID, tool)
+			}
+		}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: bad pattern: %v", rule.ID, err)
+			}
+			rule.pattern = re
+		}
+
+		args := make([]ArgMatcher, len(rule.Args))
+		for j, matcher := range rule.Args {
+			if len(matcher.Flags) == 0 && matcher.Value == "" {
+				return nil, fmt.Errorf("rule %s: argument matcher %d is empty", rule.ID, j+1)
+			}
+			if matcher.Value != "" {
+				re, err := regexp.Compile(matcher.Value)
+				if err != nil {
+					return nil, fmt.Errorf("rule %s: bad argument value: %v", rule.ID, err)
+				}
+				matcher.value = re
+			}
+			args[j] = matcher
+		}
+		rule.Args = args
+		compiled[i] = rule
+	}
+	return compiled, nil
+}
+
+// Parse reads a YAML (or JSON) policy document.
+func Parse(data []byte) ([]Rule, error) {
+	var file File
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+	return Compile(file.Rules)
+}
+
+// match reports whether the rule matches the simple command and, if so,
+// what matched.
+func (r *Rule) match(line, tool string, args []string) ([]string, bool) {
+	var why []string
+	if len(r.Tools) > 0 {
+		matched := false
+		for _, pattern := range r.Tools {
+			if ok, _ := path.Match(pattern, tool); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, false
+		}
+		why = append(why, "tool "+tool)
+	}
+	if r.pattern != nil {
+		if !r.pattern.MatchString(line) {
+			return nil, false
+		}
+		why = append(why, fmt.Sprintf("command matches /%s/", r.Pattern))
+	}
+
+	flags := expandFlags(args)
+	for _, matcher := range r.Args {
+		reason, ok := matcher.match(args, flags)
+		if !ok {
+			return nil, false
+		}
+		why = append(why, reason)
+	}
+	return why, true
+}
+
+func (m *ArgMatcher) match(args []string, flags map[string]bool) (string, bool) {
+	if len(m.Flags) == 0 {
+		for _, arg := range args {
+			if m.value.MatchString(arg) {
+				return fmt.Sprintf("argument %q matches /%s/", arg, m.Value), true
+			}
+		}
+		return "", false
+	}
+
+	for _, flag := range m.Flags {
+		if !flags[flag] {
+			continue
+		}
+		if m.value == nil {
+			return "flag " + flag, true
+		}
+		for _, value := range flagValues(args, flag) {
+			if m.value.MatchString(value) {
+				return fmt.Sprintf("flag %s value %q matches /%s/", flag, value, m.Value), true
+			}
+		}
+	}
+	return "", false
+}
+
+// flagValues returns the values given to flag, either as --flag=value or as
+// the following argument.
+func flagValues(args []string, flag string) []string {
+	var values []string
+	for i, arg := range args {
+		if value, ok := strings.CutPrefix(arg, flag+"="); ok {
+			values = append(values, value)
+		} else if arg == flag && i+1 < len(args) {
+			values = append(values, args[i+1])
+		}
+	}
+	return values
+}
+
+var actionVerbs = map[string]string{ActionAllow: "allowed", ActionDeny: "denied"}
+
+// Decision explains the outcome of evaluating a command.
+type Decision struct {
+	Command string   `json:"command"`
+	Allowed bool     `json:"allowed"`
+	Tokens  []string `json:"tokens"`
+	Tool    string   `json:"tool,omitempty"`
+	RuleID  string   `json:"rule_id,omitempty"`
+	Source  string   `json:"source"`
+	Reason  string   `json:"reason"`
+	Matched []string `json:"matched,omitempty"`
+}
+
+// Store holds the active global policy.
+type Store struct {
+	rules  []Rule
+	source string
+	mu     sync.RWMutex
+}
+
+var Default = &Store{}
+
+func init() {
+	rules, err := Compile(BuiltinRules)
+	if err != nil {
+		panic(err)
+	}
+	Default.rules = rules
+	Default.source = "builtin"
+}
+
+// Rules returns the active rules and where they came from: "builtin", the
+// policy file path, "database", or "api" when set without a database.
+func (s *Store) Rules() ([]Rule, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Rule(nil), s.rules...), s.source
+}
+
+// LoadFile replaces the built-in rules with those in a YAML policy file.
+func (s *Store) LoadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	rules, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.source = filename
+	s.mu.Unlock()
+	return nil
+}
+
+// Replace validates and installs rules as the global policy and saves them
+// to the database, where they take precedence over the policy file.
+func (s *Store) Replace(rules []Rule) ([]Rule, error) {
+	compiled, err := Compile(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	source := "api"
+	if database.DB != nil {
+		data, _ := json.Marshal(compiled)
+		if err := database.SaveCommandPolicy(data); err != nil {
+			return nil, fmt.Errorf("failed to save policy: %v", err)
+		}
+		source = "database"
+	}
+
+	s.mu.Lock()
+	s.rules = compiled
+	s.source = source
+	s.mu.Unlock()
+	return compiled, nil
+}
+
+// Load restores a policy saved through Replace from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	data, err := database.GetCommandPolicy()
+	if err != nil {
+		log.Printf("Policy: failed to load command policy: %v", err)
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		log.Printf("Policy: stored command policy is invalid: %v", err)
+		return
+	}
+	compiled, err := Compile(rules)
+	if err != nil {
+		log.Printf("Policy: stored command policy is invalid: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.rules = compiled
+	s.source = "database"
+	s.mu.Unlock()
+	log.Printf("Policy: loaded %d command rules from database", len(compiled))
+}
+
+// Evaluate decides whether command may run. Operation rules are checked
+// before the global policy, so an operation can allow what the policy denies
+// and vice versa. A command line with several simple commands is denied if
+// any of them is.
+func (s *Store) Evaluate(command string, operation []Rule) Decision {
+	decision := Decision{Command: command, Allowed: true, Source: "default"}
+
+	operation, err := Compile(operation)
+	if err != nil {
+		decision.Allowed = false
+		decision.Source = "operation"
+		decision.Reason = "invalid operation policy: " + err.Error()
+		return decision
+	}
+
+	tokens, err := Tokenize(command)
+	if err != nil {
+		decision.Allowed = false
+		decision.Reason = err.Error()
+		return decision
+	}
+	decision.Tokens = tokens
+
+	s.mu.RLock()
+	global := s.rules
+	s.mu.RUnlock()
+
+	commands := simpleCommands(tokens)
+	if len(commands) == 0 {
+		decision.Allowed = false
+		decision.Reason = "empty command"
+		return decision
+	}
+
+	var allowed *Decision
+	for _, words := range commands {
+		tool, args := unwrap(words)
+
+		current := Decision{Command: command, Allowed: true, Tokens: tokens, Tool: tool, Source: "default",
+			Reason: "no rule matched"}
+		for _, set := range []struct {
+			source string
+			rules  []Rule
+		}{{"operation", operation}, {"policy", global}} {
+			if rule, why := firstMatch(set.rules, command, tool, args); rule != nil {
+				current.Allowed = rule.Action == ActionAllow
+				current.RuleID = rule.ID
+				current.Source = set.source
+				current.Matched = why
+				current.Reason = fmt.Sprintf("%s by rule %s", actionVerbs[rule.Action], rule.ID)
+				if rule.Description != "" {
+					current.Reason += ": " + rule.Description
+				}
+				break
+			}
+		}
+		if !current.Allowed {
+			return current
+		}
+		if allowed == nil || (allowed.RuleID == "" && current.RuleID != "") {
+			allowed = &current
+		}
+	}
+	return *allowed
+}
+
+func firstMatch(rules []Rule, line, tool string, args []string) (*Rule, []string) {
+	for i := range rules {
+		if why, ok := rules[i].match(line, tool, args); ok {
+			return &rules[i], why
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// shellOperators separate the simple commands of a command line.
+var shellOperators = []string{"&&", "||", "|&", ";;", "|", ";", "&", "\n"}
+
+// Tokenize splits a command line into words the way a POSIX shell would,
+// honouring quotes and backslash escapes. Unquoted shell operators are
+// returned as tokens of their own so each simple command can be checked.
+func Tokenize(line string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	var quote rune
+	inWord, escaped := false, false
+
+	flush := func() {
+		if inWord {
+			tokens = append(tokens, current.String())
+			current.Reset()
+			inWord = false
+		}
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			flush()
+		default:
+			if op := operatorAt(runes[i:]); op != "" {
+				flush()
+				tokens = append(tokens, op)
+				i += len([]rune(op)) - 1
+				continue
+			}
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+	flush()
+	return tokens, nil
+}
+
+func operatorAt(runes []rune) string {
+	for _, op := range shellOperators {
+		if strings.HasPrefix(string(runes[:min(len(runes), 2)]), op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func isOperator(token string) bool {
+	for _, op := range shellOperators {
+		if token == op {
+			return true
+		}
+	}
+	return false
+}
+
+// simpleCommands splits tokens at shell operators.
+func simpleCommands(tokens []string) [][]string {
+	var commands [][]string
+	var current []string
+	for _, token := range tokens {
+		if isOperator(token) {
+			if len(current) > 0 {
+				commands = append(commands, current)
+			}
+			current = nil
+			continue
+		}
+		current = append(current, token)
+	}
+	if len(current) > 0 {
+		commands = append(commands, current)
+	}
+	return commands
+}
+
+// wrappers run the command that follows them; the wrapped command is the
+// one policies care about.
+var wrappers = map[string]bool{
+	"sudo": true, "doas": true, "env": true, "nohup": true, "nice": true,
+	"time": true, "exec": true, "command": true, "busybox": true,
+}
+
+// wrapperValueFlags are wrapper options that take a separate value.
+var wrapperValueFlags = map[string]bool{
+	"-u": true, "-g": true, "-C": true, "-D": true, "-h": true, "-p": true,
+	"-r": true, "-t": true, "-U": true, "-n": true,
+}
+
+// unwrap strips leading wrappers, their options and variable assignments,
+// returning the tool name and its arguments.
+func unwrap(words []string) (string, []string) {
+	for len(words) > 0 {
+		word := words[0]
+		switch {
+		case wrappers[filepath.Base(word)]:
+			words = words[1:]
+			for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+				if wrapperValueFlags[words[0]] && len(words) > 1 {
+					words = words[1:]
+				}
+				words = words[1:]
+			}
+		case strings.Contains(word, "=") && !strings.HasPrefix(word, "-") && !strings.Contains(word, "/"):
+			words = words[1:]
+		default:
+			return filepath.Base(word), words[1:]
+		}
+	}
+	return "", nil
+}
+
+// expandFlags returns the flags present in args. Combined short flags such
+// as -rf are also reported individually, so "-fr" matches a rule on "-r".
+func expandFlags(args []string) map[string]bool {
+	flags := make(map[string]bool)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			continue
+		}
+		name, _, _ := strings.Cut(arg, "=")
+		flags[name] = true
+		if !strings.HasPrefix(arg, "--") && len(arg) > 2 {
+			for _, r := range arg[1:] {
+				flags["-"+string(r)] = true
+			}
+		}
+	}
+	return flags
+}
@@ -0,0 +1,246 @@
+package presets
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+	"performa-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// Settings are the mission config fields a preset pre-fills.
+type Settings struct {
+	Category          string                `json:"category"`
+	CustomInstruction string                `json:"custom_instruction"`
+	StealthMode       bool                  `json:"stealth_mode"`
+	AggressiveLevel   int                   `json:"aggressive_level"`
+	ModelName         string                `json:"model_name"`
+	NumAgents         int                   `json:"num_agents"`
+	ExecutionDuration *int                  `json:"execution_duration"`
+	RequestedTools    []string              `json:"requested_tools"`
+	AllowedToolsOnly  bool                  `json:"allowed_tools_only"`
+	StealthOptions    models.StealthOptions `json:"stealth_options"`
+	Capabilities      models.Capabilities   `json:"capabilities"`
+}
+
+// Preset is a reusable mission setup. Built-in presets ship with the backend
+// and cannot be changed; custom presets are registered through the API.
+type Preset struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Settings    Settings  `json:"config"`
+	BuiltIn     bool      `json:"built_in"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func minutes(n int) *int {
+	return &n
+}
+
+var builtIn = []Preset{
+	{
+		ID:          "builtin:external-web-recon",
+		Name:        "External web app recon",
+		Description: "Maps an internet-facing web application: subdomains, live hosts, technologies and common misconfigurations.",
+		Settings: Settings{
+			Category:          "web",
+			CustomInstruction: "Enumerate the external attack surface of the web application. Identify subdomains, exposed services, technologies and common misconfigurations. Do not attempt exploitation.",
+			AggressiveLevel:   2,
+			NumAgents:         3,
+			ExecutionDuration: minutes(60),
+			RequestedTools:    []string{"subfinder", "amass", "httpx", "whatweb", "nuclei", "ffuf", "nmap"},
+			StealthOptions:    models.StealthOptions{UserAgentRot: true, HeaderRandom: true},
+		},
+	},
+	{
+		ID:          "builtin:internal-network-stealth",
+		Name:        "Internal network stealth",
+		Description: "Low-and-slow discovery of an internal network that avoids tripping IDS thresholds.",
+		Settings: Settings{
+			Category:          "network",
+			CustomInstruction: "Discover hosts and services on the internal network while minimising noise. Prefer slow, targeted scans over broad sweeps.",
+			StealthMode:       true,
+			AggressiveLevel:   1,
+			NumAgents:         2,
+			ExecutionDuration: minutes(120),
+			RequestedTools:    []string{"nmap", "fping", "arp-scan", "dnsrecon"},
+			AllowedToolsOnly:  true,
+			StealthOptions:    models.StealthOptions{ProxyChain: true, TimingJitter: true, DNSOverHTTPS: true, TrafficPadding: true},
+		},
+	},
+	{
+		ID:          "builtin:api-pentest",
+		Name:        "API pentest",
+		Description: "Tests a REST or GraphQL API for authentication, authorization and injection flaws.",
+		Settings: Settings{
+			Category:          "api",
+			CustomInstruction: "Test the API for broken authentication, broken object level authorization, injection and excessive data exposure. Map endpoints before testing them.",
+			AggressiveLevel:   3,
+			NumAgents:         3,
+			ExecutionDuration: minutes(90),
+			RequestedTools:    []string{"httpx", "ffuf", "nuclei", "sqlmap", "curl"},
+			StealthOptions:    models.StealthOptions{HeaderRandom: true},
+			Capabilities:      models.Capabilities{SessionHijack: true},
+		},
+	},
+}
+
+type Store struct {
+	presets map[string]*Preset
+	mu      sync.RWMutex
+}
+
+var Default = &Store{
+	presets: make(map[string]*Preset),
+}
+
+func builtInPreset(id string) *Preset {
+	for _, preset := range builtIn {
+		if preset.ID == id {
+			copied := preset
+			copied.BuiltIn = true
+			copied.Settings.RequestedTools = append([]string(nil), preset.Settings.RequestedTools...)
+			return &copied
+		}
+	}
+	return nil
+}
+
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func (s *Store) Create(name, description string, settings Settings) (*Preset, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	for _, preset := range s.GetAll() {
+		if nameKey(preset.Name) == nameKey(name) {
+			return nil, fmt.Errorf("preset %q already exists", name)
+		}
+	}
+	if settings.RequestedTools == nil {
+		settings.RequestedTools = []string{}
+	}
+
+	now := time.Now()
+	preset := &Preset{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Description: description,
+		Settings:    settings,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	s.mu.Lock()
+	s.presets[preset.ID] = preset
+	s.mu.Unlock()
+
+	s.persist(preset)
+	return preset, nil
+}
+
+// Get returns a custom preset by ID, or a built-in preset by its "builtin:" ID.
+func (s *Store) Get(id string) *Preset {
+	if preset := builtInPreset(id); preset != nil {
+		return preset
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.presets[id]
+}
+
+// GetAll returns the built-in presets followed by custom presets sorted by name.
+func (s *Store) GetAll() []*Preset {
+	all := make([]*Preset, 0, len(builtIn))
+	for _, preset := range builtIn {
+		all = append(all, builtInPreset(preset.ID))
+	}
+
+	s.mu.RLock()
+	custom := make([]*Preset, 0, len(s.presets))
+	for _, preset := range s.presets {
+		custom = append(custom, preset)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(custom, func(i, j int) bool { return nameKey(custom[i].Name) < nameKey(custom[j].Name) })
+	return append(all, custom...)
+}
+
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.presets[id]
+	delete(s.presets, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		database.DeleteConfigPreset(id)
+	}
+	return exists
+}
+
+func (s *Store) persist(preset *Preset) {
+	if database.DB == nil {
+		return
+	}
+
+	s.mu.RLock()
+	settings, _ := json.Marshal(preset.Settings)
+	record := database.ConfigPresetRecord{
+		ID:          preset.ID,
+		Name:        preset.Name,
+		Description: preset.Description,
+		Config:      settings,
+		CreatedAt:   preset.CreatedAt,
+		UpdatedAt:   preset.UpdatedAt,
+	}
+	s.mu.RUnlock()
+
+	if err := database.SaveConfigPreset(record); err != nil {
+		log.Printf("Presets: failed to persist preset %s: %v", preset.ID, err)
+	}
+}
+
+// Load restores custom presets from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllConfigPresets()
+	if err != nil {
+		log.Printf("Presets: failed to load presets: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		preset := &Preset{
+			ID:          record.ID,
+			Name:        record.Name,
+			Description: record.Description,
+			CreatedAt:   record.CreatedAt,
+			UpdatedAt:   record.UpdatedAt,
+		}
+		json.Unmarshal(record.Config, &preset.Settings)
+		if preset.Settings.RequestedTools == nil {
+			preset.Settings.RequestedTools = []string{}
+		}
+		s.presets[preset.ID] = preset
+	}
+}
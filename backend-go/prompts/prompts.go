@@ -0,0 +1,410 @@
+package prompts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"performa-backend/database"
+
+	"github.com/google/uuid"
+)
+
+const maxVersions = 50
+
+// DefaultSystemPrompt and DefaultUserPrompt are used for roles that have no
+// template of their own.
+const DefaultSystemPrompt = `You are {{.AgentName}}, a cybersecurity AI agent with the role of {{.Role}}.
+Your target is: {{.Target}}
+Category: {{.Category}}
+Operating Mode: {{.Mode}}
+Aggressive Level: {{.AggressiveLevel}}/5
+Target OS: {{.OSType}}
+Commands run on: {{.ExecutionOS}}
+{{.StealthInfo}}{{.CapabilitiesInfo}}{{.ToolsInfo}}
+
+IMPORTANT RULES:
+1. You must respect the tool restrictions. If AllowedToolsOnly is set, ONLY use the specified tools.
+2. All commands must be verified against the allowed tools list before execution.
+3. Dangerous commands (rm -rf, mkfs, chmod 777, etc.) are STRICTLY FORBIDDEN.
+4. Report all findings with severity levels (critical, high, medium, low, info), and include a CVSS v3.1 vector and CWE ID where you can determine them.
+
+Your task is to analyze the target and provide security insights based on your role.
+Be thorough but concise in your analysis.`
+
+const DefaultUserPrompt = `Analyze the target {{.Target}} and provide your findings as a {{.Role}}.`
+
+// Data is the set of variables available to prompt templates.
+type Data struct {
+	AgentName        string   `json:"agent_name"`
+	Role             string   `json:"role"`
+	Target           string   `json:"target"`
+	Category         string   `json:"category"`
+	Mode             string   `json:"mode"`
+	AggressiveLevel  int      `json:"aggressive_level"`
+	OSType           string   `json:"os_type"`
+	ExecutionOS      string   `json:"execution_os"`
+	StealthMode      bool     `json:"stealth_mode"`
+	StealthFlags     []string `json:"stealth_flags"`
+	Capabilities     []string `json:"capabilities"`
+	Tools            []string `json:"tools"`
+	AllowedToolsOnly bool     `json:"allowed_tools_only"`
+	Instructions     string   `json:"instructions"`
+
+	// Pre-formatted sections matching the default prompt.
+	StealthInfo      string `json:"stealth_info"`
+	CapabilitiesInfo string `json:"capabilities_info"`
+	ToolsInfo        string `json:"tools_info"`
+}
+
+// SampleData is used to validate templates before they are stored.
+var SampleData = Data{
+	AgentName:        "Agent-1",
+	Role:             "Scanner",
+	Target:           "example.com",
+	Category:         "web",
+	Mode:             "stealth",
+	AggressiveLevel:  2,
+	OSType:           "linux",
+	ExecutionOS:      "linux",
+	StealthMode:      true,
+	StealthFlags:     []string{"proxy_chain", "timing_jitter"},
+	Capabilities:     []string{"mitm_attacks"},
+	Tools:            []string{"nmap", "nikto"},
+	AllowedToolsOnly: true,
+	Instructions:     "Focus on exposed admin panels.",
+	StealthInfo:      "\nStealth Mode: ENABLED\n- Proxy chaining active",
+	CapabilitiesInfo: "\n- MITM attack capability",
+	ToolsInfo:        "\n\nALLOWED TOOLS ONLY: You may ONLY use these tools: nmap, nikto",
+}
+
+type Version struct {
+	Version      int       `json:"version"`
+	SystemPrompt string    `json:"system_prompt"`
+	UserPrompt   string    `json:"user_prompt"`
+	Comment      string    `json:"comment,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Template holds every version of the prompt for one agent role. Only the
+// active version is used; older versions are kept so they can be restored.
+type Template struct {
+	ID            string    `json:"id"`
+	Role          string    `json:"role"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	ActiveVersion int       `json:"active_version"`
+	Versions      []Version `json:"versions"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Active returns the version currently in use.
+func (t *Template) Active() *Version {
+	for i := range t.Versions {
+		if t.Versions[i].Version == t.ActiveVersion {
+			return &t.Versions[i]
+		}
+	}
+	return nil
+}
+
+type Store struct {
+	templates map[string]*Template
+	mu        sync.RWMutex
+}
+
+var Default = &Store{
+	templates: make(map[string]*Template),
+}
+
+// Validate parses both prompts and renders them against SampleData so that
+// unknown variables are rejected before the template is stored.
+func Validate(systemPrompt, userPrompt string) error {
+	if strings.TrimSpace(systemPrompt) == "" {
+		return fmt.Errorf("system_prompt is required")
+	}
+	if _, err := render("system_prompt", systemPrompt, SampleData); err != nil {
+		return err
+	}
+	if userPrompt != "" {
+		if _, err := render("user_prompt", userPrompt, SampleData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func render(name, text string, data Data) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+func roleKey(role string) string {
+	return strings.ToLower(strings.TrimSpace(role))
+}
+
+func (s *Store) Create(role, name, description, systemPrompt, userPrompt, comment string) (*Template, error) {
+	if roleKey(role) == "" {
+		return nil, fmt.Errorf("role is required")
+	}
+	if err := Validate(systemPrompt, userPrompt); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = role + " prompt"
+	}
+
+	now := time.Now()
+	tmpl := &Template{
+		ID:            uuid.New().String(),
+		Role:          strings.TrimSpace(role),
+		Name:          name,
+		Description:   description,
+		ActiveVersion: 1,
+		Versions: []Version{{
+			Version:      1,
+			SystemPrompt: systemPrompt,
+			UserPrompt:   userPrompt,
+			Comment:      comment,
+			CreatedAt:    now,
+		}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.mu.Lock()
+	for _, existing := range s.templates {
+		if roleKey(existing.Role) == roleKey(role) {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("a template for role %q already exists", existing.Role)
+		}
+	}
+	s.templates[tmpl.ID] = tmpl
+	s.mu.Unlock()
+
+	s.persist(tmpl)
+	return tmpl, nil
+}
+
+func (s *Store) Get(id string) *Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.templates[id]
+}
+
+// ForRole returns the template for an agent role, matched case-insensitively.
+func (s *Store) ForRole(role string) *Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, tmpl := range s.templates {
+		if roleKey(tmpl.Role) == roleKey(role) {
+			return tmpl
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetAll() []*Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	templates := make([]*Template, 0, len(s.templates))
+	for _, tmpl := range s.templates {
+		templates = append(templates, tmpl)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return roleKey(templates[i].Role) < roleKey(templates[j].Role)
+	})
+	return templates
+}
+
+// AddVersion stores new prompt text as the next version and activates it.
+// Name and description are only changed when non-empty.
+func (s *Store) AddVersion(id, name, description, systemPrompt, userPrompt, comment string) (*Template, error) {
+	if err := Validate(systemPrompt, userPrompt); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	tmpl, exists := s.templates[id]
+	if !exists {
+		s.mu.Unlock()
+		return nil, nil
+	}
+
+	next := 1
+	for _, v := range tmpl.Versions {
+		if v.Version >= next {
+			next = v.Version + 1
+		}
+	}
+	tmpl.Versions = append(tmpl.Versions, Version{
+		Version:      next,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   userPrompt,
+		Comment:      comment,
+		CreatedAt:    time.Now(),
+	})
+	if len(tmpl.Versions) > maxVersions {
+		tmpl.Versions = tmpl.Versions[len(tmpl.Versions)-maxVersions:]
+	}
+	tmpl.ActiveVersion = next
+	if name != "" {
+		tmpl.Name = name
+	}
+	if description != "" {
+		tmpl.Description = description
+	}
+	tmpl.UpdatedAt = time.Now()
+	s.mu.Unlock()
+
+	s.persist(tmpl)
+	return tmpl, nil
+}
+
+// Rollback makes an earlier version active again without discarding the
+// versions that came after it.
+func (s *Store) Rollback(id string, version int) (*Template, error) {
+	s.mu.Lock()
+	tmpl, exists := s.templates[id]
+	if !exists {
+		s.mu.Unlock()
+		return nil, nil
+	}
+
+	found := false
+	for _, v := range tmpl.Versions {
+		if v.Version == version {
+			found = true
+			break
+		}
+	}
+	if !found {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("version %d does not exist", version)
+	}
+	tmpl.ActiveVersion = version
+	tmpl.UpdatedAt = time.Now()
+	s.mu.Unlock()
+
+	s.persist(tmpl)
+	return tmpl, nil
+}
+
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.templates[id]
+	delete(s.templates, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		database.DeletePromptTemplate(id)
+	}
+	return exists
+}
+
+// Render returns the system and user prompts and the template version used, 0
+// meaning the built-in default. The template with templateID is used when it
+// exists, otherwise the one for role. A template that fails to render falls
+// back to the default so a bad prompt never stops an agent.
+func (s *Store) Render(templateID, role string, data Data) (string, string, int) {
+	systemText, userText, version := DefaultSystemPrompt, DefaultUserPrompt, 0
+
+	tmpl := s.Get(templateID)
+	if tmpl == nil {
+		tmpl = s.ForRole(role)
+	}
+	if tmpl != nil {
+		s.mu.RLock()
+		if active := tmpl.Active(); active != nil {
+			systemText, version = active.SystemPrompt, active.Version
+			if active.UserPrompt != "" {
+				userText = active.UserPrompt
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	systemPrompt, err := render("system_prompt", systemText, data)
+	if err == nil {
+		var userPrompt string
+		if userPrompt, err = render("user_prompt", userText, data); err == nil {
+			return systemPrompt, userPrompt, version
+		}
+	}
+
+	log.Printf("Prompts: template for role %s (v%d) failed to render, using default: %v", role, version, err)
+	systemPrompt, _ = render("system_prompt", DefaultSystemPrompt, data)
+	userPrompt, _ := render("user_prompt", DefaultUserPrompt, data)
+	return systemPrompt, userPrompt, 0
+}
+
+func (s *Store) persist(tmpl *Template) {
+	if database.DB == nil {
+		return
+	}
+
+	s.mu.RLock()
+	versions, _ := json.Marshal(tmpl.Versions)
+	record := database.PromptTemplateRecord{
+		ID:            tmpl.ID,
+		Role:          tmpl.Role,
+		Name:          tmpl.Name,
+		Description:   tmpl.Description,
+		ActiveVersion: tmpl.ActiveVersion,
+		Versions:      versions,
+		CreatedAt:     tmpl.CreatedAt,
+		UpdatedAt:     tmpl.UpdatedAt,
+	}
+	s.mu.RUnlock()
+
+	if err := database.SavePromptTemplate(record); err != nil {
+		log.Printf("Prompts: failed to persist template %s: %v", tmpl.ID, err)
+	}
+}
+
+// Load restores templates from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllPromptTemplates()
+	if err != nil {
+		log.Printf("Prompts: failed to load templates: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		tmpl := &Template{
+			ID:            record.ID,
+			Role:          record.Role,
+			Name:          record.Name,
+			Description:   record.Description,
+			ActiveVersion: record.ActiveVersion,
+			Versions:      []Version{},
+			CreatedAt:     record.CreatedAt,
+			UpdatedAt:     record.UpdatedAt,
+		}
+		json.Unmarshal(record.Versions, &tmpl.Versions)
+		s.templates[tmpl.ID] = tmpl
+	}
+}
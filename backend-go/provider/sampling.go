@@ -0,0 +1,38 @@
+package provider
+
+// Sampling holds the sampling parameters of a completion request. Unset
+// fields are left out of the request so the model's own defaults apply;
+// Temperature and TopP are pointers because 0 is a meaningful value.
+type Sampling struct {
+	Temperature *float64 `json:"temperature,omitempty" validate:"omitempty,min=0,max=2"`
+	TopP        *float64 `json:"top_p,omitempty" validate:"omitempty,gt=0,max=1"`
+	MaxTokens   int      `json:"max_tokens,omitempty" validate:"min=0"`
+	Stop        []string `json:"stop,omitempty" validate:"max=4,dive,required"`
+}
+
+// IsZero reports whether no parameter is set.
+func (s Sampling) IsZero() bool {
+	return s.Temperature == nil && s.TopP == nil && s.MaxTokens == 0 && len(s.Stop) == 0
+}
+
+// Or returns s with the parameters it leaves unset taken from defaults.
+func (s Sampling) Or(defaults Sampling) Sampling {
+	if s.Temperature == nil {
+		s.Temperature = defaults.Temperature
+	}
+	if s.TopP == nil {
+		s.TopP = defaults.TopP
+	}
+	if s.MaxTokens == 0 {
+		s.MaxTokens = defaults.MaxTokens
+	}
+	if len(s.Stop) == 0 {
+		s.Stop = defaults.Stop
+	}
+	return s
+}
+
+// Float returns a pointer to v, for the fields of a Sampling literal.
+func Float(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,249 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// JSONSchema is a named JSON Schema a response must match.
+type JSONSchema struct {
+	Name   string
+	Schema map[string]interface{}
+}
+
+// EncodeResponseFormat returns the response_format of a request in format
+// asking for output matching schema. Anthropic has no response format; its
+// requests carry the schema in the prompt instead.
+func EncodeResponseFormat(format Format, schema JSONSchema) (map[string]interface{}, error) {
+	switch format {
+	case OpenAI, OpenRouter:
+		// strict is left off: it requires every property to be required,
+		// which would force empty findings and actions on every turn.
+		return map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   schema.Name,
+				"strict": false,
+				"schema": schema.Schema,
+			},
+		}, nil
+	case Anthropic:
+		return nil, fmt.Errorf("%s has no structured output format", format)
+	}
+	return nil, fmt.Errorf("unknown tool format %q", format)
+}
+
+// DecodeJSON parses a structured response. Models that ignore the response
+// format tend to wrap the JSON in a fenced block, which is accepted.
+func DecodeJSON(content string) (map[string]interface{}, error) {
+	content = strings.TrimSpace(content)
+	if rest, ok := strings.CutPrefix(content, "```"); ok {
+		rest = strings.TrimPrefix(rest, "json")
+		if end := strings.LastIndex(rest, "```"); end >= 0 {
+			rest = rest[:end]
+		}
+		content = strings.TrimSpace(rest)
+	}
+	if content == "" {
+		return nil, fmt.Errorf("response is empty")
+	}
+
+	var value map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return nil, fmt.Errorf("response is not a JSON object: %w", err)
+	}
+	return value, nil
+}
+
+// Validate checks value, as decoded by encoding/json, against schema and
+// returns what does not match, each prefixed with its path. It covers the
+// keywords the response schemas use: type, enum, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// minimum and maximum.
+func Validate(schema map[string]interface{}, value interface{}) []string {
+	var problems []string
+	validate(schema, value, "$", &problems)
+	return problems
+}
+
+func validate(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			report("expected %s, got %s", strings.Join(types, " or "), typeOf(value))
+			return
+		}
+	}
+
+	if enum := enumValues(schema["enum"]); enum != nil {
+		found := false
+		for _, allowed := range enum {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("must be one of %s", joinValues(enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if min, ok := number(schema["minLength"]); ok && float64(len(v)) < min {
+			report("must be at least %g characters", min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && float64(len(v)) > max {
+			report("must be at most %g characters", max)
+		}
+
+	case float64:
+		if min, ok := number(schema["minimum"]); ok && v < min {
+			report("must be at least %g", min)
+		}
+		if max, ok := number(schema["maximum"]); ok && v > max {
+			report("must be at most %g", max)
+		}
+
+	case []interface{}:
+		if min, ok := number(schema["minItems"]); ok && float64(len(v)) < min {
+			report("must have at least %g items", min)
+		}
+		if max, ok := number(schema["maxItems"]); ok && float64(len(v)) > max {
+			report("must have at most %g items", max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validate(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				report("missing required property %q", name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := properties[name].(map[string]interface{})
+			if !ok {
+				if additional, set := schema["additionalProperties"].(bool); set && !additional {
+					report("unexpected property %q", name)
+				}
+				continue
+			}
+			validate(property, v[name], path+"."+name, problems)
+		}
+	}
+}
+
+// schemaTypes returns the types a "type" keyword allows: one name or a list.
+func schemaTypes(t interface{}) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	default:
+		return stringList(t)
+	}
+}
+
+// stringList returns a keyword's list of names, whether it was built in Go
+// as a []string or decoded from JSON as a []interface{}.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// enumValues returns the values an "enum" keyword allows.
+func enumValues(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case []string:
+		values := make([]interface{}, 0, len(v))
+		for _, s := range v {
+			values = append(values, s)
+		}
+		return values
+	}
+	return nil
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func hasType(value interface{}, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return typeOf(value) == t
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func joinValues(values []interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		encoded, _ := json.Marshal(v)
+		parts = append(parts, string(encoded))
+	}
+	return strings.Join(parts, ", ")
+}
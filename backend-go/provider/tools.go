@@ -0,0 +1,186 @@
+// Package provider adapts the function calling of the model providers to one
+// internal form: a tool is described once as a ToolSchema, encoded in the
+// format of the provider a request goes to, and the tool calls of its
+// response are decoded back into ToolCalls for the agent loop.
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Format is a provider's function-calling format.
+type Format string
+
+const (
+	// OpenAI is the Chat Completions format: tools are "function" entries and
+	// the calls come back in the message's tool_calls with their arguments
+	// as a JSON string.
+	OpenAI Format = "openai"
+	// Anthropic is the Messages format: tools carry an input_schema and the
+	// calls come back as tool_use content blocks with their input as an
+	// object.
+	Anthropic Format = "anthropic"
+	// OpenRouter takes the OpenAI format for every model it routes to, but
+	// may answer with the legacy function_call or with the arguments already
+	// decoded.
+	OpenRouter Format = "openrouter"
+)
+
+// ToolSchema describes a tool the model may call. Parameters is the JSON
+// Schema of its arguments, an object schema.
+type ToolSchema struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// ToolCall is a call the model made. Arguments is nil when the model sent
+// arguments that are not a JSON object; RawArguments keeps what it sent.
+type ToolCall struct {
+	ID           string                 `json:"id,omitempty"`
+	Name         string                 `json:"name"`
+	Arguments    map[string]interface{} `json:"arguments,omitempty"`
+	RawArguments string                 `json:"raw_arguments,omitempty"`
+}
+
+// String returns the argument key as a string, or "" when it is missing or
+// not a string.
+func (call ToolCall) String(key string) string {
+	value, _ := call.Arguments[key].(string)
+	return value
+}
+
+// EncodeTools returns schemas as the tools field of a request in format.
+func EncodeTools(format Format, schemas []ToolSchema) ([]map[string]interface{}, error) {
+	tools := make([]map[string]interface{}, 0, len(schemas))
+	for _, schema := range schemas {
+		if schema.Name == "" {
+			return nil, fmt.Errorf("tool schema without a name")
+		}
+		parameters := schema.Parameters
+		if parameters == nil {
+			parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+
+		switch format {
+		case OpenAI, OpenRouter:
+			tools = append(tools, map[string]interface{}{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":        schema.Name,
+					"description": schema.Description,
+					"parameters":  parameters,
+				},
+			})
+		case Anthropic:
+			tools = append(tools, map[string]interface{}{
+				"name":         schema.Name,
+				"description":  schema.Description,
+				"input_schema": parameters,
+			})
+		default:
+			return nil, fmt.Errorf("unknown tool format %q", format)
+		}
+	}
+	return tools, nil
+}
+
+// openAIResponse is the part of a Chat Completions response that carries
+// the content and tool calls.
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				ID       string       `json:"id"`
+				Type     string       `json:"type"`
+				Function openAICalled `json:"function"`
+			} `json:"tool_calls"`
+			FunctionCall *openAICalled `json:"function_call"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+type openAICalled struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// anthropicResponse is the part of a Messages response that carries the
+// content blocks.
+type anthropicResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		ID    string          `json:"id"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+}
+
+// DecodeResponse returns the text content and the tool calls of a response
+// body in format.
+func DecodeResponse(format Format, body []byte) (string, []ToolCall, error) {
+	switch format {
+	case OpenAI, OpenRouter:
+		var resp openAIResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return "", nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		if len(resp.Choices) == 0 {
+			return "", nil, nil
+		}
+		message := resp.Choices[0].Message
+		calls := make([]ToolCall, 0, len(message.ToolCalls))
+		for _, called := range message.ToolCalls {
+			if called.Type != "" && called.Type != "function" {
+				continue
+			}
+			calls = append(calls, newToolCall(called.ID, called.Function.Name, called.Function.Arguments))
+		}
+		if format == OpenRouter && len(calls) == 0 && message.FunctionCall != nil {
+			calls = append(calls, newToolCall("", message.FunctionCall.Name, message.FunctionCall.Arguments))
+		}
+		return message.Content, calls, nil
+
+	case Anthropic:
+		var resp anthropicResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return "", nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		var content strings.Builder
+		calls := make([]ToolCall, 0)
+		for _, block := range resp.Content {
+			switch block.Type {
+			case "text":
+				content.WriteString(block.Text)
+			case "tool_use":
+				calls = append(calls, newToolCall(block.ID, block.Name, block.Input))
+			}
+		}
+		return content.String(), calls, nil
+	}
+	return "", nil, fmt.Errorf("unknown tool format %q", format)
+}
+
+// newToolCall decodes the arguments of a call, which OpenAI sends as a JSON
+// string holding an object and Anthropic as the object itself.
+func newToolCall(id, name string, arguments json.RawMessage) ToolCall {
+	call := ToolCall{ID: id, Name: name}
+	raw := strings.TrimSpace(string(arguments))
+	var encoded string
+	if err := json.Unmarshal(arguments, &encoded); err == nil {
+		raw = strings.TrimSpace(encoded)
+	}
+	if raw == "" || raw == "null" {
+		call.Arguments = map[string]interface{}{}
+		return call
+	}
+	if err := json.Unmarshal([]byte(raw), &call.Arguments); err != nil {
+		call.Arguments = nil
+		call.RawArguments = raw
+	}
+	return call
+}
@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"encoding/json"
+	"sync"
+
+	"performa-backend/database"
+	"performa-backend/models"
+)
+
+// AgentRepo stores the latest checkpoint of each agent's run, so that a run
+// can continue after a restart. Checkpoint returns nil without an error when
+// the agent has none.
+type AgentRepo interface {
+	SaveCheckpoint(checkpoint models.AgentCheckpoint) error
+	Checkpoint(agentID string) (*models.AgentCheckpoint, error)
+	DeleteCheckpoint(agentID string) error
+}
+
+type memoryAgents struct {
+	checkpoints map[string]models.AgentCheckpoint
+	mu          sync.RWMutex
+}
+
+func NewMemoryAgents() AgentRepo {
+	return &memoryAgents{checkpoints: make(map[string]models.AgentCheckpoint)}
+}
+
+func (m *memoryAgents) SaveCheckpoint(checkpoint models.AgentCheckpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints[checkpoint.AgentID] = checkpoint
+	return nil
+}
+
+func (m *memoryAgents) Checkpoint(agentID string) (*models.AgentCheckpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	checkpoint, ok := m.checkpoints[agentID]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (m *memoryAgents) DeleteCheckpoint(agentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.checkpoints, agentID)
+	return nil
+}
+
+type databaseAgents struct{}
+
+func (databaseAgents) SaveCheckpoint(checkpoint models.AgentCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return database.SaveAgentCheckpoint(database.AgentCheckpointRecord{
+		AgentID:     checkpoint.AgentID,
+		OperationID: checkpoint.OperationID,
+		Data:        data,
+		UpdatedAt:   checkpoint.CreatedAt,
+	})
+}
+
+func (databaseAgents) Checkpoint(agentID string) (*models.AgentCheckpoint, error) {
+	record, err := database.GetAgentCheckpoint(agentID)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	var checkpoint models.AgentCheckpoint
+	if err := json.Unmarshal(record.Data, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (databaseAgents) DeleteCheckpoint(agentID string) error {
+	return database.DeleteAgentCheckpoint(agentID)
+}
@@ -0,0 +1,211 @@
+package repo
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+	"performa-backend/models"
+)
+
+// Config is a saved mission config.
+type Config struct {
+	ID                string                `json:"id"`
+	Name              string                `json:"name"`
+	Target            string                `json:"target"`
+	Category          string                `json:"category"`
+	CustomInstruction string                `json:"custom_instruction"`
+	StealthMode       bool                  `json:"stealth_mode"`
+	AggressiveLevel   int                   `json:"aggressive_level"`
+	ModelName         string                `json:"model_name"`
+	NumAgents         int                   `json:"num_agents"`
+	ExecutionDuration *int                  `json:"execution_duration"`
+	RequestedTools    []string              `json:"requested_tools"`
+	AllowedToolsOnly  bool                  `json:"allowed_tools_only"`
+	StealthOptions    models.StealthOptions `json:"stealth_options"`
+	Capabilities      models.Capabilities   `json:"capabilities"`
+	RoE               *models.RoE           `json:"roe,omitempty"`
+	OwnerID           string                `json:"owner_id,omitempty"`
+	WorkspaceID       string                `json:"workspace_id"`
+	CreatedAt         time.Time             `json:"created_at"`
+	UpdatedAt         time.Time             `json:"updated_at"`
+}
+
+// ConfigRepo stores saved mission configs. Get returns nil without an error
+// when the config does not exist; List returns the most recently updated
+// first. Query returns a page of the configs matching a filter and how many
+// match in all.
+type ConfigRepo interface {
+	Save(config *Config) error
+	Get(id string) (*Config, error)
+	List() ([]*Config, error)
+	Query(filter ListFilter) ([]*Config, int, error)
+	Delete(id string) error
+}
+
+type memoryConfigs struct {
+	configs map[string]Config
+	mu      sync.RWMutex
+}
+
+func NewMemoryConfigs() ConfigRepo {
+	return &memoryConfigs{configs: make(map[string]Config)}
+}
+
+func (m *memoryConfigs) Save(config *Config) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.configs[config.ID] = *config
+	return nil
+}
+
+func (m *memoryConfigs) Get(id string) (*Config, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	config, ok := m.configs[id]
+	if !ok {
+		return nil, nil
+	}
+	return &config, nil
+}
+
+func (m *memoryConfigs) List() ([]*Config, error) {
+	m.mu.RLock()
+	configs := make([]*Config, 0, len(m.configs))
+	for _, config := range m.configs {
+		copied := config
+		configs = append(configs, &copied)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(configs, func(i, j int) bool { return configs[i].UpdatedAt.After(configs[j].UpdatedAt) })
+	return configs, nil
+}
+
+func (m *memoryConfigs) Query(filter ListFilter) ([]*Config, int, error) {
+	m.mu.RLock()
+	all := make([]Config, 0, len(m.configs))
+	items := make([]listed, 0, len(m.configs))
+	for _, config := range m.configs {
+		all = append(all, config)
+		items = append(items, listed{
+			id:          config.ID,
+			name:        config.Name,
+			target:      config.Target,
+			category:    config.Category,
+			workspaceID: config.WorkspaceID,
+			ownerID:     config.OwnerID,
+			createdAt:   config.CreatedAt,
+			updatedAt:   config.UpdatedAt,
+		})
+	}
+	m.mu.RUnlock()
+
+	page, total := filter.page(items)
+	configs := make([]*Config, 0, len(page))
+	for _, i := range page {
+		configs = append(configs, &all[i])
+	}
+	return configs, total, nil
+}
+
+func (m *memoryConfigs) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.configs, id)
+	return nil
+}
+
+type databaseConfigs struct{}
+
+func (databaseConfigs) Save(config *Config) error {
+	tools, _ := json.Marshal(config.RequestedTools)
+	stealth, _ := json.Marshal(config.StealthOptions)
+	capabilities, _ := json.Marshal(config.Capabilities)
+	roe, _ := json.Marshal(config.RoE)
+
+	return database.SaveConfig(database.SavedConfig{
+		ID:                config.ID,
+		Name:              config.Name,
+		Target:            config.Target,
+		Category:          config.Category,
+		CustomInstruction: config.CustomInstruction,
+		StealthMode:       config.StealthMode,
+		AggressiveLevel:   config.AggressiveLevel,
+		ModelName:         config.ModelName,
+		NumAgents:         config.NumAgents,
+		ExecutionDuration: config.ExecutionDuration,
+		RequestedTools:    tools,
+		AllowedToolsOnly:  config.AllowedToolsOnly,
+		StealthOptions:    stealth,
+		Capabilities:      capabilities,
+		RoE:               roe,
+		OwnerID:           config.OwnerID,
+		WorkspaceID:       config.WorkspaceID,
+		CreatedAt:         config.CreatedAt,
+		UpdatedAt:         config.UpdatedAt,
+	})
+}
+
+func (databaseConfigs) Get(id string) (*Config, error) {
+	record, err := database.GetConfig(id)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	return configFromRecord(record), nil
+}
+
+func (databaseConfigs) List() ([]*Config, error) {
+	records, err := database.GetAllConfigs()
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]*Config, 0, len(records))
+	for i := range records {
+		configs = append(configs, configFromRecord(&records[i]))
+	}
+	return configs, nil
+}
+
+func (databaseConfigs) Query(filter ListFilter) ([]*Config, int, error) {
+	records, total, err := database.QueryConfigs(filter.query())
+	if err != nil {
+		return nil, 0, err
+	}
+	configs := make([]*Config, 0, len(records))
+	for i := range records {
+		configs = append(configs, configFromRecord(&records[i]))
+	}
+	return configs, total, nil
+}
+
+func (databaseConfigs) Delete(id string) error {
+	return database.DeleteConfig(id)
+}
+
+func configFromRecord(record *database.SavedConfig) *Config {
+	config := &Config{
+		ID:                record.ID,
+		Name:              record.Name,
+		Target:            record.Target,
+		Category:          record.Category,
+		CustomInstruction: record.CustomInstruction,
+		StealthMode:       record.StealthMode,
+		AggressiveLevel:   record.AggressiveLevel,
+		ModelName:         record.ModelName,
+		NumAgents:         record.NumAgents,
+		ExecutionDuration: record.ExecutionDuration,
+		AllowedToolsOnly:  record.AllowedToolsOnly,
+		OwnerID:           record.OwnerID,
+		WorkspaceID:       record.WorkspaceID,
+		CreatedAt:         record.CreatedAt,
+		UpdatedAt:         record.UpdatedAt,
+	}
+	json.Unmarshal(record.RequestedTools, &config.RequestedTools)
+	json.Unmarshal(record.StealthOptions, &config.StealthOptions)
+	json.Unmarshal(record.Capabilities, &config.Capabilities)
+	json.Unmarshal(record.RoE, &config.RoE)
+	return config
+}
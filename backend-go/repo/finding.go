@@ -0,0 +1,122 @@
+package repo
+
+import (
+	"encoding/json"
+
+	"performa-backend/database"
+	"performa-backend/models"
+	"performa-backend/workspaces"
+)
+
+// FindingRepo searches findings. Query returns one page matching filter, the
+// total number of matches and the number of matches per severity.
+type FindingRepo interface {
+	Query(filter models.FindingFilter) ([]*models.Finding, int, map[string]int, error)
+}
+
+type memoryFindings struct {
+	findings *models.FindingsManager
+}
+
+func NewMemoryFindings(findings *models.FindingsManager) FindingRepo {
+	return memoryFindings{findings: findings}
+}
+
+func (m memoryFindings) Query(filter models.FindingFilter) ([]*models.Finding, int, map[string]int, error) {
+	summary := severitySummary()
+	countFilter := filter
+	countFilter.Limit, countFilter.Offset = 0, 0
+	all, _ := m.findings.Query(countFilter)
+	for _, f := range all {
+		summary[string(f.Severity)]++
+	}
+
+	findings, total := m.findings.Query(filter)
+	return findings, total, summary, nil
+}
+
+type databaseFindings struct{}
+
+func (databaseFindings) Query(filter models.FindingFilter) ([]*models.Finding, int, map[string]int, error) {
+	records, total, counts, err := database.QueryFindings(toFindingQuery(filter))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	findings := make([]*models.Finding, 0, len(records))
+	for _, record := range records {
+		findings = append(findings, findingFromRecord(record))
+	}
+	summary := severitySummary()
+	for severity, count := range counts {
+		summary[severity] = count
+	}
+	return findings, total, summary, nil
+}
+
+// severitySummary returns a count per severity with every severity present.
+func severitySummary() map[string]int {
+	return map[string]int{
+		"critical": 0,
+		"high":     0,
+		"medium":   0,
+		"low":      0,
+		"info":     0,
+	}
+}
+
+func toFindingQuery(filter models.FindingFilter) database.FindingQuery {
+	severities := make([]string, 0, len(filter.Severities))
+	for _, s := range filter.Severities {
+		severities = append(severities, string(s))
+	}
+	return database.FindingQuery{
+		WorkspaceID: filter.WorkspaceID,
+		Severities:  severities,
+		Category:    filter.Category,
+		Target:      filter.Target,
+		AgentID:     filter.AgentID,
+		Status:      filter.Status,
+		Search:      filter.Search,
+		Since:       filter.Since,
+		Until:       filter.Until,
+		SortBy:      filter.SortBy,
+		SortDesc:    filter.SortDesc,
+		Limit:       filter.Limit,
+		Offset:      filter.Offset,
+	}
+}
+
+func findingFromRecord(record database.FindingRecord) *models.Finding {
+	finding := &models.Finding{
+		ID:          record.ID,
+		Title:       record.Title,
+		Description: record.Description,
+		Severity:    models.Severity(record.Severity),
+		Category:    record.Category,
+		Target:      record.Target,
+		Evidence:    record.Evidence,
+		AgentID:     record.AgentID,
+		CreatedAt:   record.CreatedAt,
+		Status:      record.Status,
+		CVSSVector:  record.CVSSVector,
+		CVSSScore:   record.CVSSScore,
+		CWE:         record.CWE,
+		OWASP:       record.OWASP,
+		Confidence:  record.Confidence,
+		Remediation: record.Remediation,
+		WorkspaceID: workspaces.Normalize(record.WorkspaceID),
+		Source:      record.Source,
+		TriagedAt:   record.TriagedAt,
+		Assignee:    record.Assignee,
+
+		Fingerprint:   models.FindingFingerprint(record.Title, record.Target),
+		SuppressionID: record.Suppression,
+	}
+	json.Unmarshal(record.Classification, &finding.Classification)
+	json.Unmarshal(record.Issues, &finding.Issues)
+	json.Unmarshal(record.Retests, &finding.Retests)
+	json.Unmarshal(record.Tags, &finding.Tags)
+	json.Unmarshal(record.RemediationDetails, &finding.RemediationDetails)
+	json.Unmarshal(record.CVEEnrichment, &finding.CVEEnrichment)
+	return finding
+}
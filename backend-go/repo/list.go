@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"performa-backend/database"
+	"performa-backend/workspaces"
+)
+
+// ListFilter selects a page of saved configs or sessions. Search matches the
+// name or target, case-insensitively; Category must match exactly, ignoring
+// case. SortBy is created_at, updated_at or name.
+type ListFilter struct {
+	WorkspaceID string
+	OwnerID     string
+	Search      string
+	Category    string
+	SortBy      string
+	SortDesc    bool
+	Limit       int
+	Offset      int
+}
+
+// listed is what a ListFilter looks at of a saved config or session.
+type listed struct {
+	id, name, target, category, workspaceID, ownerID string
+	createdAt, updatedAt                             time.Time
+}
+
+func (f ListFilter) matches(item listed) bool {
+	if f.WorkspaceID != "" && workspaces.Normalize(item.workspaceID) != f.WorkspaceID {
+		return false
+	}
+	if f.OwnerID != "" && item.ownerID != f.OwnerID {
+		return false
+	}
+	if f.Category != "" && !strings.EqualFold(item.category, f.Category) {
+		return false
+	}
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		if !strings.Contains(strings.ToLower(item.name), search) && !strings.Contains(strings.ToLower(item.target), search) {
+			return false
+		}
+	}
+	return true
+}
+
+// less orders two items by the filter's sort, ties broken by ID.
+func (f ListFilter) less(a, b listed) bool {
+	var before, after bool
+	switch f.SortBy {
+	case "created_at":
+		before, after = a.createdAt.Before(b.createdAt), b.createdAt.Before(a.createdAt)
+	case "name":
+		x, y := strings.ToLower(a.name), strings.ToLower(b.name)
+		before, after = x < y, y < x
+	default:
+		before, after = a.updatedAt.Before(b.updatedAt), b.updatedAt.Before(a.updatedAt)
+	}
+	if before == after {
+		return a.id < b.id
+	}
+	if f.SortDesc {
+		return after
+	}
+	return before
+}
+
+// page sorts the matching items of a list and returns the indexes of those
+// on the filter's page and how many matched.
+func (f ListFilter) page(items []listed) ([]int, int) {
+	matched := make([]int, 0, len(items))
+	for i, item := range items {
+		if f.matches(item) {
+			matched = append(matched, i)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return f.less(items[matched[i]], items[matched[j]]) })
+
+	total := len(matched)
+	if f.Offset >= total {
+		return []int{}, total
+	}
+	matched = matched[f.Offset:]
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[:f.Limit]
+	}
+	return matched, total
+}
+
+func (f ListFilter) query() database.SavedQuery {
+	return database.SavedQuery{
+		WorkspaceID: f.WorkspaceID,
+		OwnerID:     f.OwnerID,
+		Search:      f.Search,
+		Category:    f.Category,
+		SortBy:      f.SortBy,
+		SortDesc:    f.SortDesc,
+		Limit:       f.Limit,
+		Offset:      f.Offset,
+	}
+}
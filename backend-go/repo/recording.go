@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"encoding/json"
+	"sync"
+
+	"performa-backend/database"
+	"performa-backend/models"
+)
+
+// maxRecordedEntries bounds the in-memory recording of each agent's run; the
+// oldest entries are dropped first.
+const maxRecordedEntries = 2000
+
+// RecordingRepo stores the recording of each agent's run. Append numbers the
+// entry after the agent's last one and returns it as stored.
+type RecordingRepo interface {
+	Append(entry models.RecordedEntry) (models.RecordedEntry, error)
+	Recording(agentID string) ([]models.RecordedEntry, error)
+}
+
+type memoryRecordings struct {
+	entries map[string][]models.RecordedEntry
+	seqs    map[string]int
+	mu      sync.RWMutex
+}
+
+func NewMemoryRecordings() RecordingRepo {
+	return &memoryRecordings{
+		entries: make(map[string][]models.RecordedEntry),
+		seqs:    make(map[string]int),
+	}
+}
+
+func (m *memoryRecordings) Append(entry models.RecordedEntry) (models.RecordedEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seqs[entry.AgentID]++
+	entry.Seq = m.seqs[entry.AgentID]
+	entries := append(m.entries[entry.AgentID], entry)
+	if len(entries) > maxRecordedEntries {
+		entries = entries[len(entries)-maxRecordedEntries:]
+	}
+	m.entries[entry.AgentID] = entries
+	return entry, nil
+}
+
+func (m *memoryRecordings) Recording(agentID string) ([]models.RecordedEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make([]models.RecordedEntry, len(m.entries[agentID]))
+	copy(entries, m.entries[agentID])
+	return entries, nil
+}
+
+type databaseRecordings struct{}
+
+func (databaseRecordings) Append(entry models.RecordedEntry) (models.RecordedEntry, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+	seq, err := database.SaveAgentRecording(database.AgentRecordingRecord{
+		AgentID:     entry.AgentID,
+		OperationID: entry.OperationID,
+		Kind:        entry.Kind,
+		Data:        data,
+		CreatedAt:   entry.CreatedAt,
+	})
+	entry.Seq = seq
+	return entry, err
+}
+
+func (databaseRecordings) Recording(agentID string) ([]models.RecordedEntry, error) {
+	records, err := database.GetAgentRecording(agentID)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.RecordedEntry, 0, len(records))
+	for _, record := range records {
+		var entry models.RecordedEntry
+		if err := json.Unmarshal(record.Data, &entry); err != nil {
+			return nil, err
+		}
+		entry.Seq = record.Seq
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
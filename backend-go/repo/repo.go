@@ -0,0 +1,36 @@
+// Package repo persists configs, sessions, findings, agent checkpoints and
+// agent run recordings behind one interface per entity. Each has a database implementation and an
+// in-memory one; Init picks between them once at startup so that every
+// handler behaves the same whichever is in use.
+package repo
+
+import (
+	"performa-backend/database"
+	"performa-backend/models"
+)
+
+var (
+	Configs    ConfigRepo    = NewMemoryConfigs()
+	Sessions   SessionRepo   = NewMemorySessions()
+	Findings   FindingRepo   = NewMemoryFindings(models.Findings)
+	Agents     AgentRepo     = NewMemoryAgents()
+	Recordings RecordingRepo = NewMemoryRecordings()
+)
+
+// Init installs the database repositories when a database is connected and
+// the in-memory ones otherwise.
+func Init() {
+	if database.DB == nil {
+		Configs = NewMemoryConfigs()
+		Sessions = NewMemorySessions()
+		Findings = NewMemoryFindings(models.Findings)
+		Agents = NewMemoryAgents()
+		Recordings = NewMemoryRecordings()
+		return
+	}
+	Configs = databaseConfigs{}
+	Sessions = databaseSessions{}
+	Findings = databaseFindings{}
+	Agents = databaseAgents{}
+	Recordings = databaseRecordings{}
+}
@@ -0,0 +1,211 @@
+package repo
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+)
+
+// Session is a saved snapshot of a mission's config, agents and findings.
+type Session struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Config      interface{} `json:"config"`
+	Agents      interface{} `json:"agents"`
+	Findings    interface{} `json:"findings"`
+	OwnerID     string      `json:"owner_id,omitempty"`
+	WorkspaceID string      `json:"workspace_id"`
+	OperationID string      `json:"operation_id,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// SessionRepo stores saved sessions. Get returns nil without an error when
+// the session does not exist; List returns the most recently updated first
+// and ListByOperation the most recently created first. Query returns a page
+// of the sessions matching a filter, by the target and category of their
+// config, and how many match in all.
+type SessionRepo interface {
+	Save(session *Session) error
+	Get(id string) (*Session, error)
+	List() ([]*Session, error)
+	Query(filter ListFilter) ([]*Session, int, error)
+	ListByOperation(operationID string) ([]*Session, error)
+	Delete(id string) error
+}
+
+type memorySessions struct {
+	sessions map[string]Session
+	mu       sync.RWMutex
+}
+
+func NewMemorySessions() SessionRepo {
+	return &memorySessions{sessions: make(map[string]Session)}
+}
+
+func (m *memorySessions) Save(session *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session.ID] = *session
+	return nil
+}
+
+func (m *memorySessions) Get(id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (m *memorySessions) List() ([]*Session, error) {
+	sessions := m.filter(func(*Session) bool { return true })
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt) })
+	return sessions, nil
+}
+
+func (m *memorySessions) ListByOperation(operationID string) ([]*Session, error) {
+	sessions := m.filter(func(s *Session) bool { return s.OperationID == operationID })
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+func (m *memorySessions) Query(filter ListFilter) ([]*Session, int, error) {
+	sessions := m.filter(func(*Session) bool { return true })
+	items := make([]listed, 0, len(sessions))
+	for _, session := range sessions {
+		target, category := sessionTarget(session)
+		items = append(items, listed{
+			id:          session.ID,
+			name:        session.Name,
+			target:      target,
+			category:    category,
+			workspaceID: session.WorkspaceID,
+			ownerID:     session.OwnerID,
+			createdAt:   session.CreatedAt,
+			updatedAt:   session.UpdatedAt,
+		})
+	}
+
+	page, total := filter.page(items)
+	paged := make([]*Session, 0, len(page))
+	for _, i := range page {
+		paged = append(paged, sessions[i])
+	}
+	return paged, total, nil
+}
+
+// sessionTarget reads the target and category of a session's config, which
+// is a StartRequest when saved in this process and a decoded map otherwise.
+func sessionTarget(session *Session) (string, string) {
+	var config struct {
+		Target   string `json:"target"`
+		Category string `json:"category"`
+	}
+	if raw, err := json.Marshal(session.Config); err == nil {
+		json.Unmarshal(raw, &config)
+	}
+	return config.Target, config.Category
+}
+
+func (m *memorySessions) filter(keep func(*Session) bool) []*Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		copied := session
+		if keep(&copied) {
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions
+}
+
+func (m *memorySessions) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+type databaseSessions struct{}
+
+func (databaseSessions) Save(session *Session) error {
+	config, _ := json.Marshal(session.Config)
+	agents, _ := json.Marshal(session.Agents)
+	findings, _ := json.Marshal(session.Findings)
+
+	return database.SaveSession(database.SavedSession{
+		ID:          session.ID,
+		Name:        session.Name,
+		Config:      config,
+		Agents:      agents,
+		Findings:    findings,
+		OwnerID:     session.OwnerID,
+		WorkspaceID: session.WorkspaceID,
+		OperationID: session.OperationID,
+		CreatedAt:   session.CreatedAt,
+		UpdatedAt:   session.UpdatedAt,
+	})
+}
+
+func (databaseSessions) Get(id string) (*Session, error) {
+	record, err := database.GetSession(id)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	return sessionFromRecord(record), nil
+}
+
+func (databaseSessions) List() ([]*Session, error) {
+	return sessionsFromRecords(database.GetAllSessions())
+}
+
+func (databaseSessions) ListByOperation(operationID string) ([]*Session, error) {
+	return sessionsFromRecords(database.GetOperationSessions(operationID))
+}
+
+func (databaseSessions) Query(filter ListFilter) ([]*Session, int, error) {
+	records, total, err := database.QuerySessions(filter.query())
+	if err != nil {
+		return nil, 0, err
+	}
+	sessions, err := sessionsFromRecords(records, nil)
+	return sessions, total, err
+}
+
+func (databaseSessions) Delete(id string) error {
+	return database.DeleteSession(id)
+}
+
+func sessionsFromRecords(records []database.SavedSession, err error) ([]*Session, error) {
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, 0, len(records))
+	for i := range records {
+		sessions = append(sessions, sessionFromRecord(&records[i]))
+	}
+	return sessions, nil
+}
+
+func sessionFromRecord(record *database.SavedSession) *Session {
+	session := &Session{
+		ID:          record.ID,
+		Name:        record.Name,
+		OwnerID:     record.OwnerID,
+		WorkspaceID: record.WorkspaceID,
+		OperationID: record.OperationID,
+		CreatedAt:   record.CreatedAt,
+		UpdatedAt:   record.UpdatedAt,
+	}
+	json.Unmarshal(record.Config, &session.Config)
+	json.Unmarshal(record.Agents, &session.Agents)
+	json.Unmarshal(record.Findings, &session.Findings)
+	return session
+}
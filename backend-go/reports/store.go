@@ -0,0 +1,134 @@
+package reports
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+
+	"github.com/google/uuid"
+)
+
+// Store keeps the uploaded report templates.
+type Store struct {
+	templates map[string]*Template
+	mu        sync.RWMutex
+}
+
+var Default = &Store{templates: make(map[string]*Template)}
+
+// Save validates a template and keeps it, as a new template when its ID is
+// empty and in place of the one with its ID otherwise.
+func (s *Store) Save(t *Template) error {
+	t.Name = strings.TrimSpace(t.Name)
+	if err := Validate(t); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	if existing, ok := s.templates[t.ID]; ok {
+		t.CreatedAt = existing.CreatedAt
+	} else {
+		t.ID = uuid.New().String()
+		t.CreatedAt = now
+	}
+	t.BuiltIn = false
+	t.UpdatedAt = now
+	s.templates[t.ID] = t
+	s.mu.Unlock()
+
+	s.persist(t)
+	return nil
+}
+
+// Get returns the template with the given ID, the built-in one included, or
+// nil.
+func (s *Store) Get(id string) *Template {
+	if id == DefaultTemplateID {
+		return DefaultTemplate
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.templates[id]
+}
+
+// List returns the built-in template followed by those of a workspace by
+// name.
+func (s *Store) List(workspaceID string) []*Template {
+	s.mu.RLock()
+	list := make([]*Template, 0)
+	for _, t := range s.templates {
+		if t.WorkspaceID == workspaceID {
+			list = append(list, t)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+	return append([]*Template{DefaultTemplate}, list...)
+}
+
+// Delete removes a template; the built-in one cannot be.
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.templates[id]
+	delete(s.templates, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		if err := database.DeleteReportTemplate(id); err != nil {
+			log.Printf("Reports: failed to delete template %s: %v", id, err)
+		}
+	}
+	return exists
+}
+
+func (s *Store) persist(t *Template) {
+	if database.DB == nil {
+		return
+	}
+	s.mu.RLock()
+	data, err := json.Marshal(t)
+	s.mu.RUnlock()
+	if err != nil {
+		return
+	}
+	record := database.ReportTemplateRecord{
+		ID:          t.ID,
+		WorkspaceID: t.WorkspaceID,
+		Data:        data,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
+	if err := database.SaveReportTemplate(record); err != nil {
+		log.Printf("Reports: failed to persist template %s: %v", t.ID, err)
+	}
+}
+
+// Load restores the templates from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+	records, err := database.GetAllReportTemplates()
+	if err != nil {
+		log.Printf("Reports: failed to load templates: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		var t Template
+		if err := json.Unmarshal(record.Data, &t); err != nil {
+			log.Printf("Reports: skipping template %s: %v", record.ID, err)
+			continue
+		}
+		s.templates[t.ID] = &t
+	}
+}
@@ -0,0 +1,103 @@
+package reports
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+)
+
+const (
+	// SummaryDraft is a generated or edited summary waiting for review.
+	SummaryDraft = "draft"
+	// SummaryApproved is a reviewed summary, included in the reports of its
+	// operation.
+	SummaryApproved = "approved"
+)
+
+// Summary is the executive summary and risk narrative of an operation's
+// report. It is generated by a model as a draft, which reviewers edit and
+// approve before reports include it.
+type Summary struct {
+	OperationID      string     `json:"operation_id"`
+	WorkspaceID      string     `json:"workspace_id"`
+	ExecutiveSummary string     `json:"executive_summary"`
+	RiskNarrative    string     `json:"risk_narrative"`
+	Status           string     `json:"status"`
+	Model            string     `json:"model,omitempty"`
+	Edited           bool       `json:"edited"`
+	GeneratedAt      time.Time  `json:"generated_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	ReviewedBy       string     `json:"reviewed_by,omitempty"`
+	ReviewedAt       *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// SummaryStore keeps the summary of each operation.
+type SummaryStore struct {
+	summaries map[string]*Summary
+	mu        sync.RWMutex
+}
+
+var Summaries = &SummaryStore{summaries: make(map[string]*Summary)}
+
+// Get returns a copy of the operation's summary, or nil.
+func (s *SummaryStore) Get(operationID string) *Summary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	summary, ok := s.summaries[operationID]
+	if !ok {
+		return nil
+	}
+	copied := *summary
+	return &copied
+}
+
+// Put keeps a summary in place of the operation's previous one.
+func (s *SummaryStore) Put(summary Summary) {
+	summary.UpdatedAt = time.Now()
+	s.mu.Lock()
+	s.summaries[summary.OperationID] = &summary
+	s.mu.Unlock()
+
+	if database.DB == nil {
+		return
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return
+	}
+	record := database.ReportSummaryRecord{
+		OperationID: summary.OperationID,
+		WorkspaceID: summary.WorkspaceID,
+		Data:        data,
+		UpdatedAt:   summary.UpdatedAt,
+	}
+	if err := database.SaveReportSummary(record); err != nil {
+		log.Printf("Reports: failed to persist summary of operation %s: %v", summary.OperationID, err)
+	}
+}
+
+// Load restores the summaries from the database.
+func (s *SummaryStore) Load() {
+	if database.DB == nil {
+		return
+	}
+	records, err := database.GetAllReportSummaries()
+	if err != nil {
+		log.Printf("Reports: failed to load summaries: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		var summary Summary
+		if err := json.Unmarshal(record.Data, &summary); err != nil {
+			log.Printf("Reports: skipping summary of operation %s: %v", record.OperationID, err)
+			continue
+		}
+		s.summaries[summary.OperationID] = &summary
+	}
+}
@@ -0,0 +1,467 @@
+// Package reports renders operation reports as HTML from Go templates. A
+// workspace can upload its own templates: a report body, a cover page, a logo
+// and the colors severities are shown in; what a template leaves out comes
+// from the built-in default.
+package reports
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTemplateID names the built-in template.
+	DefaultTemplateID = "default"
+	// MaxTemplateBytes bounds the body and the cover page of a template.
+	MaxTemplateBytes = 256 << 10
+	// MaxLogoBytes bounds a template's logo.
+	MaxLogoBytes = 512 << 10
+)
+
+// Severities lists the severities from most to least severe, the order
+// reports group findings in.
+var Severities = []string{"critical", "high", "medium", "low", "info"}
+
+// DefaultColors are the severity colors of templates that set none.
+var DefaultColors = map[string]string{
+	"critical": "#7b1fa2",
+	"high":     "#c62828",
+	"medium":   "#ef6c00",
+	"low":      "#f9a825",
+	"info":     "#546e7a",
+}
+
+// logoTypes are the image types a logo may have.
+var logoTypes = map[string]bool{
+	"image/png":     true,
+	"image/jpeg":    true,
+	"image/gif":     true,
+	"image/webp":    true,
+	"image/svg+xml": true,
+}
+
+// colorPattern matches the CSS colors a severity may be given: a hex color,
+// an rgb() or hsl() function or a color name.
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3,4}|#[0-9a-fA-F]{6}|#[0-9a-fA-F]{8}|(rgb|rgba|hsl|hsla)\([0-9., %]+\)|[a-zA-Z]{3,20})$`)
+
+// Asset is a file a template embeds in the reports it renders.
+type Asset struct {
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// DataURI returns the asset as a data: URI, so that a report is a single
+// self-contained file.
+func (a *Asset) DataURI() string {
+	return "data:" + a.ContentType + ";base64," + base64.StdEncoding.EncodeToString(a.Data)
+}
+
+// Template is a report template. Body is the html/template of the report and
+// Cover that of its cover page, which the body includes with
+// {{template "cover" .}}; either falls back to the default when empty.
+type Template struct {
+	ID             string            `json:"id"`
+	WorkspaceID    string            `json:"workspace_id,omitempty"`
+	Name           string            `json:"name"`
+	Description    string            `json:"description,omitempty"`
+	Body           string            `json:"body,omitempty"`
+	Cover          string            `json:"cover,omitempty"`
+	Logo           *Asset            `json:"logo,omitempty"`
+	SeverityColors map[string]string `json:"severity_colors,omitempty"`
+	BuiltIn        bool              `json:"built_in,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// DefaultTemplate is the built-in template.
+var DefaultTemplate = &Template{
+	ID:          DefaultTemplateID,
+	Name:        "Default",
+	Description: "Cover page, severity overview and findings by severity.",
+	Body:        DefaultBody,
+	Cover:       DefaultCover,
+	BuiltIn:     true,
+}
+
+// Finding is a finding as reports show it.
+type Finding struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Severity    string    `json:"severity"`
+	Category    string    `json:"category"`
+	Target      string    `json:"target"`
+	Evidence    string    `json:"evidence"`
+	Status      string    `json:"status"`
+	CVSSScore   *float64  `json:"cvss_score,omitempty"`
+	CVSSVector  string    `json:"cvss_vector,omitempty"`
+	CWE         string    `json:"cwe_id,omitempty"`
+	Remediation string    `json:"remediation,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Justification, Approver and AcceptedUntil describe the accepted risk
+	// of a suppressed finding.
+	Justification string     `json:"justification,omitempty"`
+	Approver      string     `json:"approver,omitempty"`
+	AcceptedUntil *time.Time `json:"accepted_until,omitempty"`
+}
+
+// suppressedStatus is the status of findings suppressed as accepted risks.
+const suppressedStatus = "suppressed"
+
+// Operation is the operation a report covers.
+type Operation struct {
+	ID        string    `json:"id"`
+	Target    string    `json:"target"`
+	Status    string    `json:"status"`
+	Agents    int       `json:"agents"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SeverityCount is how many findings of a severity a report has.
+type SeverityCount struct {
+	Severity string `json:"severity"`
+	Count    int    `json:"count"`
+}
+
+// Branding is what a template brands its reports with.
+type Branding struct {
+	// Logo is the data: URI of the template's logo, empty without one.
+	Logo   template.URL
+	Colors map[string]template.CSS
+}
+
+// Data is what report templates render. Findings, Severities and Total
+// leave out the findings suppressed as accepted risks, which are listed in
+// Suppressed.
+type Data struct {
+	Title       string          `json:"title"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Operation   Operation       `json:"operation"`
+	Findings    []Finding       `json:"findings"`
+	Severities  []SeverityCount `json:"severities"`
+	Total       int             `json:"total"`
+	Suppressed  []Finding       `json:"suppressed"`
+	// ExecutiveSummary and RiskNarrative are those of the operation's
+	// approved summary, empty without one.
+	ExecutiveSummary string   `json:"executive_summary"`
+	RiskNarrative    string   `json:"risk_narrative"`
+	Branding         Branding `json:"-"`
+}
+
+// NewData returns the data of a report on an operation's findings, counting
+// them by severity and ordering them from most to least severe, with the
+// suppressed ones set apart.
+func NewData(title string, op Operation, findings []Finding) Data {
+	rank := make(map[string]int, len(Severities))
+	for i, severity := range Severities {
+		rank[severity] = i
+	}
+	level := func(f Finding) int {
+		if r, ok := rank[strings.ToLower(f.Severity)]; ok {
+			return r
+		}
+		return len(Severities)
+	}
+
+	var sorted, suppressed []Finding
+	for _, f := range findings {
+		if strings.EqualFold(f.Status, suppressedStatus) {
+			suppressed = append(suppressed, f)
+		} else {
+			sorted = append(sorted, f)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return level(sorted[i]) < level(sorted[j]) })
+	sort.SliceStable(suppressed, func(i, j int) bool { return level(suppressed[i]) < level(suppressed[j]) })
+
+	counts := make([]SeverityCount, len(Severities))
+	for i, severity := range Severities {
+		counts[i].Severity = severity
+	}
+	for _, f := range sorted {
+		if r := level(f); r < len(Severities) {
+			counts[r].Count++
+		}
+	}
+
+	return Data{
+		Title:       title,
+		GeneratedAt: time.Now(),
+		Operation:   op,
+		Findings:    sorted,
+		Severities:  counts,
+		Total:       len(sorted),
+		Suppressed:  suppressed,
+	}
+}
+
+// SampleData is what templates are validated and previewed with.
+var SampleData = sampleData()
+
+func sampleData() Data {
+	data := NewData("Security Assessment: example.com", Operation{
+		ID:        "00000000-0000-0000-0000-000000000000",
+		Target:    "example.com",
+		Status:    "completed",
+		Agents:    3,
+		CreatedAt: time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC),
+	}, []Finding{
+		{
+			ID:          "sample-1",
+			Title:       "SQL injection in login form",
+			Description: "The username parameter of /login is concatenated into a SQL query.",
+			Severity:    "critical",
+			Category:    "injection",
+			Target:      "https://example.com/login",
+			Evidence:    "sqlmap: parameter 'username' is vulnerable (boolean-based blind)",
+			Status:      "new",
+			CVSSScore:   float(9.8),
+			CVSSVector:  "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H",
+			CWE:         "CWE-89",
+			Remediation: "Use parameterized queries.",
+			CreatedAt:   time.Date(2025, 1, 6, 9, 42, 0, 0, time.UTC),
+		},
+		{
+			ID:          "sample-2",
+			Title:       "Missing Content-Security-Policy header",
+			Description: "Responses do not set a Content-Security-Policy.",
+			Severity:    "low",
+			Category:    "misconfiguration",
+			Target:      "https://example.com",
+			Evidence:    "curl -I https://example.com: no content-security-policy header",
+			Status:      "triaged",
+			CWE:         "CWE-693",
+			CreatedAt:   time.Date(2025, 1, 6, 9, 15, 0, 0, time.UTC),
+		},
+		{
+			ID:            "sample-3",
+			Title:         "TLS 1.0 enabled",
+			Description:   "The legacy endpoint still accepts TLS 1.0 connections.",
+			Severity:      "medium",
+			Category:      "crypto",
+			Target:        "legacy.example.com:443",
+			Evidence:      "sslscan: TLSv1.0 enabled",
+			Status:        suppressedStatus,
+			CreatedAt:     time.Date(2025, 1, 6, 9, 20, 0, 0, time.UTC),
+			Justification: "Required by a partner integration until its migration in Q3.",
+			Approver:      "ciso",
+			AcceptedUntil: timePtr(time.Date(2025, 9, 30, 0, 0, 0, 0, time.UTC)),
+		},
+	})
+	data.ExecutiveSummary = "The assessment of example.com found one critical and one low severity issue.\n\nThe critical SQL injection exposes the user database to unauthenticated attackers and should be fixed first."
+	data.RiskNarrative = "An attacker exploiting the login form could read and modify every account, leading to full compromise of the application."
+	return data
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// Validate checks a template's assets and colors and renders it against
+// SampleData, so that templates that do not parse or use unknown fields are
+// rejected before they are stored.
+func Validate(t *Template) error {
+	if strings.TrimSpace(t.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(t.Body) > MaxTemplateBytes || len(t.Cover) > MaxTemplateBytes {
+		return fmt.Errorf("body and cover are limited to %d bytes", MaxTemplateBytes)
+	}
+	if t.Logo != nil {
+		if !logoTypes[t.Logo.ContentType] {
+			return fmt.Errorf("logo: unsupported content type %q", t.Logo.ContentType)
+		}
+		if len(t.Logo.Data) == 0 || len(t.Logo.Data) > MaxLogoBytes {
+			return fmt.Errorf("logo: must be between 1 and %d bytes", MaxLogoBytes)
+		}
+	}
+	for severity, color := range t.SeverityColors {
+		if _, ok := DefaultColors[severity]; !ok {
+			return fmt.Errorf("severity_colors: unknown severity %q", severity)
+		}
+		if !colorPattern.MatchString(color) {
+			return fmt.Errorf("severity_colors: %s: invalid color %q", severity, color)
+		}
+	}
+	_, err := Render(t, SampleData)
+	return err
+}
+
+// Render renders data with the template.
+func Render(t *Template, data Data) ([]byte, error) {
+	data.Branding = t.branding()
+	funcs := template.FuncMap{
+		"severityColor": func(severity string) template.CSS {
+			if color, ok := data.Branding.Colors[strings.ToLower(severity)]; ok {
+				return color
+			}
+			return data.Branding.Colors["info"]
+		},
+		"upper":      strings.ToUpper,
+		"paragraphs": paragraphs,
+		"date": func(t time.Time) string {
+			return t.Format("January 2, 2006")
+		},
+		"datetime": func(t time.Time) string {
+			return t.Format("2006-01-02 15:04 MST")
+		},
+	}
+
+	body, cover := t.Body, t.Cover
+	if strings.TrimSpace(body) == "" {
+		body = DefaultBody
+	}
+	if strings.TrimSpace(cover) == "" {
+		cover = DefaultCover
+	}
+
+	tmpl, err := template.New("report").Funcs(funcs).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	if tmpl.Lookup("cover") == nil {
+		if _, err := tmpl.New("cover").Parse(cover); err != nil {
+			return nil, fmt.Errorf("cover: %w", err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "report", data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// paragraphs splits text on its blank lines.
+func paragraphs(text string) []string {
+	var list []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			list = append(list, paragraph)
+		}
+	}
+	return list
+}
+
+// branding returns the logo and the severity colors of the template, the
+// default colors filling in those it does not set. The colors were checked
+// by Validate, so they are trusted as CSS.
+func (t *Template) branding() Branding {
+	branding := Branding{Colors: make(map[string]template.CSS, len(DefaultColors))}
+	for severity, color := range DefaultColors {
+		branding.Colors[severity] = template.CSS(color)
+	}
+	for severity, color := range t.SeverityColors {
+		if colorPattern.MatchString(color) {
+			branding.Colors[severity] = template.CSS(color)
+		}
+	}
+	if t.Logo != nil && logoTypes[t.Logo.ContentType] {
+		branding.Logo = template.URL(t.Logo.DataURI())
+	}
+	return branding
+}
+
+// DefaultCover is the cover page of templates that set none.
+const DefaultCover = `<section class="cover">
+  {{if .Branding.Logo}}<img class="logo" src="{{.Branding.Logo}}" alt="Logo">{{end}}
+  <h1>{{.Title}}</h1>
+  <p class="target">{{.Operation.Target}}</p>
+  <p class="date">{{date .GeneratedAt}}</p>
+</section>`
+
+// DefaultBody is the report of templates that set no body of their own.
+const DefaultBody = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #212121; margin: 0; }
+  main { max-width: 960px; margin: 0 auto; padding: 2rem; }
+  .cover { min-height: 90vh; display: flex; flex-direction: column; justify-content: center; align-items: center; text-align: center; page-break-after: always; }
+  .cover .logo { max-width: 240px; max-height: 120px; margin-bottom: 2rem; }
+  .cover h1 { font-size: 2.4rem; margin: 0 0 1rem; }
+  .cover .target { font-size: 1.3rem; color: #424242; }
+  .cover .date { color: #757575; }
+  table { border-collapse: collapse; width: 100%; margin: 1rem 0; }
+  th, td { text-align: left; padding: .5rem; border-bottom: 1px solid #e0e0e0; vertical-align: top; }
+  .badge { display: inline-block; padding: .15rem .5rem; border-radius: 3px; color: #fff; font-size: .8rem; font-weight: 600; }
+  .finding { border-left: 4px solid #e0e0e0; padding: .5rem 1rem; margin: 1.5rem 0; page-break-inside: avoid; }
+  pre { background: #f5f5f5; padding: .75rem; overflow-x: auto; white-space: pre-wrap; font-size: .85rem; }
+</style>
+</head>
+<body>
+{{template "cover" .}}
+<main>
+  {{if .ExecutiveSummary}}
+  <h2>Executive summary</h2>
+  {{range paragraphs .ExecutiveSummary}}<p>{{.}}</p>
+  {{end}}{{end}}
+  {{if .RiskNarrative}}
+  <h2>Risk narrative</h2>
+  {{range paragraphs .RiskNarrative}}<p>{{.}}</p>
+  {{end}}{{end}}
+
+  <h2>Overview</h2>
+  <table>
+    <tr><th>Target</th><td>{{.Operation.Target}}</td></tr>
+    <tr><th>Operation</th><td>{{.Operation.ID}} ({{.Operation.Status}}, {{.Operation.Agents}} agents)</td></tr>
+    <tr><th>Started</th><td>{{datetime .Operation.CreatedAt}}</td></tr>
+    <tr><th>Generated</th><td>{{datetime .GeneratedAt}}</td></tr>
+  </table>
+
+  <h2>Findings by severity</h2>
+  <table>
+    {{range .Severities}}<tr><td><span class="badge" style="background: {{severityColor .Severity}}">{{upper .Severity}}</span></td><td>{{.Count}}</td></tr>
+    {{end}}<tr><th>Total</th><th>{{.Total}}</th></tr>
+  </table>
+  {{with .Suppressed}}<p>{{len .}} finding(s) suppressed as accepted risks are listed under Accepted risks and not counted above.</p>{{end}}
+
+  <h2>Findings</h2>
+  {{range .Findings}}
+  <article class="finding" style="border-left-color: {{severityColor .Severity}}">
+    <h3><span class="badge" style="background: {{severityColor .Severity}}">{{upper .Severity}}</span> {{.Title}}</h3>
+    <table>
+      <tr><th>Target</th><td>{{.Target}}</td></tr>
+      {{if .Category}}<tr><th>Category</th><td>{{.Category}}</td></tr>{{end}}
+      {{if .CVSSScore}}<tr><th>CVSS</th><td>{{.CVSSScore}} {{.CVSSVector}}</td></tr>{{end}}
+      {{if .CWE}}<tr><th>CWE</th><td>{{.CWE}}</td></tr>{{end}}
+      <tr><th>Status</th><td>{{.Status}}</td></tr>
+    </table>
+    {{if .Description}}<p>{{.Description}}</p>{{end}}
+    {{if .Evidence}}<h4>Evidence</h4><pre>{{.Evidence}}</pre>{{end}}
+    {{if .Remediation}}<h4>Remediation</h4><p>{{.Remediation}}</p>{{end}}
+  </article>
+  {{else}}
+  <p>No findings were reported.</p>
+  {{end}}
+
+  {{with .Suppressed}}
+  <h2>Accepted risks</h2>
+  <table>
+    <tr><th>Severity</th><th>Finding</th><th>Target</th><th>Justification</th><th>Approved by</th><th>Accepted until</th></tr>
+    {{range .}}<tr>
+      <td><span class="badge" style="background: {{severityColor .Severity}}">{{upper .Severity}}</span></td>
+      <td>{{.Title}}</td>
+      <td>{{.Target}}</td>
+      <td>{{.Justification}}</td>
+      <td>{{.Approver}}</td>
+      <td>{{if .AcceptedUntil}}{{date .AcceptedUntil}}{{else}}No expiry{{end}}</td>
+    </tr>
+    {{end}}
+  </table>
+  {{end}}
+</main>
+</body>
+</html>
+`
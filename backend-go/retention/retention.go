@@ -0,0 +1,358 @@
+package retention
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Artifact types.
+const (
+	TypeLogs     = "logs"
+	TypeFindings = "findings"
+	TypeSessions = "sessions"
+	TypeMessages = "messages"
+)
+
+// Reasons an item is purged.
+const (
+	ReasonExpired   = "expired"
+	ReasonDiskUsage = "disk_usage"
+)
+
+// Run triggers.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+const (
+	maxReports     = 50
+	maxReportItems = 200
+)
+
+// Policy says how long each artifact type is kept and how much disk the
+// on-disk artifacts may use.
+type Policy struct {
+	// Days maps an artifact type to the number of days its items are kept.
+	// Zero or a missing type keeps them forever.
+	Days map[string]int `json:"days"`
+	// MaxDiskBytes caps the size of the on-disk items. Once over, the oldest
+	// are purged first. Zero is no cap.
+	MaxDiskBytes int64 `json:"max_disk_bytes"`
+}
+
+// Item is one purgeable piece of data.
+type Item struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	// Parent is the item's container, such as the agent of a message.
+	Parent string `json:"parent,omitempty"`
+	// Path is where the item is written in an archive, below its type.
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	// OnDisk marks items counted against the policy's disk cap.
+	OnDisk bool   `json:"on_disk"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Source lists, archives and deletes the items of one artifact type.
+type Source interface {
+	Type() string
+	Items() ([]Item, error)
+	// Archive returns the item's contents to archive before it is deleted.
+	Archive(item Item) ([]byte, error)
+	Delete(item Item) error
+}
+
+// Summary counts the items and bytes purged of one artifact type.
+type Summary struct {
+	Count int   `json:"count"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Report describes a janitor run, or what one would purge for a dry run.
+type Report struct {
+	ID      string `json:"id"`
+	DryRun  bool   `json:"dry_run"`
+	Trigger string `json:"trigger"`
+	Policy  Policy `json:"policy"`
+	// DiskBytes is the size of the on-disk items before the run.
+	DiskBytes int64              `json:"disk_bytes"`
+	Purged    map[string]Summary `json:"purged"`
+	Items     []Item             `json:"items"`
+	// Truncated is set when Items lists only the first of the purged items.
+	Truncated  bool      `json:"truncated,omitempty"`
+	Archive    string    `json:"archive,omitempty"`
+	Errors     []string  `json:"errors,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Total sums the purged items of every type.
+func (r Report) Total() Summary {
+	var total Summary
+	for _, summary := range r.Purged {
+		total.Count += summary.Count
+		total.Bytes += summary.Bytes
+	}
+	return total
+}
+
+// Janitor purges the items of its sources that a policy no longer keeps,
+// archiving them first.
+type Janitor struct {
+	sources    map[string]Source
+	archiveDir string
+	reports    []Report
+	notify     func(Report)
+	running    sync.Mutex
+	mu         sync.RWMutex
+}
+
+var Default = NewJanitor()
+
+func NewJanitor() *Janitor {
+	return &Janitor{sources: make(map[string]Source)}
+}
+
+// Configure sets where archives are written and the sources purged.
+func (j *Janitor) Configure(archiveDir string, sources ...Source) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.archiveDir = archiveDir
+	j.sources = make(map[string]Source, len(sources))
+	for _, source := range sources {
+		j.sources[source.Type()] = source
+	}
+}
+
+// SetNotify registers fn to be called with the report of every run that
+// purged something or failed.
+func (j *Janitor) SetNotify(fn func(Report)) {
+	j.mu.Lock()
+	j.notify = fn
+	j.mu.Unlock()
+}
+
+// Reports returns up to limit reports of past runs, newest first.
+func (j *Janitor) Reports(limit int) []Report {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	reports := make([]Report, 0, len(j.reports))
+	for i := len(j.reports) - 1; i >= 0; i-- {
+		if limit > 0 && len(reports) >= limit {
+			break
+		}
+		reports = append(reports, j.reports[i])
+	}
+	return reports
+}
+
+// Run purges what policy no longer keeps, archiving every item before it is
+// deleted. Items that fail to archive are kept. A dry run only reports what
+// would be purged.
+func (j *Janitor) Run(policy Policy, trigger string, dryRun bool) Report {
+	j.running.Lock()
+	defer j.running.Unlock()
+
+	j.mu.RLock()
+	sources := j.sources
+	archiveDir := j.archiveDir
+	notify := j.notify
+	j.mu.RUnlock()
+
+	report := Report{
+		ID:        uuid.New().String(),
+		DryRun:    dryRun,
+		Trigger:   trigger,
+		Policy:    policy,
+		Purged:    make(map[string]Summary),
+		Items:     make([]Item, 0),
+		StartedAt: time.Now(),
+	}
+
+	items, diskBytes, errs := plan(sources, policy, report.StartedAt)
+	report.DiskBytes = diskBytes
+	report.Errors = errs
+	if !dryRun && len(items) > 0 {
+		archived, archive, err := writeArchive(sources, archiveDir, items, report.StartedAt)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		report.Archive = archive
+		items = items[:0]
+		for _, item := range archived {
+			if err := sources[item.Type].Delete(item); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("delete %s %s: %v", item.Type, item.ID, err))
+				continue
+			}
+			items = append(items, item)
+		}
+	}
+
+	for _, item := range items {
+		summary := report.Purged[item.Type]
+		summary.Count++
+		summary.Bytes += item.Size
+		report.Purged[item.Type] = summary
+		if len(report.Items) < maxReportItems {
+			report.Items = append(report.Items, item)
+		} else {
+			report.Truncated = true
+		}
+	}
+	report.FinishedAt = time.Now()
+	if dryRun {
+		return report
+	}
+
+	j.mu.Lock()
+	j.reports = append(j.reports, report)
+	if len(j.reports) > maxReports {
+		j.reports = j.reports[len(j.reports)-maxReports:]
+	}
+	j.mu.Unlock()
+
+	total := report.Total()
+	if total.Count > 0 || len(report.Errors) > 0 {
+		log.Printf("Retention: purged %d items (%d bytes) into %q with %d errors", total.Count, total.Bytes, report.Archive, len(report.Errors))
+		if notify != nil {
+			notify(report)
+		}
+	}
+	return report
+}
+
+// plan selects the items past their type's retention, then the oldest
+// remaining on-disk items until their size is within the disk cap. It also
+// returns the size of the on-disk items before purging.
+func plan(sources map[string]Source, policy Policy, now time.Time) ([]Item, int64, []string) {
+	var selected, kept []Item
+	var errs []string
+	var diskBytes, remaining int64
+
+	types := make([]string, 0, len(sources))
+	for t := range sources {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	for _, t := range types {
+		items, err := sources[t].Items()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("list %s: %v", t, err))
+			continue
+		}
+		days := policy.Days[t]
+		cutoff := now.AddDate(0, 0, -days)
+		for _, item := range items {
+			item.Type = t
+			if item.OnDisk {
+				diskBytes += item.Size
+			}
+			if days > 0 && item.ModifiedAt.Before(cutoff) {
+				item.Reason = ReasonExpired
+				selected = append(selected, item)
+				continue
+			}
+			if item.OnDisk {
+				remaining += item.Size
+				kept = append(kept, item)
+			}
+		}
+	}
+
+	if policy.MaxDiskBytes > 0 && remaining > policy.MaxDiskBytes {
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].ModifiedAt.Before(kept[j].ModifiedAt) })
+		for _, item := range kept {
+			if remaining <= policy.MaxDiskBytes {
+				break
+			}
+			item.Reason = ReasonDiskUsage
+			selected = append(selected, item)
+			remaining -= item.Size
+		}
+	}
+	return selected, diskBytes, errs
+}
+
+// writeArchive writes the items to a gzipped tarball in dir and returns the
+// items it holds. Nothing is returned as archived when the tarball cannot be
+// completed.
+func writeArchive(sources map[string]Source, dir string, items []Item, now time.Time) ([]Item, string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, "", fmt.Errorf("create archive directory: %w", err)
+	}
+	name := filepath.Join(dir, "retention-"+now.UTC().Format("20060102T150405Z")+".tar.gz")
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, "", fmt.Errorf("create archive: %w", err)
+	}
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	archived := make([]Item, 0, len(items))
+	var errs []error
+	var fatal error
+	for _, item := range items {
+		data, err := sources[item.Type].Archive(item)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("archive %s %s: %w", item.Type, item.ID, err))
+			continue
+		}
+		header := &tar.Header{
+			Name:    path.Join(item.Type, item.Path),
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: item.ModifiedAt,
+		}
+		if fatal = tw.WriteHeader(header); fatal != nil {
+			break
+		}
+		if _, fatal = tw.Write(data); fatal != nil {
+			break
+		}
+		archived = append(archived, item)
+	}
+
+	err = tw.Close()
+	if fatal != nil {
+		err = fatal
+	}
+	if gzErr := gz.Close(); err == nil {
+		err = gzErr
+	}
+	if syncErr := file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name)
+		return nil, "", fmt.Errorf("write archive: %w", err)
+	}
+	if len(archived) == 0 {
+		os.Remove(name)
+		name = ""
+	}
+
+	var joined error
+	if len(errs) > 0 {
+		joined = fmt.Errorf("%d items not archived, first: %w", len(items)-len(archived), errs[0])
+	}
+	return archived, name, joined
+}
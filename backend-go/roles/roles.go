@@ -0,0 +1,298 @@
+package roles
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+	"performa-backend/provider"
+	"performa-backend/tools"
+
+	"github.com/google/uuid"
+)
+
+// Role describes the job an agent does in an operation. Built-in roles
+// cannot be changed; custom roles are created through the API.
+type Role struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	PromptTemplateID string    `json:"prompt_template_id,omitempty"`
+	ToolCategories   []string  `json:"tool_categories"`
+	BuiltIn          bool      `json:"built_in"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+
+	// Sampling holds the sampling parameters the role's agents default to.
+	// Only built-in roles set them.
+	Sampling provider.Sampling `json:"sampling,omitempty"`
+}
+
+// DefaultRoles are assigned in order when a start request names no roles.
+var DefaultRoles = []string{"Scanner", "Analyzer", "Reporter", "Exploiter", "Validator"}
+
+// builtIn roles default to a temperature fitting their job: low where the
+// answers must be exact, higher where the agent should try alternatives.
+var builtIn = map[string]Role{
+	"scanner": {Name: "Scanner", Description: "Discovers hosts, open ports and exposed services.",
+		Sampling: provider.Sampling{Temperature: provider.Float(0.3)}},
+	"analyzer": {Name: "Analyzer", Description: "Analyzes discovered services for weaknesses.",
+		Sampling: provider.Sampling{Temperature: provider.Float(0.5)}},
+	"reporter": {Name: "Reporter", Description: "Consolidates results into a findings report.",
+		Sampling: provider.Sampling{Temperature: provider.Float(0.4)}},
+	"exploiter": {Name: "Exploiter", Description: "Attempts to validate weaknesses by exploiting them.",
+		Sampling: provider.Sampling{Temperature: provider.Float(0.7)}},
+	"validator": {Name: "Validator", Description: "Confirms findings and rules out false positives.",
+		Sampling: provider.Sampling{Temperature: provider.Float(0.1), TopP: provider.Float(0.9)}},
+}
+
+type Store struct {
+	roles map[string]*Role
+	mu    sync.RWMutex
+}
+
+var Default = &Store{
+	roles: make(map[string]*Role),
+}
+
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func builtInRole(name string) *Role {
+	role, ok := builtIn[nameKey(name)]
+	if !ok {
+		return nil
+	}
+	role.ID = "builtin:" + nameKey(name)
+	role.BuiltIn = true
+	role.ToolCategories = []string{}
+	return &role
+}
+
+// ValidateToolCategories rejects categories unknown to the tools package.
+func ValidateToolCategories(categories []string) error {
+	for _, category := range categories {
+		if _, ok := tools.AllowedTools[category]; !ok {
+			return fmt.Errorf("unknown tool category %q", category)
+		}
+	}
+	return nil
+}
+
+func (s *Store) Create(name, description, promptTemplateID string, toolCategories []string) (*Role, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if err := ValidateToolCategories(toolCategories); err != nil {
+		return nil, err
+	}
+	if s.Resolve(name) != nil {
+		return nil, fmt.Errorf("role %q already exists", name)
+	}
+	if toolCategories == nil {
+		toolCategories = []string{}
+	}
+
+	now := time.Now()
+	role := &Role{
+		ID:               uuid.New().String(),
+		Name:             name,
+		Description:      description,
+		PromptTemplateID: promptTemplateID,
+		ToolCategories:   toolCategories,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+
+	s.mu.Lock()
+	s.roles[role.ID] = role
+	s.mu.Unlock()
+
+	s.persist(role)
+	return role, nil
+}
+
+// Get returns a custom role by ID, or a built-in role by its "builtin:" ID.
+func (s *Store) Get(id string) *Role {
+	if strings.HasPrefix(id, "builtin:") {
+		return builtInRole(strings.TrimPrefix(id, "builtin:"))
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.roles[id]
+}
+
+// Resolve looks a role up by name (case-insensitively) or ID.
+func (s *Store) Resolve(nameOrID string) *Role {
+	if role := builtInRole(nameOrID); role != nil {
+		return role
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if role, ok := s.roles[nameOrID]; ok {
+		return role
+	}
+	for _, role := range s.roles {
+		if nameKey(role.Name) == nameKey(nameOrID) {
+			return role
+		}
+	}
+	return nil
+}
+
+// GetAll returns the built-in roles followed by custom roles sorted by name.
+func (s *Store) GetAll() []*Role {
+	all := make([]*Role, 0, len(DefaultRoles))
+	for _, name := range DefaultRoles {
+		all = append(all, builtInRole(name))
+	}
+
+	s.mu.RLock()
+	custom := make([]*Role, 0, len(s.roles))
+	for _, role := range s.roles {
+		custom = append(custom, role)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(custom, func(i, j int) bool { return nameKey(custom[i].Name) < nameKey(custom[j].Name) })
+	return append(all, custom...)
+}
+
+// Update applies fn to a custom role under lock and persists the result.
+func (s *Store) Update(id string, fn func(role *Role) error) (*Role, error) {
+	s.mu.Lock()
+	role, exists := s.roles[id]
+	if !exists {
+		s.mu.Unlock()
+		return nil, nil
+	}
+
+	updated := *role
+	if err := fn(&updated); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if strings.TrimSpace(updated.Name) == "" {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("name is required")
+	}
+	if err := ValidateToolCategories(updated.ToolCategories); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if builtInRole(updated.Name) != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("role %q already exists", updated.Name)
+	}
+	for otherID, other := range s.roles {
+		if otherID != id && nameKey(other.Name) == nameKey(updated.Name) {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("role %q already exists", updated.Name)
+		}
+	}
+	updated.UpdatedAt = time.Now()
+	*role = updated
+	s.mu.Unlock()
+
+	s.persist(role)
+	return role, nil
+}
+
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.roles[id]
+	delete(s.roles, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		database.DeleteAgentRole(id)
+	}
+	return exists
+}
+
+// Assign resolves the requested roles and returns the role of each of count
+// agents, cycling through them round-robin. With no roles requested the
+// built-in roles are used.
+func (s *Store) Assign(requested []string, count int) ([]*Role, error) {
+	if len(requested) == 0 {
+		requested = DefaultRoles
+	}
+
+	resolved := make([]*Role, 0, len(requested))
+	for _, name := range requested {
+		role := s.Resolve(name)
+		if role == nil {
+			return nil, fmt.Errorf("unknown role %q", name)
+		}
+		resolved = append(resolved, role)
+	}
+
+	assigned := make([]*Role, count)
+	for i := range assigned {
+		assigned[i] = resolved[i%len(resolved)]
+	}
+	return assigned, nil
+}
+
+func (s *Store) persist(role *Role) {
+	if database.DB == nil {
+		return
+	}
+
+	s.mu.RLock()
+	categories, _ := json.Marshal(role.ToolCategories)
+	record := database.AgentRoleRecord{
+		ID:               role.ID,
+		Name:             role.Name,
+		Description:      role.Description,
+		PromptTemplateID: role.PromptTemplateID,
+		ToolCategories:   categories,
+		CreatedAt:        role.CreatedAt,
+		UpdatedAt:        role.UpdatedAt,
+	}
+	s.mu.RUnlock()
+
+	if err := database.SaveAgentRole(record); err != nil {
+		log.Printf("Roles: failed to persist role %s: %v", role.ID, err)
+	}
+}
+
+// Load restores custom roles from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllAgentRoles()
+	if err != nil {
+		log.Printf("Roles: failed to load roles: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		role := &Role{
+			ID:               record.ID,
+			Name:             record.Name,
+			Description:      record.Description,
+			PromptTemplateID: record.PromptTemplateID,
+			ToolCategories:   []string{},
+			CreatedAt:        record.CreatedAt,
+			UpdatedAt:        record.UpdatedAt,
+		}
+		json.Unmarshal(record.ToolCategories, &role.ToolCategories)
+		s.roles[role.ID] = role
+	}
+}
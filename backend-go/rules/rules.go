@@ -0,0 +1,280 @@
+// Package rules applies user-configured rules to findings as they are
+// created and updated: tagging, assigning, raising the severity of,
+// notifying about or suppressing the findings that match their conditions.
+package rules
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"performa-backend/escalation"
+	"performa-backend/models"
+)
+
+// Action types.
+const (
+	ActionSetTag        = "set_tag"
+	ActionSetAssignee   = "set_assignee"
+	ActionRaiseSeverity = "raise_severity"
+	ActionNotify        = "notify"
+	ActionSuppress      = "suppress"
+)
+
+// maxPatternLength bounds the target and title patterns of a rule.
+const maxPatternLength = 512
+
+// Conditions select the findings a rule applies to. Every condition set
+// must hold; a rule without conditions matches every finding of its
+// workspace. Target and Title are regular expressions, matched case
+// insensitively.
+type Conditions struct {
+	Severities []string `json:"severities,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	Target     string   `json:"target,omitempty"`
+	Title      string   `json:"title,omitempty"`
+}
+
+// Action is what a rule does to a matching finding. Channel and URL
+// address a notification as in the escalation policies.
+type Action struct {
+	Type     string `json:"type"`
+	Tag      string `json:"tag,omitempty"`
+	Assignee string `json:"assignee,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Channel  string `json:"channel,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// Rule applies its actions to the findings of its workspace that come to
+// match its conditions, when they are created or when an update makes them
+// match. Rules run by position; a rule with Stop set ends the evaluation
+// when it matches.
+type Rule struct {
+	ID          string     `json:"id"`
+	WorkspaceID string     `json:"workspace_id"`
+	Name        string     `json:"name"`
+	Enabled     bool       `json:"enabled"`
+	Position    int        `json:"position"`
+	Conditions  Conditions `json:"conditions"`
+	Actions     []Action   `json:"actions"`
+	Stop        bool       `json:"stop"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	target *regexp.Regexp
+	title  *regexp.Regexp
+}
+
+// Change is an action a rule applied to a finding.
+type Change struct {
+	RuleID   string `json:"rule_id"`
+	RuleName string `json:"rule_name"`
+	Action   string `json:"action"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+}
+
+// Validate checks the rule's conditions and actions and compiles its
+// patterns.
+func (r *Rule) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	for i, severity := range r.Conditions.Severities {
+		severity = strings.ToLower(strings.TrimSpace(severity))
+		if models.SeverityRank[models.Severity(severity)] == 0 {
+			return fmt.Errorf("unknown severity %q", r.Conditions.Severities[i])
+		}
+		r.Conditions.Severities[i] = severity
+	}
+	var err error
+	if r.target, err = compilePattern("target", r.Conditions.Target); err != nil {
+		return err
+	}
+	if r.title, err = compilePattern("title", r.Conditions.Title); err != nil {
+		return err
+	}
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	for i := range r.Actions {
+		if err := r.Actions[i].validate(); err != nil {
+			return fmt.Errorf("action %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func compilePattern(name, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if len(pattern) > maxPatternLength {
+		return nil, fmt.Errorf("%s pattern is longer than %d characters", name, maxPatternLength)
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s pattern: %v", name, err)
+	}
+	return re, nil
+}
+
+func (a *Action) validate() error {
+	switch a.Type {
+	case ActionSetTag:
+		a.Tag = strings.TrimSpace(a.Tag)
+		if a.Tag == "" {
+			return fmt.Errorf("tag is required")
+		}
+	case ActionSetAssignee:
+		a.Assignee = strings.TrimSpace(a.Assignee)
+		if a.Assignee == "" {
+			return fmt.Errorf("assignee is required")
+		}
+	case ActionRaiseSeverity:
+		a.Severity = strings.ToLower(strings.TrimSpace(a.Severity))
+		if models.SeverityRank[models.Severity(a.Severity)] == 0 {
+			return fmt.Errorf("unknown severity %q", a.Severity)
+		}
+	case ActionNotify:
+		if a.Channel != escalation.ChannelSlack && a.Channel != escalation.ChannelWebhook {
+			return fmt.Errorf("channel must be %q or %q", escalation.ChannelSlack, escalation.ChannelWebhook)
+		}
+	case ActionSuppress:
+	default:
+		return fmt.Errorf("type must be one of %s, %s, %s, %s, %s",
+			ActionSetTag, ActionSetAssignee, ActionRaiseSeverity, ActionNotify, ActionSuppress)
+	}
+	return nil
+}
+
+// Matches reports whether the finding meets the rule's conditions.
+func (r *Rule) Matches(finding *models.Finding) bool {
+	c := r.Conditions
+	if len(c.Severities) > 0 && !containsFold(c.Severities, string(finding.Severity)) {
+		return false
+	}
+	if len(c.Categories) > 0 && !containsFold(c.Categories, finding.Category) {
+		return false
+	}
+	if r.target != nil && !r.target.MatchString(finding.Target) {
+		return false
+	}
+	return r.title == nil || r.title.MatchString(finding.Title)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) clone() *Rule {
+	copied := *r
+	copied.Conditions.Severities = append([]string{}, r.Conditions.Severities...)
+	copied.Conditions.Categories = append([]string{}, r.Conditions.Categories...)
+	copied.Actions = append([]Action{}, r.Actions...)
+	return &copied
+}
+
+// Evaluate applies the enabled rules of the finding's workspace to a finding
+// about to be stored, before being its previous version or nil for a new
+// finding. A rule acts on the finding when it matches it and did not match
+// before, so that updates do not apply it again. Notifications are sent
+// asynchronously.
+func Evaluate(before, finding *models.Finding) []Change {
+	return apply(Default.Enabled(finding.WorkspaceID), before, finding, true)
+}
+
+// DryRun returns what rules would do to the finding if it were created,
+// without changing it or notifying anyone.
+func DryRun(rules []*Rule, finding *models.Finding) []Change {
+	copied := *finding
+	return apply(rules, nil, &copied, false)
+}
+
+func apply(rules []*Rule, before, finding *models.Finding, live bool) []Change {
+	var changes []Change
+	for _, rule := range rules {
+		if !rule.Matches(finding) || (before != nil && rule.Matches(before)) {
+			continue
+		}
+		for _, action := range rule.Actions {
+			if change, ok := applyAction(rule, action, finding, live); ok {
+				changes = append(changes, change)
+			}
+		}
+		if rule.Stop {
+			break
+		}
+	}
+	return changes
+}
+
+// applyAction applies one action to the finding and reports the change it
+// made, if any.
+func applyAction(rule *Rule, action Action, finding *models.Finding, live bool) (Change, bool) {
+	change := Change{RuleID: rule.ID, RuleName: rule.Name, Action: action.Type}
+	switch action.Type {
+	case ActionSetTag:
+		for _, tag := range finding.Tags {
+			if strings.EqualFold(tag, action.Tag) {
+				return change, false
+			}
+		}
+		finding.Tags = append(append([]string{}, finding.Tags...), action.Tag)
+		change.To = action.Tag
+	case ActionSetAssignee:
+		if finding.Assignee == action.Assignee {
+			return change, false
+		}
+		change.From, change.To = finding.Assignee, action.Assignee
+		finding.Assignee = action.Assignee
+	case ActionRaiseSeverity:
+		severity := models.Severity(action.Severity)
+		if models.SeverityRank[finding.Severity] >= models.SeverityRank[severity] {
+			return change, false
+		}
+		change.From, change.To = string(finding.Severity), action.Severity
+		finding.Severity = severity
+	case ActionSuppress:
+		// Only untriaged findings are suppressed, so that a rule does not
+		// override a status set by hand.
+		if finding.Status != "new" {
+			return change, false
+		}
+		change.From, change.To = finding.Status, models.FindingStatusSuppressed
+		finding.Status = models.FindingStatusSuppressed
+	case ActionNotify:
+		change.To = action.Channel
+		if live {
+			go notify(rule.Name, action, *finding)
+		}
+	}
+	return change, true
+}
+
+func notify(ruleName string, action Action, finding models.Finding) {
+	var payload interface{}
+	if action.Channel == escalation.ChannelSlack {
+		payload = map[string]string{
+			"text": fmt.Sprintf(":label: %s finding: %s on %s (rule: %s)",
+				strings.ToUpper(string(finding.Severity)), finding.Title, finding.Target, ruleName),
+		}
+	} else {
+		payload = map[string]interface{}{
+			"rule":    ruleName,
+			"finding": finding,
+		}
+	}
+	if err := escalation.Post(action.Channel, action.URL, payload); err != nil {
+		log.Printf("Rules: rule %q %s notification failed: %v", ruleName, action.Channel, err)
+	}
+}
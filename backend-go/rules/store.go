@@ -0,0 +1,228 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+
+	"github.com/google/uuid"
+)
+
+// Store keeps the finding rules of every workspace.
+type Store struct {
+	rules map[string]*Rule
+	mu    sync.RWMutex
+}
+
+var Default = &Store{rules: make(map[string]*Rule)}
+
+// Create validates a rule and adds it after the workspace's other rules.
+func (s *Store) Create(rule Rule) (*Rule, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rule.ID = uuid.New().String()
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+
+	s.mu.Lock()
+	rule.Position = 1
+	for _, existing := range s.rules {
+		if existing.WorkspaceID == rule.WorkspaceID && existing.Position >= rule.Position {
+			rule.Position = existing.Position + 1
+		}
+	}
+	stored := rule.clone()
+	s.rules[stored.ID] = stored
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return stored.clone(), nil
+}
+
+func (s *Store) Get(id string) *Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if rule, ok := s.rules[id]; ok {
+		return rule.clone()
+	}
+	return nil
+}
+
+// List returns the workspace's rules in evaluation order.
+func (s *Store) List(workspaceID string) []*Rule {
+	s.mu.RLock()
+	list := make([]*Rule, 0)
+	for _, rule := range s.rules {
+		if rule.WorkspaceID == workspaceID {
+			list = append(list, rule.clone())
+		}
+	}
+	s.mu.RUnlock()
+
+	sortRules(list)
+	return list
+}
+
+// Enabled returns the workspace's enabled rules in evaluation order.
+func (s *Store) Enabled(workspaceID string) []*Rule {
+	enabled := make([]*Rule, 0)
+	for _, rule := range s.List(workspaceID) {
+		if rule.Enabled {
+			enabled = append(enabled, rule)
+		}
+	}
+	return enabled
+}
+
+func sortRules(list []*Rule) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Position != list[j].Position {
+			return list[i].Position < list[j].Position
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+}
+
+// Update applies fn to a copy of the rule, validates it and stores the
+// result. It returns nil, nil when the rule does not exist.
+func (s *Store) Update(id string, fn func(rule *Rule)) (*Rule, error) {
+	s.mu.Lock()
+	existing, ok := s.rules[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	updated := existing.clone()
+	fn(updated)
+	if err := updated.Validate(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	updated.ID = id
+	updated.WorkspaceID = existing.WorkspaceID
+	updated.Position = existing.Position
+	updated.CreatedAt = existing.CreatedAt
+	updated.UpdatedAt = time.Now()
+	s.rules[id] = updated
+	stored := updated.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return stored, nil
+}
+
+// Reorder moves the listed rules of a workspace to the front in the order
+// given, followed by its other rules in their current order.
+func (s *Store) Reorder(workspaceID string, ids []string) ([]*Rule, error) {
+	s.mu.Lock()
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		rule, ok := s.rules[id]
+		if !ok || rule.WorkspaceID != workspaceID {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("rule %s not found", id)
+		}
+		if seen[id] {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("rule %s listed twice", id)
+		}
+		seen[id] = true
+	}
+
+	rest := make([]*Rule, 0)
+	for _, rule := range s.rules {
+		if rule.WorkspaceID == workspaceID && !seen[rule.ID] {
+			rest = append(rest, rule)
+		}
+	}
+	sortRules(rest)
+	ordered := make([]*Rule, 0, len(ids)+len(rest))
+	for _, id := range ids {
+		ordered = append(ordered, s.rules[id])
+	}
+	ordered = append(ordered, rest...)
+
+	changed := make([]*Rule, 0)
+	for i, rule := range ordered {
+		if rule.Position != i+1 {
+			rule.Position = i + 1
+			rule.UpdatedAt = time.Now()
+			changed = append(changed, rule.clone())
+		}
+	}
+	s.mu.Unlock()
+
+	for _, rule := range changed {
+		s.persist(rule)
+	}
+	return s.List(workspaceID), nil
+}
+
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.rules[id]
+	delete(s.rules, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		if err := database.DeleteFindingRule(id); err != nil {
+			log.Printf("Rules: failed to delete rule %s: %v", id, err)
+		}
+	}
+	return exists
+}
+
+func (s *Store) persist(rule *Rule) {
+	if database.DB == nil {
+		return
+	}
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return
+	}
+	record := database.FindingRuleRecord{
+		ID:          rule.ID,
+		WorkspaceID: rule.WorkspaceID,
+		Data:        data,
+		CreatedAt:   rule.CreatedAt,
+		UpdatedAt:   rule.UpdatedAt,
+	}
+	if err := database.SaveFindingRule(record); err != nil {
+		log.Printf("Rules: failed to persist rule %s: %v", rule.ID, err)
+	}
+}
+
+// Load restores the rules from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+	records, err := database.GetAllFindingRules()
+	if err != nil {
+		log.Printf("Rules: failed to load rules: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		var rule Rule
+		if err := json.Unmarshal(record.Data, &rule); err != nil {
+			log.Printf("Rules: skipping rule %s: %v", record.ID, err)
+			continue
+		}
+		if err := rule.Validate(); err != nil {
+			log.Printf("Rules: skipping invalid rule %s: %v", record.ID, err)
+			continue
+		}
+		s.rules[rule.ID] = &rule
+	}
+}
@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxBlackoutChain bounds the adjoining windows followed to find when a
+// blackout ends.
+const maxBlackoutChain = 32
+
+// BlackoutWindow is a period in which an operation must not run, in one of
+// three forms:
+//   - a daily range: Start and End as "HH:MM", an End before Start spanning
+//     midnight and an End equal to Start the whole day, limited to some
+//     weekdays ("mon" to "sun") by Days;
+//   - a cron expression whose every firing starts a blackout of
+//     DurationMinutes;
+//   - a one-off range from From until Until.
+type BlackoutWindow struct {
+	Days            []string   `json:"days,omitempty"`
+	Start           string     `json:"start,omitempty"`
+	End             string     `json:"end,omitempty"`
+	Cron            string     `json:"cron,omitempty"`
+	DurationMinutes int        `json:"duration_minutes,omitempty"`
+	From            *time.Time `json:"from,omitempty"`
+	Until           *time.Time `json:"until,omitempty"`
+}
+
+// Blackout lists the windows in which an operation's agents are paused.
+// Daily ranges and cron expressions are read in Timezone, the server's
+// local time when it is empty.
+type Blackout struct {
+	Timezone string           `json:"timezone,omitempty"`
+	Windows  []BlackoutWindow `json:"windows"`
+}
+
+func parseBlackoutClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Validate checks the timezone and that each window is one valid form.
+func (b *Blackout) Validate() error {
+	if _, err := location(b.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", b.Timezone)
+	}
+	if len(b.Windows) == 0 {
+		return fmt.Errorf("at least one window is required")
+	}
+	for i, w := range b.Windows {
+		if err := w.validate(); err != nil {
+			return fmt.Errorf("window %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (w BlackoutWindow) validate() error {
+	forms := 0
+	for _, set := range []bool{w.Start != "" || w.End != "", w.Cron != "", w.From != nil || w.Until != nil} {
+		if set {
+			forms++
+		}
+	}
+	if forms != 1 {
+		return fmt.Errorf("set exactly one of start and end, cron, or from and until")
+	}
+
+	switch {
+	case w.Cron != "":
+		if _, err := ParseCron(w.Cron); err != nil {
+			return fmt.Errorf("cron: %v", err)
+		}
+		if w.DurationMinutes <= 0 {
+			return fmt.Errorf("duration_minutes must be positive with cron")
+		}
+	case w.From != nil || w.Until != nil:
+		if w.From == nil || w.Until == nil {
+			return fmt.Errorf("from and until go together")
+		}
+		if !w.Until.After(*w.From) {
+			return fmt.Errorf("until must be after from")
+		}
+	default:
+		if _, err := parseBlackoutClock(w.Start); err != nil {
+			return err
+		}
+		if _, err := parseBlackoutClock(w.End); err != nil {
+			return err
+		}
+	}
+	if len(w.Days) > 0 && (w.Start == "" || w.End == "") {
+		return fmt.Errorf("days only apply to start and end")
+	}
+	for _, day := range w.Days {
+		if _, ok := dayNames[strings.ToUpper(strings.TrimSpace(day))]; !ok {
+			return fmt.Errorf("unknown day %q", day)
+		}
+	}
+	return nil
+}
+
+// Active reports whether t falls in a blackout window and, if it does, when
+// the blackout ends, following the windows that adjoin or overlap it.
+func (b *Blackout) Active(t time.Time) (bool, time.Time) {
+	if b == nil {
+		return false, time.Time{}
+	}
+	loc, err := location(b.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	end, ok := b.endOf(t.In(loc))
+	if !ok {
+		return false, time.Time{}
+	}
+	for i := 0; i < maxBlackoutChain; i++ {
+		next, ok := b.endOf(end)
+		if !ok || !next.After(end) {
+			break
+		}
+		end = next
+	}
+	return true, end
+}
+
+// endOf returns the latest end of the windows t falls in.
+func (b *Blackout) endOf(t time.Time) (time.Time, bool) {
+	var end time.Time
+	found := false
+	for _, w := range b.Windows {
+		if e, ok := w.endOf(t); ok && (!found || e.After(end)) {
+			end, found = e, true
+		}
+	}
+	return end, found
+}
+
+func (w BlackoutWindow) endOf(t time.Time) (time.Time, bool) {
+	switch {
+	case w.Cron != "":
+		expr, err := ParseCron(w.Cron)
+		if err != nil || w.DurationMinutes <= 0 {
+			return time.Time{}, false
+		}
+		duration := time.Duration(w.DurationMinutes) * time.Minute
+		// The blackout is on when the expression fired in the last
+		// duration, up to and including t.
+		start := expr.Next(t.Add(-duration))
+		if start.IsZero() || start.After(t) {
+			return time.Time{}, false
+		}
+		return start.Add(duration), true
+
+	case w.From != nil && w.Until != nil:
+		if t.Before(*w.From) || !t.Before(*w.Until) {
+			return time.Time{}, false
+		}
+		return w.Until.In(t.Location()), true
+	}
+
+	start, err1 := parseBlackoutClock(w.Start)
+	end, err2 := parseBlackoutClock(w.End)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	clock := func(days, minutes int) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day()+days, 0, minutes, 0, 0, t.Location())
+	}
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	switch {
+	case start == end:
+		if w.onDay(today) {
+			return clock(1, 0), true
+		}
+	case start < end:
+		if w.onDay(today) && minute >= start && minute < end {
+			return clock(0, end), true
+		}
+	default:
+		// The part of an overnight range after midnight belongs to the
+		// day it started.
+		if w.onDay(today) && minute >= start {
+			return clock(1, end), true
+		}
+		if w.onDay(yesterday) && minute < end {
+			return clock(0, end), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w BlackoutWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, name := range w.Days {
+		if d, ok := dayNames[strings.ToUpper(strings.TrimSpace(name))]; ok && time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
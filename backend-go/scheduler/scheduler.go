@@ -0,0 +1,412 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+
+	"github.com/google/uuid"
+)
+
+const maxRunHistory = 50
+
+type RunStatus string
+
+const (
+	RunStatusStarted RunStatus = "started"
+	RunStatusSkipped RunStatus = "skipped"
+	RunStatusFailed  RunStatus = "failed"
+)
+
+type Run struct {
+	ID          string    `json:"id"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	StartedAt   time.Time `json:"started_at"`
+	OperationID string    `json:"operation_id,omitempty"`
+	Status      RunStatus `json:"status"`
+	Trigger     string    `json:"trigger"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type Schedule struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	ConfigID  string     `json:"config_id"`
+	CronExpr  string     `json:"cron"`
+	Timezone  string     `json:"timezone"`
+	Enabled   bool       `json:"enabled"`
+	Paused    bool       `json:"paused"`
+	NextRunAt *time.Time `json:"next_run_at"`
+	LastRunAt *time.Time `json:"last_run_at"`
+	Runs      []Run      `json:"runs"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// DispatchFunc starts an operation for the schedule and returns its ID.
+type DispatchFunc func(s *Schedule) (string, error)
+
+type Scheduler struct {
+	schedules map[string]*Schedule
+	dispatch  DispatchFunc
+	onTick    []func(now time.Time)
+	interval  time.Duration
+	mu        sync.RWMutex
+	stop      chan struct{}
+}
+
+var Default = &Scheduler{
+	schedules: make(map[string]*Schedule),
+	interval:  15 * time.Second,
+}
+
+func (s *Scheduler) SetDispatcher(fn DispatchFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dispatch = fn
+}
+
+// OnTick runs fn on every tick of the dispatcher loop, after the schedules
+// due were triggered.
+func (s *Scheduler) OnTick(fn func(now time.Time)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onTick = append(s.onTick, fn)
+}
+
+func location(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// nextRun computes the next fire time for cronExpr after t in timezone tz.
+func nextRun(cronExpr, tz string, after time.Time) (*time.Time, error) {
+	expr, err := ParseCron(cronExpr)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := location(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", tz)
+	}
+	next := expr.Next(after.In(loc))
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron expression %q never fires", cronExpr)
+	}
+	return &next, nil
+}
+
+// Validate checks a cron expression and timezone without creating anything.
+func Validate(cronExpr, tz string) error {
+	_, err := nextRun(cronExpr, tz, time.Now())
+	return err
+}
+
+func (s *Scheduler) Create(name, configID, cronExpr, tz string, enabled bool) (*Schedule, error) {
+	next, err := nextRun(cronExpr, tz, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	schedule := &Schedule{
+		ID:        uuid.New().String(),
+		Name:      name,
+		ConfigID:  configID,
+		CronExpr:  cronExpr,
+		Timezone:  tz,
+		Enabled:   enabled,
+		NextRunAt: next,
+		Runs:      []Run{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.mu.Lock()
+	s.schedules[schedule.ID] = schedule
+	s.mu.Unlock()
+
+	s.persist(schedule)
+	return schedule, nil
+}
+
+func (s *Scheduler) Get(id string) *Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.schedules[id]
+}
+
+func (s *Scheduler) GetAll() []*Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedules := make([]*Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+	return schedules
+}
+
+func (s *Scheduler) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.schedules[id]
+	delete(s.schedules, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		database.DeleteSchedule(id)
+	}
+	return exists
+}
+
+// Update applies fn to the schedule under lock, recomputes the next run and
+// persists the result.
+func (s *Scheduler) Update(id string, fn func(schedule *Schedule) error) (*Schedule, error) {
+	s.mu.Lock()
+	schedule, exists := s.schedules[id]
+	if !exists {
+		s.mu.Unlock()
+		return nil, nil
+	}
+
+	updated := *schedule
+	if err := fn(&updated); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	next, err := nextRun(updated.CronExpr, updated.Timezone, time.Now())
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	updated.NextRunAt = next
+	updated.UpdatedAt = time.Now()
+	*schedule = updated
+	s.mu.Unlock()
+
+	s.persist(schedule)
+	return schedule, nil
+}
+
+// RunNow triggers the schedule immediately, regardless of its state.
+func (s *Scheduler) RunNow(id string) (*Run, error) {
+	schedule := s.Get(id)
+	if schedule == nil {
+		return nil, fmt.Errorf("schedule not found")
+	}
+	run := s.execute(schedule, time.Now(), "manual")
+	return &run, nil
+}
+
+func (s *Scheduler) execute(schedule *Schedule, scheduledAt time.Time, trigger string) Run {
+	run := Run{
+		ID:          uuid.New().String(),
+		ScheduledAt: scheduledAt,
+		StartedAt:   time.Now(),
+		Trigger:     trigger,
+		Status:      RunStatusStarted,
+	}
+
+	s.mu.RLock()
+	dispatch := s.dispatch
+	snapshot := *schedule
+	s.mu.RUnlock()
+
+	if dispatch == nil {
+		run.Status = RunStatusFailed
+		run.Error = "no dispatcher configured"
+	} else if operationID, err := dispatch(&snapshot); err != nil {
+		run.Status = RunStatusFailed
+		run.Error = err.Error()
+	} else {
+		run.OperationID = operationID
+	}
+
+	s.recordRun(schedule.ID, run)
+	return run
+}
+
+func (s *Scheduler) recordRun(id string, run Run) {
+	s.mu.Lock()
+	schedule, exists := s.schedules[id]
+	if !exists {
+		s.mu.Unlock()
+		return
+	}
+	schedule.Runs = append(schedule.Runs, run)
+	if len(schedule.Runs) > maxRunHistory {
+		schedule.Runs = schedule.Runs[len(schedule.Runs)-maxRunHistory:]
+	}
+	if run.Status != RunStatusSkipped {
+		startedAt := run.StartedAt
+		schedule.LastRunAt = &startedAt
+	}
+	schedule.UpdatedAt = time.Now()
+	s.mu.Unlock()
+
+	s.persist(schedule)
+}
+
+// Start loads persisted schedules and runs the dispatcher loop until Stop.
+func (s *Scheduler) Start() {
+	s.load()
+
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				s.tick(now)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *Scheduler) tick(now time.Time) {
+	due := make([]*Schedule, 0)
+
+	s.mu.Lock()
+	for _, schedule := range s.schedules {
+		if schedule.NextRunAt == nil || schedule.NextRunAt.After(now) {
+			continue
+		}
+		due = append(due, schedule)
+	}
+	s.mu.Unlock()
+
+	for _, schedule := range due {
+		s.mu.Lock()
+		scheduledAt := *schedule.NextRunAt
+		active := schedule.Enabled && !schedule.Paused
+		next, err := nextRun(schedule.CronExpr, schedule.Timezone, now)
+		if err == nil {
+			schedule.NextRunAt = next
+		} else {
+			schedule.NextRunAt = nil
+		}
+		s.mu.Unlock()
+
+		if !active {
+			if schedule.Enabled {
+				s.recordRun(schedule.ID, Run{
+					ID:          uuid.New().String(),
+					ScheduledAt: scheduledAt,
+					StartedAt:   now,
+					Trigger:     "cron",
+					Status:      RunStatusSkipped,
+					Error:       "schedule paused",
+				})
+			} else {
+				s.persist(schedule)
+			}
+			continue
+		}
+
+		log.Printf("Scheduler: triggering schedule %s (%s)", schedule.ID, schedule.Name)
+		s.execute(schedule, scheduledAt, "cron")
+	}
+
+	s.mu.RLock()
+	hooks := append([]func(time.Time){}, s.onTick...)
+	s.mu.RUnlock()
+	for _, fn := range hooks {
+		fn(now)
+	}
+}
+
+func (s *Scheduler) persist(schedule *Schedule) {
+	if database.DB == nil {
+		return
+	}
+
+	s.mu.RLock()
+	runs, _ := json.Marshal(schedule.Runs)
+	record := database.ScheduleRecord{
+		ID:        schedule.ID,
+		Name:      schedule.Name,
+		ConfigID:  schedule.ConfigID,
+		CronExpr:  schedule.CronExpr,
+		Timezone:  schedule.Timezone,
+		Enabled:   schedule.Enabled,
+		Paused:    schedule.Paused,
+		NextRunAt: schedule.NextRunAt,
+		LastRunAt: schedule.LastRunAt,
+		Runs:      runs,
+		CreatedAt: schedule.CreatedAt,
+		UpdatedAt: schedule.UpdatedAt,
+	}
+	s.mu.RUnlock()
+
+	if err := database.SaveSchedule(record); err != nil {
+		log.Printf("Scheduler: failed to persist schedule %s: %v", schedule.ID, err)
+	}
+}
+
+// load restores schedules from the database. Runs missed while the backend
+// was down are not replayed; the next run is recomputed from now.
+func (s *Scheduler) load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllSchedules()
+	if err != nil {
+		log.Printf("Scheduler: failed to load schedules: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		schedule := &Schedule{
+			ID:        record.ID,
+			Name:      record.Name,
+			ConfigID:  record.ConfigID,
+			CronExpr:  record.CronExpr,
+			Timezone:  record.Timezone,
+			Enabled:   record.Enabled,
+			Paused:    record.Paused,
+			LastRunAt: record.LastRunAt,
+			Runs:      []Run{},
+			CreatedAt: record.CreatedAt,
+			UpdatedAt: record.UpdatedAt,
+		}
+		json.Unmarshal(record.Runs, &schedule.Runs)
+		if next, err := nextRun(schedule.CronExpr, schedule.Timezone, time.Now()); err == nil {
+			schedule.NextRunAt = next
+		}
+		s.schedules[schedule.ID] = schedule
+	}
+}
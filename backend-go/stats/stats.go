@@ -0,0 +1,313 @@
+// Package stats aggregates findings for the statistics dashboard: findings
+// per severity per day, time to triage, top categories and a risk score per
+// target. Without a database the aggregates are kept up to date in memory as
+// findings are stored.
+package stats
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SeverityWeights are the points a finding of each severity adds to its
+// target's risk score.
+var SeverityWeights = map[string]float64{
+	"critical": 10,
+	"high":     7,
+	"medium":   4,
+	"low":      1,
+	"info":     0,
+}
+
+// ClosedStatuses are the finding statuses that no longer count towards a
+// target's risk.
+var ClosedStatuses = []string{"resolved", "fixed", "closed", "false_positive", "accepted", SuppressedStatus}
+
+// SuppressedStatus is the status of findings suppressed as accepted risks,
+// counted apart from the others.
+const SuppressedStatus = "suppressed"
+
+// IsClosed reports whether a finding with status no longer counts towards
+// risk.
+func IsClosed(status string) bool {
+	status = strings.ToLower(strings.TrimSpace(status))
+	for _, closed := range ClosedStatuses {
+		if status == closed {
+			return true
+		}
+	}
+	return false
+}
+
+const dayLayout = "2006-01-02"
+
+// Fact is the part of a finding the aggregates are computed from.
+type Fact struct {
+	WorkspaceID string
+	Severity    string
+	Category    string
+	Target      string
+	Status      string
+	CreatedAt   time.Time
+	TriagedAt   *time.Time
+}
+
+// TriageSum accumulates the time findings created on one day took to be
+// triaged.
+type TriageSum struct {
+	Seconds float64
+	Count   int
+}
+
+// Tally holds the raw aggregates of one workspace. Daily, Suppressed and
+// Triage are keyed by creation day ("YYYY-MM-DD"); Targets only counts open
+// findings.
+type Tally struct {
+	Daily      map[string]map[string]int
+	Suppressed map[string]map[string]int
+	Categories map[string]int
+	Targets    map[string]map[string]int
+	Triage     map[string]TriageSum
+}
+
+func NewTally() *Tally {
+	return &Tally{
+		Daily:      make(map[string]map[string]int),
+		Suppressed: make(map[string]map[string]int),
+		Categories: make(map[string]int),
+		Targets:    make(map[string]map[string]int),
+		Triage:     make(map[string]TriageSum),
+	}
+}
+
+func addCount(counts map[string]map[string]int, key, severity string, delta int) {
+	if counts[key] == nil {
+		counts[key] = make(map[string]int)
+	}
+	counts[key][severity] += delta
+	if counts[key][severity] <= 0 {
+		delete(counts[key], severity)
+		if len(counts[key]) == 0 {
+			delete(counts, key)
+		}
+	}
+}
+
+// AddTriage records a finding created at createdAt and triaged at triagedAt.
+func (t *Tally) AddTriage(createdAt, triagedAt time.Time) {
+	t.addTriage(createdAt, triagedAt, 1)
+}
+
+func (t *Tally) addTriage(createdAt, triagedAt time.Time, sign int) {
+	day := createdAt.UTC().Format(dayLayout)
+	sum := t.Triage[day]
+	sum.Seconds += float64(sign) * triagedAt.Sub(createdAt).Seconds()
+	sum.Count += sign
+	if sum.Count <= 0 {
+		delete(t.Triage, day)
+		return
+	}
+	t.Triage[day] = sum
+}
+
+// apply adds the fact to the tally, or removes it when sign is -1.
+func (t *Tally) apply(fact *Fact, sign int) {
+	severity := strings.ToLower(fact.Severity)
+	day := fact.CreatedAt.UTC().Format(dayLayout)
+	addCount(t.Daily, day, severity, sign)
+	if strings.EqualFold(fact.Status, SuppressedStatus) {
+		addCount(t.Suppressed, day, severity, sign)
+	}
+
+	t.Categories[fact.Category] += sign
+	if t.Categories[fact.Category] <= 0 {
+		delete(t.Categories, fact.Category)
+	}
+	if !IsClosed(fact.Status) {
+		addCount(t.Targets, fact.Target, severity, sign)
+	}
+	if fact.TriagedAt != nil {
+		t.addTriage(fact.CreatedAt, *fact.TriagedAt, sign)
+	}
+}
+
+func (t *Tally) clone() *Tally {
+	copied := NewTally()
+	for day, counts := range t.Daily {
+		for severity, count := range counts {
+			addCount(copied.Daily, day, severity, count)
+		}
+	}
+	for day, counts := range t.Suppressed {
+		for severity, count := range counts {
+			addCount(copied.Suppressed, day, severity, count)
+		}
+	}
+	for target, counts := range t.Targets {
+		for severity, count := range counts {
+			addCount(copied.Targets, target, severity, count)
+		}
+	}
+	for category, count := range t.Categories {
+		copied.Categories[category] = count
+	}
+	for day, sum := range t.Triage {
+		copied.Triage[day] = sum
+	}
+	return copied
+}
+
+// Aggregator keeps a tally per workspace up to date as findings change.
+type Aggregator struct {
+	tallies map[string]*Tally
+	mu      sync.Mutex
+}
+
+var Default = &Aggregator{tallies: make(map[string]*Tally)}
+
+// Apply replaces the previous version of a finding, nil for a new one, with
+// its current version in the tallies.
+func (a *Aggregator) Apply(before, after *Fact) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if before != nil {
+		a.tally(before.WorkspaceID).apply(before, -1)
+	}
+	if after != nil {
+		a.tally(after.WorkspaceID).apply(after, 1)
+	}
+}
+
+func (a *Aggregator) tally(workspaceID string) *Tally {
+	if a.tallies[workspaceID] == nil {
+		a.tallies[workspaceID] = NewTally()
+	}
+	return a.tallies[workspaceID]
+}
+
+// Tally returns a copy of a workspace's tally.
+func (a *Aggregator) Tally(workspaceID string) *Tally {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if tally, ok := a.tallies[workspaceID]; ok {
+		return tally.clone()
+	}
+	return NewTally()
+}
+
+type DayCount struct {
+	Date       string         `json:"date"`
+	Total      int            `json:"total"`
+	BySeverity map[string]int `json:"by_severity"`
+}
+
+type CategoryCount struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// TargetRisk scores a target by its open findings: the sum of their
+// SeverityWeights.
+type TargetRisk struct {
+	Target     string         `json:"target"`
+	Score      float64        `json:"score"`
+	Open       int            `json:"open"`
+	BySeverity map[string]int `json:"by_severity"`
+}
+
+// FindingReport is the findings part of the stats API. MeanTimeToTriage is
+// in seconds and nil when no finding in the period was triaged. Suppressed
+// counts the findings of the period suppressed as accepted risks, which
+// Total includes.
+type FindingReport struct {
+	PerDay               []DayCount      `json:"per_day"`
+	Total                int             `json:"total"`
+	Suppressed           int             `json:"suppressed"`
+	SuppressedBySeverity map[string]int  `json:"suppressed_by_severity"`
+	Triaged              int             `json:"triaged"`
+	MeanTimeToTriage     *float64        `json:"mean_time_to_triage_seconds"`
+	TopCategories        []CategoryCount `json:"top_categories"`
+	Targets              []TargetRisk    `json:"targets"`
+}
+
+// Report builds the findings report from a tally over the days from since to
+// until, with every day present, listing up to top categories and targets.
+func Report(t *Tally, since, until time.Time, top int) FindingReport {
+	report := FindingReport{
+		PerDay:               []DayCount{},
+		SuppressedBySeverity: make(map[string]int),
+		TopCategories:        []CategoryCount{},
+		Targets:              []TargetRisk{},
+	}
+
+	first := since.UTC().Format(dayLayout)
+	for day := since.UTC(); day.Format(dayLayout) <= until.UTC().Format(dayLayout); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dayLayout)
+		count := DayCount{Date: date, BySeverity: make(map[string]int)}
+		for severity, n := range t.Daily[date] {
+			count.BySeverity[severity] = n
+			count.Total += n
+		}
+		report.Total += count.Total
+		report.PerDay = append(report.PerDay, count)
+		for severity, n := range t.Suppressed[date] {
+			report.SuppressedBySeverity[severity] += n
+			report.Suppressed += n
+		}
+	}
+
+	var triage TriageSum
+	for day, sum := range t.Triage {
+		if day >= first {
+			triage.Seconds += sum.Seconds
+			triage.Count += sum.Count
+		}
+	}
+	if triage.Count > 0 {
+		mean := triage.Seconds / float64(triage.Count)
+		report.MeanTimeToTriage = &mean
+		report.Triaged = triage.Count
+	}
+
+	for category, count := range t.Categories {
+		report.TopCategories = append(report.TopCategories, CategoryCount{Category: category, Count: count})
+	}
+	sort.Slice(report.TopCategories, func(i, j int) bool {
+		a, b := report.TopCategories[i], report.TopCategories[j]
+		if a.Count == b.Count {
+			return a.Category < b.Category
+		}
+		return a.Count > b.Count
+	})
+
+	for target, counts := range t.Targets {
+		risk := TargetRisk{Target: target, BySeverity: make(map[string]int)}
+		for severity, n := range counts {
+			risk.BySeverity[severity] = n
+			risk.Open += n
+			risk.Score += SeverityWeights[severity] * float64(n)
+		}
+		report.Targets = append(report.Targets, risk)
+	}
+	sort.Slice(report.Targets, func(i, j int) bool {
+		a, b := report.Targets[i], report.Targets[j]
+		if a.Score == b.Score {
+			return a.Target < b.Target
+		}
+		return a.Score > b.Score
+	})
+
+	if top > 0 {
+		if len(report.TopCategories) > top {
+			report.TopCategories = report.TopCategories[:top]
+		}
+		if len(report.Targets) > top {
+			report.Targets = report.Targets[:top]
+		}
+	}
+	return report
+}
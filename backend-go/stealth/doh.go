@@ -0,0 +1,273 @@
+package stealth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Well-known DNS-over-HTTPS endpoints, selectable by name.
+var DoHProviders = map[string]string{
+	"cloudflare": "https://cloudflare-dns.com/dns-query",
+	"google":     "https://dns.google/dns-query",
+}
+
+const (
+	dohTimeout     = 5 * time.Second
+	dohMinCacheTTL = 30 * time.Second
+	dohMaxCacheTTL = 10 * time.Minute
+	dohMaxResponse = 64 * 1024
+)
+
+// ResolveDoHEndpoint returns the URL of a DoH provider name, or endpoint
+// itself when it is already an https URL.
+func ResolveDoHEndpoint(endpoint string) (string, error) {
+	endpoint = strings.TrimSpace(endpoint)
+	if url, ok := DoHProviders[strings.ToLower(endpoint)]; ok {
+		return url, nil
+	}
+	if !strings.HasPrefix(endpoint, "https://") {
+		return "", fmt.Errorf("DoH endpoint must be cloudflare, google or an https URL, got %q", endpoint)
+	}
+	return endpoint, nil
+}
+
+type dohEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// Resolver resolves hostnames with DNS-over-HTTPS (RFC 8484) queries to one
+// endpoint, caching answers for their TTL. When the endpoint fails and
+// Fallback is set, the system resolver answers instead.
+type Resolver struct {
+	Endpoint string
+	Fallback bool
+
+	client *http.Client
+	cache  map[string]dohEntry
+	mu     sync.Mutex
+}
+
+var (
+	resolvers   = make(map[string]*Resolver)
+	resolversMu sync.Mutex
+)
+
+// DoHResolver returns the shared resolver of an endpoint, a provider name
+// or an https URL, so that routes using the same endpoint share its cache.
+func DoHResolver(endpoint string, fallback bool) (*Resolver, error) {
+	url, err := ResolveDoHEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s|%t", url, fallback)
+
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	if resolver, ok := resolvers[key]; ok {
+		return resolver, nil
+	}
+	resolver := &Resolver{
+		Endpoint: url,
+		Fallback: fallback,
+		client:   &http.Client{Timeout: dohTimeout},
+		cache:    make(map[string]dohEntry),
+	}
+	resolvers[key] = resolver
+	return resolver, nil
+}
+
+// LookupHost returns the addresses of host, IPv4 first. IP literals are
+// returned as is.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	r.mu.Lock()
+	if entry, ok := r.cache[host]; ok && time.Now().Before(entry.expires) {
+		r.mu.Unlock()
+		return append([]string{}, entry.addrs...), nil
+	}
+	r.mu.Unlock()
+
+	addrs, ttl, err := r.query(ctx, host)
+	if err != nil {
+		if !r.Fallback {
+			return nil, err
+		}
+		log.Printf("Stealth: DoH lookup of %s failed, using system DNS: %v", host, err)
+		return net.DefaultResolver.LookupHost(ctx, host)
+	}
+
+	r.mu.Lock()
+	r.cache[host] = dohEntry{addrs: addrs, expires: time.Now().Add(ttl)}
+	r.mu.Unlock()
+	return append([]string{}, addrs...), nil
+}
+
+// query asks the endpoint for the A and AAAA records of host and returns the
+// addresses with the lowest TTL among them, clamped to the cache bounds.
+func (r *Resolver) query(ctx context.Context, host string) ([]string, time.Duration, error) {
+	var v4, v6 []string
+	ttl := dohMaxCacheTTL
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		addrs, answerTTL, err := r.exchange(ctx, host, qtype)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(addrs) > 0 && answerTTL < ttl {
+			ttl = answerTTL
+		}
+		if qtype == dnsmessage.TypeA {
+			v4 = addrs
+		} else {
+			v6 = addrs
+		}
+	}
+	addrs := append(v4, v6...)
+	if len(addrs) == 0 {
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	if ttl < dohMinCacheTTL {
+		ttl = dohMinCacheTTL
+	}
+	return addrs, ttl, nil
+}
+
+func (r *Resolver) exchange(ctx context.Context, host string, qtype dnsmessage.Type) ([]string, time.Duration, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	query, err := builder.Finish()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The ID is 0 as RFC 8484 recommends, so GET responses are cacheable.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.Endpoint+"?dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH endpoint returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dohMaxResponse))
+	if err != nil {
+		return nil, 0, err
+	}
+	return parseDoHAnswer(body, qtype)
+}
+
+func parseDoHAnswer(body []byte, qtype dnsmessage.Type) ([]string, time.Duration, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid DoH response: %w", err)
+	}
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	default:
+		return nil, 0, fmt.Errorf("DoH query failed: %s", header.RCode)
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return nil, 0, fmt.Errorf("invalid DoH response: %w", err)
+	}
+
+	var addrs []string
+	var ttl time.Duration
+	for {
+		answer, err := parser.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid DoH response: %w", err)
+		}
+		if answer.Type != qtype {
+			if err := parser.SkipAnswer(); err != nil {
+				return nil, 0, fmt.Errorf("invalid DoH response: %w", err)
+			}
+			continue
+		}
+
+		var ip net.IP
+		if qtype == dnsmessage.TypeA {
+			record, err := parser.AResource()
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid DoH response: %w", err)
+			}
+			ip = net.IP(record.A[:])
+		} else {
+			record, err := parser.AAAAResource()
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid DoH response: %w", err)
+			}
+			ip = net.IP(record.AAAA[:])
+		}
+		addrs = append(addrs, ip.String())
+		if answerTTL := time.Duration(answer.TTL) * time.Second; ttl == 0 || answerTTL < ttl {
+			ttl = answerTTL
+		}
+	}
+	return addrs, ttl, nil
+}
+
+// Dialer returns a dialer that resolves hostnames with r and dials the
+// addresses in turn through forward.
+func (r *Resolver) Dialer(forward Dialer) Dialer {
+	return &resolvingDialer{resolver: r, forward: forward}
+}
+
+type resolvingDialer struct {
+	resolver *Resolver
+	forward  Dialer
+}
+
+func (d *resolvingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.forward.DialContext(ctx, network, addr)
+	}
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range addrs {
+		conn, err := d.forward.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
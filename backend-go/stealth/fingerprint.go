@@ -0,0 +1,179 @@
+package stealth
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Header values picked once per fingerprint when header randomization is on,
+// so that consecutive requests of a session look like the same browser.
+// Accept-Encoding is left to the clients, which only decode what they ask
+// for themselves.
+var (
+	acceptValues = []string{
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		"text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8",
+		"*/*",
+	}
+	cacheControlValues = []string{"", "max-age=0", "no-cache"}
+)
+
+// Fingerprinter gives an agent session a stable browser fingerprint and the
+// request headers derived from it, switching to a new fingerprint every
+// RotateEvery requests. Zero keeps one fingerprint for the whole session.
+type Fingerprinter struct {
+	RotateEvery  int
+	UserAgent    bool
+	HeaderRandom bool
+
+	current  Fingerprint
+	extra    map[string]string
+	requests int
+	rotated  int
+	mu       sync.Mutex
+}
+
+// FingerprintStats describes an agent session's current fingerprint.
+type FingerprintStats struct {
+	Fingerprint Fingerprint       `json:"fingerprint"`
+	Headers     map[string]string `json:"headers"`
+	Requests    int               `json:"requests"`
+	Rotations   int               `json:"rotations"`
+	RotateEvery int               `json:"rotate_every"`
+}
+
+var (
+	fingerprinters   = make(map[string]*Fingerprinter)
+	fingerprintersMu sync.RWMutex
+)
+
+// SetFingerprinter registers the fingerprinter of an agent session.
+func SetFingerprinter(agentID string, f *Fingerprinter) {
+	fingerprintersMu.Lock()
+	defer fingerprintersMu.Unlock()
+	fingerprinters[agentID] = f
+}
+
+// FingerprinterFor returns the agent session's fingerprinter, or nil when its
+// requests keep the tools' own headers.
+func FingerprinterFor(agentID string) *Fingerprinter {
+	fingerprintersMu.RLock()
+	defer fingerprintersMu.RUnlock()
+	return fingerprinters[agentID]
+}
+
+// ForgetFingerprinter drops the fingerprinter of a deleted agent.
+func ForgetFingerprinter(agentID string) {
+	fingerprintersMu.Lock()
+	defer fingerprintersMu.Unlock()
+	delete(fingerprinters, agentID)
+}
+
+// NewFingerprinter returns a fingerprinter setting the User-Agent when
+// userAgent is set and the other browser headers when headers is set.
+func NewFingerprinter(rotateEvery int, userAgent, headers bool) *Fingerprinter {
+	if rotateEvery < 0 {
+		rotateEvery = 0
+	}
+	f := &Fingerprinter{RotateEvery: rotateEvery, UserAgent: userAgent, HeaderRandom: headers}
+	f.rotate()
+	return f
+}
+
+// rotate must be called with f.mu held, or before f is shared.
+func (f *Fingerprinter) rotate() {
+	f.current = GenerateFingerprint()
+	f.extra = map[string]string{
+		"Accept": acceptValues[rand.Intn(len(acceptValues))],
+	}
+	if value := cacheControlValues[rand.Intn(len(cacheControlValues))]; value != "" {
+		f.extra["Cache-Control"] = value
+	}
+	if rand.Intn(2) == 0 {
+		f.extra["Upgrade-Insecure-Requests"] = "1"
+	}
+}
+
+// headers must be called with f.mu held.
+func (f *Fingerprinter) headers() map[string]string {
+	headers := ApplyStealthHeaders(nil, f.current)
+	if !f.HeaderRandom {
+		return map[string]string{"User-Agent": headers["User-Agent"]}
+	}
+	for name, value := range f.extra {
+		headers[name] = value
+	}
+	if !f.UserAgent {
+		delete(headers, "User-Agent")
+	}
+	return headers
+}
+
+// Next counts one request and returns the headers it must carry, rotating
+// the fingerprint first when the previous one has been used RotateEvery
+// times.
+func (f *Fingerprinter) Next() map[string]string {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.RotateEvery > 0 && f.requests > 0 && f.requests%f.RotateEvery == 0 {
+		f.rotate()
+		f.rotated++
+	}
+	f.requests++
+	return f.headers()
+}
+
+// Stats reports the current fingerprint and how often it was used.
+func (f *Fingerprinter) Stats() FingerprintStats {
+	if f == nil {
+		return FingerprintStats{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return FingerprintStats{
+		Fingerprint: f.current,
+		Headers:     f.headers(),
+		Requests:    f.requests,
+		Rotations:   f.rotated,
+		RotateEvery: f.RotateEvery,
+	}
+}
+
+// SortedHeaderNames returns the names of headers in a stable order, for
+// building command lines.
+func SortedHeaderNames(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fingerprintTransport sets the fingerprint headers on every request that
+// does not set them itself.
+type fingerprintTransport struct {
+	base          http.RoundTripper
+	fingerprinter *Fingerprinter
+}
+
+func (t *fingerprintTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	headers := t.fingerprinter.Next()
+	if len(headers) > 0 {
+		req = req.Clone(req.Context())
+		for name, value := range headers {
+			if req.Header.Get(name) == "" {
+				req.Header.Set(name, value)
+			}
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,251 @@
+package stealth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jitterOnlyDelay is the base spacing between requests when timing jitter is
+// enabled without an explicit rate limit.
+const jitterOnlyDelay = 1000
+
+const rateWindow = 10 * time.Second
+
+var (
+	pacers   = make(map[string]*Pacer)
+	pacersMu sync.RWMutex
+)
+
+// SetPacer registers the pacer enforcing an operation's request rate.
+func SetPacer(operationID string, pacer *Pacer) {
+	pacersMu.Lock()
+	defer pacersMu.Unlock()
+	pacers[operationID] = pacer
+}
+
+// PacerFor returns the operation's pacer, or nil when it is unpaced.
+func PacerFor(operationID string) *Pacer {
+	pacersMu.RLock()
+	defer pacersMu.RUnlock()
+	return pacers[operationID]
+}
+
+// Pacer is a token bucket shared by all outbound requests of an operation.
+// A nil *Pacer never blocks.
+type Pacer struct {
+	rps     float64
+	burst   float64
+	jitter  bool
+	profile *TimingProfile
+	tokens  float64
+	last    time.Time
+	// nextSlot is the earliest time the timing profile lets the next
+	// request go out.
+	nextSlot time.Time
+
+	requests  int64
+	throttled int64
+	waited    time.Duration
+	recent    []time.Time
+	lastSent  time.Time
+	gapTotal  time.Duration
+	gaps      int64
+	mu        sync.Mutex
+}
+
+type PacerStats struct {
+	LimitRps   int     `json:"limit_rps"`
+	CurrentRps float64 `json:"current_rps"`
+	Requests   int64   `json:"requests"`
+	Throttled  int64   `json:"throttled"`
+	WaitedMs   int64   `json:"waited_ms"`
+	Jitter     bool    `json:"jitter"`
+	// AvgGapMs is the average time between consecutive requests.
+	AvgGapMs float64        `json:"avg_gap_ms"`
+	Profile  *TimingProfile `json:"timing_profile,omitempty"`
+}
+
+// NewPacer returns a pacer allowing rps requests per second (unlimited when
+// rps <= 0) with a burst of one second's worth of requests. When jitter is set
+// each request is additionally delayed by GetTimingJitter around the spacing.
+func NewPacer(rps int, jitter bool) *Pacer {
+	burst := float64(rps)
+	if burst < 1 {
+		burst = 1
+	}
+	return &Pacer{
+		rps:    float64(rps),
+		burst:  burst,
+		jitter: jitter,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// SetProfile schedules the pacer's requests along a timing profile, which
+// replaces the plain timing jitter. nil removes it.
+func (p *Pacer) SetProfile(profile *TimingProfile) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.profile = profile
+}
+
+// Limit returns the configured requests per second, or 0 when unlimited.
+func (p *Pacer) Limit() int {
+	if p == nil {
+		return 0
+	}
+	return int(p.rps)
+}
+
+// Wait blocks until the next request may be sent or ctx is done.
+func (p *Pacer) Wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+
+	delay := p.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pacer) reserve() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var delay time.Duration
+	if p.rps > 0 {
+		p.tokens += now.Sub(p.last).Seconds() * p.rps
+		if p.tokens > p.burst {
+			p.tokens = p.burst
+		}
+		p.last = now
+		p.tokens--
+		if p.tokens < 0 {
+			delay = time.Duration(-p.tokens / p.rps * float64(time.Second))
+		}
+	}
+
+	if p.profile != nil {
+		at := now.Add(delay)
+		if p.nextSlot.After(at) {
+			delay, at = p.nextSlot.Sub(now), p.nextSlot
+		}
+		p.nextSlot = at.Add(p.profile.Gap())
+	} else if p.jitter {
+		if p.rps <= 0 {
+			delay += time.Duration(GetTimingJitter(jitterOnlyDelay)) * time.Millisecond
+		} else if base := int(1000 / p.rps); base >= 2 {
+			// GetTimingJitter spreads around base; only the excess is added so
+			// the average rate stays close to the configured limit.
+			if extra := GetTimingJitter(base) - base; extra > 0 {
+				delay += time.Duration(extra) * time.Millisecond
+			}
+		}
+	}
+
+	p.requests++
+	if delay > 0 {
+		p.throttled++
+		p.waited += delay
+	}
+	sendAt := now.Add(delay)
+	if sendAt.After(p.lastSent) {
+		if !p.lastSent.IsZero() {
+			p.gapTotal += sendAt.Sub(p.lastSent)
+			p.gaps++
+		}
+		p.lastSent = sendAt
+	}
+	p.recent = append(p.recent, sendAt)
+	p.trimRecent(now)
+	return delay
+}
+
+func (p *Pacer) trimRecent(now time.Time) {
+	cutoff := now.Add(-rateWindow)
+	i := 0
+	for i < len(p.recent) && p.recent[i].Before(cutoff) {
+		i++
+	}
+	p.recent = p.recent[i:]
+}
+
+// Stats reports the pacer's configuration and the observed request rate over
+// the last ten seconds.
+func (p *Pacer) Stats() PacerStats {
+	if p == nil {
+		return PacerStats{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.trimRecent(now)
+	sent := 0
+	for _, t := range p.recent {
+		if !t.After(now) {
+			sent++
+		}
+	}
+
+	stats := PacerStats{
+		LimitRps:   int(p.rps),
+		CurrentRps: float64(sent) / rateWindow.Seconds(),
+		Requests:   p.requests,
+		Throttled:  p.throttled,
+		WaitedMs:   p.waited.Milliseconds(),
+		Jitter:     p.jitter,
+		Profile:    p.profile,
+	}
+	if p.gaps > 0 {
+		stats.AvgGapMs = float64(p.gapTotal.Milliseconds()) / float64(p.gaps)
+	}
+	return stats
+}
+
+// pacedTransport waits on the pacer before every round trip.
+type pacedTransport struct {
+	base  http.RoundTripper
+	pacer *Pacer
+}
+
+func (t *pacedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.pacer.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Client returns an HTTP client that follows the route (direct when r is nil),
+// is paced by pacer and carries fingerprinter's headers when it is not nil.
+// Backend-originated requests towards a target should be made through this
+// client.
+func (r *Route) Client(pacer *Pacer, fingerprinter *Fingerprinter) (*http.Client, error) {
+	dialer, err := r.Dialer(routeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	client := newHTTPClient(dialer, routeTimeout)
+	if fingerprinter != nil {
+		client.Transport = &fingerprintTransport{base: client.Transport, fingerprinter: fingerprinter}
+	}
+	if pacer != nil {
+		client.Transport = &pacedTransport{base: client.Transport, pacer: pacer}
+	}
+	return client, nil
+}
@@ -0,0 +1,216 @@
+package stealth
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// paddingPaths are requested as decoys: pages and assets any browser visit
+// fetches, which blend the operation's requests into ordinary traffic.
+var paddingPaths = []string{
+	"/", "/index.html", "/favicon.ico", "/robots.txt", "/sitemap.xml",
+	"/about", "/contact", "/css/style.css", "/js/main.js", "/images/logo.png",
+}
+
+const (
+	paddingTimeout  = 15 * time.Second
+	paddingMaxBody  = 256 * 1024
+	paddingMaxBurst = 10
+)
+
+var (
+	padders   = make(map[string]*Padder)
+	paddersMu sync.RWMutex
+)
+
+// SetPadder registers the padder of an operation.
+func SetPadder(operationID string, padder *Padder) {
+	paddersMu.Lock()
+	defer paddersMu.Unlock()
+	padders[operationID] = padder
+}
+
+// PadderFor returns the operation's padder, or nil when its traffic is not
+// padded.
+func PadderFor(operationID string) *Padder {
+	paddersMu.RLock()
+	defer paddersMu.RUnlock()
+	return padders[operationID]
+}
+
+// Padder interleaves dummy benign requests with an operation's real ones:
+// Ratio decoys per real request on average, towards the operation's web
+// targets, through the operation's route and pacer. A nil *Padder does
+// nothing.
+type Padder struct {
+	Ratio float64
+
+	bases  []string
+	client *http.Client
+	credit float64
+	sent   int64
+	failed int64
+	mu     sync.Mutex
+}
+
+// PaddingStats counts the decoy requests of an operation.
+type PaddingStats struct {
+	Ratio  float64 `json:"ratio"`
+	Sent   int64   `json:"sent"`
+	Failed int64   `json:"failed"`
+}
+
+// NewPadder returns a padder sending decoys to the web roots of targets
+// (hosts, IPs or URLs; CIDR ranges are skipped) with client, or nil when
+// none of the targets can be requested or ratio is not positive.
+func NewPadder(ratio float64, targets []string, client *http.Client) *Padder {
+	if ratio <= 0 {
+		return nil
+	}
+	bases := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if base := paddingBase(target); base != "" {
+			bases = append(bases, base)
+		}
+	}
+	if len(bases) == 0 {
+		return nil
+	}
+	return &Padder{Ratio: ratio, bases: bases, client: client}
+}
+
+// paddingBase returns the web root of a target, or "" when the target is not
+// a single host.
+func paddingBase(target string) string {
+	target = strings.TrimSpace(target)
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" {
+			return ""
+		}
+		return u.Scheme + "://" + u.Host
+	}
+	if target == "" || strings.ContainsAny(target, "/ *") {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return "http://" + target
+	}
+	if ip := net.ParseIP(target); ip != nil && ip.To4() == nil {
+		return "http://[" + target + "]"
+	}
+	return "http://" + target
+}
+
+// Pad records one real request and sends the decoys it earns in the
+// background. Fractional ratios accumulate across requests.
+func (p *Padder) Pad() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.credit += p.Ratio
+	count := int(p.credit)
+	p.credit -= float64(count)
+	p.mu.Unlock()
+
+	if count > paddingMaxBurst {
+		count = paddingMaxBurst
+	}
+	if count > 0 {
+		go p.send(count)
+	}
+}
+
+func (p *Padder) send(count int) {
+	for i := 0; i < count; i++ {
+		base := p.bases[rand.Intn(len(p.bases))]
+		target := base + paddingPaths[rand.Intn(len(paddingPaths))]
+
+		ctx, cancel := context.WithTimeout(context.Background(), paddingTimeout)
+		err := p.request(ctx, target)
+		cancel()
+
+		p.mu.Lock()
+		if err != nil {
+			p.failed++
+		} else {
+			p.sent++
+		}
+		p.mu.Unlock()
+		if err != nil {
+			log.Printf("Stealth: padding request to %s failed: %v", target, err)
+		}
+	}
+}
+
+func (p *Padder) request(ctx context.Context, target string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Read the body like a browser would, so the decoy is a full exchange.
+	_, err = io.Copy(io.Discard, io.LimitReader(resp.Body, paddingMaxBody))
+	return err
+}
+
+// Stats reports how many decoys were sent.
+func (p *Padder) Stats() PaddingStats {
+	if p == nil {
+		return PaddingStats{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PaddingStats{Ratio: p.Ratio, Sent: p.sent, Failed: p.failed}
+}
+
+// NoiseReport summarizes the traffic an operation put on the wire.
+type NoiseReport struct {
+	// Requests counts every outbound request, decoys included.
+	Requests        int64          `json:"requests"`
+	RealRequests    int64          `json:"real_requests"`
+	PaddingRequests int64          `json:"padding_requests"`
+	PaddingFailed   int64          `json:"padding_failed"`
+	PaddingRatio    float64        `json:"padding_ratio"`
+	AvgGapMs        float64        `json:"avg_gap_ms"`
+	CurrentRps      float64        `json:"current_rps"`
+	TimingProfile   *TimingProfile `json:"timing_profile,omitempty"`
+	Padding         bool           `json:"padding"`
+}
+
+// Noise builds the noise report of an operation from its pacer and padder.
+// PaddingRatio is the share of decoys among all requests.
+func Noise(pacer *Pacer, padder *Padder) NoiseReport {
+	rate, padding := pacer.Stats(), padder.Stats()
+	report := NoiseReport{
+		Requests:        rate.Requests,
+		PaddingRequests: padding.Sent,
+		PaddingFailed:   padding.Failed,
+		AvgGapMs:        rate.AvgGapMs,
+		CurrentRps:      rate.CurrentRps,
+		TimingProfile:   rate.Profile,
+		Padding:         padder != nil,
+	}
+	decoys := padding.Sent + padding.Failed
+	report.RealRequests = report.Requests - decoys
+	if report.RealRequests < 0 {
+		report.RealRequests = 0
+	}
+	if report.Requests > 0 {
+		report.PaddingRatio = float64(decoys) / float64(report.Requests)
+	}
+	return report
+}
@@ -0,0 +1,287 @@
+package stealth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const routeTimeout = 30 * time.Second
+
+// httpTools honour the standard proxy environment variables, so a single-hop
+// route can be applied to them without proxychains.
+var httpTools = map[string]bool{
+	"curl": true, "wget": true, "httpx": true, "nuclei": true, "ffuf": true,
+	"gobuster": true, "whatweb": true, "wpscan": true, "wafw00f": true,
+	"subfinder": true, "dnsx": true, "naabu": true,
+}
+
+// ProxyAware reports whether a tool honours the standard proxy environment
+// variables.
+func ProxyAware(tool string) bool {
+	return httpTools[tool]
+}
+
+// Route is the outbound path an operation's traffic takes: an ordered list of
+// proxy hops, with Tor as the first hop when enabled. With a Resolver,
+// hostnames the backend resolves itself, including the proxies', are looked
+// up over DNS-over-HTTPS; hostnames of targets reached through a proxy are
+// still resolved by the proxy.
+type Route struct {
+	Proxies  []string
+	Tor      bool
+	Resolver *Resolver
+}
+
+// ConnectivityReport is the result of probing a route.
+type ConnectivityReport struct {
+	Routed    bool      `json:"routed"`
+	Hops      int       `json:"hops"`
+	Tor       bool      `json:"tor"`
+	ExitIP    string    `json:"exit_ip,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+var (
+	routes   = make(map[string]*Route)
+	routesMu sync.RWMutex
+)
+
+// SetRoute registers the route used by an operation's outbound traffic.
+func SetRoute(operationID string, route *Route) {
+	routesMu.Lock()
+	defer routesMu.Unlock()
+	routes[operationID] = route
+}
+
+// RouteFor returns the operation's route, or nil for direct traffic.
+func RouteFor(operationID string) *Route {
+	routesMu.RLock()
+	defer routesMu.RUnlock()
+	return routes[operationID]
+}
+
+// NewRoute validates and assembles a route. torAddr is the local Tor SOCKS
+// listener and is only used when tor is set.
+func NewRoute(proxies []string, tor bool, torAddr string) (*Route, error) {
+	hops := make([]string, 0, len(proxies)+1)
+	if tor {
+		if torAddr == "" {
+			torAddr = "127.0.0.1:9050"
+		}
+		hops = append(hops, "socks5h://"+torAddr)
+	}
+	hops = append(hops, proxies...)
+
+	if _, err := ChainDialer(hops, routeTimeout); err != nil {
+		return nil, err
+	}
+	return &Route{Proxies: hops, Tor: tor}, nil
+}
+
+// Enabled reports whether traffic on this route goes through any proxy.
+func (r *Route) Enabled() bool {
+	return r != nil && len(r.Proxies) > 0
+}
+
+// DoH reports whether hostnames on this route are resolved over
+// DNS-over-HTTPS.
+func (r *Route) DoH() bool {
+	return r != nil && r.Resolver != nil
+}
+
+// Dialer returns a dialer that follows the route (direct when r is nil).
+func (r *Route) Dialer(timeout time.Duration) (Dialer, error) {
+	var base Dialer = &net.Dialer{Timeout: timeout}
+	if r == nil {
+		return base, nil
+	}
+	if r.Resolver != nil {
+		base = r.Resolver.Dialer(base)
+	}
+	return chainDialer(base, r.Proxies)
+}
+
+// lookupHost resolves host with the route's resolver, or the system one.
+func (r *Route) lookupHost(host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), routeTimeout)
+	defer cancel()
+	if r.DoH() {
+		return r.Resolver.LookupHost(ctx, host)
+	}
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// Check connects through the route to checkURL and reports the exit IP seen
+// by the remote end. checkURL must return either a bare IP or {"ip": "..."}.
+func (r *Route) Check(checkURL string) ConnectivityReport {
+	report := ConnectivityReport{
+		Routed:    r.Enabled(),
+		CheckedAt: time.Now(),
+	}
+	if r != nil {
+		report.Hops = len(r.Proxies)
+		report.Tor = r.Tor
+	}
+	client, err := r.Client(nil, nil)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	start := time.Now()
+	resp, err := client.Get(checkURL)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	defer resp.Body.Close()
+	report.LatencyMs = time.Since(start).Milliseconds()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	if resp.StatusCode != 200 {
+		report.Error = fmt.Sprintf("exit IP check returned status %d", resp.StatusCode)
+		return report
+	}
+
+	var parsed struct {
+		IP     string `json:"ip"`
+		Origin string `json:"origin"`
+	}
+	text := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &parsed) == nil {
+		text = parsed.IP
+		if text == "" {
+			text = parsed.Origin
+		}
+	}
+	if net.ParseIP(text) == nil {
+		report.Error = "exit IP check returned an unexpected response"
+		return report
+	}
+	report.ExitIP = text
+	return report
+}
+
+// Env returns proxy environment variables for a single-hop route. Multi-hop
+// routes cannot be expressed through the environment and return nil.
+func (r *Route) Env() []string {
+	if !r.Enabled() || len(r.Proxies) != 1 {
+		return nil
+	}
+
+	proxy := r.Proxies[0]
+	// Resolve hostnames on the proxy side so DNS lookups follow the route.
+	if strings.HasPrefix(proxy, "socks5://") {
+		proxy = "socks5h://" + strings.TrimPrefix(proxy, "socks5://")
+	}
+	return []string{
+		"ALL_PROXY=" + proxy, "all_proxy=" + proxy,
+		"HTTP_PROXY=" + proxy, "http_proxy=" + proxy,
+		"HTTPS_PROXY=" + proxy, "https_proxy=" + proxy,
+		"NO_PROXY=", "no_proxy=",
+	}
+}
+
+// Wrap rewrites a tool invocation so its traffic follows the route. Tools are
+// run under proxychains when it is installed; otherwise single-hop routes fall
+// back to proxy environment variables for HTTP tools. Anything that cannot be
+// routed is refused rather than sent directly. On a direct route with DoH,
+// curl is pointed at the DoH endpoint; other tools use the system resolver.
+// The returned cleanup func must be called once the command has finished.
+func (r *Route) Wrap(argv []string) ([]string, []string, func(), error) {
+	noop := func() {}
+	if len(argv) == 0 {
+		return argv, nil, noop, nil
+	}
+	if !r.Enabled() {
+		if r.DoH() && argv[0] == "curl" {
+			wrapped := append([]string{argv[0], "--doh-url", r.Resolver.Endpoint}, argv[1:]...)
+			return wrapped, nil, noop, nil
+		}
+		return argv, nil, noop, nil
+	}
+
+	if binary := proxychainsBinary(); binary != "" {
+		confPath, err := r.writeProxychainsConfig()
+		if err != nil {
+			return nil, nil, noop, err
+		}
+		wrapped := append([]string{binary, "-q", "-f", confPath}, argv...)
+		return wrapped, nil, func() { os.Remove(confPath) }, nil
+	}
+
+	if httpTools[argv[0]] && len(r.Proxies) == 1 {
+		return argv, r.Env(), noop, nil
+	}
+
+	return nil, nil, noop, fmt.Errorf("%s cannot be routed through the configured proxy chain (install proxychains4)", argv[0])
+}
+
+func proxychainsBinary() string {
+	for _, name := range []string{"proxychains4", "proxychains"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func (r *Route) writeProxychainsConfig() (string, error) {
+	var b strings.Builder
+	b.WriteString("strict_chain\nproxy_dns\ntcp_read_time_out 15000\ntcp_connect_time_out 8000\n\n[ProxyList]\n")
+
+	for _, raw := range r.Proxies {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", err
+		}
+		host, port, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			return "", fmt.Errorf("proxy %q must include a port", raw)
+		}
+		if ip := net.ParseIP(host); ip == nil {
+			addrs, err := r.lookupHost(host)
+			if err != nil || len(addrs) == 0 {
+				return "", fmt.Errorf("cannot resolve proxy host %q", host)
+			}
+			host = addrs[0]
+		}
+
+		kind := "socks5"
+		if u.Scheme == "http" {
+			kind = "http"
+		}
+		line := kind + " " + host + " " + port
+		if u.User != nil {
+			password, _ := u.User.Password()
+			line += " " + u.User.Username() + " " + password
+		}
+		b.WriteString(line + "\n")
+	}
+
+	f, err := os.CreateTemp("", "performa-proxychains-*.conf")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(b.String()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
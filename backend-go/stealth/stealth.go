@@ -29,6 +29,7 @@ type Capabilities struct {
 	ARPSpoof          bool `json:"arp_spoof"`
 	SessionHijack     bool `json:"session_hijack"`
 	CredentialCapture bool `json:"credential_capture"`
+	Exploitation      bool `json:"exploitation"`
 }
 
 type BrowserProfile struct {
@@ -197,5 +198,6 @@ func DefaultCapabilities() Capabilities {
 		ARPSpoof:          false,
 		SessionHijack:     false,
 		CredentialCapture: false,
+		Exploitation:      false,
 	}
 }
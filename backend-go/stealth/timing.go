@@ -0,0 +1,53 @@
+package stealth
+
+import (
+	"math/rand"
+	"time"
+)
+
+// TimingProfile is a low-and-slow scheduling curve: consecutive requests of
+// an operation are at least MinGapMs apart, with the rest of the gap drawn
+// from an exponential distribution so that gaps average MeanGapMs and
+// requests arrive irregularly instead of at a fixed rate.
+type TimingProfile struct {
+	Name      string `json:"name"`
+	MinGapMs  int64  `json:"min_gap_ms"`
+	MeanGapMs int64  `json:"mean_gap_ms"`
+}
+
+// timingProfiles maps aggressiveness levels to their curve. Level 5 has none
+// and is only bound by the rate limit.
+var timingProfiles = map[int]TimingProfile{
+	1: {Name: "paranoid", MinGapMs: 5000, MeanGapMs: 15000},
+	2: {Name: "sneaky", MinGapMs: 2000, MeanGapMs: 5000},
+	3: {Name: "polite", MinGapMs: 400, MeanGapMs: 1000},
+	4: {Name: "normal", MinGapMs: 0, MeanGapMs: 200},
+}
+
+// TimingProfileFor returns the curve of an aggressiveness level, or nil for
+// levels without one.
+func TimingProfileFor(level int) *TimingProfile {
+	profile, ok := timingProfiles[level]
+	if !ok {
+		return nil
+	}
+	return &profile
+}
+
+// Gap draws the spacing before the next request. The exponential tail is
+// capped at four times its mean so a single request is never held for long.
+func (p *TimingProfile) Gap() time.Duration {
+	if p == nil {
+		return 0
+	}
+	minGap := time.Duration(p.MinGapMs) * time.Millisecond
+	spread := time.Duration(p.MeanGapMs)*time.Millisecond - minGap
+	if spread <= 0 {
+		return minGap
+	}
+	extra := time.Duration(rand.ExpFloat64() * float64(spread))
+	if extra > 4*spread {
+		extra = 4 * spread
+	}
+	return minGap + extra
+}
@@ -0,0 +1,218 @@
+package stealth
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Dialer is the subset of net.Dialer used to build proxy chains.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// proxyHop tunnels connections through one proxy, reaching the proxy itself
+// via the previous hop.
+type proxyHop struct {
+	proxy   *url.URL
+	forward Dialer
+}
+
+// ChainDialer returns a dialer that connects through each proxy in order.
+// Supported schemes are socks5, socks5h and http.
+func ChainDialer(proxies []string, timeout time.Duration) (Dialer, error) {
+	return chainDialer(&net.Dialer{Timeout: timeout}, proxies)
+}
+
+// chainDialer builds a proxy chain whose first hop is reached through base.
+func chainDialer(dialer Dialer, proxies []string) (Dialer, error) {
+	for _, raw := range proxies {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", raw)
+		}
+		switch u.Scheme {
+		case "socks5", "socks5h", "http":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+		dialer = &proxyHop{proxy: u, forward: dialer}
+	}
+	return dialer, nil
+}
+
+func (h *proxyHop) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := h.forward.DialContext(ctx, "tcp", h.proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s unreachable: %w", h.proxy.Host, err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	switch h.proxy.Scheme {
+	case "http":
+		err = httpConnect(conn, h.proxy, addr)
+	default:
+		err = socks5Connect(conn, h.proxy, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", h.proxy.Host, err)
+	}
+	return conn, nil
+}
+
+func httpConnect(conn net.Conn, proxy *url.URL, addr string) error {
+	req := "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	req += "\r\n"
+	if _, err := io.WriteString(conn, req); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("CONNECT failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// socks5Connect performs a SOCKS5 CONNECT (RFC 1928) with optional
+// username/password authentication (RFC 1929). Hostnames are always resolved
+// by the proxy so DNS does not leak outside the chain.
+func socks5Connect(conn net.Conn, proxy *url.URL, addr string) error {
+	methods := []byte{0x00}
+	if proxy.User != nil {
+		methods = []byte{0x00, 0x02}
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return fmt.Errorf("not a SOCKS5 proxy")
+	}
+
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if proxy.User == nil {
+			return fmt.Errorf("proxy requires authentication")
+		}
+		username := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		auth := []byte{0x01, byte(len(username))}
+		auth = append(auth, username...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return fmt.Errorf("SOCKS5 authentication failed")
+		}
+	default:
+		return fmt.Errorf("no acceptable SOCKS5 auth method")
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(req, 0x01)
+		req = append(req, ip.To4()...)
+	} else if ip != nil {
+		req = append(req, 0x04)
+		req = append(req, ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("hostname too long")
+		}
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0x00 {
+		return fmt.Errorf("SOCKS5 connect failed with code %d", header[1])
+	}
+
+	var skip int
+	switch header[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return fmt.Errorf("invalid SOCKS5 bind address type")
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// NewHTTPClient returns an HTTP client whose connections are made through the
+// given proxy chain. An empty chain dials directly.
+func NewHTTPClient(proxies []string, timeout time.Duration) (*http.Client, error) {
+	dialer, err := ChainDialer(proxies, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return newHTTPClient(dialer, timeout), nil
+}
+
+func newHTTPClient(dialer Dialer, timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		Proxy:               nil,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     60 * time.Second,
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
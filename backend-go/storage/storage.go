@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+type Object struct {
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// Backend is implemented by every object store the backend can persist
+// findings, reports and attachments to. Keys always use forward slashes.
+type Backend interface {
+	Name() string
+	Put(key string, data []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	List(prefix string) ([]Object, error)
+	PresignGet(key string, expiry time.Duration) (string, error)
+}
+
+type Config struct {
+	Backend    string
+	LocalRoot  string
+	SigningKey string
+
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3Prefix    string
+	S3PathStyle bool
+}
+
+var Default Backend
+
+// Init selects the storage backend described by cfg and installs it as Default.
+func Init(cfg Config) (Backend, error) {
+	var backend Backend
+	var err error
+
+	switch strings.ToLower(cfg.Backend) {
+	case "", "local":
+		backend, err = NewLocal(cfg.LocalRoot, cfg.SigningKey)
+	case "s3":
+		backend, err = NewS3(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	Default = backend
+	return backend, nil
+}
+
+// CleanKey normalises an object key and rejects keys that would escape the
+// storage root.
+func CleanKey(key string) (string, error) {
+	key = strings.ReplaceAll(key, "\\", "/")
+	cleaned := path.Clean("/" + key)
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" || cleaned == "." {
+		return "", fmt.Errorf("empty storage key")
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("invalid storage key %q", key)
+		}
+	}
+	return cleaned, nil
+}
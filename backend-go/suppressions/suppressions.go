@@ -0,0 +1,293 @@
+// Package suppressions keeps the accepted-risk register: approved, justified
+// suppressions that mark newly reported findings matching a known accepted
+// risk as suppressed instead of new, until they expire.
+package suppressions
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+	"performa-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// Suppression accepts the risk of the findings it matches. A finding matches
+// when every criterion set holds: its fingerprint (see
+// models.FindingFingerprint), its target, exactly or as a glob such as
+// "*.example.com", and its category, both ignoring case.
+type Suppression struct {
+	ID            string     `json:"id"`
+	WorkspaceID   string     `json:"workspace_id"`
+	Fingerprint   string     `json:"fingerprint,omitempty"`
+	Target        string     `json:"target,omitempty"`
+	Category      string     `json:"category,omitempty"`
+	Justification string     `json:"justification"`
+	Approver      string     `json:"approver"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	CreatedBy     string     `json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	// Suppressed counts the findings the suppression suppressed.
+	Suppressed    int        `json:"suppressed"`
+	LastMatchedAt *time.Time `json:"last_matched_at,omitempty"`
+}
+
+// Validate checks the suppression has criteria, a justification and an
+// approver.
+func (s *Suppression) Validate() error {
+	s.Fingerprint = strings.ToLower(strings.TrimSpace(s.Fingerprint))
+	s.Target = strings.TrimSpace(s.Target)
+	s.Category = strings.TrimSpace(s.Category)
+	s.Justification = strings.TrimSpace(s.Justification)
+	s.Approver = strings.TrimSpace(s.Approver)
+	if s.Fingerprint == "" && s.Target == "" && s.Category == "" {
+		return fmt.Errorf("at least one of fingerprint, target and category is required")
+	}
+	if _, err := path.Match(strings.ToLower(s.Target), ""); err != nil {
+		return fmt.Errorf("invalid target pattern: %v", err)
+	}
+	if s.Justification == "" {
+		return fmt.Errorf("justification is required")
+	}
+	if s.Approver == "" {
+		return fmt.Errorf("approver is required")
+	}
+	return nil
+}
+
+// Active reports whether the suppression has not expired at now.
+func (s *Suppression) Active(now time.Time) bool {
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
+// Matches reports whether the finding meets the suppression's criteria.
+func (s *Suppression) Matches(finding *models.Finding) bool {
+	if s.Fingerprint != "" && s.Fingerprint != models.FindingFingerprint(finding.Title, finding.Target) {
+		return false
+	}
+	if s.Target != "" {
+		pattern, target := strings.ToLower(s.Target), strings.ToLower(strings.TrimSpace(finding.Target))
+		if matched, _ := path.Match(pattern, target); !matched && pattern != target {
+			return false
+		}
+	}
+	return s.Category == "" || strings.EqualFold(s.Category, finding.Category)
+}
+
+func (s *Suppression) clone() *Suppression {
+	copied := *s
+	return &copied
+}
+
+// Store keeps the register of every workspace.
+type Store struct {
+	suppressions map[string]*Suppression
+	mu           sync.RWMutex
+}
+
+var Default = &Store{suppressions: make(map[string]*Suppression)}
+
+func (s *Store) Create(suppression Suppression) (*Suppression, error) {
+	if err := suppression.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	suppression.ID = uuid.New().String()
+	suppression.CreatedAt = now
+	suppression.UpdatedAt = now
+	suppression.Suppressed = 0
+	suppression.LastMatchedAt = nil
+	stored := suppression.clone()
+
+	s.mu.Lock()
+	s.suppressions[stored.ID] = stored
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return stored.clone(), nil
+}
+
+func (s *Store) Get(id string) *Suppression {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if suppression, ok := s.suppressions[id]; ok {
+		return suppression.clone()
+	}
+	return nil
+}
+
+// List returns the workspace's suppressions, newest first, only the active
+// ones unless all is set.
+func (s *Store) List(workspaceID string, all bool) []*Suppression {
+	now := time.Now()
+	s.mu.RLock()
+	list := make([]*Suppression, 0)
+	for _, suppression := range s.suppressions {
+		if suppression.WorkspaceID == workspaceID && (all || suppression.Active(now)) {
+			list = append(list, suppression.clone())
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Update applies fn to a copy of the suppression, validates it and stores
+// the result. It returns nil, nil when the suppression does not exist.
+func (s *Store) Update(id string, fn func(suppression *Suppression)) (*Suppression, error) {
+	s.mu.Lock()
+	existing, ok := s.suppressions[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	updated := existing.clone()
+	fn(updated)
+	if err := updated.Validate(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	updated.ID = id
+	updated.WorkspaceID = existing.WorkspaceID
+	updated.CreatedBy = existing.CreatedBy
+	updated.CreatedAt = existing.CreatedAt
+	updated.Suppressed = existing.Suppressed
+	updated.LastMatchedAt = existing.LastMatchedAt
+	updated.UpdatedAt = time.Now()
+	s.suppressions[id] = updated
+	stored := updated.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return stored, nil
+}
+
+// Delete revokes a suppression. The findings it suppressed keep their
+// status.
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.suppressions[id]
+	delete(s.suppressions, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		if err := database.DeleteSuppression(id); err != nil {
+			log.Printf("Suppressions: failed to delete suppression %s: %v", id, err)
+		}
+	}
+	return exists
+}
+
+// Match returns the oldest active suppression of the finding's workspace
+// that matches it, or nil.
+func (s *Store) Match(finding *models.Finding) *Suppression {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var match *Suppression
+	for _, suppression := range s.suppressions {
+		if suppression.WorkspaceID != finding.WorkspaceID || !suppression.Active(now) || !suppression.Matches(finding) {
+			continue
+		}
+		if match == nil || suppression.CreatedAt.Before(match.CreatedAt) {
+			match = suppression
+		}
+	}
+	if match == nil {
+		return nil
+	}
+	return match.clone()
+}
+
+// Apply suppresses a finding about to be stored, before being its previous
+// version, when it is being reported with status "new" and an active
+// suppression matches it.
+func (s *Store) Apply(before, finding *models.Finding) bool {
+	if before != nil || finding.Status != "new" {
+		return false
+	}
+	suppression := s.Match(finding)
+	if suppression == nil {
+		return false
+	}
+	Suppress(finding, suppression)
+	s.RecordMatches(suppression.ID, 1)
+	return true
+}
+
+// Suppress marks the finding as suppressed by the suppression.
+func Suppress(finding *models.Finding, suppression *Suppression) {
+	finding.Status = models.FindingStatusSuppressed
+	finding.SuppressionID = suppression.ID
+}
+
+// RecordMatches counts n findings suppressed by the suppression.
+func (s *Store) RecordMatches(id string, n int) {
+	s.mu.Lock()
+	suppression, ok := s.suppressions[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	suppression.Suppressed += n
+	suppression.LastMatchedAt = &now
+	stored := suppression.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+}
+
+func (s *Store) persist(suppression *Suppression) {
+	if database.DB == nil {
+		return
+	}
+	data, err := json.Marshal(suppression)
+	if err != nil {
+		return
+	}
+	record := database.SuppressionRecord{
+		ID:          suppression.ID,
+		WorkspaceID: suppression.WorkspaceID,
+		Data:        data,
+		CreatedAt:   suppression.CreatedAt,
+		UpdatedAt:   suppression.UpdatedAt,
+	}
+	if err := database.SaveSuppression(record); err != nil {
+		log.Printf("Suppressions: failed to persist suppression %s: %v", suppression.ID, err)
+	}
+}
+
+// Load restores the register from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+	records, err := database.GetAllSuppressions()
+	if err != nil {
+		log.Printf("Suppressions: failed to load suppressions: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		var suppression Suppression
+		if err := json.Unmarshal(record.Data, &suppression); err != nil {
+			log.Printf("Suppressions: skipping suppression %s: %v", record.ID, err)
+			continue
+		}
+		s.suppressions[suppression.ID] = &suppression
+	}
+}
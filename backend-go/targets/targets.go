@@ -0,0 +1,196 @@
+// Package targets parses and expands the target lists operations run against:
+// hostnames, IP addresses, CIDR ranges and URLs.
+package targets
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// MaxExpanded caps how many targets a list may expand to, so a stray /8 does
+// not spawn millions of agents' worth of work.
+const MaxExpanded = 1024
+
+// Expand validates entries and expands CIDR ranges into their host addresses.
+// Hostnames, IPs and URLs pass through unchanged. The result keeps the input
+// order with duplicates removed.
+func Expand(entries []string) ([]string, error) {
+	seen := make(map[string]bool)
+	expanded := make([]string, 0, len(entries))
+	add := func(target string) error {
+		if seen[target] {
+			return nil
+		}
+		if len(expanded) == MaxExpanded {
+			return fmt.Errorf("targets expand to more than %d hosts", MaxExpanded)
+		}
+		seen[target] = true
+		expanded = append(expanded, target)
+		return nil
+	}
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			hosts, err := expandPrefix(prefix)
+			if err != nil {
+				return nil, err
+			}
+			for _, host := range hosts {
+				if err := add(host); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		target, err := normalize(entry)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(target); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(expanded) == 0 {
+		return nil, fmt.Errorf("no targets given")
+	}
+	return expanded, nil
+}
+
+// expandPrefix lists the usable host addresses of a CIDR range, leaving out
+// the network and broadcast addresses of IPv4 ranges larger than a /31.
+func expandPrefix(prefix netip.Prefix) ([]string, error) {
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 16 || 1<<hostBits > MaxExpanded+2 {
+		return nil, fmt.Errorf("CIDR %s is too large to expand (limit %d hosts)", prefix, MaxExpanded)
+	}
+
+	var hosts []string
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, addr.String())
+		if !addr.Next().IsValid() {
+			break
+		}
+	}
+	if prefix.Addr().Is4() && hostBits > 1 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// normalize checks a single hostname, IP or URL target and lower-cases
+// hostnames so the same host is not scanned twice.
+func normalize(entry string) (string, error) {
+	if strings.Contains(entry, "://") {
+		u, err := url.Parse(entry)
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid URL target %q", entry)
+		}
+		u.Host = strings.ToLower(u.Host)
+		return u.String(), nil
+	}
+
+	if addr, err := netip.ParseAddr(entry); err == nil {
+		return addr.String(), nil
+	}
+
+	host := entry
+	if h, port, err := net.SplitHostPort(entry); err == nil {
+		host = h
+		if port == "" {
+			return "", fmt.Errorf("invalid target %q", entry)
+		}
+	}
+	if !validHostname(host) {
+		return "", fmt.Errorf("invalid target %q", entry)
+	}
+	return strings.ToLower(entry), nil
+}
+
+func validHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Parse reads a targets file: either one target per line or CSV. In a CSV
+// file the column headed target, host, url or ip is used when there is one,
+// otherwise the first column. Blank lines and lines starting with # are
+// skipped.
+func Parse(data []byte) ([]string, error) {
+	if !bytes.Contains(data, []byte(",")) {
+		var entries []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		return entries, nil
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var entries []string
+	column := 0
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		if row == 0 {
+			if header := headerColumn(record); header >= 0 {
+				column = header
+				continue
+			}
+		}
+		if column < len(record) {
+			if value := strings.TrimSpace(record[column]); value != "" {
+				entries = append(entries, value)
+			}
+		}
+	}
+	return entries, nil
+}
+
+func headerColumn(record []string) int {
+	for i, field := range record {
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "target", "host", "hostname", "url", "ip", "address":
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,350 @@
+package telemetry
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxQueuedEvents bounds the events waiting to be shipped; events
+	// emitted while the queue is full are dropped.
+	maxQueuedEvents = 4096
+	// redialInterval is how long the shipper waits before reconnecting
+	// after a failed connection or write.
+	redialInterval = 5 * time.Second
+	// facilityLocal0 is the syslog facility of every message.
+	facilityLocal0 = 16
+	// structuredDataID names the SD-ELEMENT of RFC 5424 messages; the
+	// number is the private enterprise number reserved for examples.
+	structuredDataID = "performa@32473"
+)
+
+// Event categories.
+const (
+	CategoryOperation  = "operation"
+	CategoryNetwork    = "network"
+	CategoryCredential = "credential"
+	CategoryAuth       = "auth"
+)
+
+// Outcomes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is an audit or operation event shipped to syslog. Severity ranges
+// from 0 to 10 as in CEF and is mapped onto a syslog severity for RFC 5424
+// messages.
+type Event struct {
+	Time        time.Time
+	Category    string
+	Action      string
+	Severity    int
+	Outcome     string
+	Actor       string
+	SourceIP    string
+	Workspace   string
+	OperationID string
+	Message     string
+	Fields      map[string]string
+}
+
+var shipper atomic.Pointer[syslogShipper]
+
+// Emit queues event for syslog. It never blocks.
+func Emit(event Event) {
+	s := shipper.Load()
+	if s == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case s.queue <- event:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// syslogShipper writes events to one syslog receiver. A failed write drops
+// the event and closes the connection; the next event reconnects.
+type syslogShipper struct {
+	network  string
+	address  string
+	format   string
+	appName  string
+	version  string
+	hostname string
+
+	queue   chan Event
+	done    chan struct{}
+	stopped sync.WaitGroup
+	dropped atomic.Int64
+
+	conn     net.Conn
+	lastDial time.Time
+}
+
+func newSyslogShipper(network, address, format string, cfg Config) *syslogShipper {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &syslogShipper{
+		network:  network,
+		address:  address,
+		format:   format,
+		appName:  cfg.ServiceName,
+		version:  cfg.ServiceVersion,
+		hostname: hostname,
+		queue:    make(chan Event, maxQueuedEvents),
+		done:     make(chan struct{}),
+	}
+	s.stopped.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *syslogShipper) run() {
+	defer s.stopped.Done()
+	for {
+		select {
+		case event := <-s.queue:
+			s.write(event)
+		case <-s.done:
+			for {
+				select {
+				case event := <-s.queue:
+					s.write(event)
+				default:
+					if s.conn != nil {
+						s.conn.Close()
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *syslogShipper) stop() {
+	close(s.done)
+	s.stopped.Wait()
+}
+
+func (s *syslogShipper) write(event Event) {
+	if dropped := s.dropped.Swap(0); dropped > 0 {
+		log.Printf("Telemetry: dropped %d syslog events, the queue was full", dropped)
+	}
+	if s.conn == nil {
+		if time.Since(s.lastDial) < redialInterval {
+			return
+		}
+		s.lastDial = time.Now()
+		conn, err := s.dial()
+		if err != nil {
+			log.Printf("Telemetry: syslog receiver %s unreachable: %v", s.address, err)
+			return
+		}
+		s.conn = conn
+	}
+
+	message := s.message(event)
+	if s.network != "udp" {
+		// Stream transports separate messages with a newline (RFC 6587
+		// non-transparent framing), which every receiver accepts.
+		message += "\n"
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(redialInterval))
+	if _, err := s.conn.Write([]byte(message)); err != nil {
+		log.Printf("Telemetry: failed to ship event to syslog: %v", err)
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *syslogShipper) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: redialInterval}
+	if s.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.address, &tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	return dialer.Dial(s.network, s.address)
+}
+
+// message renders event as an RFC 5424 message. In CEF format the message
+// body is the CEF record.
+func (s *syslogShipper) message(event Event) string {
+	priority := facilityLocal0*8 + syslogSeverity(event.Severity)
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s", priority, event.Time.UTC().Format(time.RFC3339Nano),
+		s.hostname, headerField(s.appName), os.Getpid(), headerField(event.Category))
+
+	if s.format == FormatCEF {
+		return header + " - " + s.cef(event)
+	}
+	message := header + " " + structuredData(event)
+	if event.Message != "" {
+		message += " " + event.Message
+	}
+	return message
+}
+
+// syslogSeverity maps a CEF severity onto a syslog one.
+func syslogSeverity(severity int) int {
+	switch {
+	case severity >= 9:
+		return 2 // critical
+	case severity >= 7:
+		return 3 // error
+	case severity >= 5:
+		return 4 // warning
+	case severity >= 3:
+		return 5 // notice
+	}
+	return 6 // informational
+}
+
+// headerField makes value a valid RFC 5424 header field: printable ASCII
+// without spaces, at most 48 characters, or "-".
+func headerField(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	if len(value) > 48 {
+		value = value[:48]
+	}
+	return value
+}
+
+func structuredData(event Event) string {
+	params := eventParams(event)
+	var b strings.Builder
+	b.WriteString("[" + structuredDataID)
+	for _, param := range params {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(param[1])
+		b.WriteString(" " + param[0] + `="` + value + `"`)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// eventParams lists the fields of event that are set, standard ones first
+// and then Fields by name.
+func eventParams(event Event) [][2]string {
+	params := [][2]string{{"action", event.Action}}
+	for _, param := range [][2]string{
+		{"outcome", event.Outcome},
+		{"actor", event.Actor},
+		{"src", event.SourceIP},
+		{"workspace", event.Workspace},
+		{"operation", event.OperationID},
+	} {
+		if param[1] != "" {
+			params = append(params, param)
+		}
+	}
+	keys := make([]string, 0, len(event.Fields))
+	for key := range event.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if name := paramName(key); name != "" && event.Fields[key] != "" {
+			params = append(params, [2]string{name, event.Fields[key]})
+		}
+	}
+	return params
+}
+
+// paramName keeps the letters, digits and underscores of key, which every
+// receiver accepts in both SD-PARAM names and CEF extension keys.
+func paramName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, key)
+}
+
+// cef renders event as a CEF record. The signature ID is category.action;
+// workspace and operation go into the custom string fields cs1 and cs2.
+func (s *syslogShipper) cef(event Event) string {
+	severity := event.Severity
+	if severity < 0 {
+		severity = 0
+	} else if severity > 10 {
+		severity = 10
+	}
+	version := s.version
+	if version == "" {
+		version = "-"
+	}
+	name := event.Message
+	if name == "" {
+		name = event.Action
+	}
+
+	var b strings.Builder
+	b.WriteString("CEF:0|Performa|Performa|" + cefHeader(version) + "|" + cefHeader(event.Category+"."+event.Action) +
+		"|" + cefHeader(name) + "|" + strconv.Itoa(severity) + "|")
+
+	extensions := [][2]string{
+		{"rt", strconv.FormatInt(event.Time.UnixMilli(), 10)},
+		{"cat", event.Category},
+		{"act", event.Action},
+	}
+	for _, ext := range [][2]string{
+		{"outcome", event.Outcome},
+		{"suser", event.Actor},
+		{"src", event.SourceIP},
+	} {
+		if ext[1] != "" {
+			extensions = append(extensions, ext)
+		}
+	}
+	if event.Workspace != "" {
+		extensions = append(extensions, [2]string{"cs1Label", "workspace"}, [2]string{"cs1", event.Workspace})
+	}
+	if event.OperationID != "" {
+		extensions = append(extensions, [2]string{"cs2Label", "operation"}, [2]string{"cs2", event.OperationID})
+	}
+	if event.Message != "" {
+		extensions = append(extensions, [2]string{"msg", event.Message})
+	}
+	for _, param := range eventParams(Event{Fields: event.Fields})[1:] {
+		extensions = append(extensions, param)
+	}
+
+	for i, ext := range extensions {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(ext[0] + "=" + cefExtension(ext[1]))
+	}
+	return b.String()
+}
+
+func cefHeader(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ").Replace(value)
+}
+
+func cefExtension(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
@@ -0,0 +1,103 @@
+// Package telemetry exports what the backend does to external observability
+// systems: traces of HTTP requests, Brain calls and LLM requests to an
+// OpenTelemetry collector over OTLP/HTTP, and audit and operation events to
+// a syslog receiver, as RFC 5424 messages or CEF, for a SIEM.
+//
+// Both exporters are off until Init configures them; every function of the
+// package is then a cheap no-op.
+package telemetry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config selects the exporters. An empty OTLPEndpoint leaves tracing off and
+// an empty SyslogAddress leaves event shipping off.
+type Config struct {
+	ServiceName    string
+	ServiceVersion string
+
+	// OTLPEndpoint is the collector's base URL; spans are posted to
+	// <OTLPEndpoint>/v1/traces unless it already ends with that path.
+	OTLPEndpoint  string
+	OTLPHeaders   map[string]string
+	SampleRatio   float64
+	FlushInterval time.Duration
+
+	// SyslogNetwork is udp, tcp or tls.
+	SyslogNetwork string
+	SyslogAddress string
+	// SyslogFormat is rfc5424 or cef.
+	SyslogFormat string
+}
+
+// Syslog formats.
+const (
+	FormatRFC5424 = "rfc5424"
+	FormatCEF     = "cef"
+)
+
+// Init starts the exporters cfg configures, stopping any started before.
+func Init(cfg Config) error {
+	Shutdown()
+
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "performa-backend"
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+
+	if cfg.OTLPEndpoint != "" {
+		endpoint := strings.TrimRight(cfg.OTLPEndpoint, "/")
+		if !strings.HasSuffix(endpoint, "/v1/traces") {
+			endpoint += "/v1/traces"
+		}
+		ratio := cfg.SampleRatio
+		if ratio <= 0 || ratio > 1 {
+			ratio = 1
+		}
+		tracer.Store(newExporter(endpoint, cfg, ratio))
+	}
+
+	if cfg.SyslogAddress != "" {
+		network := strings.ToLower(cfg.SyslogNetwork)
+		if network == "" {
+			network = "udp"
+		}
+		if network != "udp" && network != "tcp" && network != "tls" {
+			return fmt.Errorf("unknown syslog network %q; expected udp, tcp or tls", cfg.SyslogNetwork)
+		}
+		format := strings.ToLower(cfg.SyslogFormat)
+		if format == "" {
+			format = FormatRFC5424
+		}
+		if format != FormatRFC5424 && format != FormatCEF {
+			return fmt.Errorf("unknown syslog format %q; expected %s or %s", cfg.SyslogFormat, FormatRFC5424, FormatCEF)
+		}
+		shipper.Store(newSyslogShipper(network, cfg.SyslogAddress, format, cfg))
+	}
+	return nil
+}
+
+// Shutdown flushes and stops the exporters.
+func Shutdown() {
+	if e := tracer.Swap(nil); e != nil {
+		e.stop()
+	}
+	if s := shipper.Swap(nil); s != nil {
+		s.stop()
+	}
+}
+
+// TracingEnabled reports whether spans are exported.
+func TracingEnabled() bool {
+	return tracer.Load() != nil
+}
+
+// ShippingEnabled reports whether events are shipped to syslog.
+func ShippingEnabled() bool {
+	return shipper.Load() != nil
+}
@@ -0,0 +1,185 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind is the OpenTelemetry kind of a span.
+type SpanKind int
+
+// Span kinds, numbered as in OTLP.
+const (
+	SpanInternal SpanKind = 1
+	SpanServer   SpanKind = 2
+	SpanClient   SpanKind = 3
+)
+
+// TraceparentHeader carries the trace context between services, as the W3C
+// Trace Context specification defines it.
+const TraceparentHeader = "traceparent"
+
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+func (sc spanContext) valid() bool {
+	return sc.traceID != [16]byte{} && sc.spanID != [8]byte{}
+}
+
+func (sc spanContext) traceparent() string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.traceID[:]) + "-" + hex.EncodeToString(sc.spanID[:]) + "-" + flags
+}
+
+// Span is a timed operation of a trace. A nil Span, which Start returns when
+// tracing is off, accepts every call and does nothing.
+type Span struct {
+	context  spanContext
+	parentID [8]byte
+	name     string
+	kind     SpanKind
+	start    time.Time
+	exporter *exporter
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	err        string
+	ended      bool
+}
+
+type spanContextKey struct{}
+
+// Start begins a span named name as a child of the span in ctx, or of the
+// remote parent Extract put there, and returns a context holding it.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	e := tracer.Load()
+	if e == nil {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := &Span{
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		exporter:   e,
+		attributes: make(map[string]interface{}),
+	}
+	if parent, ok := ctx.Value(spanContextKey{}).(spanContext); ok && parent.valid() {
+		span.context.traceID = parent.traceID
+		span.context.sampled = parent.sampled
+		span.parentID = parent.spanID
+	} else {
+		rand.Read(span.context.traceID[:])
+		span.context.sampled = e.sample(span.context.traceID)
+	}
+	rand.Read(span.context.spanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, span.context), span
+}
+
+// Extract returns ctx with the remote parent named by a traceparent header
+// value, so that the next span started from it continues the caller's trace.
+// Invalid values are ignored.
+func Extract(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+	var sc spanContext
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !sc.valid() {
+		return ctx
+	}
+	sc.sampled = flags[0]&1 == 1
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// Inject sets the traceparent header of an outgoing request to the span in
+// ctx.
+func Inject(ctx context.Context, header http.Header) {
+	if ctx == nil {
+		return
+	}
+	if sc, ok := ctx.Value(spanContextKey{}).(spanContext); ok && sc.valid() {
+		header.Set(TraceparentHeader, sc.traceparent())
+	}
+}
+
+// SetAttribute records an attribute of the span. Values are strings, bools,
+// integers or floats; anything else is recorded as its string form.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	switch value.(type) {
+	case string, bool, int, int64, float64:
+	default:
+		value = fmt.Sprint(value)
+	}
+	s.mu.Lock()
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetName renames the span, for names only known once the operation has
+// run, such as the route a request matched.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// End finishes the span, marking it failed when err is not nil, and queues it
+// for export. Calls after the first do nothing.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mu.Unlock()
+
+	if s.context.sampled {
+		s.exporter.enqueue(s)
+	}
+}
+
+// sampleBound maps a trace ID onto [0, 1) so that every service sampling
+// with the same ratio keeps the same traces.
+func sampleBound(traceID [16]byte) float64 {
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>11) / (1 << 53)
+}
@@ -0,0 +1,266 @@
+package timeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+	"performa-backend/telemetry"
+	"performa-backend/ws"
+
+	"github.com/google/uuid"
+)
+
+// maxEventsPerOperation bounds the in-memory timeline of each operation.
+// With a database connected the full history is kept there.
+const maxEventsPerOperation = 5000
+
+// Event types.
+const (
+	EventAgentCreated   = "agent_created"
+	EventToolExecuted   = "tool_executed"
+	EventFindingCreated = "finding_created"
+	EventStatusChanged  = "status_changed"
+	EventOperatorAction = "operator_action"
+)
+
+var EventTypes = []string{EventAgentCreated, EventToolExecuted, EventFindingCreated, EventStatusChanged, EventOperatorAction}
+
+// Actors.
+const (
+	ActorSystem   = "system"
+	ActorAgent    = "agent"
+	ActorOperator = "operator"
+)
+
+// Event is one entry of an operation's timeline.
+type Event struct {
+	ID          string                 `json:"id"`
+	OperationID string                 `json:"operation_id"`
+	AgentID     string                 `json:"agent_id,omitempty"`
+	Type        string                 `json:"type"`
+	Actor       string                 `json:"actor"`
+	Summary     string                 `json:"summary"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+	Timestamp   time.Time              `json:"timestamp"`
+}
+
+// Filter selects a page of an operation's timeline. Empty fields match
+// everything.
+type Filter struct {
+	Types   []string
+	AgentID string
+	Since   *time.Time
+	Until   *time.Time
+	Limit   int
+	Offset  int
+}
+
+func (f Filter) matches(event Event) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			if event.Type == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.AgentID != "" && event.AgentID != f.AgentID {
+		return false
+	}
+	if f.Since != nil && event.Timestamp.Before(*f.Since) {
+		return false
+	}
+	if f.Until != nil && event.Timestamp.After(*f.Until) {
+		return false
+	}
+	return true
+}
+
+type Store struct {
+	events map[string][]Event
+	mu     sync.RWMutex
+}
+
+var Default = &Store{
+	events: make(map[string][]Event),
+}
+
+// Record adds an event to its operation's timeline, persists it and
+// broadcasts it to WebSocket clients. Events without an operation are
+// dropped.
+func (s *Store) Record(event Event) {
+	if event.OperationID == "" {
+		return
+	}
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.Actor == "" {
+		event.Actor = ActorSystem
+	}
+
+	s.mu.Lock()
+	events := append(s.events[event.OperationID], event)
+	if len(events) > maxEventsPerOperation {
+		events = events[len(events)-maxEventsPerOperation:]
+	}
+	s.events[event.OperationID] = events
+	s.mu.Unlock()
+
+	s.persist(event)
+	ship(event)
+	ws.BroadcastTimelineEvent(event.OperationID, event)
+}
+
+// Query returns one page of an operation's timeline in chronological order
+// and the total number of matching events. It reads from the database when
+// one is connected and from memory otherwise.
+func (s *Store) Query(operationID string, filter Filter) ([]Event, int) {
+	if database.DB != nil {
+		records, total, err := database.QueryEvents(database.EventQuery{
+			OperationID: operationID,
+			Types:       filter.Types,
+			AgentID:     filter.AgentID,
+			Since:       filter.Since,
+			Until:       filter.Until,
+			Limit:       filter.Limit,
+			Offset:      filter.Offset,
+		})
+		if err == nil {
+			events := make([]Event, 0, len(records))
+			for _, record := range records {
+				events = append(events, eventFromRecord(record))
+			}
+			return events, total
+		}
+		log.Printf("Timeline: failed to query events for %s: %v", operationID, err)
+	}
+
+	s.mu.RLock()
+	matched := make([]Event, 0)
+	for _, event := range s.events[operationID] {
+		if filter.matches(event) {
+			matched = append(matched, event)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Timestamp.Before(matched[j].Timestamp) })
+
+	total := len(matched)
+	if filter.Offset >= total {
+		return []Event{}, total
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total
+}
+
+func (s *Store) persist(event Event) {
+	if database.DB == nil {
+		return
+	}
+
+	var data json.RawMessage
+	if len(event.Data) > 0 {
+		data, _ = json.Marshal(event.Data)
+	}
+	record := database.EventRecord{
+		ID:          event.ID,
+		OperationID: event.OperationID,
+		AgentID:     event.AgentID,
+		Type:        event.Type,
+		Actor:       event.Actor,
+		Summary:     event.Summary,
+		Data:        data,
+		CreatedAt:   event.Timestamp,
+	}
+	if err := database.SaveEvent(record); err != nil {
+		log.Printf("Timeline: failed to persist event %s: %v", event.ID, err)
+	}
+}
+
+// ship sends event to syslog. Findings are as severe as the finding and
+// operator actions and status changes are notable; the scalar values of Data
+// become fields of the message.
+func ship(event Event) {
+	if !telemetry.ShippingEnabled() {
+		return
+	}
+
+	severity := 1
+	switch event.Type {
+	case EventFindingCreated:
+		severity = findingSeverity(event.Data["severity"])
+	case EventOperatorAction, EventStatusChanged:
+		severity = 3
+	}
+	fields := map[string]string{"actor_type": event.Actor, "agent": event.AgentID, "event_id": event.ID}
+	for key, value := range event.Data {
+		switch value.(type) {
+		case string, bool, int, int64, float64:
+			fields[key] = fmt.Sprint(value)
+		}
+	}
+	actor, _ := event.Data["actor"].(string)
+
+	telemetry.Emit(telemetry.Event{
+		Time:        event.Timestamp,
+		Category:    telemetry.CategoryOperation,
+		Action:      event.Type,
+		Severity:    severity,
+		Actor:       actor,
+		OperationID: event.OperationID,
+		Message:     event.Summary,
+		Fields:      fields,
+	})
+}
+
+func findingSeverity(severity interface{}) int {
+	switch severity {
+	case "critical":
+		return 10
+	case "high":
+		return 8
+	case "medium":
+		return 5
+	case "low":
+		return 3
+	}
+	return 1
+}
+
+func eventFromRecord(record database.EventRecord) Event {
+	event := Event{
+		ID:          record.ID,
+		OperationID: record.OperationID,
+		AgentID:     record.AgentID,
+		Type:        record.Type,
+		Actor:       record.Actor,
+		Summary:     record.Summary,
+		Timestamp:   record.CreatedAt,
+	}
+	if len(record.Data) > 0 {
+		json.Unmarshal(record.Data, &event.Data)
+	}
+	return event
+}
+
+// Record adds an event to the default store.
+func Record(event Event) {
+	Default.Record(event)
+}
@@ -44,9 +44,31 @@ var AllowedTools = map[string][]string{
 	},
 }
 
-var DangerousCommands = []string{
-	"rm -rf", "mkfs", "chmod 777", ":(){:|:&};:",
-	"reboot", "shutdown", "halt", "dd if=/dev/zero",
+// OSVariants maps tools whose command differs by operating system (GOOS
+// names) to the command used there. An empty command means the tool has no
+// equivalent on that system; systems not listed use the tool's own name.
+var OSVariants = map[string]map[string]string{
+	"ip":          {"windows": "ipconfig", "darwin": "ifconfig"},
+	"ifconfig":    {"windows": "ipconfig"},
+	"ps":          {"windows": "tasklist"},
+	"grep":        {"windows": "findstr"},
+	"uname":       {"windows": "systeminfo"},
+	"id":          {"windows": "whoami"},
+	"cat":         {"windows": ""},
+	"ls":          {"windows": ""},
+	"find":        {"windows": ""},
+	"top":         {"windows": ""},
+	"lsof":        {"windows": ""},
+	"dig":         {"windows": ""},
+	"strings":     {"windows": ""},
+	"file":        {"windows": ""},
+	"tcpdump":     {"windows": ""},
+	"kismet":      {"windows": ""},
+	"lynis":       {"windows": ""},
+	"arp-scan":    {"windows": ""},
+	"netdiscover": {"windows": "", "darwin": ""},
+	"openscap":    {"windows": "", "darwin": ""},
+	"kube-bench":  {"windows": "", "darwin": ""},
 }
 
 func GetAllAllowedTools() []string {
@@ -57,13 +79,16 @@ func GetAllAllowedTools() []string {
 	return all
 }
 
+// IsToolAllowed reports whether tool may run. OS variants count as the tool
+// they stand for, so ipconfig is allowed wherever ip is.
 func IsToolAllowed(tool string, requestedTools []string, allowedToolsOnly bool) bool {
+	tool = CanonicalTool(tool)
 	if !allowedToolsOnly || len(requestedTools) == 0 {
 		return isInAllowedTools(tool)
 	}
 	
 	for _, t := range requestedTools {
-		if t == tool {
+		if CanonicalTool(t) == tool {
 			return true
 		}
 	}
@@ -81,29 +106,8 @@ func isInAllowedTools(tool string) bool {
 	return false
 }
 
-func IsDangerousCommand(cmd string) bool {
-	for _, dangerous := range DangerousCommands {
-		if contains(cmd, dangerous) {
-			return true
-		}
-	}
-	return false
-}
-
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsSubstring(s, substr))
-}
-
-func containsSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
-	}
-	return false
-}
-
 func GetToolCategory(tool string) string {
+	tool = CanonicalTool(tool)
 	for category, tools := range AllowedTools {
 		for _, t := range tools {
 			if t == tool {
@@ -114,6 +118,19 @@ func GetToolCategory(tool string) string {
 	return "unknown"
 }
 
+// IsToolInCategories reports whether tool belongs to any of the categories.
+func IsToolInCategories(tool string, categories []string) bool {
+	tool = CanonicalTool(tool)
+	for _, category := range categories {
+		for _, t := range AllowedTools[category] {
+			if t == tool {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func FilterToolsByCategory(category string) []string {
 	if tools, exists := AllowedTools[category]; exists {
 		return tools
@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	versionProbeTimeout = 3 * time.Second
+	probeWorkers        = 8
+	maxVersionLength    = 120
+)
+
+// binaries maps tools whose executable is named differently from the tool.
+// Several candidates are tried in order.
+var binaries = map[string][]string{
+	"metasploit": {"msfconsole"},
+	"aws-cli":    {"aws"},
+	"owasp-zap":  {"zaproxy", "zap.sh"},
+	"zaproxy":    {"zaproxy", "zap.sh"},
+	"burpsuite":  {"burpsuite", "BurpSuiteCommunity", "BurpSuitePro"},
+	"mongosh":    {"mongosh", "mongo"},
+}
+
+// versionArgs overrides the arguments used to ask a tool for its version.
+// Tools mapped to nil have no version flag and are only located.
+var versionArgs = map[string][]string{
+	"nuclei":      {"-version"},
+	"subfinder":   {"-version"},
+	"httpx":       {"-version"},
+	"naabu":       {"-version"},
+	"dnsx":        {"-version"},
+	"amass":       {"-version"},
+	"ffuf":        {"-V"},
+	"gobuster":    {"version"},
+	"dig":         {"-v"},
+	"hydra":       {"-h"},
+	"medusa":      {"-V"},
+	"john":        {},
+	"kubectl":     {"version", "--client"},
+	"az":          {"version"},
+	"gcloud":      {"version"},
+	"volatility":  {"-h"},
+	"ip":          {"-V"},
+	"whois":       nil,
+	"nslookup":    nil,
+	"netstat":     nil,
+	"top":         nil,
+	"ifconfig":    nil,
+	"ps":          nil,
+	"hostname":    nil,
+	"whoami":      nil,
+	"id":          nil,
+	"shodan":      nil,
+	"censys":      nil,
+	"maltego":     nil,
+	"wireshark":   nil,
+	"kismet":      nil,
+	"postman":     nil,
+	"burpsuite":   nil,
+	"zaproxy":     nil,
+	"owasp-zap":   nil,
+	"recon-ng":    nil,
+	"openscap":    nil,
+	"dirb":        nil,
+	"netdiscover": nil,
+	"arp-scan":    {"--version"},
+}
+
+// ToolStatus reports whether a tool from AllowedTools is installed. Command
+// is set when the tool goes by another command on this host's OS, and
+// Unsupported when it has no equivalent there.
+type ToolStatus struct {
+	Name        string   `json:"name"`
+	Categories  []string `json:"categories"`
+	Command     string   `json:"command,omitempty"`
+	Unsupported bool     `json:"unsupported,omitempty"`
+	Available   bool     `json:"available"`
+	Path        string   `json:"path,omitempty"`
+	Version     string   `json:"version,omitempty"`
+}
+
+// Report is the result of probing every allowed tool on this host, whose OS
+// is OS.
+type Report struct {
+	OS        string       `json:"os"`
+	Tools     []ToolStatus `json:"tools"`
+	Available int          `json:"available"`
+	Missing   []string     `json:"missing"`
+	ProbedAt  time.Time    `json:"probed_at"`
+}
+
+var (
+	reportMu   sync.RWMutex
+	lastReport *Report
+)
+
+// Probe locates every tool in AllowedTools on PATH, asks the ones it finds
+// for their version, and caches the result for Availability and Runnable.
+func Probe() *Report {
+	categories := make(map[string][]string)
+	for category, names := range AllowedTools {
+		for _, name := range names {
+			categories[name] = append(categories[name], category)
+		}
+	}
+
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := make([]ToolStatus, len(names))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < probeWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				statuses[i] = probeTool(names[i])
+			}
+		}()
+	}
+	for i := range names {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := &Report{OS: HostOS(), Tools: statuses, Missing: []string{}, ProbedAt: time.Now()}
+	for i := range statuses {
+		sort.Strings(categories[statuses[i].Name])
+		statuses[i].Categories = categories[statuses[i].Name]
+		if statuses[i].Available {
+			report.Available++
+		} else {
+			report.Missing = append(report.Missing, statuses[i].Name)
+		}
+	}
+
+	reportMu.Lock()
+	lastReport = report
+	reportMu.Unlock()
+	return report
+}
+
+func probeTool(name string) ToolStatus {
+	status := ToolStatus{Name: name}
+
+	command, supported := ToolName(name, HostOS())
+	if !supported {
+		status.Unsupported = true
+		return status
+	}
+	candidates := binaries[name]
+	if command != name {
+		status.Command = command
+		candidates = []string{command}
+	}
+	if len(candidates) == 0 {
+		candidates = []string{name}
+	}
+	for _, binary := range candidates {
+		if path, err := exec.LookPath(binary); err == nil {
+			status.Available = true
+			status.Path = path
+			break
+		}
+	}
+	if !status.Available {
+		return status
+	}
+
+	args, custom := versionArgs[name]
+	if !custom {
+		args = []string{"--version"}
+	} else if args == nil {
+		return status
+	}
+	status.Version = toolVersion(status.Path, args)
+	return status
+}
+
+// toolVersion runs the tool's version command and returns the first line of
+// output that contains a digit, or the first non-empty line.
+func toolVersion(path string, args []string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+
+	output, _ := exec.CommandContext(ctx, path, args...).CombinedOutput()
+	var version string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if version == "" {
+			version = line
+		}
+		if strings.ContainsAny(line, "0123456789") {
+			version = line
+			break
+		}
+	}
+	if len(version) > maxVersionLength {
+		version = version[:maxVersionLength]
+	}
+	return version
+}
+
+// Availability returns the cached probe report, probing first if none has
+// run yet.
+func Availability() *Report {
+	reportMu.RLock()
+	report := lastReport
+	reportMu.RUnlock()
+
+	if report == nil {
+		return Probe()
+	}
+	return report
+}
+
+// Runnable splits tools into those installed on this host and those missing.
+// Before the first probe has finished every tool is assumed runnable.
+func Runnable(requested []string) (runnable, missing []string) {
+	reportMu.RLock()
+	report := lastReport
+	reportMu.RUnlock()
+
+	if report == nil {
+		return requested, nil
+	}
+
+	available := make(map[string]bool, len(report.Tools))
+	for _, status := range report.Tools {
+		available[status.Name] = status.Available
+	}
+	for _, tool := range requested {
+		if installed, known := available[CanonicalTool(tool)]; installed || !known {
+			runnable = append(runnable, tool)
+		} else {
+			missing = append(missing, tool)
+		}
+	}
+	return runnable, missing
+}
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Capability names, matching the JSON keys of an operation's capabilities.
+const (
+	CapPacketInjection   = "packet_injection"
+	CapMITMAttacks       = "mitm_attacks"
+	CapWebSocketHijack   = "websocket_hijack"
+	CapSSLStripping      = "ssl_stripping"
+	CapDNSSpoof          = "dns_spoof"
+	CapARPSpoof          = "arp_spoof"
+	CapSessionHijack     = "session_hijack"
+	CapCredentialCapture = "credential_capture"
+	CapExploitation      = "exploitation"
+)
+
+// CategoryCapabilities lists the capability every tool in a category needs.
+var CategoryCapabilities = map[string]string{
+	"exploitation": CapExploitation,
+	"wireless":     CapPacketInjection,
+}
+
+// ToolCapabilities lists the capability specific tools need regardless of
+// their category.
+var ToolCapabilities = map[string]string{
+	"bettercap":   CapMITMAttacks,
+	"ettercap":    CapMITMAttacks,
+	"mitmproxy":   CapMITMAttacks,
+	"sslstrip":    CapSSLStripping,
+	"arpspoof":    CapARPSpoof,
+	"dnsspoof":    CapDNSSpoof,
+	"dnschef":     CapDNSSpoof,
+	"responder":   CapCredentialCapture,
+	"scapy":       CapPacketInjection,
+	"hping3":      CapPacketInjection,
+	"websocat":    CapWebSocketHijack,
+	"ferret":      CapSessionHijack,
+	"hamster":     CapSessionHijack,
+	"tcpdump":     CapCredentialCapture,
+	"tshark":      CapCredentialCapture,
+	"wireshark":   CapCredentialCapture,
+	"aircrack-ng": CapPacketInjection,
+}
+
+// FlagCapabilities lists tool flags that turn an otherwise permitted tool
+// into one that needs a capability, e.g. nmap's source address spoofing.
+var FlagCapabilities = map[string]map[string]string{
+	"nmap": {
+		"-S":          CapPacketInjection,
+		"-D":          CapPacketInjection,
+		"--spoof-mac": CapPacketInjection,
+		"--send-eth":  CapPacketInjection,
+		"--badsum":    CapPacketInjection,
+		"--data":      CapPacketInjection,
+	},
+	"masscan": {
+		"--source-ip":  CapPacketInjection,
+		"--source-mac": CapPacketInjection,
+	},
+	"sqlmap": {
+		"--os-shell":   CapExploitation,
+		"--os-pwn":     CapExploitation,
+		"--os-cmd":     CapExploitation,
+		"--file-write": CapExploitation,
+		"--priv-esc":   CapExploitation,
+	},
+	"nuclei": {
+		"-code": CapExploitation,
+	},
+}
+
+// CapabilityDenial explains why a command was refused for lack of a
+// capability.
+type CapabilityDenial struct {
+	Tool       string `json:"tool"`
+	Capability string `json:"capability"`
+	Flag       string `json:"flag,omitempty"`
+	Category   string `json:"category,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// CheckCapabilities returns the first capability args need that is not in
+// enabled, or nil when the command may run.
+func CheckCapabilities(args []string, enabled map[string]bool) *CapabilityDenial {
+	if len(args) == 0 {
+		return nil
+	}
+	tool := filepath.Base(args[0])
+
+	category := GetToolCategory(tool)
+	if capability, ok := CategoryCapabilities[category]; ok && !enabled[capability] {
+		return &CapabilityDenial{
+			Tool:       tool,
+			Capability: capability,
+			Category:   category,
+			Reason:     fmt.Sprintf("%s tools require the %s capability", category, capability),
+		}
+	}
+	if capability, ok := ToolCapabilities[tool]; ok && !enabled[capability] {
+		return &CapabilityDenial{
+			Tool:       tool,
+			Capability: capability,
+			Reason:     fmt.Sprintf("%s requires the %s capability", tool, capability),
+		}
+	}
+
+	flags := FlagCapabilities[tool]
+	for _, arg := range args[1:] {
+		flag, _, _ := strings.Cut(arg, "=")
+		if capability, ok := flags[flag]; ok && !enabled[capability] {
+			return &CapabilityDenial{
+				Tool:       tool,
+				Capability: capability,
+				Flag:       flag,
+				Reason:     fmt.Sprintf("%s %s requires the %s capability", tool, flag, capability),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Package managers an install strategy can use.
+const (
+	ManagerApt  = "apt"
+	ManagerBrew = "brew"
+	ManagerGo   = "go"
+	ManagerPip  = "pip"
+)
+
+// InstallStrategy installs a tool's package with one package manager. Go
+// packages are module paths installed at @latest.
+type InstallStrategy struct {
+	Manager string `json:"manager"`
+	Package string `json:"package"`
+}
+
+// InstallManifest lists the tools that can be installed and how, in order of
+// preference. It is the upper bound of what the installer will touch.
+var InstallManifest = map[string][]InstallStrategy{
+	"nmap":         {{ManagerApt, "nmap"}, {ManagerBrew, "nmap"}},
+	"masscan":      {{ManagerApt, "masscan"}, {ManagerBrew, "masscan"}},
+	"nikto":        {{ManagerApt, "nikto"}, {ManagerBrew, "nikto"}},
+	"sqlmap":       {{ManagerApt, "sqlmap"}, {ManagerPip, "sqlmap"}, {ManagerBrew, "sqlmap"}},
+	"gobuster":     {{ManagerGo, "github.com/OJ/gobuster/v3"}, {ManagerApt, "gobuster"}, {ManagerBrew, "gobuster"}},
+	"ffuf":         {{ManagerGo, "github.com/ffuf/ffuf/v2"}, {ManagerApt, "ffuf"}, {ManagerBrew, "ffuf"}},
+	"nuclei":       {{ManagerGo, "github.com/projectdiscovery/nuclei/v3/cmd/nuclei"}, {ManagerBrew, "nuclei"}},
+	"subfinder":    {{ManagerGo, "github.com/projectdiscovery/subfinder/v2/cmd/subfinder"}, {ManagerBrew, "subfinder"}},
+	"httpx":        {{ManagerGo, "github.com/projectdiscovery/httpx/cmd/httpx"}, {ManagerBrew, "httpx"}},
+	"naabu":        {{ManagerGo, "github.com/projectdiscovery/naabu/v2/cmd/naabu"}, {ManagerBrew, "naabu"}},
+	"dnsx":         {{ManagerGo, "github.com/projectdiscovery/dnsx/cmd/dnsx"}, {ManagerBrew, "dnsx"}},
+	"amass":        {{ManagerApt, "amass"}, {ManagerBrew, "amass"}},
+	"whatweb":      {{ManagerApt, "whatweb"}, {ManagerBrew, "whatweb"}},
+	"wafw00f":      {{ManagerPip, "wafw00f"}, {ManagerApt, "wafw00f"}},
+	"dirb":         {{ManagerApt, "dirb"}},
+	"wfuzz":        {{ManagerPip, "wfuzz"}, {ManagerApt, "wfuzz"}},
+	"dnsrecon":     {{ManagerApt, "dnsrecon"}, {ManagerPip, "dnsrecon"}},
+	"whois":        {{ManagerApt, "whois"}, {ManagerBrew, "whois"}},
+	"dig":          {{ManagerApt, "dnsutils"}, {ManagerBrew, "bind"}},
+	"curl":         {{ManagerApt, "curl"}, {ManagerBrew, "curl"}},
+	"wget":         {{ManagerApt, "wget"}, {ManagerBrew, "wget"}},
+	"fping":        {{ManagerApt, "fping"}, {ManagerBrew, "fping"}},
+	"hydra":        {{ManagerApt, "hydra"}, {ManagerBrew, "hydra"}},
+	"john":         {{ManagerApt, "john"}, {ManagerBrew, "john"}},
+	"hashcat":      {{ManagerApt, "hashcat"}, {ManagerBrew, "hashcat"}},
+	"searchsploit": {{ManagerApt, "exploitdb"}},
+	"theHarvester": {{ManagerApt, "theharvester"}},
+	"trivy":        {{ManagerBrew, "trivy"}},
+	"semgrep":      {{ManagerPip, "semgrep"}, {ManagerBrew, "semgrep"}},
+	"checkov":      {{ManagerPip, "checkov"}},
+	"prowler":      {{ManagerPip, "prowler"}},
+	"binwalk":      {{ManagerApt, "binwalk"}, {ManagerBrew, "binwalk"}},
+	"exiftool":     {{ManagerApt, "libimage-exiftool-perl"}, {ManagerBrew, "exiftool"}},
+	"tcpdump":      {{ManagerApt, "tcpdump"}},
+}
+
+// Installable returns the names of the tools in the manifest, sorted.
+func Installable() []string {
+	names := make([]string, 0, len(InstallManifest))
+	for name := range InstallManifest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Installer runs install commands on the host, or inside Container with
+// docker exec when it is set.
+type Installer struct {
+	Container string
+}
+
+// command builds an exec.Cmd for args, wrapped in docker exec for a container.
+func (in Installer) command(ctx context.Context, args ...string) *exec.Cmd {
+	if in.Container != "" {
+		dockerArgs := append([]string{"exec", "-e", "DEBIAN_FRONTEND=noninteractive", in.Container}, args...)
+		return exec.CommandContext(ctx, "docker", dockerArgs...)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+	return cmd
+}
+
+// hasManager reports whether a package manager is available where tools are
+// installed.
+func (in Installer) hasManager(ctx context.Context, manager string) bool {
+	binary := map[string]string{ManagerApt: "apt-get", ManagerBrew: "brew", ManagerGo: "go", ManagerPip: "pip3"}[manager]
+	if in.Container == "" {
+		_, err := exec.LookPath(binary)
+		return err == nil
+	}
+	return in.command(ctx, "sh", "-c", "command -v "+binary).Run() == nil
+}
+
+// strategyCommands returns the commands that install a package with a
+// strategy.
+func strategyCommands(strategy InstallStrategy) [][]string {
+	switch strategy.Manager {
+	case ManagerApt:
+		return [][]string{
+			{"apt-get", "update"},
+			{"apt-get", "install", "-y", "--no-install-recommends", strategy.Package},
+		}
+	case ManagerBrew:
+		return [][]string{{"brew", "install", strategy.Package}}
+	case ManagerGo:
+		return [][]string{{"go", "install", strategy.Package + "@latest"}}
+	case ManagerPip:
+		return [][]string{{"pip3", "install", "--upgrade", strategy.Package}}
+	}
+	return nil
+}
+
+// Install installs tool with the first manifest strategy whose package
+// manager is available, calling progress with each line of output. It returns
+// the strategy used.
+func (in Installer) Install(ctx context.Context, tool string, progress func(string)) (InstallStrategy, error) {
+	strategies, ok := InstallManifest[tool]
+	if !ok {
+		return InstallStrategy{}, fmt.Errorf("%s is not in the install manifest", tool)
+	}
+
+	for _, strategy := range strategies {
+		if !in.hasManager(ctx, strategy.Manager) {
+			continue
+		}
+		progress(fmt.Sprintf("Installing %s with %s (%s)", tool, strategy.Manager, strategy.Package))
+		for _, args := range strategyCommands(strategy) {
+			progress("$ " + strings.Join(args, " "))
+			if err := in.run(ctx, args, progress); err != nil {
+				return strategy, fmt.Errorf("%s failed: %w", strings.Join(args, " "), err)
+			}
+		}
+		return strategy, nil
+	}
+
+	managers := make([]string, 0, len(strategies))
+	for _, strategy := range strategies {
+		managers = append(managers, strategy.Manager)
+	}
+	return InstallStrategy{}, fmt.Errorf("no supported package manager for %s (needs one of %s)", tool, strings.Join(managers, ", "))
+}
+
+func (in Installer) run(ctx context.Context, args []string, progress func(string)) error {
+	cmd := in.command(ctx, args...)
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				progress(line)
+			}
+		}
+		io.Copy(io.Discard, reader)
+	}()
+
+	err := cmd.Run()
+	writer.Close()
+	<-done
+	return err
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"runtime"
+	"sort"
+)
+
+// HostOS is the operating system of this host, as a GOOS name.
+func HostOS() string {
+	return runtime.GOOS
+}
+
+// ToolName returns the command that provides tool on goos, and false when
+// the tool has no equivalent there.
+func ToolName(tool, goos string) (string, bool) {
+	if variant, ok := OSVariants[tool][goos]; ok {
+		return variant, variant != ""
+	}
+	return tool, true
+}
+
+// CanonicalTool returns the AllowedTools name of tool, which may be the OS
+// variant of one, e.g. "ip" for "ipconfig". Names that are neither are
+// returned as they are.
+func CanonicalTool(name string) string {
+	if isInAllowedTools(name) {
+		return name
+	}
+	bases := make([]string, 0, len(OSVariants))
+	for base := range OSVariants {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+	for _, base := range bases {
+		for _, variant := range OSVariants[base] {
+			if variant == name {
+				return base
+			}
+		}
+	}
+	return name
+}
+
+// SupportedOn reports whether the command name runs on goos: either it is
+// the name tools use there, or it is not a known tool at all.
+func SupportedOn(name, goos string) bool {
+	tool := CanonicalTool(name)
+	if !isInAllowedTools(tool) {
+		return true
+	}
+	variant, ok := ToolName(tool, goos)
+	return ok && variant == name
+}
+
+// NamesOn returns the commands that provide tools on goos, dropping the ones
+// without an equivalent there.
+func NamesOn(tools []string, goos string) []string {
+	names := make([]string, 0, len(tools))
+	seen := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		name, ok := ToolName(CanonicalTool(tool), goos)
+		if ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Incompatible returns the tools that have no equivalent on goos.
+func Incompatible(tools []string, goos string) []string {
+	var incompatible []string
+	for _, tool := range tools {
+		if _, ok := ToolName(CanonicalTool(tool), goos); !ok {
+			incompatible = append(incompatible, tool)
+		}
+	}
+	return incompatible
+}
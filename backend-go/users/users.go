@@ -0,0 +1,319 @@
+// Package users stores the accounts that log in to the API. Passwords are
+// kept as bcrypt hashes and never returned.
+package users
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles. Admins see and manage every user's resources.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+const minPasswordLength = 8
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUsernameTaken      = errors.New("username is already taken")
+
+	usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.@-]{3,64}$`)
+)
+
+// User is an account. TokenVersion is embedded in issued tokens and bumped to
+// revoke them all, e.g. on logout or a password change.
+type User struct {
+	ID           string     `json:"id"`
+	Username     string     `json:"username"`
+	Role         string     `json:"role"`
+	Disabled     bool       `json:"disabled"`
+	TokenVersion int        `json:"-"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	passwordHash string
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+func validRole(role string) bool {
+	return role == RoleAdmin || role == RoleUser
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+type Store struct {
+	users map[string]*User
+	mu    sync.RWMutex
+}
+
+var Default = &Store{
+	users: make(map[string]*User),
+}
+
+// findByUsername must be called with s.mu held.
+func (s *Store) findByUsername(username string) *User {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Username, username) {
+			return user
+		}
+	}
+	return nil
+}
+
+func (s *Store) Create(username, password, role string) (*User, error) {
+	username = strings.TrimSpace(username)
+	if !usernamePattern.MatchString(username) {
+		return nil, fmt.Errorf("username must be 3-64 letters, digits or _.@-")
+	}
+	if role == "" {
+		role = RoleUser
+	}
+	if !validRole(role) {
+		return nil, fmt.Errorf("role must be %q or %q", RoleAdmin, RoleUser)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.findByUsername(username) != nil {
+		s.mu.Unlock()
+		return nil, ErrUsernameTaken
+	}
+	now := time.Now()
+	user := &User{
+		ID:           uuid.New().String(),
+		Username:     username,
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		passwordHash: hash,
+	}
+	s.users[user.ID] = user
+	copied := *user
+	s.mu.Unlock()
+
+	s.persist(&copied)
+	return &copied, nil
+}
+
+// Authenticate checks a username and password and records the login. A
+// disabled account fails like a wrong password.
+func (s *Store) Authenticate(username, password string) (*User, error) {
+	s.mu.Lock()
+	user := s.findByUsername(strings.TrimSpace(username))
+	if user == nil || user.Disabled {
+		s.mu.Unlock()
+		return nil, ErrInvalidCredentials
+	}
+	hash := user.passwordHash
+	s.mu.Unlock()
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	user.LastLoginAt = &now
+	copied := *user
+	s.mu.Unlock()
+
+	s.persist(&copied)
+	return &copied, nil
+}
+
+func (s *Store) Get(id string) *User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if user, ok := s.users[id]; ok {
+		copied := *user
+		return &copied
+	}
+	return nil
+}
+
+// GetAll returns the users sorted by username.
+func (s *Store) GetAll() []*User {
+	s.mu.RLock()
+	all := make([]*User, 0, len(s.users))
+	for _, user := range s.users {
+		copied := *user
+		all = append(all, &copied)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool { return strings.ToLower(all[i].Username) < strings.ToLower(all[j].Username) })
+	return all
+}
+
+func (s *Store) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users)
+}
+
+// Update changes a user's role, disabled flag or password; nil fields are
+// left unchanged. Disabling a user or changing their password revokes their
+// tokens. It returns nil, nil when the user does not exist.
+func (s *Store) Update(id string, role *string, disabled *bool, password *string) (*User, error) {
+	if role != nil && !validRole(*role) {
+		return nil, fmt.Errorf("role must be %q or %q", RoleAdmin, RoleUser)
+	}
+	var hash string
+	if password != nil {
+		var err error
+		if hash, err = hashPassword(*password); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	user, ok := s.users[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	if role != nil {
+		user.Role = *role
+	}
+	if disabled != nil {
+		if *disabled && !user.Disabled {
+			user.TokenVersion++
+		}
+		user.Disabled = *disabled
+	}
+	if hash != "" {
+		user.passwordHash = hash
+		user.TokenVersion++
+	}
+	user.UpdatedAt = time.Now()
+	copied := *user
+	s.mu.Unlock()
+
+	s.persist(&copied)
+	return &copied, nil
+}
+
+// RevokeTokens invalidates every token issued to the user so far.
+func (s *Store) RevokeTokens(id string) {
+	s.mu.Lock()
+	user, ok := s.users[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	user.TokenVersion++
+	copied := *user
+	s.mu.Unlock()
+
+	s.persist(&copied)
+}
+
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	_, exists := s.users[id]
+	delete(s.users, id)
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		database.DeleteUser(id)
+	}
+	return exists
+}
+
+// Bootstrap creates an admin account with the given credentials when no users
+// exist yet, so a fresh deployment can log in.
+func (s *Store) Bootstrap(username, password string) {
+	if s.Count() > 0 {
+		return
+	}
+	if password == "" {
+		log.Printf("Warning: authentication is enabled but no users exist; set AUTH_ADMIN_PASSWORD to create an admin")
+		return
+	}
+	if _, err := s.Create(username, password, RoleAdmin); err != nil {
+		log.Printf("Warning: failed to create admin user %q: %v", username, err)
+		return
+	}
+	log.Printf("Created admin user %q", username)
+}
+
+func (s *Store) persist(user *User) {
+	if database.DB == nil {
+		return
+	}
+
+	record := database.UserRecord{
+		ID:           user.ID,
+		Username:     user.Username,
+		PasswordHash: user.passwordHash,
+		Role:         user.Role,
+		Disabled:     user.Disabled,
+		TokenVersion: user.TokenVersion,
+		LastLoginAt:  user.LastLoginAt,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+	}
+	if err := database.SaveUser(record); err != nil {
+		log.Printf("Users: failed to persist user %s: %v", user.ID, err)
+	}
+}
+
+// Load restores users from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllUsers()
+	if err != nil {
+		log.Printf("Users: failed to load users: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		s.users[record.ID] = &User{
+			ID:           record.ID,
+			Username:     record.Username,
+			Role:         record.Role,
+			Disabled:     record.Disabled,
+			TokenVersion: record.TokenVersion,
+			LastLoginAt:  record.LastLoginAt,
+			CreatedAt:    record.CreatedAt,
+			UpdatedAt:    record.UpdatedAt,
+			passwordHash: record.PasswordHash,
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package validation checks request structs against their `validate` tags
+// (github.com/go-playground/validator) and reports the problems per field,
+// naming fields by their JSON names.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes one invalid field. Field is the JSON path of the
+// field, e.g. "stealth_options.proxy_chain" or "targets[2]".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+// Struct validates v, a struct or a pointer to one, and returns every
+// problem found, or nil when it is valid.
+func Struct(v interface{}) []FieldError {
+	err := validate.Struct(v)
+	if err == nil {
+		return nil
+	}
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return []FieldError{{Field: "", Message: err.Error()}}
+	}
+
+	problems := make([]FieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		field := fieldPath(fe.Namespace())
+		problems = append(problems, FieldError{Field: field, Message: message(field, fe)})
+	}
+	return problems
+}
+
+// Join combines problems into one error for callers outside the HTTP API,
+// which have no field-level response to put them in.
+func Join(problems []FieldError) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.Message
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// fieldPath drops the struct name validator puts first in a namespace.
+func fieldPath(namespace string) string {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func message(field string, fe validator.FieldError) string {
+	param := fe.Param()
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "required_without":
+		return fmt.Sprintf("%s is required when %s is not set", field, toSnake(param))
+	case "min":
+		if isCollection(fe.Kind()) {
+			return fmt.Sprintf("%s must have at least %s items", field, param)
+		}
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at least %s characters", field, param)
+		}
+		return fmt.Sprintf("%s must be at least %s", field, param)
+	case "max":
+		if isCollection(fe.Kind()) {
+			return fmt.Sprintf("%s must have at most %s items", field, param)
+		}
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at most %s characters", field, param)
+		}
+		return fmt.Sprintf("%s must be at most %s", field, param)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", field, strings.Join(strings.Fields(param), ", "))
+	case "url", "http_url":
+		return field + " must be a URL"
+	case "hostname_port":
+		return field + " must be host:port"
+	case "email":
+		return field + " must be an email address"
+	}
+	if param != "" {
+		return fmt.Sprintf("%s failed the %s=%s check", field, fe.Tag(), param)
+	}
+	return fmt.Sprintf("%s failed the %s check", field, fe.Tag())
+}
+
+// toSnake turns the Go name of a field referenced by a tag parameter into
+// its JSON name, which the request structs derive the same way.
+func toSnake(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isCollection(kind reflect.Kind) bool {
+	return kind == reflect.Slice || kind == reflect.Array || kind == reflect.Map
+}
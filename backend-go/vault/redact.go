@@ -0,0 +1,174 @@
+package vault
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Kinds of captured credentials.
+const (
+	KindPassword   = "password"
+	KindToken      = "token"
+	KindAPIKey     = "api_key"
+	KindSecret     = "secret"
+	KindPrivateKey = "private_key"
+	KindHash       = "hash"
+)
+
+// Secret is a credential value found in a text.
+type Secret struct {
+	Kind     string
+	Username string
+	Value    string
+}
+
+// redactionRule finds credentials in a text. Value is the submatch holding the
+// secret, which is replaced by a placeholder; User, when non-zero, the one
+// holding the account it belongs to.
+type redactionRule struct {
+	kind    string
+	pattern *regexp.Regexp
+	value   int
+	user    int
+	// kindOf derives the kind from the whole match when set.
+	kindOf func(match string) string
+}
+
+var redactionRules = []redactionRule{
+	{
+		kind:    KindPrivateKey,
+		pattern: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`),
+	},
+	{
+		kind:    KindPassword,
+		pattern: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://([^\s:/@\[\]]+):([^\s@/]+)@`),
+		value:   2,
+		user:    1,
+	},
+	{
+		kind:    KindToken,
+		pattern: regexp.MustCompile(`(?i)\bauthorization:\s*(?:basic|bearer|token)\s+([A-Za-z0-9+/=._~-]+)`),
+		value:   1,
+	},
+	{
+		kind:    KindPassword,
+		pattern: regexp.MustCompile(`(?i)\blogin:\s*(\S+)\s+password:\s*(\S+)`),
+		value:   2,
+		user:    1,
+	},
+	{
+		kind:    KindHash,
+		pattern: regexp.MustCompile(`\b([a-z_][a-z0-9_.-]*):(\$(?:1|2[abxy]?|5|6|y|argon2id?)\$[^\s:]+)`),
+		value:   2,
+		user:    1,
+	},
+	{
+		kind:    KindAPIKey,
+		pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)\b(password|passwd|pwd|pass|secret|client_secret|api[_-]?key|access[_-]?key|secret[_-]?key|access[_-]?token|auth[_-]?token|token)\b["']?\s*[=:]\s*["']?([^\s"'&,;<>]+)`),
+		value:   2,
+		kindOf:  keyValueKind,
+	},
+}
+
+// keyValueUserPattern finds the account next to a key=value secret.
+var keyValueUserPattern = regexp.MustCompile(`(?i)\b(?:user(?:name)?|login|email|uid)\b["']?\s*[=:]\s*["']?([^\s"'&,;<>]+)`)
+
+func keyValueKind(match string) string {
+	key := strings.ToLower(match)
+	switch {
+	case strings.HasPrefix(key, "pass") || strings.HasPrefix(key, "pwd"):
+		return KindPassword
+	case strings.Contains(key, "token"):
+		return KindToken
+	case strings.Contains(key, "key"):
+		return KindAPIKey
+	}
+	return KindSecret
+}
+
+// Placeholder is what replaces a redacted value of kind.
+func Placeholder(kind string) string {
+	return "[REDACTED " + kind + "]"
+}
+
+// redactable reports whether value looks like a secret rather than a
+// placeholder already standing in for one.
+func redactable(value string) bool {
+	if value == "" || strings.HasPrefix(value, "[REDACTED") {
+		return false
+	}
+	return strings.Trim(value, "*xX.") != ""
+}
+
+// Redact replaces the credential values recognised in text by placeholders
+// and returns them.
+func Redact(text string) (string, []Secret) {
+	var secrets []Secret
+	for _, rule := range redactionRules {
+		text = rule.apply(text, &secrets)
+	}
+	return text, secrets
+}
+
+func (r redactionRule) apply(text string, secrets *[]Secret) string {
+	matches := r.pattern.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[2*r.value], m[2*r.value+1]
+		if start < 0 {
+			continue
+		}
+		value := text[start:end]
+		if !redactable(value) {
+			continue
+		}
+
+		secret := Secret{Kind: r.kind, Value: value}
+		if r.kindOf != nil {
+			secret.Kind = r.kindOf(text[m[0]:m[1]])
+		}
+		if r.user > 0 && m[2*r.user] >= 0 {
+			secret.Username = text[m[2*r.user]:m[2*r.user+1]]
+		} else if r.kindOf != nil {
+			secret.Username = lineUser(text, m[0])
+		}
+		*secrets = append(*secrets, secret)
+
+		b.WriteString(text[last:start])
+		b.WriteString(Placeholder(secret.Kind))
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// lineUser returns the account named on the line holding offset, if any.
+func lineUser(text string, offset int) string {
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+	lineEnd := len(text)
+	if i := strings.IndexByte(text[offset:], '\n'); i >= 0 {
+		lineEnd = offset + i
+	}
+	if match := keyValueUserPattern.FindStringSubmatch(text[lineStart:lineEnd]); match != nil && redactable(match[1]) {
+		return match[1]
+	}
+	return ""
+}
+
+// Mask returns the displayable form of a secret: its first and last
+// characters for long values, nothing of short ones.
+func Mask(value string) string {
+	runes := []rune(value)
+	if len(runes) < 8 {
+		return "****"
+	}
+	return string(runes[0]) + "****" + string(runes[len(runes)-1])
+}
@@ -0,0 +1,348 @@
+// Package vault keeps the credentials captured during operations. Values are
+// stored encrypted with the credentials master key and only shown masked;
+// reading one in clear is an explicit, audited action. Redact strips
+// credential patterns from the text of findings so that the values live in
+// the vault only.
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/credentials"
+	"performa-backend/database"
+	"performa-backend/telemetry"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotStored is returned when revealing a credential captured while no
+// master key was set, whose value was therefore discarded.
+var ErrNotStored = errors.New("credential value was not stored: CREDENTIALS_MASTER_KEY was not set when it was captured")
+
+// Credential is a captured credential. Its value is never returned; Masked
+// hints at it and Stored tells whether it can be revealed.
+type Credential struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	OperationID string    `json:"operation_id,omitempty"`
+	AgentID     string    `json:"agent_id,omitempty"`
+	FindingID   string    `json:"finding_id,omitempty"`
+	Target      string    `json:"target,omitempty"`
+	Kind        string    `json:"kind"`
+	Username    string    `json:"username,omitempty"`
+	Masked      string    `json:"masked"`
+	Source      string    `json:"source"`
+	Stored      bool      `json:"stored"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	fingerprint string
+	ciphertext  string
+}
+
+// Reveal is an audit entry for a credential shown in clear.
+type Reveal struct {
+	ID           string    `json:"id"`
+	CredentialID string    `json:"credential_id"`
+	Actor        string    `json:"actor"`
+	IP           string    `json:"ip,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Filter selects credentials. Empty fields match everything.
+type Filter struct {
+	WorkspaceID string
+	OperationID string
+	FindingID   string
+	AgentID     string
+	Kind        string
+	Limit       int
+	Offset      int
+}
+
+func (f Filter) matches(c *Credential) bool {
+	return (f.WorkspaceID == "" || c.WorkspaceID == f.WorkspaceID) &&
+		(f.OperationID == "" || c.OperationID == f.OperationID) &&
+		(f.FindingID == "" || c.FindingID == f.FindingID) &&
+		(f.AgentID == "" || c.AgentID == f.AgentID) &&
+		(f.Kind == "" || c.Kind == f.Kind)
+}
+
+type Store struct {
+	credentials   map[string]*Credential
+	byFingerprint map[string]*Credential
+	reveals       map[string][]Reveal
+	sealer        *credentials.Sealer
+	mu            sync.RWMutex
+}
+
+var Default = NewStore()
+
+func NewStore() *Store {
+	return &Store{
+		credentials:   make(map[string]*Credential),
+		byFingerprint: make(map[string]*Credential),
+		reveals:       make(map[string][]Reveal),
+	}
+}
+
+// SetMasterKey sets the key captured values are encrypted with. Without one,
+// credentials are still recorded masked but their values are discarded.
+func (s *Store) SetMasterKey(masterKey string) error {
+	sealer, err := credentials.NewSealer(masterKey)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sealer = sealer
+	return nil
+}
+
+func (s *Store) Enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sealer != nil
+}
+
+func (c *Credential) clone() *Credential {
+	copied := *c
+	copied.fingerprint, copied.ciphertext = "", ""
+	return &copied
+}
+
+// Add stores a captured credential with its value, unless the same value was
+// already captured for the same workspace, target, kind and account. It
+// returns the stored credential and whether it is new. A known credential
+// that had no finding yet is linked to credential.FindingID.
+func (s *Store) Add(credential Credential, value string) (*Credential, bool) {
+	s.mu.Lock()
+	// Without a master key the fingerprint would be a plain hash of the
+	// value, so only its masked form is fingerprinted.
+	identity := value
+	if s.sealer == nil {
+		identity = Mask(value)
+	}
+	fingerprint := s.sealer.Fingerprint(strings.Join([]string{
+		credential.WorkspaceID, credential.Target, credential.Kind, credential.Username, identity,
+	}, "\x00"))
+	if existing, ok := s.byFingerprint[fingerprint]; ok {
+		linked := existing.FindingID == "" && credential.FindingID != ""
+		if linked {
+			existing.FindingID = credential.FindingID
+		}
+		copied := existing.clone()
+		s.mu.Unlock()
+		if linked {
+			s.persist(existing)
+		}
+		return copied, false
+	}
+
+	if s.sealer != nil {
+		ciphertext, err := s.sealer.Seal(value)
+		if err != nil {
+			log.Printf("Vault: failed to encrypt captured credential: %v", err)
+		}
+		credential.ciphertext = ciphertext
+	}
+	credential.ID = uuid.New().String()
+	credential.Masked = Mask(value)
+	credential.Stored = credential.ciphertext != ""
+	credential.CreatedAt = time.Now()
+	credential.fingerprint = fingerprint
+
+	stored := &credential
+	s.credentials[stored.ID] = stored
+	s.byFingerprint[fingerprint] = stored
+	copied := stored.clone()
+	s.mu.Unlock()
+
+	s.persist(stored)
+	return copied, true
+}
+
+// Get returns a copy of the credential without its value.
+func (s *Store) Get(id string) *Credential {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if credential, ok := s.credentials[id]; ok {
+		return credential.clone()
+	}
+	return nil
+}
+
+// List returns the page of credentials matching filter, most recent first,
+// and the number of matches.
+func (s *Store) List(filter Filter) ([]*Credential, int) {
+	s.mu.RLock()
+	matched := make([]*Credential, 0)
+	for _, credential := range s.credentials {
+		if filter.matches(credential) {
+			matched = append(matched, credential.clone())
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].CreatedAt.After(matched[j].CreatedAt)
+		}
+		return matched[i].ID < matched[j].ID
+	})
+	total := len(matched)
+	if filter.Offset >= total {
+		return []*Credential{}, total
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total
+}
+
+// Reveal decrypts a credential's value for actor and records the access in
+// its audit trail. It returns nil values for an unknown credential.
+func (s *Store) Reveal(id, actor, ip string) (string, *Reveal, error) {
+	s.mu.Lock()
+	credential, ok := s.credentials[id]
+	if !ok {
+		s.mu.Unlock()
+		return "", nil, nil
+	}
+	if s.sealer == nil {
+		s.mu.Unlock()
+		return "", nil, credentials.ErrNoMasterKey
+	}
+	if credential.ciphertext == "" {
+		s.mu.Unlock()
+		return "", nil, ErrNotStored
+	}
+	value, err := s.sealer.Open(credential.ciphertext)
+	if err != nil {
+		s.mu.Unlock()
+		return "", nil, err
+	}
+
+	reveal := Reveal{
+		ID:           uuid.New().String(),
+		CredentialID: id,
+		Actor:        actor,
+		IP:           ip,
+		CreatedAt:    time.Now(),
+	}
+	s.reveals[id] = append(s.reveals[id], reveal)
+	revealed := *credential
+	s.mu.Unlock()
+
+	log.Printf("Vault: credential %s revealed to %s from %s", id, actor, ip)
+	telemetry.Emit(telemetry.Event{
+		Time:        reveal.CreatedAt,
+		Category:    telemetry.CategoryCredential,
+		Action:      "reveal_credential",
+		Severity:    7,
+		Outcome:     telemetry.OutcomeSuccess,
+		Actor:       actor,
+		SourceIP:    ip,
+		Workspace:   revealed.WorkspaceID,
+		OperationID: revealed.OperationID,
+		Message:     fmt.Sprintf("Captured %s credential revealed", revealed.Kind),
+		Fields:      map[string]string{"credential_id": id, "reveal_id": reveal.ID},
+	})
+	if err := database.SaveCredentialReveal(database.CredentialRevealRecord(reveal)); err != nil {
+		log.Printf("Vault: failed to persist reveal of credential %s: %v", id, err)
+	}
+	return value, &reveal, nil
+}
+
+// Reveals returns the audit trail of a credential, oldest first.
+func (s *Store) Reveals(id string) []Reveal {
+	if database.DB != nil {
+		records, err := database.GetCredentialReveals(id)
+		if err == nil {
+			reveals := make([]Reveal, 0, len(records))
+			for _, record := range records {
+				reveals = append(reveals, Reveal(record))
+			}
+			return reveals
+		}
+		log.Printf("Vault: failed to load reveals of credential %s: %v", id, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Reveal{}, s.reveals[id]...)
+}
+
+func (s *Store) persist(credential *Credential) {
+	if database.DB == nil {
+		return
+	}
+
+	s.mu.RLock()
+	record := database.CapturedCredentialRecord{
+		ID:          credential.ID,
+		WorkspaceID: credential.WorkspaceID,
+		OperationID: credential.OperationID,
+		AgentID:     credential.AgentID,
+		FindingID:   credential.FindingID,
+		Target:      credential.Target,
+		Kind:        credential.Kind,
+		Username:    credential.Username,
+		Masked:      credential.Masked,
+		Source:      credential.Source,
+		Fingerprint: credential.fingerprint,
+		Ciphertext:  credential.ciphertext,
+		CreatedAt:   credential.CreatedAt,
+	}
+	s.mu.RUnlock()
+
+	if err := database.SaveCapturedCredential(record); err != nil {
+		log.Printf("Vault: failed to persist captured credential %s: %v", credential.ID, err)
+	}
+}
+
+// Load restores captured credentials from the database. Values stay
+// encrypted until they are revealed.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllCapturedCredentials()
+	if err != nil {
+		log.Printf("Vault: failed to load captured credentials: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		credential := &Credential{
+			ID:          record.ID,
+			WorkspaceID: record.WorkspaceID,
+			OperationID: record.OperationID,
+			AgentID:     record.AgentID,
+			FindingID:   record.FindingID,
+			Target:      record.Target,
+			Kind:        record.Kind,
+			Username:    record.Username,
+			Masked:      record.Masked,
+			Source:      record.Source,
+			Stored:      record.Ciphertext != "",
+			CreatedAt:   record.CreatedAt,
+			fingerprint: record.Fingerprint,
+			ciphertext:  record.Ciphertext,
+		}
+		s.credentials[credential.ID] = credential
+		s.byFingerprint[credential.fingerprint] = credential
+	}
+}
@@ -0,0 +1,49 @@
+package wordlists
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+)
+
+//go:embed builtin/*.txt
+var builtinFiles embed.FS
+
+// builtin is a list shipped with the backend, pinned to its SHA-256: a copy
+// that does not hash to it is never written out or used.
+type builtin struct {
+	name        string
+	description string
+	sha256      string
+}
+
+var builtins = []builtin{
+	{"api-endpoints", "Common REST, GraphQL, Swagger and actuator endpoints", "d6e2fc4a2a93641ba463534675047f411fb7c2b4dad52e64605cbcb90b7a70f1"},
+	{"backup-files", "Backup archives and database dumps named after the target", "a17c1ba52607a08982a68441ee9a66affdcafd404aa867501e1ee582bd5f28fa"},
+	{"common-dirs", "Common web directories", "1efb7f59a833a7558e7226e906546c889fe7e513bf0ab6776f3e551f2605f6c3"},
+	{"common-files", "Sensitive and well-known web files", "1f8d9a4b9b68a03d347655499ca15286b5aae0d2c628d33a7d7cc9f7a3e10f8c"},
+	{"subdomains-top", "Frequent subdomain labels", "b446ffc4682d120f298263410fdc0ae3a80c30039544b6a6a2e3105034610fdd"},
+}
+
+func (b builtin) data() []byte {
+	data, _ := builtinFiles.ReadFile("builtin/" + b.name + ".txt")
+	return data
+}
+
+// loadBuiltin describes a built-in list after checking the shipped copy
+// against its pinned hash.
+func loadBuiltin(b builtin) (*Wordlist, error) {
+	data := b.data()
+	if data == nil {
+		return nil, fmt.Errorf("not shipped")
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != b.sha256 {
+		return nil, fmt.Errorf("sha256 is %s, expected %s", actual, b.sha256)
+	}
+	list := describe(b.name, data)
+	list.Description = b.description
+	list.Builtin = true
+	return list, nil
+}
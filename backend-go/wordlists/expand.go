@@ -0,0 +1,248 @@
+package wordlists
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// placeholder matches {{name}} and {{name:argument}} in a command
+	// argument. Names other than those below are left as they are, so that
+	// tools with a template syntax of their own, such as nuclei's
+	// {{BaseURL}}, keep working.
+	placeholder = regexp.MustCompile(`\{\{\s*([a-z]+)(?::([^{}\s]+))?\s*\}\}`)
+	// targetPlaceholder matches the placeholders a templated list uses.
+	targetPlaceholder = regexp.MustCompile(`\{\{\s*(target|url|host|domain|name)\s*\}\}`)
+)
+
+// Target holds the forms of an operation target that placeholders expand
+// to: {{target}} as given, {{url}} as a URL with a scheme, {{host}} without
+// scheme, port or path, {{domain}} the host without a leading "www." and
+// {{name}} the domain's first label.
+type Target struct {
+	Target string
+	URL    string
+	Host   string
+	Domain string
+	Name   string
+}
+
+// ParseTarget splits a target given as a host, host:port or URL.
+func ParseTarget(target string) Target {
+	target = strings.TrimSpace(target)
+	t := Target{Target: target}
+	if target == "" {
+		return t
+	}
+
+	raw := target
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		t.URL, t.Host = raw, target
+	} else {
+		t.URL = strings.TrimSuffix(parsed.Scheme+"://"+parsed.Host+parsed.Path, "/")
+		t.Host = parsed.Hostname()
+	}
+
+	t.Domain = strings.TrimPrefix(t.Host, "www.")
+	t.Name = t.Domain
+	if net.ParseIP(t.Domain) == nil {
+		if i := strings.Index(t.Domain, "."); i > 0 {
+			t.Name = t.Domain[:i]
+		}
+	}
+	return t
+}
+
+func (t Target) value(name string) (string, bool) {
+	switch name {
+	case "target":
+		return t.Target, true
+	case "url":
+		return t.URL, true
+	case "host":
+		return t.Host, true
+	case "domain":
+		return t.Domain, true
+	case "name":
+		return t.Name, true
+	}
+	return "", false
+}
+
+// Expansion is a command with its placeholders replaced. Files lists the
+// wordlist files it reads, which a sandboxed run must be given.
+type Expansion struct {
+	Args  []string
+	Files []string
+}
+
+// ExpandArgs replaces the placeholders of a command's arguments:
+// {{wordlist:NAME}} with the path of the named list, and the target
+// placeholders with the forms of target. allowed, when not empty, limits the
+// lists the command may use. A list that is unknown, not allowed or fails
+// its integrity check is an error.
+func (s *Store) ExpandArgs(args []string, target Target, allowed []string) (Expansion, error) {
+	expansion := Expansion{Args: make([]string, len(args))}
+	var expandErr error
+	for i, arg := range args {
+		expansion.Args[i] = placeholder.ReplaceAllStringFunc(arg, func(match string) string {
+			parts := placeholder.FindStringSubmatch(match)
+			name, argument := parts[1], parts[2]
+			if name == "wordlist" {
+				if argument == "" {
+					expandErr = fmt.Errorf("{{wordlist:NAME}} needs a wordlist name")
+					return match
+				}
+				path, err := s.resolve(argument, target, allowed)
+				if err != nil {
+					expandErr = err
+					return match
+				}
+				expansion.Files = append(expansion.Files, path)
+				return path
+			}
+			if value, ok := target.value(name); ok && argument == "" {
+				if value == "" {
+					expandErr = fmt.Errorf("{{%s}} needs a single target", name)
+					return match
+				}
+				return value
+			}
+			return match
+		})
+		if expandErr != nil {
+			return Expansion{}, expandErr
+		}
+	}
+	return expansion, nil
+}
+
+// resolve returns the file a command reads a list from: the list itself,
+// or for a templated list, its copy expanded for target.
+func (s *Store) resolve(name string, target Target, allowed []string) (string, error) {
+	name = strings.ToLower(name)
+	if len(allowed) > 0 && !contains(allowed, name) {
+		return "", fmt.Errorf("wordlist %s is not selected for this operation; use one of %s", name, strings.Join(allowed, ", "))
+	}
+	list := s.Get(name)
+	if list == nil {
+		return "", fmt.Errorf("unknown wordlist %s", name)
+	}
+	path, err := s.verifiedPath(name)
+	if err != nil {
+		return "", err
+	}
+	if !list.Templated {
+		return path, nil
+	}
+	if target.Target == "" {
+		return "", fmt.Errorf("wordlist %s is expanded per target and needs a single target", name)
+	}
+	return s.expandList(list, path, target)
+}
+
+// expandList writes the entries of a templated list expanded for target,
+// dropping duplicates and comments. Copies are named after the list's hash,
+// so that an upload under the same name never reuses a stale one.
+func (s *Store) expandList(list *Wordlist, path string, target Target) (string, error) {
+	key := sha256.Sum256([]byte(list.SHA256 + "\n" + target.Target))
+	out := filepath.Join(s.Dir(), expandedDir, list.Name+"-"+hex.EncodeToString(key[:8])+".txt")
+	if _, err := os.Stat(out); err == nil {
+		return out, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	seen := make(map[string]bool)
+	var expanded strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = targetPlaceholder.ReplaceAllStringFunc(line, func(match string) string {
+			value, _ := target.value(targetPlaceholder.FindStringSubmatch(match)[1])
+			return value
+		})
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		expanded.WriteString(line)
+		expanded.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(out), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.WriteString(expanded.String()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	tmp.Close()
+	os.Chmod(tmp.Name(), 0644)
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return out, nil
+}
+
+// Preview returns up to limit entries of a list, expanded for target when
+// the list is templated and target is set.
+func (s *Store) Preview(name string, target Target, limit int) ([]string, error) {
+	list := s.Get(name)
+	if list == nil {
+		return nil, ErrNotFound
+	}
+	path, err := s.verifiedPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if list.Templated && target.Target != "" {
+		if path, err = s.expandList(list, path, target); err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]string, 0, limit)
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(entries) >= limit {
+			break
+		}
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	return entries, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
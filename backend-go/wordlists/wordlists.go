@@ -0,0 +1,429 @@
+// Package wordlists manages the named wordlists web scanning tools are run
+// with: a few built-in lists shipped with the backend and lists uploaded by
+// operators, stored under a data directory. Every list is recorded with its
+// SHA-256 and checked against it before a tool uses it, so that a list edited
+// or corrupted on disk is never handed to a scan.
+package wordlists
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxSize bounds an uploaded list, within the API's request body limit.
+const MaxSize = 4 << 20
+
+const (
+	indexFile   = "index.json"
+	builtinDir  = "builtin"
+	expandedDir = ".expanded"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+var (
+	ErrNotFound = errors.New("wordlist not found")
+	ErrExists   = errors.New("a wordlist with that name already exists")
+	ErrBuiltin  = errors.New("built-in wordlists cannot be changed")
+)
+
+// Wordlist describes a stored list. Entries counts its non-empty lines that
+// are not comments. Templated lists use target placeholders, such as
+// {{domain}}, in their entries and are expanded for each target they run
+// against.
+type Wordlist struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Builtin     bool      `json:"builtin"`
+	Templated   bool      `json:"templated"`
+	Entries     int       `json:"entries"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Error says why the list failed its integrity check, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// Check is the outcome of verifying one list against its recorded hash.
+// Restored is set for a built-in list that was rewritten from the copy
+// shipped with the backend.
+type Check struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	SHA256   string `json:"sha256"`
+	Actual   string `json:"actual,omitempty"`
+	Restored bool   `json:"restored,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// verified remembers the file a list last passed its integrity check as, so
+// that unchanged files are not hashed again on every run.
+type verified struct {
+	size    int64
+	modTime time.Time
+}
+
+type Store struct {
+	dir      string
+	lists    map[string]*Wordlist
+	verified map[string]verified
+	mu       sync.RWMutex
+}
+
+var Default = &Store{lists: make(map[string]*Wordlist), verified: make(map[string]verified)}
+
+// Configure sets the data directory lists are stored under.
+func (s *Store) Configure(dir string) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = dir
+}
+
+// Dir returns the absolute data directory.
+func (s *Store) Dir() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dir
+}
+
+// ValidName reports whether name may name a list.
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Load writes out the built-in lists, restoring any that no longer match the
+// shipped copy, and reads the index of uploaded lists.
+func (s *Store) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(s.dir, builtinDir), 0755); err != nil {
+		return fmt.Errorf("failed to create wordlists directory: %w", err)
+	}
+	s.lists = make(map[string]*Wordlist)
+	s.verified = make(map[string]verified)
+
+	for _, b := range builtins {
+		list, err := loadBuiltin(b)
+		if err != nil {
+			log.Printf("Wordlists: built-in list %s is corrupt and was skipped: %v", b.name, err)
+			continue
+		}
+		path := s.pathLocked(list)
+		actual, err := hashFile(path)
+		if err != nil || actual != list.SHA256 {
+			if err := os.WriteFile(path, b.data(), 0644); err != nil {
+				return fmt.Errorf("failed to write built-in wordlist %s: %w", b.name, err)
+			}
+			if err == nil {
+				log.Printf("Wordlists: restored built-in list %s, which did not match its hash", b.name)
+			}
+		}
+		s.lists[list.Name] = list
+	}
+
+	var uploaded []*Wordlist
+	data, err := os.ReadFile(filepath.Join(s.dir, indexFile))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return fmt.Errorf("failed to read wordlist index: %w", err)
+	default:
+		if err := json.Unmarshal(data, &uploaded); err != nil {
+			return fmt.Errorf("failed to parse wordlist index: %w", err)
+		}
+	}
+	for _, list := range uploaded {
+		if !ValidName(list.Name) || s.lists[list.Name] != nil {
+			log.Printf("Wordlists: ignoring index entry %q", list.Name)
+			continue
+		}
+		list.Builtin = false
+		s.lists[list.Name] = list
+	}
+	log.Printf("Wordlists: %d lists in %s", len(s.lists), s.dir)
+	return nil
+}
+
+// saveIndexLocked records the uploaded lists. s.mu must be held.
+func (s *Store) saveIndexLocked() error {
+	uploaded := make([]*Wordlist, 0, len(s.lists))
+	for _, list := range s.lists {
+		if !list.Builtin {
+			uploaded = append(uploaded, list)
+		}
+	}
+	sort.Slice(uploaded, func(i, j int) bool { return uploaded[i].Name < uploaded[j].Name })
+	data, err := json.MarshalIndent(uploaded, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, indexFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, indexFile))
+}
+
+// pathLocked returns where a list is stored. s.mu must be held.
+func (s *Store) pathLocked(list *Wordlist) string {
+	if list.Builtin {
+		return filepath.Join(s.dir, builtinDir, list.Name+".txt")
+	}
+	return filepath.Join(s.dir, list.Name+".txt")
+}
+
+// List returns every list, sorted by name.
+func (s *Store) List() []Wordlist {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lists := make([]Wordlist, 0, len(s.lists))
+	for _, list := range s.lists {
+		lists = append(lists, *list)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+	return lists
+}
+
+// Get returns the named list, or nil.
+func (s *Store) Get(name string) *Wordlist {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, ok := s.lists[name]
+	if !ok {
+		return nil
+	}
+	copied := *list
+	return &copied
+}
+
+// Add stores data as a new list. Lines are normalized to end in a single
+// newline; data must be text.
+func (s *Store) Add(name, description string, data []byte) (*Wordlist, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid name %q: use up to 64 lowercase letters, digits, dots, dashes or underscores", name)
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("wordlist is %d bytes, over the %d byte limit", len(data), MaxSize)
+	}
+	data, err := normalize(data)
+	if err != nil {
+		return nil, err
+	}
+
+	list := describe(name, data)
+	list.Description = strings.TrimSpace(description)
+	if list.Entries == 0 {
+		return nil, fmt.Errorf("wordlist has no entries")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.lists[name]; ok {
+		if existing.Builtin {
+			return nil, ErrBuiltin
+		}
+		return nil, ErrExists
+	}
+	if err := os.WriteFile(s.pathLocked(list), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write wordlist: %w", err)
+	}
+	s.lists[name] = list
+	if err := s.saveIndexLocked(); err != nil {
+		delete(s.lists, name)
+		os.Remove(s.pathLocked(list))
+		return nil, fmt.Errorf("failed to save wordlist index: %w", err)
+	}
+	copied := *list
+	return &copied, nil
+}
+
+// Delete removes an uploaded list and its expanded copies.
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, ok := s.lists[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if list.Builtin {
+		return ErrBuiltin
+	}
+	delete(s.lists, name)
+	if err := s.saveIndexLocked(); err != nil {
+		s.lists[name] = list
+		return fmt.Errorf("failed to save wordlist index: %w", err)
+	}
+	path := s.pathLocked(list)
+	delete(s.verified, path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Wordlists: failed to remove %s: %v", path, err)
+	}
+	expanded, _ := filepath.Glob(filepath.Join(s.dir, expandedDir, name+"-"+strings.Repeat("[0-9a-f]", 16)+".txt"))
+	for _, path := range expanded {
+		os.Remove(path)
+	}
+	return nil
+}
+
+// Verify re-hashes every list, or the named ones, restoring built-in lists
+// that do not match. Lists that fail are marked with the reason until they
+// pass again.
+func (s *Store) Verify(names ...string) []Check {
+	if len(names) == 0 {
+		for _, list := range s.List() {
+			names = append(names, list.Name)
+		}
+	}
+	checks := make([]Check, 0, len(names))
+	for _, name := range names {
+		s.mu.Lock()
+		list, ok := s.lists[name]
+		if !ok {
+			s.mu.Unlock()
+			checks = append(checks, Check{Name: name, Error: ErrNotFound.Error()})
+			continue
+		}
+		path := s.pathLocked(list)
+		delete(s.verified, path)
+		s.mu.Unlock()
+
+		check := Check{Name: name, SHA256: list.SHA256}
+		_, restored, err := s.check(name)
+		check.Restored = restored
+		if err != nil {
+			check.Error = err.Error()
+			check.Actual, _ = hashFile(path)
+		} else {
+			check.OK = true
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// verifiedPath returns the path of a list that passed its integrity check.
+func (s *Store) verifiedPath(name string) (string, error) {
+	path, _, err := s.check(name)
+	return path, err
+}
+
+// check hashes a list's file unless it is unchanged since it last passed.
+// A built-in list that does not match is rewritten from the shipped copy.
+func (s *Store) check(name string) (path string, restored bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, ok := s.lists[name]
+	if !ok {
+		return "", false, ErrNotFound
+	}
+	path = s.pathLocked(list)
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		if v, ok := s.verified[path]; ok && v.size == info.Size() && v.modTime.Equal(info.ModTime()) {
+			return path, false, nil
+		}
+	}
+
+	actual, hashErr := hashFile(path)
+	if hashErr == nil && actual == list.SHA256 {
+		list.Error = ""
+		if info, err := os.Stat(path); err == nil {
+			s.verified[path] = verified{size: info.Size(), modTime: info.ModTime()}
+		}
+		return path, false, nil
+	}
+
+	if list.Builtin {
+		for _, b := range builtins {
+			if b.name == list.Name {
+				if err := os.WriteFile(path, b.data(), 0644); err != nil {
+					list.Error = "restore failed: " + err.Error()
+					return "", false, fmt.Errorf("wordlist %s failed its integrity check and could not be restored: %w", name, err)
+				}
+				log.Printf("Wordlists: restored built-in list %s, which did not match its hash", name)
+				list.Error = ""
+				if info, err := os.Stat(path); err == nil {
+					s.verified[path] = verified{size: info.Size(), modTime: info.ModTime()}
+				}
+				return path, true, nil
+			}
+		}
+	}
+
+	if hashErr != nil {
+		list.Error = "unreadable: " + hashErr.Error()
+		return "", false, fmt.Errorf("wordlist %s is unreadable: %w", name, hashErr)
+	}
+	list.Error = "sha256 mismatch: file is " + actual
+	return "", false, fmt.Errorf("wordlist %s failed its integrity check: its sha256 is %s, expected %s", name, actual, list.SHA256)
+}
+
+// normalize checks data is text and ends every line with a single newline.
+func normalize(data []byte) ([]byte, error) {
+	text := string(data)
+	if strings.ContainsRune(text, 0) {
+		return nil, fmt.Errorf("wordlist is not a text file")
+	}
+	text = strings.TrimPrefix(text, "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return nil, fmt.Errorf("wordlist has no entries")
+	}
+	return []byte(text + "\n"), nil
+}
+
+// describe records the size, hash and entries of a list's content.
+func describe(name string, data []byte) *Wordlist {
+	sum := sha256.Sum256(data)
+	list := &Wordlist{
+		Name:      name,
+		Size:      int64(len(data)),
+		SHA256:    hex.EncodeToString(sum[:]),
+		CreatedAt: time.Now().UTC(),
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list.Entries++
+		if !list.Templated && targetPlaceholder.MatchString(line) {
+			list.Templated = true
+		}
+	}
+	return list
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,407 @@
+// Package workspaces separates the engagements run on one instance. Every
+// config, session, operation, finding and asset belongs to a workspace, and
+// API requests only ever see the resources of the workspace they select.
+package workspaces
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"performa-backend/database"
+
+	"github.com/google/uuid"
+)
+
+// DefaultID is the workspace of requests that select none, and of every
+// resource created before workspaces existed.
+const DefaultID = "default"
+
+// apiKeyPrefix marks Performa workspace API keys.
+const apiKeyPrefix = "pfk_"
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// APIKey grants access to one workspace. Only a SHA-256 hash of the key is
+// kept; the key itself is returned once, when it is created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Hash       string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Workspace is a tenant. Members, when set, lists the users allowed to
+// select it; otherwise any user may.
+type Workspace struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Members     []string  `json:"members"`
+	APIKeys     []APIKey  `json:"api_keys"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// storedAPIKey is APIKey as persisted, including its hash.
+type storedAPIKey struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+type storedWorkspace struct {
+	Workspace
+	APIKeys []storedAPIKey `json:"api_keys"`
+}
+
+func (w *Workspace) clone() *Workspace {
+	copied := *w
+	copied.Members = append([]string{}, w.Members...)
+	copied.APIKeys = append([]APIKey{}, w.APIKeys...)
+	return &copied
+}
+
+// HasMember reports whether userID may select the workspace.
+func (w *Workspace) HasMember(userID string) bool {
+	if len(w.Members) == 0 {
+		return true
+	}
+	for _, member := range w.Members {
+		if member == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize maps the empty workspace ID of legacy resources to DefaultID.
+func Normalize(id string) string {
+	if id == "" {
+		return DefaultID
+	}
+	return id
+}
+
+// Validate checks the workspace's ID and name.
+func (w *Workspace) Validate() error {
+	if !idPattern.MatchString(w.ID) {
+		return fmt.Errorf("id must be 1-63 lowercase letters, digits, _ or -, starting with a letter or digit")
+	}
+	if strings.TrimSpace(w.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	return nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type Store struct {
+	workspaces map[string]*Workspace
+	// keys maps API key hashes to their workspace.
+	keys map[string]string
+	mu   sync.RWMutex
+}
+
+var Default = newStore()
+
+func newStore() *Store {
+	now := time.Now()
+	return &Store{
+		workspaces: map[string]*Workspace{
+			DefaultID: {ID: DefaultID, Name: "Default", Members: []string{}, APIKeys: []APIKey{}, CreatedAt: now, UpdatedAt: now},
+		},
+		keys: make(map[string]string),
+	}
+}
+
+// Create adds a workspace. The ID, when empty, is derived from the name.
+func (s *Store) Create(workspace Workspace) (*Workspace, error) {
+	if workspace.ID == "" {
+		workspace.ID = slugify(workspace.Name)
+	}
+	if err := workspace.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	workspace.APIKeys = []APIKey{}
+	if workspace.Members == nil {
+		workspace.Members = []string{}
+	}
+	workspace.CreatedAt = now
+	workspace.UpdatedAt = now
+
+	s.mu.Lock()
+	if _, exists := s.workspaces[workspace.ID]; exists {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("workspace %q already exists", workspace.ID)
+	}
+	stored := workspace.clone()
+	s.workspaces[stored.ID] = stored
+	result := stored.clone()
+	s.mu.Unlock()
+
+	s.persist(result)
+	return result, nil
+}
+
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if len(slug) > 63 {
+		slug = slug[:63]
+	}
+	return slug
+}
+
+func (s *Store) Get(id string) *Workspace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if workspace, ok := s.workspaces[Normalize(id)]; ok {
+		return workspace.clone()
+	}
+	return nil
+}
+
+// GetAll returns the workspaces sorted by name, the default one first.
+func (s *Store) GetAll() []*Workspace {
+	s.mu.RLock()
+	all := make([]*Workspace, 0, len(s.workspaces))
+	for _, workspace := range s.workspaces {
+		all = append(all, workspace.clone())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].ID == DefaultID || all[j].ID == DefaultID {
+			return all[i].ID == DefaultID
+		}
+		return strings.ToLower(all[i].Name) < strings.ToLower(all[j].Name)
+	})
+	return all
+}
+
+// Update changes a workspace's name, description or members; nil fields are
+// left unchanged. It returns nil, nil when the workspace does not exist.
+func (s *Store) Update(id string, name, description *string, members []string) (*Workspace, error) {
+	s.mu.Lock()
+	workspace, ok := s.workspaces[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	updated := workspace.clone()
+	if name != nil {
+		updated.Name = *name
+	}
+	if description != nil {
+		updated.Description = *description
+	}
+	if members != nil {
+		updated.Members = members
+	}
+	if err := updated.Validate(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	updated.UpdatedAt = time.Now()
+	s.workspaces[updated.ID] = updated
+	result := updated.clone()
+	s.mu.Unlock()
+
+	s.persist(result)
+	return result, nil
+}
+
+// Delete removes a workspace and revokes its API keys. The default workspace
+// cannot be deleted.
+func (s *Store) Delete(id string) (bool, error) {
+	if id == DefaultID {
+		return false, fmt.Errorf("the default workspace cannot be deleted")
+	}
+
+	s.mu.Lock()
+	workspace, exists := s.workspaces[id]
+	if exists {
+		for _, key := range workspace.APIKeys {
+			delete(s.keys, key.Hash)
+		}
+		delete(s.workspaces, id)
+	}
+	s.mu.Unlock()
+
+	if exists && database.DB != nil {
+		database.DeleteWorkspace(id)
+	}
+	return exists, nil
+}
+
+// CreateAPIKey issues a key for the workspace and returns it along with its
+// record. The key cannot be retrieved again.
+func (s *Store) CreateAPIKey(workspaceID, name string) (string, *APIKey, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(random)
+	record := APIKey{
+		ID:        uuid.New().String(),
+		Name:      strings.TrimSpace(name),
+		Hint:      key[:len(apiKeyPrefix)+4] + "****" + key[len(key)-4:],
+		Hash:      hashKey(key),
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	workspace, ok := s.workspaces[workspaceID]
+	if !ok {
+		s.mu.Unlock()
+		return "", nil, fmt.Errorf("workspace not found")
+	}
+	workspace.APIKeys = append(workspace.APIKeys, record)
+	workspace.UpdatedAt = time.Now()
+	s.keys[record.Hash] = workspace.ID
+	result := workspace.clone()
+	s.mu.Unlock()
+
+	s.persist(result)
+	return key, &record, nil
+}
+
+// RevokeAPIKey deletes one of the workspace's keys.
+func (s *Store) RevokeAPIKey(workspaceID, keyID string) bool {
+	s.mu.Lock()
+	workspace, ok := s.workspaces[workspaceID]
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+	found := false
+	kept := workspace.APIKeys[:0]
+	for _, key := range workspace.APIKeys {
+		if key.ID == keyID {
+			delete(s.keys, key.Hash)
+			found = true
+			continue
+		}
+		kept = append(kept, key)
+	}
+	workspace.APIKeys = kept
+	result := workspace.clone()
+	s.mu.Unlock()
+
+	if found {
+		s.persist(result)
+	}
+	return found
+}
+
+// ResolveAPIKey returns the workspace a key belongs to, or nil for an unknown
+// key, and records that the key was used.
+func (s *Store) ResolveAPIKey(key string) *Workspace {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil
+	}
+	hash := hashKey(key)
+
+	s.mu.Lock()
+	id, ok := s.keys[hash]
+	if !ok {
+		s.mu.Unlock()
+		return nil
+	}
+	workspace := s.workspaces[id]
+	now := time.Now()
+	for i := range workspace.APIKeys {
+		if workspace.APIKeys[i].Hash == hash {
+			workspace.APIKeys[i].LastUsedAt = &now
+		}
+	}
+	result := workspace.clone()
+	s.mu.Unlock()
+
+	return result
+}
+
+func (s *Store) persist(workspace *Workspace) {
+	if database.DB == nil {
+		return
+	}
+
+	stored := storedWorkspace{Workspace: *workspace}
+	for _, key := range workspace.APIKeys {
+		stored.APIKeys = append(stored.APIKeys, storedAPIKey{APIKey: key, Hash: key.Hash})
+	}
+	data, _ := json.Marshal(stored)
+	record := database.WorkspaceRecord{
+		ID:        workspace.ID,
+		Name:      workspace.Name,
+		Data:      data,
+		CreatedAt: workspace.CreatedAt,
+		UpdatedAt: workspace.UpdatedAt,
+	}
+	if err := database.SaveWorkspace(record); err != nil {
+		log.Printf("Workspaces: failed to persist workspace %s: %v", workspace.ID, err)
+	}
+}
+
+// Load restores workspaces and their API keys from the database.
+func (s *Store) Load() {
+	if database.DB == nil {
+		return
+	}
+
+	records, err := database.GetAllWorkspaces()
+	if err != nil {
+		log.Printf("Workspaces: failed to load workspaces: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		var stored storedWorkspace
+		if err := json.Unmarshal(record.Data, &stored); err != nil {
+			log.Printf("Workspaces: skipping invalid workspace %s: %v", record.ID, err)
+			continue
+		}
+		workspace := stored.Workspace
+		workspace.ID = record.ID
+		workspace.APIKeys = []APIKey{}
+		for _, key := range stored.APIKeys {
+			key.APIKey.Hash = key.Hash
+			workspace.APIKeys = append(workspace.APIKeys, key.APIKey)
+			s.keys[key.Hash] = record.ID
+		}
+		if workspace.Members == nil {
+			workspace.Members = []string{}
+		}
+		s.workspaces[record.ID] = &workspace
+	}
+}
@@ -0,0 +1,140 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultBackplaneChannel is the Redis channel hub broadcasts are fanned out on.
+const DefaultBackplaneChannel = "performa:ws:broadcast"
+
+// backplaneEnvelope wraps a broadcast with the instance that produced it, so an
+// instance can skip its own messages when they come back from Redis.
+type backplaneEnvelope struct {
+	Origin  string          `json:"origin"`
+	Message json.RawMessage `json:"message"`
+}
+
+// redisBackplane relays hub broadcasts between backend replicas over Redis
+// pub/sub. Every replica publishes what it broadcasts locally and delivers
+// what the others publish to its own clients.
+type redisBackplane struct {
+	client   *redis.Client
+	pubsub   *redis.PubSub
+	channel  string
+	instance string
+	outgoing chan []byte
+}
+
+// UseRedis connects the hub to the Redis server at redisURL and starts
+// relaying broadcasts through channel. Until it is called the hub only
+// reaches clients connected to this instance.
+func (h *Hub) UseRedis(redisURL, channel string) error {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	if channel == "" {
+		channel = DefaultBackplaneChannel
+	}
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	pubsub := client.Subscribe(context.Background(), channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		client.Close()
+		return fmt.Errorf("failed to subscribe to %s: %w", channel, err)
+	}
+
+	backplane := &redisBackplane{
+		client:   client,
+		pubsub:   pubsub,
+		channel:  channel,
+		instance: uuid.New().String(),
+		outgoing: make(chan []byte, 256),
+	}
+
+	h.mu.Lock()
+	h.backplane = backplane
+	h.mu.Unlock()
+
+	go backplane.receive(h)
+	go backplane.send()
+	log.Printf("WebSocket backplane connected (redis channel %s, instance %s)", channel, backplane.instance)
+	return nil
+}
+
+// publish queues a locally broadcast message for the other replicas without
+// blocking the hub; messages are dropped while Redis is too slow to keep up.
+func (b *redisBackplane) publish(data []byte) {
+	select {
+	case b.outgoing <- data:
+	default:
+		log.Printf("WebSocket backplane: publish queue full, dropping message")
+	}
+}
+
+// send publishes queued messages one at a time so other replicas receive them
+// in the order they were broadcast.
+func (b *redisBackplane) send() {
+	for data := range b.outgoing {
+		payload, err := json.Marshal(backplaneEnvelope{Origin: b.instance, Message: data})
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := b.client.Publish(ctx, b.channel, payload).Err(); err != nil {
+			log.Printf("WebSocket backplane: publish failed: %v", err)
+		}
+		cancel()
+	}
+}
+
+// receive delivers broadcasts from other replicas to this hub's clients until
+// the subscription is closed. go-redis reconnects the subscription on its own
+// after network errors.
+func (b *redisBackplane) receive(h *Hub) {
+	for msg := range b.pubsub.Channel() {
+		var envelope backplaneEnvelope
+		if err := json.Unmarshal([]byte(msg.Payload), &envelope); err != nil {
+			log.Printf("WebSocket backplane: dropping malformed message: %v", err)
+			continue
+		}
+		if envelope.Origin == b.instance {
+			continue
+		}
+		h.remote <- envelope.Message
+	}
+}
+
+func (b *redisBackplane) close() {
+	close(b.outgoing)
+	b.pubsub.Close()
+	b.client.Close()
+}
+
+// CloseBackplane disconnects the hub from Redis; broadcasts stay local from
+// then on.
+func (h *Hub) CloseBackplane() {
+	h.mu.Lock()
+	backplane := h.backplane
+	h.backplane = nil
+	h.mu.Unlock()
+
+	if backplane != nil {
+		backplane.close()
+	}
+}
@@ -0,0 +1,59 @@
+package ws
+
+// Command is an operator action sent over the connection, e.g.
+// {"type":"command","id":"7","action":"pause_agent","agent_id":"..."}. ID is
+// the client's correlation ID, echoed in the result.
+type Command struct {
+	ID          string `json:"id,omitempty"`
+	Action      string `json:"action"`
+	AgentID     string `json:"agent_id,omitempty"`
+	FindingID   string `json:"finding_id,omitempty"`
+	OperationID string `json:"operation_id,omitempty"`
+}
+
+// CommandResult answers a command in a "command_result" message. Code is
+// the HTTP status the equivalent REST call would have returned.
+type CommandResult struct {
+	ID     string      `json:"id,omitempty"`
+	Action string      `json:"action"`
+	OK     bool        `json:"ok"`
+	Code   int         `json:"code"`
+	Error  string      `json:"error,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// Session is what a command handler knows about the connection a command
+// came from: its workspace and the request locals set when it was
+// authenticated.
+type Session struct {
+	Workspace string
+	Locals    func(key string) interface{}
+}
+
+// ExecuteCommand runs an operator command. It is set by the handlers
+// package, which authorizes commands like the equivalent REST calls.
+var ExecuteCommand func(session Session, command Command) CommandResult
+
+// runCommand executes a command sent by client and sends back its result.
+// Replay requests are served by the hub itself.
+func runCommand(client *Client, session Session, command Command) {
+	var result CommandResult
+	switch {
+	case command.Action == "replay":
+		result = CommandResult{ID: command.ID, Action: command.Action, OK: true, Code: 200}
+		replayTimeline(client, command.OperationID)
+	case ExecuteCommand == nil:
+		result = CommandResult{ID: command.ID, Action: command.Action, Code: 503, Error: "commands are not available"}
+	default:
+		result = ExecuteCommand(session, command)
+		result.ID, result.Action = command.ID, command.Action
+	}
+	client.writeJSON(WSMessage{Type: "command_result", Status: commandStatus(result), Data: result})
+}
+
+func commandStatus(result CommandResult) string {
+	if result.OK {
+		return "ok"
+	}
+	return "error"
+}
@@ -0,0 +1,186 @@
+package ws
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Client encodings, chosen with the ?encoding= query parameter when
+// connecting.
+const (
+	EncodingJSON    = "json"
+	EncodingMsgPack = "msgpack"
+)
+
+// CoalesceInterval is how often coalesced topics are flushed: each topic
+// sends at most one frame per interval.
+const CoalesceInterval = time.Second
+
+// clientOptions are negotiated per connection. Batch clients get the
+// messages of a flush in one {"type":"batch","data":[...]} frame.
+type clientOptions struct {
+	encoding string
+	batch    bool
+	mu       sync.Mutex
+}
+
+// write sends one frame to the client in its encoding. Writes are
+// serialized because a connection allows only one concurrent writer.
+func (c *Client) write(frame *frame) error {
+	c.opts.mu.Lock()
+	defer c.opts.mu.Unlock()
+
+	if c.opts.encoding == EncodingMsgPack {
+		data, err := frame.msgpack()
+		if err != nil {
+			return err
+		}
+		return c.Conn.WriteMessage(websocket.BinaryMessage, data)
+	}
+	return c.Conn.WriteMessage(websocket.TextMessage, frame.json)
+}
+
+// writeJSON sends a reply to this client only, in its encoding.
+func (c *Client) writeJSON(message WSMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return c.write(&frame{json: data})
+}
+
+// frame is an encoded message. The MessagePack form is derived from the JSON
+// on first use and shared by every MessagePack client.
+type frame struct {
+	json    []byte
+	packed  []byte
+	packErr error
+	once    sync.Once
+}
+
+func (f *frame) msgpack() ([]byte, error) {
+	f.once.Do(func() {
+		var decoded interface{}
+		if f.packErr = json.Unmarshal(f.json, &decoded); f.packErr == nil {
+			f.packed, f.packErr = msgpack.Marshal(decoded)
+		}
+	})
+	return f.packed, f.packErr
+}
+
+// batchFrame wraps several encoded messages in a single frame.
+func batchFrame(messages [][]byte) *frame {
+	raw := make([]json.RawMessage, len(messages))
+	for i, data := range messages {
+		raw[i] = data
+	}
+	data, _ := json.Marshal(struct {
+		Type string            `json:"type"`
+		Data []json.RawMessage `json:"data"`
+	}{"batch", raw})
+	return &frame{json: data}
+}
+
+// coalesce queues message under topic, replacing any message for the topic
+// that has not been flushed yet.
+func (h *Hub) coalesce(topic string, message WSMessage) {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	if _, queued := h.pending[topic]; !queued {
+		h.pendingOrder = append(h.pendingOrder, topic)
+	}
+	h.pending[topic] = message
+}
+
+// takePending returns the queued messages in the order their topics were
+// first queued and empties the queue.
+func (h *Hub) takePending() []WSMessage {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	messages := make([]WSMessage, 0, len(h.pendingOrder))
+	for _, topic := range h.pendingOrder {
+		messages = append(messages, h.pending[topic])
+	}
+	h.pending = make(map[string]WSMessage)
+	h.pendingOrder = nil
+	return messages
+}
+
+// flush broadcasts the coalesced messages: individually to listeners, the
+// backplane and ordinary clients, and as one frame to batch clients.
+func (h *Hub) flush() {
+	messages := h.takePending()
+	if len(messages) == 0 {
+		return
+	}
+
+	encoded := make([][]byte, len(messages))
+	frames := make([]*frame, len(messages))
+	owners := make([]string, len(messages))
+	for i, message := range messages {
+		encoded[i], _ = json.Marshal(message)
+		frames[i] = &frame{json: encoded[i]}
+		owners[i] = MessageWorkspace(message)
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	// Batch clients of one workspace share a frame.
+	batches := make(map[string]*frame)
+	for client := range h.clients {
+		if client.opts.batch {
+			batch, built := batches[client.workspace]
+			if !built {
+				visible := make([][]byte, 0, len(encoded))
+				for i, data := range encoded {
+					if client.receives(owners[i]) {
+						visible = append(visible, data)
+					}
+				}
+				if len(visible) > 0 {
+					batch = batchFrame(visible)
+				}
+				batches[client.workspace] = batch
+			}
+			if batch != nil {
+				h.send(client, batch)
+			}
+			continue
+		}
+		for i, f := range frames {
+			if client.receives(owners[i]) {
+				h.send(client, f)
+			}
+		}
+	}
+	for _, data := range encoded {
+		h.notifyListeners(data)
+		if h.backplane != nil {
+			h.backplane.publish(data)
+		}
+	}
+}
+
+// decodeClientMessage reads a message sent by the client, which may use
+// MessagePack if it negotiated it; JSON is always accepted.
+func decodeClientMessage(client *Client, data []byte, message interface{}) error {
+	if err := json.Unmarshal(data, message); err == nil || client.opts.encoding != EncodingMsgPack {
+		return err
+	}
+	var decoded map[string]interface{}
+	if err := msgpack.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(decoded)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, message)
+}
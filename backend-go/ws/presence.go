@@ -0,0 +1,166 @@
+package ws
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// maxSubscriptions bounds the operations one connection may subscribe to.
+const maxSubscriptions = 50
+
+// Identity is who a connection authenticated as. It is empty for anonymous
+// connections, made while authentication is disabled.
+type Identity struct {
+	UserID   string `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Role     string `json:"role,omitempty"`
+	// APIKey is set for connections made with a workspace API key.
+	APIKey bool `json:"api_key,omitempty"`
+}
+
+// IdentifyClient returns the identity of a connection from the request
+// locals set when it was authenticated. It is set by the handlers package,
+// which knows how they are stored.
+var IdentifyClient func(locals func(key string) interface{}) Identity
+
+// presence is what the hub tracks about a connection besides its options.
+type presence struct {
+	identity    Identity
+	remoteAddr  string
+	userAgent   string
+	connectedAt time.Time
+
+	mu            sync.Mutex
+	lastActivity  time.Time
+	received      int
+	subscriptions map[string]bool
+}
+
+// ClientInfo describes a connection to this instance. ID is the one the hub
+// gave it; ClientID is the one the client chose with ?id=. Subscriptions are
+// the operations the client said it is watching.
+type ClientInfo struct {
+	ID            string    `json:"id"`
+	ClientID      string    `json:"client_id"`
+	Identity      Identity  `json:"identity"`
+	Workspace     string    `json:"workspace"`
+	Encoding      string    `json:"encoding"`
+	Batch         bool      `json:"batch"`
+	Subscriptions []string  `json:"subscriptions"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+	UserAgent     string    `json:"user_agent,omitempty"`
+	ConnectedAt   time.Time `json:"connected_at"`
+	LastActivity  time.Time `json:"last_activity"`
+	Received      int       `json:"messages_received"`
+}
+
+// info returns a snapshot of the client's presence.
+func (c *Client) info() ClientInfo {
+	c.presence.mu.Lock()
+	defer c.presence.mu.Unlock()
+	subscriptions := make([]string, 0, len(c.presence.subscriptions))
+	for operationID := range c.presence.subscriptions {
+		subscriptions = append(subscriptions, operationID)
+	}
+	sort.Strings(subscriptions)
+	return ClientInfo{
+		ID:            c.SessionID,
+		ClientID:      c.ID,
+		Identity:      c.presence.identity,
+		Workspace:     c.workspace,
+		Encoding:      c.opts.encoding,
+		Batch:         c.opts.batch,
+		Subscriptions: subscriptions,
+		RemoteAddr:    c.presence.remoteAddr,
+		UserAgent:     c.presence.userAgent,
+		ConnectedAt:   c.presence.connectedAt,
+		LastActivity:  c.presence.lastActivity,
+		Received:      c.presence.received,
+	}
+}
+
+// touch records a message received from the client.
+func (c *Client) touch() {
+	c.presence.mu.Lock()
+	defer c.presence.mu.Unlock()
+	c.presence.lastActivity = time.Now()
+	c.presence.received++
+}
+
+// subscribe adds or removes an operation the client is watching and reports
+// whether its subscriptions changed.
+func (c *Client) subscribe(operationID string, on bool) bool {
+	if operationID == "" {
+		return false
+	}
+	c.presence.mu.Lock()
+	defer c.presence.mu.Unlock()
+	if c.presence.subscriptions[operationID] == on {
+		return false
+	}
+	if on {
+		if len(c.presence.subscriptions) >= maxSubscriptions {
+			return false
+		}
+		c.presence.subscriptions[operationID] = true
+	} else {
+		delete(c.presence.subscriptions, operationID)
+	}
+	return true
+}
+
+// Clients returns the connections to this instance, oldest first. With a
+// backplane, other instances' connections are not included.
+func (h *Hub) Clients() []ClientInfo {
+	h.mu.RLock()
+	clients := make([]ClientInfo, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client.info())
+	}
+	h.mu.RUnlock()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+	return clients
+}
+
+// Disconnect closes the connection with the given hub ID, telling the
+// client why, and returns what it was. It reports false when no such client
+// is connected to this instance. The client leaves the hub when its read
+// loop notices.
+func (h *Hub) Disconnect(id, reason string) (ClientInfo, bool) {
+	h.mu.RLock()
+	var target *Client
+	for client := range h.clients {
+		if client.SessionID == id {
+			target = client
+			break
+		}
+	}
+	h.mu.RUnlock()
+	if target == nil {
+		return ClientInfo{}, false
+	}
+
+	info := target.info()
+	target.writeJSON(WSMessage{Type: "disconnected", Message: reason})
+	target.opts.mu.Lock()
+	target.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason), time.Now().Add(time.Second))
+	target.opts.mu.Unlock()
+	target.Conn.Close()
+	return info, true
+}
+
+// presenceMessage tells the clients of a connection's workspace that it
+// joined, left or changed what it watches.
+func presenceMessage(client *Client, status string) WSMessage {
+	return WSMessage{
+		Type:      "presence",
+		Status:    status,
+		Data:      client.info(),
+		Workspace: client.workspace,
+	}
+}
@@ -0,0 +1,70 @@
+package ws
+
+import "sync"
+
+// ReplaySize is how many timeline events the hub keeps so clients that
+// connect late or reconnect can catch up.
+const ReplaySize = 1000
+
+type replayBuffer struct {
+	messages []WSMessage
+	next     int
+	full     bool
+	mu       sync.RWMutex
+}
+
+var replay = &replayBuffer{messages: make([]WSMessage, ReplaySize)}
+
+func (r *replayBuffer) add(message WSMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages[r.next] = message
+	r.next = (r.next + 1) % len(r.messages)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// events returns the buffered events client may see, oldest first,
+// optionally only those of one operation.
+func (r *replayBuffer) events(client *Client, operationID string) []interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ordered := r.messages[:r.next]
+	if r.full {
+		ordered = append(append([]WSMessage(nil), r.messages[r.next:]...), r.messages[:r.next]...)
+	}
+
+	events := make([]interface{}, 0, len(ordered))
+	for _, message := range ordered {
+		if (operationID == "" || message.Message == operationID) && client.receives(MessageWorkspace(message)) {
+			events = append(events, message.Data)
+		}
+	}
+	return events
+}
+
+// BroadcastTimelineEvent sends an operation timeline event to clients and
+// keeps it in the replay buffer.
+func BroadcastTimelineEvent(operationID string, event interface{}) {
+	message := WSMessage{
+		Type:    "timeline_event",
+		Message: operationID,
+		Data:    event,
+	}
+	replay.add(message)
+	MainHub.broadcast <- message
+}
+
+// replayTimeline answers a {"type":"replay","message":"<operation_id>"}
+// request with the buffered events in one frame. An empty operation ID
+// replays every operation.
+func replayTimeline(client *Client, operationID string) error {
+	return client.writeJSON(WSMessage{
+		Type:    "replay",
+		Message: operationID,
+		Data:    replay.events(client, operationID),
+	})
+}
@@ -4,14 +4,45 @@ import (
         "encoding/json"
         "log"
         "sync"
+        "time"
+
+        "performa-backend/workspaces"
 
         "github.com/gofiber/fiber/v2"
         "github.com/gofiber/websocket/v2"
+        "github.com/google/uuid"
 )
 
 type Client struct {
         Conn *websocket.Conn
         ID   string
+        // SessionID identifies the connection in the hub; ID is whatever the
+        // client called itself and need not be unique.
+        SessionID string
+        opts      clientOptions
+        presence  presence
+        // workspace is the workspace the connection selected; the client only
+        // receives messages of that workspace and global ones.
+        workspace string
+}
+
+// WorkspaceOf returns the workspace a message belongs to, or "" for messages
+// every client may receive. It is set by the handlers package, which knows
+// which workspace an agent or operation belongs to.
+var WorkspaceOf func(message WSMessage) string
+
+// MessageWorkspace returns the workspace whose clients may receive a
+// message, or "" when every client may.
+func MessageWorkspace(message WSMessage) string {
+        if message.Workspace != "" || WorkspaceOf == nil {
+                return message.Workspace
+        }
+        return WorkspaceOf(message)
+}
+
+// receives reports whether the client may see a message of workspace.
+func (c *Client) receives(workspace string) bool {
+        return workspace == "" || workspace == c.workspace
 }
 
 type WSMessage struct {
@@ -24,6 +55,8 @@ type WSMessage struct {
         Memory  float64     `json:"memory_usage,omitempty"`
         Disk    float64     `json:"disk_usage,omitempty"`
         Network float64     `json:"network_usage,omitempty"`
+        // Workspace limits the message to the clients of one workspace.
+        Workspace string    `json:"workspace,omitempty"`
 }
 
 type Hub struct {
@@ -31,7 +64,14 @@ type Hub struct {
         broadcast  chan WSMessage
         register   chan *Client
         unregister chan *Client
+        remote     chan []byte
+        backplane  *redisBackplane
+        listeners  map[chan []byte]struct{}
         mu         sync.RWMutex
+
+        pending      map[string]WSMessage
+        pendingOrder []string
+        pendingMu    sync.Mutex
 }
 
 var MainHub = &Hub{
@@ -39,39 +79,148 @@ var MainHub = &Hub{
         broadcast:  make(chan WSMessage, 256),
         register:   make(chan *Client),
         unregister: make(chan *Client),
+        remote:     make(chan []byte, 256),
+        listeners:  make(map[chan []byte]struct{}),
+        pending:    make(map[string]WSMessage),
 }
 
 func (h *Hub) Run() {
+        ticker := time.NewTicker(CoalesceInterval)
+        defer ticker.Stop()
+
         for {
                 select {
                 case client := <-h.register:
                         h.mu.Lock()
                         h.clients[client] = true
                         h.mu.Unlock()
-                        log.Printf("Client connected: %s", client.ID)
+                        log.Printf("Client connected: %s (%s)", client.ID, client.SessionID)
+                        h.publish(presenceMessage(client, "join"))
 
                 case client := <-h.unregister:
                         h.mu.Lock()
-                        if _, ok := h.clients[client]; ok {
+                        _, ok := h.clients[client]
+                        if ok {
                                 delete(h.clients, client)
                                 client.Conn.Close()
                         }
                         h.mu.Unlock()
-                        log.Printf("Client disconnected: %s", client.ID)
+                        log.Printf("Client disconnected: %s (%s)", client.ID, client.SessionID)
+                        if ok {
+                                h.publish(presenceMessage(client, "leave"))
+                        }
 
                 case message := <-h.broadcast:
-                        h.mu.RLock()
-                        data, _ := json.Marshal(message)
-                        for client := range h.clients {
-                                if err := client.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
-                                        log.Printf("Error sending message to client %s: %v", client.ID, err)
-                                }
-                        }
-                        h.mu.RUnlock()
+                        h.publish(message)
+
+                case data := <-h.remote:
+                        h.deliver(data)
+
+                case <-ticker.C:
+                        h.flush()
+                }
+        }
+}
+
+// publish delivers a message to this instance's clients and, through the
+// backplane, to the other instances'.
+func (h *Hub) publish(message WSMessage) {
+        data, _ := json.Marshal(message)
+        h.deliver(data)
+
+        h.mu.RLock()
+        if h.backplane != nil {
+                h.backplane.publish(data)
+        }
+        h.mu.RUnlock()
+}
+
+// deliver writes an encoded message to every client connected to this
+// instance and to every listener. Slow listeners drop messages rather than
+// holding up the hub.
+func (h *Hub) deliver(data []byte) {
+        workspace := ""
+        var message WSMessage
+        if json.Unmarshal(data, &message) == nil {
+                workspace = MessageWorkspace(message)
+        }
+
+        h.mu.RLock()
+        defer h.mu.RUnlock()
+
+        f := &frame{json: data}
+        for client := range h.clients {
+                if client.receives(workspace) {
+                        h.send(client, f)
+                }
+        }
+        h.notifyListeners(data)
+}
+
+// send must be called with h.mu held.
+func (h *Hub) send(client *Client, f *frame) {
+        if err := client.write(f); err != nil {
+                log.Printf("Error sending message to client %s: %v", client.ID, err)
+        }
+}
+
+// notifyListeners must be called with h.mu held.
+func (h *Hub) notifyListeners(data []byte) {
+        for ch := range h.listeners {
+                select {
+                case ch <- data:
+                default:
                 }
         }
 }
 
+// Listen returns a channel that receives every encoded message the hub
+// delivers from now on, the same feed WebSocket clients get, and a function
+// that cancels the subscription and closes the channel.
+func (h *Hub) Listen() (<-chan []byte, func()) {
+        h.mu.Lock()
+        defer h.mu.Unlock()
+
+        ch := make(chan []byte, 64)
+        h.listeners[ch] = struct{}{}
+
+        var once sync.Once
+        cancel := func() {
+                once.Do(func() {
+                        h.mu.Lock()
+                        defer h.mu.Unlock()
+                        delete(h.listeners, ch)
+                        close(ch)
+                })
+        }
+        return ch, cancel
+}
+
+// HubStats is a snapshot of the hub's connections for diagnostics.
+type HubStats struct {
+        Clients        int  `json:"clients"`
+        Listeners      int  `json:"listeners"`
+        PendingTopics  int  `json:"pending_topics"`
+        QueuedMessages int  `json:"queued_messages"`
+        Backplane      bool `json:"backplane"`
+}
+
+func (h *Hub) Stats() HubStats {
+        h.mu.RLock()
+        stats := HubStats{
+                Clients:        len(h.clients),
+                Listeners:      len(h.listeners),
+                QueuedMessages: len(h.broadcast),
+                Backplane:      h.backplane != nil,
+        }
+        h.mu.RUnlock()
+
+        h.pendingMu.Lock()
+        stats.PendingTopics = len(h.pendingOrder)
+        h.pendingMu.Unlock()
+        return stats
+}
+
 func BroadcastMessage(msgType string, content string) {
         MainHub.broadcast <- WSMessage{
                 Type:    msgType,
@@ -88,23 +237,193 @@ func BroadcastAgentUpdate(agentID string, status string, message string) {
         }
 }
 
-func BroadcastResources(cpu, memory, disk, network float64) {
+// BroadcastWorkspaceMessage is BroadcastMessage for the clients of one
+// workspace.
+func BroadcastWorkspaceMessage(workspace, msgType, content string) {
+        MainHub.broadcast <- WSMessage{
+                Type:      msgType,
+                Message:   content,
+                Workspace: workspace,
+        }
+}
+
+func BroadcastAgentsBulk(workspace, action string, results interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:      "agents_bulk_update",
+                Status:    action,
+                Data:      results,
+                Workspace: workspace,
+        }
+}
+
+func BroadcastAgentChunk(agentID string, content string) {
+        MainHub.broadcast <- WSMessage{
+                Type:    "agent_chat_chunk",
+                AgentID: agentID,
+                Message: content,
+        }
+}
+
+func BroadcastToolInstall(jobID string, tool string, status string, line string) {
+        MainHub.broadcast <- WSMessage{
+                Type:    "tool_install",
+                Message: line,
+                Status:  status,
+                Data: map[string]string{
+                        "job_id": jobID,
+                        "tool":   tool,
+                },
+        }
+}
+
+// BroadcastAgentReaper reports a change of an agent's liveness: "stale" when
+// its loop went silent, "recovered" when it reported in again, "reaped" when
+// the reaper marked it as failed and "crashed" when its goroutine panicked.
+func BroadcastAgentReaper(agentID, status, message string, agent interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:    "agent_reaper",
+                AgentID: agentID,
+                Status:  status,
+                Message: message,
+                Data:    agent,
+        }
+}
+
+// BroadcastAgentFailure reports a classified agent error and what its retry
+// policy did about it.
+func BroadcastAgentFailure(agentID string, failure interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:    "agent_failure",
+                AgentID: agentID,
+                Data:    failure,
+        }
+}
+
+func BroadcastCapabilityDenied(agentID string, denial interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:    "capability_denied",
+                AgentID: agentID,
+                Data:    denial,
+        }
+}
+
+func BroadcastBlackboardUpdate(operationID string, entry interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:    "blackboard_update",
+                Message: operationID,
+                Data:    entry,
+        }
+}
+
+// BroadcastBudget reports a change of an operation's budget state to the
+// clients of its workspace.
+func BroadcastBudget(workspace, operationID string, status interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:      "budget",
+                Message:   operationID,
+                Data:      status,
+                Workspace: workspace,
+        }
+}
+
+// BroadcastJob reports a background job that started or finished to the
+// clients of its workspace.
+func BroadcastJob(workspace, jobID, status string, job interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:      "job",
+                Message:   jobID,
+                Status:    status,
+                Data:      job,
+                Workspace: workspace,
+        }
+}
+
+// BroadcastRoEViolation reports something an operation's rules of
+// engagement refused to the clients of its workspace. operationID is empty
+// for a refused launch.
+func BroadcastRoEViolation(workspace, operationID string, violation interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:      "roe_violation",
+                Message:   operationID,
+                Data:      violation,
+                Workspace: workspace,
+        }
+}
+
+// BroadcastSpoofing reports the state of an operation's ARP or DNS spoofing
+// session to the clients of its workspace.
+func BroadcastSpoofing(workspace, operationID string, session interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:      "spoofing",
+                Message:   operationID,
+                Data:      session,
+                Workspace: workspace,
+        }
+}
+
+// BroadcastRetention tells every client what a retention run purged. summary
+// is a one-line notice, report the full run.
+func BroadcastRetention(summary string, report interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:    "retention",
+                Message: summary,
+                Data:    report,
+        }
+}
+
+// BroadcastOperationProgress reports a running operation's progress and ETA
+// to the clients of its workspace.
+func BroadcastOperationProgress(workspace, operationID string, progress interface{}) {
+        MainHub.broadcast <- WSMessage{
+                Type:      "operation_progress",
+                Message:   operationID,
+                Data:      progress,
+                Workspace: workspace,
+        }
+}
+
+// BroadcastCostUpdate reports what a running operation's model calls have
+// spent so far, and how fast, to the clients of its workspace.
+func BroadcastCostUpdate(workspace, operationID string, update interface{}) {
         MainHub.broadcast <- WSMessage{
+                Type:      "cost_update",
+                Message:   operationID,
+                Data:      update,
+                Workspace: workspace,
+        }
+}
+
+// BroadcastResources is coalesced: clients get at most one system resources
+// frame per CoalesceInterval.
+func BroadcastResources(cpu, memory, disk, network float64, details interface{}) {
+        MainHub.coalesce("resources", WSMessage{
                 Type:    "resources",
+                Data:    details,
                 CPU:     cpu,
                 Memory:  memory,
                 Disk:    disk,
                 Network: network,
-        }
+        })
 }
 
-func BroadcastResourceUpdate(agentID string, cpu, memory float64) {
+func BroadcastResourceAlert(alert interface{}) {
         MainHub.broadcast <- WSMessage{
+                Type: "resource_alert",
+                Data: alert,
+        }
+}
+
+// BroadcastResourceUpdate is coalesced per agent: clients get at most one
+// resources frame per agent per CoalesceInterval.
+func BroadcastResourceUpdate(agentID string, cpu, memory, disk, network float64) {
+        MainHub.coalesce("agent_resources:"+agentID, WSMessage{
                 Type:    "agent_resources",
                 AgentID: agentID,
                 CPU:     cpu,
                 Memory:  memory,
-        }
+                Disk:    disk,
+                Network: network,
+        })
 }
 
 func WebSocketUpgrade(c *fiber.Ctx) error {
@@ -114,11 +433,38 @@ func WebSocketUpgrade(c *fiber.Ctx) error {
         return fiber.ErrUpgradeRequired
 }
 
+// HandleWebSocket serves a live connection. ?encoding=msgpack switches the
+// client to binary MessagePack frames and ?batch=true delivers coalesced
+// updates as one batch frame per flush. Operators can control agents and
+// findings with "command" messages, answered by "command_result" ones.
+// "subscribe" and "unsubscribe" messages name an operation the client is
+// watching, which its presence shows to the other clients.
 func HandleWebSocket(c *websocket.Conn) {
+        now := time.Now()
         client := &Client{
-                Conn: c,
-                ID:   c.Query("id", "anonymous"),
+                Conn:      c,
+                ID:        c.Query("id", "anonymous"),
+                SessionID: uuid.NewString(),
+                workspace: workspaces.DefaultID,
+                presence: presence{
+                        remoteAddr:    c.RemoteAddr().String(),
+                        userAgent:     c.Headers("User-Agent"),
+                        connectedAt:   now,
+                        lastActivity:  now,
+                        subscriptions: make(map[string]bool),
+                },
+        }
+        if IdentifyClient != nil {
+                client.presence.identity = IdentifyClient(c.Locals)
+        }
+        if workspace, ok := c.Locals("workspace").(string); ok && workspace != "" {
+                client.workspace = workspace
+        }
+        client.opts.encoding = EncodingJSON
+        if c.Query("encoding") == EncodingMsgPack {
+                client.opts.encoding = EncodingMsgPack
         }
+        client.opts.batch = c.Query("batch") == "true"
 
         MainHub.register <- client
 
@@ -134,18 +480,32 @@ func HandleWebSocket(c *websocket.Conn) {
                         break
                 }
 
+                client.touch()
+
                 var wsMsg WSMessage
-                if err := json.Unmarshal(msg, &wsMsg); err != nil {
+                if err := decodeClientMessage(client, msg, &wsMsg); err != nil {
                         continue
                 }
 
                 switch wsMsg.Type {
                 case "ping":
-                        c.WriteJSON(WSMessage{Type: "pong"})
+                        client.writeJSON(WSMessage{Type: "pong"})
                 case "chat":
                         BroadcastMessage("chat", wsMsg.Message)
+                case "replay":
+                        replayTimeline(client, wsMsg.Message)
+                case "subscribe", "unsubscribe":
+                        if client.subscribe(wsMsg.Message, wsMsg.Type == "subscribe") {
+                                MainHub.broadcast <- presenceMessage(client, "update")
+                        }
                 case "get_updates":
-                        c.WriteJSON(WSMessage{Type: "system", Message: "Updates sent"})
+                        client.writeJSON(WSMessage{Type: "system", Message: "Updates sent"})
+                case "command":
+                        var command Command
+                        if err := decodeClientMessage(client, msg, &command); err != nil {
+                                continue
+                        }
+                        runCommand(client, Session{Workspace: client.workspace, Locals: c.Locals}, command)
                 }
         }
 }